@@ -0,0 +1,122 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RegisterHandler アカウントを作成してログインさせるハンドラー(POST /auth/register)
+// ユーザー名とパスワードを検証し、パスワードはbcryptでハッシュ化して保存する
+func RegisterHandler(users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var credentials Credentials
+		if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+		if apiErr := validateCredentials(credentials.Username, credentials.Password); apiErr != nil {
+			writeError(w, http.StatusBadRequest, apiErr)
+			return
+		}
+		taken, err := users.UsernameTaken(r.Context(), credentials.Username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "データベースエラー"))
+			return
+		}
+		if taken {
+			writeError(w, http.StatusConflict, newAPIError(ErrCodeUsernameTaken, "このユーザー名は既に使われています"))
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "パスワードのハッシュ化に失敗しました"))
+			return
+		}
+
+		// ゲストとして遊んでいた場合は、アカウントの作成と同時に対戦記録を引き継ぐ
+		claims, _ := auth.FromRequest(r)
+		guestID := ""
+		if claims != nil && claims.IsGuest() {
+			guestID = claims.UserID()
+		}
+		err = users.Create(r.Context(), repository.NewUser{
+			Username:     credentials.Username,
+			PasswordHash: string(hashedPassword),
+			MergeGuestID: guestID,
+		})
+		if errors.Is(err, repository.ErrConflict) {
+			writeError(w, http.StatusConflict, newAPIError(ErrCodeUsernameTaken, "このユーザー名は既に使われています"))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "アカウントの作成に失敗しました"))
+			return
+		}
+
+		// 引き継いだゲストのセッションはもう使わない
+		if guestID != "" {
+			if err := auth.RevokeSession(r.Context(), guestID, claims.SessionID()); err != nil {
+				slog.Error("ゲストのセッションの無効化エラー", logging.Err(err))
+			}
+		}
+
+		token, err := auth.StartSession(w, r, credentials.Username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "セッションの作成に失敗しました"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(AuthResponse{
+			Status:   "success",
+			Username: credentials.Username,
+			Token:    token,
+		})
+	}
+}
+
+// AuthLoginHandler パスワードでログインするハンドラー(POST /auth/login)
+// ユーザーが存在しない場合とパスワードが違う場合は同じエラーを返す
+func AuthLoginHandler(users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var credentials Credentials
+		if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+
+		user, err := users.FindByUsername(r.Context(), credentials.Username)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "データベースエラー"))
+			return
+		}
+		// OAuthで作成したアカウントはパスワードが空なのでログインできない
+		if err != nil || user.PasswordHash == "" ||
+			bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(credentials.Password)) != nil {
+			writeError(w, http.StatusUnauthorized, newAPIError(ErrCodeInvalidCredentials, "ユーザー名またはパスワードが正しくありません"))
+			return
+		}
+
+		token, err := auth.StartSession(w, r, credentials.Username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "セッションの作成に失敗しました"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AuthResponse{
+			Status:   "success",
+			Username: credentials.Username,
+			Token:    token,
+		})
+	}
+}
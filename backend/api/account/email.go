@@ -0,0 +1,223 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	VerifyTokenTTL = 24 * time.Hour
+	ResetTokenTTL  = time.Hour
+)
+
+var (
+	// linkBaseURL メールに載せるリンクの先頭(フロントエンドのURL)
+	linkBaseURL = "http://localhost:3000"
+	// requireVerifiedEmail trueの場合、メールアドレスを確認していないユーザーはランク戦に参加できない
+	requireVerifiedEmail = false
+)
+
+// SetLinkBaseURL メールに載せるリンクの先頭を設定する
+func SetLinkBaseURL(url string) {
+	linkBaseURL = url
+}
+
+// SetEmailVerificationRequired ランク戦に参加するのにメールアドレスの確認を必須にするかを設定する
+func SetEmailVerificationRequired(required bool) {
+	requireVerifiedEmail = required
+}
+
+// EmailVerificationRequired ランク戦にメールアドレスの確認が必要かを返す
+func EmailVerificationRequired() bool {
+	return requireVerifiedEmail
+}
+
+// IsEmailVerified ユーザーがメールアドレスを確認済みかを返す
+func IsEmailVerified(ctx context.Context, emails repository.EmailRepository, username string) (bool, error) {
+	return emails.EmailVerified(ctx, username)
+}
+
+// hashToken トークンはハッシュにしてから保存する
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueEmailToken 一度だけ使えるトークンを発行する
+// 同じ用途の未使用のトークンは無効にする
+func issueEmailToken(ctx context.Context, emails repository.EmailRepository, username, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	err := emails.IssueEmailToken(ctx, repository.EmailToken{
+		Hash:      hashToken(token),
+		Username:  username,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RequestVerificationHandler メールアドレスを登録して確認メールを送るハンドラー(POST /auth/email)
+// メールアドレスを変更した場合は確認済みの状態を取り消す
+func RequestVerificationHandler(emails repository.EmailRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, newAPIError(ErrCodeUnauthorized, "ログインが必要です"))
+			return
+		}
+
+		var request EmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+		addr, err := mail.ParseAddress(request.Email)
+		if err != nil || addr.Address != request.Email || len(request.Email) > 255 {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidEmail, "メールアドレスの形式が正しくありません"))
+			return
+		}
+
+		if err := emails.SetEmail(r.Context(), username, request.Email); err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "データベースエラー"))
+			return
+		}
+
+		token, err := issueEmailToken(r.Context(), emails, username, repository.EmailTokenVerify, VerifyTokenTTL)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "トークンの発行に失敗しました"))
+			return
+		}
+		body := "以下のリンクからメールアドレスを確認してください(24時間有効)\n\n" +
+			linkBaseURL + "/verify-email?token=" + token
+		if err := mailSender.Send(r.Context(), request.Email, "メールアドレスの確認", body); err != nil {
+			slog.Error("確認メールの送信エラー", logging.Err(err))
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "メールの送信に失敗しました"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+	}
+}
+
+// VerifyEmailHandler メールのトークンでメールアドレスを確認済みにするハンドラー(POST /auth/email/verify)
+// 他のアカウントが確認済みのメールアドレスは確認できない
+// 登録の時点で断ると、他人のメールアドレスが使われているかを調べられてしまうため、確認の時点で断る
+func VerifyEmailHandler(emails repository.EmailRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+
+		username, err := emails.VerifyEmail(r.Context(), hashToken(request.Token))
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidToken, "リンクが無効か期限切れです"))
+			return
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			writeError(w, http.StatusConflict, newAPIError(ErrCodeEmailTaken, "このメールアドレスは他のアカウントで確認済みです"))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "データベースエラー"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "verified", "username": username})
+	}
+}
+
+// RequestPasswordResetHandler パスワード再設定のメールを送るハンドラー(POST /auth/password/forgot)
+// メールアドレスが登録されているかを知られないよう、常に同じ応答を返す
+func RequestPasswordResetHandler(emails repository.EmailRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request EmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+
+		// 確認済みのメールアドレスにだけ送る
+		username, err := emails.VerifiedUser(r.Context(), request.Email)
+		if err == nil {
+			token, err := issueEmailToken(r.Context(), emails, username, repository.EmailTokenReset, ResetTokenTTL)
+			if err == nil {
+				body := "以下のリンクからパスワードを再設定してください(1時間有効)\n" +
+					"心当たりがない場合はこのメールを無視してください\n\n" +
+					linkBaseURL + "/reset-password?token=" + token
+				err = mailSender.Send(r.Context(), request.Email, "パスワードの再設定", body)
+			}
+			if err != nil {
+				slog.Error("パスワード再設定メールの送信エラー", logging.Err(err))
+			}
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("パスワード再設定のユーザー検索エラー", logging.Err(err))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+	}
+}
+
+// ResetPasswordHandler メールのトークンでパスワードを再設定するハンドラー(POST /auth/password/reset)
+// 再設定後は全てのセッションを無効にする
+func ResetPasswordHandler(emails repository.EmailRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request PasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+		if apiErr := validatePassword(request.Password); apiErr != nil {
+			writeError(w, http.StatusBadRequest, apiErr)
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "パスワードのハッシュ化に失敗しました"))
+			return
+		}
+
+		username, err := emails.ResetPassword(r.Context(), hashToken(request.Token), string(hashedPassword))
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidToken, "リンクが無効か期限切れです"))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "データベースエラー"))
+			return
+		}
+
+		if err := auth.RevokeUserSessions(r.Context(), username); err != nil {
+			slog.Error("パスワード再設定後のセッション無効化エラー", logging.Err(err))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	}
+}
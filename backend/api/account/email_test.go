@@ -0,0 +1,114 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sys3/api/repository"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestUsers emailを登録したアカウントをメモリ上に作成する
+func newTestUsers(t *testing.T, emails map[string]string) (*repository.MemoryUserRepository, *repository.MemoryEmailRepository) {
+	t.Helper()
+	users := repository.NewMemoryUserRepository()
+	store := repository.NewMemoryEmailRepository(users)
+	ctx := context.Background()
+	for username, email := range emails {
+		if err := users.Create(ctx, repository.NewUser{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetEmail(ctx, username, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users, store
+}
+
+func post(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestVerifyEmailRejectsAddressVerifiedByOther(t *testing.T) {
+	_, emails := newTestUsers(t, map[string]string{"alice": "shared@example.com", "bob": "Shared@example.com"})
+	ctx := context.Background()
+
+	token, err := issueEmailToken(ctx, emails, "alice", repository.EmailTokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(VerifyEmailHandler(emails), `{"token":"`+token+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("alice: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	token, err = issueEmailToken(ctx, emails, "bob", repository.EmailTokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(VerifyEmailHandler(emails), `{"token":"`+token+`"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("bob: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if verified, _ := IsEmailVerified(ctx, emails, "bob"); verified {
+		t.Error("bob's email was verified")
+	}
+}
+
+func TestVerifyEmailTokenIsSingleUse(t *testing.T) {
+	_, emails := newTestUsers(t, map[string]string{"alice": "alice@example.com"})
+	ctx := context.Background()
+
+	first, err := issueEmailToken(ctx, emails, "alice", repository.EmailTokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 後から発行したトークンだけが使える
+	token, err := issueEmailToken(ctx, emails, "alice", repository.EmailTokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(VerifyEmailHandler(emails), `{"token":"`+first+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("replaced token: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := post(VerifyEmailHandler(emails), `{"token":"`+token+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("first: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := post(VerifyEmailHandler(emails), `{"token":"`+token+`"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("second: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	users, emails := newTestUsers(t, map[string]string{"alice": "alice@example.com"})
+	ctx := context.Background()
+
+	// 確認用のトークンではパスワードを再設定できない
+	token, err := issueEmailToken(ctx, emails, "alice", repository.EmailTokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(ResetPasswordHandler(emails), `{"token":"`+token+`","password":"newpassword1"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("verify token: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	token, err = issueEmailToken(ctx, emails, "alice", repository.EmailTokenReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(ResetPasswordHandler(emails), `{"token":"`+token+`","password":"newpassword1"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	user, err := users.FindByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("newpassword1")); err != nil {
+		t.Errorf("password was not changed: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package account
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// /auth/ 以下とプロフィールのAPIが返すエラーコード
+const (
+	ErrCodeInvalidRequest     = "invalid_request"
+	ErrCodeInvalidUsername    = "invalid_username"
+	ErrCodeInvalidPassword    = "invalid_password"
+	ErrCodeInvalidDisplayName = "invalid_display_name"
+	ErrCodeInappropriateName  = "inappropriate_name"
+	ErrCodeInvalidProfile     = "invalid_profile"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeUsernameTaken      = "username_taken"
+	ErrCodeInvalidCredentials = "invalid_credentials"
+	ErrCodeInvalidEmail       = "invalid_email"
+	ErrCodeEmailTaken         = "email_taken"
+	ErrCodeInvalidToken       = "invalid_token"
+	ErrCodeServerError        = "server_error"
+)
+
+// APIError /auth/ 以下とプロフィールのAPIが返すエラーの共通形式
+type APIError struct {
+	Code    string `json:"code"`    // 機械判定用のエラーコード
+	Message string `json:"message"` // 表示用のメッセージ
+}
+
+func newAPIError(code, message string) *APIError {
+	return &APIError{Code: code, Message: message}
+}
+
+// writeError エラーを {"status": "error", "error": {...}} の形式で返す
+func writeError(w http.ResponseWriter, status int, apiErr *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "error",
+		"error":  apiErr,
+	})
+}
@@ -0,0 +1,58 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// MailSender メールの送信方法を抽象化するインターフェース
+type MailSender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogMailSender メールを送信せずにログに出力する。開発用
+type LogMailSender struct{}
+
+func (LogMailSender) Send(ctx context.Context, to, subject, body string) error {
+	slog.Info("メール送信(ログのみ)", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// SMTPMailSender SMTPサーバー経由でメールを送信する
+type SMTPMailSender struct {
+	Addr string // host:port
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailSender SMTPサーバーを使うMailSenderを作成する
+// usernameが空の場合は認証しない
+func NewSMTPMailSender(addr, from, username, password string) *SMTPMailSender {
+	sender := &SMTPMailSender{Addr: addr, From: from}
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		sender.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender
+}
+
+// Send 件名は日本語を含むので、ヘッダーに書けるようにエンコードして送る
+func (s *SMTPMailSender) Send(ctx context.Context, to, subject, body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		s.From, to, mime.QEncoding.Encode("utf-8", subject), body)
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{to}, []byte(msg))
+}
+
+var mailSender MailSender = LogMailSender{}
+
+// SetMailSender メールの送信方法を設定する
+func SetMailSender(sender MailSender) {
+	mailSender = sender
+}
@@ -1,7 +1,62 @@
 package account
 
-type Account struct {
-	ID       string `json:"id"`
+import "sys3/api/repository"
+
+// Credentials /auth/register と /auth/login のリクエスト
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// AuthResponse /auth/register と /auth/login のレスポンス
+type AuthResponse struct {
+	Status   string `json:"status"`
 	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+// Profile ユーザーのプロフィール
+type Profile = repository.Profile
+
+// publicProfile 対戦相手に表示する項目だけを返す
+func publicProfile(p Profile) PublicProfile {
+	return PublicProfile{
+		Username:    p.Username,
+		DisplayName: p.DisplayName,
+		AvatarURL:   p.AvatarURL,
+		Country:     p.Country,
+	}
+}
+
+// PublicProfile マッチングや対戦結果で対戦相手に送るプロフィール
+type PublicProfile struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Country     string `json:"country,omitempty"`
+}
+
+// ProfileUpdate プロフィール更新のリクエスト
+type ProfileUpdate struct {
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Bio         string `json:"bio"`
+	Country     string `json:"country"`
+	Locale      string `json:"locale"`
+}
+
+// EmailRequest /auth/email と /auth/password/forgot のリクエスト
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// TokenRequest /auth/email/verify のリクエスト
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// PasswordResetRequest /auth/password/reset のリクエスト
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
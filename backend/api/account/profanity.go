@@ -0,0 +1,158 @@
+package account
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProfanityFilter ユーザー名や表示名に不適切な言葉が含まれていないかを判定する
+// 対戦相手に表示されるため、登録時と表示名の変更時に使う
+type ProfanityFilter interface {
+	Contains(text string) bool
+}
+
+// WordListFilter 禁止語の一覧で判定するProfanityFilter
+// 大文字小文字、よくある数字への置き換え(0→o など)を無視して判定する
+// 英数字の禁止語は単語の区切り(記号、空白、小文字から大文字への切り替わり)で分けた単語の先頭か末尾に
+// ある場合だけ一致とし、Yamashita や Scunthorpe のように単語の途中に含まれるだけのものは通す
+// 区切りのない日本語などの禁止語は部分一致で判定する
+type WordListFilter struct {
+	words     []string // 単語の区切りで判定する禁止語
+	fragments []string // 部分一致で判定する禁止語
+	allowed   map[string]bool
+}
+
+// NewWordListFilter 禁止語の一覧と、禁止語を含んでいても許可する単語の一覧からフィルターを作成する
+func NewWordListFilter(words, allowed []string) *WordListFilter {
+	f := &WordListFilter{allowed: make(map[string]bool)}
+	for _, w := range words {
+		w = normalizeForFilter(w)
+		switch {
+		case w == "":
+		case isASCIIWord(w):
+			f.words = append(f.words, w)
+		default:
+			f.fragments = append(f.fragments, w)
+		}
+	}
+	for _, w := range allowed {
+		f.allowed[normalizeForFilter(w)] = true
+	}
+	return f
+}
+
+func (f *WordListFilter) Contains(text string) bool {
+	normalized := normalizeForFilter(text)
+	for _, w := range f.fragments {
+		if strings.Contains(normalized, w) {
+			return true
+		}
+	}
+	for _, token := range tokenizeForFilter(text) {
+		if f.allowed[token] {
+			continue
+		}
+		for _, w := range f.words {
+			if strings.HasPrefix(token, w) || strings.HasSuffix(token, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s",
+)
+
+// normalizeForFilter 判定の前に表記ゆれをなくす
+func normalizeForFilter(text string) string {
+	return leetReplacer.Replace(strings.ToLower(text))
+}
+
+// isASCIIWord 英数字だけの禁止語か
+func isASCIIWord(w string) bool {
+	for _, r := range w {
+		if r >= unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenizeForFilter 単語の区切りで分けて、それぞれ表記ゆれをなくした単語を返す
+// f.u.c.k のように1文字ずつ区切った部分は、つなげて1つの単語として扱う
+func tokenizeForFilter(text string) []string {
+	var tokens []string
+	var current []rune
+	var prev rune
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, normalizeForFilter(string(current)))
+			current = current[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '@' && r != '$':
+			flush()
+		case unicode.IsLower(prev) && unicode.IsUpper(r):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+		prev = r
+	}
+	flush()
+
+	var merged []string
+	var spelled strings.Builder
+	for _, token := range tokens {
+		if utf8.RuneCountInString(token) == 1 {
+			spelled.WriteString(token)
+			continue
+		}
+		if spelled.Len() > 0 {
+			merged = append(merged, spelled.String())
+			spelled.Reset()
+		}
+		merged = append(merged, token)
+	}
+	if spelled.Len() > 0 {
+		merged = append(merged, spelled.String())
+	}
+	return merged
+}
+
+// defaultProfanityWords 最低限の禁止語
+// 運用ではSetProfanityFilterで外部の一覧やサービスに差し替える
+var defaultProfanityWords = []string{
+	"fuck", "shit", "bitch", "cunt", "nigger", "faggot",
+	"ちんこ", "まんこ", "死ね", "殺す",
+}
+
+// defaultAllowedWords 禁止語で始まるか終わるが、禁止語ではない単語
+var defaultAllowedWords = []string{
+	"shitake",
+}
+
+var (
+	filterMu        sync.RWMutex
+	profanityFilter ProfanityFilter = NewWordListFilter(defaultProfanityWords, defaultAllowedWords)
+)
+
+// SetProfanityFilter 不適切な言葉の判定に使うフィルターを差し替える
+func SetProfanityFilter(filter ProfanityFilter) {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	profanityFilter = filter
+}
+
+func containsProfanity(text string) bool {
+	filterMu.RLock()
+	defer filterMu.RUnlock()
+	return profanityFilter != nil && profanityFilter.Contains(text)
+}
@@ -0,0 +1,39 @@
+package account
+
+import "testing"
+
+func TestWordListFilterContains(t *testing.T) {
+	filter := NewWordListFilter(defaultProfanityWords, defaultAllowedWords)
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		// 禁止語を単語の途中に含むだけの名前や地名
+		{"Yamashita", false},
+		{"Matsushita", false},
+		{"Kinoshita", false},
+		{"Morishita", false},
+		{"Scunthorpe", false},
+		{"taro_yamashita", false},
+		{"MorishitaKen", false},
+		{"shitake", false},
+		{"やました", false},
+
+		{"fuck", true},
+		{"FUCK", true},
+		{"Shithead", true},
+		{"bull_shit", true},
+		{"BullShit", true},
+		{"xXShitXx", true},
+		{"sh1t", true},
+		{"f.u.c.k", true},
+		{"f u c k you", true},
+		{"お前死ねよ", true},
+	}
+	for _, tt := range tests {
+		if got := filter.Contains(tt.text); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
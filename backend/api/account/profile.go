@@ -0,0 +1,166 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxBioLength       = 200
+	maxAvatarURLLength = 512
+)
+
+var (
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)               // ISO 3166-1 alpha-2
+	localePattern  = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`) // 例: ja, en-US
+)
+
+// GetProfile プロフィールを取得する
+// プロフィールを登録していないユーザーは表示名をユーザー名にして返す
+func GetProfile(ctx context.Context, profiles repository.ProfileRepository, username string) (Profile, error) {
+	profile, err := profiles.Profile(ctx, username)
+	if err != nil {
+		return Profile{}, err
+	}
+	if profile.DisplayName == "" {
+		profile.DisplayName = username
+	}
+	return profile, nil
+}
+
+// GetPublicProfile 対戦相手に表示するプロフィールを取得する
+// ゲストや取得に失敗した場合はユーザーIDだけを返す
+func GetPublicProfile(ctx context.Context, profiles repository.ProfileRepository, username string) PublicProfile {
+	if auth.IsGuestID(username) {
+		return PublicProfile{Username: username, DisplayName: "ゲスト"}
+	}
+	profile, err := GetProfile(ctx, profiles, username)
+	if err != nil {
+		return PublicProfile{Username: username, DisplayName: username}
+	}
+	return publicProfile(profile)
+}
+
+// GetProfileHandler ユーザーの公開プロフィールを返すハンドラー(GET /users/{id}/profile)
+func GetProfileHandler(users repository.UserRepository, profiles repository.ProfileRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["id"]
+
+		if _, err := users.FindByUsername(r.Context(), username); errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, newAPIError(ErrCodeNotFound, "ユーザーが見つかりません"))
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "データベースエラー"))
+			return
+		}
+
+		profile, err := GetProfile(r.Context(), profiles, username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "プロフィールの取得に失敗しました"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
+
+// MyProfileHandler ログイン中のユーザーのプロフィールを返すハンドラー(GET /profile)
+func MyProfileHandler(profiles repository.ProfileRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, newAPIError(ErrCodeUnauthorized, "ログインが必要です"))
+			return
+		}
+
+		profile, err := GetProfile(r.Context(), profiles, username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "プロフィールの取得に失敗しました"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
+
+// UpdateProfileHandler ログイン中のユーザーのプロフィールを更新するハンドラー(PUT /profile)
+func UpdateProfileHandler(profiles repository.ProfileRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, newAPIError(ErrCodeUnauthorized, "ログインが必要です"))
+			return
+		}
+
+		var request ProfileUpdate
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(ErrCodeInvalidRequest, "無効なJSONデータです"))
+			return
+		}
+		if apiErr := validateProfile(request); apiErr != nil {
+			writeError(w, http.StatusBadRequest, apiErr)
+			return
+		}
+
+		err := profiles.SaveProfile(r.Context(), Profile{
+			Username:    username,
+			DisplayName: request.DisplayName,
+			AvatarURL:   request.AvatarURL,
+			Bio:         request.Bio,
+			Country:     request.Country,
+			Locale:      request.Locale,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "プロフィールの更新に失敗しました"))
+			return
+		}
+
+		profile, err := GetProfile(r.Context(), profiles, username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, newAPIError(ErrCodeServerError, "プロフィールの取得に失敗しました"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
+
+// validateProfile プロフィールの各項目を検証する
+// 表示名と自己紹介は対戦相手に表示されるので不適切な言葉も確認する
+func validateProfile(p ProfileUpdate) *APIError {
+	if p.DisplayName != "" {
+		if apiErr := ValidateDisplayName(p.DisplayName); apiErr != nil {
+			return apiErr
+		}
+	}
+	if p.AvatarURL != "" {
+		u, err := url.Parse(p.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(p.AvatarURL) > maxAvatarURLLength {
+			return newAPIError(ErrCodeInvalidProfile, "アバターのURLが正しくありません")
+		}
+	}
+	if utf8.RuneCountInString(p.Bio) > maxBioLength {
+		return newAPIError(ErrCodeInvalidProfile, "自己紹介は200文字以内にしてください")
+	}
+	if containsProfanity(p.Bio) {
+		return newAPIError(ErrCodeInappropriateName, "不適切な言葉が含まれています")
+	}
+	if p.Country != "" && !countryPattern.MatchString(p.Country) {
+		return newAPIError(ErrCodeInvalidProfile, "国は2文字の国コードで指定してください")
+	}
+	if p.Locale != "" && !localePattern.MatchString(p.Locale) {
+		return newAPIError(ErrCodeInvalidProfile, "言語の形式が正しくありません")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	profiles := repository.NewMemoryProfileRepository()
+	req := httptest.NewRequest(http.MethodPut, "/profile", strings.NewReader(`{"display_name":"アリス","country":"JP"}`))
+	claims := &auth.Claims{}
+	claims.Subject = "alice"
+	req = req.WithContext(auth.WithClaims(req.Context(), claims))
+	rec := httptest.NewRecorder()
+	UpdateProfileHandler(profiles)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	public := GetPublicProfile(context.Background(), profiles, "alice")
+	if public.DisplayName != "アリス" || public.Country != "JP" {
+		t.Errorf("public profile = %+v", public)
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	profiles := repository.NewMemoryProfileRepository()
+	if err := users.Create(context.Background(), repository.NewUser{Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/profile", GetProfileHandler(users, profiles))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/bob/profile", nil))
+	var profile Profile
+	if err := json.NewDecoder(rec.Body).Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+	// 登録していなければ表示名はユーザー名になる
+	if profile.DisplayName != "bob" {
+		t.Errorf("display_name = %q, want bob", profile.DisplayName)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/nobody/profile", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
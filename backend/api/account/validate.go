@@ -0,0 +1,76 @@
+package account
+
+import (
+	"regexp"
+	"sys3/api/auth"
+	"unicode/utf8"
+)
+
+const (
+	minUsernameLength    = 3
+	maxUsernameLength    = 20
+	minPasswordLength    = 8
+	maxPasswordLength    = 72 // bcryptはこれより長い部分を無視する
+	maxDisplayNameLength = 30
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ValidateUsername ユーザー名の長さ、使える文字、不適切な言葉を検証する
+// 問題がなければnilを返す
+func ValidateUsername(username string) *APIError {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return newAPIError(ErrCodeInvalidUsername, "ユーザー名は3〜20文字にしてください")
+	}
+	if !usernamePattern.MatchString(username) {
+		return newAPIError(ErrCodeInvalidUsername, "ユーザー名には英数字と_のみ使えます")
+	}
+	// ゲストのIDと区別できなくなるため
+	if auth.IsGuestID(username) {
+		return newAPIError(ErrCodeInvalidUsername, "このユーザー名は使えません")
+	}
+	if containsProfanity(username) {
+		return newAPIError(ErrCodeInappropriateName, "不適切な言葉が含まれています")
+	}
+	return nil
+}
+
+// ValidateDisplayName 表示名の長さと不適切な言葉を検証する
+// 表示名は日本語なども使えるが、制御文字は使えない
+func ValidateDisplayName(name string) *APIError {
+	length := utf8.RuneCountInString(name)
+	if length == 0 || length > maxDisplayNameLength || !utf8.ValidString(name) {
+		return newAPIError(ErrCodeInvalidDisplayName, "表示名は1〜30文字にしてください")
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return newAPIError(ErrCodeInvalidDisplayName, "表示名に使えない文字が含まれています")
+		}
+	}
+	if containsProfanity(name) {
+		return newAPIError(ErrCodeInappropriateName, "不適切な言葉が含まれています")
+	}
+	return nil
+}
+
+// IsAllowedUsername ユーザー名として使えるかを返す(重複は確認しない)
+func IsAllowedUsername(username string) bool {
+	return ValidateUsername(username) == nil
+}
+
+// validateCredentials 登録時のユーザー名とパスワードを検証する
+// 問題がなければnilを返す
+func validateCredentials(username, password string) *APIError {
+	if apiErr := ValidateUsername(username); apiErr != nil {
+		return apiErr
+	}
+	return validatePassword(password)
+}
+
+// validatePassword パスワードの長さを検証する(bcryptは72バイトまでしか使わない)
+func validatePassword(password string) *APIError {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return newAPIError(ErrCodeInvalidPassword, "パスワードは8〜72文字にしてください")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sys3/api/logging"
+	"time"
+)
+
+// 監視する事象
+const (
+	RatingUpdateFailure = "rating_update_failure" // 対戦結果とレートの保存に失敗した
+	AbnormalClose       = "abnormal_close"        // WebSocket接続がクローズフレームなしに切れた
+)
+
+// descriptions 通知に載せる事象の説明
+var descriptions = map[string]string{
+	RatingUpdateFailure: "レートの更新に繰り返し失敗しています",
+	AbnormalClose:       "WebSocket接続の異常切断が急増しています",
+}
+
+// 通知の送信にかけられる時間
+const notifyTimeout = 10 * time.Second
+
+// Rule 事象がWindowの間にThreshold回以上起きたら通知する
+// 通知が続けて届かないように、通知した後Cooldownの間は同じ事象を通知しない
+type Rule struct {
+	Threshold int
+	Window    time.Duration
+	Cooldown  time.Duration
+}
+
+// defaultRules 設定しない場合の通知の条件
+var defaultRules = map[string]Rule{
+	RatingUpdateFailure: {Threshold: 3, Window: 5 * time.Minute, Cooldown: 15 * time.Minute},
+	AbnormalClose:       {Threshold: 50, Window: time.Minute, Cooldown: 15 * time.Minute},
+}
+
+// DefaultRule 設定しない場合のnameの通知の条件を返す
+func DefaultRule(name string) Rule {
+	return defaultRules[name]
+}
+
+// Alert 通知の内容
+type Alert struct {
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`     // Windowの間に起きた回数
+	Window    string    `json:"window"`    // 数えた期間(例: "5m0s")
+	Threshold int       `json:"threshold"` // 通知する回数
+	FiredAt   time.Time `json:"fired_at"`
+}
+
+type tracker struct {
+	mu       sync.Mutex
+	rules    map[string]Rule
+	events   map[string][]time.Time // Windowの間に起きた日時
+	lastSent map[string]time.Time
+}
+
+var events = &tracker{
+	rules:    copyRules(defaultRules),
+	events:   map[string][]time.Time{},
+	lastSent: map[string]time.Time{},
+}
+
+func copyRules(rules map[string]Rule) map[string]Rule {
+	out := make(map[string]Rule, len(rules))
+	for name, rule := range rules {
+		out[name] = rule
+	}
+	return out
+}
+
+// SetRule nameの事象を通知する条件を設定する。Thresholdが0なら通知しない
+// サーバー起動前に呼び出すこと
+func SetRule(name string, rule Rule) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.rules[name] = rule
+}
+
+// Record nameの事象が起きたことを記録し、条件を超えていれば通知する
+// 通知は別のゴルーチンで送るので、呼び出し元は待たされない
+func Record(name string) {
+	if a, ok := events.record(name, time.Now()); ok {
+		go send(a)
+	}
+}
+
+func (t *tracker) record(name string, now time.Time) (Alert, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rule, ok := t.rules[name]
+	if !ok || rule.Threshold <= 0 {
+		return Alert{}, false
+	}
+
+	// 期間を過ぎた記録を捨てる
+	recent := t.events[name]
+	i := 0
+	for i < len(recent) && now.Sub(recent[i]) > rule.Window {
+		i++
+	}
+	recent = append(recent[i:], now)
+	t.events[name] = recent
+
+	if len(recent) < rule.Threshold {
+		return Alert{}, false
+	}
+	if last, ok := t.lastSent[name]; ok && now.Sub(last) < rule.Cooldown {
+		return Alert{}, false
+	}
+	t.lastSent[name] = now
+	return Alert{
+		Name:      name,
+		Message:   descriptions[name],
+		Count:     len(recent),
+		Window:    rule.Window.String(),
+		Threshold: rule.Threshold,
+		FiredAt:   now,
+	}, true
+}
+
+func send(a Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := notifier.Notify(ctx, a); err != nil {
+		slog.Error("アラートの通知エラー", "alert", a.Name, logging.Err(err))
+	}
+}
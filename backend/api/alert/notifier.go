@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Notifier アラートの通知方法を抽象化するインターフェース
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// LogNotifier 通知せずにログに出力する。通知先を設定しない場合に使う
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, a Alert) error {
+	slog.Warn("アラート", "alert", a.Name, "message", a.Message, "count", a.Count, "window", a.Window)
+	return nil
+}
+
+// WebhookNotifier アラートをJSONでURLにPOSTする
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // nilならhttp.DefaultClient
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	return postJSON(ctx, n.Client, n.URL, a)
+}
+
+// SlackNotifier SlackのIncoming Webhookにアラートを投稿する
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client // nilならhttp.DefaultClient
+}
+
+func (n SlackNotifier) Notify(ctx context.Context, a Alert) error {
+	text := fmt.Sprintf(":rotating_light: *%s*\n%s (直近%sで%d回、閾値%d回)", a.Name, a.Message, a.Window, a.Count, a.Threshold)
+	return postJSON(ctx, n.Client, n.WebhookURL, map[string]string{"text": text})
+}
+
+// Notifiers 全ての通知先に通知する
+type Notifiers []Notifier
+
+func (ns Notifiers) Notify(ctx context.Context, a Alert) error {
+	var errs []error
+	for _, n := range ns {
+		if err := n.Notify(ctx, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("通知先が %d を返しました", resp.StatusCode)
+	}
+	return nil
+}
+
+var notifier Notifier = LogNotifier{}
+
+// SetNotifier アラートの通知方法を設定する
+func SetNotifier(n Notifier) {
+	notifier = n
+}
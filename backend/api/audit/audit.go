@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sys3/api/auth"
+	"sys3/api/clientip"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPayloadSize 記録するリクエストの本文の最大バイト数
+const maxPayloadSize = 64 << 10
+
+type contextKey struct{}
+
+// diffHolder ハンドラーが記録した変更をミドルウェアに渡すための入れ物
+type diffHolder struct {
+	diff json.RawMessage
+}
+
+// Annotate 操作による変更前と変更後の値を記録に含める
+// Middlewareで包まれていないリクエストでは何もしない
+func Annotate(r *http.Request, before, after interface{}) {
+	holder, ok := r.Context().Value(contextKey{}).(*diffHolder)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(change{Before: before, After: after})
+	if err != nil {
+		return
+	}
+	holder.diff = data
+}
+
+// statusRecorder レスポンスのステータスコードを記録するResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Middleware 管理者用のハンドラーを包み、状態を変更する操作を記録する
+// 操作したユーザー、ルート、対象の{id}、リクエストの本文、変更内容、結果のステータスを保存する
+// 一覧の取得などのGETは記録しない
+func Middleware(entries repository.AuditRepository, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		payload := readPayload(r)
+		holder := &diffHolder{}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, holder))
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r)
+
+		entry := Entry{
+			Action:    actionOf(r),
+			Target:    mux.Vars(r)["id"],
+			Payload:   payload,
+			Diff:      holder.diff,
+			Status:    recorder.status,
+			IP:        clientip.FromRequest(r),
+			CreatedAt: time.Now(),
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if claims, ok := auth.FromRequest(r); ok {
+			entry.Actor = claims.UserID()
+		}
+
+		// クライアントが切断しても記録は残す
+		ctx, cancel := repository.WithTimeout(context.WithoutCancel(r.Context()))
+		defer cancel()
+		if err := entries.RecordAudit(ctx, entry); err != nil {
+			slog.Error("操作の記録エラー", logging.KeyUserID, entry.Actor, "action", entry.Action, logging.Err(err))
+		}
+	}
+}
+
+// actionOf ルートのテンプレートとメソッドから操作名を作る
+func actionOf(r *http.Request) string {
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			path = template
+		}
+	}
+	return r.Method + " " + path
+}
+
+// readPayload リクエストの本文を読み取り、ハンドラーがもう一度読めるように戻す
+// JSONでない本文は文字列として、大きすぎる本文は省略して記録する
+func readPayload(r *http.Request) json.RawMessage {
+	if r.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+	if len(body) > maxPayloadSize {
+		data, _ := json.Marshal("(本文が大きすぎるため省略)")
+		return data
+	}
+	if json.Valid(body) {
+		return body
+	}
+	data, _ := json.Marshal(string(body))
+	return data
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"testing"
+)
+
+func TestMiddlewareRecordsChanges(t *testing.T) {
+	entries := repository.NewMemoryAuditRepository()
+	handler := Middleware(entries, func(w http.ResponseWriter, r *http.Request) {
+		Annotate(r, map[string]bool{"closed": false}, map[string]bool{"closed": true})
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	claims := &auth.Claims{}
+	claims.Subject = "admin"
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req := httptest.NewRequest(method, "/admin/rooms/r1/close", strings.NewReader(`{"reason":"spam"}`))
+		req = req.WithContext(auth.WithClaims(req.Context(), claims))
+		handler(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	ListHandler(entries)(rec, httptest.NewRequest("GET", "/admin/audit?actor=admin", nil))
+	var resp ListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	// GETは記録しない
+	if resp.Total != 1 || len(resp.Entries) != 1 {
+		t.Fatalf("total = %d, entries = %d, want 1", resp.Total, len(resp.Entries))
+	}
+	e := resp.Entries[0]
+	if e.Action != "POST /admin/rooms/r1/close" || e.Status != http.StatusNoContent {
+		t.Errorf("entry = %+v", e)
+	}
+	if string(e.Payload) != `{"reason":"spam"}` || !strings.Contains(string(e.Diff), `"after":{"closed":true}`) {
+		t.Errorf("payload = %s, diff = %s", e.Payload, e.Diff)
+	}
+}
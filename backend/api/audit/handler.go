@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sys3/api/repository"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// parseTime RFC3339か日付(2006-01-02)を受け付ける
+func parseTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// ListHandler 管理者の操作の記録を新しい順に返すハンドラー(GET /admin/audit)
+// クエリパラメータ:
+//   - actor: 操作したユーザー
+//   - action: 操作名(例: "POST /admin/rooms/{id}/close")
+//   - target: 操作の対象
+//   - from, to: 操作した日時の範囲(RFC3339 または 2006-01-02。toの日付はその日を含む)
+//   - page, per_page: ページ番号(1から)と1ページあたりの件数
+func ListHandler(entries repository.AuditRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := Filter{
+			Actor:   query.Get("actor"),
+			Action:  query.Get("action"),
+			Target:  query.Get("target"),
+			Page:    1,
+			PerPage: defaultPageSize,
+		}
+		if value := query.Get("from"); value != "" {
+			from, ok := parseTime(value)
+			if !ok {
+				http.Error(w, "fromの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			filter.From = from
+		}
+		if value := query.Get("to"); value != "" {
+			to, ok := parseTime(value)
+			if !ok {
+				http.Error(w, "toの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			// 日付だけの指定はその日の終わりまでを含める
+			if len(value) == len("2006-01-02") {
+				to = to.AddDate(0, 0, 1)
+			}
+			filter.To = to
+		}
+		if value := query.Get("page"); value != "" {
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				http.Error(w, "pageの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			filter.Page = page
+		}
+		if value := query.Get("per_page"); value != "" {
+			perPage, err := strconv.Atoi(value)
+			if err != nil || perPage < 1 {
+				http.Error(w, "per_pageの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			filter.PerPage = min(perPage, maxPageSize)
+		}
+
+		found, total, err := entries.AuditEntries(r.Context(), repository.AuditFilter{
+			Actor:  filter.Actor,
+			Action: filter.Action,
+			Target: filter.Target,
+			From:   filter.From,
+			To:     filter.To,
+			Limit:  filter.PerPage,
+			Offset: (filter.Page - 1) * filter.PerPage,
+		})
+		if err != nil {
+			http.Error(w, "操作の記録の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListResponse{
+			Entries: found,
+			Total:   total,
+			Page:    filter.Page,
+			PerPage: filter.PerPage,
+		})
+	}
+}
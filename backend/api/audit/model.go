@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"sys3/api/repository"
+	"time"
+)
+
+// Entry 管理者の操作の記録
+type Entry = repository.AuditEntry
+
+// Filter 操作の記録の絞り込み条件
+type Filter struct {
+	Actor   string
+	Action  string
+	Target  string
+	From    time.Time
+	To      time.Time
+	Page    int
+	PerPage int
+}
+
+// ListResponse 操作の記録の一覧
+type ListResponse struct {
+	Entries []Entry `json:"entries"`
+	Total   int     `json:"total"`
+	Page    int     `json:"page"`
+	PerPage int     `json:"per_page"`
+}
+
+type change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
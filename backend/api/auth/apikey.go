@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyPrefix APIキーの先頭に付ける文字列。トークンとの区別に使う
+const APIKeyPrefix = "qk_"
+
+// apiKeySessionPrefix APIキーで認証したリクエストのセッションID
+// キーを無効にしたときに、そのキーで接続しているWebSocketだけを切断するために使う
+const apiKeySessionPrefix = "apikey:"
+
+// MaxAPIKeysPerUser 1人のユーザーが発行できるAPIキーの数
+const MaxAPIKeysPerUser = 10
+
+// APIキーのスコープ
+const (
+	ScopePlay      = "play"       // マッチメイキングに参加する
+	ScopeSpectate  = "spectate"   // 対戦を観戦する
+	ScopeStatsRead = "stats:read" // レートやランキングを取得する
+)
+
+var validScopes = map[string]bool{
+	ScopePlay:      true,
+	ScopeSpectate:  true,
+	ScopeStatsRead: true,
+}
+
+var (
+	ErrInvalidAPIKey  = errors.New("APIキーが不正です")
+	ErrTooManyAPIKeys = errors.New("APIキーの発行数が上限に達しています")
+)
+
+// APIKey 発行したAPIキーの情報。キー自体はハッシュでのみ保存する
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 一覧で見分けるためのキーの先頭部分
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// IsAPIKey APIキーで認証したかを返す
+func (c *Claims) IsAPIKey() bool {
+	return c.apiKey
+}
+
+// HasScope 指定したスコープの操作ができるかを返す
+// ログインセッションのトークンは全てのスコープを持つ
+func (c *Claims) HasScope(scope string) bool {
+	if !c.apiKey {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope APIキーで認証したリクエストのうち、スコープを持たないものを403で拒否する
+// ログインセッションや未ログインのリクエストはそのまま通す
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := FromRequest(r); ok && !claims.HasScope(scope) {
+			http.Error(w, "APIキーにこの操作の権限がありません", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey ユーザーのAPIキーを発行する
+// 発行したキーはこの時しか返さないので、呼び出し元で利用者に表示すること
+func CreateAPIKey(ctx context.Context, username, name string, scopes []string) (string, APIKey, error) {
+	if apiKeys == nil {
+		return "", APIKey{}, errors.New("APIキーの保存先が設定されていません")
+	}
+
+	count, err := apiKeys.CountAPIKeys(ctx, username)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	if count >= MaxAPIKeysPerUser {
+		return "", APIKey{}, ErrTooManyAPIKeys
+	}
+
+	id := make([]byte, 8)
+	secretPart := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", APIKey{}, err
+	}
+	if _, err := rand.Read(secretPart); err != nil {
+		return "", APIKey{}, err
+	}
+	key := APIKeyPrefix + hex.EncodeToString(secretPart)
+
+	apiKey := APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Prefix:    key[:len(APIKeyPrefix)+6],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	err = apiKeys.CreateAPIKey(ctx, repository.APIKey{
+		ID:        apiKey.ID,
+		KeyHash:   hashAPIKey(key),
+		Prefix:    apiKey.Prefix,
+		Username:  username,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: apiKey.CreatedAt,
+	})
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	return key, apiKey, nil
+}
+
+// authenticateAPIKey APIキーを検証し、持ち主とスコープを含むClaimsを返す
+// APIキーにはロールを付けないので、管理者用のAPIには使えない
+func authenticateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	if apiKeys == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	stored, err := apiKeys.APIKeyByHash(ctx, hashAPIKey(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 最終利用日時の更新に失敗しても認証は通す
+	apiKeys.TouchAPIKey(ctx, stored.ID)
+
+	claims := &Claims{
+		Scopes: stored.Scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      apiKeySessionPrefix + stored.ID,
+			Subject: stored.Username,
+		},
+		apiKey: true,
+	}
+	return claims, nil
+}
+
+// ListAPIKeys ユーザーの有効なAPIキーを返す
+func ListAPIKeys(ctx context.Context, username string) ([]APIKey, error) {
+	stored, err := apiKeys.APIKeys(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKey, len(stored))
+	for i, k := range stored {
+		keys[i] = APIKey{
+			ID:         k.ID,
+			Name:       k.Name,
+			Prefix:     k.Prefix,
+			Scopes:     k.Scopes,
+			CreatedAt:  k.CreatedAt,
+			LastUsedAt: k.LastUsedAt,
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey APIキーを無効にし、そのキーで接続しているクライアントを切断させる
+// 有効なキーがない場合はrepository.ErrNotFoundを返す
+func RevokeAPIKey(ctx context.Context, username, id string) error {
+	if err := apiKeys.RevokeAPIKey(ctx, id, username); err != nil {
+		return err
+	}
+	notifyRevoke(username, apiKeySessionPrefix+id)
+	return nil
+}
+
+// sessionUser ログインセッションで認証したユーザーを返す
+// APIキーで別のAPIキーを発行・削除できないようにする
+func sessionUser(r *http.Request) (string, bool) {
+	claims, ok := FromRequest(r)
+	if !ok || claims.IsGuest() || claims.IsAPIKey() {
+		return "", false
+	}
+	return claims.UserID(), true
+}
+
+// CreateAPIKeyHandler APIキーを発行するハンドラー(POST /apikeys)
+// リクエスト: {"name": "mybot", "scopes": ["stats:read"]}
+func CreateAPIKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := sessionUser(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "無効なJSONデータです", http.StatusBadRequest)
+			return
+		}
+		if request.Name == "" || len(request.Name) > 50 {
+			http.Error(w, "名前は1〜50文字にしてください", http.StatusBadRequest)
+			return
+		}
+		if len(request.Scopes) == 0 {
+			http.Error(w, "スコープを1つ以上指定してください", http.StatusBadRequest)
+			return
+		}
+		for _, scope := range request.Scopes {
+			if !validScopes[scope] {
+				http.Error(w, "不明なスコープです: "+scope, http.StatusBadRequest)
+				return
+			}
+		}
+
+		key, apiKey, err := CreateAPIKey(r.Context(), username, request.Name, request.Scopes)
+		if errors.Is(err, ErrTooManyAPIKeys) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "APIキーの発行に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"key":     key,
+			"api_key": apiKey,
+		})
+	}
+}
+
+// ListAPIKeysHandler 自分のAPIキーの一覧を返すハンドラー(GET /apikeys)
+func ListAPIKeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := sessionUser(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		keys, err := ListAPIKeys(r.Context(), username)
+		if err != nil {
+			http.Error(w, "データベースエラー", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// RevokeAPIKeyHandler 自分のAPIキーを無効にするハンドラー(DELETE /apikeys/{id})
+func RevokeAPIKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := sessionUser(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		err := RevokeAPIKey(r.Context(), username, mux.Vars(r)["id"])
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "APIキーが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "APIキーの無効化に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CSRFHeaderName 状態を変更するリクエストでCSRFトークンを送るヘッダー
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFCookieName CSRFトークンを渡すCookie。JavaScriptから読めるようにHttpOnlyにしない
+	CSRFCookieName = "csrf_token"
+)
+
+// CSRFToken セッションに紐付いたCSRFトークンを返す
+// セッションIDの署名なので保存する必要がなく、ログアウトすると使えなくなる
+func CSRFToken(claims *Claims) string {
+	return csrfTokenFor(claims.SessionID())
+}
+
+func csrfTokenFor(sessionID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("csrf:" + sessionID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFMiddleware Cookieのトークンで認証したPOST/PUT/PATCH/DELETEリクエストのCSRFトークンを検証する
+// Authorizationヘッダーのトークンやキーで認証するAPIクライアントは、ブラウザが自動で送らないので対象外
+// ログインしていないリクエストも、奪われる権限がないのでそのまま通す
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isStateChanging(r.Method) || strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := r.Cookie(TokenCookieName); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, ok := FromRequest(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(CSRFHeaderName)
+		if token == "" || !hmac.Equal([]byte(token), []byte(CSRFToken(claims))) {
+			http.Error(w, "CSRFトークンが正しくありません", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isStateChanging(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// setCSRFCookie CSRFトークンをCookieに保存する
+func setCSRFCookie(w http.ResponseWriter, sessionID string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    csrfTokenFor(sessionID),
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   false, // 開発環境ではfalse
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CSRFTokenHandler ログイン中のセッションのCSRFトークンを返すハンドラー(GET /auth/csrf)
+// 同じ値をCookieにも保存するので、クライアントはどちらかを X-CSRF-Token ヘッダーで送る
+func CSRFTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromRequest(r)
+		if !ok || claims.IsAPIKey() {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		token := CSRFToken(claims)
+		setCSRFCookie(w, claims.SessionID(), 0)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"csrf_token": token})
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// lastSeenInterval セッションの最終利用日時を更新する間隔
+// リクエストのたびに書き込まないよう、この間隔より古い場合だけ更新する
+const lastSeenInterval = time.Minute
+
+// ActiveSession 有効なセッションの一覧に返す情報
+type ActiveSession struct {
+	Session
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	Current    bool       `json:"current"` // このリクエストのセッションか
+	Online     bool       `json:"online"`  // WebSocketで接続中か
+}
+
+// Connection 接続中のWebSocketの情報
+type Connection struct {
+	SessionID    string    `json:"session_id"`
+	IP           string    `json:"ip"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	InGame       bool      `json:"in_game"`
+}
+
+var connectionLister func(username string) []Connection
+
+// SetConnectionLister ユーザーの接続中のWebSocketを返す関数を設定する
+// 接続を管理するパッケージ(matchmaking)から登録する
+func SetConnectionLister(fn func(username string) []Connection) {
+	connectionLister = fn
+}
+
+// touchSession セッションの最終利用日時を更新する
+func touchSession(ctx context.Context, sessionID string) {
+	if sessions == nil {
+		return
+	}
+	sessions.TouchSession(ctx, sessionID, time.Now(), lastSeenInterval)
+}
+
+// ListActiveSessions ユーザーの有効期限内で無効にされていないセッションを返す
+func ListActiveSessions(ctx context.Context, username string) ([]ActiveSession, error) {
+	stored, err := sessions.ActiveSessions(ctx, username, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	active := make([]ActiveSession, len(stored))
+	for i, s := range stored {
+		active[i] = ActiveSession{
+			Session: Session{
+				ID:        s.ID,
+				Username:  s.Username,
+				IP:        s.IP,
+				UserAgent: s.UserAgent,
+				CreatedAt: s.CreatedAt,
+				ExpiresAt: s.ExpiresAt,
+			},
+			LastSeenAt: s.LastSeenAt,
+		}
+	}
+	return active, nil
+}
+
+// ListSessionsHandler 自分の有効なセッションと接続中のWebSocketを返すハンドラー(GET /sessions)
+func ListSessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := sessionUser(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		claims, _ := FromRequest(r)
+
+		active, err := ListActiveSessions(r.Context(), username)
+		if err != nil {
+			http.Error(w, "データベースエラー", http.StatusInternalServerError)
+			return
+		}
+		connections := []Connection{}
+		if connectionLister != nil {
+			connections = append(connections, connectionLister(username)...)
+		}
+
+		online := make(map[string]bool, len(connections))
+		for _, c := range connections {
+			online[c.SessionID] = true
+		}
+		for i := range active {
+			active[i].Current = active[i].ID == claims.SessionID()
+			active[i].Online = online[active[i].ID]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sessions":    active,
+			"connections": connections,
+		})
+	}
+}
+
+// RevokeSessionHandler 自分のセッションを1つ無効にするハンドラー(DELETE /sessions/{id})
+// そのセッションで接続中のWebSocketも切断される
+func RevokeSessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := sessionUser(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		sessionID := mux.Vars(r)["id"]
+
+		err := sessions.RevokeSession(r.Context(), sessionID, username)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "セッションが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "セッションの無効化に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		notifyRevoke(username, sessionID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
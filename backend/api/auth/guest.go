@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RoleGuest アカウントを作らずに遊んでいるプレイヤー
+	RoleGuest = "guest"
+	// GuestIDPrefix ゲストに割り当てるIDの接頭辞
+	GuestIDPrefix = "guest-"
+	// GuestTokenTTL ゲストのトークンの有効期間(通常のログインより短い)
+	GuestTokenTTL = 6 * time.Hour
+	// GuestRetention ゲストの対戦記録を残しておく期間
+	// この期間内にアカウントを作成すれば記録を引き継げる
+	GuestRetention = 7 * 24 * time.Hour
+)
+
+var guestMode atomic.Bool
+
+// SetGuestMode ゲストでの対戦を許可するかを設定する
+func SetGuestMode(enabled bool) {
+	guestMode.Store(enabled)
+}
+
+// GuestModeEnabled ゲストでの対戦が許可されているかを返す
+func GuestModeEnabled() bool {
+	return guestMode.Load()
+}
+
+// IsGuestID ゲストに割り当てたIDかを返す
+func IsGuestID(id string) bool {
+	return strings.HasPrefix(id, GuestIDPrefix)
+}
+
+// IsGuest ゲストのトークンかを返す
+func (c *Claims) IsGuest() bool {
+	return c.HasRole(RoleGuest)
+}
+
+func newGuestID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return GuestIDPrefix + hex.EncodeToString(b), nil
+}
+
+// GuestLoginHandler ゲストIDを発行してゲスト用のトークンを返すハンドラー
+// ゲストはレートの変動しないカジュアル戦のみ遊べる
+func GuestLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !GuestModeEnabled() {
+			http.Error(w, "ゲストでのプレイは現在できません", http.StatusForbidden)
+			return
+		}
+
+		guestID, err := newGuestID()
+		if err != nil {
+			http.Error(w, "ゲストIDの発行に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		token, err := startSession(w, r, guestID, GuestTokenTTL, RoleGuest)
+		if err != nil {
+			http.Error(w, "セッションの作成に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   "success",
+			"guest_id": guestID,
+			"token":    token,
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// TokenCookieName ログイン時にトークンを保存するCookieの名前
+const TokenCookieName = "token"
+
+type contextKey struct{}
+
+// Middleware リクエストのトークンとセッションを検証し、有効であれば中身をコンテキストに保存する
+// トークンは Authorization: Bearer ヘッダー、Cookie、?token= の順に探す
+// ブラウザのWebSocketはヘッダーを付けられないため、アップグレード時はCookieかクエリを使う
+// トークンがない・不正なリクエストもそのまま通すので、ログインが必要かは各ハンドラーで判断する
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := tokenFromRequest(r); token != "" {
+			if claims, err := Authenticate(r.Context(), token); err == nil {
+				r = r.WithContext(WithClaims(r.Context(), claims))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAuth ログインしていないリクエスト(ゲストを含む)を401で拒否する
+func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := UserID(r); !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if cookie, err := r.Cookie(TokenCookieName); err == nil {
+		return cookie.Value
+	}
+	return r.URL.Query().Get("token")
+}
+
+// WithClaims 検証済みのトークンの中身を保存したコンテキストを返す
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromRequest Middlewareで検証済みのトークンの中身を返す
+func FromRequest(r *http.Request) (*Claims, bool) {
+	claims, ok := r.Context().Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// UserID ログイン中のユーザーIDを返す
+// ゲストはアカウントを持たないのでfalseを返す
+// APIキーはスコープで許可された操作にしか使えないので、ログインとしては扱わない
+func UserID(r *http.Request) (string, bool) {
+	claims, ok := FromRequest(r)
+	if !ok || claims.IsGuest() || claims.IsAPIKey() {
+		return "", false
+	}
+	return claims.UserID(), true
+}
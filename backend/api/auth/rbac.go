@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sys3/api/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// RoleModerator 通報の対応や部屋の強制終了ができる
+const RoleModerator = "moderator"
+
+// roleLevels 上位のロールは下位のロールの権限も持つ
+var roleLevels = map[string]int{
+	RoleGuest:     0,
+	RolePlayer:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// IsValidRole アカウントに設定できるロールかを返す
+func IsValidRole(role string) bool {
+	return role == RolePlayer || role == RoleModerator || role == RoleAdmin
+}
+
+// HasRoleAtLeast 指定したロール以上の権限を持っているかを返す
+func (c *Claims) HasRoleAtLeast(role string) bool {
+	required, ok := roleLevels[role]
+	if !ok {
+		return false
+	}
+	for _, r := range c.Roles {
+		if level, ok := roleLevels[r]; ok && level >= required {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole 指定したロール以上の権限を持つユーザーだけを通す
+// ログインしていなければ401、権限が足りなければ403を返す
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromRequest(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		if !claims.HasRoleAtLeast(role) {
+			http.Error(w, "権限がありません", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// userRole アカウントに設定されているロールを返す
+// アカウントの保存先が設定されていない場合やロールが不明な場合はプレイヤーとして扱う
+func userRole(ctx context.Context, username string) (string, error) {
+	if users == nil {
+		return RolePlayer, nil
+	}
+	role, err := users.GetRole(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !IsValidRole(role)) {
+		return RolePlayer, nil
+	}
+	return role, err
+}
+
+// SetRoleHandler アカウントのロールを変更する管理者用ハンドラー
+// 変更したアカウントのセッションは無効にするので、次のログインから新しいロールになる
+func SetRoleHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["id"]
+		var request struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !IsValidRole(request.Role) {
+			http.Error(w, "無効なロールです", http.StatusBadRequest)
+			return
+		}
+
+		err := users.SetRole(r.Context(), username, request.Role)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "ユーザーが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "ロールの変更に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if err := RevokeUserSessions(r.Context(), username); err != nil {
+			http.Error(w, "セッションの無効化に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sys3/api/clientip"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrSessionRevoked セッションがログアウトなどで無効になっている
+var ErrSessionRevoked = errors.New("セッションは無効になっています")
+
+// MaxSessionAge ログインしてからトークンを更新し続けられる期間
+// 過ぎたら盗まれたトークンでも使い続けられないよう、ログインし直してもらう
+const MaxSessionAge = 7 * 24 * time.Hour
+
+// Session サーバー側で管理するログインセッション
+// 発行したトークンにはセッションIDを含め、検証時にセッションが有効かも確認する
+type Session struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	sessions repository.SessionRepository
+	apiKeys  repository.APIKeyRepository
+	users    repository.UserRepository
+)
+
+// SetSessionRepository セッションの保存先を設定する。サーバー起動前に呼び出すこと
+// 設定しない場合はトークンの署名と有効期限だけで検証する
+func SetSessionRepository(repo repository.SessionRepository) {
+	sessions = repo
+}
+
+// SetAPIKeyRepository APIキーの保存先を設定する。サーバー起動前に呼び出すこと
+// 設定しない場合はAPIキーを発行・認証できない
+func SetAPIKeyRepository(repo repository.APIKeyRepository) {
+	apiKeys = repo
+}
+
+// SetUserRepository ロールを読み込むアカウントの保存先を設定する。サーバー起動前に呼び出すこと
+// 設定しない場合は全てのアカウントをプレイヤーとして扱う
+func SetUserRepository(repo repository.UserRepository) {
+	users = repo
+}
+
+var (
+	revokeMu    sync.RWMutex
+	revokeHooks []func(username, sessionID string)
+)
+
+// OnRevoke セッションが無効になったときに呼び出す関数を登録する
+// 接続中のWebSocketを切断するために使う。sessionIDが空の場合はユーザーの全てのセッション
+func OnRevoke(hook func(username, sessionID string)) {
+	revokeMu.Lock()
+	defer revokeMu.Unlock()
+	revokeHooks = append(revokeHooks, hook)
+}
+
+func notifyRevoke(username, sessionID string) {
+	revokeMu.RLock()
+	defer revokeMu.RUnlock()
+	for _, hook := range revokeHooks {
+		hook(username, sessionID)
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateSession ユーザーの新しいセッションを作成する
+func CreateSession(ctx context.Context, username, ip, userAgent string) (Session, error) {
+	return createSession(ctx, username, ip, userAgent, TokenTTL)
+}
+
+func createSession(ctx context.Context, username, ip, userAgent string, ttl time.Duration) (Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return Session{}, err
+	}
+	// user_agentの列の長さに収める
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	now := time.Now()
+	session := Session{
+		ID:        id,
+		Username:  username,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if sessions == nil {
+		return session, nil
+	}
+
+	err = sessions.CreateSession(ctx, repository.Session{
+		ID:        session.ID,
+		Username:  session.Username,
+		IP:        session.IP,
+		UserAgent: session.UserAgent,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// StartSession セッションを作成してトークンを発行し、Cookieに保存する
+// パスワードでのログインとOAuthでのログインで同じトークンを使うための共通処理
+// トークンにはアカウントに設定されているロールを含める
+func StartSession(w http.ResponseWriter, r *http.Request, username string) (string, error) {
+	role, err := userRole(r.Context(), username)
+	if err != nil {
+		return "", err
+	}
+	return startSession(w, r, username, TokenTTL, role)
+}
+
+func startSession(w http.ResponseWriter, r *http.Request, username string, ttl time.Duration, roles ...string) (string, error) {
+	session, err := createSession(r.Context(), username, clientip.FromRequest(r), r.UserAgent(), ttl)
+	if err != nil {
+		return "", err
+	}
+	token, err := IssueToken(session, roles...)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     TokenCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   false, // 開発環境ではfalse
+		SameSite: http.SameSiteLaxMode,
+	})
+	setCSRFCookie(w, session.ID, int(ttl.Seconds()))
+	return token, nil
+}
+
+// ValidateSession セッションが有効期限内で、無効にされていないかを確認する
+func ValidateSession(ctx context.Context, sessionID, username string) error {
+	if sessions == nil {
+		return nil
+	}
+
+	session, err := sessions.GetSession(ctx, sessionID, username)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.RevokedAt != nil) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return ErrExpiredToken
+	}
+	touchSession(ctx, sessionID)
+	return nil
+}
+
+// RevokeSession セッションを無効にする(ログアウト)
+func RevokeSession(ctx context.Context, username, sessionID string) error {
+	if sessions != nil {
+		// 無効にした後のログアウトなど、既に無効なセッションはそのままにする
+		err := sessions.RevokeSession(ctx, sessionID, username)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	}
+	notifyRevoke(username, sessionID)
+	return nil
+}
+
+// RevokeUserSessions ユーザーの全てのセッションを無効にする(アカウントの停止など)
+func RevokeUserSessions(ctx context.Context, username string) error {
+	if sessions != nil {
+		if err := sessions.RevokeUserSessions(ctx, username); err != nil {
+			return err
+		}
+	}
+	notifyRevoke(username, "")
+	return nil
+}
+
+// Authenticate トークンの署名と有効期限、セッションの状態を検証して中身を返す
+// APIキー(qk_で始まる)の場合はキーを検証する
+func Authenticate(ctx context.Context, token string) (*Claims, error) {
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return authenticateAPIKey(ctx, token)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateSession(ctx, claims.SessionID(), claims.UserID()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RevokeUserSessionsHandler 指定したユーザーの全てのセッションを無効にする管理者用ハンドラー
+// 接続中のWebSocketも切断されるので、すぐに対戦できなくなる
+func RevokeUserSessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["id"]
+		if err := RevokeUserSessions(r.Context(), username); err != nil {
+			http.Error(w, "セッションの無効化に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RefreshSession セッションの有効期限を延長し、新しいトークンを発行する
+// 対戦中などで長く接続しているクライアントが、接続を切らずにトークンを更新するために使う
+// ログインしてからMaxSessionAgeを過ぎたセッションは延長できない。ロールはアカウントから読み直す
+func RefreshSession(ctx context.Context, claims *Claims) (string, time.Time, error) {
+	ttl := TokenTTL
+	roles := claims.Roles
+	if claims.IsGuest() {
+		ttl = GuestTokenTTL
+	} else {
+		role, err := userRole(ctx, claims.UserID())
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		roles = []string{role}
+	}
+
+	// トークンの発行日時は更新してもログインした日時のままにしている
+	session := Session{ID: claims.SessionID(), Username: claims.UserID()}
+	if claims.IssuedAt != nil {
+		session.CreatedAt = claims.IssuedAt.Time
+	}
+	if sessions != nil {
+		stored, err := sessions.GetSession(ctx, session.ID, session.Username)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && stored.RevokedAt != nil) {
+			return "", time.Time{}, ErrSessionRevoked
+		}
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		session.CreatedAt = stored.CreatedAt
+	}
+
+	now := time.Now()
+	maxExpiresAt := session.CreatedAt.Add(MaxSessionAge)
+	if !now.Before(maxExpiresAt) {
+		return "", time.Time{}, ErrExpiredToken
+	}
+	session.ExpiresAt = now.Add(ttl)
+	if session.ExpiresAt.After(maxExpiresAt) {
+		session.ExpiresAt = maxExpiresAt
+	}
+
+	if sessions != nil {
+		err := sessions.ExtendSession(ctx, session.ID, session.Username, session.ExpiresAt)
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", time.Time{}, ErrSessionRevoked
+		}
+		if err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	token, err := IssueToken(session, roles...)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
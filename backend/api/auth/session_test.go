@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sys3/api/repository"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// useMemoryRepos セッションとアカウントの保存先をメモリ上のリポジトリにする
+func useMemoryRepos(t *testing.T) (*repository.MemorySessionRepository, *repository.MemoryUserRepository) {
+	t.Helper()
+	sessionRepo := repository.NewMemorySessionRepository()
+	userRepo := repository.NewMemoryUserRepository()
+	SetSessionRepository(sessionRepo)
+	SetUserRepository(userRepo)
+	t.Cleanup(func() {
+		SetSessionRepository(nil)
+		SetUserRepository(nil)
+	})
+	return sessionRepo, userRepo
+}
+
+// loginAt createdAtにログインしたセッションのトークンの中身を返す
+func loginAt(t *testing.T, username string, createdAt time.Time, roles ...string) *Claims {
+	t.Helper()
+	session := Session{
+		ID:        "s-" + createdAt.Format(time.RFC3339Nano),
+		Username:  username,
+		CreatedAt: createdAt,
+		ExpiresAt: time.Now().Add(TokenTTL),
+	}
+	err := sessions.CreateSession(context.Background(), repository.Session{
+		ID:        session.ID,
+		Username:  session.Username,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := IssueToken(session, roles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestRefreshSessionMaxAge(t *testing.T) {
+	useMemoryRepos(t)
+	ctx := context.Background()
+
+	claims := loginAt(t, "alice", time.Now().Add(-MaxSessionAge-time.Minute), RolePlayer)
+	if _, _, err := RefreshSession(ctx, claims); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expired session: err = %v, want ErrExpiredToken", err)
+	}
+
+	createdAt := time.Now().Add(-MaxSessionAge + time.Hour)
+	claims = loginAt(t, "alice", createdAt, RolePlayer)
+	_, expiresAt, err := RefreshSession(ctx, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := createdAt.Add(MaxSessionAge); expiresAt.After(want) {
+		t.Errorf("expiresAt = %v, want no later than %v", expiresAt, want)
+	}
+}
+
+func TestRefreshSessionRevoked(t *testing.T) {
+	useMemoryRepos(t)
+	ctx := context.Background()
+
+	claims := loginAt(t, "alice", time.Now(), RolePlayer)
+	if err := RevokeSession(ctx, "alice", claims.SessionID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RefreshSession(ctx, claims); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("err = %v, want ErrSessionRevoked", err)
+	}
+	// ログアウト済みのセッションをもう一度ログアウトしてもエラーにしない
+	if err := RevokeSession(ctx, "alice", claims.SessionID()); err != nil {
+		t.Errorf("second revoke: err = %v", err)
+	}
+}
+
+func TestRefreshSessionReloadsRole(t *testing.T) {
+	_, userRepo := useMemoryRepos(t)
+	ctx := context.Background()
+	if err := userRepo.Create(ctx, repository.NewUser{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := userRepo.SetRole(ctx, "alice", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	claims := loginAt(t, "alice", time.Now(), RoleAdmin)
+	if err := userRepo.SetRole(ctx, "alice", RolePlayer); err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := RefreshSession(ctx, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.HasRole(RoleAdmin) || !refreshed.HasRole(RolePlayer) {
+		t.Errorf("roles = %v, want [%s]", refreshed.Roles, RolePlayer)
+	}
+	if !refreshed.IssuedAt.Equal(claims.IssuedAt.Time) {
+		t.Errorf("IssuedAt = %v, want %v", refreshed.IssuedAt, claims.IssuedAt)
+	}
+}
+
+func TestSetRoleHandler(t *testing.T) {
+	_, userRepo := useMemoryRepos(t)
+	ctx := context.Background()
+	if err := userRepo.Create(ctx, repository.NewUser{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	claims := loginAt(t, "alice", time.Now(), RolePlayer)
+
+	tests := []struct {
+		name     string
+		username string
+		body     string
+		want     int
+	}{
+		{"change", "alice", `{"role":"moderator"}`, http.StatusNoContent},
+		{"same role", "alice", `{"role":"moderator"}`, http.StatusNoContent},
+		{"unknown user", "bob", `{"role":"moderator"}`, http.StatusNotFound},
+		{"invalid role", "alice", `{"role":"owner"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/users/"+tt.username+"/role", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.username})
+			rec := httptest.NewRecorder()
+			SetRoleHandler()(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	if role, _ := userRole(ctx, "alice"); role != RoleModerator {
+		t.Errorf("role = %q, want %q", role, RoleModerator)
+	}
+	// ロールを変えたアカウントは新しいロールでログインし直す
+	if err := ValidateSession(ctx, claims.SessionID(), "alice"); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("ValidateSession err = %v, want ErrSessionRevoked", err)
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenTTL 発行したトークンの有効期間
+const TokenTTL = 24 * time.Hour
+
+// ロール
+const (
+	RolePlayer = "player"
+	RoleAdmin  = "admin"
+)
+
+var (
+	ErrInvalidToken = errors.New("トークンが不正です")
+	ErrExpiredToken = errors.New("トークンの有効期限が切れています")
+)
+
+var secret []byte
+
+// SetSecret トークンの署名に使う秘密鍵を設定する
+// 空の場合はランダムな鍵を生成する(サーバーを再起動すると発行済みのトークンは無効になる)
+func SetSecret(key string) {
+	if key != "" {
+		secret = []byte(key)
+		return
+	}
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("秘密鍵の生成に失敗しました: %v", err))
+	}
+}
+
+func init() {
+	SetSecret("")
+}
+
+// Claims トークンに含める情報
+// ユーザーIDはsub、セッションIDはjtiに入れる
+// Scopesはトークンには含めず、APIキーで認証したときだけ設定する
+type Claims struct {
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"-"`
+	jwt.RegisteredClaims
+
+	apiKey bool
+}
+
+// UserID トークンの持ち主のユーザーID
+func (c *Claims) UserID() string {
+	return c.Subject
+}
+
+// SessionID トークンを発行したセッションのID
+func (c *Claims) SessionID() string {
+	return c.ID
+}
+
+// HasRole 指定したロールを持っているかを返す
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IssueToken セッションのユーザーIDとロールを含む署名付きのJWTを発行する
+// 有効期限はセッションに合わせる
+func IssueToken(session Session, roles ...string) (string, error) {
+	claims := Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID,
+			Subject:   session.Username,
+			IssuedAt:  jwt.NewNumericDate(session.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// ValidateToken JWTの署名と有効期限を検証して中身を返す
+func ValidateToken(token string) (*Claims, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpiredToken
+	}
+	if err != nil || !parsed.Valid || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
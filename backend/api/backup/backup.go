@@ -0,0 +1,232 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sys3/api/repository"
+	"time"
+)
+
+// Export tablesの内容を全て読み出してwに書き出す
+func Export(ctx context.Context, db *sql.DB, dialect repository.Dialect, tables []string, w io.Writer) error {
+	dump := Dump{
+		Version:   FormatVersion,
+		CreatedAt: time.Now(),
+		Driver:    dialect.Name(),
+	}
+	for _, name := range tables {
+		table, err := exportTable(ctx, db, name)
+		if err != nil {
+			return fmt.Errorf("%sの書き出しに失敗しました: %w", name, err)
+		}
+		dump.Tables = append(dump.Tables, table)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(dump)
+}
+
+func exportTable(ctx context.Context, db *sql.DB, name string) (Table, error) {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM "+name)
+	if err != nil {
+		return Table{}, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return Table{}, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{Name: name, Columns: columns, Rows: [][]json.RawMessage{}}
+	timeColumns := make([]bool, len(columns))
+	boolColumns := make([]bool, len(columns))
+	for i, t := range types {
+		// MySQLのBOOLEANはTINYINT(1)として作られる
+		switch strings.ToUpper(t.DatabaseTypeName()) {
+		case "BOOL", "BOOLEAN", "TINYINT":
+			boolColumns[i] = true
+		}
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return Table{}, err
+		}
+		row := make([]json.RawMessage, len(columns))
+		for i, v := range values {
+			switch value := v.(type) {
+			case []byte:
+				// ドライバーによっては文字列の列も[]byteで返る
+				v = string(value)
+			case time.Time:
+				timeColumns[i] = true
+				v = value.UTC().Format(time.RFC3339Nano)
+			case int64:
+				if boolColumns[i] {
+					v = value != 0
+				}
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return Table{}, err
+			}
+			row[i] = data
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	for i := range columns {
+		if timeColumns[i] {
+			table.TimeColumns = append(table.TimeColumns, columns[i])
+		}
+		if boolColumns[i] {
+			table.BoolColumns = append(table.BoolColumns, columns[i])
+		}
+	}
+	return table, rows.Err()
+}
+
+// Import rのダンプをデータベースに書き込む
+// replaceがtrueの場合はダンプに含まれるテーブルの既存の行を削除してから書き込む
+// falseの場合は書き込み先のテーブルが空でなければ何もせずにエラーを返す
+// 全て1つのトランザクションで行うので、途中で失敗した場合は何も変更されない
+func Import(ctx context.Context, db *sql.DB, dialect repository.Dialect, r io.Reader, replace bool) (int, error) {
+	var dump Dump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return 0, fmt.Errorf("ダンプの形式が正しくありません: %w", err)
+	}
+	if dump.Version != FormatVersion {
+		return 0, fmt.Errorf("対応していないダンプのバージョンです: %d", dump.Version)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// 参照している側のテーブルから先に削除する
+	for i := len(dump.Tables) - 1; i >= 0; i-- {
+		name := dump.Tables[i].Name
+		if replace {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+name); err != nil {
+				return 0, fmt.Errorf("%sの削除に失敗しました: %w", name, err)
+			}
+			continue
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+name).Scan(&count); err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			return 0, fmt.Errorf("%sが空ではありません(上書きする場合はreplaceを指定してください)", name)
+		}
+	}
+
+	total := 0
+	for _, table := range dump.Tables {
+		n, err := importTable(ctx, tx, dialect, table)
+		if err != nil {
+			return 0, fmt.Errorf("%sの書き込みに失敗しました: %w", table.Name, err)
+		}
+		total += n
+	}
+	if dialect.Name() == repository.DriverPostgres {
+		if err := resetSequences(ctx, tx, dump.Tables); err != nil {
+			return 0, err
+		}
+	}
+	return total, tx.Commit()
+}
+
+func importTable(ctx context.Context, tx *sql.Tx, dialect repository.Dialect, table Table) (int, error) {
+	if len(table.Rows) == 0 {
+		return 0, nil
+	}
+	isTime := make(map[string]bool, len(table.TimeColumns))
+	for _, c := range table.TimeColumns {
+		isTime[c] = true
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+	query := dialect.Rebind(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table.Name, strings.Join(table.Columns, ", "), placeholders))
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, row := range table.Rows {
+		if len(row) != len(table.Columns) {
+			return 0, fmt.Errorf("列の数が一致しません")
+		}
+		args := make([]interface{}, len(row))
+		for i, raw := range row {
+			value, err := decodeValue(raw, isTime[table.Columns[i]])
+			if err != nil {
+				return 0, err
+			}
+			args[i] = value
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return 0, err
+		}
+	}
+	return len(table.Rows), nil
+}
+
+// decodeValue 書き出した値をドライバーに渡せる値に戻す
+// 数値は整数ならint64、それ以外はfloat64にする
+func decodeValue(raw json.RawMessage, isTime bool) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch value := v.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n, nil
+		}
+		return value.Float64()
+	case string:
+		if isTime {
+			return time.Parse(time.RFC3339Nano, value)
+		}
+	}
+	return v, nil
+}
+
+// resetSequences PostgreSQLではIDを指定して挿入しても連番が進まないので、最大値に合わせる
+func resetSequences(ctx context.Context, tx *sql.Tx, tables []Table) error {
+	for _, table := range tables {
+		hasID := false
+		for _, c := range table.Columns {
+			if c == "id" {
+				hasID = true
+			}
+		}
+		if !hasID || len(table.Rows) == 0 {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%s', 'id'), (SELECT MAX(id) FROM %s))", table.Name, table.Name))
+		if err != nil {
+			return fmt.Errorf("%sの連番の更新に失敗しました: %w", table.Name, err)
+		}
+	}
+	return nil
+}
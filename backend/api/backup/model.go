@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FormatVersion ダンプの形式のバージョン
+const FormatVersion = 1
+
+// Dump データベースの種類に依存しない形式で書き出したテーブルの内容
+type Dump struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Driver    string    `json:"driver"` // 書き出し元のデータベース(参考情報)
+	Tables    []Table   `json:"tables"`
+}
+
+// Table 1つのテーブルの内容
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	// TimeColumns 日時の列。RFC3339の文字列で書き出し、読み込み時にtime.Timeに戻す
+	TimeColumns []string `json:"time_columns,omitempty"`
+	// BoolColumns 真偽値の列。MySQLでは数値になるので、書き出し時にtrue/falseに揃える
+	BoolColumns []string            `json:"bool_columns,omitempty"`
+	Rows        [][]json.RawMessage `json:"rows"`
+}
+
+// QuestionTables 問題集だけを移すときのテーブル
+var QuestionTables = []string{"questions", "question_versions", "question_stats", "question_reviews", "question_reports", "categories", "tags", "question_categories", "question_tags", "question_pools", "question_pool_members", "question_translations"}
+
+// CoreTables 環境を移すときに書き出すテーブル(外部キーの参照先を先に並べる)
+// セッション・APIキー・メールのトークンは環境ごとのものなので含めない
+var CoreTables = []string{
+	"users",
+	"user_profiles",
+	"oauth_accounts",
+	"friends",
+	"friend_requests",
+	"questions",
+	"question_versions",
+	"question_stats",
+	"question_reviews",
+	"question_reports",
+	"categories",
+	"tags",
+	"question_categories",
+	"question_tags",
+	"question_pools",
+	"question_pool_members",
+	"question_translations",
+	"player_ratings",
+	"player_stats",
+	"seasons",
+	"season_ratings",
+	"matches",
+	"rating_history",
+	"match_answers",
+	"match_buzzes",
+	"smurf_flags",
+}
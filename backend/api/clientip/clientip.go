@@ -0,0 +1,99 @@
+package clientip
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// 信頼するプロキシのアドレス範囲
+// ここに含まれるアドレスからのリクエストのみX-Forwarded-For/X-Real-IPを信用する
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies 信頼するプロキシをCIDRまたはIPアドレスで設定する
+// サーバー起動前に呼び出すこと
+func SetTrustedProxies(proxies []string) {
+	trustedProxies = nil
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			slog.Warn("信頼するプロキシの設定が不正です", "proxy", proxy)
+			continue
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+}
+
+func isTrusted(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve リクエストの送信元の実際のIPアドレスを返す
+// 直接の接続元が信頼するプロキシの場合のみ、X-Forwarded-Forを右から辿って
+// 信頼するプロキシ以外の最初のアドレスを使う
+func Resolve(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil || !isTrusted(remoteIP) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !isTrusted(ip) {
+				return ip.String()
+			}
+		}
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+	return remote
+}
+
+// Middleware 解決したIPアドレスをリクエストのコンテキストに保存する
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKey{}, Resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FromRequest コンテキストに保存されたIPアドレスを返す
+// Middlewareを通っていない場合はその場で解決する
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+	return Resolve(r)
+}
@@ -0,0 +1,178 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+var outbox repository.EventRepository
+
+// SetEventRepository 送信前のイベントの保存先を設定する
+// サーバー起動前に呼び出すこと。設定しない場合はイベントを保存も送信もしない
+func SetEventRepository(repo repository.EventRepository) {
+	outbox = repo
+}
+
+const (
+	// 1回にまとめて送るイベントの最大数
+	batchSize = 100
+	// 送信済みのイベントを残しておく期間
+	deliveredRetention = 24 * time.Hour
+)
+
+var (
+	// wake Emitしたことを送信のゴルーチンに知らせる
+	wake = make(chan struct{}, 1)
+	// publishMu 同じサーバーの中で同じイベントを同時に送らないようにする
+	publishMu sync.Mutex
+)
+
+// enabled 送信先が設定されているか。NopSinkの場合はイベントを保存しない
+func enabled() bool {
+	_, nop := sink.(NopSink)
+	return outbox != nil && !nop
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Emit イベントを保存し、送信のゴルーチンに知らせる。呼び出し元は送信を待たない
+// 先に保存してから送るので、送信先やサーバーが途中で落ちても、送信済みになるまで送り直す
+func Emit(ctx context.Context, e Event) {
+	if !enabled() {
+		return
+	}
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("対戦のイベントの変換エラー", "event_type", e.Type, logging.KeyRoomID, e.RoomID, logging.Err(err))
+		return
+	}
+
+	// 対戦が終わった直後のイベントも保存できるように、部屋のコンテキストのキャンセルは引き継がない
+	ctx, cancel := repository.WithTimeout(context.WithoutCancel(ctx))
+	defer cancel()
+	err = outbox.SaveEvent(ctx, repository.OutboxEvent{
+		EventID:   e.ID,
+		Type:      e.Type,
+		RoomID:    e.RoomID,
+		Payload:   string(payload),
+		CreatedAt: e.OccurredAt,
+	})
+	if err != nil {
+		slog.Error("対戦のイベントの保存エラー", "event_type", e.Type, logging.KeyRoomID, e.RoomID, logging.Err(err))
+		return
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// StartPublisher 保存したイベントを送信先に送るゴルーチンを起動する
+// intervalごと、またはEmitされたときに、送信していないイベントを古い順にまとめて送る
+// 送信に失敗したイベントは次の機会にもう一度送る
+func StartPublisher(interval time.Duration) {
+	if !enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		failing := false
+		lastCleanup := time.Now()
+		for {
+			select {
+			case <-ticker.C:
+			case <-wake:
+			}
+
+			err := Flush(context.Background())
+			// 送信先が落ちている間に同じ警告を出し続けないように、失敗し始めたときと回復したときだけ記録する
+			if err != nil && !failing {
+				slog.Warn("対戦のイベントを送信できません。送信できるまで再試行します", logging.Err(err))
+			} else if err == nil && failing {
+				slog.Info("対戦のイベントの送信が回復しました")
+			}
+			failing = err != nil
+
+			if time.Since(lastCleanup) >= time.Hour {
+				deleteDelivered()
+				lastCleanup = time.Now()
+			}
+		}
+	}()
+}
+
+// Flush 送信していないイベントを全て送る。サーバーの停止時にも、接続を閉じる前に呼ぶ
+func Flush(ctx context.Context) error {
+	if !enabled() {
+		return nil
+	}
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	for {
+		n, err := publishBatch(ctx)
+		if err != nil || n < batchSize {
+			return err
+		}
+	}
+}
+
+// publishBatch 送信していないイベントを古い順に最大batchSize件送り、送信済みにした件数を返す
+func publishBatch(ctx context.Context) (int, error) {
+	qctx, cancel := repository.WithTimeout(ctx)
+	defer cancel()
+	pending, err := outbox.PendingEvents(qctx, batchSize)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	ids := make([]int64, len(pending))
+	var batch []Event
+	for i, saved := range pending {
+		ids[i] = saved.ID
+		var e Event
+		if err := json.Unmarshal([]byte(saved.Payload), &e); err != nil {
+			// 読めないイベントは送らずに送信済みにして、後のイベントが止まらないようにする
+			slog.Error("対戦のイベントを読み取れないため破棄します", "id", saved.ID, logging.Err(err))
+			continue
+		}
+		batch = append(batch, e)
+	}
+
+	if len(batch) > 0 {
+		if err := sink.Publish(qctx, batch); err != nil {
+			outbox.IncrementAttempts(qctx, ids)
+			return 0, err
+		}
+	}
+	// ここで失敗すると次の機会に同じイベントをもう一度送ることになるが、受信側でIDを使って重複を取り除く
+	if err := outbox.MarkDelivered(qctx, ids, time.Now()); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// deleteDelivered 送信してからdeliveredRetentionが過ぎたイベントを削除する
+func deleteDelivered() {
+	ctx, cancel := repository.WithTimeout(context.Background())
+	defer cancel()
+	if err := outbox.DeleteDelivered(ctx, time.Now().Add(-deliveredRetention)); err != nil {
+		slog.Warn("送信済みの対戦のイベントの削除エラー", logging.Err(err))
+	}
+}
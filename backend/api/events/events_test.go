@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sys3/api/repository"
+	"testing"
+)
+
+// fakeSink 受け取ったイベントを記録する送信先。errを設定すると送信に失敗する
+type fakeSink struct {
+	published []Event
+	err       error
+}
+
+func (s *fakeSink) Publish(ctx context.Context, events []Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.published = append(s.published, events...)
+	return nil
+}
+
+func useFakeSink(t *testing.T) (*fakeSink, *repository.MemoryEventRepository) {
+	t.Helper()
+	fake := &fakeSink{}
+	repo := repository.NewMemoryEventRepository()
+	SetSink(fake)
+	SetEventRepository(repo)
+	t.Cleanup(func() {
+		SetSink(NopSink{})
+		SetEventRepository(nil)
+	})
+	return fake, repo
+}
+
+func TestFlushRetriesFailedEvents(t *testing.T) {
+	fake, repo := useFakeSink(t)
+	ctx := context.Background()
+
+	fake.err = errors.New("sink down")
+	Emit(ctx, Event{Type: TypeMatchStarted, RoomID: "r1"})
+	Emit(ctx, Event{Type: TypeMatchFinished, RoomID: "r1"})
+	if err := Flush(ctx); err == nil {
+		t.Fatal("Flush succeeded while the sink is down")
+	}
+	if n := repo.Attempts(1); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+
+	// 送信先が回復したら保存しておいたイベントを順に送る
+	fake.err = nil
+	if err := Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.published) != 2 || fake.published[0].Type != TypeMatchStarted || fake.published[1].Type != TypeMatchFinished {
+		t.Fatalf("published = %+v", fake.published)
+	}
+	if fake.published[0].ID == "" {
+		t.Error("event ID is empty")
+	}
+
+	// 送信済みのイベントは送り直さない
+	if err := Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.published) != 2 {
+		t.Errorf("published %d events after the second flush, want 2", len(fake.published))
+	}
+}
@@ -0,0 +1,25 @@
+package events
+
+import "time"
+
+// 対戦のイベントの種類
+const (
+	TypeMatchCreated  = "match.created"   // 部屋を作って対戦相手を待ち始めた
+	TypeMatchTimedOut = "match.timed_out" // 対戦相手が見つからなかった
+	TypeMatchStarted  = "match.started"   // 対戦を始めた
+	TypeMatchFinished = "match.finished"  // 対戦が終わった。終わり方はData["result"]
+)
+
+// Event 分析基盤に送る対戦のイベント
+// 少なくとも1回は届けるため、同じIDのイベントが2回以上届くことがある。受信側でIDを使って重複を取り除くこと
+type Event struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	RoomID     string                 `json:"room_id"`
+	GameType   string                 `json:"game_type"`
+	Mode       string                 `json:"mode"`
+	PoolID     int                    `json:"pool_id,omitempty"`
+	Players    []string               `json:"players"`
+	Data       map[string]interface{} `json:"data,omitempty"` // イベントの種類ごとの内容
+	OccurredAt time.Time              `json:"occurred_at"`
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sink イベントの送信先を抽象化するインターフェース
+// Publishがエラーを返したイベントは、後でもう一度まとめて送る
+type Sink interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+// NopSink イベントをどこにも送らない。送信先を設定しない場合に使い、イベントを保存もしない
+type NopSink struct{}
+
+func (NopSink) Publish(ctx context.Context, events []Event) error {
+	return nil
+}
+
+// RedisStreamSink Redis StreamsにイベントをXADDする
+// 1件ごとにtype・id・payload(イベント全体のJSON)のフィールドを持つエントリーになる
+type RedisStreamSink struct {
+	Client *redis.Client
+	Stream string
+	MaxLen int64 // ストリームに残すおおよその件数。0なら削らない
+}
+
+// NewRedisStreamSink redis://形式のURLのRedisに送るRedisStreamSinkを作成する
+func NewRedisStreamSink(url, stream string, maxLen int64) (*RedisStreamSink, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStreamSink{Client: redis.NewClient(opts), Stream: stream, MaxLen: maxLen}, nil
+}
+
+func (s *RedisStreamSink) Publish(ctx context.Context, events []Event) error {
+	pipe := s.Client.Pipeline()
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.Stream,
+			MaxLen: s.MaxLen,
+			Approx: s.MaxLen > 0,
+			Values: map[string]interface{}{"type": e.Type, "id": e.ID, "payload": payload},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+var sink Sink = NopSink{}
+
+// SetSink イベントの送信先を設定する
+// サーバー起動前に呼び出すこと
+func SetSink(s Sink) {
+	sink = s
+}
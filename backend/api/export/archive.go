@@ -0,0 +1,44 @@
+package export
+
+import (
+	"context"
+	"sys3/api/account"
+	"sys3/api/repository"
+	"time"
+)
+
+// Sources エクスポートに含めるデータの読み取り先
+type Sources struct {
+	Users      repository.UserRepository
+	Profiles   repository.ProfileRepository
+	PlayerData repository.PlayerDataRepository
+}
+
+// Build ユーザーのデータを全て集めてArchiveを作成する
+func Build(ctx context.Context, sources Sources, username string) (Archive, error) {
+	archive := Archive{
+		Username:    username,
+		GeneratedAt: time.Now(),
+	}
+
+	user, err := sources.Users.FindByUsername(ctx, username)
+	if err != nil {
+		return Archive{}, err
+	}
+	archive.Account = AccountInfo{
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+	}
+
+	if archive.Profile, err = account.GetProfile(ctx, sources.Profiles, username); err != nil {
+		return Archive{}, err
+	}
+	if archive.Matches, err = sources.PlayerData.Matches(ctx, username); err != nil {
+		return Archive{}, err
+	}
+	if archive.RatingHistory, err = sources.PlayerData.RatingHistory(ctx, username); err != nil {
+		return Archive{}, err
+	}
+	return archive, nil
+}
@@ -0,0 +1,101 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"testing"
+	"time"
+)
+
+// newTestSources aliceとbobのアカウントと、2人の対戦を1つ持つ読み取り先を作成する
+func newTestSources(t *testing.T) (Sources, *repository.MemoryPlayerDataRepository) {
+	t.Helper()
+	users := repository.NewMemoryUserRepository()
+	for _, username := range []string{"alice", "bob"} {
+		if err := users.Create(context.Background(), repository.NewUser{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := repository.NewMemoryPlayerDataRepository()
+	data.AddMatch(MatchEntry{
+		ID: 1, GameType: "quiz", Rated: true, Player1ID: "alice", Player2ID: "bob", PlayedAt: time.Now(),
+		Answers: []AnswerEntry{
+			{QuestionNo: 1, QuestionID: 10, PlayerID: "alice", Answer: "a", Correct: true},
+			{QuestionNo: 2, QuestionID: 11, PlayerID: "bob", Answer: "b", Correct: true},
+		},
+	})
+	data.AddRatingChange("alice", RatingHistoryEntry{MatchID: 1, GameType: "quiz", OldRating: 1500, NewRating: 1516})
+	return Sources{Users: users, Profiles: repository.NewMemoryProfileRepository(), PlayerData: data}, data
+}
+
+func TestBuildExportsOnlyOwnAnswers(t *testing.T) {
+	sources, _ := newTestSources(t)
+	archive, err := Build(context.Background(), sources, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Matches) != 1 {
+		t.Fatalf("matches = %d, want 1", len(archive.Matches))
+	}
+	answers := archive.Matches[0].Answers
+	if len(answers) != 1 || answers[0].PlayerID != "alice" {
+		t.Errorf("answers = %+v, want only alice's answer", answers)
+	}
+	if len(archive.RatingHistory) != 1 || archive.Profile.DisplayName != "alice" {
+		t.Errorf("archive = %+v", archive)
+	}
+}
+
+func exportAs(sources Sources, username string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/players/me/export", nil)
+	claims := &auth.Claims{}
+	claims.Subject = username
+	req = req.WithContext(auth.WithClaims(req.Context(), claims))
+	rec := httptest.NewRecorder()
+	ExportHandler(sources)(rec, req)
+	return rec
+}
+
+func TestExportHandler(t *testing.T) {
+	sources, _ := newTestSources(t)
+	rec := exportAs(sources, "bob")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var archive Archive
+	if err := json.NewDecoder(rec.Body).Decode(&archive); err != nil {
+		t.Fatal(err)
+	}
+	if archive.Username != "bob" || len(archive.Matches) != 1 || len(archive.RatingHistory) != 0 {
+		t.Errorf("archive = %+v", archive)
+	}
+}
+
+// 対戦が多い場合はバックグラウンドで作成し、作成中のエクスポートを使い回す
+func TestExportHandlerReusesPendingJob(t *testing.T) {
+	sources, data := newTestSources(t)
+	for i := 0; i < SyncMatchLimit; i++ {
+		data.AddMatch(MatchEntry{ID: int64(i + 2), GameType: "quiz", Player1ID: "alice", Player2ID: "bob", PlayedAt: time.Now()})
+	}
+	t.Cleanup(func() {
+		jobsMutex.Lock()
+		defer jobsMutex.Unlock()
+		jobs = make(map[string]*job)
+	})
+
+	first := exportAs(sources, "alice")
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body = %s", first.Code, first.Body)
+	}
+	second := exportAs(sources, "alice")
+	if second.Code != http.StatusAccepted && second.Code != http.StatusOK {
+		t.Fatalf("second: status = %d, body = %s", second.Code, second.Body)
+	}
+	if first.Header().Get("Location") != second.Header().Get("Location") {
+		t.Errorf("Location = %q, want %q", second.Header().Get("Location"), first.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,207 @@
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SyncMatchLimit 対戦数がこれ以下ならリクエストの中で作成して返す
+// 超える場合はバックグラウンドで作成し、完成したらダウンロードできるようにする
+const SyncMatchLimit = 500
+
+// JobRetention 作成したエクスポートを保持しておく時間
+const JobRetention = time.Hour
+
+// buildTimeout バックグラウンドでのエクスポートの作成にかけられる時間
+const buildTimeout = 5 * time.Minute
+
+// MaxConcurrentBuilds 同時にバックグラウンドで作成できるエクスポートの数
+// 作成中はデータベースの接続を使い続けるので、対戦の記録の保存を妨げないようにする
+const MaxConcurrentBuilds = 4
+
+// buildSlots バックグラウンドで作成中のエクスポートの数を制限するセマフォ
+var buildSlots = make(chan struct{}, MaxConcurrentBuilds)
+
+// job バックグラウンドで作成するエクスポート
+type job struct {
+	username  string
+	status    string
+	archive   Archive
+	createdAt time.Time
+}
+
+var (
+	jobsMutex sync.Mutex
+	jobs      = make(map[string]*job)
+)
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// findJobLocked ユーザーの作成中か完成済みのエクスポートを返す。なければ空のIDを返す
+func findJobLocked(username string) (string, *job) {
+	for id, j := range jobs {
+		if j.username == username && j.status != StatusFailed {
+			return id, j
+		}
+	}
+	return "", nil
+}
+
+// pruneJobsLocked 保持期間を過ぎたエクスポートを削除する
+func pruneJobsLocked(now time.Time) {
+	for id, j := range jobs {
+		if now.Sub(j.createdAt) > JobRetention {
+			delete(jobs, id)
+		}
+	}
+}
+
+func jobResponse(id, status string) JobResponse {
+	return JobResponse{ID: id, Status: status, URL: "/players/me/export/" + id}
+}
+
+// writeArchive エクスポートをダウンロード用のJSONとして返す
+func writeArchive(w http.ResponseWriter, archive Archive) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-export-%s.json"`, archive.Username, archive.GeneratedAt.Format("20060102")))
+	json.NewEncoder(w).Encode(archive)
+}
+
+func writeJob(w http.ResponseWriter, status int, response JobResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", response.URL)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportHandler ログイン中のユーザーのデータを書き出すハンドラー(GET /players/me/export)
+// プロフィール、対戦履歴、問題ごとの回答、レート履歴をJSONで返す
+// 対戦数が多い場合は202とエクスポートのURLを返し、バックグラウンドで作成する
+// 作成中か完成済みのエクスポートがあれば、作り直さずにそのURLを返す
+func ExportHandler(sources Sources) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+
+		count, err := sources.PlayerData.CountMatches(r.Context(), username)
+		if err != nil {
+			http.Error(w, "データの書き出しに失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if count <= SyncMatchLimit {
+			archive, err := Build(r.Context(), sources, username)
+			if err != nil {
+				slog.Error("データの書き出しエラー", logging.KeyUserID, username, logging.Err(err))
+				http.Error(w, "データの書き出しに失敗しました", http.StatusInternalServerError)
+				return
+			}
+			writeArchive(w, archive)
+			return
+		}
+
+		id, err := newJobID()
+		if err != nil {
+			http.Error(w, "データの書き出しに失敗しました", http.StatusInternalServerError)
+			return
+		}
+		j := &job{username: username, status: StatusPending, createdAt: time.Now()}
+		jobsMutex.Lock()
+		pruneJobsLocked(j.createdAt)
+		if existingID, existing := findJobLocked(username); existing != nil {
+			status := existing.status
+			jobsMutex.Unlock()
+			code := http.StatusAccepted
+			if status == StatusReady {
+				code = http.StatusOK
+			}
+			writeJob(w, code, jobResponse(existingID, status))
+			return
+		}
+		select {
+		case buildSlots <- struct{}{}:
+		default:
+			jobsMutex.Unlock()
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "エクスポートの作成が混み合っています。しばらくしてからお試しください", http.StatusServiceUnavailable)
+			return
+		}
+		jobs[id] = j
+		jobsMutex.Unlock()
+
+		go func() {
+			defer func() { <-buildSlots }()
+			ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+			defer cancel()
+			archive, err := Build(ctx, sources, username)
+
+			jobsMutex.Lock()
+			defer jobsMutex.Unlock()
+			if err != nil {
+				slog.Error("データの書き出しエラー", logging.KeyUserID, username, logging.Err(err))
+				j.status = StatusFailed
+				return
+			}
+			j.archive = archive
+			j.status = StatusReady
+		}()
+
+		writeJob(w, http.StatusAccepted, jobResponse(id, StatusPending))
+	}
+}
+
+// ExportJobHandler バックグラウンドで作成したエクスポートを返すハンドラー(GET /players/me/export/{id})
+// 作成中の場合は202、完成していればエクスポート本体を返す
+func ExportJobHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		jobsMutex.Lock()
+		j, found := jobs[id]
+		var status string
+		var archive Archive
+		if found {
+			status, archive = j.status, j.archive
+		}
+		jobsMutex.Unlock()
+
+		// 他のユーザーのエクスポートは存在しないものとして扱う
+		if !found || j.username != username {
+			http.Error(w, "エクスポートが見つかりません", http.StatusNotFound)
+			return
+		}
+		switch status {
+		case StatusReady:
+			writeArchive(w, archive)
+		case StatusFailed:
+			http.Error(w, "データの書き出しに失敗しました", http.StatusInternalServerError)
+		default:
+			writeJob(w, http.StatusAccepted, jobResponse(id, status))
+		}
+	}
+}
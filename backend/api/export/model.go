@@ -0,0 +1,48 @@
+package export
+
+import (
+	"sys3/api/account"
+	"sys3/api/repository"
+	"time"
+)
+
+// Archive ユーザーが持ち出せる自分のデータ一式
+type Archive struct {
+	Username      string               `json:"username"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Account       AccountInfo          `json:"account"`
+	Profile       account.Profile      `json:"profile"`
+	Matches       []MatchEntry         `json:"matches"`
+	RatingHistory []RatingHistoryEntry `json:"rating_history"`
+}
+
+// AccountInfo アカウントの登録情報(パスワードのハッシュは含めない)
+type AccountInfo struct {
+	Email           string     `json:"email,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// MatchEntry 参加した対戦と、その対戦での問題ごとの回答
+type MatchEntry = repository.PlayerMatch
+
+// AnswerEntry 対戦中の1問ごとの回答
+// 対戦相手の回答は相手のデータなので含めない
+type AnswerEntry = repository.PlayerAnswer
+
+// RatingHistoryEntry レートの変動の記録
+type RatingHistoryEntry = repository.RatingChange
+
+// 作成待ちのエクスポートの状態
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// JobResponse 非同期で作成するエクスポートの状態
+type JobResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	URL    string `json:"url"` // 状態の確認と、完成後のダウンロードに使う
+}
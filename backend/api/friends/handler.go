@@ -1,20 +1,21 @@
 package friends
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sys3/api/auth"
+	"sys3/api/repository"
 )
 
 // フレンド申請を送信するハンドラー
-func SendFriendRequestHandler(db *sql.DB) http.HandlerFunc {
+func SendFriendRequestHandler(friends repository.FriendRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("username")
-		if err != nil {
+		username, ok := auth.UserID(r)
+		if !ok {
 			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
 			return
 		}
-		username := cookie.Value
 
 		var request struct {
 			FriendUsername string `json:"friend_username"`
@@ -30,11 +31,7 @@ func SendFriendRequestHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// 既存のフレンド関係をチェック
-		var exists bool
-		err = db.QueryRow(
-			"SELECT EXISTS(SELECT 1 FROM friends WHERE username = ? AND friend_username = ?)",
-			username, request.FriendUsername,
-		).Scan(&exists)
+		exists, err := friends.AreFriends(r.Context(), username, request.FriendUsername)
 		if err != nil {
 			http.Error(w, "データベースエラー", http.StatusInternalServerError)
 			return
@@ -45,10 +42,11 @@ func SendFriendRequestHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// フレンド申請を保存
-		_, err = db.Exec(
-			"INSERT INTO friend_requests (username, friend_username) VALUES (?, ?)",
-			username, request.FriendUsername,
-		)
+		err = friends.CreateFriendRequest(r.Context(), username, request.FriendUsername)
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "既にフレンド申請を送信しています", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "フレンド申請の送信に失敗しました", http.StatusInternalServerError)
 			return
@@ -62,14 +60,13 @@ func SendFriendRequestHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // フレンド申請に応答するハンドラー
-func RespondToFriendRequestHandler(db *sql.DB) http.HandlerFunc {
+func RespondToFriendRequestHandler(friends repository.FriendRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("username")
-		if err != nil {
+		username, ok := auth.UserID(r)
+		if !ok {
 			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
 			return
 		}
-		username := cookie.Value
 
 		var request Request
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -77,44 +74,21 @@ func RespondToFriendRequestHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// ステータスを更新
-		status := "rejected"
-		if request.Action == "accept" {
-			status = "accepted"
-
-			// フレンド申請の情報を取得
-			var senderUsername string
-			err = db.QueryRow(
-				"SELECT username FROM friend_requests WHERE id = ?",
-				request.RequestID,
-			).Scan(&senderUsername)
-			if err != nil {
-				http.Error(w, "フレンド申請の情報取得に失敗しました", http.StatusInternalServerError)
-				return
-			}
-
-			// friendsテーブルに追加
-			_, err = db.Exec(
-				"INSERT INTO friends (username, friend_username) VALUES (?, ?), (?, ?)",
-				username, senderUsername,
-				senderUsername, username,
-			)
-			if err != nil {
-				http.Error(w, "フレンド追加に失敗しました", http.StatusInternalServerError)
-				return
-			}
+		accept := request.Action == "accept"
+		err := friends.RespondFriendRequest(r.Context(), request.RequestID, username, accept)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "承認待ちのフレンド申請が見つかりません", http.StatusNotFound)
+			return
 		}
-
-		// friend_requestsテーブルのステータスを更新
-		_, err = db.Exec(
-			"UPDATE friend_requests SET status = ? WHERE id = ? AND friend_username = ?",
-			status, request.RequestID, username,
-		)
 		if err != nil {
 			http.Error(w, "フレンド申請の更新に失敗しました", http.StatusInternalServerError)
 			return
 		}
 
+		status := repository.FriendRequestRejected
+		if accept {
+			status = repository.FriendRequestAccepted
+		}
 		json.NewEncoder(w).Encode(FriendResponse{
 			Message: "フレンド申請を" + status + "しました",
 			Status:  status,
@@ -123,37 +97,20 @@ func RespondToFriendRequestHandler(db *sql.DB) http.HandlerFunc {
 }
 
 // 承認待ちのフレンド申請を取得するハンドラー
-func GetPendingRequestsHandler(db *sql.DB) http.HandlerFunc {
+func GetPendingRequestsHandler(friends repository.FriendRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("username")
-		if err != nil {
+		username, ok := auth.UserID(r)
+		if !ok {
 			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
 			return
 		}
-		username := cookie.Value
 
 		// 自分宛のフレンド申請を取得
-		rows, err := db.Query(`
-			SELECT id, username, friend_username, status 
-			FROM friend_requests 
-			WHERE friend_username = ? AND status = 'pending'`,
-			username,
-		)
+		requests, err := friends.PendingFriendRequests(r.Context(), username)
 		if err != nil {
 			http.Error(w, "フレンド申請の取得に失敗しました", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		var requests []FriendRequest
-		for rows.Next() {
-			var request FriendRequest
-			if err := rows.Scan(&request.ID, &request.Username, &request.FriendUsername, &request.Status); err != nil {
-				http.Error(w, "データの読み取りに失敗しました", http.StatusInternalServerError)
-				return
-			}
-			requests = append(requests, request)
-		}
 
 		json.NewEncoder(w).Encode(requests)
 	}
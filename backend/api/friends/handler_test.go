@@ -0,0 +1,74 @@
+package friends
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"testing"
+)
+
+// serve usernameでログインしたリクエストをhandlerに渡す
+func serve(handler http.HandlerFunc, username, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	claims := &auth.Claims{}
+	claims.Subject = username
+	req = req.WithContext(auth.WithClaims(req.Context(), claims))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestFriendRequestAccepted(t *testing.T) {
+	friends := repository.NewMemoryFriendRepository()
+
+	if rec := serve(SendFriendRequestHandler(friends), "alice", `{"friend_username":"bob"}`); rec.Code != http.StatusOK {
+		t.Fatalf("send: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := serve(SendFriendRequestHandler(friends), "alice", `{"friend_username":"bob"}`); rec.Code != http.StatusConflict {
+		t.Errorf("send twice: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec := serve(GetPendingRequestsHandler(friends), "bob", "")
+	var pending []FriendRequest
+	if err := json.NewDecoder(rec.Body).Decode(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Username != "alice" {
+		t.Fatalf("pending = %+v, want one request from alice", pending)
+	}
+
+	// 申請された本人以外は応答できない
+	body := `{"request_id":` + strconv.Itoa(pending[0].ID) + `,"action":"accept"}`
+	if rec := serve(RespondToFriendRequestHandler(friends), "carol", body); rec.Code != http.StatusNotFound {
+		t.Errorf("respond by other: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serve(RespondToFriendRequestHandler(friends), "bob", body); rec.Code != http.StatusOK {
+		t.Fatalf("respond: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := serve(RespondToFriendRequestHandler(friends), "bob", body); rec.Code != http.StatusNotFound {
+		t.Errorf("respond twice: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	for _, pair := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+		if ok, _ := friends.AreFriends(context.Background(), pair[0], pair[1]); !ok {
+			t.Errorf("%s and %s are not friends", pair[0], pair[1])
+		}
+	}
+	if rec := serve(SendFriendRequestHandler(friends), "bob", `{"friend_username":"alice"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("send to friend: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestFriendRequestRequiresLogin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"friend_username":"bob"}`))
+	rec := httptest.NewRecorder()
+	SendFriendRequestHandler(repository.NewMemoryFriendRepository())(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
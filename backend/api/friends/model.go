@@ -1,11 +1,8 @@
 package friends
 
-type FriendRequest struct {
-	ID             int    `json:"id"`
-	Username       string `json:"username"`
-	FriendUsername string `json:"friend_username"`
-	Status         string `json:"status"`
-}
+import "sys3/api/repository"
+
+type FriendRequest = repository.FriendRequest
 
 type FriendResponse struct {
 	Message string `json:"message"`
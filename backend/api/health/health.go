@@ -0,0 +1,98 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// 応答のstatus
+const (
+	StatusOK          = "ok"
+	StatusReady       = "ready"
+	StatusUnavailable = "unavailable"
+)
+
+// startedAt プロセスが起動した日時
+var startedAt = time.Now()
+
+// CheckResult 準備ができているかを確認した結果
+type CheckResult struct {
+	Healthy bool                   `json:"healthy"`
+	Since   *time.Time             `json:"since,omitempty"`   // この状態になった日時
+	Error   string                 `json:"error,omitempty"`   // 準備ができていない理由
+	Details map[string]interface{} `json:"details,omitempty"` // 確認した項目ごとの補足
+}
+
+// Check 準備ができているかを確認する関数
+// ロードバランサーから頻繁に呼ばれるので、データベースへの問い合わせなどはせずに保持している状態を返すこと
+type Check func() CheckResult
+
+// checks /readyzで確認する項目
+var checks = map[string]Check{}
+
+// Register /readyzで確認する項目を追加する。同じ名前の項目は置き換える
+func Register(name string, check Check) {
+	checks[name] = check
+}
+
+// Result nameの項目を確認した結果を返す。登録されていなければfalse
+func Result(name string) (CheckResult, bool) {
+	check, ok := checks[name]
+	if !ok {
+		return CheckResult{}, false
+	}
+	return check(), true
+}
+
+type livenessResponse struct {
+	Status        string    `json:"status"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// LivenessHandler プロセスが動いていれば常に200を返すハンドラー(/healthz)
+// データベースの障害などでは失敗させない。失敗するとオーケストレーターがプロセスを再起動してしまうため
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, livenessResponse{
+			Status:        StatusOK,
+			StartedAt:     startedAt,
+			UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		})
+	}
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// ReadinessHandler 登録した項目が全て準備できていれば200、1つでもできていなければ503を返すハンドラー(/readyz)
+// 503の間はロードバランサーが新しい接続を振り分けないようにする
+func ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := readinessResponse{Status: StatusReady, Checks: make(map[string]CheckResult, len(checks))}
+		for name, check := range checks {
+			result := check()
+			if !result.Healthy {
+				res.Status = StatusUnavailable
+			}
+			res.Checks[name] = result
+		}
+
+		code := http.StatusOK
+		if res.Status != StatusReady {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, res)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	// プローブの結果が途中のプロキシにキャッシュされないようにする
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// 警告とエラーの件数を数える期間。1分ごとに区切って1時間分を保持する
+const (
+	countBucket  = time.Minute
+	countBuckets = 60
+)
+
+// RecentCounts 直近の期間に出力された警告とエラーの件数
+type RecentCounts struct {
+	Warn  int `json:"warn"`
+	Error int `json:"error"`
+}
+
+// levelCounter 警告とエラーの件数を1分ごとに数える
+type levelCounter struct {
+	mu      sync.Mutex
+	minutes [countBuckets]int64 // 各区切りが何分目(Unix時刻/60)のものか
+	warn    [countBuckets]int
+	errors  [countBuckets]int
+}
+
+var counter levelCounter
+
+func (c *levelCounter) add(t time.Time, lvl slog.Level) {
+	minute := t.Unix() / int64(countBucket.Seconds())
+	i := minute % countBuckets
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.minutes[i] != minute {
+		// 1時間前の区切りを使い回す
+		c.minutes[i], c.warn[i], c.errors[i] = minute, 0, 0
+	}
+	if lvl >= slog.LevelError {
+		c.errors[i]++
+	} else {
+		c.warn[i]++
+	}
+}
+
+// Recent 直近のwithin(最長1時間)に出力された警告とエラーの件数を返す
+// 分の区切りで数えるので、今の分は途中までの件数になる
+func Recent(within time.Duration) RecentCounts {
+	now := time.Now().Unix() / int64(countBucket.Seconds())
+	oldest := now - int64(min(max(within, countBucket), countBuckets*countBucket)/countBucket) + 1
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	var counts RecentCounts
+	for i := range counter.minutes {
+		if m := counter.minutes[i]; m >= oldest && m <= now {
+			counts.Warn += counter.warn[i]
+			counts.Error += counter.errors[i]
+		}
+	}
+	return counts
+}
+
+// countingHandler 警告以上のログを数えてから、次のハンドラーに渡す
+// 出力するレベルをerrorにしている間も警告を数えられるように、警告以上は常に受け取る
+type countingHandler struct {
+	next slog.Handler
+}
+
+func (h countingHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return lvl >= slog.LevelWarn || h.next.Enabled(ctx, lvl)
+}
+
+func (h countingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		counter.add(r.Time, r.Level)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h countingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return countingHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h countingHandler) WithGroup(name string) slog.Handler {
+	return countingHandler{next: h.next.WithGroup(name)}
+}
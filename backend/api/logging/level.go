@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 一時的に変えたレベルを元に戻すまでの時間
+const (
+	defaultLevelDuration = 15 * time.Minute
+	maxLevelDuration     = 24 * time.Hour
+)
+
+var (
+	levelMu sync.Mutex
+	// baseLevel Setupで設定したレベル。一時的に変えたレベルは期限が来るとこれに戻る
+	baseLevel   slog.Level
+	levelUntil  time.Time
+	revertTimer *time.Timer
+)
+
+// SetLevel 出力するログのレベルをdの間だけlvlに変え、期限を返す
+// 障害の調査中にメッセージごとのデバッグログを一時的に出すため。dが過ぎるとSetupで設定したレベルに戻る
+func SetLevel(lvl slog.Level, d time.Duration) time.Time {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if revertTimer != nil {
+		revertTimer.Stop()
+	}
+	level.Set(lvl)
+	levelUntil = time.Now().Add(d)
+	revertTimer = time.AfterFunc(d, resetLevel)
+	return levelUntil
+}
+
+// resetLevel Setupで設定したレベルに戻す
+func resetLevel() {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if revertTimer != nil {
+		revertTimer.Stop()
+		revertTimer = nil
+	}
+	levelUntil = time.Time{}
+	level.Set(baseLevel)
+	slog.Info("ログのレベルを元に戻しました", "level", levelName(baseLevel))
+}
+
+func levelName(lvl slog.Level) string {
+	return strings.ToLower(lvl.String())
+}
+
+type levelResponse struct {
+	Level   string     `json:"level"`
+	Default string     `json:"default"`         // 元に戻したときのレベル
+	Until   *time.Time `json:"until,omitempty"` // 一時的に変えている場合の期限
+}
+
+type levelRequest struct {
+	Level    string `json:"level"`    // debug, info, warn, error。空なら元のレベルに戻す
+	Duration string `json:"duration"` // 変えておく時間(例: "30m")。デフォルトは15分、最長24時間
+}
+
+func currentLevel() levelResponse {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	res := levelResponse{Level: levelName(level.Level()), Default: levelName(baseLevel)}
+	if !levelUntil.IsZero() {
+		until := levelUntil
+		res.Until = &until
+	}
+	return res
+}
+
+// LevelHandler 出力するログのレベルを確認・変更する管理者用ハンドラー
+// GETで今のレベルを返し、PUTで{"level":"debug","duration":"30m"}のように一時的に変える
+func LevelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var req levelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "リクエストの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			if req.Level == "" {
+				resetLevel()
+			} else {
+				lvl, err := ParseLevel(req.Level)
+				if err != nil {
+					http.Error(w, "levelには debug, info, warn, error のいずれかを指定してください", http.StatusBadRequest)
+					return
+				}
+				d := defaultLevelDuration
+				if req.Duration != "" {
+					if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 || d > maxLevelDuration {
+						http.Error(w, "durationには24時間以内の時間を \"30m\" のように指定してください", http.StatusBadRequest)
+						return
+					}
+				}
+				until := SetLevel(lvl, d)
+				slog.Warn("ログのレベルを一時的に変更しました", "level", levelName(lvl), "until", until)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(currentLevel())
+	}
+}
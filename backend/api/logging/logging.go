@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// 対戦のセッションのログに付ける属性のキー
+// 部屋やユーザーごとにログを絞り込めるように、どのパッケージでも同じキーを使う
+const (
+	KeyUserID        = "user_id"
+	KeyRoomID        = "room_id"
+	KeyQuestionIndex = "question_index" // 対戦の何問目か(0から数える)
+	KeyMessageType   = "message_type"   // クライアントから受信したメッセージのtype
+	KeyTraceID       = "trace_id"       // 対戦ごとのトレースID。トレースの送信先でスパンを探すときに使う
+	KeyConnID        = "conn_id"        // WebSocket接続ごとのID。クライアントに送るエラーにも含める
+)
+
+// 出力の形式
+const (
+	FormatText = "text" // 開発用。人が読みやすい key=value の形式
+	FormatJSON = "json" // 本番用。1行に1つのJSONで、ログの収集基盤で検索できる
+)
+
+// level 出力するログの最低レベル
+var level = new(slog.LevelVar)
+
+// Setup 標準のロガーをformatの形式でwに出力するように設定する
+// log パッケージの出力もこのロガーを通してInfoレベルで出力される
+// 警告とエラーの件数はRecentで取得できるように数えておく
+// Cookieの値・トークン・メールアドレスは、DisableRedactionを呼ばない限り伏せて出力する
+func Setup(w io.Writer, format string, lvl slog.Level) {
+	levelMu.Lock()
+	baseLevel = lvl
+	levelMu.Unlock()
+	level.Set(lvl)
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if strings.EqualFold(format, FormatJSON) {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(countingHandler{next: handler}))
+}
+
+// ParseLevel "debug"・"info"・"warn"・"error"をログのレベルに変換する。空ならInfo
+func ParseLevel(s string) (slog.Level, error) {
+	var lvl slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := lvl.UnmarshalText([]byte(s))
+	return lvl, err
+}
+
+// Err エラーを"error"属性としてログに付ける
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
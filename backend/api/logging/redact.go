@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// redacted 伏せた値の代わりに出力する文字列
+const redacted = "[REDACTED]"
+
+// sensitiveKeys キーにこれらを含む属性やヘッダー、メッセージのフィールドは値を伏せる(小文字で比較する)
+var sensitiveKeys = []string{"cookie", "authorization", "token", "password", "secret", "api_key", "apikey", "api-key"}
+
+var (
+	// メールアドレスはドメインだけ残す
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	// メール本文のリンクなどに含まれるトークン
+	tokenParamPattern = regexp.MustCompile(`(?i)\b(token|code|key)=[^&\s"']+`)
+	bearerPattern     = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/\-]+=*`)
+	jwtPattern        = regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`)
+)
+
+// unredacted trueの間は伏せずにそのまま出力する
+var unredacted atomic.Bool
+
+// DisableRedaction Cookie・トークン・メールアドレスを伏せずにログに出力する
+// ローカルでの開発専用。本番で呼び出さないこと
+func DisableRedaction() {
+	unredacted.Store(true)
+}
+
+// redactAttr ログの属性からCookieの値・トークン・メールアドレスを伏せる
+// slog.HandlerOptions.ReplaceAttr に渡すので、WithやWithGroupで付けた属性も対象になる
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if unredacted.Load() {
+		return a
+	}
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		return slog.Any(a.Key, redactValue(a.Value.Any()))
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString 文字列に含まれるメールアドレスとトークンを伏せる
+func redactString(s string) string {
+	s = emailPattern.ReplaceAllString(s, "***@$1")
+	s = tokenParamPattern.ReplaceAllString(s, "$1="+redacted)
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	return jwtPattern.ReplaceAllString(s, redacted)
+}
+
+// redactValue リクエストのヘッダーや受信したメッセージなど、値の中身まで伏せる
+// 元の値は呼び出し元で使い続けるので、書き換えずにコピーを返す
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case http.Header:
+		out := make(http.Header, len(v))
+		for k, values := range v {
+			if isSensitiveKey(k) {
+				out[k] = []string{redacted}
+				continue
+			}
+			out[k] = make([]string, len(values))
+			for i, s := range values {
+				out[k][i] = redactString(s)
+			}
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if isSensitiveKey(k) {
+				out[k] = redacted
+			} else {
+				out[k] = redactValue(val)
+			}
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, val := range v {
+			if isSensitiveKey(k) {
+				out[k] = redacted
+			} else {
+				out[k] = redactString(val)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = redactValue(val)
+		}
+		return out
+	case string:
+		return redactString(v)
+	case error:
+		// データベースのエラーなどに入力値が含まれることがある
+		return redactString(v.Error())
+	}
+	return v
+}
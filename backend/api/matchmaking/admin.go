@@ -0,0 +1,157 @@
+package matchmaking
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sys3/api/audit"
+	"sys3/api/health"
+	"sys3/api/logging"
+	"sys3/api/metrics"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CloseRoom 部屋を強制的に終了し、参加しているプレイヤーを切断する
+// 対戦中の場合は結果を記録せずに終了する。部屋がなければErrRoomNotFound
+func CloseRoom(roomID string) error {
+	roomsMutex.Lock()
+	room, ok := rooms[roomID]
+	if ok {
+		delete(rooms, roomID)
+		room.closed.Store(true)
+		room.cancel()
+	}
+	roomsMutex.Unlock()
+	if !ok {
+		return ErrRoomNotFound
+	}
+	cluster.remove(room)
+
+	for _, c := range []*Client{room.Player1Conn, room.Player2Conn} {
+		if c != nil {
+			c.CloseWithError(CloseKicked, "管理者により部屋が閉じられました")
+		}
+	}
+	slog.Info("部屋を強制終了しました", logging.KeyRoomID, roomID)
+	return nil
+}
+
+// CloseRoomHandler 部屋を強制終了するモデレーター用ハンドラー
+func CloseRoomHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := mux.Vars(r)["id"]
+		roomsMutex.Lock()
+		var players []string
+		if room, ok := rooms[roomID]; ok {
+			players = []string{room.PlayerID, room.Player2ID}
+		}
+		roomsMutex.Unlock()
+
+		if err := CloseRoom(roomID); errors.Is(err, ErrRoomNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		audit.Annotate(r, map[string]interface{}{"players": players, "closed": false}, map[string]interface{}{"closed": true})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GameSummary 対戦中の部屋の概要
+type GameSummary struct {
+	RoomID    string    `json:"room_id"`
+	GameType  string    `json:"game_type"`
+	Mode      string    `json:"mode"`
+	PoolID    int       `json:"pool_id,omitempty"`
+	Players   []string  `json:"players"`
+	CreatedAt time.Time `json:"created_at"` // 部屋が作られた日時
+}
+
+// QueueDepth マッチングの待ち行列ごとの、対戦相手を待っている部屋の数
+// ゲームの種類・対戦の種類・問題のプールが同じ部屋どうしでマッチングする
+type QueueDepth struct {
+	GameType          string `json:"game_type"`
+	Mode              string `json:"mode"`
+	PoolID            int    `json:"pool_id,omitempty"`
+	Waiting           int    `json:"waiting"`
+	OldestWaitSeconds int    `json:"oldest_wait_seconds"`
+}
+
+// Overview 運用のダッシュボードに表示する対戦の状況
+type Overview struct {
+	Connections int            `json:"connections"`
+	Rooms       map[string]int `json:"rooms"` // 状態ごとの部屋の数
+	Games       []GameSummary  `json:"games"` // 対戦中の部屋。部屋が作られた順
+	Queue       []QueueDepth   `json:"queue"`
+	QueueDepth  int            `json:"queue_depth"` // 対戦相手を待っている部屋の合計
+	// 直近に出力された警告とエラーの件数
+	RecentErrors map[string]logging.RecentCounts `json:"recent_errors"`
+	Database     *health.CheckResult             `json:"database,omitempty"`
+	GeneratedAt  time.Time                       `json:"generated_at"`
+}
+
+// overview 部屋の一覧から対戦の状況を集計する
+func overview(now time.Time) Overview {
+	o := Overview{
+		Rooms: map[string]int{metrics.RoomWaiting: 0, metrics.RoomPlaying: 0},
+		Games: []GameSummary{},
+		Queue: []QueueDepth{},
+	}
+	queues := map[QueueDepth]*QueueDepth{}
+
+	roomsMutex.Lock()
+	for _, room := range rooms {
+		switch {
+		case !room.IsMatched:
+			o.Rooms[metrics.RoomWaiting]++
+			key := QueueDepth{GameType: room.GameType, Mode: room.Mode(), PoolID: room.PoolID}
+			q, ok := queues[key]
+			if !ok {
+				q = &key
+				queues[key] = q
+			}
+			q.Waiting++
+			q.OldestWaitSeconds = max(q.OldestWaitSeconds, int(now.Sub(room.CreatedAt).Seconds()))
+		case room.ctx.Err() == nil:
+			o.Rooms[metrics.RoomPlaying]++
+			o.Games = append(o.Games, GameSummary{
+				RoomID:    room.ID,
+				GameType:  room.GameType,
+				Mode:      room.Mode(),
+				PoolID:    room.PoolID,
+				Players:   []string{room.PlayerID, room.Player2ID},
+				CreatedAt: room.CreatedAt,
+			})
+		}
+	}
+	roomsMutex.Unlock()
+
+	for _, q := range queues {
+		o.Queue = append(o.Queue, *q)
+		o.QueueDepth += q.Waiting
+	}
+	sort.Slice(o.Games, func(i, j int) bool { return o.Games[i].CreatedAt.Before(o.Games[j].CreatedAt) })
+	sort.Slice(o.Queue, func(i, j int) bool { return o.Queue[i].Waiting > o.Queue[j].Waiting })
+
+	o.Connections = hub.Count()
+	o.RecentErrors = map[string]logging.RecentCounts{
+		"5m": logging.Recent(5 * time.Minute),
+		"1h": logging.Recent(time.Hour),
+	}
+	if db, ok := health.Result("database"); ok {
+		o.Database = &db
+	}
+	o.GeneratedAt = now
+	return o
+}
+
+// OverviewHandler 接続数・部屋と対戦の状況・待ち行列・直近のエラー件数・データベースの状態をまとめて返す管理者用ハンドラー
+func OverviewHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(overview(time.Now()))
+	}
+}
@@ -0,0 +1,52 @@
+package matchmaking
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Announcement 全クライアントに配信するお知らせ
+type Announcement struct {
+	Status  string    `json:"status"` // 常に"announcement"
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Announce 接続中の全クライアントにお知らせを配信し、配信できた件数を返す
+func Announce(message string) int {
+	announcement := Announcement{
+		Status:  "announcement",
+		Message: message,
+		SentAt:  time.Now(),
+	}
+	delivered := hub.Broadcast(announcement)
+	slog.Info("お知らせを配信しました", "message", message, "delivered", delivered)
+	return delivered
+}
+
+// BroadcastHandler 管理者がお知らせを配信するハンドラー
+func BroadcastHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		if request.Message == "" {
+			http.Error(w, "メッセージを入力してください", http.StatusBadRequest)
+			return
+		}
+
+		delivered := Announce(request.Message)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "お知らせを配信しました",
+			"delivered": delivered,
+		})
+	}
+}
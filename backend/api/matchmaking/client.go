@@ -0,0 +1,394 @@
+package matchmaking
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"sys3/api/alert"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/metrics"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ConnectionConfig 接続ごとの読み書きの制限を管理する構造体
+type ConnectionConfig struct {
+	MaxMessageSize    int64         // 受信できる1メッセージの最大バイト数
+	PongWait          time.Duration // この時間内に何も受信しなければ切断する
+	PingPeriod        time.Duration // Pingの送信間隔(PongWaitより短くすること)
+	WriteWait         time.Duration // 1メッセージの書き込みにかけられる最大時間
+	OutboundQueueSize int           // 送信待ちにできるメッセージ数。超えると切断する
+	IncomingQueueSize int           // 受信してまだ処理していないメッセージを溜めておける数
+	ReadBufferSize    int           // WebSocketの読み取りバッファのバイト数
+	WriteBufferSize   int           // WebSocketの書き込みバッファのバイト数
+}
+
+// defaultConnectionConfig 設定しない場合の接続ごとの読み書きの制限
+var defaultConnectionConfig = ConnectionConfig{
+	MaxMessageSize:    4096,
+	PongWait:          60 * time.Second,
+	PingPeriod:        10 * time.Second, // 遅延の測定も兼ねるため短めにする
+	WriteWait:         10 * time.Second,
+	OutboundQueueSize: 64,
+	IncomingQueueSize: 16,
+	ReadBufferSize:    1024,
+	WriteBufferSize:   1024,
+}
+
+var connectionConfig = defaultConnectionConfig
+
+var (
+	errClientClosed = errors.New("接続は既に閉じられています")
+	errTooSlow      = errors.New("送信キューが一杯です")
+)
+
+// DefaultConnectionConfig 設定しない場合に使う接続ごとの読み書きの制限を返す
+func DefaultConnectionConfig() ConnectionConfig {
+	return defaultConnectionConfig
+}
+
+// SetConnectionConfig 接続ごとの読み書きの制限を設定する
+// サーバー起動前に呼び出すこと
+func SetConnectionConfig(config ConnectionConfig) {
+	connectionConfig = config
+	upgrader.ReadBufferSize = config.ReadBufferSize
+	upgrader.WriteBufferSize = config.WriteBufferSize
+}
+
+// wsConn Clientが読み書きする接続。*websocket.Connか、別のインスタンスのプレイヤーとRedisで中継するremoteConn
+type wsConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// Client WebSocket接続とエンコード方式をまとめた構造体
+// ハンドラーはconn.WriteJSONではなくClient.Writeを使う
+type Client struct {
+	ID     string // 接続ごとのID。ログとクライアントに送るエラーに含める
+	UserID string // Hubに登録されたユーザーID
+	IP     string // プロキシを考慮した接続元のIPアドレス
+	Guest  bool   // ゲストはカジュアル戦のみ遊べる
+
+	// 認証に使ったトークンの中身。token_refreshで更新される
+	claims atomic.Pointer[auth.Claims]
+	conn   wsConn
+	codec  Codec
+
+	// 別のインスタンスの部屋で対戦している間の中継先。設定されている間は受信したメッセージを転送する
+	relay atomic.Pointer[relay]
+
+	// 送信するメッセージは一旦キューに入れ、writePumpだけが接続に書き込む
+	// 読み取りの遅いクライアントがセッション全体を止めないようにするため
+	outbound   chan outboundFrame
+	writerDone chan struct{} // writePumpの終了時にクローズされる
+	closeOnce  sync.Once
+
+	// 受信したメッセージはreadPumpからこのチャネルに流れる
+	// 接続が切れるとクローズされる
+	incoming chan map[string]interface{}
+	limiter  *tokenBucket
+	done     chan struct{} // readPumpの終了時にクローズされる
+	latency  latencyTracker
+
+	connectedAt time.Time
+
+	// アイドル判定用。lastActivityはUnixNano
+	lastActivity atomic.Int64
+	busy         atomic.Bool
+
+	roomID atomic.Value // 参加中の部屋ID(string)
+	shown  shownQuestions
+
+	// 接続から部屋に入るまでのスパン。対戦のスパンからリンクする
+	handshake trace.SpanContext
+}
+
+func newClient(conn wsConn, codec Codec) *Client {
+	c := &Client{
+		conn:        conn,
+		codec:       codec,
+		outbound:    make(chan outboundFrame, connectionConfig.OutboundQueueSize),
+		incoming:    make(chan map[string]interface{}, connectionConfig.IncomingQueueSize),
+		limiter:     newTokenBucket(rateLimitConfig.Rate, rateLimitConfig.Burst),
+		done:        make(chan struct{}),
+		writerDone:  make(chan struct{}),
+		connectedAt: time.Now(),
+	}
+	c.touch()
+	return c
+}
+
+// Write メッセージをエンコードして送信する
+// 全てのメッセージにサーバー側で生成したevent_idを付与する
+func (c *Client) Write(msg interface{}) error {
+	return c.send(msg, "")
+}
+
+// Reply クライアントからのメッセージへの応答を送信する
+// 受信したメッセージのrequest_idをそのまま返すので、クライアント側で対応付けられる
+func (c *Client) Reply(requestID string, msg interface{}) error {
+	return c.send(msg, requestID)
+}
+
+func (c *Client) send(msg interface{}, requestID string) error {
+	if e, ok := msg.(ErrorMessage); ok {
+		e.ConnID = c.ID
+		msg = e
+	}
+	data, err := c.codec.Marshal(withFields(msg, map[string]string{
+		"event_id":   newEventID(),
+		"request_id": requestID,
+	}))
+	if err != nil {
+		return err
+	}
+	return c.enqueue(outboundFrame{data: data})
+}
+
+// outboundFrame 送信キューに入れるフレーム
+// closeCodeが0でなければ、それまでのメッセージを送信した後にクローズする
+type outboundFrame struct {
+	data      []byte
+	closeCode int
+}
+
+// enqueue 送信キューにフレームを追加する
+// キューが一杯の場合は読み取りが遅すぎるとみなして切断する
+func (c *Client) enqueue(frame outboundFrame) error {
+	select {
+	case <-c.done:
+		return errClientClosed
+	default:
+	}
+
+	select {
+	case c.outbound <- frame:
+		return nil
+	default:
+		c.logger().Warn("送信キューが一杯のため切断します")
+		c.CloseWithCode(CloseTooSlow)
+		return errTooSlow
+	}
+}
+
+// start 読み取りと書き込みのゴルーチンを起動する
+// 接続中のクライアントの数は、読み取りのゴルーチンが終わる(接続が切れる)まで数える
+func (c *Client) start() {
+	metrics.ActiveConnections.Inc()
+	go c.readPump()
+	go c.writePump()
+	go c.idleLoop()
+	go c.tokenLoop()
+}
+
+// writePump 送信キューのメッセージを順番に書き込む
+func (c *Client) writePump() {
+	defer close(c.writerDone)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case frame := <-c.outbound:
+			if frame.closeCode != 0 {
+				c.CloseWithCode(frame.closeCode)
+				return
+			}
+			start := time.Now()
+			c.conn.SetWriteDeadline(start.Add(connectionConfig.WriteWait))
+			if err := c.conn.WriteMessage(c.codec.FrameType(), frame.data); err != nil {
+				c.logger().Warn("メッセージ送信エラー", logging.Err(err))
+				c.Close()
+				return
+			}
+			// 書き込みのたびにロガーを作らないように、遅かった場合だけ記録する
+			if threshold := slowLogConfig.Write; threshold > 0 && time.Since(start) >= threshold {
+				logIfSlow(c.logger(), "write", start, threshold, "bytes", len(frame.data), "queued", len(c.outbound))
+			}
+		}
+	}
+}
+
+// Incoming 受信メッセージのチャネルを返す
+func (c *Client) Incoming() <-chan map[string]interface{} {
+	return c.incoming
+}
+
+// readPump 接続からの読み取りを1つのゴルーチンに集約する
+// レート制限を超えたメッセージは破棄して警告し、繰り返す場合は切断する
+// 最大サイズを超えるメッセージや、PongWait以内に何も受信できない場合も切断する
+func (c *Client) readPump() {
+	defer metrics.ActiveConnections.Dec()
+	defer close(c.incoming)
+	defer close(c.done)
+
+	// サイズ超過時はgorilla/websocketがCloseMessageTooBig(1009)を送信して読み取りを終了する
+	c.conn.SetReadLimit(connectionConfig.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(connectionConfig.PongWait))
+	c.conn.SetPongHandler(func(payload string) error {
+		c.recordPong(payload)
+		return c.conn.SetReadDeadline(time.Now().Add(connectionConfig.PongWait))
+	})
+	go c.pingLoop()
+
+	warnings := 0
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.logger().Warn("最大メッセージサイズ超過のため切断します")
+			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				c.logger().Info("読み取りタイムアウトのため切断します")
+				c.CloseWithCode(CloseReadTimeout)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				c.logger().Warn("予期せぬ接続切断", logging.Err(err))
+				alert.Record(alert.AbnormalClose)
+			} else {
+				// クローズフレームなしに切れた接続は、急増したらネットワークやプロキシの障害を疑う
+				if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
+					alert.Record(alert.AbnormalClose)
+				}
+				c.logger().Info("メッセージ読み取りエラー", logging.Err(err))
+			}
+			c.Close()
+			return
+		}
+		// メッセージを受信できたので読み取り期限を延長
+		c.conn.SetReadDeadline(time.Now().Add(connectionConfig.PongWait))
+
+		if !c.limiter.Allow() {
+			warnings++
+			if warnings > rateLimitConfig.MaxWarnings {
+				c.logger().Warn("レート制限超過のため切断します")
+				c.CloseWithError(CloseRateLimited, "メッセージの送信が多すぎるため切断しました")
+				return
+			}
+			c.SendError(ErrCodeRateLimited, "メッセージの送信が多すぎます")
+			continue
+		}
+
+		var message map[string]interface{}
+		if err := c.codec.Unmarshal(data, &message); err != nil {
+			c.logger().Warn("メッセージのデコードエラー", logging.Err(err))
+			c.SendError(ErrCodeProtocolError, "メッセージの形式が正しくありません")
+			continue
+		}
+
+		c.touch()
+		c.logger().Debug("メッセージを受信", logging.KeyMessageType, message["type"])
+
+		// エラー報告・トークンの更新・問題の報告はセッションに渡さずにここで処理する
+		switch message["type"] {
+		case "client_error":
+			c.handleClientError(message)
+			continue
+		case "token_refresh":
+			c.handleTokenRefresh(message)
+			continue
+		}
+
+		// 別のインスタンスで対戦している場合は、問題の報告も含めて部屋のあるインスタンスに転送する
+		if r := c.relay.Load(); r != nil {
+			r.forward(c.codec.FrameType(), data)
+			continue
+		}
+
+		if message["type"] == "report_question" {
+			// データベースへの書き込みで読み取りを止めないよう別のゴルーチンで処理する
+			go c.handleReportQuestion(message)
+			continue
+		}
+
+		// 受信側が追いつかない場合はメッセージを破棄して読み取りを続ける
+		select {
+		case c.incoming <- message:
+		default:
+			c.logger().Warn("受信バッファが一杯のためメッセージを破棄", logging.KeyMessageType, message["type"])
+		}
+	}
+}
+
+// pingLoop 定期的にPingを送信し、PongでreadPumpの読み取り期限を延長させる
+// Pongが返るまでの時間から接続の遅延も測定する
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(connectionConfig.PingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			// WriteControlは他の書き込みと並行して呼び出せる
+			// 送信時刻を埋め込み、Pongで往復遅延を測定する
+			now := time.Now()
+			if err := c.conn.WriteControl(websocket.PingMessage, pingPayload(now), now.Add(10*time.Second)); err != nil {
+				c.logger().Info("Ping送信エラー", logging.Err(err))
+				return
+			}
+		}
+	}
+}
+
+// SendError 共通形式のエラーメッセージを送信する
+func (c *Client) SendError(code, message string) error {
+	return c.Write(newErrorMessage(code, message))
+}
+
+// CloseWithError エラーメッセージを送信してからクローズコード付きで接続を閉じる
+// 送信キューに残っているメッセージを書き込んでからクローズする
+func (c *Client) CloseWithError(closeCode int, message string) error {
+	if err := c.SendError(closeReasons[closeCode], message); err != nil {
+		return c.CloseWithCode(closeCode)
+	}
+	if err := c.enqueue(outboundFrame{closeCode: closeCode}); err != nil {
+		return c.CloseWithCode(closeCode)
+	}
+	return nil
+}
+
+// CloseWithCode クローズフレームを送信してから接続を閉じる
+// クローズ理由にはクローズコードに対応するエラーコードを使う
+func (c *Client) CloseWithCode(code int) error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, closeReasons[code]),
+			time.Now().Add(time.Second),
+		)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// Shutdown 送信キューに残っているメッセージを書き込んでから正常終了のクローズをする
+// WriteWaitを過ぎても書き込みが終わらない場合はそのまま接続を閉じる
+func (c *Client) Shutdown() {
+	if err := c.enqueue(outboundFrame{closeCode: websocket.CloseNormalClosure}); err == nil {
+		select {
+		case <-c.writerDone:
+		case <-time.After(connectionConfig.WriteWait):
+		}
+	}
+	c.Close()
+}
+
+// Close 接続を閉じる
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+	})
+	return err
+}
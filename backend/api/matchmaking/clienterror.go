@@ -0,0 +1,46 @@
+package matchmaking
+
+import (
+	"log/slog"
+	"sys3/api/logging"
+)
+
+// ClientErrorReport クライアントから報告されたエラーの内容
+type ClientErrorReport struct {
+	LastMessageType string `json:"last_message_type"` // 最後に受信したメッセージのstatus
+	State           string `json:"state"`             // クライアント側の画面や状態
+	Error           string `json:"error"`             // エラーの内容
+}
+
+// setRoom クライアントが参加している部屋のIDを記録する
+func (c *Client) setRoom(roomID string) {
+	c.roomID.Store(roomID)
+}
+
+// RoomID クライアントが参加している部屋のIDを返す
+func (c *Client) RoomID() string {
+	id, _ := c.roomID.Load().(string)
+	return id
+}
+
+// logger 接続のID、ユーザーIDと参加中の部屋IDを付けたロガーを返す
+func (c *Client) logger() *slog.Logger {
+	return slog.With(logging.KeyConnID, c.ID, logging.KeyUserID, c.UserID, logging.KeyRoomID, c.RoomID())
+}
+
+// handleClientError "client_error"メッセージを部屋IDと合わせてログに記録する
+// ゲームの進行とは関係ないので、readPumpの中で処理してセッションには渡さない
+func (c *Client) handleClientError(message map[string]interface{}) {
+	report := ClientErrorReport{}
+	report.LastMessageType, _ = message["last_message_type"].(string)
+	report.State, _ = message["state"].(string)
+	report.Error, _ = message["error"].(string)
+
+	c.logger().Warn("クライアントエラー報告",
+		logging.KeyMessageType, "client_error",
+		"last_message_type", report.LastMessageType, "state", report.State, "client_error", report.Error)
+
+	c.Reply(requestIDOf(message), map[string]string{
+		"status": "client_error_received",
+	})
+}
@@ -0,0 +1,404 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sys3/api/logging"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// 複数のインスタンスでのマッチング
+//
+// 対戦相手を待っている部屋はRedisの共有の待ち行列(ソート済みセット)にも登録し、どのインスタンスからでも取り出せるようにする
+// 別のインスタンスの部屋を取り出したインスタンスは、部屋のあるインスタンスに参加を依頼する
+// 部屋のあるインスタンスは、参加したプレイヤーの接続をremoteConnで表したClientを作り、
+// 同じインスタンスのプレイヤーと同じように対戦を進める。フレームはRedisのPub/Subで中継する
+
+// Cluster Redisを使って複数のインスタンスでマッチングする
+// SetClusterで設定しない場合(nil)は、1つのプロセスの中だけでマッチングする
+type Cluster struct {
+	client      *redis.Client
+	instanceID  string
+	joinTimeout time.Duration
+	joins       *redis.PubSub
+}
+
+var cluster *Cluster
+
+// NewCluster redis://形式のURLのRedisで待ち行列を共有するClusterを作成する
+// instanceIDはインスタンスごとに異なる値にすること。joinTimeoutは別のインスタンスの部屋への参加の応答を待つ時間
+func NewCluster(url, instanceID string, joinTimeout time.Duration) (*Cluster, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{client: redis.NewClient(opts), instanceID: instanceID, joinTimeout: joinTimeout}
+	ctx, cancel := c.timeout()
+	defer cancel()
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetCluster 複数のインスタンスでのマッチングを設定し、他のインスタンスからの参加の受付を始める
+// サーバー起動前に呼び出すこと
+func SetCluster(c *Cluster) {
+	cluster = c
+	c.joins = c.client.Subscribe(context.Background(), joinChannel(c.instanceID))
+	go func() {
+		for msg := range c.joins.Channel() {
+			var req joinRequest
+			if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+				slog.Warn("他のインスタンスからの参加の依頼を読み取れません", logging.Err(err))
+				continue
+			}
+			go c.acceptJoin(req)
+		}
+	}()
+}
+
+// Close 参加の受付を止めてRedisへの接続を閉じる。サーバーの停止時に、全ての接続を閉じてから呼ぶ
+func (c *Cluster) Close() error {
+	if c == nil {
+		return nil
+	}
+	if c.joins != nil {
+		c.joins.Close()
+	}
+	return c.client.Close()
+}
+
+// clusterOpTimeout Redisの1回の操作にかけられる時間
+// Redisに接続できない間もマッチングが長く止まらないように短くする
+const clusterOpTimeout = time.Second
+
+func (c *Cluster) timeout() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), clusterOpTimeout)
+}
+
+func queueKey(gameType, mode string, poolID int) string {
+	return fmt.Sprintf("quiz:cluster:queue:%s:%s:%d", gameType, mode, poolID)
+}
+
+func roomKey(roomID string) string {
+	return "quiz:cluster:room:" + roomID
+}
+
+func joinChannel(instanceID string) string {
+	return "quiz:cluster:join:" + instanceID
+}
+
+// upChannel プレイヤーが接続しているインスタンスから部屋のあるインスタンスへのチャネル
+func upChannel(roomID string) string {
+	return "quiz:cluster:room:" + roomID + ":up"
+}
+
+// downChannel 部屋のあるインスタンスからプレイヤーが接続しているインスタンスへのチャネル
+func downChannel(roomID string) string {
+	return "quiz:cluster:room:" + roomID + ":down"
+}
+
+// enqueue 対戦相手を待っている部屋を共有の待ち行列に登録する
+// 登録できなかった部屋は、このインスタンスの中だけでマッチングする
+func (c *Cluster) enqueue(room *Room) {
+	if c == nil {
+		return
+	}
+	ctx, cancel := c.timeout()
+	defer cancel()
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, roomKey(room.ID), "instance", c.instanceID, "player_id", room.PlayerID)
+	// インスタンスが止まって取り除かれなかった部屋は、参加を依頼する前に期限切れで分かる
+	pipe.Expire(ctx, roomKey(room.ID), 2*gameConfig.MatchTimeout)
+	pipe.ZAdd(ctx, queueKey(room.GameType, room.Mode(), room.PoolID), redis.Z{Score: float64(room.CreatedAt.UnixMilli()), Member: room.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		room.logger().Warn("共有の待ち行列への登録エラー。このインスタンスの中だけでマッチングします", logging.Err(err))
+		return
+	}
+	room.shared.Store(true)
+}
+
+// shares 部屋が共有の待ち行列に登録されているか
+func (c *Cluster) shares(room *Room) bool {
+	return c != nil && room.shared.Load()
+}
+
+// claim 同じインスタンスのプレイヤーとマッチングするために、部屋を共有の待ち行列から取り出す
+// 他のインスタンスが先に取り出していればfalse。Redisに接続できない間はマッチングを止めないようにtrueを返す
+func (c *Cluster) claim(room *Room) bool {
+	if !c.shares(room) {
+		return true
+	}
+	ctx, cancel := c.timeout()
+	defer cancel()
+	n, err := c.client.ZRem(ctx, queueKey(room.GameType, room.Mode(), room.PoolID), room.ID).Result()
+	if err != nil {
+		room.logger().Warn("共有の待ち行列からの取り出しエラー", logging.Err(err))
+		return true
+	}
+	return n == 1
+}
+
+// remove タイムアウトや強制終了で閉じた部屋を共有の待ち行列から取り除く
+func (c *Cluster) remove(room *Room) {
+	if c == nil || !room.shared.Load() {
+		return
+	}
+	ctx, cancel := c.timeout()
+	defer cancel()
+	pipe := c.client.TxPipeline()
+	pipe.ZRem(ctx, queueKey(room.GameType, room.Mode(), room.PoolID), room.ID)
+	pipe.Del(ctx, roomKey(room.ID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		room.logger().Warn("共有の待ち行列からの削除エラー", logging.Err(err))
+	}
+}
+
+// remoteRoom 共有の待ち行列から取り出した、別のインスタンスの部屋
+type remoteRoom struct {
+	ID       string
+	Instance string
+}
+
+// remoteCandidates 1回の接続で共有の待ち行列から調べる部屋の数
+const remoteCandidates = 20
+
+// findRemote 別のインスタンスで対戦相手を待っている部屋を古い順に探し、取り出せた部屋を返す
+func (c *Cluster) findRemote(gameType, mode string, poolID int, userID string) (remoteRoom, bool) {
+	if c == nil {
+		return remoteRoom{}, false
+	}
+	ctx, cancel := c.timeout()
+	defer cancel()
+	key := queueKey(gameType, mode, poolID)
+	ids, err := c.client.ZRange(ctx, key, 0, remoteCandidates-1).Result()
+	if err != nil {
+		slog.Warn("共有の待ち行列の取得エラー", logging.Err(err))
+		return remoteRoom{}, false
+	}
+	for _, id := range ids {
+		meta, err := c.client.HGetAll(ctx, roomKey(id)).Result()
+		if err != nil {
+			slog.Warn("共有の待ち行列の部屋の取得エラー", logging.KeyRoomID, id, logging.Err(err))
+			return remoteRoom{}, false
+		}
+		if len(meta) == 0 {
+			// 部屋のあるインスタンスが取り除かないまま止まった
+			c.client.ZRem(ctx, key, id)
+			continue
+		}
+		// 同じインスタンスの部屋は、このインスタンスの中でマッチングする
+		if meta["instance"] == c.instanceID || meta["player_id"] == userID {
+			continue
+		}
+		if n, err := c.client.ZRem(ctx, key, id).Result(); err == nil && n == 1 {
+			return remoteRoom{ID: id, Instance: meta["instance"]}, true
+		}
+	}
+	return remoteRoom{}, false
+}
+
+// joinRequest 別のインスタンスの部屋への参加の依頼
+type joinRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"`
+	ConnID string `json:"conn_id"`
+	IP     string `json:"ip"`
+	Guest  bool   `json:"guest"`
+	Codec  string `json:"codec"`
+}
+
+// インスタンスの間で中継するフレームの種類
+const (
+	frameMessage   = "message"   // WebSocketのメッセージ
+	frameClose     = "close"     // 接続を閉じる。Codeはクローズコード
+	frameHeartbeat = "heartbeat" // 相手のインスタンスが動いていることを知らせる
+	frameAccept    = "accept"    // 参加の依頼を受け付けた
+	frameReject    = "reject"    // 部屋が既になくなっていたため参加できない
+)
+
+// relayFrame インスタンスの間で中継するフレーム
+type relayFrame struct {
+	Kind string `json:"kind"`
+	Type int    `json:"type,omitempty"` // WebSocketのフレーム種別
+	Data []byte `json:"data,omitempty"`
+	Code int    `json:"code,omitempty"`
+}
+
+func (c *Cluster) publish(channel string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.timeout()
+	defer cancel()
+	return c.client.Publish(ctx, channel, payload).Err()
+}
+
+// subscribe チャネルの購読を始め、購読できたことを確認してから返す
+func (c *Cluster) subscribe(channel string) (*redis.PubSub, error) {
+	ctx, cancel := c.timeout()
+	defer cancel()
+	sub := c.client.Subscribe(ctx, channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+func decodeFrame(msg *redis.Message) (relayFrame, error) {
+	var f relayFrame
+	err := json.Unmarshal([]byte(msg.Payload), &f)
+	return f, err
+}
+
+// joinRemote 別のインスタンスの部屋に参加し、対戦が終わるまでclientとのメッセージを中継する
+// 参加できたらjoinedを呼ぶ。部屋が既になくなっていたか応答がなかった場合はfalseを返すので、このインスタンスで部屋を探し直す
+func (c *Cluster) joinRemote(client *Client, userID string, remote remoteRoom, joined func()) bool {
+	logger := slog.With(logging.KeyConnID, client.ID, logging.KeyUserID, userID, logging.KeyRoomID, remote.ID, "owner_instance", remote.Instance)
+	sub, err := c.subscribe(downChannel(remote.ID))
+	if err != nil {
+		logger.Warn("別のインスタンスの部屋のチャネルを購読できません", logging.Err(err))
+		return false
+	}
+	defer sub.Close()
+	frames := sub.Channel()
+
+	req := joinRequest{RoomID: remote.ID, UserID: userID, ConnID: client.ID, IP: client.IP, Guest: client.Guest, Codec: client.codec.Name()}
+	if err := c.publish(joinChannel(remote.Instance), req); err != nil {
+		logger.Warn("別のインスタンスの部屋への参加の依頼エラー", logging.Err(err))
+		return false
+	}
+	select {
+	case msg := <-frames:
+		if f, err := decodeFrame(msg); err != nil || f.Kind != frameAccept {
+			logger.Info("別のインスタンスの部屋に参加できませんでした")
+			return false
+		}
+	case <-time.After(c.joinTimeout):
+		logger.Warn("別のインスタンスの部屋への参加の応答がありません")
+		return false
+	case <-client.done:
+		return true
+	}
+
+	logger.Info("別のインスタンスの部屋に参加しました")
+	joined()
+	r := &relay{cluster: c, channel: upChannel(remote.ID)}
+	client.relay.Store(r)
+	client.setBusy(true)
+	client.setRoom(remote.ID)
+	defer func() {
+		client.relay.Store(nil)
+		client.setRoom("")
+		client.setBusy(false)
+	}()
+
+	heartbeat := time.NewTicker(connectionConfig.PingPeriod)
+	defer heartbeat.Stop()
+	// 部屋のあるインスタンスからはPingごとにハートビートが届く。途絶えたインスタンスは止まったとみなす
+	ownerDeadline := time.NewTimer(connectionConfig.PongWait)
+	defer ownerDeadline.Stop()
+	for {
+		select {
+		case msg, ok := <-frames:
+			if !ok {
+				return true
+			}
+			f, err := decodeFrame(msg)
+			if err != nil {
+				logger.Warn("中継されたフレームを読み取れません", logging.Err(err))
+				continue
+			}
+			ownerDeadline.Reset(connectionConfig.PongWait)
+			switch f.Kind {
+			case frameMessage:
+				client.enqueue(outboundFrame{data: f.Data})
+			case frameClose:
+				// 送信キューに残っているメッセージを書き込んでから閉じる
+				client.enqueue(outboundFrame{closeCode: f.Code})
+				return true
+			}
+		case <-ownerDeadline.C:
+			logger.Warn("部屋のあるインスタンスからの応答が途絶えたため切断します")
+			client.CloseWithError(CloseServerShutdown, "対戦を進めているサーバーが停止したため対戦を終了しました")
+			return true
+		case <-heartbeat.C:
+			r.send(relayFrame{Kind: frameHeartbeat})
+		case <-client.done:
+			r.send(relayFrame{Kind: frameClose, Code: websocket.CloseGoingAway})
+			return true
+		}
+	}
+}
+
+// relay プレイヤーが接続しているインスタンスから、部屋のあるインスタンスへの中継
+type relay struct {
+	cluster *Cluster
+	channel string
+}
+
+// forward 受信したメッセージを、デコードせずにそのまま部屋のあるインスタンスに送る
+func (r *relay) forward(frameType int, data []byte) {
+	r.send(relayFrame{Kind: frameMessage, Type: frameType, Data: data})
+}
+
+func (r *relay) send(f relayFrame) {
+	if err := r.cluster.publish(r.channel, f); err != nil {
+		slog.Warn("部屋のあるインスタンスへの中継エラー", "channel", r.channel, logging.Err(err))
+	}
+}
+
+// acceptJoin 別のインスタンスに接続しているプレイヤーを、このインスタンスの部屋に参加させる
+func (c *Cluster) acceptJoin(req joinRequest) {
+	logger := slog.With(logging.KeyRoomID, req.RoomID, logging.KeyConnID, req.ConnID, logging.KeyUserID, req.UserID)
+	codec, ok := codecs[req.Codec]
+	if !ok {
+		codec = jsonCodec{}
+	}
+	conn, err := c.newRemoteConn(req.RoomID)
+	if err != nil {
+		logger.Warn("参加したプレイヤーのチャネルを購読できません", logging.Err(err))
+		c.publish(downChannel(req.RoomID), relayFrame{Kind: frameReject})
+		return
+	}
+
+	roomsMutex.Lock()
+	room, ok := rooms[req.RoomID]
+	if !ok || room.IsMatched || draining.Load() {
+		roomsMutex.Unlock()
+		conn.Close()
+		c.publish(downChannel(req.RoomID), relayFrame{Kind: frameReject})
+		logger.Info("部屋が既にないため、別のインスタンスからの参加を断りました")
+		return
+	}
+	if err := c.publish(downChannel(req.RoomID), relayFrame{Kind: frameAccept}); err != nil {
+		roomsMutex.Unlock()
+		conn.Close()
+		logger.Warn("別のインスタンスへの参加の応答エラー", logging.Err(err))
+		return
+	}
+
+	proxy := newClient(conn, codec)
+	proxy.ID = req.ConnID
+	proxy.UserID = req.UserID
+	proxy.IP = req.IP
+	proxy.Guest = req.Guest
+	proxy.start()
+	room.IsMatched = true
+	room.Player2ID = req.UserID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	joinRoom(ctx, room, proxy)
+	// 対戦が終わったら、handleGameSessionが送信しきってから中継を閉じる
+	logger.Info("別のインスタンスに接続しているプレイヤーが部屋に参加しました")
+}
@@ -0,0 +1,111 @@
+package matchmaking
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec WebSocketメッセージのエンコード方式を抽象化するインターフェース
+type Codec interface {
+	// Name クライアントとのネゴシエーションに使う名前
+	Name() string
+	// FrameType 送信時に使うWebSocketのフレーム種別
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// jsonCodec 従来のJSONテキストフレーム
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string   { return "json" }
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec MessagePackのバイナリフレーム
+// 構造体のフィールド名はJSONと揃えるためjsonタグを使う
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string   { return "msgpack" }
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+var codecs = map[string]Codec{
+	"json":    jsonCodec{},
+	"msgpack": msgpackCodec{},
+}
+
+// サポートしているサブプロトコルと、それぞれが使うエンコード方式
+// 先に書いたものほど優先される
+var subprotocols = []struct {
+	Name  string
+	Codec string
+}{
+	{"quiz.v1.json", "json"},
+	{"quiz.v1.msgpack", "msgpack"},
+}
+
+// supportedSubprotocols upgraderに渡すサブプロトコル名の一覧
+func supportedSubprotocols() []string {
+	names := make([]string, len(subprotocols))
+	for i, p := range subprotocols {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// hasSupportedSubprotocol クライアントが要求したサブプロトコルに対応しているものがあるかを返す
+// サブプロトコルを要求していない従来のクライアントはtrue
+func hasSupportedSubprotocol(requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, name := range requested {
+		for _, p := range subprotocols {
+			if p.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// negotiateCodec 接続時に決まったサブプロトコルからエンコード方式を選ぶ
+// サブプロトコルを使わない従来のクライアントは ?encoding= で指定でき、
+// 未指定または未対応の場合はJSONを使う
+func negotiateCodec(subprotocol, encoding string) Codec {
+	for _, p := range subprotocols {
+		if p.Name == subprotocol {
+			return codecs[p.Codec]
+		}
+	}
+	if codec, ok := codecs[encoding]; ok {
+		return codec
+	}
+	return jsonCodec{}
+}
@@ -0,0 +1,87 @@
+package matchmaking
+
+import (
+	"log/slog"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"time"
+)
+
+// 同じユーザーが複数の端末から接続した場合の扱い
+const (
+	// 古い接続を切断して新しい接続を使う
+	DevicePolicyKickOld = "kick_old"
+	// 既に接続がある場合は新しい接続を拒否する
+	DevicePolicyRejectNew = "reject_new"
+	// 複数の接続を許可する
+	DevicePolicyAllow = "allow"
+)
+
+var devicePolicy = DevicePolicyKickOld
+
+// SetDevicePolicy 複数端末からの接続の扱いを設定する
+// サーバー起動前に呼び出すこと
+func SetDevicePolicy(policy string) {
+	switch policy {
+	case DevicePolicyKickOld, DevicePolicyRejectNew, DevicePolicyAllow:
+		devicePolicy = policy
+	default:
+		slog.Warn("不明な端末ポリシーです", "policy", policy, "fallback", DevicePolicyKickOld)
+		devicePolicy = DevicePolicyKickOld
+	}
+}
+
+// registerClient 端末ポリシーに従ってクライアントをHubに登録する
+// 新しい接続を拒否した場合はfalseを返す
+func registerClient(userID string, c *Client) bool {
+	switch devicePolicy {
+	case DevicePolicyRejectNew:
+		if !hub.RegisterIfAbsent(userID, c) {
+			slog.Info("既に接続中のため新しい接続を拒否します", logging.KeyConnID, c.ID, logging.KeyUserID, userID)
+			c.CloseWithError(CloseAlreadyConnected, "既に別の端末で接続しています")
+			return false
+		}
+	case DevicePolicyAllow:
+		hub.Register(userID, c)
+	default:
+		for _, old := range hub.Replace(userID, c) {
+			slog.Info("別の端末から接続されたため古い接続を切断します", logging.KeyConnID, old.ID, logging.KeyUserID, userID, "new_conn_id", c.ID)
+			old.CloseWithError(CloseLoggedInElsewhere, "別の端末でログインしたため切断しました")
+		}
+	}
+	return true
+}
+
+// disconnectRevoked セッションが無効になったユーザーの接続を切断する
+// sessionIDが空の場合はユーザーの全ての接続を切断する
+func disconnectRevoked(userID, sessionID string) {
+	for _, c := range hub.Lookup(userID) {
+		if sessionID != "" && c.SessionID() != sessionID {
+			continue
+		}
+		c.logger().Info("セッションが無効になったため切断します")
+		c.CloseWithError(CloseKicked, "セッションが無効になったため切断しました")
+	}
+}
+
+// listConnections ユーザーの接続中のクライアントの情報を返す
+// セッションの一覧APIから使う
+func listConnections(userID string) []auth.Connection {
+	clients := hub.Lookup(userID)
+	connections := make([]auth.Connection, 0, len(clients))
+	for _, c := range clients {
+		connections = append(connections, auth.Connection{
+			SessionID:    c.SessionID(),
+			IP:           c.IP,
+			ConnectedAt:  c.connectedAt,
+			LastActiveAt: time.Unix(0, c.lastActivity.Load()),
+			InGame:       c.RoomID() != "",
+		})
+	}
+	return connections
+}
+
+func init() {
+	auth.OnRevoke(disconnectRevoked)
+	auth.SetConnectionLister(listConnections)
+}
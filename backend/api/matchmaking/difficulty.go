@@ -0,0 +1,64 @@
+package matchmaking
+
+import (
+	"context"
+	"math/rand"
+	"sys3/api/repository"
+)
+
+// difficultyCurve 何問目にどの難易度の問題を出すか。問題数より短い場合は最後の難易度を繰り返す
+var difficultyCurve = []string{
+	repository.DifficultyEasy,
+	repository.DifficultyEasy,
+	repository.DifficultyNormal,
+	repository.DifficultyNormal,
+	repository.DifficultyHard,
+}
+
+// SetDifficultyCurve 何問目にどの難易度の問題を出すかを設定する。空の場合は難易度で絞り込まない
+// サーバー起動前に呼び出すこと
+func SetDifficultyCurve(curve []string) {
+	difficultyCurve = curve
+}
+
+// difficultyFor index問目(0始まり)に出す問題の難易度を返す
+func difficultyFor(index int) string {
+	if len(difficultyCurve) == 0 {
+		return ""
+	}
+	return difficultyCurve[min(index, len(difficultyCurve)-1)]
+}
+
+// pickQuestions filterに当てはまる問題から対戦で出題するn問を選び、出題する順に並べて返す
+// 問題は対戦の開始時にまとめて読み込み、出題のたびにデータベースに問い合わせない
+// 何問目かに応じた難易度の問題が足りない場合は難易度を問わずに選ぶ。問題が足りなければn問より少なくなる
+func pickQuestions(ctx context.Context, n int, filter repository.QuestionFilter) ([]repository.Question, error) {
+	sampled, err := questions.Sample(ctx, filter, n)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(sampled), func(i, j int) { sampled[i], sampled[j] = sampled[j], sampled[i] })
+
+	used := make([]bool, len(sampled))
+	// take まだ選んでいない問題のうち、difficultyの問題(空の場合は全ての問題)の最初のものを選ぶ
+	take := func(difficulty string) (repository.Question, bool) {
+		for i, q := range sampled {
+			if !used[i] && (difficulty == "" || q.Difficulty == difficulty) {
+				used[i] = true
+				return q, true
+			}
+		}
+		return repository.Question{}, false
+	}
+	picked := make([]repository.Question, 0, n)
+	for index := 0; index < n; index++ {
+		q, ok := take(difficultyFor(index))
+		if !ok {
+			if q, ok = take(""); !ok {
+				break
+			}
+		}
+		picked = append(picked, q)
+	}
+	return picked, nil
+}
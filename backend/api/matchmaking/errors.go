@@ -0,0 +1,52 @@
+package matchmaking
+
+import (
+	"errors"
+	"sys3/api/repository"
+)
+
+// 対戦の処理で返すエラー。呼び出し元はerrors.Isで判定し、クライアントにはErrorCodeで変換したエラーコードを送る
+var (
+	// ErrRoomNotFound 指定した部屋がないか、既に終わっている
+	ErrRoomNotFound = errors.New("部屋が見つかりません")
+	// ErrAlreadyQueued 同じ待ち行列で既に対戦相手を待っている
+	ErrAlreadyQueued = errors.New("既に対戦相手を待っています")
+	// ErrNotYourTurn 回答権のないプレイヤーが回答した
+	ErrNotYourTurn = errors.New("回答権がありません")
+	// ErrServerBusy 同時に進める対戦の数が上限に達していて、対戦を開始できない
+	ErrServerBusy = errors.New("サーバーが混み合っているため対戦を開始できませんでした。しばらくしてから再度お試しください")
+	// ErrDBUnavailable データベースに接続できないため、対戦を始められないか結果を保存できない
+	ErrDBUnavailable = repository.ErrDBUnavailable
+)
+
+// errorCodes エラーとクライアントに送るエラーコードの対応。ラップされたエラーも上から順にerrors.Isで判定する
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrRoomNotFound, ErrCodeRoomNotFound},
+	{ErrAlreadyQueued, ErrCodeAlreadyQueued},
+	{ErrNotYourTurn, ErrCodeNotYourTurn},
+	{ErrServerBusy, ErrCodeServerBusy},
+	{ErrDBUnavailable, ErrCodeUnavailable},
+}
+
+// ErrorCode errに対応するクライアント向けのエラーコードを返す。対応するものがなければErrCodeServerError
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ErrCodeServerError
+}
+
+// errorMessageFor errをクライアントに送るエラーメッセージにする
+// 対応するエラーコードのないエラーは、内部の情報を含むことがあるのでメッセージを送らない
+func errorMessageFor(err error) ErrorMessage {
+	code := ErrorCode(err)
+	if code == ErrCodeServerError {
+		return newErrorMessage(code, "サーバーエラーが発生しました")
+	}
+	return newErrorMessage(code, err.Error())
+}
@@ -1,192 +1,462 @@
 package matchmaking
 
 import (
-	"bytes"
-	"database/sql"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/http/httptest"
+	"slices"
 	"sync"
+	"sys3/api/account"
+	"sys3/api/auth"
+	"sys3/api/clientip"
+	"sys3/api/events"
+	"sys3/api/logging"
+	"sys3/api/metrics"
 	"sys3/api/rate"
+	"sys3/api/repository"
+	"sys3/api/tracing"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	rooms      = make(map[string]*Room)
 	roomsMutex sync.Mutex
 	upgrader   = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // 全てのオリジンを許可
-		},
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+		CheckOrigin:     checkOrigin, // 許可リストに含まれるオリジンのみ許可
+		Subprotocols:    supportedSubprotocols(),
+		ReadBufferSize:  defaultConnectionConfig.ReadBufferSize,
+		WriteBufferSize: defaultConnectionConfig.WriteBufferSize,
 	}
-	db *sql.DB
+	// レートの参照・更新はこのインターフェースを通して行う
+	ratings rate.RatingService
+	// 出題する問題の取得先
+	questions repository.QuestionRepository
+	// 対戦相手に送るプロフィールの取得先
+	profiles repository.ProfileRepository
+	// ランク戦の参加条件にするメールアドレスの確認状態の取得先
+	emails repository.EmailRepository
+	// データベースに接続できているか。接続できない間は新しい対戦を始めない
+	databaseHealthy = func() bool { return true }
 )
 
 // WebSocketを使用したマッチメイキングハンドラー
 func MatchmakingHandler(w http.ResponseWriter, r *http.Request) {
+	// 停止中のサーバーにはロードバランサーが振り分けないはずだが、届いた場合は別のサーバーに繋ぎ直してもらう
+	if draining.Load() {
+		http.Error(w, "サーバーを停止しています", http.StatusServiceUnavailable)
+		return
+	}
+
+	// 未対応のサブプロトコルのみを要求するクライアントはアップグレード前に拒否する
+	if !hasSupportedSubprotocol(websocket.Subprotocols(r)) {
+		http.Error(w, "未対応のサブプロトコルです", http.StatusBadRequest)
+		return
+	}
+
+	// ゲームの種類ごとに別々にマッチングし、レートもその種類のものを使う
+	gameType := rate.NormalizeGameType(r.URL.Query().Get("game_type"))
+	if !rate.IsKnownGameType(gameType) {
+		http.Error(w, "不明なゲームの種類です", http.StatusBadRequest)
+		return
+	}
+
+	// テーマのある対戦はプールの問題だけを出題し、同じプールの部屋どうしでマッチングする
+	pool, err := resolvePool(r)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "問題のプールが見つかりません", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errPoolEmpty) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("問題のプールの取得エラー", logging.Err(err))
+		http.Error(w, "サーバーエラーが発生しました", http.StatusInternalServerError)
+		return
+	}
+
+	// 接続ごとのIDを発行する。ログとクライアントに送るエラーに含め、アップグレードの応答ヘッダーでも返す
+	connID := newConnID()
+
+	// 接続してから部屋に入るまでをスパンに記録する。途中で終わった場合はここで終える
+	ctx, handshake := tracing.Start(tracing.FromRequest(r), "matchmaking.handshake",
+		attribute.String(logging.KeyConnID, connID),
+		attribute.String("game_type", gameType),
+		attribute.Int("pool_id", pool.ID),
+	)
+	defer handshake.End()
 
 	// WebSocket接続のアップグレード
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, http.Header{"X-Connection-Id": {connID}})
 	if err != nil {
-		fmt.Printf("WebSocketアップグレードエラー: %v\n", err)
+		slog.Warn("WebSocketアップグレードエラー", logging.KeyConnID, connID, logging.Err(err))
+		tracing.Fail(handshake, err)
 		http.Error(w, fmt.Sprintf("WebSocketアップグレード失敗: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer conn.Close()
 
-	// Cookieの確認
-	cookies := r.Cookies()
-	fmt.Printf("受け取ったクッキー: %+v\n", cookies)
+	// ネゴシエーションしたサブプロトコル(または ?encoding=)のエンコード方式でクライアントを作成
+	client := newClient(conn, negotiateCodec(conn.Subprotocol(), r.URL.Query().Get("encoding")))
+	client.ID = connID
+	client.IP = clientip.FromRequest(r)
+	client.start()
+	// 対戦相手として部屋に参加した接続は、対戦を進めるゴルーチンが引き継いで閉じる
+	handedOff := false
+	// 送信キューに残ったメッセージを書き込んでから接続を閉じる
+	defer func() {
+		if !handedOff {
+			client.Shutdown()
+		}
+	}()
 
-	cookie, err := r.Cookie("username")
+	// アップグレード時のトークン、なければ最初のメッセージで認証してからマッチメイキングに参加させる
+	claims, _ := auth.FromRequest(r)
+	userID, err := authenticate(client, claims)
 	if err != nil {
-		fmt.Printf("クッキーエラー: %v\n", err)
-		conn.WriteJSON(map[string]string{
-			"status":  "unauthorized",
-			"message": "ログインが必要です",
-		})
+		slog.Warn("認証エラー", logging.KeyConnID, connID, "ip", client.IP, logging.Err(err))
+		tracing.Fail(handshake, err)
+		client.CloseWithError(CloseUnauthorized, "認証に失敗しました")
 		return
 	}
 
-	fmt.Printf("見つかったユーザー名クッキー: %+v\n", cookie)
+	slog.Info("WebSocket接続確立", logging.KeyConnID, connID, logging.KeyUserID, userID, "ip", client.IP, "guest", client.Guest)
+	handshake.SetAttributes(attribute.String(logging.KeyUserID, userID), attribute.Bool("guest", client.Guest))
 
-	fmt.Printf("WebSocket接続確立: %s\n", cookie.Value)
+	// 対戦の途中で問題を取得できなくなるので、データベースに接続できない間は受け付けない
+	if !databaseHealthy() {
+		client.CloseWithError(CloseUnavailable, "現在サーバーに障害が発生しているため対戦を開始できません。しばらくしてから再度お試しください")
+		return
+	}
 
-	roomsMutex.Lock()
+	// ?mode=casual でレートの変動しないカジュアル戦に参加する
+	// ゲストは常にカジュアル戦
+	casual := r.URL.Query().Get("mode") == ModeCasual || client.Guest
+	handshake.SetAttributes(attribute.Bool("casual", casual))
 
-	// 空いている部屋を探す
-	var matchedRoom *Room
-	for _, room := range rooms {
-		if room.PlayerID != cookie.Value && !room.IsMatched {
-			matchedRoom = room
-			matchedRoom.IsMatched = false
-			matchedRoom.Player2ID = cookie.Value
-			break
+	// 設定されている場合、ランク戦はメールアドレスを確認したユーザーのみ
+	if !casual && account.EmailVerificationRequired() {
+		ctx, cancel := repository.WithTimeout(ctx)
+		verified, err := account.IsEmailVerified(ctx, emails, userID)
+		cancel()
+		if err != nil {
+			slog.Error("メール確認状態の取得エラー", logging.KeyConnID, connID, logging.KeyUserID, userID, logging.Err(err))
+			client.SendError(ErrCodeServerError, "サーバーエラーが発生しました")
+			return
+		}
+		if !verified {
+			client.SendError(ErrCodeEmailNotVerified, "ランク戦に参加するにはメールアドレスの確認が必要です")
+			return
 		}
 	}
 
-	if matchedRoom != nil {
-		// 既存の部屋とマッチングが成功した場合の処理
-		matchedRoom.IsMatched = true
-		matchedRoom.Player2ID = cookie.Value
-		matchedRoom.Player2Conn = conn
-		roomsMutex.Unlock()
+	// 接続中のクライアントとしてHubに登録(同じユーザーの既存の接続は端末ポリシーに従う)
+	if !registerClient(userID, client) {
+		return
+	}
+	defer func() {
+		if !handedOff {
+			hub.Unregister(userID, client)
+		}
+	}()
+
+	client.handshake = handshake.SpanContext()
 
-		// 両プレイヤーにマッチング成功を通知
-		matchResponse := map[string]string{
-			"status":  "matched",
-			"room_id": matchedRoom.ID,
+	// 別のインスタンスで対戦相手を待っている部屋があれば、そのインスタンスで対戦する
+	// (複数のインスタンスでマッチングしない場合は何もしない)
+	if remote, ok := cluster.findRemote(gameType, modeOf(casual), pool.ID, userID); ok {
+		joined := func() {
+			handshake.SetAttributes(attribute.String(logging.KeyRoomID, remote.ID), attribute.Bool("matched", true), attribute.String("owner_instance", remote.Instance))
+			handshake.End()
 		}
-		matchedRoom.Player1Conn.WriteJSON(matchResponse)
-		conn.WriteJSON(matchResponse)
+		if cluster.joinRemote(client, userID, remote, joined) {
+			return
+		}
+	}
 
-		// 接続を維持
-		select {}
+	roomsMutex.Lock()
+	// 接続を受け付けてから部屋に入るまでの間にサーバーの停止が始まった
+	if draining.Load() {
+		roomsMutex.Unlock()
+		client.CloseWithError(CloseServerShutdown, "サーバーを停止しているため対戦を開始できません")
+		return
+	}
 
-		// Player1の場合のみゲームセッションを開始
-		handleGameSession(matchedRoom)
+	if queuedIn(userID, gameType, casual, pool.ID) {
+		roomsMutex.Unlock()
+		client.Reply("", errorMessageFor(ErrAlreadyQueued))
+		return
+	}
+
+	// 空いている部屋を探す
+	matchedRoom := claimRoom(userID, gameType, casual, pool.ID)
+	if matchedRoom != nil {
+		// 既存の部屋とマッチングが成功した場合の処理
+		matchedRoom.IsMatched = true
+		matchedRoom.Player2ID = userID
+		joinRoom(ctx, matchedRoom, client)
+		handshake.SetAttributes(attribute.String(logging.KeyRoomID, matchedRoom.ID), attribute.Bool("matched", true))
+		handshake.End()
+
+		// 対戦は部屋の作成者の接続のハンドラーで進める。この接続の読み取りと切断の検知はreadPumpが行い、
+		// 対戦が終わったらreleaseJoinerで閉じるので、ハンドラーはここで終わる
+		handedOff = true
 		return
 	}
 
 	// マッチする部屋が見つからなかった場合、新しい部屋を作成
 	newRoom := &Room{
 		ID:          generateRoomID(),
-		PlayerID:    cookie.Value,
-		Player1Conn: conn,
+		PlayerID:    userID,
+		Player1Conn: client,
+		GameType:    gameType,
+		Casual:      casual,
+		PoolID:      pool.ID,
+		PoolName:    pool.Name,
 		CreatedAt:   time.Now(),
 		IsMatched:   false,
+		matched:     make(chan struct{}),
 	}
+	newRoom.ctx, newRoom.cancel = context.WithCancel(context.Background())
 	rooms[newRoom.ID] = newRoom
+	client.setBusy(true)
+	client.setRoom(newRoom.ID)
 	roomsMutex.Unlock()
+	// 他のインスタンスに接続したプレイヤーともマッチングできるようにする
+	cluster.enqueue(newRoom)
 
 	// クライアントに待機状態を通知
-	conn.WriteJSON(map[string]string{
+	client.Write(map[string]string{
 		"status":  "waiting",
 		"room_id": newRoom.ID,
 	})
+	events.Emit(ctx, newRoom.event(events.TypeMatchCreated, nil))
+
+	handshake.SetAttributes(attribute.String(logging.KeyRoomID, newRoom.ID), attribute.Bool("matched", false))
+	handshake.End()
 
 	// マッチングを待機
 	if waitForMatch(newRoom) {
 		// 部屋作成者（Player1）の場合のみゲームセッションを開始
 		handleGameSession(newRoom)
+
+		// 対戦が終わった接続はアイドル判定の対象に戻す
+		newRoom.Player1Conn.setBusy(false)
+	} else {
+		client.setBusy(false)
 	}
 	// マッチングがタイムアウトした場合は、この時点で処理が終了する
 }
 
+// queuedIn ユーザーが同じ待ち行列で対戦相手を待っているか。roomsMutexをロックしてから呼ぶこと
+// 接続ごとに別の部屋を作ると、同じユーザーの部屋どうしはマッチングしないため待ち行列が無駄に増える
+// 別の端末からの接続で置き換えられた接続の部屋は、Hubに登録されていないので数えない
+func queuedIn(userID, gameType string, casual bool, poolID int) bool {
+	connected := hub.Lookup(userID)
+	for _, room := range rooms {
+		if room.PlayerID == userID && !room.IsMatched && room.GameType == gameType && room.Casual == casual && room.PoolID == poolID && slices.Contains(connected, room.Player1Conn) {
+			return true
+		}
+	}
+	return false
+}
+
+// claimRoom 条件に合う空いている部屋を探し、対戦相手として参加するために確保する
+// roomsMutexをロックしてから呼ぶこと。返すときもロックしたままになっている
+// 共有の待ち行列からの取り出しはRedisへの問い合わせになるので、候補を選んでからロックを解除して行い、
+// ロックし直した後で、その間に他の接続が参加したりタイムアウトしたりしていないかを確かめる
+func claimRoom(userID, gameType string, casual bool, poolID int) *Room {
+	var candidates []*Room
+	for _, room := range rooms {
+		if room.PlayerID != userID && !room.IsMatched && room.GameType == gameType && room.Casual == casual && room.PoolID == poolID {
+			candidates = append(candidates, room)
+		}
+	}
+
+	for _, room := range candidates {
+		if cluster.shares(room) {
+			roomsMutex.Unlock()
+			claimed := cluster.claim(room)
+			roomsMutex.Lock()
+			if !claimed {
+				continue
+			}
+		}
+		if rooms[room.ID] == room && !room.IsMatched {
+			return room
+		}
+	}
+	return nil
+}
+
+// joinRoom clientをPlayer2として部屋に参加させ、両プレイヤーにマッチングしたことを通知する
+// roomsMutexをロックし、IsMatchedとPlayer2IDを設定してから呼ぶこと。この中でロックを解除する
+// プロフィールの取得はデータベースへの問い合わせになるので、ロックを解除してから行う
+func joinRoom(ctx context.Context, room *Room, client *Client) {
+	sessions.Add(1)
+	room.Player2Conn = client
+	client.setBusy(true)
+	client.setRoom(room.ID)
+	player1ID, player2ID := room.PlayerID, room.Player2ID
+	roomsMutex.Unlock()
+
+	ctx, cancel := repository.WithTimeout(ctx)
+	defer cancel()
+	// Profilesは対戦が始まる(room.matchedを閉じる)までは、このゴルーチンしか触らない
+	room.Profiles = map[string]account.PublicProfile{
+		player1ID: account.GetPublicProfile(ctx, profiles, player1ID),
+		player2ID: account.GetPublicProfile(ctx, profiles, player2ID),
+	}
+
+	// 両プレイヤーにマッチング成功を通知(このゲームの種類でのレートとランク帯も含める)
+	matchResponse := map[string]interface{}{
+		"status":    "matched",
+		"room_id":   room.ID,
+		"game_type": room.GameType,
+		"mode":      room.Mode(),
+		"pool":      room.PoolName,
+		"profiles":  room.Profiles,
+		"ratings": map[string]int{
+			room.PlayerID:  ratings.Rating(ctx, room.PlayerID, room.GameType),
+			room.Player2ID: ratings.Rating(ctx, room.Player2ID, room.GameType),
+		},
+		"tiers": map[string]string{
+			room.PlayerID:  ratings.Tier(ctx, room.PlayerID, room.GameType),
+			room.Player2ID: ratings.Tier(ctx, room.Player2ID, room.GameType),
+		},
+	}
+	room.Player1Conn.Write(matchResponse)
+	client.Write(matchResponse)
+	// マッチングの通知より先にゲーム開始のメッセージが届かないように、送信してから待っている作成者に知らせる
+	close(room.matched)
+}
+
 func generateRoomID() string {
 	// ユニークな部屋IDを生成する実装
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
 func handleGameSession(room *Room) {
-	// 出題済みの問題IDを管理
-	usedQuestionIDs := make(map[int]bool)
-
-	// 利用可能な問題の総数を取得
-	var totalQuestions int
-	err := db.QueryRow("SELECT COUNT(*) FROM questions").Scan(&totalQuestions)
+	// サーバーの停止時に、進行中の対戦が終わるのを待てるようにする
+	defer sessions.Done()
+	// 引き継いだ参加者の接続は、最後のメッセージを送ってから閉じる
+	defer releaseJoiner(room)
+	// 対戦が終わったら、実行中のデータベース操作も中断させる
+	defer room.cancel()
+
+	// 対戦ごとに新しいトレースを始め、両プレイヤーの接続のスパンをリンクする
+	// 問題の取得や結果の保存などのデータベース操作は、このスパンの子として記録される
+	matchCtx, span := tracing.Tracer().Start(room.ctx, "match",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: room.Player1Conn.handshake}, trace.Link{SpanContext: room.Player2Conn.handshake}),
+		trace.WithAttributes(
+			attribute.String(logging.KeyRoomID, room.ID),
+			attribute.String("game_type", room.GameType),
+			attribute.String("mode", room.Mode()),
+			attribute.Int("pool_id", room.PoolID),
+		),
+	)
+	logger := room.logger().With("conn_ids", []string{room.Player1Conn.ID, room.Player2Conn.ID})
+	if traceID := tracing.TraceID(matchCtx); traceID != "" {
+		logger = logger.With(logging.KeyTraceID, traceID)
+	}
+	// 途中で終わった場合は中断として記録する
+	result := metrics.MatchAborted
+	// 対戦が終わったイベントに載せる内容。全ての問題を出題し終えた場合はスコアと勝者を含める
+	finished := map[string]interface{}{}
+	// 出題中の問題のスパン。途中で終わった場合に閉じる
+	var questionSpan trace.Span
+	defer func() {
+		if questionSpan != nil {
+			questionSpan.End()
+		}
+		finished["result"] = finishMatch(room, result)
+		if !room.StartedAt.IsZero() {
+			finished["duration_ms"] = time.Since(room.StartedAt).Milliseconds()
+		}
+		span.SetAttributes(attribute.String("result", finished["result"].(string)))
+		span.End()
+		events.Emit(matchCtx, room.event(events.TypeMatchFinished, finished))
+	}()
+	// パニックが発生した場合は対戦を無効にして、中断として記録する
+	defer recoverSession(room, span, logger)
+
+	// 同時に進める対戦の数が上限に達している場合は、枠が空くまで開始を待つ
+	if err := scheduler.acquire(room); err != nil {
+		logger.Warn("対戦を開始できません", logging.Err(err))
+		if errors.Is(err, ErrServerBusy) {
+			room.Player1Conn.Write(errorMessageFor(err))
+			room.Player2Conn.Write(errorMessageFor(err))
+		}
+		return
+	}
+	defer scheduler.release()
+
+	// 出題する問題を、何問目かに応じた難易度で開始前にまとめて取得する
+	// 問題数は設定した問題数と利用可能な問題数のうち少ない方になる
+	fetchStart := time.Now()
+	ctx, cancel := repository.WithTimeout(matchCtx)
+	picked, err := pickQuestions(ctx, gameConfig.QuestionsPerGame, repository.QuestionFilter{PoolID: room.PoolID})
+	cancel()
+	logIfSlow(logger, "question_fetch", fetchStart, slowLogConfig.QuestionFetch, "questions", len(picked))
 	if err != nil {
-		log.Printf("問題数取得エラー: %v", err)
+		logger.Error("問題取得エラー", logging.Err(err))
+		tracing.Fail(span, err)
+		abortGame(room)
 		return
 	}
 
 	// ゲーム開始メッセージを送信
+	room.StartedAt = time.Now()
+	metrics.MatchesStarted.WithLabelValues(room.GameType, room.Mode()).Inc()
+	events.Emit(matchCtx, room.event(events.TypeMatchStarted, nil))
 	startMessage := map[string]string{
 		"status":  "game_start",
 		"message": "対戦を開始します",
 	}
-	if err := room.Player1Conn.WriteJSON(startMessage); err != nil {
-		log.Printf("Player1へのゲーム開始メッセージ送信エラー: %v", err)
+	if err := room.Player1Conn.Write(startMessage); err != nil {
+		logger.Warn("ゲーム開始メッセージ送信エラー", logging.KeyUserID, room.PlayerID, logging.Err(err))
 		return
 	}
-	if err := room.Player2Conn.WriteJSON(startMessage); err != nil {
-		log.Printf("Player2へのゲーム開始メッセージ送信エラー: %v", err)
+	if err := room.Player2Conn.Write(startMessage); err != nil {
+		logger.Warn("ゲーム開始メッセージ送信エラー", logging.KeyUserID, room.Player2ID, logging.Err(err))
 		return
 	}
 
 	// スコアを管理
 	player1Score := 0
 	player2Score := 0
+	buzzTimes := answerTimes{}
+	// 問題ごとの回答(対戦記録と一緒に保存する)
+	var answers []rate.AnswerRecord
 
-	// 問題数を管理（利用可能な問題数と5問のうち少ない方）
-	const number_of_questions = 5 // ここで問題数を指定できつ
-	questionsPerGame := min(number_of_questions, totalQuestions)
-
-	for questionCount := 0; questionCount < questionsPerGame; questionCount++ {
-		// まだ出題していない問題を取得
-		var question Question
-		for {
-			err := db.QueryRow(`
-				SELECT id, question_text, correct_answer, choice1, choice2, choice3, choice4 
-				FROM questions 
-				ORDER BY RAND() 
-				LIMIT 1
-			`).Scan(
-				&question.ID,
-				&question.QuestionText,
-				&question.CorrectAnswer,
-				&question.Choices[0],
-				&question.Choices[1],
-				&question.Choices[2],
-				&question.Choices[3],
-			)
-			if err != nil {
-				log.Printf("問題取得エラー: %v", err)
-				return
-			}
-
-			// 未出題の問題であれば使用
-			if !usedQuestionIDs[question.ID] {
-				usedQuestionIDs[question.ID] = true
-				break
-			}
+	for questionCount, stored := range picked {
+		// 強制終了された部屋やサーバーの停止で中止した部屋は、結果を記録せずに終了する
+		if room.stopped() {
+			return
+		}
+		qlog := logger.With(logging.KeyQuestionIndex, questionCount)
+		_, questionSpan = tracing.Start(matchCtx, "match.question", attribute.Int(logging.KeyQuestionIndex, questionCount))
+
+		deliveryStart := time.Now()
+		qlog = qlog.With("question_id", stored.ID)
+		questionSpan.SetAttributes(attribute.Int("question_id", stored.ID), attribute.String("difficulty", stored.Difficulty))
+		question := Question{
+			ID:            stored.ID,
+			QuestionText:  stored.QuestionText,
+			CorrectAnswer: stored.CorrectAnswer,
+			Version:       stored.Version,
+		}
+		if stored.Source == repository.QuestionSourceCommunity {
+			question.Contributor = stored.CreatorUsername
 		}
+		copy(question.Choices[:], stored.Choices)
 
 		// 問題を送信
 		questionMessage := map[string]interface{}{
@@ -195,30 +465,54 @@ func handleGameSession(room *Room) {
 		}
 
 		// 両プレイヤーに順番に送信
-		if err := room.Player1Conn.WriteJSON(questionMessage); err != nil {
-			log.Printf("Player1への問題送信エラー: %v", err)
+		if err := room.Player1Conn.Write(questionMessage); err != nil {
+			qlog.Warn("問題送信エラー", logging.KeyUserID, room.PlayerID, logging.Err(err))
 			return
 		}
-		if err := room.Player2Conn.WriteJSON(questionMessage); err != nil {
-			log.Printf("Player2への問題送信エラー: %v", err)
+		if err := room.Player2Conn.Write(questionMessage); err != nil {
+			qlog.Warn("問題送信エラー", logging.KeyUserID, room.Player2ID, logging.Err(err))
 			return
 		}
+		metrics.QuestionDelivery.Observe(time.Since(deliveryStart).Seconds())
+		questionSpan.AddEvent("delivered")
+		// 出題した問題だけを報告できるように記録する
+		room.Player1Conn.shown.record(room.ID, room.GameType, question)
+		room.Player2Conn.shown.record(room.ID, room.GameType, question)
 
 		// 問題送信後、少し待機
-		time.Sleep(1 * time.Second)
+		if !room.pause(gameConfig.QuestionDelay) {
+			return
+		}
 
 		// 回答権管理用のチャネル
-		answerRights := make(chan string, 1)
-		answerTimeout := time.After(10 * time.Second)
+		answerRights := make(chan answerClaim, 1)
+		answerTimeout := time.After(gameConfig.BuzzTimeout)
+		questionOpenedAt := time.Now()
 		var answered bool
 
 		// 両プレイヤーからの回答リクエストを待機
-		go handleAnswerRequest(room.Player1Conn, room.PlayerID, answerRights)
-		go handleAnswerRequest(room.Player2Conn, room.Player2ID, answerRights)
+		questionDone := make(chan struct{})
+		buzzes := newBuzzLog(questionOpenedAt)
+		go handleAnswerRequest(room.Player1Conn, room.PlayerID, answerRights, questionDone, buzzes, qlog)
+		go handleAnswerRequest(room.Player2Conn, room.Player2ID, answerRights, questionDone, buzzes, qlog)
 
 		// 回答権または制限時間待ち
+		answerRecord := rate.AnswerRecord{QuestionID: question.ID, QuestionVersion: question.Version}
 		select {
-		case playerID := <-answerRights:
+		case claim := <-answerRights:
+			playerID := claim.PlayerID
+			buzzTime := time.Since(questionOpenedAt)
+			buzzTimes[playerID] = append(buzzTimes[playerID], buzzTime)
+			metrics.ObserveBuzz(room.GameType, stored.Categories, buzzTime)
+			answerRecord.PlayerID = playerID
+			answerRecord.LatencyMs = int(buzzTime.Milliseconds())
+			questionSpan.AddEvent("answer_rights_granted", trace.WithAttributes(attribute.String(logging.KeyUserID, playerID)))
+
+			// 遅延を考慮した判定のため、回答権獲得時の両プレイヤーの遅延を記録しておく
+			_, p1Latency, _ := room.Player1Conn.Latency()
+			_, p2Latency, _ := room.Player2Conn.Latency()
+			qlog.Info("回答権獲得時の遅延", logging.KeyUserID, playerID, "player1_latency", p1Latency, "player2_latency", p2Latency)
+
 			// 回答権獲得を両プレイヤーに通知
 			rightsGrantedMessage := map[string]interface{}{
 				"status":    "answer_rights_granted",
@@ -226,16 +520,21 @@ func handleGameSession(room *Room) {
 				"player_id": playerID, // どのプレイヤーが回答権を得たか
 			}
 
-			// 両プレイヤーに通知を送信
-			if err := room.Player1Conn.WriteJSON(rightsGrantedMessage); err != nil {
-				log.Printf("Player1への回答権通知エラー: %v", err)
+			// 両プレイヤーに通知を送信(回答権を得たプレイヤーにはrequest_idを返す)
+			player1RequestID, player2RequestID := claim.RequestID, ""
+			if playerID != room.PlayerID {
+				player1RequestID, player2RequestID = "", claim.RequestID
+			}
+			if err := room.Player1Conn.Reply(player1RequestID, rightsGrantedMessage); err != nil {
+				qlog.Warn("回答権通知エラー", logging.KeyUserID, room.PlayerID, logging.Err(err))
 			}
-			if err := room.Player2Conn.WriteJSON(rightsGrantedMessage); err != nil {
-				log.Printf("Player2への回答権通知エラー: %v", err)
+			if err := room.Player2Conn.Reply(player2RequestID, rightsGrantedMessage); err != nil {
+				qlog.Warn("回答権通知エラー", logging.KeyUserID, room.Player2ID, logging.Err(err))
 			}
 
 			// 回答権を得たプレイヤーの回答を待機
-			answered = handlePlayerAnswer(room, playerID, question.CorrectAnswer)
+			answerRecord.Answer, answered = handlePlayerAnswer(room, playerID, question.CorrectAnswer, qlog)
+			answerRecord.Correct = answered
 
 			// スコアの更新
 			if answered {
@@ -251,27 +550,46 @@ func handleGameSession(room *Room) {
 					"player1_score": player1Score,
 					"player2_score": player2Score,
 				}
-				room.Player1Conn.WriteJSON(scoreMessage)
-				room.Player2Conn.WriteJSON(scoreMessage)
+				room.Player1Conn.Write(scoreMessage)
+				room.Player2Conn.Write(scoreMessage)
 			}
 
+		case <-room.ctx.Done():
+			// 強制終了またはサーバーの停止
+			close(questionDone)
+			return
+
 		case <-answerTimeout:
 			// 制限時間切れ
+			questionSpan.AddEvent("timeout")
 			timeoutMessage := map[string]string{
 				"status":  "timeout",
 				"message": "制限時間切れ",
 			}
-			room.Player1Conn.WriteJSON(timeoutMessage)
-			room.Player2Conn.WriteJSON(timeoutMessage)
+			room.Player1Conn.Write(timeoutMessage)
+			room.Player2Conn.Write(timeoutMessage)
 		}
 
+		// この問題の回答受付を終了
+		close(questionDone)
+		answerRecord.Buzzes = buzzes.records()
+		answers = append(answers, answerRecord)
+		questionSpan.SetAttributes(attribute.Bool("correct", answerRecord.Correct))
+		questionSpan.End()
+		questionSpan = nil
+
 		// 次の問題までの待機時間
-		time.Sleep(3 * time.Second)
+		if !room.pause(gameConfig.NextQuestionDelay) {
+			return
+		}
 	}
 
 	// 最終結果の通知
 	finalResult := map[string]interface{}{
-		"status": "game_end",
+		"status":    "game_end",
+		"game_type": room.GameType,
+		"mode":      room.Mode(),
+		"profiles":  room.Profiles,
 		"final_scores": map[string]interface{}{
 			"player1": map[string]interface{}{
 				"id":    room.PlayerID,
@@ -282,52 +600,107 @@ func handleGameSession(room *Room) {
 				"score": player2Score,
 			},
 		},
-		"winner": determineWinner(room.PlayerID, room.Player2ID, player1Score, player2Score),
 	}
+	outcome := determineWinner(room.PlayerID, room.Player2ID, player1Score, player2Score)
+	finalResult["winner"] = outcome.payload()
+	finished["questions"] = len(answers)
+	finished["scores"] = map[string]int{room.PlayerID: player1Score, room.Player2ID: player2Score}
+	finished["winner"] = outcome.payload()
 
-	room.Player1Conn.WriteJSON(finalResult)
-	room.Player2Conn.WriteJSON(finalResult)
+	if room.stopped() {
+		return
+	}
+	result = metrics.MatchCompleted
+	metrics.CompleteMatch(room.GameType, room.Mode(), outcome.Result == rate.OutcomeDraw)
+	// 対戦記録・回答・レートの更新をまとめて保存する(カジュアル戦はレートを変動させない)
+	// 更新後のレートを結果と一緒に送るので、クライアントが別途取得する必要はない
+	record := matchRecord(room, player1Score, player2Score, buzzTimes, outcome)
+	record.Answers = answers
+	finalizeStart := time.Now()
+	// 保存を始めた後は、強制終了やサーバーの停止で部屋のコンテキストがキャンセルされても最後まで保存する
+	saved, err := rate.NewFinalizer(ratings).Finalize(context.WithoutCancel(matchCtx), record, !room.Casual)
+	logIfSlow(logger, "finalize", finalizeStart, slowLogConfig.Finalize, "answers", len(record.Answers))
+	if err != nil {
+		logger.Error("対戦結果の保存エラー", logging.Err(err))
+		// 結果を保存できなかったことをクライアントが表示できるようにする
+		finalResult["error_code"] = ErrorCode(err)
+	} else if saved.Rated {
+		finalResult["rating_changes"] = ratingChanges(outcome, saved.Update)
+	}
 
-	// レート計算と更新
-	updatePlayerRatings(db, finalResult["winner"].(map[string]string)["id"],
-		finalResult["winner"].(map[string]string)["loser_id"])
+	room.Player1Conn.Write(finalResult)
+	room.Player2Conn.Write(finalResult)
 }
 
-func handleAnswerRequest(conn *websocket.Conn, playerID string, answerRights chan<- string) {
+// releaseJoiner 対戦が終わった参加者(Player2)の接続をHubから外して閉じる
+// 参加者の接続のハンドラーはjoinRoomの後すぐに返るので、接続は対戦を進めるゴルーチンが引き継いでいる
+// 別のインスタンスから参加したプレイヤーの中継はHubに登録していないので、閉じるだけになる
+func releaseJoiner(room *Room) {
+	hub.Unregister(room.Player2ID, room.Player2Conn)
+	room.Player2Conn.Shutdown()
+}
+
+// abortGame データベースのエラーで対戦を続けられなくなったことを両プレイヤーに通知する
+// 結果は記録せず、レートも変動しない
+func abortGame(room *Room) {
+	const message = "サーバーの障害により対戦を続けられなくなりました。この対戦の結果は記録されません"
+	room.Player1Conn.SendError(ErrCodeUnavailable, message)
+	room.Player2Conn.SendError(ErrCodeUnavailable, message)
+}
+
+func handleAnswerRequest(conn *Client, playerID string, answerRights chan<- answerClaim, done <-chan struct{}, buzzes *buzzLog, logger *slog.Logger) {
+	logger = logger.With(logging.KeyConnID, conn.ID, logging.KeyUserID, playerID)
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("handleAnswerRequest でパニック発生: %v", r)
+			logger.Error("handleAnswerRequest でパニック発生", "panic", r)
 		}
 	}()
 
 	for {
 		var message map[string]interface{}
-		err := conn.ReadJSON(&message)
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("予期せぬ接続切断: %v", err)
-			} else {
-				log.Printf("メッセージ読み取りエラー: %v", err)
-			}
+		select {
+		case <-done:
+			// この問題の出題が終わったので待機をやめる
 			return
+		case msg, ok := <-conn.Incoming():
+			if !ok {
+				logger.Info("プレイヤーの接続が切断されました")
+				return
+			}
+			message = msg
 		}
 
-		log.Printf("受信したメッセージ: %+v", message)
+		requestID := requestIDOf(message)
+		msgLog := logger.With(logging.KeyMessageType, message["type"], "request_id", requestID)
+		msgLog.Debug("受信したメッセージ", "message", message)
+
+		// 回答権を得る前や他のプレイヤーの回答中に送られた回答は受け付けない
+		if _, ok := message["answer"].(string); ok {
+			msgLog.Info("回答権のない回答を拒否")
+			if err := conn.Reply(requestID, errorMessageFor(ErrNotYourTurn)); err != nil {
+				msgLog.Warn("回答拒否メッセージ送信エラー", logging.Err(err))
+				return
+			}
+			continue
+		}
 
 		if message["type"] == "answer_request" {
 			select {
-			case answerRights <- playerID:
-				log.Printf("プレイヤー %s が回答権を獲得", playerID)
+			case answerRights <- answerClaim{PlayerID: playerID, RequestID: requestID}:
+				buzzes.add(playerID, true)
+				msgLog.Info("回答権を獲得")
 				// 回答権獲得の通知は handleGameSession で行うため、ここでは即座に return
 				return
 			default:
 				// 他のプレイヤーが既に回答権を取得している
-				err := conn.WriteJSON(map[string]string{
+				buzzes.add(playerID, false)
+				msgLog.Info("回答権要求を拒否")
+				err := conn.Reply(requestID, map[string]string{
 					"status":  "answer_denied",
 					"message": "他のプレイヤーが回答中です",
 				})
 				if err != nil {
-					log.Printf("回答権拒否メッセージ送信エラー: %v", err)
+					msgLog.Warn("回答権拒否メッセージ送信エラー", logging.Err(err))
 					return
 				}
 			}
@@ -335,11 +708,10 @@ func handleAnswerRequest(conn *websocket.Conn, playerID string, answerRights cha
 	}
 }
 
-func handlePlayerAnswer(room *Room, playerID string, correctAnswer string) bool {
-	log.Printf("プレイヤー %s の回答を待機中", playerID)
-
-	var conn *websocket.Conn
-	var otherConn *websocket.Conn
+// handlePlayerAnswer 回答権を得たプレイヤーの回答を待って判定し、回答と正誤を返す
+func handlePlayerAnswer(room *Room, playerID string, correctAnswer string, logger *slog.Logger) (string, bool) {
+	var conn *Client
+	var otherConn *Client
 
 	if playerID == room.PlayerID {
 		conn = room.Player1Conn
@@ -348,137 +720,190 @@ func handlePlayerAnswer(room *Room, playerID string, correctAnswer string) bool
 		conn = room.Player2Conn
 		otherConn = room.Player1Conn
 	}
+	logger = logger.With(logging.KeyConnID, conn.ID, logging.KeyUserID, playerID)
+	logger.Debug("回答を待機中")
 
 	// 回答を待機
-	answerTimeout := time.After(5 * time.Second)
-	answerChan := make(chan string)
-
-	go func() {
-		var answer map[string]string
-		if err := conn.ReadJSON(&answer); err == nil {
-			log.Printf("回答を受信: %+v", answer)
-			answerChan <- answer["answer"]
-		} else {
-			log.Printf("回答受信エラー: %v", err)
+	answerTimeout := time.After(gameConfig.AnswerTimeout)
+	answer, requestID, received := "", "", false
+	for !received {
+		select {
+		case message, ok := <-conn.Incoming():
+			if !ok {
+				// 切断された場合は時間切れと同じ扱いにする
+				logger.Info("回答受信エラー: 接続が切断されました")
+				answer = "時間切れ"
+				received = true
+				continue
+			}
+			// answerフィールドを持つメッセージのみ回答として扱う
+			if a, ok := message["answer"].(string); ok {
+				logger.Debug("回答を受信", logging.KeyMessageType, message["type"], "message", message)
+				answer = a
+				requestID = requestIDOf(message)
+				received = true
+			}
+		case <-answerTimeout:
+			logger.Info("回答時間切れ")
+			answer = "時間切れ"
+			received = true
 		}
-	}()
+	}
 
-	select {
-	case answer := <-answerChan:
-		isCorrect := answer == correctAnswer
-		log.Printf("回答結果: %v (正解: %s, 回答: %s)", isCorrect, correctAnswer, answer)
-
-		resultMessage := map[string]interface{}{
-			"status":         "answer_result",
-			"correct":        isCorrect,
-			"answer":         answer,
-			"correct_answer": correctAnswer,
-		}
-		conn.WriteJSON(resultMessage)
-		otherConn.WriteJSON(resultMessage)
-		return isCorrect
-
-	case <-answerTimeout:
-		log.Printf("回答時間切れ")
-		// タイムアウトメッセージを変更
-		timeoutMessage := map[string]interface{}{
-			"status":         "answer_result",
-			"correct":        false,
-			"answer":         "時間切れ",
-			"correct_answer": correctAnswer,
-		}
-		conn.WriteJSON(timeoutMessage)
-		otherConn.WriteJSON(timeoutMessage)
-		return false
+	isCorrect := answer == correctAnswer
+	logger.Info("回答結果", "correct", isCorrect, "correct_answer", correctAnswer, "answer", answer)
+
+	resultMessage := map[string]interface{}{
+		"status":         "answer_result",
+		"correct":        isCorrect,
+		"answer":         answer,
+		"correct_answer": correctAnswer,
 	}
+	conn.Reply(requestID, resultMessage)
+	otherConn.Write(resultMessage)
+	return answer, isCorrect
 }
 
+// waitForMatch 対戦相手が参加するか、タイムアウトするか、部屋が閉じられるまで待つ
+// 対戦相手が参加した場合はtrueを返す。待っている間はroomsMutexをロックしない
 func waitForMatch(room *Room) bool {
-	// タイムアウト時間を30秒に延長
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	// 設定した時間内に対戦相手が見つからなければタイムアウトにする
+	timer := time.NewTimer(gameConfig.MatchTimeout)
+	defer timer.Stop()
 
-	for {
+	select {
+	case <-room.matched:
+		return waitForJoin(room)
+	case <-timer.C:
 		roomsMutex.Lock()
 		if room.IsMatched {
+			// タイムアウトと同時にマッチングした
 			roomsMutex.Unlock()
-			return true
+			return waitForJoin(room)
 		}
+		delete(rooms, room.ID)
+		room.Player1Conn.Write(map[string]string{
+			"status": "timeout",
+		})
 		roomsMutex.Unlock()
-
-		select {
-		case <-ticker.C:
-			roomsMutex.Lock()
-			if !room.IsMatched {
-				delete(rooms, room.ID)
-				room.Player1Conn.WriteJSON(map[string]string{
-					"status": "timeout",
-				})
-				roomsMutex.Unlock()
-				return false
-			}
-			roomsMutex.Unlock()
-		default:
-			time.Sleep(100 * time.Millisecond)
+		cluster.remove(room)
+		metrics.MatchmakingWait.WithLabelValues(room.GameType, room.Mode(), metrics.WaitTimedOut).Observe(time.Since(room.CreatedAt).Seconds())
+		events.Emit(room.ctx, room.event(events.TypeMatchTimedOut, map[string]interface{}{"waited_ms": time.Since(room.CreatedAt).Milliseconds()}))
+		return false
+	case <-room.ctx.Done():
+		// サーバーの停止で部屋が閉じられた
+		// マッチングした直後に強制終了された部屋は、対戦を始めてhandleGameSessionに片付けさせる
+		roomsMutex.Lock()
+		matched := room.IsMatched
+		roomsMutex.Unlock()
+		if matched {
+			return waitForJoin(room)
 		}
+		return false
 	}
 }
 
+// waitForJoin IsMatchedを設定した部屋で、joinRoomがマッチングの通知を送り終えるのを待つ
+func waitForJoin(room *Room) bool {
+	<-room.matched
+	metrics.MatchmakingWait.WithLabelValues(room.GameType, room.Mode(), metrics.WaitMatched).Observe(time.Since(room.CreatedAt).Seconds())
+	return true
+}
+
 // 勝者を決定する関数
-func determineWinner(player1ID, player2ID string, score1, score2 int) map[string]string {
+func determineWinner(player1ID, player2ID string, score1, score2 int) GameOutcome {
 	if score1 > score2 {
-		return map[string]string{
-			"id":       player1ID,
-			"loser_id": player2ID,
-			"message":  "Player 1の勝利！",
+		return GameOutcome{
+			Result:   rate.OutcomeWin,
+			WinnerID: player1ID,
+			LoserID:  player2ID,
+			Message:  "Player 1の勝利！",
 		}
 	} else if score2 > score1 {
-		return map[string]string{
-			"id":       player2ID,
-			"loser_id": player1ID,
-			"message":  "Player 2の勝利！",
+		return GameOutcome{
+			Result:   rate.OutcomeWin,
+			WinnerID: player2ID,
+			LoserID:  player1ID,
+			Message:  "Player 2の勝利！",
 		}
 	}
-	return map[string]string{
-		"id":      "draw",
-		"message": "引き分け",
+	// 引き分けの場合もレート計算のために両者のIDを持っておく
+	return GameOutcome{
+		Result:   rate.OutcomeDraw,
+		WinnerID: player1ID,
+		LoserID:  player2ID,
+		Message:  "引き分け",
 	}
 }
 
-// レート計算と更新
-func updatePlayerRatings(db *sql.DB, winnerID, loserID string) {
-	if winnerID == "draw" {
-		return // 引き分けの場合はレーティング更新なし
+// matchRecord 保存する対戦記録を作成する
+// 引き分けの場合も両者のスコアを0.5としてレートを更新する
+func matchRecord(room *Room, player1Score, player2Score int, buzzTimes answerTimes, outcome GameOutcome) rate.MatchRecord {
+	return rate.MatchRecord{
+		MatchResult: rate.MatchResult{
+			WinnerID: outcome.WinnerID,
+			LoserID:  outcome.LoserID,
+			GameType: room.GameType,
+			Outcome:  outcome.Result,
+		},
+		Player1ID:    room.PlayerID,
+		Player2ID:    room.Player2ID,
+		Player1Score: player1Score,
+		Player2Score: player2Score,
+		StartedAt:    room.StartedAt,
+		MatchKey:     room.ID,
+
+		Player1AnswerMs: buzzTimes.averageMs(room.PlayerID),
+		Player2AnswerMs: buzzTimes.averageMs(room.Player2ID),
 	}
+}
 
-	// レート更新のリクエストを作成
-	rateRequest := rate.RatingRequest{
-		WinnerID: winnerID,
-		LoserID:  loserID,
-		GameType: "quiz",
+// ratingChanges 最終結果に含める両プレイヤーのレート変動
+func ratingChanges(outcome GameOutcome, update rate.RatingUpdate) map[string]interface{} {
+	return map[string]interface{}{
+		outcome.WinnerID: map[string]interface{}{
+			"old_rating": update.WinnerOldRating,
+			"new_rating": update.WinnerNewRating,
+			"delta":      update.WinnerNewRating - update.WinnerOldRating,
+			"tier":       update.WinnerTier,
+			"streak":     update.WinnerStreak,
+		},
+		outcome.LoserID: map[string]interface{}{
+			"old_rating": update.LoserOldRating,
+			"new_rating": update.LoserNewRating,
+			"delta":      update.LoserNewRating - update.LoserOldRating,
+			"tier":       update.LoserTier,
+			"streak":     update.LoserStreak,
+		},
 	}
+}
 
-	// レート計算ハンドラーを使用してレートを更新
-	handler := rate.CalculateRatingHandler(db)
-
-	// リクエストを作成
-	reqBody, _ := json.Marshal(rateRequest)
-	req, _ := http.NewRequest("POST", "/calculate-rating", bytes.NewBuffer(reqBody))
+// SetQuestionRepository 出題する問題の取得先を設定する
+// サーバー起動前に呼び出すこと
+func SetQuestionRepository(repo repository.QuestionRepository) {
+	questions = repo
+}
 
-	// レスポンスを受け取るためのRecorderを作成
-	w := httptest.NewRecorder()
+// SetProfileRepository 対戦相手に送るプロフィールの取得先を設定する
+// サーバー起動前に呼び出すこと
+func SetProfileRepository(repo repository.ProfileRepository) {
+	profiles = repo
+}
 
-	// ハンドラーを実行
-	handler.ServeHTTP(w, req)
+// SetEmailRepository メールアドレスの確認状態の取得先を設定する
+// サーバー起動前に呼び出すこと
+func SetEmailRepository(repo repository.EmailRepository) {
+	emails = repo
+}
 
-	// エラーチェック
-	if w.Code != http.StatusOK {
-		log.Printf("レート更新エラー: %v", w.Body.String())
-		return
-	}
+// SetHealthCheck データベースに接続できているかを返す関数を設定する
+// falseを返す間は新しい接続を受け付けない。指定しない場合は常に接続できているものとする
+func SetHealthCheck(fn func() bool) {
+	databaseHealthy = fn
 }
 
-// InitDB データベース接続を初期化する
-func InitDB(database *sql.DB) {
-	db = database
+// SetRatingService セッションで使うレートの参照・更新先を設定する
+// サーバー起動前に呼び出すこと
+func SetRatingService(service rate.RatingService) {
+	ratings = service
 }
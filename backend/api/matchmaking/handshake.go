@@ -0,0 +1,72 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"time"
+)
+
+// AuthTimeout 接続してから認証メッセージを受信するまでの制限時間
+const AuthTimeout = 10 * time.Second
+
+var (
+	errAuthTimeout   = errors.New("認証メッセージを受信できませんでした")
+	errGuestDisabled = errors.New("ゲストでの対戦は現在できません")
+	errScopeDenied   = errors.New("APIキーに対戦の権限がありません")
+)
+
+// authenticate 認証を行い、ユーザーIDを返す
+// アップグレード時にauth.Middlewareで検証済みのトークン(claims)があればそれを使う
+// なければ接続直後の最初のメッセージで認証する
+// クライアントは {"type": "auth", "token": "<ログイン時に発行されたトークン>"} を送信する
+// Cookieに頼らないので、ブラウザ以外のクライアントからも接続できる
+// ボットなどはトークンの代わりにAPIキーを使える
+func authenticate(c *Client, claims *auth.Claims) (string, error) {
+	requestID := ""
+	if claims == nil {
+		var message map[string]interface{}
+		select {
+		case msg, ok := <-c.Incoming():
+			if !ok {
+				return "", errAuthTimeout
+			}
+			message = msg
+		case <-time.After(AuthTimeout):
+			return "", errAuthTimeout
+		}
+
+		if message["type"] != "auth" {
+			return "", fmt.Errorf("最初のメッセージが認証メッセージではありません: %v", message["type"])
+		}
+		token, _ := message["token"].(string)
+		ctx, cancel := repository.WithTimeout(context.Background())
+		defer cancel()
+		var err error
+		claims, err = auth.Authenticate(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		requestID = requestIDOf(message)
+	}
+
+	// ゲストはゲストモードが有効な間だけ接続できる
+	if claims.IsGuest() && !auth.GuestModeEnabled() {
+		return "", errGuestDisabled
+	}
+	// APIキーで対戦するにはplayスコープが必要
+	if !claims.HasScope(auth.ScopePlay) {
+		return "", errScopeDenied
+	}
+
+	c.setClaims(claims)
+	c.Guest = claims.IsGuest()
+	c.Reply(requestID, map[string]interface{}{
+		"status":  "authenticated",
+		"user_id": claims.UserID(),
+		"guest":   c.Guest,
+	})
+	return claims.UserID(), nil
+}
@@ -0,0 +1,140 @@
+package matchmaking
+
+import "sync"
+
+// Hub 接続中の全クライアントをユーザーIDごとに管理する構造体
+// 同じユーザーが複数の端末から接続している場合もあるため、ユーザーごとに複数の接続を持つ
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[string]map[*Client]struct{}
+}
+
+// NewHub 空のHubを作成する
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[string]map[*Client]struct{}),
+	}
+}
+
+var hub = NewHub()
+
+// GetHub サーバー全体で共有しているHubを返す
+func GetHub() *Hub {
+	return hub
+}
+
+// Register クライアントをユーザーIDに紐付けて登録する
+func (h *Hub) Register(userID string, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c.UserID = userID
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*Client]struct{})
+	}
+	h.clients[userID][c] = struct{}{}
+}
+
+// Unregister クライアントの登録を解除する
+func (h *Hub) Unregister(userID string, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns := h.clients[userID]
+	if conns == nil {
+		return
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(h.clients, userID)
+	}
+}
+
+// Lookup 指定したユーザーの接続を全て返す
+func (h *Hub) Lookup(userID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	conns := make([]*Client, 0, len(h.clients[userID]))
+	for c := range h.clients[userID] {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// IsOnline 指定したユーザーが接続中かを返す
+func (h *Hub) IsOnline(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// Each 接続中の全クライアントに対してfnを呼び出す
+// fnの中でRegister/Unregisterを呼ばないこと
+func (h *Hub) Each(fn func(userID string, c *Client)) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for userID, conns := range h.clients {
+		for c := range conns {
+			fn(userID, c)
+		}
+	}
+}
+
+// Count 接続中のクライアント数を返す
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, conns := range h.clients {
+		count += len(conns)
+	}
+	return count
+}
+
+// Broadcast 接続中の全クライアントにメッセージを送信する
+// 送信に成功したクライアントの数を返す
+func (h *Hub) Broadcast(msg interface{}) int {
+	// 送信中にロックを保持しないよう、先に送信先を集めておく
+	var targets []*Client
+	h.Each(func(_ string, c *Client) {
+		targets = append(targets, c)
+	})
+
+	delivered := 0
+	for _, c := range targets {
+		if err := c.Write(msg); err == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// Replace クライアントを登録し、同じユーザーの既存の接続を登録解除して返す
+func (h *Hub) Replace(userID string, c *Client) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var previous []*Client
+	for old := range h.clients[userID] {
+		previous = append(previous, old)
+	}
+	c.UserID = userID
+	h.clients[userID] = map[*Client]struct{}{c: {}}
+	return previous
+}
+
+// RegisterIfAbsent 同じユーザーの接続がない場合のみクライアントを登録する
+func (h *Hub) RegisterIfAbsent(userID string, c *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients[userID]) > 0 {
+		return false
+	}
+	c.UserID = userID
+	h.clients[userID] = map[*Client]struct{}{c: {}}
+	return true
+}
@@ -0,0 +1,72 @@
+package matchmaking
+
+import (
+	"time"
+)
+
+// IdleConfig 何もしていない接続を切断するまでの時間を管理する構造体
+type IdleConfig struct {
+	// マッチング待ちでも対戦中でもない状態がこの時間続いたら切断する
+	// 0の場合は切断しない
+	Timeout time.Duration
+}
+
+// defaultIdleConfig 設定しない場合のアイドル接続のタイムアウト
+var defaultIdleConfig = IdleConfig{
+	Timeout: 5 * time.Minute,
+}
+
+var idleConfig = defaultIdleConfig
+
+// DefaultIdleConfig 設定しない場合に使うアイドル接続のタイムアウトを返す
+func DefaultIdleConfig() IdleConfig {
+	return defaultIdleConfig
+}
+
+// SetIdleConfig アイドル接続のタイムアウトを設定する
+// サーバー起動前に呼び出すこと
+func SetIdleConfig(config IdleConfig) {
+	idleConfig = config
+}
+
+// touch 最後に操作があった時刻を更新する
+func (c *Client) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// setBusy マッチング待ちや対戦中はアイドル判定の対象外にする
+// 対象外から戻った時点からアイドル時間を数え直す
+func (c *Client) setBusy(busy bool) {
+	c.busy.Store(busy)
+	c.touch()
+}
+
+// idleFor 最後の操作からの経過時間を返す
+func (c *Client) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.lastActivity.Load()))
+}
+
+// idleLoop アイドル状態が続いた接続にメッセージを送ってから切断する
+func (c *Client) idleLoop() {
+	timeout := idleConfig.Timeout
+	if timeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			if c.busy.Load() || c.idleFor(now) < timeout {
+				continue
+			}
+			c.logger().Info("アイドル状態が続いたため切断します")
+			c.CloseWithError(CloseIdleTimeout, "一定時間操作がなかったため切断しました")
+			return
+		}
+	}
+}
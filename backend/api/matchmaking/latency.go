@@ -0,0 +1,77 @@
+package matchmaking
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyTracker Ping/Pongから測定した往復遅延(RTT)を保持する
+type latencyTracker struct {
+	mu      sync.RWMutex
+	last    time.Duration
+	average time.Duration // 指数移動平均
+	samples int
+}
+
+// 移動平均で新しい測定値にかける重み
+const latencySmoothing = 0.2
+
+func (t *latencyTracker) record(rtt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.last = rtt
+	if t.samples == 0 {
+		t.average = rtt
+	} else {
+		t.average = time.Duration(latencySmoothing*float64(rtt) + (1-latencySmoothing)*float64(t.average))
+	}
+	t.samples++
+}
+
+func (t *latencyTracker) get() (last, average time.Duration, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.last, t.average, t.samples > 0
+}
+
+// pingPayload Pingに送信時刻を埋め込む
+func pingPayload(now time.Time) []byte {
+	return []byte(strconv.FormatInt(now.UnixNano(), 10))
+}
+
+// rttFromPong Pongに含まれる送信時刻から往復遅延を計算する
+func rttFromPong(payload string, now time.Time) (time.Duration, bool) {
+	sentAt, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	rtt := now.Sub(time.Unix(0, sentAt))
+	if rtt < 0 {
+		return 0, false
+	}
+	return rtt, true
+}
+
+// Latency 直近に測定した往復遅延と、その移動平均を返す
+// まだ測定できていない場合はokがfalseになる
+func (c *Client) Latency() (last, average time.Duration, ok bool) {
+	return c.latency.get()
+}
+
+// recordPong Pongの受信時に遅延を記録し、クライアントにlatency_reportを送信する
+func (c *Client) recordPong(payload string) {
+	rtt, ok := rttFromPong(payload, time.Now())
+	if !ok {
+		return
+	}
+	c.latency.record(rtt)
+
+	_, average, _ := c.latency.get()
+	c.Write(map[string]interface{}{
+		"status":     "latency_report",
+		"rtt_ms":     rtt.Milliseconds(),
+		"avg_rtt_ms": average.Milliseconds(),
+	})
+}
@@ -0,0 +1,74 @@
+package matchmaking
+
+import (
+	"sys3/api/health"
+	"sys3/api/metrics"
+)
+
+func init() {
+	metrics.SetRoomStates(countRoomStates)
+	metrics.SetGamesInProgress(countGamesInProgress)
+}
+
+// countRoomStates 状態ごとの部屋の数を数える
+// 対戦が終わった部屋はコンテキストがキャンセルされているので数えない
+func countRoomStates() map[string]int {
+	roomsMutex.Lock()
+	defer roomsMutex.Unlock()
+
+	counts := map[string]int{}
+	for _, room := range rooms {
+		switch {
+		case !room.IsMatched:
+			counts[metrics.RoomWaiting]++
+		case room.ctx.Err() == nil:
+			counts[metrics.RoomPlaying]++
+		}
+	}
+	return counts
+}
+
+// countGamesInProgress 進行中の対戦の数を種類ごとに数える
+func countGamesInProgress() map[metrics.Game]int {
+	roomsMutex.Lock()
+	defer roomsMutex.Unlock()
+
+	counts := map[metrics.Game]int{}
+	for _, room := range rooms {
+		if room.IsMatched && room.ctx.Err() == nil {
+			counts[metrics.Game{GameType: room.GameType, Mode: room.Mode()}]++
+		}
+	}
+	return counts
+}
+
+// finishMatch 対戦が終わったことを終わり方と一緒にメトリクスに記録し、記録した終わり方を返す
+func finishMatch(room *Room, result string) string {
+	if room.closed.Load() {
+		result = metrics.MatchClosed
+	} else if room.shutdown.Load() {
+		result = metrics.MatchShutdown
+	}
+	metrics.MatchesFinished.WithLabelValues(room.GameType, room.Mode(), result).Inc()
+	return result
+}
+
+// Readiness 新しい対戦を受け付けているかを/readyzに返す。データベースに接続できない間は受け付けない
+func Readiness() health.CheckResult {
+	rooms := countRoomStates()
+	result := health.CheckResult{
+		Healthy: databaseHealthy() && !draining.Load(),
+		Details: map[string]interface{}{
+			"connections":   hub.Count(),
+			"waiting_rooms": rooms[metrics.RoomWaiting],
+			"playing_rooms": rooms[metrics.RoomPlaying],
+			"queued_games":  scheduler.waiting(),
+		},
+	}
+	if draining.Load() {
+		result.Error = "サーバーを停止しているため新しい対戦を受け付けていません"
+	} else if !result.Healthy {
+		result.Error = "データベースに接続できないため新しい対戦を受け付けていません"
+	}
+	return result
+}
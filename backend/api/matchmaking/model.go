@@ -2,11 +2,52 @@
 package matchmaking
 
 import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"sys3/api/account"
+	"sys3/api/events"
+	"sys3/api/logging"
+	"sys3/api/rate"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// GameConfig マッチングと対戦の進め方を管理する構造体
+type GameConfig struct {
+	QuestionsPerGame  int           // 1回の対戦で出題する問題数(問題が足りなければ少なくなる)
+	MatchTimeout      time.Duration // 対戦相手が見つかるまで待つ時間
+	QuestionDelay     time.Duration // 問題を送ってから回答権の受付を始めるまでの時間
+	BuzzTimeout       time.Duration // 回答権の受付を終えるまでの時間
+	AnswerTimeout     time.Duration // 回答権を得たプレイヤーの回答を待つ時間
+	NextQuestionDelay time.Duration // 次の問題を送るまでの時間
+}
+
+// defaultGameConfig 設定しない場合のマッチングと対戦の進め方
+var defaultGameConfig = GameConfig{
+	QuestionsPerGame:  5,
+	MatchTimeout:      30 * time.Second,
+	QuestionDelay:     1 * time.Second,
+	BuzzTimeout:       10 * time.Second,
+	AnswerTimeout:     5 * time.Second,
+	NextQuestionDelay: 3 * time.Second,
+}
+
+var gameConfig = defaultGameConfig
+
+// DefaultGameConfig 設定しない場合に使うマッチングと対戦の進め方を返す
+func DefaultGameConfig() GameConfig {
+	return defaultGameConfig
+}
+
+// SetGameConfig マッチングと対戦の進め方を設定する
+// サーバー起動前に呼び出すこと
+func SetGameConfig(config GameConfig) {
+	gameConfig = config
+}
+
 // Player プレイヤー情報を管理する構造体
 type Player struct {
 	ID       string
@@ -19,10 +60,86 @@ type Room struct {
 	ID          string
 	PlayerID    string // Player1のID
 	Player2ID   string
-	Player1Conn *websocket.Conn
-	Player2Conn *websocket.Conn
+	Player1Conn *Client
+	Player2Conn *Client
 	CreatedAt   time.Time
+	StartedAt   time.Time // 対戦が始まった日時(対戦履歴に記録する)
 	IsMatched   bool
+	GameType    string // レートを管理するゲームの種類
+	Casual      bool   // レートの変動しないカジュアル戦
+	PoolID      int    // 出題に使う問題のプール。0の場合は全ての問題から出題する
+	PoolName    string
+	// 対戦相手に表示するプロフィール(マッチング時に取得する)
+	Profiles map[string]account.PublicProfile
+
+	closed   atomic.Bool // 管理者により強制終了された
+	shutdown atomic.Bool // サーバーの停止により中止された
+	shared   atomic.Bool // 複数のインスタンスで共有する待ち行列に登録した
+
+	// 対戦相手が参加し、両プレイヤーにマッチングを通知し終えるとjoinRoomがクローズする
+	matched chan struct{}
+
+	// 対戦中のデータベース操作に使うコンテキスト
+	// 対戦が終わるか強制終了されるとキャンセルされる
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// 対戦の種類
+const (
+	ModeRanked = "ranked"
+	ModeCasual = "casual"
+)
+
+// Mode 対戦の種類を返す
+func (r *Room) Mode() string {
+	return modeOf(r.Casual)
+}
+
+func modeOf(casual bool) string {
+	if casual {
+		return ModeCasual
+	}
+	return ModeRanked
+}
+
+// logger 部屋のIDと対戦の種類を付けたロガーを返す
+// stopped 強制終了またはサーバーの停止で、結果を記録せずに終わらせる部屋かを返す
+func (r *Room) stopped() bool {
+	return r.closed.Load() || r.shutdown.Load()
+}
+
+// pause dの間待つ。途中で部屋のコンテキストがキャンセルされた場合はfalseを返す
+func (r *Room) pause(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// event 部屋の情報を付けた対戦のイベントを作る
+func (r *Room) event(eventType string, data map[string]interface{}) events.Event {
+	players := []string{r.PlayerID}
+	if r.Player2ID != "" {
+		players = append(players, r.Player2ID)
+	}
+	return events.Event{
+		Type:     eventType,
+		RoomID:   r.ID,
+		GameType: r.GameType,
+		Mode:     r.Mode(),
+		PoolID:   r.PoolID,
+		Players:  players,
+		Data:     data,
+	}
+}
+
+func (r *Room) logger() *slog.Logger {
+	return slog.With(logging.KeyRoomID, r.ID, "game_type", r.GameType, "mode", r.Mode())
 }
 
 // GameState ゲームの状態を管理する構造体
@@ -37,4 +154,82 @@ type Question struct {
 	QuestionText  string    `json:"question_text"`
 	CorrectAnswer string    `json:"correct_answer"`
 	Choices       [4]string `json:"choices"`
+	Contributor   string    `json:"contributor,omitempty"` // プレイヤーが投稿した問題の場合は投稿者
+	Version       int       `json:"-"`                     // 対戦記録に残す問題の版
+}
+
+// answerClaim 回答権を要求したプレイヤーと、そのリクエストのrequest_id
+// answerTimes 問題が出てから回答権を得るまでの時間をプレイヤーごとに記録する
+type answerTimes map[string][]time.Duration
+
+// averageMs 平均時間(ミリ秒)を返す。記録がなければ0
+func (a answerTimes) averageMs(playerID string) int {
+	times := a[playerID]
+	if len(times) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, t := range times {
+		total += t
+	}
+	return int((total / time.Duration(len(times))).Milliseconds())
+}
+
+type answerClaim struct {
+	PlayerID  string
+	RequestID string
+}
+
+// buzzLog 1問の間の回答権の要求を、取れなかったものも含めて記録する
+// 両プレイヤーのhandleAnswerRequestから同時に追加される
+type buzzLog struct {
+	mu       sync.Mutex
+	openedAt time.Time
+	buzzes   []rate.BuzzRecord
+}
+
+func newBuzzLog(openedAt time.Time) *buzzLog {
+	return &buzzLog{openedAt: openedAt}
+}
+
+func (l *buzzLog) add(playerID string, granted bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buzzes = append(l.buzzes, rate.BuzzRecord{
+		PlayerID:  playerID,
+		LatencyMs: int(time.Since(l.openedAt).Milliseconds()),
+		Granted:   granted,
+	})
+}
+
+// records 記録した要求のコピーを返す
+func (l *buzzLog) records() []rate.BuzzRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]rate.BuzzRecord(nil), l.buzzes...)
+}
+
+// GameOutcome 対戦の結果
+// 引き分けの場合、WinnerIDとLoserIDにはPlayer1とPlayer2のIDが入る
+type GameOutcome struct {
+	Result   rate.Outcome
+	WinnerID string
+	LoserID  string
+	Message  string
+}
+
+// payload game_endメッセージの"winner"に入れる内容
+// 従来のクライアントとの互換性のため、引き分けのidは"draw"にする
+func (o GameOutcome) payload() map[string]string {
+	if o.Result == rate.OutcomeDraw {
+		return map[string]string{
+			"id":      "draw",
+			"message": o.Message,
+		}
+	}
+	return map[string]string{
+		"id":       o.WinnerID,
+		"loser_id": o.LoserID,
+		"message":  o.Message,
+	}
 }
@@ -0,0 +1,85 @@
+package matchmaking
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginPolicy WebSocket接続を許可するオリジンを管理する構造体
+type OriginPolicy struct {
+	// 許可するオリジンの一覧
+	// "https://example.com" のように完全一致で指定するほか、
+	// "https://*.example.com" や "*.example.com" でサブドメインを許可できる
+	AllowedOrigins []string
+	// 開発モードでは全てのオリジンを許可する
+	DevMode bool
+}
+
+// デフォルトではフロントエンドの開発サーバーのみ許可する
+var originPolicy = OriginPolicy{
+	AllowedOrigins: []string{"http://localhost:3000"},
+}
+
+// SetOriginPolicy WebSocket接続のオリジンポリシーを設定する
+// サーバー起動前に呼び出すこと
+func SetOriginPolicy(policy OriginPolicy) {
+	originPolicy = policy
+}
+
+// checkOrigin upgrader.CheckOriginから呼び出されるオリジンチェック
+func checkOrigin(r *http.Request) bool {
+	return originPolicy.Allows(r.Header.Get("Origin"))
+}
+
+// Allows 指定されたオリジンが許可されているかを判定する
+func (p OriginPolicy) Allows(origin string) bool {
+	if p.DevMode {
+		return true
+	}
+
+	// Originヘッダーがない場合はブラウザ以外のクライアントなので許可する
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+
+	for _, allowed := range p.AllowedOrigins {
+		if matchOrigin(strings.ToLower(strings.TrimSpace(allowed)), scheme, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 許可リストの1エントリとオリジンを比較する
+func matchOrigin(allowed, scheme, host string) bool {
+	if allowed == "" {
+		return false
+	}
+	if allowed == "*" {
+		return true
+	}
+
+	// スキームが指定されていればスキームも一致させる
+	if i := strings.Index(allowed, "://"); i >= 0 {
+		if allowed[:i] != scheme {
+			return false
+		}
+		allowed = allowed[i+3:]
+	}
+	allowed = strings.TrimSuffix(allowed, "/")
+
+	// "*.example.com" はサブドメインのみにマッチさせる(example.com自体は含まない)
+	if strings.HasPrefix(allowed, "*.") {
+		suffix := allowed[1:]
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return allowed == host
+}
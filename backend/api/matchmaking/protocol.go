@@ -0,0 +1,70 @@
+package matchmaking
+
+// アプリケーション独自のWebSocketクローズコード
+// RFC 6455でアプリケーション用に予約されている4000〜4999を使う
+const (
+	CloseUnauthorized      = 4001 // 認証されていない
+	CloseProtocolError     = 4002 // 不正なメッセージを受信した
+	CloseServerShutdown    = 4003 // サーバーの停止
+	CloseKicked            = 4004 // サーバー側から切断された
+	CloseIdleTimeout       = 4005 // 一定時間操作がなかった
+	CloseRateLimited       = 4006 // メッセージの送信が多すぎる
+	CloseReadTimeout       = 4007 // Pongなどの受信が途絶えた
+	CloseTooSlow           = 4008 // 送信キューが溢れるほど読み取りが遅い
+	CloseLoggedInElsewhere = 4009 // 別の端末から接続された
+	CloseAlreadyConnected  = 4010 // 既に別の端末から接続している
+	CloseUnavailable       = 4011 // データベースに接続できず対戦を開始できない
+)
+
+// クライアントが分岐に使うエラーコード
+const (
+	ErrCodeUnauthorized      = "unauthorized"
+	ErrCodeProtocolError     = "protocol_error"
+	ErrCodeServerError       = "server_error"
+	ErrCodeServerClosing     = "server_shutdown"
+	ErrCodeKicked            = "kicked"
+	ErrCodeIdleTimeout       = "idle_timeout"
+	ErrCodeRateLimited       = "rate_limited"
+	ErrCodeReadTimeout       = "read_timeout"
+	ErrCodeTooSlow           = "too_slow"
+	ErrCodeLoggedInElsewhere = "logged_in_elsewhere"
+	ErrCodeAlreadyConnected  = "already_connected"
+	ErrCodeEmailNotVerified  = "email_not_verified"
+	ErrCodeUnavailable       = "service_unavailable"
+	ErrCodeAlreadyReported   = "already_reported"
+	ErrCodeRoomNotFound      = "room_not_found"
+	ErrCodeAlreadyQueued     = "already_queued"
+	ErrCodeNotYourTurn       = "not_your_turn"
+	ErrCodeServerBusy        = "server_busy"
+)
+
+// closeReasons クローズコードに対応するクローズ理由の文字列
+var closeReasons = map[int]string{
+	CloseUnauthorized:      ErrCodeUnauthorized,
+	CloseProtocolError:     ErrCodeProtocolError,
+	CloseServerShutdown:    ErrCodeServerClosing,
+	CloseKicked:            ErrCodeKicked,
+	CloseIdleTimeout:       ErrCodeIdleTimeout,
+	CloseRateLimited:       ErrCodeRateLimited,
+	CloseReadTimeout:       ErrCodeReadTimeout,
+	CloseTooSlow:           ErrCodeTooSlow,
+	CloseLoggedInElsewhere: ErrCodeLoggedInElsewhere,
+	CloseAlreadyConnected:  ErrCodeAlreadyConnected,
+	CloseUnavailable:       ErrCodeUnavailable,
+}
+
+// ErrorMessage クライアントに送信するエラーメッセージの共通形式
+type ErrorMessage struct {
+	Status  string `json:"status"`  // 常に"error"
+	Code    string `json:"code"`    // 機械判定用のエラーコード
+	Message string `json:"message"` // 表示用のメッセージ
+	ConnID  string `json:"conn_id"` // 送信した接続のID。問い合わせのときにサーバーのログと突き合わせる
+}
+
+func newErrorMessage(code, message string) ErrorMessage {
+	return ErrorMessage{
+		Status:  "error",
+		Code:    code,
+		Message: message,
+	}
+}
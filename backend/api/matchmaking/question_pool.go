@@ -0,0 +1,70 @@
+package matchmaking
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sys3/api/repository"
+	"sys3/api/season"
+	"time"
+)
+
+var (
+	// 出題に使う問題のプールの取得先
+	pools repository.PoolRepository
+	// 開催中のシーズンに設定された問題のプールを調べるためのシーズンの取得先
+	seasons repository.SeasonRepository
+)
+
+// SetPoolRepository 問題のプールの取得先を設定する
+// サーバー起動前に呼び出すこと
+func SetPoolRepository(repo repository.PoolRepository) {
+	pools = repo
+}
+
+// SetSeasonRepository シーズンの取得先を設定する
+// サーバー起動前に呼び出すこと
+func SetSeasonRepository(repo repository.SeasonRepository) {
+	seasons = repo
+}
+
+// errPoolEmpty 指定されたプールに出題できる問題がない
+var errPoolEmpty = errors.New("このプールには出題できる問題がありません")
+
+// resolvePool 部屋の出題に使う問題のプールを返す。プールを使わない場合はIDが0
+// ?pool=でプールのIDを指定でき、指定がなければ開催中のシーズンに設定されたプールを使う
+func resolvePool(r *http.Request) (repository.QuestionPool, error) {
+	ctx, cancel := repository.WithTimeout(r.Context())
+	defer cancel()
+
+	if v := r.URL.Query().Get("pool"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			return repository.QuestionPool{}, repository.ErrNotFound
+		}
+		pool, err := pools.GetPool(ctx, id)
+		if err != nil {
+			return repository.QuestionPool{}, err
+		}
+		if pool.QuestionCount == 0 {
+			return repository.QuestionPool{}, errPoolEmpty
+		}
+		return pool, nil
+	}
+
+	id, err := season.CurrentQuestionPool(ctx, seasons, time.Now())
+	if err != nil || id == 0 {
+		return repository.QuestionPool{}, err
+	}
+	pool, err := pools.GetPool(ctx, id)
+	if err != nil {
+		return repository.QuestionPool{}, err
+	}
+	if pool.QuestionCount == 0 {
+		// 問題を入れ忘れたプールで対戦できなくならないよう、全ての問題から出題する
+		slog.Warn("シーズンの問題のプールに問題がないため、全ての問題から出題します", "pool_id", id)
+		return repository.QuestionPool{}, nil
+	}
+	return pool, nil
+}
@@ -0,0 +1,62 @@
+package matchmaking
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitConfig 接続ごとの受信メッセージ数の制限を管理する構造体
+type RateLimitConfig struct {
+	Rate        float64 // 1秒あたりに補充されるトークン数
+	Burst       int     // 一度に送信できる最大メッセージ数
+	MaxWarnings int     // 警告を送る回数。これを超えると接続を切断する
+}
+
+var rateLimitConfig = RateLimitConfig{
+	Rate:        5,
+	Burst:       10,
+	MaxWarnings: 3,
+}
+
+// SetRateLimit 受信メッセージのレート制限を設定する
+// サーバー起動前に呼び出すこと
+func SetRateLimit(config RateLimitConfig) {
+	rateLimitConfig = config
+}
+
+// tokenBucket トークンバケット方式のレートリミッター
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:     rate,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Allow トークンを1つ消費できればtrueを返す
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,35 @@
+package matchmaking
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sys3/api/tracing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recoverSession handleGameSession でパニックが発生した場合に、プロセスを落とさずに対戦を無効にする
+// handleGameSession の中で defer して使う。両プレイヤーにserver_errorを通知し、部屋を片付ける
+// 結果は記録せず、レートも変動しない
+func recoverSession(room *Room, span trace.Span, logger *slog.Logger) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	logger.Error("対戦中にパニック発生", "panic", r, "stack", string(debug.Stack()))
+	tracing.Fail(span, fmt.Errorf("panic: %v", r))
+
+	const message = "サーバーで予期しないエラーが発生したため対戦を終了しました。この対戦の結果は記録されません"
+	for _, c := range []*Client{room.Player1Conn, room.Player2Conn} {
+		if c != nil {
+			c.SendError(ErrCodeServerError, message)
+			c.setRoom("")
+		}
+	}
+
+	roomsMutex.Lock()
+	delete(rooms, room.ID)
+	roomsMutex.Unlock()
+	room.cancel()
+}
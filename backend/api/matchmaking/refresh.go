@@ -0,0 +1,113 @@
+package matchmaking
+
+import (
+	"context"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// TokenExpiryWarning トークンの有効期限が切れる何秒前に通知するか
+const TokenExpiryWarning = time.Minute
+
+// setClaims 認証に使ったトークンの中身を記録する
+func (c *Client) setClaims(claims *auth.Claims) {
+	c.claims.Store(claims)
+}
+
+// SessionID 認証に使ったトークンのセッションID
+// セッションが無効になったときに切断するために使う
+func (c *Client) SessionID() string {
+	if claims := c.claims.Load(); claims != nil {
+		return claims.SessionID()
+	}
+	return ""
+}
+
+// tokenExpiresAt 現在のトークンの有効期限
+func (c *Client) tokenExpiresAt() time.Time {
+	claims := c.claims.Load()
+	if claims == nil || claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
+
+// handleTokenRefresh "token_refresh"メッセージで接続を切らずにトークンを更新する
+// クライアントは {"type": "token_refresh", "token": "<現在のトークン>"} を送信する
+// トークンとセッションを検証し直してから、有効期限を延長した新しいトークンを返す
+func (c *Client) handleTokenRefresh(message map[string]interface{}) {
+	requestID := requestIDOf(message)
+	current := c.claims.Load()
+	if current == nil {
+		c.Reply(requestID, newErrorMessage(ErrCodeUnauthorized, "認証が完了していません"))
+		return
+	}
+	// APIキーには有効期限がないので更新しない
+	if current.IsAPIKey() {
+		c.Reply(requestID, newErrorMessage(ErrCodeProtocolError, "APIキーは更新できません"))
+		return
+	}
+
+	ctx, cancel := repository.WithTimeout(context.Background())
+	defer cancel()
+
+	token, _ := message["token"].(string)
+	claims, err := auth.Authenticate(ctx, token)
+	if err != nil || claims.UserID() != current.UserID() {
+		c.logger().Warn("トークンの更新に失敗しました", logging.KeyMessageType, "token_refresh", logging.Err(err))
+		c.Reply(requestID, newErrorMessage(ErrCodeUnauthorized, "トークンを更新できませんでした"))
+		return
+	}
+
+	refreshed, expiresAt, err := auth.RefreshSession(ctx, claims)
+	if err != nil {
+		c.logger().Warn("トークンの更新に失敗しました", logging.KeyMessageType, "token_refresh", logging.Err(err))
+		c.Reply(requestID, newErrorMessage(ErrCodeUnauthorized, "トークンを更新できませんでした"))
+		return
+	}
+	validated, err := auth.ValidateToken(refreshed)
+	if err != nil {
+		c.Reply(requestID, newErrorMessage(ErrCodeServerError, "トークンを更新できませんでした"))
+		return
+	}
+	c.setClaims(validated)
+
+	c.Reply(requestID, map[string]interface{}{
+		"status":     "token_refreshed",
+		"token":      refreshed,
+		"expires_at": expiresAt,
+	})
+}
+
+// tokenLoop トークンの有効期限が近づいたら通知し、更新されないまま期限が切れたら切断する
+func (c *Client) tokenLoop() {
+	warned := time.Time{}
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			expiresAt := c.tokenExpiresAt()
+			if expiresAt.IsZero() {
+				continue
+			}
+			if now.After(expiresAt) {
+				c.logger().Info("トークンの有効期限が切れたため切断します")
+				c.CloseWithError(CloseUnauthorized, "トークンの有効期限が切れました")
+				return
+			}
+			if expiresAt.Sub(now) <= TokenExpiryWarning && !warned.Equal(expiresAt) {
+				warned = expiresAt
+				c.Write(map[string]interface{}{
+					"status":     "token_expiring",
+					"expires_at": expiresAt,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package matchmaking
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"sys3/api/logging"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// remoteConn 別のインスタンスに接続しているプレイヤーとの接続
+// プレイヤーが接続しているインスタンスとRedisのチャネルでフレームをやり取りする
+// Pingとクローズフレームもチャネルで送り、PongWaitの判定には相手のインスタンスからのハートビートを使う
+type remoteConn struct {
+	cluster *Cluster
+	roomID  string
+	sub     *redis.PubSub
+	frames  <-chan *redis.Message
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeSent atomic.Bool
+
+	// readPumpのゴルーチンだけが読み書きする
+	readDeadline time.Time
+	pongHandler  func(string) error
+}
+
+func (c *Cluster) newRemoteConn(roomID string) (*remoteConn, error) {
+	sub, err := c.subscribe(upChannel(roomID))
+	if err != nil {
+		return nil, err
+	}
+	return &remoteConn{
+		cluster: c,
+		roomID:  roomID,
+		sub:     sub,
+		frames:  sub.Channel(),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// remoteTimeout 読み取り期限を過ぎたことを表すエラー。readPumpはnet.Errorとして判定する
+type remoteTimeout struct{}
+
+func (remoteTimeout) Error() string   { return "中継の読み取りがタイムアウトしました" }
+func (remoteTimeout) Timeout() bool   { return true }
+func (remoteTimeout) Temporary() bool { return true }
+
+var _ net.Error = remoteTimeout{}
+
+func (rc *remoteConn) ReadMessage() (int, []byte, error) {
+	for {
+		msg, err := rc.next()
+		if err != nil {
+			return 0, nil, err
+		}
+		f, err := decodeFrame(msg)
+		if err != nil {
+			slog.Warn("中継されたフレームを読み取れません", logging.KeyRoomID, rc.roomID, logging.Err(err))
+			continue
+		}
+		switch f.Kind {
+		case frameMessage:
+			return f.Type, f.Data, nil
+		case frameHeartbeat:
+			// Pongと同じように読み取り期限を延長させる
+			if rc.pongHandler != nil {
+				rc.pongHandler("")
+			}
+		case frameClose:
+			rc.closeSent.Store(true)
+			return 0, nil, &websocket.CloseError{Code: f.Code}
+		}
+	}
+}
+
+// next 次に届いたフレームを読み取り期限まで待つ
+func (rc *remoteConn) next() (*redis.Message, error) {
+	var expired <-chan time.Time
+	if !rc.readDeadline.IsZero() {
+		timer := time.NewTimer(time.Until(rc.readDeadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case msg, ok := <-rc.frames:
+		if !ok {
+			return nil, net.ErrClosed
+		}
+		return msg, nil
+	case <-expired:
+		return nil, remoteTimeout{}
+	case <-rc.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (rc *remoteConn) WriteMessage(messageType int, data []byte) error {
+	return rc.cluster.publish(downChannel(rc.roomID), relayFrame{Kind: frameMessage, Type: messageType, Data: data})
+}
+
+// WriteControl Pingはハートビートとして送る。プレイヤーとのPing・Pongは接続しているインスタンスが行う
+func (rc *remoteConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	switch messageType {
+	case websocket.PingMessage:
+		return rc.cluster.publish(downChannel(rc.roomID), relayFrame{Kind: frameHeartbeat})
+	case websocket.CloseMessage:
+		code := websocket.CloseNormalClosure
+		if len(data) >= 2 {
+			code = int(binary.BigEndian.Uint16(data))
+		}
+		rc.closeSent.Store(true)
+		return rc.cluster.publish(downChannel(rc.roomID), relayFrame{Kind: frameClose, Code: code})
+	}
+	return nil
+}
+
+func (rc *remoteConn) SetReadLimit(limit int64) {}
+
+func (rc *remoteConn) SetReadDeadline(t time.Time) error {
+	rc.readDeadline = t
+	return nil
+}
+
+func (rc *remoteConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (rc *remoteConn) SetPongHandler(h func(appData string) error) {
+	rc.pongHandler = h
+}
+
+// Close 中継をやめる。クローズフレームを送っていなければ、相手のインスタンスにプレイヤーとの接続を閉じさせる
+func (rc *remoteConn) Close() error {
+	rc.closeOnce.Do(func() {
+		if !rc.closeSent.Swap(true) {
+			rc.cluster.publish(downChannel(rc.roomID), relayFrame{Kind: frameClose, Code: websocket.CloseGoingAway})
+		}
+		close(rc.done)
+		rc.sub.Close()
+	})
+	return nil
+}
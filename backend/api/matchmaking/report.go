@@ -0,0 +1,126 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sys3/api/logging"
+	"sys3/api/question"
+	"sys3/api/repository"
+)
+
+// 問題の報告の保存先
+var reports repository.ReportRepository
+
+// SetReportRepository 問題の報告の保存先を設定する
+// サーバー起動前に呼び出すこと
+func SetReportRepository(repo repository.ReportRepository) {
+	reports = repo
+}
+
+// shownQuestions 接続に出題した問題の版。報告された問題が実際に出題されたものかを確かめる
+type shownQuestions struct {
+	mu       sync.Mutex
+	roomID   string
+	gameType string
+	versions map[int]int
+
+	// 続けて送られた報告が同時に重複の確認をすり抜けないよう、1件ずつ処理する
+	reporting sync.Mutex
+}
+
+// record 部屋で出題した問題を記録する。別の部屋に移った場合はそれまでの記録を捨てる
+func (s *shownQuestions) record(roomID, gameType string, q Question) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roomID != roomID || s.versions == nil {
+		s.roomID, s.gameType, s.versions = roomID, gameType, make(map[int]int)
+	}
+	s.versions[q.ID] = q.Version
+}
+
+// lookup 出題した問題の版と部屋を返す。出題していなければokがfalse
+func (s *shownQuestions) lookup(questionID int) (version int, roomID, gameType string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	version, ok = s.versions[questionID]
+	return version, s.roomID, s.gameType, ok
+}
+
+// intOf JSONやMessagePackで受け取った数値をintにする
+func intOf(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), n == float64(int(n))
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint8:
+		return int(n), true
+	case uint16:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// handleReportQuestion "report_question"メッセージで報告された問題を記録する
+// {"type": "report_question", "question_id": 1, "reason": "wrong_answer", "comment": "..."}
+// ゲームの進行とは関係ないので、readPumpの中で受け取ってセッションには渡さない
+func (c *Client) handleReportQuestion(message map[string]interface{}) {
+	c.shown.reporting.Lock()
+	defer c.shown.reporting.Unlock()
+
+	requestID := requestIDOf(message)
+	if c.Guest {
+		c.Reply(requestID, newErrorMessage(ErrCodeUnauthorized, "問題を報告するにはログインが必要です"))
+		return
+	}
+	id, _ := intOf(message["question_id"])
+	version, roomID, gameType, ok := c.shown.lookup(id)
+	if !ok {
+		c.Reply(requestID, newErrorMessage(ErrCodeProtocolError, "この対戦で出題された問題ではありません"))
+		return
+	}
+	report := repository.QuestionReport{
+		QuestionID:      id,
+		QuestionVersion: version,
+		Reporter:        c.UserID,
+		RoomID:          roomID,
+		GameType:        gameType,
+	}
+	report.Reason, _ = message["reason"].(string)
+	report.Comment, _ = message["comment"].(string)
+
+	// 報告した対戦の部屋で記録する(次の対戦が始まっていることがあるため、接続の部屋IDは使わない)
+	logger := slog.With(logging.KeyConnID, c.ID, logging.KeyUserID, c.UserID, logging.KeyRoomID, roomID, logging.KeyMessageType, "report_question", "question_id", id)
+	ctx, cancel := repository.WithTimeout(context.Background())
+	defer cancel()
+	suspended, err := question.Report(ctx, questions, reports, report)
+	switch {
+	case errors.Is(err, question.ErrInvalidReport):
+		c.Reply(requestID, newErrorMessage(ErrCodeProtocolError, "理由にはwrong_answer、typo、offensiveのいずれかを指定してください"))
+		return
+	case errors.Is(err, repository.ErrConflict):
+		c.Reply(requestID, newErrorMessage(ErrCodeAlreadyReported, "この問題は既に報告しています"))
+		return
+	case err != nil:
+		logger.Error("問題の報告の保存エラー", logging.Err(err))
+		c.Reply(requestID, newErrorMessage(ErrCodeServerError, "報告を保存できませんでした"))
+		return
+	}
+	logger.Info("問題の報告", "question_version", version, "reason", report.Reason, "suspended", suspended)
+	c.Reply(requestID, map[string]interface{}{
+		"status":      "question_reported",
+		"question_id": id,
+	})
+}
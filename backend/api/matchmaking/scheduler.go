@@ -0,0 +1,111 @@
+package matchmaking
+
+import (
+	"sync/atomic"
+	"sys3/api/metrics"
+	"time"
+)
+
+// SchedulerConfig 1つのインスタンスで同時に進める対戦の数を管理する構造体
+// マッチングが急に増えても、対戦のゴルーチンとデータベースへの負荷が際限なく増えないようにする
+type SchedulerConfig struct {
+	MaxSessions  int           // 同時に進める対戦の上限。0の場合は制限しない
+	MaxQueued    int           // 上限に達している間、開始を待たせておける対戦の数。超えた対戦は開始せずに終える
+	QueueTimeout time.Duration // 開始を待たせておける最長時間
+}
+
+// defaultSchedulerConfig 設定しない場合の同時に進める対戦の数
+var defaultSchedulerConfig = SchedulerConfig{
+	MaxSessions:  500,
+	MaxQueued:    200,
+	QueueTimeout: 30 * time.Second,
+}
+
+var scheduler = newSessionScheduler(defaultSchedulerConfig)
+
+// DefaultSchedulerConfig 設定しない場合に使う同時に進める対戦の数を返す
+func DefaultSchedulerConfig() SchedulerConfig {
+	return defaultSchedulerConfig
+}
+
+// SetSchedulerConfig 同時に進める対戦の数を設定する
+// サーバー起動前に呼び出すこと
+func SetSchedulerConfig(config SchedulerConfig) {
+	scheduler = newSessionScheduler(config)
+}
+
+// sessionScheduler 対戦を始める前に枠を取らせ、上限に達している間は枠が空くまで待たせる
+type sessionScheduler struct {
+	config SchedulerConfig
+	slots  chan struct{} // 進行中の対戦の枠。上限がない場合はnil
+	queued atomic.Int64  // 枠が空くのを待っている対戦の数
+}
+
+func newSessionScheduler(config SchedulerConfig) *sessionScheduler {
+	s := &sessionScheduler{config: config}
+	if config.MaxSessions > 0 {
+		s.slots = make(chan struct{}, config.MaxSessions)
+	}
+	return s
+}
+
+// acquire 対戦の枠を取る。空いていなければ両プレイヤーにqueuedを送って待つ
+// 待っている対戦が多すぎる場合やQueueTimeoutまでに空かなかった場合はErrServerBusy
+// 待っている間に部屋が閉じられるか、どちらかのプレイヤーが切断した場合もエラーを返す
+// エラーを返さなかった場合は、対戦が終わったらreleaseを呼ぶこと
+func (s *sessionScheduler) acquire(room *Room) error {
+	if s.slots == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	position := s.queued.Add(1)
+	defer s.queued.Add(-1)
+	if int(position) > s.config.MaxQueued {
+		return ErrServerBusy
+	}
+	metrics.SessionsQueued.Inc()
+	defer metrics.SessionsQueued.Dec()
+
+	// positionは待ち始めた時点で、この対戦を含めて何組が待っているか
+	queuedMessage := map[string]interface{}{
+		"status":   "queued",
+		"room_id":  room.ID,
+		"position": position,
+		"message":  "サーバーが混み合っているため、対戦の開始を待っています",
+	}
+	room.Player1Conn.Write(queuedMessage)
+	room.Player2Conn.Write(queuedMessage)
+	room.logger().Info("対戦の枠が空くのを待ちます", "position", position)
+
+	timer := time.NewTimer(s.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrServerBusy
+	case <-room.ctx.Done():
+		return room.ctx.Err()
+	case <-room.Player1Conn.done:
+		return errClientClosed
+	case <-room.Player2Conn.done:
+		return errClientClosed
+	}
+}
+
+// release acquireで取った枠を返す
+func (s *sessionScheduler) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// waiting 枠が空くのを待っている対戦の数を返す
+func (s *sessionScheduler) waiting() int {
+	return int(s.queued.Load())
+}
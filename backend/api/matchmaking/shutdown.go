@@ -0,0 +1,87 @@
+package matchmaking
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// draining trueの間は新しい接続とマッチングを受け付けない
+var draining atomic.Bool
+
+// sessions 進行中の対戦。マッチングしたときに増やし、handleGameSessionが終わったときに減らす
+// drainingにしてからは増やさないので、Waitと同時にAddされることはない
+var sessions sync.WaitGroup
+
+// StopMatchmaking 新しい接続とマッチングの受付を止め、対戦相手を待っている部屋を閉じる
+// サーバーを停止するときに最初に呼ぶ。これ以降/readyzは503を返す
+func StopMatchmaking() {
+	roomsMutex.Lock()
+	draining.Store(true)
+	var waiting []*Room
+	for id, room := range rooms {
+		if !room.IsMatched {
+			delete(rooms, id)
+			room.cancel()
+			waiting = append(waiting, room)
+		}
+	}
+	roomsMutex.Unlock()
+
+	for _, room := range waiting {
+		cluster.remove(room)
+		room.Player1Conn.CloseWithError(CloseServerShutdown, "サーバーを停止するため、マッチングを中止しました")
+	}
+	slog.Info("マッチングの受付を停止しました", "waiting_rooms", len(waiting))
+}
+
+// WaitForSessions 進行中の対戦が全て終わるまで、最長timeoutまで待つ。全て終わればtrueを返す
+func WaitForSessions(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// StopSessions 進行中の対戦を結果を記録せずに中止させ、中止させた数を返す
+// 既に結果の保存を始めている対戦は、保存が終わってから終了する
+func StopSessions() int {
+	roomsMutex.Lock()
+	var playing []*Room
+	for _, room := range rooms {
+		if room.IsMatched && room.ctx.Err() == nil {
+			room.shutdown.Store(true)
+			room.cancel()
+			playing = append(playing, room)
+		}
+	}
+	roomsMutex.Unlock()
+
+	for _, room := range playing {
+		for _, c := range []*Client{room.Player1Conn, room.Player2Conn} {
+			c.CloseWithError(CloseServerShutdown, "サーバーを停止するため対戦を中止しました。この対戦の結果は記録されません")
+		}
+	}
+	if len(playing) > 0 {
+		slog.Warn("進行中の対戦を中止しました", "rooms", len(playing))
+	}
+	return len(playing)
+}
+
+// CloseConnections 残っている全ての接続を閉じ、閉じた数を返す
+func CloseConnections() int {
+	closed := 0
+	hub.Each(func(userID string, c *Client) {
+		c.CloseWithError(CloseServerShutdown, "サーバーを停止します")
+		closed++
+	})
+	return closed
+}
@@ -0,0 +1,48 @@
+package matchmaking
+
+import (
+	"log/slog"
+	"time"
+)
+
+// SlowLogConfig 対戦の処理がこれより時間がかかった場合に、警告としてログに記録する
+// 対戦が重く感じられる原因を探すため。0の項目は記録しない
+type SlowLogConfig struct {
+	QuestionFetch time.Duration // 対戦で出題する問題の取得
+	Write         time.Duration // 1メッセージの接続への書き込み
+	Finalize      time.Duration // 対戦結果とレートの保存
+}
+
+// defaultSlowLogConfig 設定しない場合の閾値
+var defaultSlowLogConfig = SlowLogConfig{
+	QuestionFetch: 200 * time.Millisecond,
+	Write:         1 * time.Second,
+	Finalize:      1 * time.Second,
+}
+
+var slowLogConfig = defaultSlowLogConfig
+
+// DefaultSlowLogConfig 設定しない場合に使う閾値を返す
+func DefaultSlowLogConfig() SlowLogConfig {
+	return defaultSlowLogConfig
+}
+
+// SetSlowLogConfig 遅い処理としてログに記録する閾値を設定する
+// サーバー起動前に呼び出すこと
+func SetSlowLogConfig(config SlowLogConfig) {
+	slowLogConfig = config
+}
+
+// logIfSlow startからの経過時間がthreshold以上であれば、処理の名前と一緒に警告を記録する
+// loggerには部屋や接続などを付けておき、どの対戦で遅くなったかが分かるようにする
+func logIfSlow(logger *slog.Logger, step string, start time.Time, threshold time.Duration, args ...any) {
+	elapsed := time.Since(start)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+	logger.Warn("処理に時間がかかっています", append([]any{
+		"step", step,
+		"duration_ms", elapsed.Milliseconds(),
+		"threshold_ms", threshold.Milliseconds(),
+	}, args...)...)
+}
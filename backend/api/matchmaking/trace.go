@@ -0,0 +1,69 @@
+package matchmaking
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var eventCounter uint64
+
+// newEventID サーバーから送信するメッセージごとのイベントIDを生成する
+// 起動時刻と連番を組み合わせるので、ログを時系列に並べやすい
+func newEventID() string {
+	n := atomic.AddUint64(&eventCounter, 1)
+	return fmt.Sprintf("ev-%x-%d", serverStartedAt, n)
+}
+
+var serverStartedAt = time.Now().Unix()
+
+// newConnID WebSocket接続ごとのIDを生成する
+// 複数のサーバーで動かしても重ならないように、連番ではなく乱数を使う
+func newConnID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "conn-" + hex.EncodeToString(b)
+}
+
+// requestIDOf クライアントから受信したメッセージのrequest_idを返す
+func requestIDOf(message map[string]interface{}) string {
+	id, _ := message["request_id"].(string)
+	return id
+}
+
+// withFields 送信するメッセージにフィールドを追加したコピーを返す
+// 空文字のフィールドは追加しない
+func withFields(msg interface{}, fields map[string]string) interface{} {
+	var out map[string]interface{}
+	switch m := msg.(type) {
+	case map[string]interface{}:
+		out = make(map[string]interface{}, len(m)+len(fields))
+		for k, v := range m {
+			out[k] = v
+		}
+	case map[string]string:
+		out = make(map[string]interface{}, len(m)+len(fields))
+		for k, v := range m {
+			out[k] = v
+		}
+	default:
+		// 構造体などは一度JSONを経由してmapに変換する
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return msg
+		}
+		if err := json.Unmarshal(data, &out); err != nil || out == nil {
+			return msg
+		}
+	}
+
+	for k, v := range fields {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
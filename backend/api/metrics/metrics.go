@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// メトリクス名の接頭辞
+const namespace = "quiz"
+
+// 部屋の状態
+const (
+	RoomWaiting = "waiting" // 対戦相手を待っている
+	RoomPlaying = "playing" // 対戦中
+)
+
+// 対戦の終わり方
+const (
+	MatchCompleted = "completed" // 全ての問題を出題し終えた
+	MatchAborted   = "aborted"   // データベースの障害や切断で続けられなくなった
+	MatchClosed    = "closed"    // 管理者により強制終了された
+	MatchShutdown  = "shutdown"  // サーバーの停止により中止された
+)
+
+// マッチングの待機の結果
+const (
+	WaitMatched  = "matched"
+	WaitTimedOut = "timeout"
+)
+
+// 全ての問題を出題し終えた対戦の勝敗
+const (
+	OutcomeDecided = "decided" // どちらかが勝った
+	OutcomeDraw    = "draw"    // 引き分け
+)
+
+// NoCategory カテゴリーのない問題に付けるラベル
+const NoCategory = "none"
+
+// region サーバーを動かしている地域。対戦ごとのメトリクスにラベルとして付ける
+var region string
+
+// SetRegion 対戦ごとのメトリクスに付ける地域を設定する。サーバー起動前に呼び出すこと
+func SetRegion(r string) {
+	region = r
+}
+
+var (
+	// ActiveConnections WebSocketで接続中のクライアントの数
+	ActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_connections",
+		Help:      "WebSocketで接続中のクライアントの数",
+	})
+
+	// MatchesStarted 始まった対戦の数
+	MatchesStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matches_started_total",
+		Help:      "始まった対戦の数",
+	}, []string{"game_type", "mode"})
+
+	// MatchesFinished 終わった対戦の数。resultは対戦の終わり方
+	MatchesFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matches_finished_total",
+		Help:      "終わった対戦の数",
+	}, []string{"game_type", "mode", "result"})
+
+	// MatchmakingWait 部屋を作ってから対戦相手が見つかる(またはタイムアウトする)までの時間
+	MatchmakingWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "matchmaking_wait_seconds",
+		Help:      "部屋を作ってから対戦相手が見つかるまでの時間",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 15, 20, 25, 30},
+	}, []string{"game_type", "mode", "outcome"})
+
+	// QuestionDelivery 問題を出題し始めてから両プレイヤーに送り終えるまでの時間
+	QuestionDelivery = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "question_delivery_seconds",
+		Help:      "問題を出題し始めてから両プレイヤーに送り終えるまでの時間",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	})
+
+	// DBQueryDuration データベースのクエリの実行時間。statementはSQLの最初のキーワード
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "データベースのクエリの実行時間",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"statement"})
+
+	// BuzzLatency 問題を出してから回答権を取るまでの時間。categoryは問題の最初のカテゴリー
+	BuzzLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "buzz_latency_seconds",
+		Help:      "問題を出してから回答権を取るまでの時間",
+		Buckets:   []float64{0.25, 0.5, 1, 1.5, 2, 3, 5, 7.5, 10, 15},
+	}, []string{"game_type", "category", "region"})
+
+	// MatchesCompleted 全ての問題を出題し終えた対戦の数。outcomeで引き分けの割合がわかる
+	MatchesCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matches_completed_total",
+		Help:      "全ての問題を出題し終えた対戦の数",
+	}, []string{"game_type", "mode", "region", "outcome"})
+
+	// RatingUpdateFailures 再試行しても保存できなかったランク戦の結果の数
+	RatingUpdateFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rating_update_failures_total",
+		Help:      "再試行しても保存できなかったランク戦の結果の数",
+	}, []string{"game_type"})
+
+	// SessionsQueued 同時に進める対戦の上限に達したため、開始を待っている対戦の数
+	SessionsQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_queued",
+		Help:      "同時に進める対戦の上限に達したため、開始を待っている対戦の数",
+	})
+)
+
+// roomStates 部屋の状態ごとの数を返す関数。matchmakingパッケージが設定する
+var (
+	roomStatesMu sync.RWMutex
+	roomStates   func() map[string]int
+)
+
+// SetRoomStates 部屋の状態ごとの数を返す関数を設定する。値は収集されるたびに数え直す
+func SetRoomStates(fn func() map[string]int) {
+	roomStatesMu.Lock()
+	roomStates = fn
+	roomStatesMu.Unlock()
+}
+
+// roomCollector 部屋の状態ごとの数を収集するコレクター
+type roomCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c roomCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c roomCollector) Collect(ch chan<- prometheus.Metric) {
+	roomStatesMu.RLock()
+	fn := roomStates
+	roomStatesMu.RUnlock()
+
+	counts := map[string]int{}
+	if fn != nil {
+		counts = fn()
+	}
+	// 部屋がない状態も0として出力する
+	for _, state := range []string{RoomWaiting, RoomPlaying} {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts[state]), state)
+	}
+}
+
+// Game 対戦の種類。進行中の対戦の数を数える単位
+type Game struct {
+	GameType string
+	Mode     string
+}
+
+// gamesInProgress 進行中の対戦の数を種類ごとに返す関数。matchmakingパッケージが設定する
+var (
+	gamesMu         sync.RWMutex
+	gamesInProgress func() map[Game]int
+)
+
+// SetGamesInProgress 進行中の対戦の数を種類ごとに返す関数を設定する。値は収集されるたびに数え直す
+func SetGamesInProgress(fn func() map[Game]int) {
+	gamesMu.Lock()
+	gamesInProgress = fn
+	gamesMu.Unlock()
+}
+
+// gameCollector 進行中の対戦の数を種類ごとに収集するコレクター
+type gameCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c gameCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c gameCollector) Collect(ch chan<- prometheus.Metric) {
+	gamesMu.RLock()
+	fn := gamesInProgress
+	gamesMu.RUnlock()
+	if fn == nil {
+		return
+	}
+	// 対戦が終わった種類は出力しないので、ダッシュボードでは値がない場合を0として扱うこと
+	for g, n := range fn() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), g.GameType, g.Mode, region)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(roomCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "rooms"), "状態ごとの部屋の数", []string{"state"}, nil),
+	})
+	prometheus.MustRegister(gameCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "games_in_progress"), "種類ごとの進行中の対戦の数", []string{"game_type", "mode", "region"}, nil),
+	})
+}
+
+// ObserveBuzz 回答権を取るまでの時間を記録する。categoriesは出題した問題のカテゴリー
+// 1問を複数のカテゴリーで数えると合計が合わなくなるので、最初のカテゴリーだけで数える
+func ObserveBuzz(gameType string, categories []string, d time.Duration) {
+	category := NoCategory
+	if len(categories) > 0 {
+		category = categories[0]
+	}
+	BuzzLatency.WithLabelValues(gameType, category, region).Observe(d.Seconds())
+}
+
+// CompleteMatch 全ての問題を出題し終えた対戦を勝敗と一緒に記録する
+func CompleteMatch(gameType, mode string, draw bool) {
+	outcome := OutcomeDecided
+	if draw {
+		outcome = OutcomeDraw
+	}
+	MatchesCompleted.WithLabelValues(gameType, mode, region, outcome).Inc()
+}
+
+// ObserveQuery クエリの実行時間を記録する。statementはselectやinsertなどのSQLの最初のキーワード
+func ObserveQuery(statement string, d time.Duration) {
+	DBQueryDuration.WithLabelValues(statement).Observe(d.Seconds())
+}
+
+// Handler Prometheus形式でメトリクスを返すハンドラー
+// tokenが空でなければ、Authorization: Bearer <token> を付けたリクエストだけに返す
+func Handler(token string) http.Handler {
+	h := promhttp.Handler()
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "認証が必要です", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,195 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sys3/api/account"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+)
+
+const (
+	pendingCookieName = "oauth_pending"
+	pendingTTL        = 10 * time.Minute
+)
+
+var successURL = "http://localhost:3000/"
+
+// SetSuccessURL ログイン完了後にリダイレクトする画面のURLを設定する
+func SetSuccessURL(url string) {
+	successURL = url
+}
+
+// LoginHandler 外部サービスのログイン画面にリダイレクトするハンドラー
+// CSRF対策のstateとPKCEのcode_verifierはコールバックまでCookieに保存しておく
+func LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := lookupProvider(mux.Vars(r)["provider"])
+		if !ok {
+			http.Error(w, "未対応の外部サービスです", http.StatusNotFound)
+			return
+		}
+
+		state, err := randomString()
+		if err != nil {
+			http.Error(w, "ログインの開始に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		pending := pendingLogin{State: state, Verifier: oauth2.GenerateVerifier()}
+		data, _ := json.Marshal(pending)
+		http.SetCookie(w, &http.Cookie{
+			Name:     pendingCookieName,
+			Value:    base64.RawURLEncoding.EncodeToString(data),
+			Path:     "/auth/oauth/",
+			MaxAge:   int(pendingTTL.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		url := provider.Config.AuthCodeURL(state, oauth2.AccessTypeOnline, oauth2.S256ChallengeOption(pending.Verifier))
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+}
+
+// CallbackHandler 外部サービスからのコールバックを受け取りログインさせるハンドラー
+// 連携済みのアカウントがあればそのアカウント、ログイン中であればそのアカウントに連携し、
+// どちらでもなければ新しくアカウントを作成する
+func CallbackHandler(links repository.OAuthRepository, users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := lookupProvider(mux.Vars(r)["provider"])
+		if !ok {
+			http.Error(w, "未対応の外部サービスです", http.StatusNotFound)
+			return
+		}
+
+		pending, err := readPending(r)
+		// 使い終わったCookieは削除する
+		http.SetCookie(w, &http.Cookie{Name: pendingCookieName, Path: "/auth/oauth/", MaxAge: -1})
+		if err != nil || r.URL.Query().Get("state") != pending.State {
+			http.Error(w, "ログインの状態が一致しません", http.StatusBadRequest)
+			return
+		}
+
+		token, err := provider.Config.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(pending.Verifier))
+		if err != nil {
+			slog.Warn("OAuthのトークン取得エラー", "provider", provider.Name, logging.Err(err))
+			http.Error(w, "外部サービスでの認証に失敗しました", http.StatusUnauthorized)
+			return
+		}
+		user, err := provider.FetchUser(r.Context(), provider.Config.Client(r.Context(), token))
+		if err != nil {
+			slog.Warn("OAuthのユーザー情報取得エラー", "provider", provider.Name, logging.Err(err))
+			http.Error(w, "外部サービスでの認証に失敗しました", http.StatusUnauthorized)
+			return
+		}
+
+		current, _ := auth.UserID(r)
+		username, err := linkAccount(r.Context(), links, users, provider.Name, user, current)
+		if err != nil {
+			slog.Error("アカウントの連携エラー", "provider", provider.Name, logging.Err(err))
+			http.Error(w, "アカウントの連携に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		// パスワードでのログインと同じセッションとトークンを発行する
+		if _, err := auth.StartSession(w, r, username); err != nil {
+			http.Error(w, "セッションの作成に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, successURL, http.StatusFound)
+	}
+}
+
+func readPending(r *http.Request) (pendingLogin, error) {
+	var pending pendingLogin
+	cookie, err := r.Cookie(pendingCookieName)
+	if err != nil {
+		return pending, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return pending, err
+	}
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return pending, err
+	}
+	if pending.State == "" || pending.Verifier == "" {
+		return pending, errors.New("ログインの状態がありません")
+	}
+	return pending, nil
+}
+
+// linkAccount 外部サービスのユーザーに対応するローカルのアカウント名を返す
+// currentはログイン中のユーザー(いなければ空)
+func linkAccount(ctx context.Context, links repository.OAuthRepository, users repository.UserRepository, provider string, user ExternalUser, current string) (string, error) {
+	username, err := links.LinkedUser(ctx, provider, user.ID)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return username, err
+	}
+
+	if current != "" {
+		err := links.LinkAccount(ctx, repository.OAuthLink{Provider: provider, ProviderUserID: user.ID, Username: current})
+		if errors.Is(err, repository.ErrConflict) {
+			// 同じ外部サービスのユーザーが同時に連携された
+			return links.LinkedUser(ctx, provider, user.ID)
+		}
+		if err != nil {
+			return "", err
+		}
+		return current, nil
+	}
+
+	// 外部サービスの名前がユーザー名として使えない場合は汎用の名前にする
+	base := strings.TrimSpace(user.Name)
+	if !account.IsAllowedUsername(base) {
+		base = "player"
+	}
+	candidate := base
+	for i := 0; i < 10; i++ {
+		taken, err := users.UsernameTaken(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			err := links.LinkAccount(ctx, repository.OAuthLink{Provider: provider, ProviderUserID: user.ID, Username: candidate, CreateUser: true})
+			if err == nil {
+				return candidate, nil
+			}
+			if !errors.Is(err, repository.ErrConflict) {
+				return "", err
+			}
+			// 同時に連携されたのでなければ、同じ名前のアカウントが先に作成されたので別の名前にする
+			if username, err := links.LinkedUser(ctx, provider, user.ID); err == nil {
+				return username, nil
+			}
+		}
+		suffix, err := randomString()
+		if err != nil {
+			return "", err
+		}
+		// ユーザー名の最大長(20文字)に収める
+		candidate = fmt.Sprintf("%.13s_%s", base, suffix[:6])
+	}
+	return "", errors.New("ユーザー名を決められませんでした")
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,55 @@
+package oauth
+
+import (
+	"context"
+	"sys3/api/repository"
+	"testing"
+)
+
+func TestLinkAccount(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	links := repository.NewMemoryOAuthRepository(users)
+	ctx := context.Background()
+	if err := users.Create(ctx, repository.NewUser{Username: "alice", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同じ名前のアカウントがあれば別の名前で作成する
+	username, err := linkAccount(ctx, links, users, "github", ExternalUser{ID: "1", Name: "Alice"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username == "alice" || username == "Alice" {
+		t.Errorf("username = %q, want a name other than alice", username)
+	}
+	if _, err := users.FindByUsername(ctx, username); err != nil {
+		t.Errorf("FindByUsername(%q) = %v", username, err)
+	}
+
+	// 連携済みのユーザーは同じアカウントでログインする
+	again, err := linkAccount(ctx, links, users, "github", ExternalUser{ID: "1", Name: "Alice"}, "")
+	if err != nil || again != username {
+		t.Errorf("second login = %q, %v, want %q", again, err, username)
+	}
+
+	// ログイン中ならそのアカウントに連携する
+	linked, err := linkAccount(ctx, links, users, "google", ExternalUser{ID: "2", Name: "someone"}, "alice")
+	if err != nil || linked != "alice" {
+		t.Errorf("link to current = %q, %v, want alice", linked, err)
+	}
+	if taken, _ := users.UsernameTaken(ctx, "someone"); taken {
+		t.Error("created an account while logged in")
+	}
+}
+
+func TestLinkAccountUsesGenericNameForInvalidName(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	links := repository.NewMemoryOAuthRepository(users)
+	username, err := linkAccount(context.Background(), links, users, "github", ExternalUser{ID: "1", Name: "  "}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "player" {
+		t.Errorf("username = %q, want player", username)
+	}
+}
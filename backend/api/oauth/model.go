@@ -0,0 +1,27 @@
+package oauth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// Provider OAuthでログインできる外部サービス
+type Provider struct {
+	Name   string
+	Config *oauth2.Config
+	// FetchUser アクセストークンを使って外部サービスのユーザー情報を取得する
+	FetchUser func(ctx context.Context, client httpDoer) (ExternalUser, error)
+}
+
+// ExternalUser 外部サービスのユーザー情報
+type ExternalUser struct {
+	ID   string // 外部サービスでのユーザーID(変更されない値)
+	Name string // 新しくアカウントを作るときのユーザー名の候補
+}
+
+// pendingLogin ログイン開始からコールバックまでの間、Cookieに保存しておく情報
+type pendingLogin struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"` // PKCEのcode_verifier
+}
@@ -0,0 +1,133 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+	"golang.org/x/oauth2/google"
+)
+
+// 対応している外部サービス
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+	ProviderLINE   = "line"
+)
+
+var lineEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://access.line.me/oauth2/v2.1/authorize",
+	TokenURL: "https://api.line.me/oauth2/v2.1/token",
+}
+
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]*Provider{}
+)
+
+// ProviderConfig 外部サービスごとの設定
+type ProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // コールバックのURL(例: https://example.com/auth/oauth/google/callback)
+}
+
+// RegisterProvider 外部サービスを有効にする
+// nameはProviderGoogle, ProviderGitHub, ProviderLINEのいずれか
+func RegisterProvider(name string, config ProviderConfig) error {
+	base := &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
+	}
+
+	var provider *Provider
+	switch name {
+	case ProviderGoogle:
+		base.Endpoint = google.Endpoint
+		base.Scopes = []string{"openid", "profile"}
+		provider = &Provider{Name: name, Config: base, FetchUser: fetchGoogleUser}
+	case ProviderGitHub:
+		base.Endpoint = github.Endpoint
+		base.Scopes = []string{"read:user"}
+		provider = &Provider{Name: name, Config: base, FetchUser: fetchGitHubUser}
+	case ProviderLINE:
+		base.Endpoint = lineEndpoint
+		base.Scopes = []string{"profile"}
+		provider = &Provider{Name: name, Config: base, FetchUser: fetchLINEUser}
+	default:
+		return fmt.Errorf("未対応の外部サービスです: %s", name)
+	}
+
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = provider
+	return nil
+}
+
+func lookupProvider(name string) (*Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// getJSON urlにGETしてレスポンスのJSONをvに読み込む
+func getJSON(ctx context.Context, client httpDoer, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ユーザー情報の取得に失敗しました: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func fetchGoogleUser(ctx context.Context, client httpDoer) (ExternalUser, error) {
+	var info struct {
+		Sub  string `json:"sub"`
+		Name string `json:"name"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return ExternalUser{}, err
+	}
+	return ExternalUser{ID: info.Sub, Name: info.Name}, nil
+}
+
+func fetchGitHubUser(ctx context.Context, client httpDoer) (ExternalUser, error) {
+	var info struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &info); err != nil {
+		return ExternalUser{}, err
+	}
+	return ExternalUser{ID: strconv.FormatInt(info.ID, 10), Name: info.Login}, nil
+}
+
+func fetchLINEUser(ctx context.Context, client httpDoer) (ExternalUser, error) {
+	var info struct {
+		UserID      string `json:"userId"`
+		DisplayName string `json:"displayName"`
+	}
+	if err := getJSON(ctx, client, "https://api.line.me/v2/profile", &info); err != nil {
+		return ExternalUser{}, err
+	}
+	return ExternalUser{ID: info.UserID, Name: info.DisplayName}, nil
+}
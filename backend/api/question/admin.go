@@ -0,0 +1,292 @@
+package question
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sys3/api/audit"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// questionID URLの{id}から問題IDを取得する
+func questionID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	return id, err == nil && id > 0
+}
+
+// ListQuestionsHandler 削除されていない問題を全て返す管理者用ハンドラー
+// ?status=を指定した場合はその状態の問題だけを返す
+// ?category=と?tag=で名前を指定すると、そのカテゴリー・タグが付いた問題だけを返す
+func ListQuestionsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var list []Question
+		var err error
+		if status := r.URL.Query().Get("status"); status != "" {
+			if !isValidStatus(status) {
+				http.Error(w, "無効な状態です", http.StatusBadRequest)
+				return
+			}
+			list, err = questions.ListByStatus(r.Context(), status)
+		} else {
+			list, err = questions.List(r.Context())
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if category := r.URL.Query().Get("category"); category != "" {
+			list = filterQuestions(list, func(q Question) bool { return hasLabel(q.Categories, category) })
+		}
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			list = filterQuestions(list, func(q Question) bool { return hasLabel(q.Tags, tag) })
+		}
+		if list == nil {
+			list = []Question{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// GetQuestionByIDHandler 1問を返す管理者用ハンドラー
+func GetQuestionByIDHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		q, err := questions.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+// CreateQuestionHandler 問題を追加する管理者用ハンドラー。作成した問題を返す
+// statusを省略した場合は承認済みとして追加する。activate_atが先の日時なら、その日時まで出題を待機する
+func CreateQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q Question
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		q, err := Validate(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Status == "" {
+			q.Status = repository.QuestionApproved
+		}
+		if !isValidStatus(q.Status) {
+			http.Error(w, "無効な状態です", http.StatusBadRequest)
+			return
+		}
+		if q.Status == repository.QuestionApproved {
+			q.Status = scheduledStatus(q, time.Now())
+		}
+		q.Source = repository.QuestionSourceAdmin
+		q.CreatorUsername, _ = auth.UserID(r)
+
+		id, err := questions.Create(r.Context(), q)
+		if err != nil {
+			http.Error(w, "問題の保存に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		q.ID = int(id)
+		if created, err := questions.Get(r.Context(), q.ID); err == nil {
+			q = created
+		}
+		audit.Annotate(r, nil, q)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+// UpdateQuestionHandler 問題の内容を書き換える管理者用ハンドラー。変更後の問題を返す
+// 作成者と審査の状態は変更しない。変更前の内容は操作の記録と問題の版に残す
+func UpdateQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		var q Question
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		q, err := Validate(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		before, err := questions.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		q.ID = id
+		q.CreatorUsername = before.CreatorUsername
+		q.Status = before.Status
+		editor, _ := auth.UserID(r)
+		err = questions.Update(r.Context(), q, editor)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		// 版やカテゴリーも含めた保存後の内容を返す
+		if after, err := questions.Get(r.Context(), id); err == nil {
+			q = after
+		}
+		audit.Annotate(r, before, q)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+// QuestionVersionsHandler 問題の編集履歴を古い版から順に返す管理者用ハンドラー
+func QuestionVersionsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		versions, err := questions.Versions(r.Context(), id)
+		if err != nil {
+			http.Error(w, "編集履歴の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if len(versions) == 0 {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+	}
+}
+
+// DeleteQuestionHandler 問題を削除する管理者用ハンドラー
+// 過去の対戦記録から参照できるように、行は残して出題の対象から外す
+func DeleteQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		err := questions.Delete(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の削除に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		audit.Annotate(r, map[string]bool{"deleted": false}, map[string]bool{"deleted": true})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RestoreQuestionHandler 削除した問題を元に戻す管理者用ハンドラー
+func RestoreQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		err := questions.Restore(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "削除済みの問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の復元に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		audit.Annotate(r, map[string]bool{"deleted": true}, map[string]bool{"deleted": false})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeletedQuestionsHandler 削除済みの問題を返す管理者用ハンドラー
+func DeletedQuestionsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := questions.ListDeleted(r.Context())
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []Question{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// QuestionStatsHandler 問題ごとの正解率や回答時間の集計を返す管理者用ハンドラー
+// 難しすぎる・易しすぎる問題を見つけて調整するために使う
+func QuestionStatsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := questions.Stats(r.Context())
+		if err != nil {
+			http.Error(w, "集計の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// QuestionStatsByIDHandler 1問の回答の集計を返す管理者用ハンドラー
+func QuestionStatsByIDHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		stats, err := questions.StatsByID(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "集計の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	}
+}
@@ -0,0 +1,145 @@
+package question
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// Calibration 回答の集計から問題の難易度を計算する設定
+type Calibration struct {
+	MinSamples int           // 出題回数がこれより少ない問題は計算しない
+	TimeWeight float64       // スコアのうち回答時間が占める割合(0〜1)。残りは不正解の割合
+	SlowAnswer time.Duration // 平均回答時間がこの時間以上なら、回答時間の面では最も難しいとみなす
+	EasyBelow  float64       // スコアがこれ未満なら易しい
+	HardAbove  float64       // スコアがこれより大きければ難しい
+}
+
+var calibration = Calibration{
+	MinSamples: 20,
+	TimeWeight: 0.3,
+	SlowAnswer: 8 * time.Second,
+	EasyBelow:  0.35,
+	HardAbove:  0.65,
+}
+
+// SetCalibration 難易度の計算の設定を変更する
+func SetCalibration(c Calibration) {
+	calibration = c
+}
+
+// CalibrationResult 難易度を計算し直した結果
+type CalibrationResult struct {
+	Checked int                `json:"checked"` // 出題回数が足りて計算した問題の数
+	Skipped int                `json:"skipped"` // 出題回数が足りなかった問題の数
+	Changed []DifficultyChange `json:"changed"`
+}
+
+// DifficultyChange 難易度が変わった問題
+type DifficultyChange struct {
+	QuestionID int     `json:"question_id"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Score      float64 `json:"score"`
+}
+
+// difficultyScore 集計から0(易しい)〜1(難しい)のスコアを計算する
+// 出題されたのに誰も正解しなかった回も不正解として数える
+func (c Calibration) difficultyScore(s repository.QuestionStats) float64 {
+	miss := 1 - float64(s.TimesCorrect)/float64(s.TimesShown)
+	slow := 0.0
+	if c.SlowAnswer > 0 {
+		slow = math.Min(s.AvgAnswerMs/float64(c.SlowAnswer.Milliseconds()), 1)
+	}
+	return (1-c.TimeWeight)*miss + c.TimeWeight*slow
+}
+
+// difficultyOf スコアを難易度に変換する
+func (c Calibration) difficultyOf(score float64) string {
+	switch {
+	case score < c.EasyBelow:
+		return repository.DifficultyEasy
+	case score > c.HardAbove:
+		return repository.DifficultyHard
+	default:
+		return repository.DifficultyNormal
+	}
+}
+
+// Calibrate 出題回数が足りている問題の難易度を回答の集計から計算し直す
+// 難易度もスコアも変わらない問題は書き込まない
+func Calibrate(ctx context.Context, questions repository.QuestionRepository, c Calibration) (CalibrationResult, error) {
+	result := CalibrationResult{Changed: []DifficultyChange{}}
+	list, err := questions.List(ctx)
+	if err != nil {
+		return result, err
+	}
+	stats, err := questions.Stats(ctx)
+	if err != nil {
+		return result, err
+	}
+	byID := make(map[int]repository.QuestionStats, len(stats))
+	for _, s := range stats {
+		byID[s.QuestionID] = s
+	}
+
+	for _, q := range list {
+		s := byID[q.ID]
+		if s.TimesShown == 0 || s.TimesShown < c.MinSamples {
+			result.Skipped++
+			continue
+		}
+		result.Checked++
+		// 保存時の丸めで毎回書き込まないよう、小数点以下4桁にそろえる
+		score := math.Round(c.difficultyScore(s)*10000) / 10000
+		difficulty := c.difficultyOf(score)
+		if q.Difficulty == difficulty && q.DifficultyScore != nil && *q.DifficultyScore == score {
+			continue
+		}
+		if err := questions.SetDifficulty(ctx, q.ID, difficulty, score); err != nil {
+			return result, err
+		}
+		if q.Difficulty != difficulty {
+			result.Changed = append(result.Changed, DifficultyChange{QuestionID: q.ID, From: q.Difficulty, To: difficulty, Score: score})
+		}
+	}
+	return result, nil
+}
+
+// StartCalibration 問題の難易度を定期的に計算し直すゴルーチンを起動する
+func StartCalibration(questions repository.QuestionRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			result, err := Calibrate(ctx, questions, calibration)
+			cancel()
+			if err != nil {
+				slog.Error("問題の難易度の計算エラー", logging.Err(err))
+				continue
+			}
+			if len(result.Changed) > 0 {
+				slog.Info("問題の難易度を更新しました", "checked", result.Checked, "changed", len(result.Changed))
+			}
+		}
+	}()
+}
+
+// CalibrateHandler 問題の難易度を今すぐ計算し直す管理者用ハンドラー。難易度が変わった問題を返す
+func CalibrateHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := Calibrate(r.Context(), questions, calibration)
+		if err != nil {
+			http.Error(w, "難易度の計算に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,302 @@
+package question
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sys3/api/audit"
+	"sys3/api/repository"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// カテゴリー・タグの名前の長さの上限(db.sqlのVARCHAR(100))
+const maxLabelLength = 100
+
+// labelID URLの{id}からカテゴリー・タグ・問題のプールのIDを取得する
+func labelID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	return id, err == nil && id > 0
+}
+
+// labelName カテゴリー・タグ・問題のプールの名前の前後の空白を取り除いて確認する
+func labelName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("名前を入力してください")
+	}
+	if utf8.RuneCountInString(name) > maxLabelLength {
+		return "", errors.New("名前が長すぎます")
+	}
+	return name, nil
+}
+
+// ListCategoriesHandler カテゴリーを名前の順に返すハンドラー
+func ListCategoriesHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := categories.Categories(r.Context())
+		if err != nil {
+			http.Error(w, "カテゴリーの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// CreateCategoryHandler カテゴリーを追加する管理者用ハンドラー
+func CreateCategoryHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var c repository.Category
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		name, err := labelName(c.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c = repository.Category{Name: name, Description: strings.TrimSpace(c.Description)}
+
+		id, err := categories.CreateCategory(r.Context(), c)
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "同じ名前のカテゴリーがあります", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "カテゴリーの保存に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		c.ID = id
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// UpdateCategoryHandler カテゴリーの名前と説明を変更する管理者用ハンドラー
+func UpdateCategoryHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なカテゴリーIDです", http.StatusBadRequest)
+			return
+		}
+		var c repository.Category
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		name, err := labelName(c.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c = repository.Category{ID: id, Name: name, Description: strings.TrimSpace(c.Description)}
+
+		err = categories.UpdateCategory(r.Context(), c)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "カテゴリーが見つかりません", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "同じ名前のカテゴリーがあります", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "カテゴリーの更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// DeleteCategoryHandler カテゴリーを削除する管理者用ハンドラー。問題との紐付けも削除する
+func DeleteCategoryHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なカテゴリーIDです", http.StatusBadRequest)
+			return
+		}
+		err := categories.DeleteCategory(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "カテゴリーが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "カテゴリーの削除に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListTagsHandler タグを名前の順に返すハンドラー
+func ListTagsHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := categories.Tags(r.Context())
+		if err != nil {
+			http.Error(w, "タグの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// CreateTagHandler タグを追加する管理者用ハンドラー
+func CreateTagHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var t repository.Tag
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		name, err := labelName(t.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t = repository.Tag{Name: name}
+
+		id, err := categories.CreateTag(r.Context(), name)
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "同じ名前のタグがあります", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "タグの保存に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		t.ID = id
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// DeleteTagHandler タグを削除する管理者用ハンドラー。問題との紐付けも削除する
+func DeleteTagHandler(categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なタグIDです", http.StatusBadRequest)
+			return
+		}
+		err := categories.DeleteTag(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "タグが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "タグの削除に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type labelsRequest struct {
+	CategoryIDs []int `json:"category_ids"`
+	TagIDs      []int `json:"tag_ids"`
+}
+
+// SetQuestionLabelsHandler 問題のカテゴリーとタグを置き換える管理者用ハンドラー
+// 本文は{"category_ids": [1, 2], "tag_ids": [3]}。変更後の問題を返す
+func SetQuestionLabelsHandler(questions repository.QuestionRepository, categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		var req labelsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+
+		// 存在しないIDを紐付けないように、先に一覧と照らし合わせる
+		knownCategories, err := categories.Categories(r.Context())
+		if err != nil {
+			http.Error(w, "カテゴリーの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		knownTags, err := categories.Tags(r.Context())
+		if err != nil {
+			http.Error(w, "タグの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		categoryIDs := make(map[int]bool, len(knownCategories))
+		for _, c := range knownCategories {
+			categoryIDs[c.ID] = true
+		}
+		tagIDs := make(map[int]bool, len(knownTags))
+		for _, t := range knownTags {
+			tagIDs[t.ID] = true
+		}
+		for _, cid := range req.CategoryIDs {
+			if !categoryIDs[cid] {
+				http.Error(w, "存在しないカテゴリーです: "+strconv.Itoa(cid), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, tid := range req.TagIDs {
+			if !tagIDs[tid] {
+				http.Error(w, "存在しないタグです: "+strconv.Itoa(tid), http.StatusBadRequest)
+				return
+			}
+		}
+
+		before, err := questions.Get(r.Context(), id)
+		if err == nil {
+			err = questions.SetLabels(r.Context(), id, req.CategoryIDs, req.TagIDs)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "カテゴリーとタグの保存に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		after, err := questions.Get(r.Context(), id)
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		audit.Annotate(r, before, after)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(after)
+	}
+}
+
+// hasLabel 名前の一覧にnameが含まれるかを返す
+func hasLabel(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// filterQuestions keepがtrueを返す問題だけを残す
+func filterQuestions(list []Question, keep func(Question) bool) []Question {
+	var kept []Question
+	for _, q := range list {
+		if keep(q) {
+			kept = append(kept, q)
+		}
+	}
+	return kept
+}
@@ -1,16 +1,17 @@
 package question
 
 import (
-	"database/sql"
 	"encoding/json"
 	"net/http"
+	"sys3/api/auth"
+	"sys3/api/repository"
 )
 
-func MakeQuestionHandler(db *sql.DB) http.HandlerFunc {
+func MakeQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// ユーザー認証の確認
-		cookie, err := r.Cookie("username")
-		if err != nil {
+		username, ok := auth.UserID(r)
+		if !ok {
 			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
 			return
 		}
@@ -22,27 +23,8 @@ func MakeQuestionHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// バリデーション
-		if len(question.Choices) != 4 {
-			http.Error(w, "選択肢は4つ必要です", http.StatusBadRequest)
-			return
-		}
-
-		// データベースに問題を保存
-		_, err = db.Exec(
-			"INSERT INTO questions (creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-			cookie.Value,
-			question.QuestionText,
-			question.CorrectAnswer,
-			question.Choices[0],
-			question.Choices[1],
-			question.Choices[2],
-			question.Choices[3],
-			question.Explanation,
-		)
-
-		if err != nil {
-			http.Error(w, "問題の保存に失敗しました", http.StatusInternalServerError)
+		// プレイヤーの投稿として検証・保存する
+		if _, ok := submit(w, r, questions, username, question); !ok {
 			return
 		}
 
@@ -53,54 +35,20 @@ func MakeQuestionHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// とりあえずいったん全ての問題を取得するハンドラー
-func GetQuestionHandler(db *sql.DB) http.HandlerFunc {
+// とりあえずいったん承認済みの問題を全て取得するハンドラー
+func GetQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// レスポンスヘッダーの設定
 		w.Header().Set("Content-Type", "application/json")
 
-		// データベースから問題を取得
-		rows, err := db.Query(`
-			SELECT id, creator_username, question_text, correct_answer, 
-			       choice1, choice2, choice3, choice4, explanation 
-			FROM questions`)
+		// 保存先から問題を取得
+		list, err := questions.ListByStatus(r.Context(), repository.QuestionApproved)
 		if err != nil {
 			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		// 問題のスライスを作成
-		var questions []Question
-		for rows.Next() {
-			var q Question
-			var choices [4]string
-			err := rows.Scan(
-				&q.ID,
-				&q.CreatorUsername,
-				&q.QuestionText,
-				&q.CorrectAnswer,
-				&choices[0],
-				&choices[1],
-				&choices[2],
-				&choices[3],
-				&q.Explanation,
-			)
-			if err != nil {
-				http.Error(w, "データの読み取りに失敗しました", http.StatusInternalServerError)
-				return
-			}
-			q.Choices = choices[:]
-			questions = append(questions, q)
-		}
-
-		// エラーチェック
-		if err = rows.Err(); err != nil {
-			http.Error(w, "データの読み取り中にエラーが発生しました", http.StatusInternalServerError)
-			return
-		}
 
 		// 結果をJSONで返す
-		json.NewEncoder(w).Encode(questions)
+		json.NewEncoder(w).Encode(list)
 	}
 }
@@ -0,0 +1,278 @@
+package question
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+)
+
+// 一度に取り込める量の上限
+const (
+	maxImportRows = 5000
+	maxImportSize = 10 << 20
+)
+
+// 取り込むファイルの形式
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// ImportRow ファイルから読み取った1問分の行
+type ImportRow struct {
+	Row      int // CSVは見出しを除いた1始まりの行番号、JSONは配列の1始まりの位置
+	Question Question
+	Err      error // 読み取りや検証に失敗した場合のエラー
+}
+
+// ImportResult 1行ごとの取り込み結果
+type ImportResult struct {
+	Row          int    `json:"row"`
+	ID           int    `json:"id,omitempty"` // 保存した問題のID。ドライランでは0
+	QuestionText string `json:"question_text,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ImportReport 取り込み全体の集計
+type ImportReport struct {
+	DryRun   bool           `json:"dry_run"`
+	Total    int            `json:"total"`
+	Valid    int            `json:"valid"`    // 検証に通った行数
+	Invalid  int            `json:"invalid"`  // 検証に失敗した行数
+	Imported int            `json:"imported"` // 保存した行数
+	Failed   int            `json:"failed"`   // 検証には通ったが保存に失敗した行数
+	Rows     []ImportResult `json:"rows"`
+}
+
+// DetectFormat 指定された形式、Content-Type、ファイル名の順に取り込む形式を決める
+func DetectFormat(format, contentType, filename string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			switch mediaType {
+			case "text/csv":
+				format = FormatCSV
+			case "application/json":
+				format = FormatJSON
+			}
+		}
+	}
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case FormatCSV, FormatJSON:
+		return format, nil
+	case "":
+		return "", errors.New("ファイルの形式を指定してください(csv, json)")
+	}
+	return "", fmt.Errorf("対応していない形式です: %s", format)
+}
+
+// ParseImport 問題のファイルを1問ずつの行に分解する
+// 行ごとの誤りはImportRow.Errに入れて読み取りを続ける。ファイル全体が読めない場合のみエラーを返す
+//
+// CSVは1行目を見出しとし、question_text, correct_answer, choice1〜choice4, explanation(省略可)の列を持つ
+// JSONはQuestionと同じ形式のオブジェクトの配列とする
+func ParseImport(r io.Reader, format string) ([]ImportRow, error) {
+	var rows []ImportRow
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(r)
+	case FormatJSON:
+		rows, err = parseJSON(r)
+	default:
+		return nil, fmt.Errorf("対応していない形式です: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("問題が1つも含まれていません")
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("一度に取り込めるのは%d問までです", maxImportRows)
+	}
+	return rows, nil
+}
+
+var csvColumns = []string{"question_text", "correct_answer", "choice1", "choice2", "choice3", "choice4"}
+
+func parseCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // 列数の誤りは行ごとに報告する
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("見出し行を読み取れません: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	required := 0 // 必須の列を全て含むのに必要な列数
+	for _, name := range csvColumns {
+		i, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("見出し行に%s列がありません", name)
+		}
+		required = max(required, i+1)
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var rows []ImportRow
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		row := ImportRow{Row: n}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			row.Err = fmt.Errorf("行を読み取れません: %v", parseErr.Err)
+			rows = append(rows, row)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < required {
+			row.Err = fmt.Errorf("列が足りません(%d列/%d列)", len(record), required)
+		}
+		row.Question = Question{
+			QuestionText:  field(record, "question_text"),
+			CorrectAnswer: field(record, "correct_answer"),
+			Choices: []string{
+				field(record, "choice1"),
+				field(record, "choice2"),
+				field(record, "choice3"),
+				field(record, "choice4"),
+			},
+			Explanation: field(record, "explanation"),
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseJSON(r io.Reader) ([]ImportRow, error) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("問題の配列を読み取れません: %w", err)
+	}
+	rows := make([]ImportRow, len(items))
+	for i, item := range items {
+		rows[i].Row = i + 1
+		if err := json.Unmarshal(item, &rows[i].Question); err != nil {
+			rows[i].Err = errors.New("問題の形式が正しくありません")
+		}
+	}
+	return rows, nil
+}
+
+// Import 検証に通った行を保存し、行ごとの結果を返す
+// ドライランでは検証だけを行い何も保存しない。ファイル内で問題文が重複する行は後の方を誤りとする
+func Import(ctx context.Context, questions repository.QuestionRepository, rows []ImportRow, creator string, dryRun bool) ImportReport {
+	report := ImportReport{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Rows:   make([]ImportResult, 0, len(rows)),
+	}
+	seen := make(map[string]int, len(rows))
+
+	for _, row := range rows {
+		result := ImportResult{Row: row.Row}
+		q, err := row.Question, row.Err
+		if err == nil {
+			q, err = Validate(q)
+		}
+		if err == nil {
+			if first, ok := seen[q.QuestionText]; ok {
+				err = fmt.Errorf("%d行目と同じ問題文です", first)
+			} else {
+				seen[q.QuestionText] = row.Row
+			}
+		}
+		result.QuestionText = q.QuestionText
+		if err != nil {
+			result.Error = err.Error()
+			report.Invalid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+		report.Valid++
+
+		if !dryRun {
+			q.CreatorUsername = creator
+			q.Status = repository.QuestionApproved
+			q.Source = repository.QuestionSourceImport
+			id, err := questions.Create(ctx, q)
+			if err != nil {
+				slog.Error("問題の取り込みエラー", "row", row.Row, logging.Err(err))
+				result.Error = "問題の保存に失敗しました"
+				report.Failed++
+			} else {
+				result.ID = int(id)
+				report.Imported++
+			}
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	return report
+}
+
+// ImportQuestionsHandler CSVまたはJSONのファイルから問題をまとめて追加する管理者用ハンドラー
+// 本文にファイルの内容をそのまま送る。形式は?format=またはContent-Typeで指定する
+// ?dry_run=trueの場合は検証結果だけを返す
+func ImportQuestionsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := DetectFormat(r.URL.Query().Get("format"), r.Header.Get("Content-Type"), "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		rows, err := ParseImport(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "ファイルが大きすぎます", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		creator, _ := auth.UserID(r)
+		report := Import(r.Context(), questions, rows, creator, dryRun)
+		if !dryRun {
+			slog.Info("問題を取り込みました", logging.KeyUserID, creator, "imported", report.Imported, "invalid", report.Invalid, "failed", report.Failed)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -1,10 +1,6 @@
 package question
 
-type Question struct {
-	ID              int      `json:"id"`
-	CreatorUsername string   `json:"creator_username"`
-	QuestionText    string   `json:"question_text"`
-	CorrectAnswer   string   `json:"correct_answer"`
-	Choices         []string `json:"choices"`
-	Explanation     string   `json:"explanation"`
-}
+import "sys3/api/repository"
+
+// Question 問題。保存先との間でそのまま受け渡す
+type Question = repository.Question
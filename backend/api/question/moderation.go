@@ -0,0 +1,213 @@
+package question
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sys3/api/audit"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"time"
+)
+
+// transitions 審査の操作と、その操作ができる変更前の状態
+var transitions = map[string][]string{
+	// 作成者が審査を依頼する。却下された問題も直して依頼し直せる
+	repository.QuestionPendingReview: {repository.QuestionDraft, repository.QuestionRejected},
+	// 一度却下した問題も承認し直せる。報告で停止した問題は、直すか問題ないと判断したら承認し直す
+	repository.QuestionApproved: {repository.QuestionPendingReview, repository.QuestionRejected, repository.QuestionSuspended},
+	// 承認済みの問題を却下すると出題されなくなる。出題待ちや出題を終えた問題も却下できる
+	repository.QuestionRejected: {repository.QuestionPendingReview, repository.QuestionApproved, repository.QuestionSuspended, repository.QuestionScheduled, repository.QuestionRetired},
+}
+
+// isValidStatus 問題に設定できる状態かを返す
+func isValidStatus(status string) bool {
+	switch status {
+	case repository.QuestionDraft, repository.QuestionPendingReview, repository.QuestionApproved, repository.QuestionRejected, repository.QuestionSuspended,
+		repository.QuestionScheduled, repository.QuestionRetired:
+		return true
+	}
+	return false
+}
+
+// canTransition fromの状態の問題をtoに変更できるかを返す
+func canTransition(from, to string) bool {
+	for _, s := range transitions[to] {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+type reviewRequest struct {
+	Comment string `json:"comment"`
+}
+
+// changeStatus 問題の状態をstatusに変更し、変更後の問題を返す
+// 承認する場合、出題を始める日時より前なら出題待ちに、終える日時を過ぎていれば出題終了にする
+// 失敗した場合はレスポンスを書き込んでfalseを返す
+func changeStatus(w http.ResponseWriter, r *http.Request, questions repository.QuestionRepository, id int, status, comment string) (Question, bool) {
+	before, err := questions.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "問題が見つかりません", http.StatusNotFound)
+		return Question{}, false
+	}
+	if err != nil {
+		http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+		return Question{}, false
+	}
+	if !canTransition(before.Status, status) {
+		http.Error(w, "この状態の問題には実行できません: "+before.Status, http.StatusConflict)
+		return Question{}, false
+	}
+	if status == repository.QuestionApproved {
+		status = scheduledStatus(before, time.Now())
+	}
+
+	reviewer, _ := auth.UserID(r)
+	err = questions.SetStatus(r.Context(), repository.QuestionReview{
+		QuestionID: id,
+		Reviewer:   reviewer,
+		FromStatus: before.Status,
+		Status:     status,
+		Comment:    comment,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		// Getの後に他の人が状態を変更した
+		http.Error(w, "問題の状態が変更されました。読み込み直してください", http.StatusConflict)
+		return Question{}, false
+	}
+	if err != nil {
+		http.Error(w, "問題の状態の変更に失敗しました", http.StatusInternalServerError)
+		return Question{}, false
+	}
+	after := before
+	after.Status = status
+	audit.Annotate(r, before, after)
+	return after, true
+}
+
+// SubmitQuestionHandler 作成者が下書きや却下された問題の審査を依頼するハンドラー
+func SubmitQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		q, err := questions.Get(r.Context(), id)
+		if err == nil && q.CreatorUsername != username {
+			// 他人の問題は存在しないものとして扱う
+			err = repository.ErrNotFound
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		after, ok := changeStatus(w, r, questions, id, repository.QuestionPendingReview, "")
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(after)
+	}
+}
+
+// PendingQuestionsHandler 審査待ちの問題を古い順に返すモデレーター用ハンドラー
+// ?status=で他の状態の問題も取得できる
+func PendingQuestionsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = repository.QuestionPendingReview
+		}
+		if !isValidStatus(status) {
+			http.Error(w, "無効な状態です", http.StatusBadRequest)
+			return
+		}
+		list, err := questions.ListByStatus(r.Context(), status)
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []Question{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// ApproveQuestionHandler 問題を承認して出題されるようにするモデレーター用ハンドラー
+// 本文の{"comment": "..."}は省略できる
+func ApproveQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return reviewHandler(questions, repository.QuestionApproved, false)
+}
+
+// RejectQuestionHandler 問題を却下するモデレーター用ハンドラー
+// 作成者が直せるように、本文の{"comment": "..."}で理由を必ず指定する
+func RejectQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return reviewHandler(questions, repository.QuestionRejected, true)
+}
+
+func reviewHandler(questions repository.QuestionRepository, status string, requireComment bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		var req reviewRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Comment = strings.TrimSpace(req.Comment)
+		if requireComment && req.Comment == "" {
+			http.Error(w, "理由を入力してください", http.StatusBadRequest)
+			return
+		}
+
+		after, ok := changeStatus(w, r, questions, id, status, req.Comment)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(after)
+	}
+}
+
+// QuestionReviewsHandler 問題の審査の記録を古い順に返すモデレーター用ハンドラー
+func QuestionReviewsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		reviews, err := questions.Reviews(r.Context(), id)
+		if err != nil {
+			http.Error(w, "審査の記録の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if reviews == nil {
+			reviews = []repository.QuestionReview{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reviews)
+	}
+}
@@ -0,0 +1,224 @@
+package question
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sys3/api/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// ListPoolsHandler 問題のプールを名前の順に返すハンドラー
+// 部屋を作るときに?pool=で指定するIDを選ぶために使う
+func ListPoolsHandler(pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := pools.Pools(r.Context())
+		if err != nil {
+			http.Error(w, "問題のプールの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// CreatePoolHandler 問題のプールを追加する管理者用ハンドラー
+func CreatePoolHandler(pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var p repository.QuestionPool
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		name, err := labelName(p.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p = repository.QuestionPool{Name: name, Description: strings.TrimSpace(p.Description)}
+
+		id, err := pools.CreatePool(r.Context(), p)
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "同じ名前のプールがあります", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題のプールの保存に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		p.ID = id
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// UpdatePoolHandler 問題のプールの名前と説明を変更する管理者用ハンドラー
+func UpdatePoolHandler(pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なプールIDです", http.StatusBadRequest)
+			return
+		}
+		var p repository.QuestionPool
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		name, err := labelName(p.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = pools.UpdatePool(r.Context(), repository.QuestionPool{ID: id, Name: name, Description: strings.TrimSpace(p.Description)})
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題のプールが見つかりません", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "同じ名前のプールがあります", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題のプールの更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		p, err = pools.GetPool(r.Context(), id)
+		if err != nil {
+			http.Error(w, "問題のプールの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// DeletePoolHandler 問題のプールを削除する管理者用ハンドラー
+// 問題は削除せず、プールから外すだけ。プールを使っていたシーズンは全ての問題から出題するようになる
+func DeletePoolHandler(pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なプールIDです", http.StatusBadRequest)
+			return
+		}
+		err := pools.DeletePool(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題のプールが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題のプールの削除に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PoolQuestionsHandler プールに入っている削除されていない問題を返す管理者用ハンドラー
+// 審査中などで出題されない問題も返す
+func PoolQuestionsHandler(questions repository.QuestionRepository, pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なプールIDです", http.StatusBadRequest)
+			return
+		}
+		if _, err := pools.GetPool(r.Context(), id); errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題のプールが見つかりません", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "問題のプールの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		list, err := questions.List(r.Context())
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		list = filterQuestions(list, func(q Question) bool { return slices.Contains(q.PoolIDs, id) })
+		if list == nil {
+			list = []Question{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+type poolQuestionsRequest struct {
+	QuestionIDs []int `json:"question_ids"`
+}
+
+// AddPoolQuestionsHandler 問題をプールに入れる管理者用ハンドラー
+// 本文は{"question_ids": [1, 2]}。既に入っている問題はそのままにする
+func AddPoolQuestionsHandler(questions repository.QuestionRepository, pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なプールIDです", http.StatusBadRequest)
+			return
+		}
+		var req poolQuestionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.QuestionIDs) == 0 {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		if _, err := pools.GetPool(r.Context(), id); errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題のプールが見つかりません", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "問題のプールの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		err := questions.AddToPool(r.Context(), id, req.QuestionIDs)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "存在しないか削除済みの問題が含まれています", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題のプールの更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		p, err := pools.GetPool(r.Context(), id)
+		if err != nil {
+			http.Error(w, "問題のプールの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// RemovePoolQuestionHandler 問題をプールから外す管理者用ハンドラー
+func RemovePoolQuestionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := labelID(r)
+		if !ok {
+			http.Error(w, "無効なプールIDです", http.StatusBadRequest)
+			return
+		}
+		qid, err := strconv.Atoi(mux.Vars(r)["question_id"])
+		if err != nil || qid <= 0 {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		err = questions.RemoveFromPool(r.Context(), id, qid)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題はこのプールに入っていません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題のプールの更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,217 @@
+package question
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"unicode/utf8"
+)
+
+// 報告に添えるコメントの長さの上限
+const maxReportCommentLength = 500
+
+// reportThreshold 未対応の報告がこの数に達した承認済みの問題は出題を停止する。0以下の場合は停止しない
+var reportThreshold = 3
+
+// SetReportThreshold 問題の出題を自動で停止する報告の数を設定する
+func SetReportThreshold(n int) {
+	reportThreshold = n
+}
+
+// isValidReason 問題の報告の理由として使えるかを返す
+func isValidReason(reason string) bool {
+	switch reason {
+	case repository.ReportWrongAnswer, repository.ReportTypo, repository.ReportOffensive:
+		return true
+	}
+	return false
+}
+
+// ErrInvalidReport 報告の理由やコメントが不正
+var ErrInvalidReport = errors.New("報告の内容が正しくありません")
+
+// Report 対戦中の問題の報告を記録し、未対応の報告が一定数に達したら出題を停止する
+// 出題を停止した場合はsuspendedがtrue。同じ問題を報告済みの場合はrepository.ErrConflict
+func Report(ctx context.Context, questions repository.QuestionRepository, reports repository.ReportRepository, r repository.QuestionReport) (suspended bool, err error) {
+	r.Comment = strings.TrimSpace(r.Comment)
+	if !isValidReason(r.Reason) || utf8.RuneCountInString(r.Comment) > maxReportCommentLength {
+		return false, ErrInvalidReport
+	}
+	if _, err := reports.CreateReport(ctx, r); err != nil {
+		return false, err
+	}
+	if reportThreshold <= 0 {
+		return false, nil
+	}
+	count, err := reports.CountOpenReports(ctx, r.QuestionID)
+	if err != nil || count < reportThreshold {
+		return false, err
+	}
+
+	q, err := questions.Get(ctx, r.QuestionID)
+	if err != nil || q.Status != repository.QuestionApproved {
+		// 削除済みや既に停止している問題はそのまま
+		if errors.Is(err, repository.ErrNotFound) {
+			err = nil
+		}
+		return false, err
+	}
+	err = questions.SetStatus(ctx, repository.QuestionReview{
+		QuestionID: r.QuestionID,
+		FromStatus: repository.QuestionApproved,
+		Status:     repository.QuestionSuspended,
+		Comment:    fmt.Sprintf("未対応の報告が%d件に達したため自動で出題を停止しました", count),
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		// 他の報告で先に停止された
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	slog.Warn("報告が多いため問題の出題を停止しました", "question_id", r.QuestionID, "reports", count)
+	return true, nil
+}
+
+// ReportedQuestion 審査待ちの一覧に表示する、報告された問題と報告の内容
+type ReportedQuestion struct {
+	Question Question                    `json:"question"`
+	Reasons  map[string]int              `json:"reasons"` // 理由ごとの件数
+	Reports  []repository.QuestionReport `json:"reports"`
+}
+
+// ReportQueueHandler 未対応の報告がある問題を、報告の多い順に返すモデレーター用ハンドラー
+// ?status=resolvedなどで対応済みの報告も確認できる。削除済みの問題の報告は返さない
+func ReportQueueHandler(questions repository.QuestionRepository, reports repository.ReportRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = repository.ReportOpen
+		}
+		list, err := reports.ReportsByStatus(r.Context(), status)
+		if err != nil {
+			http.Error(w, "報告の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		byQuestion := make(map[int]*ReportedQuestion)
+		queue := []*ReportedQuestion{}
+		for _, report := range list {
+			item, ok := byQuestion[report.QuestionID]
+			if !ok {
+				q, err := questions.Get(r.Context(), report.QuestionID)
+				if errors.Is(err, repository.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+					return
+				}
+				item = &ReportedQuestion{Question: q, Reasons: map[string]int{}}
+				byQuestion[report.QuestionID] = item
+				queue = append(queue, item)
+			}
+			item.Reasons[report.Reason]++
+			item.Reports = append(item.Reports, report)
+		}
+		// 報告の多い問題から対応できるように並べる。同数の場合は古い報告のある問題を先にする
+		sort.SliceStable(queue, func(i, j int) bool {
+			return len(queue[i].Reports) > len(queue[j].Reports)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(queue)
+	}
+}
+
+// QuestionReportsHandler 1問の報告を古い順に返すモデレーター用ハンドラー
+func QuestionReportsHandler(reports repository.ReportRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		list, err := reports.QuestionReports(r.Context(), id)
+		if err != nil {
+			http.Error(w, "報告の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []repository.QuestionReport{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+type closeReportsRequest struct {
+	Action  string `json:"action"` // resolveかdismiss
+	Comment string `json:"comment"`
+}
+
+// CloseReportsHandler 問題の未対応の報告を閉じるモデレーター用ハンドラー
+// 本文は{"action": "resolve"}(問題を直した)か{"action": "dismiss"}(報告が誤りだった)
+// dismissの場合、報告で停止していた問題は承認済みに戻す。resolveの場合は状態を変えないので、直した後に承認する
+func CloseReportsHandler(questions repository.QuestionRepository, reports repository.ReportRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		var req closeReportsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		var status string
+		switch req.Action {
+		case "resolve":
+			status = repository.ReportResolved
+		case "dismiss":
+			status = repository.ReportDismissed
+		default:
+			http.Error(w, "actionにはresolveかdismissを指定してください", http.StatusBadRequest)
+			return
+		}
+
+		q, err := questions.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if status == repository.ReportDismissed && q.Status == repository.QuestionSuspended {
+			comment := strings.TrimSpace(req.Comment)
+			if comment == "" {
+				comment = "報告を確認し、問題がなかったため出題を再開しました"
+			}
+			if q, ok = changeStatus(w, r, questions, id, repository.QuestionApproved, comment); !ok {
+				return
+			}
+		}
+
+		resolver, _ := auth.UserID(r)
+		closed, err := reports.CloseReports(r.Context(), id, status, resolver)
+		if err != nil {
+			http.Error(w, "報告の更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"closed":   closed,
+			"question": q,
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package question
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sys3/api/audit"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// 予定の一覧を取得するときに?within=を省略した場合の期間
+const defaultRotationWindow = 7 * 24 * time.Hour
+
+// scheduledStatus 承認済みの問題が、出題を始める日時と終える日時からみてnowの時点でなるべき状態を返す
+func scheduledStatus(q Question, now time.Time) string {
+	if q.RetireAt != nil && !q.RetireAt.After(now) {
+		return repository.QuestionRetired
+	}
+	if q.ActivateAt != nil && q.ActivateAt.After(now) {
+		return repository.QuestionScheduled
+	}
+	return repository.QuestionApproved
+}
+
+// rotationComment 日時による状態の変更を審査の記録に残すときのコメント
+func rotationComment(status string) string {
+	switch status {
+	case repository.QuestionScheduled:
+		return "出題を始める日時まで出題を待機します"
+	case repository.QuestionRetired:
+		return "出題を終える日時になったため出題を終了しました"
+	}
+	return "出題を始める日時になったため出題を開始しました"
+}
+
+// RotationResult 定期的な切り替えで状態を変更した問題のID
+type RotationResult struct {
+	Activated []int `json:"activated"`
+	Retired   []int `json:"retired"`
+	Scheduled []int `json:"scheduled"` // 承認された後に、まだ出題を始める日時になっていないことがわかった
+}
+
+// Rotate 承認済みと出題待ちの問題のうち、出題を始める・終える日時になったものの状態を変更する
+// 出題を終えた問題は、予定を変更するまでそのままにする
+func Rotate(ctx context.Context, questions repository.QuestionRepository, now time.Time) (RotationResult, error) {
+	result := RotationResult{Activated: []int{}, Retired: []int{}, Scheduled: []int{}}
+	for _, status := range []string{repository.QuestionScheduled, repository.QuestionApproved} {
+		list, err := questions.ListByStatus(ctx, status)
+		if err != nil {
+			return result, err
+		}
+		for _, q := range list {
+			next := scheduledStatus(q, now)
+			if next == q.Status {
+				continue
+			}
+			err := questions.SetStatus(ctx, repository.QuestionReview{
+				QuestionID: q.ID,
+				FromStatus: q.Status,
+				Status:     next,
+				Comment:    rotationComment(next),
+			})
+			if errors.Is(err, repository.ErrNotFound) {
+				// 読み込んだ後に削除されたか、他の操作で状態が変わった
+				continue
+			}
+			if err != nil {
+				return result, err
+			}
+			switch next {
+			case repository.QuestionApproved:
+				result.Activated = append(result.Activated, q.ID)
+			case repository.QuestionRetired:
+				result.Retired = append(result.Retired, q.ID)
+			default:
+				result.Scheduled = append(result.Scheduled, q.ID)
+			}
+		}
+	}
+	return result, nil
+}
+
+// StartRotation 出題を始める・終える日時になった問題を定期的に切り替えるゴルーチンを起動する
+func StartRotation(questions repository.QuestionRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			result, err := Rotate(ctx, questions, time.Now())
+			cancel()
+			if err != nil {
+				slog.Error("問題の出題の切り替えエラー", logging.Err(err))
+				continue
+			}
+			if len(result.Activated) > 0 || len(result.Retired) > 0 {
+				slog.Info("問題の出題を切り替えました", "activated", len(result.Activated), "retired", len(result.Retired))
+			}
+		}
+	}()
+}
+
+// RotateHandler 出題を始める・終える日時になった問題を今すぐ切り替える管理者用ハンドラー
+func RotateHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := Rotate(r.Context(), questions, time.Now())
+		if err != nil {
+			http.Error(w, "問題の出題の切り替えに失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// Rotation 予定されている出題の開始・終了
+type Rotation struct {
+	QuestionID   int       `json:"question_id"`
+	QuestionText string    `json:"question_text"`
+	Status       string    `json:"status"` // 現在の状態
+	Action       string    `json:"action"` // activateかretire
+	At           time.Time `json:"at"`
+}
+
+// upcomingRotations nowからuntilまでに予定されている出題の開始・終了を日時の順に返す
+func upcomingRotations(list []Question, now, until time.Time) []Rotation {
+	rotations := []Rotation{}
+	add := func(q Question, action string, at *time.Time) {
+		if at != nil && at.After(now) && !at.After(until) {
+			rotations = append(rotations, Rotation{QuestionID: q.ID, QuestionText: q.QuestionText, Status: q.Status, Action: action, At: *at})
+		}
+	}
+	for _, q := range list {
+		if q.Status == repository.QuestionScheduled {
+			add(q, "activate", q.ActivateAt)
+		}
+		add(q, "retire", q.RetireAt)
+	}
+	sort.SliceStable(rotations, func(i, j int) bool { return rotations[i].At.Before(rotations[j].At) })
+	return rotations
+}
+
+// UpcomingRotationsHandler これから予定されている出題の開始・終了を日時の順に返す管理者用ハンドラー
+// ?within=72hのように期間を指定できる(デフォルト: 7日)
+func UpcomingRotationsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		within := defaultRotationWindow
+		if v := r.URL.Query().Get("within"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "無効な期間です", http.StatusBadRequest)
+				return
+			}
+			within = d
+		}
+		var list []Question
+		for _, status := range []string{repository.QuestionScheduled, repository.QuestionApproved} {
+			l, err := questions.ListByStatus(r.Context(), status)
+			if err != nil {
+				http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+				return
+			}
+			list = append(list, l...)
+		}
+		now := time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upcomingRotations(list, now, now.Add(within)))
+	}
+}
+
+type scheduleRequest struct {
+	ActivateAt *time.Time `json:"activate_at"`
+	RetireAt   *time.Time `json:"retire_at"`
+}
+
+// rescheduledStatus 予定を変更した問題の新しい状態を返す。審査中などで予定に関係しない状態ならそのまま
+func rescheduledStatus(q Question, now time.Time) string {
+	switch q.Status {
+	case repository.QuestionApproved, repository.QuestionScheduled, repository.QuestionRetired:
+		return scheduledStatus(q, now)
+	}
+	return q.Status
+}
+
+// SetScheduleHandler 問題の出題を始める日時と終える日時を設定する管理者用ハンドラー。変更後の問題を返す
+// 本文は{"activate_at": "2024-04-01T00:00:00+09:00", "retire_at": null}。nullにするとその日時の指定を外す
+// 承認済み・出題待ち・出題を終えた問題は、新しい日時に合わせてすぐに状態を変更する
+func SetScheduleHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		var req scheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		if err := validateSchedule(req.ActivateAt, req.RetireAt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		before, err := questions.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		after := before
+		after.ActivateAt, after.RetireAt = req.ActivateAt, req.RetireAt
+		// 同じ日時を書き込んだ場合に変更した件数が0になるデータベースがあるので、変わらなければ書き込まない
+		if !sameTime(before.ActivateAt, after.ActivateAt) || !sameTime(before.RetireAt, after.RetireAt) {
+			err = questions.SetSchedule(r.Context(), id, after.ActivateAt, after.RetireAt)
+			if errors.Is(err, repository.ErrNotFound) {
+				http.Error(w, "問題が見つかりません", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "予定の保存に失敗しました", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if next := rescheduledStatus(after, time.Now()); next != after.Status {
+			reviewer, _ := auth.UserID(r)
+			err = questions.SetStatus(r.Context(), repository.QuestionReview{
+				QuestionID: id,
+				Reviewer:   reviewer,
+				FromStatus: after.Status,
+				Status:     next,
+				Comment:    rotationComment(next),
+			})
+			if errors.Is(err, repository.ErrNotFound) {
+				http.Error(w, "問題の状態が変更されました。読み込み直してください", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "問題の状態の変更に失敗しました", http.StatusInternalServerError)
+				return
+			}
+			after.Status = next
+		}
+		if saved, err := questions.Get(r.Context(), id); err == nil {
+			after = saved
+		}
+		audit.Annotate(r, before, after)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(after)
+	}
+}
+
+// sameTime どちらもnilか、同じ日時を指しているかを返す
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
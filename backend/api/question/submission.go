@@ -0,0 +1,157 @@
+package question
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sys3/api/auth"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// SubmissionLimit プレイヤーが一定時間内に投稿できる問題の数
+type SubmissionLimit struct {
+	Max    int           // 0以下の場合は制限しない
+	Window time.Duration // 投稿数を数える期間
+}
+
+var submissionLimit = SubmissionLimit{Max: 10, Window: 24 * time.Hour}
+
+// SetSubmissionLimit 問題の投稿数の制限を設定する
+func SetSubmissionLimit(limit SubmissionLimit) {
+	submissionLimit = limit
+}
+
+// windowText 期間を表示用の文字列にする
+func windowText(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d時間", d/time.Hour)
+	}
+	return d.String()
+}
+
+// Submission 投稿した問題と最新の審査の記録
+type Submission struct {
+	Question
+	Review *repository.QuestionReview `json:"review,omitempty"`
+}
+
+// submit プレイヤーの投稿として問題を保存し、保存した問題を返す
+// 下書きとして保存する場合以外は審査待ちにする。失敗した場合はレスポンスを書き込んでfalseを返す
+func submit(w http.ResponseWriter, r *http.Request, questions repository.QuestionRepository, username string, q Question) (Question, bool) {
+	q, err := Validate(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return Question{}, false
+	}
+
+	if limit := submissionLimit; limit.Max > 0 {
+		count, err := questions.CountSubmissionsSince(r.Context(), username, time.Now().Add(-limit.Window))
+		if err != nil {
+			http.Error(w, "問題の保存に失敗しました", http.StatusInternalServerError)
+			return Question{}, false
+		}
+		if count >= limit.Max {
+			w.Header().Set("Retry-After", strconv.Itoa(int(limit.Window.Seconds())))
+			http.Error(w, fmt.Sprintf("投稿できる問題は%sに%d問までです", windowText(limit.Window), limit.Max), http.StatusTooManyRequests)
+			return Question{}, false
+		}
+	}
+
+	if q.Status != repository.QuestionDraft {
+		q.Status = repository.QuestionPendingReview
+	}
+	q.Source = repository.QuestionSourceCommunity
+	// 難易度は回答の集計から決めるので、投稿者には指定させない
+	q.Difficulty = ""
+	q.CreatorUsername = username
+	id, err := questions.Create(r.Context(), q)
+	if err != nil {
+		slog.Error("問題の投稿エラー", logging.KeyUserID, username, logging.Err(err))
+		http.Error(w, "問題の保存に失敗しました", http.StatusInternalServerError)
+		return Question{}, false
+	}
+	q.ID = int(id)
+	if created, err := questions.Get(r.Context(), q.ID); err == nil {
+		q = created
+	}
+	return q, true
+}
+
+// CreateSubmissionHandler プレイヤーが問題を投稿するハンドラー
+// 投稿した問題はモデレーターが承認すると出題され、投稿者として名前が表示される
+// "status": "draft"を指定すると下書きとして保存し、後でPOST /questions/{id}/submitで審査を依頼できる
+func CreateSubmissionHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		var q Question
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+
+		created, ok := submit(w, r, questions, username, q)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Submission{Question: created})
+	}
+}
+
+// ListSubmissionsHandler 自分が投稿した問題を新しい順に、最新の審査の記録と合わせて返すハンドラー
+func ListSubmissionsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.UserID(r)
+		if !ok {
+			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+			return
+		}
+		list, err := questions.ListSubmissions(r.Context(), username)
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		submissions := make([]Submission, len(list))
+		for i, q := range list {
+			submissions[i] = Submission{Question: q}
+			reviews, err := questions.Reviews(r.Context(), q.ID)
+			if err != nil {
+				http.Error(w, "審査の記録の取得に失敗しました", http.StatusInternalServerError)
+				return
+			}
+			if len(reviews) > 0 {
+				submissions[i].Review = &reviews[len(reviews)-1]
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(submissions)
+	}
+}
+
+// ContributorsHandler 承認された投稿の多いプレイヤーを返すハンドラー
+// ?limit= で人数を指定できる(デフォルト: 20、最大: 100)
+func ContributorsHandler(questions repository.QuestionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 20
+		if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+			limit = min(v, 100)
+		}
+		contributors, err := questions.Contributors(r.Context(), limit)
+		if err != nil {
+			http.Error(w, "投稿者の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(contributors)
+	}
+}
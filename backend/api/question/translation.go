@@ -0,0 +1,284 @@
+package question
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sys3/api/audit"
+	"sys3/api/auth"
+	"sys3/api/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// locales 問題を翻訳する言語。元の問題は日本語で書くので含めない
+var locales = []string{"en"}
+
+// SetLocales 問題を翻訳する言語を設定する。空の要素は無視する
+func SetLocales(list []string) {
+	locales = locales[:0:0]
+	for _, l := range list {
+		if l = strings.TrimSpace(l); l != "" && !slices.Contains(locales, l) {
+			locales = append(locales, l)
+		}
+	}
+}
+
+// Locales 問題を翻訳する言語を返す
+func Locales() []string {
+	return slices.Clone(locales)
+}
+
+// localeOf URLの{locale}を設定された言語と大文字・小文字を区別せずに照らし合わせ、設定の表記で返す
+func localeOf(r *http.Request) (string, bool) {
+	locale := mux.Vars(r)["locale"]
+	for _, l := range locales {
+		if strings.EqualFold(l, locale) {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// ValidateTranslation 翻訳の内容を問題と同じ規則で確認し、前後の空白を取り除いた翻訳を返す
+// 正解は元の問題の正解と同じ位置の選択肢であること
+func ValidateTranslation(t repository.QuestionTranslation, original Question) (repository.QuestionTranslation, error) {
+	q, err := Validate(Question{
+		QuestionText:  t.QuestionText,
+		CorrectAnswer: t.CorrectAnswer,
+		Choices:       t.Choices,
+		Explanation:   t.Explanation,
+	})
+	if err != nil {
+		return t, err
+	}
+	if slices.Index(q.Choices, q.CorrectAnswer) != slices.Index(original.Choices, original.CorrectAnswer) {
+		return t, errors.New("正解は元の問題の正解と同じ位置の選択肢にしてください")
+	}
+	t.QuestionText, t.CorrectAnswer, t.Choices, t.Explanation = q.QuestionText, q.CorrectAnswer, q.Choices, q.Explanation
+	return t, nil
+}
+
+// TranslationStatus 翻訳一覧に表示する、翻訳と元の問題の版より古いかどうか
+type TranslationStatus struct {
+	repository.QuestionTranslation
+	Outdated bool `json:"outdated"` // 翻訳した後に元の問題が編集された
+}
+
+// QuestionTranslationsHandler 1問の翻訳を言語の順に返す管理者用ハンドラー
+func QuestionTranslationsHandler(questions repository.QuestionRepository, translations repository.TranslationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		q, err := questions.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		list, err := translations.Translations(r.Context(), id)
+		if err != nil {
+			http.Error(w, "翻訳の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		statuses := make([]TranslationStatus, len(list))
+		for i, t := range list {
+			statuses[i] = TranslationStatus{QuestionTranslation: t, Outdated: t.SourceVersion < q.Version}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	}
+}
+
+// SaveTranslationHandler 問題の翻訳を追加・置き換える管理者用ハンドラー。保存した翻訳を返す
+// 翻訳は保存した時点の問題の版に対するものとして記録する
+func SaveTranslationHandler(questions repository.QuestionRepository, translations repository.TranslationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		locale, ok := localeOf(r)
+		if !ok {
+			http.Error(w, "翻訳する言語として設定されていません", http.StatusBadRequest)
+			return
+		}
+		var t repository.QuestionTranslation
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+
+		q, err := questions.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "問題が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		t, err = ValidateTranslation(t, q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t.QuestionID = id
+		t.Locale = locale
+		t.SourceVersion = q.Version
+		t.Translator, _ = auth.UserID(r)
+
+		before, err := translations.GetTranslation(r.Context(), id, locale)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "翻訳の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if err := translations.SaveTranslation(r.Context(), t); err != nil {
+			http.Error(w, "翻訳の保存に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if saved, err := translations.GetTranslation(r.Context(), id, locale); err == nil {
+			t = saved
+		}
+		if before.QuestionID == 0 {
+			audit.Annotate(r, nil, t)
+		} else {
+			audit.Annotate(r, before, t)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// DeleteTranslationHandler 問題の翻訳を削除する管理者用ハンドラー
+func DeleteTranslationHandler(translations repository.TranslationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := questionID(r)
+		if !ok {
+			http.Error(w, "無効な問題IDです", http.StatusBadRequest)
+			return
+		}
+		// 設定から外した言語の翻訳も消せるように、URLの表記のまま削除する
+		locale := mux.Vars(r)["locale"]
+		before, err := translations.GetTranslation(r.Context(), id, locale)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "翻訳が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "翻訳の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		err = translations.DeleteTranslation(r.Context(), id, locale)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "翻訳が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "翻訳の削除に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		audit.Annotate(r, before, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TranslationCompleteness 1つの言語の翻訳の進み具合
+// 出題される(承認済みの)問題だけを数える
+type TranslationCompleteness struct {
+	Locale     string  `json:"locale"`
+	Questions  int     `json:"questions"`  // 承認済みの問題の数
+	Translated int     `json:"translated"` // 最新の版が翻訳されている問題の数
+	Outdated   int     `json:"outdated"`   // 翻訳した後に元の問題が編集された問題の数
+	Missing    int     `json:"missing"`    // 翻訳のない問題の数
+	Percent    float64 `json:"percent"`    // Translated / Questions。問題がなければ100
+	// 未翻訳・要更新の問題ID。言語を指定して取得した場合だけ返す
+	MissingIDs  []int `json:"missing_ids,omitempty"`
+	OutdatedIDs []int `json:"outdated_ids,omitempty"`
+}
+
+// completeness 設定された言語ごとに翻訳の進み具合を数える。detailがtrueなら未翻訳・要更新の問題IDも返す
+func completeness(questions []Question, translated []repository.TranslatedVersion, langs []string, detail bool) []TranslationCompleteness {
+	versions := make(map[string]map[int]int, len(langs))
+	for _, t := range translated {
+		if versions[t.Locale] == nil {
+			versions[t.Locale] = make(map[int]int)
+		}
+		versions[t.Locale][t.QuestionID] = t.SourceVersion
+	}
+
+	list := make([]TranslationCompleteness, len(langs))
+	for i, locale := range langs {
+		c := TranslationCompleteness{Locale: locale, Questions: len(questions)}
+		for _, q := range questions {
+			version, ok := versions[locale][q.ID]
+			switch {
+			case !ok:
+				c.Missing++
+				if detail {
+					c.MissingIDs = append(c.MissingIDs, q.ID)
+				}
+			case version < q.Version:
+				c.Outdated++
+				if detail {
+					c.OutdatedIDs = append(c.OutdatedIDs, q.ID)
+				}
+			default:
+				c.Translated++
+			}
+		}
+		c.Percent = 100
+		if c.Questions > 0 {
+			c.Percent = math.Round(float64(c.Translated)/float64(c.Questions)*1000) / 10
+		}
+		list[i] = c
+	}
+	return list
+}
+
+// TranslationCompletenessHandler 設定された言語ごとの翻訳の進み具合を返す管理者用ハンドラー
+// URLに{locale}を指定した場合はその言語だけを、未翻訳・要更新の問題IDと共に返す
+func TranslationCompletenessHandler(questions repository.QuestionRepository, translations repository.TranslationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		langs := Locales()
+		detail := false
+		if _, ok := mux.Vars(r)["locale"]; ok {
+			locale, ok := localeOf(r)
+			if !ok {
+				http.Error(w, "翻訳する言語として設定されていません", http.StatusNotFound)
+				return
+			}
+			langs, detail = []string{locale}, true
+		}
+
+		approved, err := questions.ListByStatus(r.Context(), repository.QuestionApproved)
+		if err != nil {
+			http.Error(w, "問題の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		translated, err := translations.TranslatedVersions(r.Context())
+		if err != nil {
+			http.Error(w, "翻訳の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		list := completeness(approved, translated, langs, detail)
+
+		w.Header().Set("Content-Type", "application/json")
+		if detail {
+			json.NewEncoder(w).Encode(list[0])
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+	}
+}
@@ -0,0 +1,292 @@
+package question
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// 一度に外部の問題集から取得する問題数の上限(Open Trivia DBの上限に合わせる)
+const maxIngestAmount = 50
+
+// ExternalQuestion 外部の問題集から取得した1問
+type ExternalQuestion struct {
+	Question Question
+	Category string // 取り込み時に付けるカテゴリーの名前。なければ空
+}
+
+// TriviaSource 外部の問題集
+type TriviaSource interface {
+	// Name 問題の作成者として記録する名前
+	Name() string
+	// Fetch 最大amount問を取得する
+	Fetch(ctx context.Context, amount int) ([]ExternalQuestion, error)
+}
+
+// OpenTriviaDB Open Trivia DB(https://opentdb.com)から4択の問題を取得するTriviaSource
+type OpenTriviaDB struct {
+	BaseURL string // 空の場合はhttps://opentdb.com/api.php
+	Client  *http.Client
+}
+
+func (s *OpenTriviaDB) Name() string { return "opentdb" }
+
+type openTriviaResponse struct {
+	ResponseCode int `json:"response_code"`
+	Results      []struct {
+		Type             string   `json:"type"`
+		Difficulty       string   `json:"difficulty"`
+		Category         string   `json:"category"`
+		Question         string   `json:"question"`
+		CorrectAnswer    string   `json:"correct_answer"`
+		IncorrectAnswers []string `json:"incorrect_answers"`
+	} `json:"results"`
+}
+
+// openTriviaDifficulties Open Trivia DBの難易度と、この問題集の難易度の対応
+var openTriviaDifficulties = map[string]string{
+	"easy":   repository.DifficultyEasy,
+	"medium": repository.DifficultyNormal,
+	"hard":   repository.DifficultyHard,
+}
+
+func (s *OpenTriviaDB) Fetch(ctx context.Context, amount int) ([]ExternalQuestion, error) {
+	base := s.BaseURL
+	if base == "" {
+		base = "https://opentdb.com/api.php"
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	// HTMLの文字参照ではなくパーセントエンコードで受け取り、そのまま元の文字列に戻せるようにする
+	query := url.Values{"amount": {strconv.Itoa(amount)}, "type": {"multiple"}, "encode": {"url3986"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Open Trivia DBの応答が不正です: %s", resp.Status)
+	}
+
+	var body openTriviaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Open Trivia DBの応答を読み取れません: %w", err)
+	}
+	switch body.ResponseCode {
+	case 0:
+	case 1:
+		return nil, nil // 条件に合う問題がない
+	case 5:
+		return nil, fmt.Errorf("Open Trivia DBへのリクエストが多すぎます")
+	default:
+		return nil, fmt.Errorf("Open Trivia DBがエラーを返しました(%d)", body.ResponseCode)
+	}
+
+	questions := make([]ExternalQuestion, 0, len(body.Results))
+	for _, result := range body.Results {
+		if result.Type != "multiple" || len(result.IncorrectAnswers) != 3 {
+			continue
+		}
+		correct := unescapeTrivia(result.CorrectAnswer)
+		choices := []string{correct}
+		for _, answer := range result.IncorrectAnswers {
+			choices = append(choices, unescapeTrivia(answer))
+		}
+		// 正解が常に最初の選択肢にならないように並べ替える
+		rand.Shuffle(len(choices), func(i, j int) { choices[i], choices[j] = choices[j], choices[i] })
+		questions = append(questions, ExternalQuestion{
+			Question: Question{
+				QuestionText:  unescapeTrivia(result.Question),
+				CorrectAnswer: correct,
+				Choices:       choices,
+				Difficulty:    openTriviaDifficulties[unescapeTrivia(result.Difficulty)],
+			},
+			Category: unescapeTrivia(result.Category),
+		})
+	}
+	return questions, nil
+}
+
+// unescapeTrivia パーセントエンコードされた文字列を元に戻す。戻せない場合はそのまま返す
+func unescapeTrivia(s string) string {
+	if v, err := url.PathUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// triviaSources 名前で指定できる外部の問題集
+var triviaSources = map[string]TriviaSource{
+	"opentdb": &OpenTriviaDB{},
+}
+
+// TriviaSourceFor 名前に対応する外部の問題集を返す
+func TriviaSourceFor(name string) (TriviaSource, bool) {
+	s, ok := triviaSources[name]
+	return s, ok
+}
+
+// Ingest 外部の問題集から問題を取得し、審査待ちとして追加する
+// 既にある問題と同じ問題文のものは追加しない。カテゴリーがなければ作成して付ける
+// dryRunの場合は検証結果だけを返し、取得した問題もカテゴリーも保存しない
+func Ingest(ctx context.Context, questions repository.QuestionRepository, categories repository.CategoryRepository, source TriviaSource, amount int, dryRun bool) (ImportReport, error) {
+	amount = max(1, min(amount, maxIngestAmount))
+	fetched, err := source.Fetch(ctx, amount)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	// 削除済みの問題も含めて、同じ問題を取り込み直さない
+	seen := make(map[string]int)
+	for _, list := range []func(context.Context) ([]Question, error){questions.List, questions.ListDeleted} {
+		existing, err := list(ctx)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		for _, q := range existing {
+			seen[q.QuestionText] = 0
+		}
+	}
+	known, err := categories.Categories(ctx)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	categoryIDs := make(map[string]int, len(known))
+	for _, c := range known {
+		categoryIDs[c.Name] = c.ID
+	}
+
+	report := ImportReport{DryRun: dryRun, Total: len(fetched), Rows: make([]ImportResult, 0, len(fetched))}
+	for i, external := range fetched {
+		result := ImportResult{Row: i + 1}
+		q, err := Validate(external.Question)
+		if err == nil {
+			if first, ok := seen[q.QuestionText]; ok && first == 0 {
+				err = fmt.Errorf("既にある問題です")
+			} else if ok {
+				err = fmt.Errorf("%d問目と同じ問題文です", first)
+			} else {
+				seen[q.QuestionText] = i + 1
+			}
+		}
+		result.QuestionText = q.QuestionText
+		if err != nil {
+			result.Error = err.Error()
+			report.Invalid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+		report.Valid++
+
+		if !dryRun {
+			q.CreatorUsername = source.Name()
+			q.Status = repository.QuestionPendingReview
+			q.Source = repository.QuestionSourceExternal
+			id, err := questions.Create(ctx, q)
+			if err != nil {
+				slog.Error("外部の問題の取り込みエラー", "source", source.Name(), "index", i, logging.Err(err))
+				result.Error = "問題の保存に失敗しました"
+				report.Failed++
+				report.Rows = append(report.Rows, result)
+				continue
+			}
+			result.ID = int(id)
+			report.Imported++
+			if categoryID := ingestCategory(ctx, categories, categoryIDs, external.Category); categoryID != 0 {
+				if err := questions.SetLabels(ctx, int(id), []int{categoryID}, nil); err != nil {
+					slog.Error("外部の問題のカテゴリーの設定エラー", "question_id", id, logging.Err(err))
+				}
+			}
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	return report, nil
+}
+
+// ingestCategory 取り込む問題に付けるカテゴリーのIDを返す。なければ作成する
+// 名前が空か不正な場合、作成に失敗した場合は0
+func ingestCategory(ctx context.Context, categories repository.CategoryRepository, ids map[string]int, name string) int {
+	name, err := labelName(name)
+	if err != nil {
+		return 0
+	}
+	if id, ok := ids[name]; ok {
+		return id
+	}
+	id, err := categories.CreateCategory(ctx, repository.Category{Name: name, Description: ""})
+	if err != nil {
+		slog.Error("外部の問題のカテゴリーの作成エラー", "category", name, logging.Err(err))
+		return 0
+	}
+	ids[name] = id
+	return id
+}
+
+// StartIngestion 外部の問題集から定期的に問題を取り込むゴルーチンを起動する
+func StartIngestion(questions repository.QuestionRepository, categories repository.CategoryRepository, source TriviaSource, amount int, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			report, err := Ingest(ctx, questions, categories, source, amount, false)
+			cancel()
+			if err != nil {
+				slog.Error("外部の問題の取り込みエラー", "source", source.Name(), logging.Err(err))
+				continue
+			}
+			slog.Info("外部の問題を取り込みました", "source", source.Name(), "imported", report.Imported, "invalid", report.Invalid, "failed", report.Failed)
+		}
+	}()
+}
+
+// IngestQuestionsHandler 外部の問題集から問題を今すぐ取り込む管理者用ハンドラー
+// ?source=で問題集(デフォルト: opentdb)、?amount=で問題数(デフォルト: 10、最大50)を指定する
+// 取り込んだ問題は審査待ちになる。?dry_run=trueの場合は検証結果だけを返す
+func IngestQuestionsHandler(questions repository.QuestionRepository, categories repository.CategoryRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSpace(r.URL.Query().Get("source"))
+		if name == "" {
+			name = "opentdb"
+		}
+		source, ok := TriviaSourceFor(name)
+		if !ok {
+			http.Error(w, "不明な問題集です", http.StatusBadRequest)
+			return
+		}
+		amount := 10
+		if v := r.URL.Query().Get("amount"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxIngestAmount {
+				http.Error(w, fmt.Sprintf("問題数は1〜%dで指定してください", maxIngestAmount), http.StatusBadRequest)
+				return
+			}
+			amount = n
+		}
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		report, err := Ingest(r.Context(), questions, categories, source, amount, dryRun)
+		if err != nil {
+			slog.Error("外部の問題の取り込みエラー", "source", name, logging.Err(err))
+			http.Error(w, "外部の問題集から取得できませんでした", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,71 @@
+package question
+
+import (
+	"errors"
+	"strings"
+	"sys3/api/repository"
+	"time"
+	"unicode/utf8"
+)
+
+// 列の長さの上限(db.sqlのVARCHAR(255))
+const maxChoiceLength = 255
+
+// Validate 保存する問題の内容を確認し、前後の空白を取り除いた問題を返す
+// 選択肢は4つとも空でなく重複せず、正解と一致する選択肢がちょうど1つであること
+// 難易度は省略するか、easy・normal・hardのいずれかであること
+// 出題を終える日時は始める日時より後であること
+func Validate(q Question) (Question, error) {
+	q.QuestionText = strings.TrimSpace(q.QuestionText)
+	q.CorrectAnswer = strings.TrimSpace(q.CorrectAnswer)
+	q.Explanation = strings.TrimSpace(q.Explanation)
+	if q.QuestionText == "" {
+		return q, errors.New("問題文を入力してください")
+	}
+	if len(q.Choices) != 4 {
+		return q, errors.New("選択肢は4つ必要です")
+	}
+
+	choices := make([]string, len(q.Choices))
+	seen := make(map[string]bool, len(q.Choices))
+	matches := 0
+	for i, choice := range q.Choices {
+		choice = strings.TrimSpace(choice)
+		if choice == "" {
+			return q, errors.New("空の選択肢があります")
+		}
+		if utf8.RuneCountInString(choice) > maxChoiceLength {
+			return q, errors.New("選択肢が長すぎます")
+		}
+		if seen[choice] {
+			return q, errors.New("同じ選択肢が重複しています")
+		}
+		seen[choice] = true
+		if choice == q.CorrectAnswer {
+			matches++
+		}
+		choices[i] = choice
+	}
+	if matches != 1 {
+		return q, errors.New("正解は選択肢のいずれか1つと一致する必要があります")
+	}
+	q.Choices = choices
+
+	switch q.Difficulty {
+	case "", repository.DifficultyEasy, repository.DifficultyNormal, repository.DifficultyHard:
+	default:
+		return q, errors.New("無効な難易度です")
+	}
+	if err := validateSchedule(q.ActivateAt, q.RetireAt); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// validateSchedule 出題を終える日時が始める日時より後かを確認する。どちらかがnilなら確認しない
+func validateSchedule(activateAt, retireAt *time.Time) error {
+	if activateAt != nil && retireAt != nil && !retireAt.After(*activateAt) {
+		return errors.New("出題を終える日時は始める日時より後にしてください")
+	}
+	return nil
+}
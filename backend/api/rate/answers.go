@@ -0,0 +1,34 @@
+package rate
+
+import (
+	"encoding/json"
+	"net/http"
+	"sys3/api/repository"
+)
+
+const (
+	defaultFastAnswerMs    = 500
+	defaultFastAnswerCount = 5
+)
+
+// FastAnswerer 人間には難しい速さで正解を繰り返しているプレイヤー
+type FastAnswerer = repository.FastAnswerer
+
+// FastAnswersHandler 出題から回答権を取るまでが速すぎる正解の多いプレイヤーを返すハンドラー
+// ツールによる自動回答の確認用。詳細は GET /matches/{id}/replay で確認する
+// ?below_ms= 速すぎるとみなす時間(デフォルト: 500)、?min_count= 表示する最低回数(デフォルト: 5)
+func FastAnswersHandler(matches repository.MatchRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		belowMs := parsePositiveInt(r.URL.Query().Get("below_ms"), defaultFastAnswerMs)
+		minCount := parsePositiveInt(r.URL.Query().Get("min_count"), defaultFastAnswerCount)
+
+		players, err := matches.FastAnswerers(r.Context(), belowMs, minCount)
+		if err != nil {
+			http.Error(w, "データの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(players)
+	}
+}
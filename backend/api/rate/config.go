@@ -0,0 +1,115 @@
+package rate
+
+import "sync"
+
+// レーティングの計算方式
+const (
+	AlgorithmElo     = "elo"
+	AlgorithmGlicko2 = "glicko2"
+)
+
+// RatingConfig レーティングの計算に使うパラメータ
+type RatingConfig struct {
+	Algorithm     string  `json:"algorithm" yaml:"algorithm"`           // "elo" または "glicko2"
+	KFactor       float64 `json:"k_factor" yaml:"k_factor"`             // Elo: 大きくするほど1試合あたりの変動が大きくなる
+	InitialRating int     `json:"initial_rating" yaml:"initial_rating"` // 初めて対戦するプレイヤーのレート
+	Scale         float64 `json:"scale" yaml:"scale"`                   // Elo: レート差による期待勝率の広がり(標準は400)
+	Tau           float64 `json:"tau" yaml:"tau"`                       // Glicko-2: 変動率の変化のしやすさ
+
+	MinRating      int      `json:"min_rating" yaml:"min_rating"`           // これより下にはレートが下がらない
+	MaxRating      int      `json:"max_rating" yaml:"max_rating"`           // これより上にはレートが上がらない(0は上限なし)
+	ProtectedTiers []string `json:"protected_tiers" yaml:"protected_tiers"` // 一度到達すると降格しないランク帯
+}
+
+// DefaultGameType ゲームの種類が指定されなかった場合に使う種類
+const DefaultGameType = "quiz"
+
+var (
+	configMu      sync.RWMutex
+	defaultConfig = RatingConfig{
+		Algorithm:     AlgorithmElo,
+		KFactor:       KFactor,
+		InitialRating: DefaultRating,
+		Scale:         400,
+		Tau:           defaultGlickoTau,
+		MinRating:     100,
+	}
+	// ゲームの種類ごとの上書き設定
+	// ここに登録されているものが対応しているゲームの種類になる
+	gameTypeConfigs = map[string]RatingConfig{
+		DefaultGameType: {},
+	}
+)
+
+// SetConfig 全てのゲームの種類に使うデフォルトのパラメータを設定する
+// 0(空文字)のパラメータは現在の値のまま変更しない
+func SetConfig(config RatingConfig) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	defaultConfig = mergeConfig(defaultConfig, config)
+}
+
+// SetGameTypeConfig 特定のゲームの種類のパラメータを上書きする
+// 0(空文字)のパラメータはデフォルトの値を使う
+// 登録されていなかったゲームの種類は対応している種類として追加される
+func SetGameTypeConfig(gameType string, config RatingConfig) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	gameTypeConfigs[gameType] = config
+}
+
+// ConfigFor ゲームの種類に対応するパラメータを返す
+func ConfigFor(gameType string) RatingConfig {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	if override, ok := gameTypeConfigs[gameType]; ok {
+		return mergeConfig(defaultConfig, override)
+	}
+	return defaultConfig
+}
+
+// IsKnownGameType 対応しているゲームの種類かを返す
+func IsKnownGameType(gameType string) bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	_, ok := gameTypeConfigs[gameType]
+	return ok
+}
+
+// NormalizeGameType 空のゲームの種類をデフォルトに置き換える
+func NormalizeGameType(gameType string) string {
+	if gameType == "" {
+		return DefaultGameType
+	}
+	return gameType
+}
+
+// mergeConfig overrideで0(空文字)以外のパラメータだけをbaseに上書きする
+func mergeConfig(base, override RatingConfig) RatingConfig {
+	if override.Algorithm != "" {
+		base.Algorithm = override.Algorithm
+	}
+	if override.KFactor > 0 {
+		base.KFactor = override.KFactor
+	}
+	if override.InitialRating > 0 {
+		base.InitialRating = override.InitialRating
+	}
+	if override.Scale > 0 {
+		base.Scale = override.Scale
+	}
+	if override.Tau > 0 {
+		base.Tau = override.Tau
+	}
+	if override.MinRating > 0 {
+		base.MinRating = override.MinRating
+	}
+	if override.MaxRating > 0 {
+		base.MaxRating = override.MaxRating
+	}
+	if override.ProtectedTiers != nil {
+		base.ProtectedTiers = override.ProtectedTiers
+	}
+	return base
+}
@@ -0,0 +1,134 @@
+package rate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sys3/api/alert"
+	"sys3/api/logging"
+	"sys3/api/metrics"
+	"sys3/api/repository"
+	"sys3/api/tracing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Finalizer 対戦終了時の保存処理
+// 対戦記録・問題ごとの回答・レートと連勝数の更新は、RatingServiceが1つのトランザクションで保存する
+// 一時的なエラーで失敗した場合は再試行する。MatchKeyが同じなら二重に保存されることはない
+type Finalizer struct {
+	service     RatingService
+	maxAttempts int
+	backoff     time.Duration // 再試行までの待ち時間。試行ごとに2倍にする
+}
+
+// NewFinalizer serviceに保存するFinalizerを作成する
+func NewFinalizer(service RatingService) *Finalizer {
+	return &Finalizer{
+		service:     service,
+		maxAttempts: 3,
+		backoff:     200 * time.Millisecond,
+	}
+}
+
+// FinalizeResult 対戦の保存結果
+type FinalizeResult struct {
+	MatchID int64
+	Rated   bool         // レートを更新したか
+	Update  RatingUpdate // Ratedの場合のみ
+}
+
+// Finalize 対戦を保存する。ratedがfalseの場合はレートを変動させずに対戦記録だけを保存する
+// 1回の試行ごとにparentから制限時間付きのコンテキストを作る
+// ランク戦の結果を保存できなかった場合はメトリクスに記録する
+func (f *Finalizer) Finalize(parent context.Context, record MatchRecord, rated bool) (FinalizeResult, error) {
+	ctx, span := tracing.Start(parent, "rating.finalize",
+		attribute.String("game_type", record.GameType),
+		attribute.Bool("rated", rated),
+		attribute.String("match_key", record.MatchKey),
+	)
+	defer span.End()
+
+	result, err := f.retry(ctx, record, rated)
+	if err != nil {
+		tracing.Fail(span, err)
+		if rated {
+			metrics.RatingUpdateFailures.WithLabelValues(record.GameType).Inc()
+			alert.Record(alert.RatingUpdateFailure)
+		}
+		return result, err
+	}
+	span.SetAttributes(attribute.Int64("match_id", result.MatchID))
+	return result, nil
+}
+
+// retry 一時的なエラーの間、試行ごとに待ち時間を延ばしながら保存を再試行する
+func (f *Finalizer) retry(parent context.Context, record MatchRecord, rated bool) (FinalizeResult, error) {
+	var err error
+	backoff := f.backoff
+	for attempt := 1; ; attempt++ {
+		var result FinalizeResult
+		result, err = f.save(parent, record, rated)
+		if err == nil {
+			return result, nil
+		}
+		if !isTransient(err) || parent.Err() != nil {
+			return FinalizeResult{}, err
+		}
+		if attempt >= f.maxAttempts {
+			return FinalizeResult{}, fmt.Errorf("%w: %w", repository.ErrDBUnavailable, err)
+		}
+
+		slog.Warn("対戦の保存に失敗したため再試行します", "attempt", attempt, logging.Err(err))
+		trace.SpanFromContext(parent).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt), attribute.String("error", err.Error())))
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-parent.Done():
+			return FinalizeResult{}, parent.Err()
+		}
+	}
+}
+
+func (f *Finalizer) save(parent context.Context, record MatchRecord, rated bool) (FinalizeResult, error) {
+	ctx, cancel := repository.WithTimeout(parent)
+	defer cancel()
+
+	if !rated {
+		matchID, err := f.service.RecordCasualMatch(ctx, record)
+		return FinalizeResult{MatchID: matchID}, err
+	}
+	matchID, update, err := f.service.FinalizeMatch(ctx, record)
+	return FinalizeResult{MatchID: matchID, Rated: true, Update: update}, err
+}
+
+// isTransient 再試行すれば成功する可能性のあるエラーかを返す
+// 接続の切断、制限時間切れ、デッドロックやロック待ちのタイムアウトが該当する
+func isTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// 1205: ロック待ちのタイムアウト, 1213: デッドロック
+		return mysqlErr.Number == 1205 || mysqlErr.Number == 1213
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// 40001: 直列化の失敗, 40P01: デッドロック
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		// 他のトランザクションがデータベースに書き込んでいる
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package rate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sys3/api/repository"
+	"testing"
+)
+
+// flakyService 最初のfailures回のFinalizeMatchをerrで失敗させるRatingService
+type flakyService struct {
+	*MemoryService
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *flakyService) FinalizeMatch(ctx context.Context, record MatchRecord) (int64, RatingUpdate, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return 0, RatingUpdate{}, s.err
+	}
+	return s.MemoryService.FinalizeMatch(ctx, record)
+}
+
+func newTestRecord(key string) MatchRecord {
+	return MatchRecord{
+		MatchResult:  MatchResult{WinnerID: "alice", LoserID: "bob", GameType: DefaultGameType, Outcome: OutcomeWin},
+		Player1ID:    "alice",
+		Player2ID:    "bob",
+		Player1Score: 3,
+		Player2Score: 1,
+		MatchKey:     key,
+	}
+}
+
+func TestFinalizeSameMatchKeyOnce(t *testing.T) {
+	service := NewMemoryService()
+	f := NewFinalizer(service)
+	ctx := context.Background()
+
+	first, err := f.Finalize(ctx, newTestRecord("room-1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Rated || first.Update.RatingChange <= 0 {
+		t.Fatalf("first = %+v, want a rated update", first)
+	}
+	// 再試行などで同じ対戦をもう一度保存しても、レートは二重に変動しない
+	second, err := f.Finalize(ctx, newTestRecord("room-1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.MatchID != first.MatchID || second.Update != first.Update {
+		t.Errorf("second = %+v, want %+v", second, first)
+	}
+	if got := service.Rating(ctx, "alice", DefaultGameType); got != first.Update.WinnerNewRating {
+		t.Errorf("alice's rating = %d, want %d", got, first.Update.WinnerNewRating)
+	}
+	if len(service.Matches) != 1 {
+		t.Errorf("matches = %d, want 1", len(service.Matches))
+	}
+}
+
+func TestFinalizeCasualKeepsRatings(t *testing.T) {
+	service := NewMemoryService()
+	ctx := context.Background()
+
+	result, err := NewFinalizer(service).Finalize(ctx, newTestRecord("room-1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rated || result.MatchID == 0 {
+		t.Errorf("result = %+v, want an unrated match", result)
+	}
+	initial := ConfigFor(DefaultGameType).InitialRating
+	if got := service.Rating(ctx, "alice", DefaultGameType); got != initial {
+		t.Errorf("alice's rating = %d, want %d", got, initial)
+	}
+}
+
+func TestFinalizeRetriesTransientErrors(t *testing.T) {
+	broken := errors.New("broken")
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   error
+	}{
+		{"一時的なエラーは再試行する", 2, driver.ErrBadConn, 3, nil},
+		{"最大回数まで失敗したら諦める", 3, driver.ErrBadConn, 3, repository.ErrDBUnavailable},
+		{"一時的でないエラーは再試行しない", 1, broken, 1, broken},
+	}
+	for _, tt := range tests {
+		service := &flakyService{MemoryService: NewMemoryService(), failures: tt.failures, err: tt.err}
+		f := NewFinalizer(service)
+		f.backoff = 0
+
+		_, err := f.Finalize(context.Background(), newTestRecord("room-1"), true)
+		if service.calls != tt.wantCalls {
+			t.Errorf("%s: calls = %d, want %d", tt.name, service.calls, tt.wantCalls)
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
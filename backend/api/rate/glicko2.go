@@ -0,0 +1,79 @@
+package rate
+
+import "math"
+
+// Glicko-2のパラメータ
+// http://www.glicko.net/glicko/glicko2.pdf
+const (
+	glickoScale            = 173.7178 // Glicko-2の内部スケールへの変換係数
+	glickoCenter           = 1500.0
+	DefaultRatingDeviation = 350.0 // 初めて対戦するプレイヤーのレーティング偏差
+	DefaultVolatility      = 0.06  // 初めて対戦するプレイヤーの変動率
+	defaultGlickoTau       = 0.5   // 変動率の変化のしやすさ(0.3〜1.2)
+	glickoEpsilon          = 0.000001
+)
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu, muJ, phiJ float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phiJ)*(mu-muJ)))
+}
+
+// glicko2Update 1試合の結果からプレイヤーのレート・偏差・変動率を更新する
+// scoreは勝ちが1、負けが0
+func glicko2Update(player, opponent playerState, score, tau float64) playerState {
+	mu := (float64(player.Rating) - glickoCenter) / glickoScale
+	phi := player.Deviation / glickoScale
+	sigma := player.Volatility
+	muJ := (float64(opponent.Rating) - glickoCenter) / glickoScale
+	phiJ := opponent.Deviation / glickoScale
+
+	g := glickoG(phiJ)
+	e := glickoE(mu, muJ, phiJ)
+	v := 1 / (g * g * e * (1 - e))
+	delta := v * g * (score - e)
+
+	// 新しい変動率をイリノイ法で求める
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	newSigma := math.Exp(A / 2)
+
+	// 偏差とレートを更新
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*g*(score-e)
+
+	return playerState{
+		Rating:     int(math.Round(glickoScale*newMu + glickoCenter)),
+		Deviation:  glickoScale * newPhi,
+		Volatility: newSigma,
+	}
+}
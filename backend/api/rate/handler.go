@@ -1,18 +1,23 @@
 package rate
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"math"
 	"net/http"
+	"sys3/api/auth"
+	"sys3/api/repository"
 )
 
+// デフォルトのパラメータ。SetConfig/SetGameTypeConfigで変更できる
 const (
 	DefaultRating = 1500
 	KFactor       = 32 // とりあえず32にしとく、大きくしたら変動レートが大きくなる
 )
 
-func CalculateRatingHandler(db *sql.DB) http.HandlerFunc {
+// CalculateRatingHandler 対戦結果を受け取って両プレイヤーのレートを更新するハンドラー
+func CalculateRatingHandler(service RatingService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req RatingRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -20,19 +25,20 @@ func CalculateRatingHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// 勝者と敗者の現在のレートを取得
-		winnerRating := getPlayerRating(db, req.WinnerID)
-		loserRating := getPlayerRating(db, req.LoserID)
-
-		// レート変動を計算
-		expectedScore := 1.0 / (1.0 + math.Pow(10, float64(loserRating-winnerRating)/400.0))
-		ratingChange := int(math.Round(KFactor * (1.0 - expectedScore)))
-
-		winnerNewRating := winnerRating + ratingChange
-		loserNewRating := loserRating - ratingChange
+		result := MatchResult{
+			WinnerID: req.WinnerID,
+			LoserID:  req.LoserID,
+			GameType: NormalizeGameType(req.GameType),
+		}
+		if !IsKnownGameType(result.GameType) {
+			http.Error(w, "不明なゲームの種類です", http.StatusBadRequest)
+			return
+		}
+		if req.Draw {
+			result.Outcome = OutcomeDraw
+		}
 
-		// データベースを更新
-		err := updatePlayerRatings(db, req.WinnerID, winnerNewRating, req.LoserID, loserNewRating)
+		update, err := service.UpdateRatings(r.Context(), result)
 		if err != nil {
 			http.Error(w, "レートの更新に失敗しました", http.StatusInternalServerError)
 			return
@@ -40,83 +46,168 @@ func CalculateRatingHandler(db *sql.DB) http.HandlerFunc {
 
 		// レスポンスを返す
 		response := RatingResponse{
-			WinnerNewRating: winnerNewRating,
-			LoserNewRating:  loserNewRating,
-			RatingChange:    ratingChange,
+			WinnerNewRating: update.WinnerNewRating,
+			LoserNewRating:  update.LoserNewRating,
+			RatingChange:    update.RatingChange,
 		}
 		json.NewEncoder(w).Encode(response)
 	}
 }
 
-func getPlayerRating(db *sql.DB, username string) int {
-	var rating int
-	err := db.QueryRow("SELECT rating FROM player_ratings WHERE username = ?", username).Scan(&rating)
+// updateRatings 対戦結果から勝者と敗者のレートを計算して更新する
+// 引き分けの場合は両者のスコアを0.5として計算する
+// レートはゲームの種類ごとに別々に管理される
+// 読み取りから更新までを1つのトランザクションで行うので、同時に終わった対戦の更新が失われない
+func updateRatings(ctx context.Context, db *repository.DB, result MatchResult) (RatingUpdate, error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		// プレイヤーが見つからない場合は、デフォルトレートを返す
-		return DefaultRating
+		return RatingUpdate{}, err
 	}
-	return rating
+	defer tx.Rollback()
+
+	update, err := updateRatingsTx(ctx, tx, result)
+	if err != nil {
+		return RatingUpdate{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return RatingUpdate{}, err
+	}
+	update.applyToLeaderboard(NormalizeGameType(result.GameType), result)
+	return update, nil
+}
+
+// applyToLeaderboard コミット済みのレート変動をキャッシュしているランキングに反映する
+func (u RatingUpdate) applyToLeaderboard(gameType string, result MatchResult) {
+	leaderboards.update(gameType, result.WinnerID, u.WinnerNewRating)
+	leaderboards.update(gameType, result.LoserID, u.LoserNewRating)
 }
 
-func updatePlayerRatings(db *sql.DB, winnerID string, winnerNewRating int, loserID string, loserNewRating int) error {
-	tx, err := db.Begin()
+// updateRatingsTx 渡されたトランザクションの中でレートを計算して更新する
+// コミットは呼び出し側で行う
+func updateRatingsTx(ctx context.Context, tx *repository.Tx, result MatchResult) (RatingUpdate, error) {
+	gameType := NormalizeGameType(result.GameType)
+	config := ConfigFor(gameType)
+
+	// 勝者と敗者の現在のレートを取得
+	winner, err := getPlayerStateForUpdate(ctx, tx, result.WinnerID, gameType, config.InitialRating)
+	if err != nil {
+		return RatingUpdate{}, err
+	}
+	loser, err := getPlayerStateForUpdate(ctx, tx, result.LoserID, gameType, config.InitialRating)
 	if err != nil {
-		return err
+		return RatingUpdate{}, err
 	}
 
-	// 勝者のレートを更新
-	_, err = tx.Exec(`
-		INSERT INTO player_ratings (username, rating) 
-		VALUES (?, ?) 
-		ON DUPLICATE KEY UPDATE rating = ?`,
-		winnerID, winnerNewRating, winnerNewRating)
+	// 設定された方式でレート変動を計算
+	newWinner, newLoser := computeRatings(config, winner, loser, result.Outcome.winnerScore())
+	newWinner = scaleChange(winner, newWinner, result.kMultipliers[result.WinnerID])
+	newLoser = scaleChange(loser, newLoser, result.kMultipliers[result.LoserID])
+	newWinner = boundRating(config, winner, newWinner)
+	newLoser = boundRating(config, loser, newLoser)
+	newWinner.Tier = nextTier(winner.Tier, newWinner.Rating)
+	newLoser.Tier = nextTier(loser.Tier, newLoser.Rating)
+	newWinner.recordResult(result.Outcome == OutcomeWin)
+	newLoser.recordResult(false)
+	update := RatingUpdate{
+		WinnerOldRating: winner.Rating,
+		WinnerNewRating: newWinner.Rating,
+		LoserOldRating:  loser.Rating,
+		LoserNewRating:  newLoser.Rating,
+		RatingChange:    newWinner.Rating - winner.Rating,
+		WinnerTier:      newWinner.Tier,
+		LoserTier:       newLoser.Tier,
+		WinnerStreak:    newWinner.streak(),
+		LoserStreak:     newLoser.streak(),
+	}
+
+	// データベースを更新
+	if err := savePlayerState(ctx, tx, result.WinnerID, gameType, newWinner); err != nil {
+		return RatingUpdate{}, err
+	}
+	if err := savePlayerState(ctx, tx, result.LoserID, gameType, newLoser); err != nil {
+		return RatingUpdate{}, err
+	}
+	return update, nil
+}
+
+// computeRatings 勝者と敗者の対戦後のレートを計算する
+// winnerScoreは勝者側のスコア(勝ちは1、引き分けは0.5)
+func computeRatings(config RatingConfig, winner, loser playerState, winnerScore float64) (playerState, playerState) {
+	if config.Algorithm == AlgorithmGlicko2 {
+		return glicko2Update(winner, loser, winnerScore, config.Tau), glicko2Update(loser, winner, 1-winnerScore, config.Tau)
+	}
+
+	// Eloでは偏差と変動率は変更しない
+	change := calculateRatingChange(winner.Rating, loser.Rating, winnerScore, config)
+	winner.Rating += change
+	loser.Rating -= change
+	return winner, loser
+}
+
+// calculateRatingChange Eloレーティングで勝者が得るレート(敗者が失うレート)を計算する
+// 引き分け(score=0.5)ではレートの高い側が失う
+func calculateRatingChange(winnerRating, loserRating int, score float64, config RatingConfig) int {
+	expectedScore := 1.0 / (1.0 + math.Pow(10, float64(loserRating-winnerRating)/config.Scale))
+	return int(math.Round(config.KFactor * (score - expectedScore)))
+}
+
+func getPlayerRating(ctx context.Context, db *repository.DB, username, gameType string) int {
+	var rating int
+	err := db.QueryRowContext(ctx,
+		"SELECT rating FROM player_ratings WHERE username = ? AND game_type = ?",
+		username, gameType,
+	).Scan(&rating)
 	if err != nil {
-		tx.Rollback()
-		return err
+		// プレイヤーが見つからない場合は、デフォルトレートを返す
+		return ConfigFor(gameType).InitialRating
 	}
+	return rating
+}
 
-	// 敗者のレートを更新
-	_, err = tx.Exec(`
-		INSERT INTO player_ratings (username, rating) 
-		VALUES (?, ?) 
-		ON DUPLICATE KEY UPDATE rating = ?`,
-		loserID, loserNewRating, loserNewRating)
+// getPlayerStateForUpdate トランザクション内で行ロックを取ってレート・偏差・変動率を取得する
+func getPlayerStateForUpdate(ctx context.Context, tx *repository.Tx, username, gameType string, initialRating int) (playerState, error) {
+	var state playerState
+	var tier sql.NullString
+	err := tx.QueryRowContext(ctx,
+		"SELECT rating, tier, rating_deviation, volatility, current_streak, best_streak FROM player_ratings WHERE username = ? AND game_type = ?"+tx.Dialect().ForUpdate(),
+		username, gameType,
+	).Scan(&state.Rating, &tier, &state.Deviation, &state.Volatility, &state.CurrentStreak, &state.BestStreak)
+	if err == sql.ErrNoRows {
+		// プレイヤーが見つからない場合は、初期値を返す
+		return newPlayerState(initialRating), nil
+	}
 	if err != nil {
-		tx.Rollback()
-		return err
+		return playerState{}, err
+	}
+	state.Tier = tier.String
+	if !tier.Valid {
+		state.Tier = TierFor(state.Rating).Name
 	}
+	return state, nil
+}
 
-	return tx.Commit()
+func savePlayerState(ctx context.Context, tx *repository.Tx, username, gameType string, state playerState) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO player_ratings (username, game_type, rating, tier, rating_deviation, volatility, current_streak, best_streak) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`+tx.Dialect().Upsert([]string{"username", "game_type"}, `rating = VALUES(rating), tier = VALUES(tier),
+			rating_deviation = VALUES(rating_deviation), volatility = VALUES(volatility), current_streak = VALUES(current_streak), best_streak = VALUES(best_streak)`),
+		username, gameType, state.Rating, state.Tier, state.Deviation, state.Volatility, state.CurrentStreak, state.BestStreak)
+	return err
 }
 
 // レーティング上位10人のプレイヤーを返すハンドラー
-func GetTopPlayersHandler(db *sql.DB) http.HandlerFunc {
+// ?game_type= でゲームの種類を指定できる(デフォルト: quiz)
+func GetTopPlayersHandler(ratings repository.RatingRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		gameType := NormalizeGameType(r.URL.Query().Get("game_type"))
+
 		// 上位10人のプレイヤーを取得
-		rows, err := db.Query(`
-			SELECT username, rating 
-			FROM player_ratings 
-			ORDER BY rating DESC 
-			LIMIT 10
-		`)
+		topPlayers, err := ratings.Top(r.Context(), gameType, 10)
 		if err != nil {
 			http.Error(w, "ランキングの取得に失敗しました", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		// 結果を格納するスライス
-		var topPlayers []PlayerRating
-
-		// 結果を処理
-		for rows.Next() {
-			var player PlayerRating
-			if err := rows.Scan(&player.Username, &player.Rating); err != nil {
-				http.Error(w, "データの読み取りに失敗しました", http.StatusInternalServerError)
-				return
-			}
-			topPlayers = append(topPlayers, player)
-		}
 
 		// レスポンスを返す
 		w.Header().Set("Content-Type", "application/json")
@@ -124,34 +215,34 @@ func GetTopPlayersHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GetPlayerRating プレイヤーのレートを取得する関数を公開
-func GetPlayerRating(db *sql.DB, username string) int {
-	return getPlayerRating(db, username)
-}
-
-// UpdatePlayerRatings レートを更新する関数を公開
-func UpdatePlayerRatings(db *sql.DB, winnerID string, winnerNewRating int, loserID string, loserNewRating int) error {
-	return updatePlayerRatings(db, winnerID, winnerNewRating, loserID, loserNewRating)
-}
-
 // GetUserRatingHandler ログインしているユーザーのレートを返すハンドラー
-func GetUserRatingHandler(db *sql.DB) http.HandlerFunc {
+func GetUserRatingHandler(ratings repository.RatingRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// クッキーからユーザー名を取得
-		cookie, err := r.Cookie("username")
-		if err != nil {
+		// トークンからユーザー名を取得
+		username, ok := auth.UserID(r)
+		if !ok {
 			http.Error(w, "ログインが必要です", http.StatusUnauthorized)
 			return
 		}
 
 		// ユーザーのレートを取得
-		rating := getPlayerRating(db, cookie.Value)
+		gameType := NormalizeGameType(r.URL.Query().Get("game_type"))
+		rating, found, err := ratings.Rating(r.Context(), username, gameType)
+		if err != nil {
+			http.Error(w, "レートの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		// まだ対戦していない場合はデフォルトレートを返す
+		if !found {
+			rating = ConfigFor(gameType).InitialRating
+		}
 
 		// レスポンスを返す
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"username": cookie.Value,
-			"rating":   rating,
+			"username":  username,
+			"game_type": gameType,
+			"rating":    rating,
 		})
 	}
 }
@@ -0,0 +1,168 @@
+package rate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sys3/api/auth"
+	"sys3/api/repository"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestRatings レートを設定したメモリ上のRatingRepositoryを作成する
+// ランキングはパッケージ全体でキャッシュしているため、前のテストの内容を破棄しておく
+func newTestRatings(t *testing.T, ratings map[string]int) *repository.MemoryRatingRepository {
+	t.Helper()
+	InvalidateLeaderboards()
+	t.Cleanup(InvalidateLeaderboards)
+	repo := repository.NewMemoryRatingRepository()
+	for username, rating := range ratings {
+		repo.SetRating(username, repository.PlayerGameRating{GameType: DefaultGameType, Rating: rating})
+	}
+	return repo
+}
+
+// get targetへのGETリクエストをhandlerに渡す。usernameが空でなければログインした状態にする
+func get(handler http.HandlerFunc, target, username string, vars map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if username != "" {
+		claims := &auth.Claims{}
+		claims.Subject = username
+		req = req.WithContext(auth.WithClaims(req.Context(), claims))
+	}
+	req = mux.SetURLVars(req, vars)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestLeaderboardHandler(t *testing.T) {
+	ratings := newTestRatings(t, map[string]int{"alice": 1600, "bob": 1500, "carol": 1500, "dave": 1400})
+
+	response := decode[LeaderboardResponse](t, get(LeaderboardHandler(ratings), "/leaderboard?per_page=2&page=2", "", nil))
+	if response.Total != 4 {
+		t.Errorf("Total = %d, want 4", response.Total)
+	}
+	want := []LeaderboardEntry{{Rank: 2, Username: "carol", Rating: 1500}, {Rank: 4, Username: "dave", Rating: 1400}}
+	if len(response.Entries) != len(want) {
+		t.Fatalf("Entries = %+v, want %+v", response.Entries, want)
+	}
+	for i := range want {
+		if response.Entries[i] != want[i] {
+			t.Errorf("Entries[%d] = %+v, want %+v", i, response.Entries[i], want[i])
+		}
+	}
+
+	if rec := get(LeaderboardHandler(ratings), "/leaderboard?around_me=true", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("around_me without login: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := get(LeaderboardHandler(ratings), "/leaderboard?around_me=true", "erin", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("around_me unranked: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	response = decode[LeaderboardResponse](t, get(LeaderboardHandler(ratings), "/leaderboard?around_me=true", "dave", nil))
+	if response.AroundMe != "dave" || len(response.Entries) != 4 {
+		t.Errorf("around_me = %+v, want all 4 entries around dave", response)
+	}
+}
+
+func TestPlayerRankHandler(t *testing.T) {
+	ratings := newTestRatings(t, map[string]int{"alice": 1600, "bob": 1500, "carol": 1500, "dave": 1400})
+
+	rank := decode[PlayerRank](t, get(PlayerRankHandler(ratings), "/players/carol/rank", "", map[string]string{"id": "carol"}))
+	if rank.Rank != 2 || rank.Total != 4 || rank.Percentile != 50 {
+		t.Errorf("rank = %+v, want rank 2 of 4 (50%%)", rank)
+	}
+	if rec := get(PlayerRankHandler(ratings), "/players/erin/rank", "", map[string]string{"id": "erin"}); rec.Code != http.StatusNotFound {
+		t.Errorf("unranked: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestPlayerProfileHandler(t *testing.T) {
+	ratings := newTestRatings(t, nil)
+	ratings.SetRating("alice", repository.PlayerGameRating{GameType: DefaultGameType, Rating: 1600, CurrentStreak: 2, BestStreak: 3})
+
+	profile := decode[PlayerProfile](t, get(PlayerProfileHandler(ratings), "/players/alice/profile", "", map[string]string{"id": "alice"}))
+	if len(profile.Ratings) != 1 {
+		t.Fatalf("Ratings = %+v, want 1", profile.Ratings)
+	}
+	got := profile.Ratings[0]
+	// ランク帯を保存していなければレートから求める
+	if got.Tier != TierFor(1600).Name || got.Streak != (Streak{Current: 2, Best: 3}) {
+		t.Errorf("rating = %+v", got)
+	}
+}
+
+func TestPlayerStatsHandler(t *testing.T) {
+	ratings := newTestRatings(t, nil)
+	ratings.SetStats("alice", repository.PlayerGameStats{GameType: "a", GamesPlayed: 1, Wins: 1, TotalScore: 3, Buzzes: 2, CorrectAnswers: 1, TotalBuzzMs: 1000})
+	ratings.SetStats("alice", repository.PlayerGameStats{GameType: "b", GamesPlayed: 3, Wins: 1, Losses: 2, TotalScore: 3, Buzzes: 2, CorrectAnswers: 2, TotalBuzzMs: 1000})
+	ratings.SetFavoriteCategory("alice", "History")
+
+	stats := decode[PlayerStats](t, get(PlayerStatsHandler(ratings), "/players/alice/stats", "", map[string]string{"id": "alice"}))
+	if stats.GamesPlayed != 4 || stats.Wins != 2 || stats.WinRate != 0.5 || stats.AvgBuzzMs != 500 {
+		t.Errorf("total = %+v", stats.GameTypeStats)
+	}
+	if stats.FavoriteCategory != "History" || len(stats.GameTypes) != 2 {
+		t.Errorf("stats = %+v, want favorite History and 2 game types", stats)
+	}
+}
+
+func TestCalculateRatingHandler(t *testing.T) {
+	service := NewMemoryService()
+	service.SetRating("alice", DefaultGameType, 1500)
+	service.SetRating("bob", DefaultGameType, 1500)
+
+	req := httptest.NewRequest(http.MethodPost, "/rate/calculate", strings.NewReader(`{"winner_id":"alice","loser_id":"bob"}`))
+	rec := httptest.NewRecorder()
+	CalculateRatingHandler(service)(rec, req)
+	response := decode[RatingResponse](t, rec)
+	if response.RatingChange <= 0 || response.WinnerNewRating != 1500+response.RatingChange {
+		t.Errorf("response = %+v", response)
+	}
+	if got := service.Rating(req.Context(), "bob", DefaultGameType); got != response.LoserNewRating {
+		t.Errorf("bob's rating = %d, want %d", got, response.LoserNewRating)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/rate/calculate", strings.NewReader(`{"winner_id":"alice","loser_id":"bob","game_type":"unknown"}`))
+	rec = httptest.NewRecorder()
+	CalculateRatingHandler(service)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown game type: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCalculateRatingChange(t *testing.T) {
+	config := ConfigFor(DefaultGameType)
+	tests := []struct {
+		name   string
+		winner int
+		loser  int
+		score  float64
+		want   int
+	}{
+		{"同じレートの勝ちは半分", 1500, 1500, 1, int(config.KFactor / 2)},
+		{"同じレートの引き分けは変動しない", 1500, 1500, 0.5, 0},
+		{"格上との引き分けは上がる", 1300, 1700, 0.5, 13},
+		{"格下との引き分けは下がる", 1700, 1300, 0.5, -13},
+	}
+	for _, tt := range tests {
+		if got := calculateRatingChange(tt.winner, tt.loser, tt.score, config); got != tt.want {
+			t.Errorf("%s: change = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
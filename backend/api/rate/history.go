@@ -0,0 +1,159 @@
+package rate
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 100
+)
+
+// parseTimeParam RFC3339か日付(2006-01-02)を受け付ける
+func parseTimeParam(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// PlayerMatchesHandler プレイヤーの対戦履歴を新しい順に返すハンドラー(GET /players/{id}/matches)
+// クエリパラメータ:
+//   - game_type: ゲームの種類
+//   - from, to: 対戦が終わった日時の範囲(RFC3339 または 2006-01-02。toの日付はその日を含む)
+//   - result: win, loss, draw
+//   - page, per_page: ページ番号(1から)と1ページあたりの件数
+func PlayerMatchesHandler(matches repository.MatchRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := repository.MatchFilter{Username: mux.Vars(r)["id"]}
+
+		if gameType := query.Get("game_type"); gameType != "" {
+			filter.GameType = NormalizeGameType(gameType)
+			if !IsKnownGameType(filter.GameType) {
+				http.Error(w, "不明なゲームの種類です", http.StatusBadRequest)
+				return
+			}
+		}
+		if value := query.Get("from"); value != "" {
+			from, ok := parseTimeParam(value)
+			if !ok {
+				http.Error(w, "fromの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			filter.From = from
+		}
+		if value := query.Get("to"); value != "" {
+			to, ok := parseTimeParam(value)
+			if !ok {
+				http.Error(w, "toの形式が正しくありません", http.StatusBadRequest)
+				return
+			}
+			if !strings.Contains(value, "T") {
+				to = to.AddDate(0, 0, 1)
+			}
+			filter.To = to
+		}
+		switch result := query.Get("result"); result {
+		case "", repository.ResultWin, repository.ResultLoss, repository.ResultDraw:
+			filter.Result = result
+		default:
+			http.Error(w, "resultはwin, loss, drawのいずれかです", http.StatusBadRequest)
+			return
+		}
+
+		perPage := parsePositiveInt(query.Get("per_page"), defaultHistoryPageSize)
+		if perPage > maxHistoryPageSize {
+			perPage = maxHistoryPageSize
+		}
+		page := parsePositiveInt(query.Get("page"), 1)
+		filter.Limit = perPage
+		filter.Offset = (page - 1) * perPage
+
+		list, total, err := matches.ListByPlayer(r.Context(), filter)
+		if err != nil {
+			http.Error(w, "対戦履歴の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MatchHistoryResponse{
+			PlayerID: filter.Username,
+			Page:     page,
+			PerPage:  perPage,
+			Total:    total,
+			Matches:  list,
+		})
+	}
+}
+
+// MatchDetailHandler 対戦の結果と両プレイヤーのレート変動を返すハンドラー(GET /matches/{id})
+func MatchDetailHandler(matches repository.MatchRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		matchID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "対戦IDが正しくありません", http.StatusBadRequest)
+			return
+		}
+
+		detail, err := matches.Get(r.Context(), matchID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "対戦が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "対戦の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
+
+// MatchReplay 対戦の詳細と問題ごとの回答
+type MatchReplay struct {
+	repository.MatchDetail
+	Answers []repository.MatchAnswer `json:"answers"`
+}
+
+// MatchReplayHandler 対戦を振り返るための問題ごとの回答を返すハンドラー(GET /matches/{id}/replay)
+// 回答権を取れなかった要求も含むので、不正の確認にも使える
+func MatchReplayHandler(matches repository.MatchRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		matchID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "対戦IDが正しくありません", http.StatusBadRequest)
+			return
+		}
+
+		detail, err := matches.Get(r.Context(), matchID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "対戦が見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "対戦の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		answers, err := matches.Answers(r.Context(), matchID)
+		if err != nil {
+			http.Error(w, "回答の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MatchReplay{MatchDetail: detail, Answers: answers})
+	}
+}
@@ -0,0 +1,144 @@
+package rate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sys3/api/auth"
+	"sys3/api/repository"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultLeaderboardPageSize = 20
+	maxLeaderboardPageSize     = 100
+	defaultAroundMeRadius      = 5 // around_meで自分の前後に表示する人数
+)
+
+// LeaderboardHandler ランキングを返すハンドラー
+// クエリパラメータ:
+//   - game_type: ゲームの種類(デフォルト: quiz)
+//   - page, per_page: ページ番号(1から)と1ページあたりの件数
+//   - around_me=true: ログイン中のユーザーの前後の順位を返す
+func LeaderboardHandler(ratings repository.RatingRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		gameType := NormalizeGameType(query.Get("game_type"))
+		if !IsKnownGameType(gameType) {
+			http.Error(w, "不明なゲームの種類です", http.StatusBadRequest)
+			return
+		}
+
+		perPage := parsePositiveInt(query.Get("per_page"), defaultLeaderboardPageSize)
+		if perPage > maxLeaderboardPageSize {
+			perPage = maxLeaderboardPageSize
+		}
+		page := parsePositiveInt(query.Get("page"), 1)
+		offset := (page - 1) * perPage
+
+		response := LeaderboardResponse{
+			GameType: gameType,
+			Page:     page,
+			PerPage:  perPage,
+		}
+
+		if query.Get("around_me") == "true" {
+			username, ok := auth.UserID(r)
+			if !ok {
+				http.Error(w, "ログインが必要です", http.StatusUnauthorized)
+				return
+			}
+
+			var position int
+			var found bool
+			err := leaderboards.view(r.Context(), ratings, gameType, func(b *leaderboard) {
+				position, found = b.position(username)
+			})
+			if err != nil {
+				http.Error(w, "ランキングの取得に失敗しました", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "まだランキングに登録されていません", http.StatusNotFound)
+				return
+			}
+
+			// 自分の前後defaultAroundMeRadius人を返す
+			offset = position - defaultAroundMeRadius
+			if offset < 0 {
+				offset = 0
+			}
+			perPage = defaultAroundMeRadius*2 + 1
+			response.Page = 0
+			response.PerPage = perPage
+			response.AroundMe = username
+		}
+
+		// 毎回テーブル全体を並び替えないよう、キャッシュしたランキングから返す
+		err := leaderboards.view(r.Context(), ratings, gameType, func(b *leaderboard) {
+			response.Total = len(b.entries)
+			response.Entries = b.page(offset, perPage)
+		})
+		if err != nil {
+			http.Error(w, "ランキングの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// parsePositiveInt 正の整数に変換できなければdefaultValueを返す
+func parsePositiveInt(value string, defaultValue int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return defaultValue
+	}
+	return n
+}
+
+// PlayerRankHandler プレイヤーの順位と上位何パーセントかを返すハンドラー
+// ?game_type= でゲームの種類を指定できる(デフォルト: quiz)
+func PlayerRankHandler(ratings repository.RatingRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["id"]
+		gameType := NormalizeGameType(r.URL.Query().Get("game_type"))
+		if !IsKnownGameType(gameType) {
+			http.Error(w, "不明なゲームの種類です", http.StatusBadRequest)
+			return
+		}
+
+		response := PlayerRank{
+			Username: username,
+			GameType: gameType,
+		}
+		var found bool
+		err := leaderboards.view(r.Context(), ratings, gameType, func(b *leaderboard) {
+			position, ok := b.position(username)
+			if !ok {
+				return
+			}
+			found = true
+			response.Rating = b.entries[position].Rating
+			response.Rank = b.rankAt(position)
+			response.Total = len(b.entries)
+		})
+		if err != nil {
+			http.Error(w, "順位の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "まだランキングに登録されていません", http.StatusNotFound)
+			return
+		}
+
+		// 自分より下の順位のプレイヤーの割合
+		response.Percentile = float64(response.Total-response.Rank) / float64(response.Total) * 100
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,229 @@
+package rate
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// leaderboardCache ゲームの種類ごとのランキングをメモリ上に保持する
+// レートが更新されるたびに差分で並び替え、定期的にデータベースから作り直す
+// 他のサーバーやシーズンのリセットによる変更は、次の作り直しで反映される
+type leaderboardCache struct {
+	mu      sync.RWMutex
+	boards  map[string]*leaderboard
+	loading map[string]*pendingUpdates // データベースから読み込んでいる最中のゲームの種類
+}
+
+// pendingUpdates 読み込みを始めてから反映されたレートの更新
+// 読み込んだランキングに差し替えるときに適用し直して、読み込み中の更新が失われないようにする
+type pendingUpdates struct {
+	loads   int // 読み込み中の数
+	updates []LeaderboardEntry
+}
+
+// leaderboard 1つのゲームの種類のランキング
+// entriesはレートの降順、同じレートはユーザー名順(leaderboardPageと同じ並び順)
+type leaderboard struct {
+	entries []LeaderboardEntry
+	ratings map[string]int
+}
+
+var leaderboards = &leaderboardCache{boards: make(map[string]*leaderboard), loading: make(map[string]*pendingUpdates)}
+
+func entryLess(rating int, username string, e LeaderboardEntry) bool {
+	if rating != e.Rating {
+		return rating > e.Rating
+	}
+	return username < e.Username
+}
+
+// search entriesの中でratingとusernameが入る位置を返す
+func (b *leaderboard) search(rating int, username string) int {
+	return sort.Search(len(b.entries), func(i int) bool {
+		return !entryLess(b.entries[i].Rating, b.entries[i].Username, LeaderboardEntry{Rating: rating, Username: username})
+	})
+}
+
+// set プレイヤーのレートを差し替えて並び順を保つ
+func (b *leaderboard) set(username string, rating int) {
+	if old, ok := b.ratings[username]; ok {
+		i := b.search(old, username)
+		b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	}
+	i := b.search(rating, username)
+	b.entries = append(b.entries, LeaderboardEntry{})
+	copy(b.entries[i+1:], b.entries[i:])
+	b.entries[i] = LeaderboardEntry{Username: username, Rating: rating}
+	b.ratings[username] = rating
+}
+
+// rankAt 先頭からi番目のプレイヤーの順位を返す
+// RANK()と同じく、同じレートのプレイヤーは同じ順位になる
+func (b *leaderboard) rankAt(i int) int {
+	rating := b.entries[i].Rating
+	return sort.Search(len(b.entries), func(j int) bool {
+		return b.entries[j].Rating <= rating
+	}) + 1
+}
+
+// page offsetからlimit件を順位付きで返す
+func (b *leaderboard) page(offset, limit int) []LeaderboardEntry {
+	entries := []LeaderboardEntry{}
+	for i := offset; i < len(b.entries) && i < offset+limit; i++ {
+		entry := b.entries[i]
+		entry.Rank = b.rankAt(i)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// position ユーザーがランキングの先頭から何番目にいるか(0始まり)を返す
+func (b *leaderboard) position(username string) (int, bool) {
+	rating, ok := b.ratings[username]
+	if !ok {
+		return 0, false
+	}
+	return b.search(rating, username), true
+}
+
+// loadLeaderboard データベースからランキングを読み込む
+func loadLeaderboard(ctx context.Context, ratings repository.RatingRepository, gameType string) (*leaderboard, error) {
+	players, err := ratings.Leaderboard(ctx, gameType)
+	if err != nil {
+		return nil, err
+	}
+	b := &leaderboard{ratings: make(map[string]int, len(players))}
+	for _, p := range players {
+		b.entries = append(b.entries, LeaderboardEntry{Username: p.Username, Rating: p.Rating})
+		b.ratings[p.Username] = p.Rating
+	}
+	return b, nil
+}
+
+// view ランキングを読み取り用のロックを取った状態でfnに渡す
+// まだ読み込んでいないゲームの種類はデータベースから読み込む
+func (c *leaderboardCache) view(ctx context.Context, ratings repository.RatingRepository, gameType string, fn func(b *leaderboard)) error {
+	c.mu.RLock()
+	b, ok := c.boards[gameType]
+	if ok {
+		fn(b)
+		c.mu.RUnlock()
+		return nil
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	start := c.beginLoad(gameType)
+	c.mu.Unlock()
+	loaded, err := loadLeaderboard(ctx, ratings, gameType)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endLoad(gameType, start, loaded)
+	if err != nil {
+		return err
+	}
+	if b, ok = c.boards[gameType]; !ok {
+		b = loaded
+		c.boards[gameType] = b
+	}
+	fn(b)
+	return nil
+}
+
+// beginLoad データベースからの読み込みを始める前に、それ以降の更新を記録するようにする
+// 戻り値はendLoadに渡す。c.muをロックしてから呼ぶこと
+func (c *leaderboardCache) beginLoad(gameType string) int {
+	p, ok := c.loading[gameType]
+	if !ok {
+		p = &pendingUpdates{}
+		c.loading[gameType] = p
+	}
+	p.loads++
+	return len(p.updates)
+}
+
+// endLoad 読み込みを始めてから記録された更新をloadedに適用する
+// 読み込みに失敗してloadedがnilの場合も必ず呼ぶこと。c.muをロックしてから呼ぶこと
+func (c *leaderboardCache) endLoad(gameType string, start int, loaded *leaderboard) {
+	p := c.loading[gameType]
+	if loaded != nil {
+		for _, u := range p.updates[start:] {
+			loaded.set(u.Username, u.Rating)
+		}
+	}
+	p.loads--
+	if p.loads == 0 {
+		delete(c.loading, gameType)
+	}
+}
+
+// update レートの更新をランキングに反映する
+// まだ読み込んでいないゲームの種類は次に参照したときに読み込むので何もしない
+// 読み込み中のゲームの種類は、読み込み終わったランキングにも適用するために記録しておく
+func (c *leaderboardCache) update(gameType, username string, rating int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b, ok := c.boards[gameType]; ok {
+		b.set(username, rating)
+	}
+	if p, ok := c.loading[gameType]; ok {
+		p.updates = append(p.updates, LeaderboardEntry{Username: username, Rating: rating})
+	}
+}
+
+// rebuild 読み込み済みの全てのランキングをデータベースから作り直す
+// 読み込んでいる間に反映された更新は、差し替える前に適用し直す
+func (c *leaderboardCache) rebuild(ratings repository.RatingRepository) {
+	c.mu.RLock()
+	gameTypes := make([]string, 0, len(c.boards))
+	for gameType := range c.boards {
+		gameTypes = append(gameTypes, gameType)
+	}
+	c.mu.RUnlock()
+
+	for _, gameType := range gameTypes {
+		c.mu.Lock()
+		start := c.beginLoad(gameType)
+		c.mu.Unlock()
+
+		ctx, cancel := repository.WithTimeout(context.Background())
+		b, err := loadLeaderboard(ctx, ratings, gameType)
+		cancel()
+
+		c.mu.Lock()
+		c.endLoad(gameType, start, b)
+		if err == nil {
+			c.boards[gameType] = b
+		}
+		c.mu.Unlock()
+		if err != nil {
+			slog.Error("ランキングの再構築エラー", "game_type", gameType, logging.Err(err))
+		}
+	}
+}
+
+// InvalidateLeaderboards キャッシュしているランキングを全て破棄する
+// シーズンのリセットなど、レートをまとめて書き換えた後に呼び出す
+func InvalidateLeaderboards() {
+	leaderboards.mu.Lock()
+	defer leaderboards.mu.Unlock()
+	leaderboards.boards = make(map[string]*leaderboard)
+}
+
+// StartLeaderboardRebuild ランキングを定期的にデータベースから作り直すゴルーチンを起動する
+func StartLeaderboardRebuild(ratings repository.RatingRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			leaderboards.rebuild(ratings)
+		}
+	}()
+}
@@ -0,0 +1,258 @@
+package rate
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sys3/api/logging"
+	"sys3/api/repository"
+	"time"
+)
+
+// finalizeMatch 対戦記録の保存、両プレイヤーのレート更新、レート履歴の保存を1つのトランザクションで行う
+// 途中で失敗した場合は全てロールバックされるので、片方のレートだけが更新されることはない
+func finalizeMatch(ctx context.Context, db *repository.DB, record MatchRecord) (int64, RatingUpdate, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, RatingUpdate{}, err
+	}
+	defer tx.Rollback()
+
+	record.GameType = NormalizeGameType(record.GameType)
+	// 再試行の前に保存が完了していた場合は、保存済みの結果を返す
+	if matchID, found, err := findMatchByKey(ctx, tx, record.MatchKey); err != nil || found {
+		if err != nil {
+			return 0, RatingUpdate{}, err
+		}
+		update, err := storedRatingUpdate(ctx, tx, matchID, record)
+		return matchID, update, err
+	}
+	matchID, err := insertMatch(ctx, tx, record, true)
+	if err != nil {
+		return 0, RatingUpdate{}, err
+	}
+
+	// 序盤の試合で実力がランク帯を大きく上回るプレイヤーは、レートを早く適正な位置まで上げる
+	record.kMultipliers = make(map[string]float64)
+	for _, username := range []string{record.WinnerID, record.LoserID} {
+		won := record.Outcome == OutcomeWin && username == record.WinnerID
+		multiplier, err := detectSmurf(ctx, tx, username, record.GameType, getPlayerRatingTx(ctx, tx, username, record.GameType), won, record.answerMsOf(username))
+		if err != nil {
+			return 0, RatingUpdate{}, err
+		}
+		record.kMultipliers[username] = multiplier
+	}
+
+	update, err := updateRatingsTx(ctx, tx, record.MatchResult)
+	if err != nil {
+		return 0, RatingUpdate{}, err
+	}
+
+	// レート履歴
+	if err := saveRatingHistory(ctx, tx, matchID, record.WinnerID, record.GameType, update.WinnerOldRating, update.WinnerNewRating, record.answerMsOf(record.WinnerID)); err != nil {
+		return 0, RatingUpdate{}, err
+	}
+	if err := saveRatingHistory(ctx, tx, matchID, record.LoserID, record.GameType, update.LoserOldRating, update.LoserNewRating, record.answerMsOf(record.LoserID)); err != nil {
+		return 0, RatingUpdate{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, RatingUpdate{}, err
+	}
+	update.applyToLeaderboard(record.GameType, record.MatchResult)
+	return matchID, update, nil
+}
+
+// recordCasualMatch レートの変動しないカジュアル戦の対戦記録を保存する
+func recordCasualMatch(ctx context.Context, db *repository.DB, record MatchRecord) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	record.GameType = NormalizeGameType(record.GameType)
+	if matchID, found, err := findMatchByKey(ctx, tx, record.MatchKey); err != nil || found {
+		return matchID, err
+	}
+	matchID, err := insertMatch(ctx, tx, record, false)
+	if err != nil {
+		return 0, err
+	}
+	return matchID, tx.Commit()
+}
+
+// findMatchByKey MatchKeyが同じ対戦が保存済みかを確認する
+func findMatchByKey(ctx context.Context, tx *repository.Tx, key string) (int64, bool, error) {
+	if key == "" {
+		return 0, false, nil
+	}
+	var id int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM matches WHERE match_key = ?", key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// storedRatingUpdate 保存済みの対戦のレート変動をレート履歴から組み立てる
+// ランク帯と連勝数は現在の値を返す
+func storedRatingUpdate(ctx context.Context, tx *repository.Tx, matchID int64, record MatchRecord) (RatingUpdate, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT username, old_rating, new_rating FROM rating_history WHERE match_id = ?",
+		matchID,
+	)
+	if err != nil {
+		return RatingUpdate{}, err
+	}
+	defer rows.Close()
+
+	var update RatingUpdate
+	for rows.Next() {
+		var username string
+		var oldRating, newRating int
+		if err := rows.Scan(&username, &oldRating, &newRating); err != nil {
+			return RatingUpdate{}, err
+		}
+		if username == record.WinnerID {
+			update.WinnerOldRating, update.WinnerNewRating = oldRating, newRating
+		} else {
+			update.LoserOldRating, update.LoserNewRating = oldRating, newRating
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return RatingUpdate{}, err
+	}
+	update.RatingChange = update.WinnerNewRating - update.WinnerOldRating
+
+	initialRating := ConfigFor(record.GameType).InitialRating
+	winner, err := getPlayerStateForUpdate(ctx, tx, record.WinnerID, record.GameType, initialRating)
+	if err != nil {
+		return RatingUpdate{}, err
+	}
+	loser, err := getPlayerStateForUpdate(ctx, tx, record.LoserID, record.GameType, initialRating)
+	if err != nil {
+		return RatingUpdate{}, err
+	}
+	update.WinnerTier, update.WinnerStreak = winner.Tier, winner.streak()
+	update.LoserTier, update.LoserStreak = loser.Tier, loser.streak()
+	return update, nil
+}
+
+func insertMatch(ctx context.Context, tx *repository.Tx, record MatchRecord, rated bool) (int64, error) {
+	// 引き分けの場合は勝者を記録しない
+	var winnerID sql.NullString
+	if record.Outcome == OutcomeWin {
+		winnerID = sql.NullString{String: record.WinnerID, Valid: true}
+	}
+	var startedAt sql.NullTime
+	if !record.StartedAt.IsZero() {
+		startedAt = sql.NullTime{Time: record.StartedAt, Valid: true}
+	}
+	matchKey := sql.NullString{String: record.MatchKey, Valid: record.MatchKey != ""}
+	matchID, err := tx.InsertID(ctx, `
+		INSERT INTO matches (game_type, rated, player1_id, player2_id, player1_score, player2_score, winner_id, started_at, match_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.GameType, rated, record.Player1ID, record.Player2ID, record.Player1Score, record.Player2Score, winnerID, startedAt, matchKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveMatchAnswers(ctx, tx, matchID, record.Answers); err != nil {
+		return 0, err
+	}
+	if err := updatePlayerStats(ctx, tx, record); err != nil {
+		return 0, err
+	}
+	return matchID, nil
+}
+
+// saveMatchAnswers 問題ごとの回答を対戦記録に紐付けて保存する
+func saveMatchAnswers(ctx context.Context, tx *repository.Tx, matchID int64, answers []AnswerRecord) error {
+	for i, a := range answers {
+		playerID := sql.NullString{String: a.PlayerID, Valid: a.PlayerID != ""}
+		latency := sql.NullInt64{Int64: int64(a.LatencyMs), Valid: a.PlayerID != ""}
+		version := sql.NullInt64{Int64: int64(a.QuestionVersion), Valid: a.QuestionVersion > 0}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO match_answers (match_id, question_no, question_id, question_version, player_id, answer, correct, latency_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			matchID, i+1, a.QuestionID, version, playerID, a.Answer, a.Correct, latency)
+		if err != nil {
+			return err
+		}
+		for _, b := range a.Buzzes {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO match_buzzes (match_id, question_no, player_id, latency_ms, granted) VALUES (?, ?, ?, ?, ?)",
+				matchID, i+1, b.PlayerID, b.LatencyMs, b.Granted)
+			if err != nil {
+				return err
+			}
+		}
+		if err := updateQuestionStats(ctx, tx, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateQuestionStats 問題ごとの回答の集計に1回分の出題を加える
+func updateQuestionStats(ctx context.Context, tx *repository.Tx, a AnswerRecord) error {
+	answered, correct, answerMs := 0, 0, 0
+	if a.PlayerID != "" {
+		answered, answerMs = 1, a.LatencyMs
+		if a.Correct {
+			correct = 1
+		}
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO question_stats (question_id, times_shown, times_answered, times_correct, total_answer_ms)
+		VALUES (?, 1, ?, ?, ?)`+tx.Dialect().Upsert([]string{"question_id"}, `times_shown = question_stats.times_shown + 1,
+			times_answered = question_stats.times_answered + VALUES(times_answered), times_correct = question_stats.times_correct + VALUES(times_correct),
+			total_answer_ms = question_stats.total_answer_ms + VALUES(total_answer_ms)`),
+		a.QuestionID, answered, correct, answerMs)
+	return err
+}
+
+// StartGuestMatchCleanup 保存期間を過ぎたゲストの対戦記録を定期的に削除するゴルーチンを起動する
+func StartGuestMatchCleanup(matches repository.MatchRepository, prefix string, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := repository.WithTimeout(context.Background())
+			n, err := matches.DeleteGuestMatches(ctx, prefix, time.Now().Add(-retention))
+			cancel()
+			if err != nil {
+				slog.Error("ゲストの対戦記録の削除エラー", logging.Err(err))
+				continue
+			}
+			if n > 0 {
+				slog.Info("ゲストの対戦記録を削除しました", "deleted", n)
+			}
+		}
+	}()
+}
+
+func saveRatingHistory(ctx context.Context, tx *repository.Tx, matchID int64, username, gameType string, oldRating, newRating, answerMs int) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO rating_history (match_id, username, game_type, old_rating, new_rating, answer_ms)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		matchID, username, gameType, oldRating, newRating, nullIfZero(float64(answerMs)))
+	return err
+}
+
+// getPlayerRatingTx トランザクションの中で現在のレートを取得する
+// まだ対戦していない場合は初期レートを返す
+func getPlayerRatingTx(ctx context.Context, tx *repository.Tx, username, gameType string) int {
+	var rating int
+	err := tx.QueryRowContext(ctx,
+		"SELECT rating FROM player_ratings WHERE username = ? AND game_type = ?",
+		username, gameType,
+	).Scan(&rating)
+	if err != nil {
+		return ConfigFor(gameType).InitialRating
+	}
+	return rating
+}
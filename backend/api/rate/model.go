@@ -1,9 +1,15 @@
 package rate
 
+import (
+	"sys3/api/repository"
+	"time"
+)
+
 type RatingRequest struct {
 	WinnerID string `json:"winner_id"`
 	LoserID  string `json:"loser_id"`
 	GameType string `json:"game_type"` // ここは今のところ"quiz"固定
+	Draw     bool   `json:"draw"`      // 引き分けの場合はtrue(winner_id/loser_idは対戦者2人)
 }
 
 type RatingResponse struct {
@@ -12,6 +18,136 @@ type RatingResponse struct {
 	RatingChange    int `json:"rating_change"`
 }
 
+// Outcome 対戦結果の種類
+type Outcome int
+
+const (
+	OutcomeWin  Outcome = iota // WinnerIDの勝ち
+	OutcomeDraw                // 引き分け
+)
+
+// winnerScore WinnerID側のスコア(勝ちは1、引き分けは0.5)
+func (o Outcome) winnerScore() float64 {
+	if o == OutcomeDraw {
+		return 0.5
+	}
+	return 1
+}
+
+// MatchResult レート更新に使う対戦結果
+// 引き分けの場合、WinnerIDとLoserIDには対戦者2人をそれぞれ入れる
+type MatchResult struct {
+	WinnerID string
+	LoserID  string
+	GameType string
+	Outcome  Outcome
+
+	// プレイヤーごとのレート変動の倍率(サブアカウントの判定で使う)
+	kMultipliers map[string]float64
+}
+
+// MatchRecord 保存する対戦記録
+// MatchResultに加えて、記録用に対戦時の席順とスコアを持つ
+type MatchRecord struct {
+	MatchResult
+	Player1ID    string
+	Player2ID    string
+	Player1Score int
+	Player2Score int
+	StartedAt    time.Time // 対戦が始まった日時。ゼロ値は記録しない
+	// 回答権を得るまでの平均時間(ミリ秒)。0は回答権を得ていない
+	Player1AnswerMs int
+	Player2AnswerMs int
+
+	// MatchKey 対戦ごとに一意なキー(部屋ID)
+	// 保存を再試行したときに同じ対戦を二重に記録しないために使う。空の場合は確認しない
+	MatchKey string
+	// Answers 問題ごとの回答(出題順)
+	Answers []AnswerRecord
+}
+
+// AnswerRecord 1問ごとの回答の記録
+type AnswerRecord struct {
+	QuestionID      int
+	QuestionVersion int    // 出題した問題の版
+	PlayerID        string // 回答権を得たプレイヤー。誰も回答しなかった場合は空
+	Answer          string
+	Correct         bool
+	LatencyMs       int // 出題から回答権を得るまでの時間(ミリ秒)
+	// Buzzes 回答権の要求。回答権を取れなかった要求も含めて、要求した順に並べる
+	Buzzes []BuzzRecord
+}
+
+// BuzzRecord 回答権の要求1回分の記録
+type BuzzRecord struct {
+	PlayerID  string
+	LatencyMs int  // 出題から要求までの時間(ミリ秒)
+	Granted   bool // 回答権を取れたか
+}
+
+// answerMsOf プレイヤーの平均回答時間を返す
+func (r MatchRecord) answerMsOf(username string) int {
+	if username == r.Player1ID {
+		return r.Player1AnswerMs
+	}
+	return r.Player2AnswerMs
+}
+
+// RatingUpdate レート更新の結果
+// RatingChangeはWinnerID側の変動(引き分けでは負になることもある)
+type RatingUpdate struct {
+	WinnerOldRating int
+	WinnerNewRating int
+	LoserOldRating  int
+	LoserNewRating  int
+	RatingChange    int
+	WinnerTier      string // 対戦後のランク帯
+	LoserTier       string
+	WinnerStreak    Streak // 対戦後の連勝数
+	LoserStreak     Streak
+}
+
+// playerState レーティングの計算に使うプレイヤーの状態
+type playerState struct {
+	Rating     int
+	Tier       string  // 現在のランク帯(昇格・降格の猶予を考慮するため保存しておく)
+	Deviation  float64 // Glicko-2のレーティング偏差
+	Volatility float64 // Glicko-2の変動率
+
+	CurrentStreak int // 現在の連勝数
+	BestStreak    int // これまでの最長連勝数
+}
+
+// recordResult 試合の勝敗で連勝数を更新する
+// 負けと引き分けは連勝が途切れる
+func (s *playerState) recordResult(won bool) {
+	if !won {
+		s.CurrentStreak = 0
+		return
+	}
+	s.CurrentStreak++
+	s.BestStreak = max(s.BestStreak, s.CurrentStreak)
+}
+
+// Streak 連勝数
+type Streak struct {
+	Current int `json:"current"`
+	Best    int `json:"best"`
+}
+
+func (s playerState) streak() Streak {
+	return Streak{Current: s.CurrentStreak, Best: s.BestStreak}
+}
+
+func newPlayerState(initialRating int) playerState {
+	return playerState{
+		Rating:     initialRating,
+		Tier:       TierFor(initialRating).Name,
+		Deviation:  DefaultRatingDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
 type PlayerRating struct {
 	Username string `json:"username"`
 	Rating   int    `json:"rating"`
@@ -23,3 +159,99 @@ type Question struct {
 	CorrectAnswer string   `json:"correct_answer"`
 	Choices       []string `json:"choices"`
 }
+
+// LeaderboardEntry ランキングの1行
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+}
+
+// LeaderboardResponse ランキングAPIのレスポンス
+type LeaderboardResponse struct {
+	GameType string             `json:"game_type"`
+	Page     int                `json:"page"` // around_meの場合は0
+	PerPage  int                `json:"per_page"`
+	Total    int                `json:"total"`
+	AroundMe string             `json:"around_me,omitempty"`
+	Entries  []LeaderboardEntry `json:"entries"`
+}
+
+// GameTypeRating ゲームの種類ごとのレートとランク帯
+type GameTypeRating struct {
+	GameType string `json:"game_type"`
+	Rating   int    `json:"rating"`
+	Tier     string `json:"tier"`
+	Streak   Streak `json:"streak"`
+}
+
+// PlayerProfile プロフィールAPIで返すプレイヤーの成績
+type PlayerProfile struct {
+	Username string           `json:"username"`
+	Ratings  []GameTypeRating `json:"ratings"`
+}
+
+// GameTypeStats ゲームの種類ごとの成績
+type GameTypeStats struct {
+	GameType    string  `json:"game_type,omitempty"`
+	GamesPlayed int     `json:"games_played"`
+	Wins        int     `json:"wins"`
+	Losses      int     `json:"losses"`
+	Draws       int     `json:"draws"`
+	WinRate     float64 `json:"win_rate"`
+	AvgScore    float64 `json:"avg_score"`
+	Buzzes      int     `json:"buzzes"` // 回答権を取った回数
+	CorrectRate float64 `json:"correct_rate"`
+	AvgBuzzMs   float64 `json:"avg_buzz_ms"` // 回答権を取るまでの平均時間
+}
+
+// PlayerStats 成績APIのレスポンス。埋め込んだGameTypeStatsは全てのゲームの種類の合計
+// FavoriteCategoryは最も多く回答した問題のカテゴリー
+type PlayerStats struct {
+	Username         string `json:"username"`
+	FavoriteCategory string `json:"favorite_category,omitempty"`
+	GameTypeStats
+	GameTypes []GameTypeStats `json:"game_types"`
+}
+
+// PlayerRank 順位APIのレスポンス
+type PlayerRank struct {
+	Username   string  `json:"username"`
+	GameType   string  `json:"game_type"`
+	Rating     int     `json:"rating"`
+	Rank       int     `json:"rank"`
+	Total      int     `json:"total"`
+	Percentile float64 `json:"percentile"` // 自分より下の順位のプレイヤーの割合(%)
+}
+
+// TeamMatchResult チーム戦のレート更新に使う対戦結果
+// 引き分けの場合はどちらのチームをWinningTeamにしてもよい
+type TeamMatchResult struct {
+	WinningTeam []string
+	LosingTeam  []string
+	GameType    string
+	Outcome     Outcome
+}
+
+// PlayerRatingChange 1人のプレイヤーのレート変動
+type PlayerRatingChange struct {
+	OldRating int    `json:"old_rating"`
+	NewRating int    `json:"new_rating"`
+	Delta     int    `json:"delta"`
+	Tier      string `json:"tier"`
+	Streak    Streak `json:"streak"`
+}
+
+// TeamRatingUpdate チーム戦で全員のレートがどう変わったか
+type TeamRatingUpdate struct {
+	Players map[string]PlayerRatingChange `json:"players"`
+}
+
+// MatchHistoryResponse 対戦履歴APIのレスポンス
+type MatchHistoryResponse struct {
+	PlayerID string                    `json:"player_id"`
+	Page     int                       `json:"page"`
+	PerPage  int                       `json:"per_page"`
+	Total    int                       `json:"total"`
+	Matches  []repository.MatchSummary `json:"matches"`
+}
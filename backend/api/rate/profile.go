@@ -0,0 +1,64 @@
+package rate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sys3/api/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// getPlayerTier プレイヤーのゲームの種類ごとのランク帯を返す
+// まだ対戦していない場合は初期レートのランク帯を返す
+func getPlayerTier(ctx context.Context, db *repository.DB, username, gameType string) string {
+	gameType = NormalizeGameType(gameType)
+
+	var rating int
+	var tier sql.NullString
+	err := db.QueryRowContext(ctx,
+		"SELECT rating, tier FROM player_ratings WHERE username = ? AND game_type = ?",
+		username, gameType,
+	).Scan(&rating, &tier)
+	if err != nil {
+		return TierFor(ConfigFor(gameType).InitialRating).Name
+	}
+	if tier.Valid {
+		return tier.String
+	}
+	return TierFor(rating).Name
+}
+
+// PlayerProfileHandler プレイヤーのゲームの種類ごとのレートとランク帯を返すハンドラー
+func PlayerProfileHandler(ratings repository.RatingRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["id"]
+
+		stored, err := ratings.PlayerRatings(r.Context(), username)
+		if err != nil {
+			http.Error(w, "プロフィールの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		profile := PlayerProfile{
+			Username: username,
+			Ratings:  []GameTypeRating{},
+		}
+		for _, s := range stored {
+			rating := GameTypeRating{
+				GameType: s.GameType,
+				Rating:   s.Rating,
+				Tier:     s.Tier,
+				Streak:   Streak{Current: s.CurrentStreak, Best: s.BestStreak},
+			}
+			if rating.Tier == "" {
+				rating.Tier = TierFor(rating.Rating).Name
+			}
+			profile.Ratings = append(profile.Ratings, rating)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
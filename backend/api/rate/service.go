@@ -0,0 +1,229 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"sys3/api/repository"
+)
+
+// RatingService 対戦のセッションからレートを参照・更新するためのインターフェース
+// セッション側はHTTPハンドラーやデータベースに直接依存せず、これを通して利用する
+type RatingService interface {
+	// Rating ゲームの種類ごとの現在のレートを返す(未対戦なら初期レート)
+	Rating(ctx context.Context, username, gameType string) int
+	// Tier ゲームの種類ごとの現在のランク帯を返す
+	Tier(ctx context.Context, username, gameType string) string
+	// FinalizeMatch 対戦記録を保存して両プレイヤーのレートを更新する
+	FinalizeMatch(ctx context.Context, record MatchRecord) (int64, RatingUpdate, error)
+	// RecordCasualMatch レートを変動させずに対戦記録だけを保存する
+	RecordCasualMatch(ctx context.Context, record MatchRecord) (int64, error)
+	// UpdateRatings 対戦記録を保存せずに両プレイヤーのレートだけを更新する
+	UpdateRatings(ctx context.Context, result MatchResult) (RatingUpdate, error)
+	// UpdateTeamRatings チーム戦の結果から全員のレートを更新する
+	UpdateTeamRatings(ctx context.Context, result TeamMatchResult) (TeamRatingUpdate, error)
+}
+
+// SQLService データベースを使うRatingServiceの実装
+type SQLService struct {
+	db *repository.DB
+}
+
+// NewSQLService データベースを使うRatingServiceを作成する
+// レートの取得・更新のステートメントはdbが一度だけ準備して使い回す
+func NewSQLService(db *repository.DB) *SQLService {
+	return &SQLService{db: db}
+}
+
+func (s *SQLService) Rating(ctx context.Context, username, gameType string) int {
+	return getPlayerRating(ctx, s.db, username, NormalizeGameType(gameType))
+}
+
+func (s *SQLService) Tier(ctx context.Context, username, gameType string) string {
+	return getPlayerTier(ctx, s.db, username, gameType)
+}
+
+func (s *SQLService) FinalizeMatch(ctx context.Context, record MatchRecord) (int64, RatingUpdate, error) {
+	return finalizeMatch(ctx, s.db, record)
+}
+
+func (s *SQLService) RecordCasualMatch(ctx context.Context, record MatchRecord) (int64, error) {
+	return recordCasualMatch(ctx, s.db, record)
+}
+
+func (s *SQLService) UpdateRatings(ctx context.Context, result MatchResult) (RatingUpdate, error) {
+	return updateRatings(ctx, s.db, result)
+}
+
+func (s *SQLService) UpdateTeamRatings(ctx context.Context, result TeamMatchResult) (TeamRatingUpdate, error) {
+	return updateTeamRatings(ctx, s.db, result)
+}
+
+// MemoryService メモリ上でレートを管理するRatingServiceの実装
+// データベースを使わずにセッションの処理を確認するためのもので、再起動すると内容は消える
+type MemoryService struct {
+	mu      sync.Mutex
+	states  map[memoryKey]playerState
+	updates map[string]RatingUpdate // MatchKeyごとのレート変動
+	Matches []MatchRecord           // 保存された対戦記録
+}
+
+type memoryKey struct {
+	username string
+	gameType string
+}
+
+// NewMemoryService 空のMemoryServiceを作成する
+func NewMemoryService() *MemoryService {
+	return &MemoryService{
+		states:  make(map[memoryKey]playerState),
+		updates: make(map[string]RatingUpdate),
+	}
+}
+
+// SetRating プレイヤーのレートを直接設定する
+func (s *MemoryService) SetRating(username, gameType string, rating int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gameType = NormalizeGameType(gameType)
+	state := s.stateLocked(username, gameType)
+	state.Rating = rating
+	state.Tier = TierFor(rating).Name
+	s.states[memoryKey{username, gameType}] = state
+}
+
+func (s *MemoryService) stateLocked(username, gameType string) playerState {
+	if state, ok := s.states[memoryKey{username, gameType}]; ok {
+		return state
+	}
+	return newPlayerState(ConfigFor(gameType).InitialRating)
+}
+
+func (s *MemoryService) Rating(ctx context.Context, username, gameType string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stateLocked(username, NormalizeGameType(gameType)).Rating
+}
+
+func (s *MemoryService) Tier(ctx context.Context, username, gameType string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stateLocked(username, NormalizeGameType(gameType)).Tier
+}
+
+// FinalizeMatch データベース版と同じ計算でレートを更新する
+// サブアカウントの判定は行わない
+func (s *MemoryService) FinalizeMatch(ctx context.Context, record MatchRecord) (int64, RatingUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.findLocked(record.MatchKey); ok {
+		return id, s.updates[record.MatchKey], nil
+	}
+
+	update := s.updateLocked(record.MatchResult)
+	s.Matches = append(s.Matches, record)
+	if record.MatchKey != "" {
+		s.updates[record.MatchKey] = update
+	}
+	return int64(len(s.Matches)), update, nil
+}
+
+// UpdateRatings データベース版と同じ計算でレートだけを更新する
+func (s *MemoryService) UpdateRatings(ctx context.Context, result MatchResult) (RatingUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateLocked(result), nil
+}
+
+// updateLocked 勝者と敗者のレートを計算して保存する
+func (s *MemoryService) updateLocked(result MatchResult) RatingUpdate {
+	gameType := NormalizeGameType(result.GameType)
+	config := ConfigFor(gameType)
+	winner := s.stateLocked(result.WinnerID, gameType)
+	loser := s.stateLocked(result.LoserID, gameType)
+
+	newWinner, newLoser := computeRatings(config, winner, loser, result.Outcome.winnerScore())
+	newWinner = boundRating(config, winner, newWinner)
+	newLoser = boundRating(config, loser, newLoser)
+	newWinner.Tier = nextTier(winner.Tier, newWinner.Rating)
+	newLoser.Tier = nextTier(loser.Tier, newLoser.Rating)
+	newWinner.recordResult(result.Outcome == OutcomeWin)
+	newLoser.recordResult(false)
+
+	s.states[memoryKey{result.WinnerID, gameType}] = newWinner
+	s.states[memoryKey{result.LoserID, gameType}] = newLoser
+
+	return RatingUpdate{
+		WinnerOldRating: winner.Rating,
+		WinnerNewRating: newWinner.Rating,
+		LoserOldRating:  loser.Rating,
+		LoserNewRating:  newLoser.Rating,
+		RatingChange:    newWinner.Rating - winner.Rating,
+		WinnerTier:      newWinner.Tier,
+		LoserTier:       newLoser.Tier,
+		WinnerStreak:    newWinner.streak(),
+		LoserStreak:     newLoser.streak(),
+	}
+}
+
+// UpdateTeamRatings データベース版と同じ計算でチーム全員のレートを更新する
+func (s *MemoryService) UpdateTeamRatings(ctx context.Context, result TeamMatchResult) (TeamRatingUpdate, error) {
+	if err := result.validate(); err != nil {
+		return TeamRatingUpdate{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gameType := NormalizeGameType(result.GameType)
+	config := ConfigFor(gameType)
+	states := make(map[string]playerState)
+	for _, username := range append(append([]string(nil), result.WinningTeam...), result.LosingTeam...) {
+		states[username] = s.stateLocked(username, gameType)
+	}
+	winners := teamStates(states, result.WinningTeam)
+	losers := teamStates(states, result.LosingTeam)
+	newWinners, newLosers := computeTeamRatings(config, winners, losers, result.Outcome.winnerScore())
+
+	update := TeamRatingUpdate{Players: make(map[string]PlayerRatingChange)}
+	apply := func(team []string, before, after []playerState, won bool) {
+		for i, username := range team {
+			after[i].Tier = nextTier(before[i].Tier, after[i].Rating)
+			after[i].recordResult(won)
+			s.states[memoryKey{username, gameType}] = after[i]
+			update.Players[username] = PlayerRatingChange{
+				OldRating: before[i].Rating,
+				NewRating: after[i].Rating,
+				Delta:     after[i].Rating - before[i].Rating,
+				Tier:      after[i].Tier,
+				Streak:    after[i].streak(),
+			}
+		}
+	}
+	apply(result.WinningTeam, winners, newWinners, result.Outcome == OutcomeWin)
+	apply(result.LosingTeam, losers, newLosers, false)
+	return update, nil
+}
+
+func (s *MemoryService) RecordCasualMatch(ctx context.Context, record MatchRecord) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.findLocked(record.MatchKey); ok {
+		return id, nil
+	}
+	s.Matches = append(s.Matches, record)
+	return int64(len(s.Matches)), nil
+}
+
+// findLocked MatchKeyが同じ保存済みの対戦のIDを返す
+func (s *MemoryService) findLocked(key string) (int64, bool) {
+	if key == "" {
+		return 0, false
+	}
+	for i, m := range s.Matches {
+		if m.MatchKey == key {
+			return int64(i + 1), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,154 @@
+package rate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sys3/api/repository"
+)
+
+// SmurfConfig サブアカウント(実力を隠した新規アカウント)の判定基準
+type SmurfConfig struct {
+	PlacementGames   int     // この試合数までを判定の対象にする
+	MinGames         int     // 判定に必要な最低試合数
+	WinRateThreshold float64 // この勝率以上で疑う
+	FastAnswerRatio  float64 // 同じランク帯の平均回答時間に対してこの割合以下なら速すぎるとみなす
+	KMultiplier      float64 // 疑わしいプレイヤーのレート変動を何倍にするか
+}
+
+var smurfConfig = SmurfConfig{
+	PlacementGames:   10,
+	MinGames:         3,
+	WinRateThreshold: 0.8,
+	FastAnswerRatio:  0.6,
+	KMultiplier:      2.0,
+}
+
+// SetSmurfConfig サブアカウントの判定基準を設定する
+func SetSmurfConfig(config SmurfConfig) {
+	smurfConfig = config
+}
+
+// smurfStats 判定に使う序盤の試合の成績
+type smurfStats struct {
+	Games         int
+	Wins          int
+	AvgAnswerMs   float64 // 0は回答の記録がない
+	answerSamples int
+}
+
+// addMatch 今回の試合の結果を成績に加える
+func (s *smurfStats) addMatch(won bool, answerMs int) {
+	s.Games++
+	if won {
+		s.Wins++
+	}
+	if answerMs > 0 {
+		s.AvgAnswerMs = (s.AvgAnswerMs*float64(s.answerSamples) + float64(answerMs)) / float64(s.answerSamples+1)
+		s.answerSamples++
+	}
+}
+
+// detectSmurf 今回の試合を含めた序盤の成績から、実力がランク帯を大きく上回っていないかを判定する
+// 疑わしい場合は記録を残し、レート変動の倍率を返す(通常は1)
+func detectSmurf(ctx context.Context, tx *repository.Tx, username, gameType string, rating int, won bool, answerMs int) (float64, error) {
+	var stats smurfStats
+	var avgAnswer sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN m.winner_id = h.username THEN 1 ELSE 0 END), 0), AVG(h.answer_ms), COUNT(h.answer_ms)
+		FROM rating_history h
+		JOIN matches m ON m.id = h.match_id
+		WHERE h.username = ? AND h.game_type = ?`,
+		username, gameType,
+	).Scan(&stats.Games, &stats.Wins, &avgAnswer, &stats.answerSamples)
+	if err != nil {
+		return 1, err
+	}
+	stats.AvgAnswerMs = avgAnswer.Float64
+	stats.addMatch(won, answerMs)
+
+	config := smurfConfig
+	if stats.Games < config.MinGames || stats.Games > config.PlacementGames {
+		return 1, nil
+	}
+	winRate := float64(stats.Wins) / float64(stats.Games)
+	if winRate < config.WinRateThreshold {
+		return 1, nil
+	}
+
+	// 同じランク帯のプレイヤーの平均回答時間と比べる
+	// 勝率だけでは運や相手の巡り合わせでも高くなるので、回答の速さも上回っている場合だけ疑う
+	if stats.AvgAnswerMs == 0 {
+		return 1, nil
+	}
+	low, high := tierBounds(rating)
+	var bracketAnswer sql.NullFloat64
+	err = tx.QueryRowContext(ctx, `
+		SELECT AVG(answer_ms) FROM rating_history
+		WHERE game_type = ? AND old_rating >= ? AND old_rating < ? AND answer_ms IS NOT NULL`,
+		gameType, low, high,
+	).Scan(&bracketAnswer)
+	if err != nil {
+		return 1, err
+	}
+	if !bracketAnswer.Valid || stats.AvgAnswerMs > bracketAnswer.Float64*config.FastAnswerRatio {
+		return 1, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO smurf_flags (username, game_type, games, win_rate, avg_answer_ms, bracket_answer_ms)
+		VALUES (?, ?, ?, ?, ?, ?)`+tx.Dialect().Upsert([]string{"username", "game_type"}, `games = VALUES(games), win_rate = VALUES(win_rate),
+			avg_answer_ms = VALUES(avg_answer_ms), bracket_answer_ms = VALUES(bracket_answer_ms)`),
+		username, gameType, stats.Games, winRate, nullIfZero(stats.AvgAnswerMs), bracketAnswer,
+	)
+	if err != nil {
+		return 1, err
+	}
+	return config.KMultiplier, nil
+}
+
+// tierBounds レートが属するランク帯のレートの範囲を返す
+func tierBounds(rating int) (int, int) {
+	tier := TierFor(rating)
+	i := tierIndex(tier.Name)
+	if i+1 < len(tiers) {
+		return tier.MinRating, tiers[i+1].MinRating
+	}
+	return tier.MinRating, math.MaxInt32
+}
+
+func nullIfZero(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: value != 0}
+}
+
+// scaleChange レートが上がる場合だけ変動をmultiplier倍にする
+// 負けたときの下がり幅まで大きくすると、疑わしいだけの新規プレイヤーを必要以上に下げてしまう
+func scaleChange(before, after playerState, multiplier float64) playerState {
+	if multiplier == 0 || multiplier == 1 || after.Rating <= before.Rating {
+		return after
+	}
+	after.Rating = before.Rating + int(math.Round(float64(after.Rating-before.Rating)*multiplier))
+	return after
+}
+
+// SmurfFlagsHandler サブアカウントの疑いがあるプレイヤーの一覧を返す管理者用ハンドラー
+// ?game_type= でゲームの種類を指定できる(デフォルト: quiz)
+func SmurfFlagsHandler(ratings repository.RatingRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gameType := NormalizeGameType(r.URL.Query().Get("game_type"))
+
+		flags, err := ratings.SmurfFlags(r.Context(), gameType)
+		if err != nil {
+			http.Error(w, "データの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flags)
+	}
+}
+
+// SmurfFlag サブアカウントの疑いがあるプレイヤーの記録
+type SmurfFlag = repository.SmurfFlag
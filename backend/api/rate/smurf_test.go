@@ -0,0 +1,24 @@
+package rate
+
+import "testing"
+
+func TestScaleChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     int
+		after      int
+		multiplier float64
+		want       int
+	}{
+		{"上がる場合は倍にする", 1500, 1516, 2, 1532},
+		{"下がる場合はそのまま", 1500, 1484, 2, 1484},
+		{"倍率が1ならそのまま", 1500, 1516, 1, 1516},
+		{"倍率が0ならそのまま", 1500, 1516, 0, 1516},
+	}
+	for _, tt := range tests {
+		got := scaleChange(playerState{Rating: tt.before}, playerState{Rating: tt.after}, tt.multiplier)
+		if got.Rating != tt.want {
+			t.Errorf("%s: Rating = %d, want %d", tt.name, got.Rating, tt.want)
+		}
+	}
+}
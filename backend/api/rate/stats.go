@@ -0,0 +1,135 @@
+package rate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sys3/api/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// updatePlayerStats 対戦の結果を両プレイヤーの成績の集計に加える
+// 成績APIで毎回対戦履歴を集計しなくて済むように、対戦の保存と同じトランザクションで更新する
+func updatePlayerStats(ctx context.Context, tx *repository.Tx, record MatchRecord) error {
+	players := []struct {
+		id    string
+		score int
+	}{
+		{record.Player1ID, record.Player1Score},
+		{record.Player2ID, record.Player2Score},
+	}
+	for _, p := range players {
+		win, loss, draw := 0, 0, 0
+		switch {
+		case record.Outcome == OutcomeDraw:
+			draw = 1
+		case p.id == record.WinnerID:
+			win = 1
+		default:
+			loss = 1
+		}
+		buzzes, correct, buzzMs := 0, 0, 0
+		for _, a := range record.Answers {
+			if a.PlayerID != p.id {
+				continue
+			}
+			buzzes++
+			buzzMs += a.LatencyMs
+			if a.Correct {
+				correct++
+			}
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO player_stats (username, game_type, games_played, wins, losses, draws, total_score, buzzes, correct_answers, total_buzz_ms)
+			VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?, ?)`+tx.Dialect().Upsert([]string{"username", "game_type"}, `games_played = player_stats.games_played + 1,
+				wins = player_stats.wins + VALUES(wins), losses = player_stats.losses + VALUES(losses), draws = player_stats.draws + VALUES(draws),
+				total_score = player_stats.total_score + VALUES(total_score), buzzes = player_stats.buzzes + VALUES(buzzes),
+				correct_answers = player_stats.correct_answers + VALUES(correct_answers), total_buzz_ms = player_stats.total_buzz_ms + VALUES(total_buzz_ms)`),
+			p.id, record.GameType, win, loss, draw, p.score, buzzes, correct, buzzMs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statsTotals 集計した値から率と平均を計算する前の合計
+type statsTotals struct {
+	games, wins, losses, draws int
+	score                      int64
+	buzzes, correct            int
+	buzzMs                     int64
+}
+
+func (t *statsTotals) add(o statsTotals) {
+	t.games += o.games
+	t.wins += o.wins
+	t.losses += o.losses
+	t.draws += o.draws
+	t.score += o.score
+	t.buzzes += o.buzzes
+	t.correct += o.correct
+	t.buzzMs += o.buzzMs
+}
+
+func (t statsTotals) stats(gameType string) GameTypeStats {
+	s := GameTypeStats{
+		GameType:    gameType,
+		GamesPlayed: t.games,
+		Wins:        t.wins,
+		Losses:      t.losses,
+		Draws:       t.draws,
+		Buzzes:      t.buzzes,
+	}
+	if t.games > 0 {
+		s.WinRate = float64(t.wins) / float64(t.games)
+		s.AvgScore = float64(t.score) / float64(t.games)
+	}
+	if t.buzzes > 0 {
+		s.CorrectRate = float64(t.correct) / float64(t.buzzes)
+		s.AvgBuzzMs = float64(t.buzzMs) / float64(t.buzzes)
+	}
+	return s
+}
+
+// PlayerStatsHandler プレイヤーの成績の集計を返すハンドラー
+// まだ対戦していないプレイヤーは全て0で返す
+func PlayerStatsHandler(ratings repository.RatingRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["id"]
+
+		stored, err := ratings.PlayerStats(r.Context(), username)
+		if err != nil {
+			http.Error(w, "成績の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		favorite, err := ratings.FavoriteCategory(r.Context(), username)
+		if err != nil {
+			http.Error(w, "成績の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		stats := PlayerStats{Username: username, FavoriteCategory: favorite, GameTypes: []GameTypeStats{}}
+		var total statsTotals
+		for _, s := range stored {
+			t := statsTotals{
+				games:   s.GamesPlayed,
+				wins:    s.Wins,
+				losses:  s.Losses,
+				draws:   s.Draws,
+				score:   s.TotalScore,
+				buzzes:  s.Buzzes,
+				correct: s.CorrectAnswers,
+				buzzMs:  s.TotalBuzzMs,
+			}
+			total.add(t)
+			stats.GameTypes = append(stats.GameTypes, t.stats(s.GameType))
+		}
+		stats.GameTypeStats = total.stats("")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	}
+}
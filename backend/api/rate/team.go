@@ -0,0 +1,140 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sys3/api/repository"
+)
+
+// ErrInvalidTeams チーム戦の結果としてチームの構成が正しくない
+var ErrInvalidTeams = errors.New("チームの構成が正しくありません")
+
+// updateTeamRatings チーム戦(2対2など)の結果から全員のレートを計算して更新する
+// 各プレイヤーは相手チームの平均レートを対戦相手とみなして個別に計算するので、
+// 同じチームでもレートの低いプレイヤーほど勝ったときの上がり幅が大きくなる
+func updateTeamRatings(ctx context.Context, db *repository.DB, result TeamMatchResult) (TeamRatingUpdate, error) {
+	if err := result.validate(); err != nil {
+		return TeamRatingUpdate{}, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return TeamRatingUpdate{}, err
+	}
+	defer tx.Rollback()
+
+	gameType := NormalizeGameType(result.GameType)
+	config := ConfigFor(gameType)
+
+	// デッドロックを避けるため、行ロックは常にユーザー名順で取る
+	states := make(map[string]playerState)
+	players := append(append([]string(nil), result.WinningTeam...), result.LosingTeam...)
+	sort.Strings(players)
+	for _, username := range players {
+		state, err := getPlayerStateForUpdate(ctx, tx, username, gameType, config.InitialRating)
+		if err != nil {
+			return TeamRatingUpdate{}, err
+		}
+		states[username] = state
+	}
+
+	winners := teamStates(states, result.WinningTeam)
+	losers := teamStates(states, result.LosingTeam)
+	newWinners, newLosers := computeTeamRatings(config, winners, losers, result.Outcome.winnerScore())
+
+	update := TeamRatingUpdate{Players: make(map[string]PlayerRatingChange)}
+	apply := func(team []string, before, after []playerState, won bool) error {
+		for i, username := range team {
+			after[i].Tier = nextTier(before[i].Tier, after[i].Rating)
+			after[i].recordResult(won)
+			if err := savePlayerState(ctx, tx, username, gameType, after[i]); err != nil {
+				return err
+			}
+			update.Players[username] = PlayerRatingChange{
+				OldRating: before[i].Rating,
+				NewRating: after[i].Rating,
+				Delta:     after[i].Rating - before[i].Rating,
+				Tier:      after[i].Tier,
+				Streak:    after[i].streak(),
+			}
+		}
+		return nil
+	}
+	if err := apply(result.WinningTeam, winners, newWinners, result.Outcome == OutcomeWin); err != nil {
+		return TeamRatingUpdate{}, err
+	}
+	if err := apply(result.LosingTeam, losers, newLosers, false); err != nil {
+		return TeamRatingUpdate{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return TeamRatingUpdate{}, err
+	}
+	for username, change := range update.Players {
+		leaderboards.update(gameType, username, change.NewRating)
+	}
+	return update, nil
+}
+
+func (r TeamMatchResult) validate() error {
+	if len(r.WinningTeam) == 0 || len(r.LosingTeam) == 0 {
+		return ErrInvalidTeams
+	}
+	seen := make(map[string]bool)
+	for _, username := range append(append([]string(nil), r.WinningTeam...), r.LosingTeam...) {
+		if username == "" || seen[username] {
+			return ErrInvalidTeams
+		}
+		seen[username] = true
+	}
+	return nil
+}
+
+func teamStates(states map[string]playerState, team []string) []playerState {
+	result := make([]playerState, len(team))
+	for i, username := range team {
+		result[i] = states[username]
+	}
+	return result
+}
+
+// computeTeamRatings チーム全員の対戦後のレートを計算する
+// winnerScoreは勝ったチーム側のスコア(勝ちは1、引き分けは0.5)
+func computeTeamRatings(config RatingConfig, winners, losers []playerState, winnerScore float64) ([]playerState, []playerState) {
+	winnerAverage := averageState(winners)
+	loserAverage := averageState(losers)
+
+	update := func(team []playerState, opponent playerState, score float64) []playerState {
+		result := make([]playerState, len(team))
+		for i, player := range team {
+			if config.Algorithm == AlgorithmGlicko2 {
+				result[i] = boundRating(config, player, glicko2Update(player, opponent, score, config.Tau))
+				continue
+			}
+			after := player
+			after.Rating += calculateRatingChange(player.Rating, opponent.Rating, score, config)
+			result[i] = boundRating(config, player, after)
+		}
+		return result
+	}
+	return update(winners, loserAverage, winnerScore), update(losers, winnerAverage, 1-winnerScore)
+}
+
+// averageState チームを1人の対戦相手とみなしたときのレートと偏差
+// 偏差は二乗平均をとる
+func averageState(team []playerState) playerState {
+	var rating, variance, volatility float64
+	for _, p := range team {
+		rating += float64(p.Rating)
+		variance += p.Deviation * p.Deviation
+		volatility += p.Volatility
+	}
+	n := float64(len(team))
+	return playerState{
+		Rating:     int(math.Round(rating / n)),
+		Deviation:  math.Sqrt(variance / n),
+		Volatility: volatility / n,
+	}
+}
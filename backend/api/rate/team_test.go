@@ -0,0 +1,42 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUpdateTeamRatings(t *testing.T) {
+	service := NewMemoryService()
+	service.SetRating("alice", DefaultGameType, 1700)
+	service.SetRating("bob", DefaultGameType, 1300)
+	service.SetRating("carol", DefaultGameType, 1500)
+	service.SetRating("dave", DefaultGameType, 1500)
+	ctx := context.Background()
+
+	update, err := service.UpdateTeamRatings(ctx, TeamMatchResult{
+		WinningTeam: []string{"alice", "bob"},
+		LosingTeam:  []string{"carol", "dave"},
+		GameType:    DefaultGameType,
+		Outcome:     OutcomeWin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := update.Players["alice"], update.Players["bob"]
+	// 同じチームでもレートの低いプレイヤーほど上がり幅が大きい
+	if alice.Delta <= 0 || bob.Delta <= alice.Delta {
+		t.Errorf("alice = %+v, bob = %+v, want bob to gain more", alice, bob)
+	}
+	if carol := update.Players["carol"]; carol.Delta >= 0 {
+		t.Errorf("carol = %+v, want a loss", carol)
+	}
+	if got := service.Rating(ctx, "bob", DefaultGameType); got != bob.NewRating {
+		t.Errorf("bob's rating = %d, want %d", got, bob.NewRating)
+	}
+
+	_, err = service.UpdateTeamRatings(ctx, TeamMatchResult{WinningTeam: []string{"alice"}, LosingTeam: []string{"alice"}})
+	if !errors.Is(err, ErrInvalidTeams) {
+		t.Errorf("same player on both teams: err = %v, want ErrInvalidTeams", err)
+	}
+}
@@ -0,0 +1,97 @@
+package rate
+
+// Tier レートから決まるランク帯
+type Tier struct {
+	Name      string `json:"name"`
+	MinRating int    `json:"min_rating"` // このレート以上で昇格する
+}
+
+// tiers 下から順に並べたランク帯
+var tiers = []Tier{
+	{"Bronze", 0},
+	{"Silver", 1200},
+	{"Gold", 1400},
+	{"Platinum", 1600},
+	{"Diamond", 1800},
+	{"Master", 2000},
+	{"Grandmaster", 2200},
+}
+
+// DemotionBuffer 降格するまでの猶予
+// ランク帯の下限をこの値より下回った場合に初めて降格する
+const DemotionBuffer = 50
+
+// TierFor レートに対応するランク帯を返す(昇格・降格の猶予は考慮しない)
+func TierFor(rating int) Tier {
+	tier := tiers[0]
+	for _, t := range tiers {
+		if rating >= t.MinRating {
+			tier = t
+		}
+	}
+	return tier
+}
+
+func tierIndex(name string) int {
+	for i, t := range tiers {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextTier 現在のランク帯と新しいレートから、対戦後のランク帯を決める
+// 昇格は下限に達した時点で行い、降格は下限をDemotionBuffer以上下回った場合のみ行う
+func nextTier(current string, rating int) string {
+	target := TierFor(rating)
+	currentIndex := tierIndex(current)
+	if currentIndex < 0 {
+		return target.Name
+	}
+
+	targetIndex := tierIndex(target.Name)
+	if targetIndex >= currentIndex {
+		return target.Name
+	}
+
+	// 降格は猶予を超えた分だけ
+	for currentIndex > targetIndex && rating < tiers[currentIndex].MinRating-DemotionBuffer {
+		currentIndex--
+	}
+	return tiers[currentIndex].Name
+}
+
+// Tiers 全てのランク帯を返す
+func Tiers() []Tier {
+	return append([]Tier(nil), tiers...)
+}
+
+// isProtected 一度到達すると降格しないランク帯かを返す
+func (c RatingConfig) isProtected(tier string) bool {
+	for _, name := range c.ProtectedTiers {
+		if name == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// boundRating 対戦後のレートを設定された下限・上限の範囲に収める
+// 降格しないランク帯にいるプレイヤーは、そのランク帯から降格しないレートで止める
+// 範囲外のレートは対戦によってさらに範囲から遠ざからないようにするだけで、範囲内には戻さない
+func boundRating(config RatingConfig, before, after playerState) playerState {
+	if after.Rating < before.Rating {
+		floor := config.MinRating
+		if config.isProtected(before.Tier) {
+			if i := tierIndex(before.Tier); i >= 0 {
+				floor = max(floor, tiers[i].MinRating-DemotionBuffer)
+			}
+		}
+		after.Rating = max(after.Rating, min(floor, before.Rating))
+	}
+	if config.MaxRating > 0 && after.Rating > before.Rating {
+		after.Rating = min(after.Rating, max(config.MaxRating, before.Rating))
+	}
+	return after
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type sqlAPIKeyRepository struct {
+	db conn
+}
+
+// NewSQLAPIKeyRepository データベースにAPIキーを保存するAPIKeyRepositoryを作成する
+// スコープはカンマ区切りで1つの列に保存する
+func NewSQLAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return newSQLAPIKeyRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLAPIKeyRepository(db *sql.DB, dialect Dialect) APIKeyRepository {
+	return &sqlAPIKeyRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlAPIKeyRepository) CountAPIKeys(ctx context.Context, username string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM api_keys WHERE username = ? AND revoked_at IS NULL", username,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *sqlAPIKeyRepository) CreateAPIKey(ctx context.Context, key APIKey) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO api_keys (id, key_hash, prefix, username, name, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		key.ID, key.KeyHash, key.Prefix, key.Username, key.Name, strings.Join(key.Scopes, ","), key.CreatedAt,
+	)
+	return err
+}
+
+func (r *sqlAPIKeyRepository) APIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	key := APIKey{KeyHash: keyHash}
+	var scopes string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, username, scopes FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL",
+		keyHash,
+	).Scan(&key.ID, &key.Username, &scopes)
+	if err == sql.ErrNoRows {
+		return APIKey{}, ErrNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	return key, nil
+}
+
+func (r *sqlAPIKeyRepository) TouchAPIKey(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
+
+func (r *sqlAPIKeyRepository) APIKeys(ctx context.Context, username string) ([]APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, name, prefix, scopes, created_at, last_used_at FROM api_keys WHERE username = ? AND revoked_at IS NULL ORDER BY created_at",
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key := APIKey{Username: username}
+		var scopes string
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Split(scopes, ",")
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *sqlAPIKeyRepository) RevokeAPIKey(ctx context.Context, id, username string) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ? AND revoked_at IS NULL",
+		id, username,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
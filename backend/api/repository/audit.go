@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+type sqlAuditRepository struct {
+	db conn
+}
+
+// NewSQLAuditRepository データベースに管理者の操作の記録を保存するAuditRepositoryを作成する
+func NewSQLAuditRepository(db *sql.DB) AuditRepository {
+	return newSQLAuditRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLAuditRepository(db *sql.DB, dialect Dialect) AuditRepository {
+	return &sqlAuditRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlAuditRepository) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, target, payload, diff, status, ip, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Actor, entry.Action, entry.Target, nullJSON(entry.Payload), nullJSON(entry.Diff), entry.Status, entry.IP, entry.CreatedAt,
+	)
+	return err
+}
+
+func nullJSON(data json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(data), Valid: len(data) > 0}
+}
+
+func (r *sqlAuditRepository) AuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.Target != "" {
+		conditions = append(conditions, "target = ?")
+		args = append(args, filter.Target)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, actor, action, target, payload, diff, status, ip, created_at FROM audit_log"+where+
+			" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var payload, diff sql.NullString
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &payload, &diff, &e.Status, &e.IP, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if payload.Valid {
+			e.Payload = json.RawMessage(payload.String)
+		}
+		if diff.Valid {
+			e.Diff = json.RawMessage(diff.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
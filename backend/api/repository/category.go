@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlCategoryRepository struct {
+	db conn
+}
+
+// NewSQLCategoryRepository データベースにカテゴリーとタグを保存するCategoryRepositoryを作成する
+func NewSQLCategoryRepository(db *sql.DB) CategoryRepository {
+	return newSQLCategoryRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLCategoryRepository(db *sql.DB, dialect Dialect) CategoryRepository {
+	return &sqlCategoryRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlCategoryRepository) Categories(ctx context.Context) ([]Category, error) {
+	rows, err := r.db.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := r.db.CountCategoryQuestions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]int, len(counts))
+	for _, c := range counts {
+		byID[c.CategoryID] = c.QuestionCount
+	}
+
+	categories := make([]Category, len(rows))
+	for i, row := range rows {
+		categories[i] = Category{
+			ID:            row.ID,
+			Name:          row.Name,
+			Description:   row.Description,
+			QuestionCount: byID[row.ID],
+		}
+	}
+	return categories, nil
+}
+
+func (r *sqlCategoryRepository) CreateCategory(ctx context.Context, c Category) (int, error) {
+	taken, err := r.db.CategoryNameTaken(ctx, c.Name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		return 0, ErrConflict
+	}
+	id, err := r.db.CreateCategory(ctx, c.Name, c.Description)
+	return int(id), err
+}
+
+func (r *sqlCategoryRepository) UpdateCategory(ctx context.Context, c Category) error {
+	if _, err := r.db.GetCategory(ctx, c.ID); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	taken, err := r.db.CategoryNameTaken(ctx, c.Name, c.ID)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrConflict
+	}
+	// 名前と説明が変わらない場合も変更した行数が0になり得るので、存在は先に確認している
+	_, err = r.db.UpdateCategory(ctx, c.Name, c.Description, c.ID)
+	return err
+}
+
+func (r *sqlCategoryRepository) DeleteCategory(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, queryDeleteCategoryLinks, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, queryDeleteCategory, id)
+	if err != nil {
+		return err
+	}
+	if err := changed(result.RowsAffected()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlCategoryRepository) Tags(ctx context.Context) ([]Tag, error) {
+	rows, err := r.db.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := r.db.CountTagQuestions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]int, len(counts))
+	for _, c := range counts {
+		byID[c.TagID] = c.QuestionCount
+	}
+
+	tags := make([]Tag, len(rows))
+	for i, row := range rows {
+		tags[i] = Tag{ID: row.ID, Name: row.Name, QuestionCount: byID[row.ID]}
+	}
+	return tags, nil
+}
+
+func (r *sqlCategoryRepository) CreateTag(ctx context.Context, name string) (int, error) {
+	taken, err := r.db.TagNameTaken(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		return 0, ErrConflict
+	}
+	id, err := r.db.CreateTag(ctx, name)
+	return int(id), err
+}
+
+func (r *sqlCategoryRepository) DeleteTag(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, queryDeleteTagLinks, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, queryDeleteTag, id)
+	if err != nil {
+		return err
+	}
+	if err := changed(result.RowsAffected()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
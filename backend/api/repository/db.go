@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DB リポジトリの外でSQLを直接実行するパッケージが使う、Dialectを通した*sql.DB
+// クエリはリポジトリと同じくMySQLの書き方(プレースホルダーは?)で書き、実行前にRebindで変換する
+// ON DUPLICATE KEYやFOR UPDATEのようにデータベースごとに書き方が違う部分は、Dialectの句を組み立てて使う
+// 実行したクエリはリポジトリと同じく計測し、準備したステートメントを使い回す
+type DB struct {
+	c conn
+}
+
+// NewDB dialectの書き方でdbにクエリを実行するDBを作成する
+func NewDB(db *sql.DB, dialect Dialect) *DB {
+	return &DB{c: newConn(db, dialect)}
+}
+
+// Dialect クエリの書き分けに使うDialectを返す
+func (d *DB) Dialect() Dialect {
+	return d.c.dialect
+}
+
+// SQL 変換せずに使う元の*sql.DBを返す。Pingや接続プールの設定に使う
+func (d *DB) SQL() *sql.DB {
+	return d.c.DB
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.c.ExecContext(ctx, query, args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.c.QueryContext(ctx, query, args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.c.QueryRowContext(ctx, query, args...)
+}
+
+// InsertID INSERTを実行して自動採番されたIDを返す
+func (d *DB) InsertID(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return d.c.InsertID(ctx, query, args...)
+}
+
+// BeginTx トランザクションを開始する
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := d.c.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{c: tx}, nil
+}
+
+// Tx DBのトランザクション
+type Tx struct {
+	c txConn
+}
+
+// Dialect クエリの書き分けに使うDialectを返す
+func (t *Tx) Dialect() Dialect {
+	return t.c.dialect
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.c.ExecContext(ctx, query, args...)
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.c.QueryContext(ctx, query, args...)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.c.QueryRowContext(ctx, query, args...)
+}
+
+// InsertID INSERTを実行して自動採番されたIDを返す
+func (t *Tx) InsertID(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return t.c.InsertID(ctx, query, args...)
+}
+
+func (t *Tx) Commit() error {
+	return t.c.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	return t.c.Rollback()
+}
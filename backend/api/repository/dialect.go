@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect データベースごとに異なるSQLの書き方を吸収するインターフェース
+// リポジトリのクエリはMySQLの書き方(プレースホルダーは?)で書き、実行前にRebindで変換する
+type Dialect interface {
+	// Name database/sqlのドライバー名
+	Name() string
+	// Rebind ?のプレースホルダーをデータベースの形式に変換する
+	Rebind(query string) string
+	// RandomOrder ORDER BYで無作為に並べる式
+	// 空の場合は件数を数えてから無作為なOFFSETで1件だけ取得する
+	RandomOrder() string
+	// InsertID INSERTを実行して自動採番されたIDを返す
+	InsertID(ctx context.Context, db Execer, query string, args ...interface{}) (int64, error)
+	// Upsert INSERTの後ろに付けて、keysの列が重複した場合に既存の行をsetで更新する句
+	// setはMySQLの書き方で、挿入しようとした値はVALUES(列)で参照する
+	// 既存の行の値はPostgreSQLで列名があいまいにならないよう、テーブル名を付けて参照すること
+	Upsert(keys []string, set string) string
+	// ForUpdate SELECTの後ろに付けて、読み込んだ行をトランザクションの終わりまでロックする句
+	ForUpdate() string
+}
+
+// Execer *sql.DBと*sql.Txに共通するクエリの実行方法
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// 対応しているデータベースのドライバー名
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// DialectFor ドライバー名に対応するDialectを返す。不明な場合はMySQL
+func DialectFor(driver string) Dialect {
+	switch driver {
+	case DriverPostgres:
+		return postgresDialect{}
+	case DriverSQLite:
+		return sqliteDialect{}
+	}
+	return mysqlDialect{}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string               { return DriverMySQL }
+func (mysqlDialect) Rebind(query string) string { return query }
+func (mysqlDialect) RandomOrder() string        { return "RAND()" }
+func (mysqlDialect) ForUpdate() string          { return " FOR UPDATE" }
+
+func (mysqlDialect) Upsert(keys []string, set string) string {
+	return " ON DUPLICATE KEY UPDATE " + set
+}
+
+func (mysqlDialect) InsertID(ctx context.Context, db Execer, query string, args ...interface{}) (int64, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// postgresDialect PostgreSQLはプレースホルダーが$1, $2...で、LastInsertIdに対応していない
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string        { return DriverPostgres }
+func (postgresDialect) RandomOrder() string { return "RANDOM()" }
+func (postgresDialect) ForUpdate() string   { return " FOR UPDATE" }
+
+func (postgresDialect) Upsert(keys []string, set string) string {
+	return onConflict(keys, set)
+}
+
+// insertedValue MySQLのUpsertで挿入しようとした値を参照する式
+var insertedValue = regexp.MustCompile(`VALUES\((\w+)\)`)
+
+// onConflict PostgreSQLとSQLiteに共通するUpsertの句
+// 挿入しようとした値はVALUES(列)の代わりにEXCLUDED.列で参照する
+func onConflict(keys []string, set string) string {
+	return " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + insertedValue.ReplaceAllString(set, "EXCLUDED.$1")
+}
+
+func (postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (d postgresDialect) InsertID(ctx context.Context, db Execer, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, d.Rebind(query)+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// sqliteDialect ローカル開発用のSQLite
+// プレースホルダーはMySQLと同じ?で、LastInsertIdにも対応している
+// ORDER BY RANDOM()は全件を並べ替えるため、無作為な取得はOFFSETで行う
+// 書き込むトランザクションはデータベース全体をロックするので、行のロック(FOR UPDATE)はない
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string               { return DriverSQLite }
+func (sqliteDialect) Rebind(query string) string { return query }
+func (sqliteDialect) RandomOrder() string        { return "" }
+func (sqliteDialect) ForUpdate() string          { return "" }
+
+func (sqliteDialect) Upsert(keys []string, set string) string {
+	return onConflict(keys, set)
+}
+
+func (sqliteDialect) InsertID(ctx context.Context, db Execer, query string, args ...interface{}) (int64, error) {
+	return mysqlDialect{}.InsertID(ctx, db, query, args...)
+}
+
+// IsUniqueViolation 一意制約に違反したエラーかを返す
+// 重複の確認と書き込みの間に同じ値が入った場合に、重複として扱うために使う
+func IsUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// 1062: 重複したキー
+		return mysqlErr.Number == 1062
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// 23505: 一意制約違反
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+// conn クエリを実行する前にDialectでプレースホルダーを変換する*sql.DB
+// リポジトリのクエリをデータベースごとに書き分けなくて済むようにする
+// 実行したクエリはリポジトリごとのStatementCacheで準備して使い回す
+type conn struct {
+	*sql.DB
+	dialect Dialect
+	stmts   *StatementCache
+}
+
+func newConn(db *sql.DB, dialect Dialect) conn {
+	return conn{DB: db, dialect: dialect, stmts: NewStatementCache(db)}
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := observeQuery(ctx, c.dialect, query)
+	result, err := c.stmts.ExecContext(ctx, c.dialect.Rebind(query), args...)
+	done(err)
+	return result, err
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := observeQuery(ctx, c.dialect, query)
+	rows, err := c.stmts.QueryContext(ctx, c.dialect.Rebind(query), args...)
+	done(err)
+	return rows, err
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := observeQuery(ctx, c.dialect, query)
+	row := c.stmts.QueryRowContext(ctx, c.dialect.Rebind(query), args...)
+	done(row.Err())
+	return row
+}
+
+func (c conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (txConn, error) {
+	tx, err := c.DB.BeginTx(ctx, opts)
+	return txConn{Tx: tx, dialect: c.dialect, stmts: c.stmts}, err
+}
+
+func (c conn) InsertID(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, done := observeQuery(ctx, c.dialect, query)
+	id, err := c.dialect.InsertID(ctx, c.DB, query, args...)
+	done(err)
+	return id, err
+}
+
+// txConn connのトランザクション版
+type txConn struct {
+	*sql.Tx
+	dialect Dialect
+	stmts   *StatementCache
+}
+
+func (t txConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := observeQuery(ctx, t.dialect, query)
+	result, err := t.stmts.TxExecContext(ctx, t.Tx, t.dialect.Rebind(query), args...)
+	done(err)
+	return result, err
+}
+
+func (t txConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := observeQuery(ctx, t.dialect, query)
+	rows, err := t.Tx.QueryContext(ctx, t.dialect.Rebind(query), args...)
+	done(err)
+	return rows, err
+}
+
+func (t txConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := observeQuery(ctx, t.dialect, query)
+	row := t.stmts.TxQueryRowContext(ctx, t.Tx, t.dialect.Rebind(query), args...)
+	done(row.Err())
+	return row
+}
+
+func (t txConn) InsertID(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, done := observeQuery(ctx, t.dialect, query)
+	id, err := t.dialect.InsertID(ctx, t.Tx, query, args...)
+	done(err)
+	return id, err
+}
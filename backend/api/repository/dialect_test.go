@@ -0,0 +1,27 @@
+package repository
+
+import "testing"
+
+func TestUpsert(t *testing.T) {
+	set := "wins = player_stats.wins + VALUES(wins), rating = VALUES(rating)"
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{DriverMySQL, " ON DUPLICATE KEY UPDATE wins = player_stats.wins + VALUES(wins), rating = VALUES(rating)"},
+		{DriverPostgres, " ON CONFLICT (username, game_type) DO UPDATE SET wins = player_stats.wins + EXCLUDED.wins, rating = EXCLUDED.rating"},
+		{DriverSQLite, " ON CONFLICT (username, game_type) DO UPDATE SET wins = player_stats.wins + EXCLUDED.wins, rating = EXCLUDED.rating"},
+	}
+	for _, tt := range tests {
+		if got := DialectFor(tt.driver).Upsert([]string{"username", "game_type"}, set); got != tt.want {
+			t.Errorf("%s: Upsert() = %q, want %q", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresRebind(t *testing.T) {
+	got := DialectFor(DriverPostgres).Rebind("UPDATE users SET role = ? WHERE username = ?")
+	if want := "UPDATE users SET role = $1 WHERE username = $2"; got != want {
+		t.Errorf("Rebind() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlEmailRepository struct {
+	db conn
+}
+
+// NewSQLEmailRepository データベースにメールアドレスとトークンを保存するEmailRepositoryを作成する
+func NewSQLEmailRepository(db *sql.DB) EmailRepository {
+	return newSQLEmailRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLEmailRepository(db *sql.DB, dialect Dialect) EmailRepository {
+	return &sqlEmailRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlEmailRepository) EmailVerified(ctx context.Context, username string) (bool, error) {
+	var verifiedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, "SELECT email_verified_at FROM users WHERE username = ?", username).Scan(&verifiedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return verifiedAt.Valid, nil
+}
+
+func (r *sqlEmailRepository) SetEmail(ctx context.Context, username, email string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users SET email_verified_at = CASE WHEN email = ? THEN email_verified_at END, email = ?
+		WHERE username = ?`,
+		email, email, username,
+	)
+	return err
+}
+
+func (r *sqlEmailRepository) IssueEmailToken(ctx context.Context, token EmailToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE email_tokens SET used_at = ? WHERE username = ? AND purpose = ? AND used_at IS NULL",
+		time.Now(), token.Username, token.Purpose,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO email_tokens (token_hash, username, purpose, expires_at) VALUES (?, ?, ?, ?)",
+		token.Hash, token.Username, token.Purpose, token.ExpiresAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// consumeEmailToken トークンを使用済みにして、発行先のユーザー名を返す
+// 期限切れ・使用済み・存在しないトークンはErrNotFoundを返す
+// 使用済みにする更新で有効なトークンかを判定するので、同時に使われても1回しか成功しない
+func consumeEmailToken(ctx context.Context, tx txConn, tokenHash, purpose string) (string, error) {
+	now := time.Now()
+	res, err := tx.ExecContext(ctx,
+		"UPDATE email_tokens SET used_at = ? WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+		now, tokenHash, purpose, now,
+	)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrNotFound
+	}
+
+	var username string
+	err = tx.QueryRowContext(ctx, "SELECT username FROM email_tokens WHERE token_hash = ?", tokenHash).Scan(&username)
+	return username, err
+}
+
+func (r *sqlEmailRepository) VerifyEmail(ctx context.Context, tokenHash string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	username, err := consumeEmailToken(ctx, tx, tokenHash, EmailTokenVerify)
+	if err != nil {
+		return "", err
+	}
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM users u JOIN users other ON LOWER(other.email) = LOWER(u.email)
+			WHERE u.username = ? AND other.username <> u.username AND other.email_verified_at IS NOT NULL
+		)`,
+		username,
+	).Scan(&taken); err != nil {
+		return "", err
+	}
+	if taken {
+		return "", ErrConflict
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE users SET email_verified_at = ? WHERE username = ?", time.Now(), username)
+	// 同時に同じメールアドレスを確認した場合は、一意制約で後の方が失敗する
+	if IsUniqueViolation(err) {
+		return "", ErrConflict
+	}
+	if err != nil {
+		return "", err
+	}
+	return username, tx.Commit()
+}
+
+func (r *sqlEmailRepository) VerifiedUser(ctx context.Context, email string) (string, error) {
+	var username string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT username FROM users WHERE LOWER(email) = LOWER(?) AND email_verified_at IS NOT NULL",
+		email,
+	).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return username, err
+}
+
+func (r *sqlEmailRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	username, err := consumeEmailToken(ctx, tx, tokenHash, EmailTokenReset)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE username = ?", passwordHash, username); err != nil {
+		return "", err
+	}
+	return username, tx.Commit()
+}
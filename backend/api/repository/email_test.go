@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyEmailConflict(t *testing.T) {
+	db := openSQLite(t)
+	emails := newSQLEmailRepository(db, DialectFor(DriverSQLite))
+	ctx := context.Background()
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := db.Exec("INSERT INTO users (username, password, email) VALUES (?, '', ?)", username, "shared@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := emails.IssueEmailToken(ctx, EmailToken{Hash: username, Username: username, Purpose: EmailTokenVerify, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if username, err := emails.VerifyEmail(ctx, "alice"); err != nil || username != "alice" {
+		t.Fatalf("VerifyEmail(alice) = %q, %v", username, err)
+	}
+	if _, err := emails.VerifyEmail(ctx, "alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("VerifyEmail twice = %v, want ErrNotFound", err)
+	}
+	if _, err := emails.VerifyEmail(ctx, "bob"); !errors.Is(err, ErrConflict) {
+		t.Errorf("VerifyEmail(bob) = %v, want ErrConflict", err)
+	}
+	if verified, err := emails.EmailVerified(ctx, "bob"); err != nil || verified {
+		t.Errorf("EmailVerified(bob) = %v, %v, want false", verified, err)
+	}
+	if username, err := emails.VerifiedUser(ctx, "Shared@Example.com"); err != nil || username != "alice" {
+		t.Errorf("VerifiedUser = %q, %v, want alice", username, err)
+	}
+}
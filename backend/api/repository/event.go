@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type sqlEventRepository struct {
+	db conn
+}
+
+// NewSQLEventRepository データベースに送信前の対戦のイベントを保存するEventRepositoryを作成する
+func NewSQLEventRepository(db *sql.DB) EventRepository {
+	return newSQLEventRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLEventRepository(db *sql.DB, dialect Dialect) EventRepository {
+	return &sqlEventRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlEventRepository) SaveEvent(ctx context.Context, e OutboxEvent) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO match_events (event_id, event_type, room_id, payload, created_at) VALUES (?, ?, ?, ?, ?)",
+		e.EventID, e.Type, e.RoomID, e.Payload, e.CreatedAt,
+	)
+	return err
+}
+
+func (r *sqlEventRepository) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, event_id, event_type, room_id, payload, created_at FROM match_events WHERE delivered_at IS NULL ORDER BY id LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Type, &e.RoomID, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		pending = append(pending, e)
+	}
+	return pending, rows.Err()
+}
+
+// idList IN句のプレースホルダーと引数を作る
+func idList(ids []int64) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")", args
+}
+
+func (r *sqlEventRepository) MarkDelivered(ctx context.Context, ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := idList(ids)
+	_, err := r.db.ExecContext(ctx, "UPDATE match_events SET delivered_at = ? WHERE id IN "+in, append([]interface{}{at}, args...)...)
+	return err
+}
+
+func (r *sqlEventRepository) IncrementAttempts(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	in, args := idList(ids)
+	_, err := r.db.ExecContext(ctx, "UPDATE match_events SET attempts = attempts + 1 WHERE id IN "+in, args...)
+	return err
+}
+
+func (r *sqlEventRepository) DeleteDelivered(ctx context.Context, before time.Time) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM match_events WHERE delivered_at < ?", before)
+	return err
+}
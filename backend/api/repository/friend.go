@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlFriendRepository struct {
+	db conn
+}
+
+// NewSQLFriendRepository データベースにフレンドを保存するFriendRepositoryを作成する
+func NewSQLFriendRepository(db *sql.DB) FriendRepository {
+	return newSQLFriendRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLFriendRepository(db *sql.DB, dialect Dialect) FriendRepository {
+	return &sqlFriendRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlFriendRepository) AreFriends(ctx context.Context, username, friendUsername string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM friends WHERE username = ? AND friend_username = ?)",
+		username, friendUsername,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqlFriendRepository) CreateFriendRequest(ctx context.Context, username, friendUsername string) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO friend_requests (username, friend_username) VALUES (?, ?)",
+		username, friendUsername,
+	)
+	if IsUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *sqlFriendRepository) RespondFriendRequest(ctx context.Context, id int, username string, accept bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := FriendRequestRejected
+	if accept {
+		status = FriendRequestAccepted
+	}
+	// 状態の変更で申請を確保してから送った側を読むので、同時に応答しても片方しか反映されない
+	res, err := tx.ExecContext(ctx,
+		"UPDATE friend_requests SET status = ? WHERE id = ? AND friend_username = ? AND status = ?",
+		status, id, username, FriendRequestPending,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if !accept {
+		return tx.Commit()
+	}
+
+	var sender string
+	if err := tx.QueryRowContext(ctx, "SELECT username FROM friend_requests WHERE id = ?", id).Scan(&sender); err != nil {
+		return err
+	}
+	// 相手からも申請していた場合など、既にフレンドの方向は追加しない
+	for _, pair := range [][2]string{{username, sender}, {sender, username}} {
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM friends WHERE username = ? AND friend_username = ?)",
+			pair[0], pair[1],
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO friends (username, friend_username) VALUES (?, ?)",
+			pair[0], pair[1],
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlFriendRepository) PendingFriendRequests(ctx context.Context, username string) ([]FriendRequest, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, username, friend_username, status
+		FROM friend_requests
+		WHERE friend_username = ? AND status = ?
+		ORDER BY id`,
+		username, FriendRequestPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []FriendRequest
+	for rows.Next() {
+		var request FriendRequest
+		if err := rows.Scan(&request.ID, &request.Username, &request.FriendUsername, &request.Status); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
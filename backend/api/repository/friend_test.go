@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRespondFriendRequest(t *testing.T) {
+	friends := newSQLFriendRepository(openSQLite(t), DialectFor(DriverSQLite))
+	ctx := context.Background()
+
+	// 両方から申請していても、フレンドの関係は1組だけになる
+	for _, pair := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+		if err := friends.CreateFriendRequest(ctx, pair[0], pair[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := friends.CreateFriendRequest(ctx, "alice", "bob"); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateFriendRequest twice = %v, want ErrConflict", err)
+	}
+	pending, err := friends.PendingFriendRequests(ctx, "bob")
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingFriendRequests = %v, %v", pending, err)
+	}
+	if err := friends.RespondFriendRequest(ctx, pending[0].ID, "carol", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("respond by other = %v, want ErrNotFound", err)
+	}
+	if err := friends.RespondFriendRequest(ctx, pending[0].ID, "bob", true); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = friends.PendingFriendRequests(ctx, "alice")
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingFriendRequests = %v, %v", pending, err)
+	}
+	if err := friends.RespondFriendRequest(ctx, pending[0].ID, "alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := friends.AreFriends(ctx, "bob", "alice"); err != nil || !ok {
+		t.Errorf("AreFriends = %v, %v", ok, err)
+	}
+}
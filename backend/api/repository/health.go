@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"sys3/api/logging"
+	"time"
+)
+
+const (
+	// DefaultHealthInterval 接続できている間にPingする間隔のデフォルト
+	DefaultHealthInterval = 10 * time.Second
+	// 接続できない間のPingの間隔。失敗するたびに倍にする
+	initialHealthBackoff = time.Second
+	maxHealthBackoff     = 30 * time.Second
+)
+
+// HealthStatus データベースへの接続状態
+type HealthStatus struct {
+	Healthy bool      `json:"healthy"`
+	Since   time.Time `json:"since"`           // この状態になった日時
+	Error   string    `json:"error,omitempty"` // 接続できない場合の最後のエラー
+}
+
+// Health データベースに定期的にPingして接続状態を保持する
+// 接続できない間は間隔を空けながらPingを繰り返し、接続が戻ったら通常の間隔に戻す
+// 切れた接続はdatabase/sqlが破棄して作り直すので、Pingが成功すれば再接続できている
+type Health struct {
+	db       *sql.DB
+	interval time.Duration
+
+	healthy atomic.Bool
+	mu      sync.Mutex
+	since   time.Time
+	lastErr error
+}
+
+// NewHealth dbの接続状態を確認するHealthを作成する。起動時は接続できているものとする
+// intervalが0以下の場合はDefaultHealthIntervalを使う
+func NewHealth(db *sql.DB, interval time.Duration) *Health {
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	h := &Health{db: db, interval: interval, since: time.Now()}
+	h.healthy.Store(true)
+	return h
+}
+
+// Healthy データベースに接続できているかを返す
+func (h *Health) Healthy() bool {
+	return h.healthy.Load()
+}
+
+// Status 接続状態の詳細を返す
+func (h *Health) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := HealthStatus{Healthy: h.healthy.Load(), Since: h.since}
+	if h.lastErr != nil && !status.Healthy {
+		status.Error = h.lastErr.Error()
+	}
+	return status
+}
+
+// Start ctxが終了するまでPingを繰り返すゴルーチンを起動する
+func (h *Health) Start(ctx context.Context) {
+	go func() {
+		delay := h.interval
+		failing := false // 直前のPingが失敗していたか
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			pingCtx, cancel := WithTimeout(ctx)
+			err := h.db.PingContext(pingCtx)
+			cancel()
+			h.set(err)
+
+			switch {
+			case err == nil:
+				delay = h.interval
+			case !failing:
+				delay = initialHealthBackoff
+			default:
+				delay = min(delay*2, maxHealthBackoff)
+			}
+			failing = err != nil
+		}
+	}()
+}
+
+// set Pingの結果を反映する。状態が変わったときだけログに残す
+func (h *Health) set(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	healthy := err == nil
+	h.lastErr = err
+	if h.healthy.Load() == healthy {
+		return
+	}
+	h.healthy.Store(healthy)
+	h.since = time.Now()
+	if healthy {
+		slog.Info("データベースへの接続が回復しました")
+	} else {
+		slog.Error("データベースに接続できません。新しい対戦の受付を停止します", logging.Err(err))
+	}
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type sqlMatchRepository struct {
+	db conn
+}
+
+// NewSQLMatchRepository データベースの対戦履歴を参照するMatchRepositoryを作成する
+func NewSQLMatchRepository(db *sql.DB) MatchRepository {
+	return newSQLMatchRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLMatchRepository(db *sql.DB, dialect Dialect) MatchRepository {
+	return &sqlMatchRepository{db: newConn(db, dialect)}
+}
+
+// summary 読み込んだ対戦を対戦履歴の1件にする
+func (row matchRow) summary() MatchSummary {
+	m := MatchSummary{
+		ID:           row.ID,
+		GameType:     row.GameType,
+		Mode:         "ranked",
+		Player1ID:    row.Player1ID,
+		Player2ID:    row.Player2ID,
+		Player1Score: row.Player1Score,
+		Player2Score: row.Player2Score,
+		WinnerID:     row.WinnerID.String,
+		EndedAt:      row.CreatedAt.Time,
+	}
+	if !row.Rated {
+		m.Mode = "casual"
+	}
+	if row.StartedAt.Valid {
+		m.StartedAt = &row.StartedAt.Time
+		m.DurationMs = m.EndedAt.Sub(row.StartedAt.Time).Milliseconds()
+	}
+	return m
+}
+
+func (r *sqlMatchRepository) ListByPlayer(ctx context.Context, filter MatchFilter) ([]MatchSummary, int, error) {
+	username := filter.Username
+	conditions := []string{"(m.player1_id = ? OR m.player2_id = ?)"}
+	args := []interface{}{username, username}
+
+	if filter.GameType != "" {
+		conditions = append(conditions, "m.game_type = ?")
+		args = append(args, filter.GameType)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "m.created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "m.created_at < ?")
+		args = append(args, filter.To)
+	}
+	switch filter.Result {
+	case ResultWin:
+		conditions = append(conditions, "m.winner_id = ?")
+		args = append(args, username)
+	case ResultLoss:
+		conditions = append(conditions, "m.winner_id IS NOT NULL AND m.winner_id <> ?")
+		args = append(args, username)
+	case ResultDraw:
+		conditions = append(conditions, "m.winner_id IS NULL")
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM matches m WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+matchRowColumns+`, rh.old_rating, rh.new_rating
+		FROM matches m
+		LEFT JOIN rating_history rh ON rh.match_id = m.id AND rh.username = ?
+		WHERE `+where+`
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ? OFFSET ?`,
+		append(append([]interface{}{username}, args...), filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	matches := []MatchSummary{}
+	for rows.Next() {
+		var oldRating, newRating sql.NullInt64
+		row, err := scanMatchRow(rows, &oldRating, &newRating)
+		if err != nil {
+			return nil, 0, err
+		}
+		m := row.summary()
+		m.setPerspective(username)
+		if oldRating.Valid && newRating.Valid {
+			delta := int(newRating.Int64 - oldRating.Int64)
+			m.RatingChange = &delta
+		}
+		matches = append(matches, m)
+	}
+	return matches, total, rows.Err()
+}
+
+func (r *sqlMatchRepository) Get(ctx context.Context, id int64) (MatchDetail, error) {
+	row, err := r.db.GetMatch(ctx, id)
+	if err == sql.ErrNoRows {
+		return MatchDetail{}, ErrNotFound
+	}
+	if err != nil {
+		return MatchDetail{}, err
+	}
+
+	players, err := r.db.ListMatchPlayers(ctx, id)
+	if err != nil {
+		return MatchDetail{}, err
+	}
+	detail := MatchDetail{MatchSummary: row.summary(), Players: []MatchPlayerResult{}}
+	for _, p := range players {
+		detail.Players = append(detail.Players, MatchPlayerResult{
+			Username:  p.Username,
+			OldRating: p.OldRating,
+			NewRating: p.NewRating,
+			Delta:     p.NewRating - p.OldRating,
+			AnswerMs:  int(p.AnswerMs.Int32),
+		})
+	}
+	return detail, nil
+}
+
+func (r *sqlMatchRepository) Answers(ctx context.Context, id int64) ([]MatchAnswer, error) {
+	rows, err := r.db.ListMatchAnswers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	buzzes, err := r.db.ListMatchBuzzes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]MatchAnswer, len(rows))
+	index := make(map[int]int, len(rows))
+	for i, row := range rows {
+		answers[i] = MatchAnswer{
+			QuestionNo:      row.QuestionNo,
+			QuestionID:      row.QuestionID,
+			QuestionVersion: int(row.QuestionVersion.Int32),
+			QuestionText:    row.QuestionText,
+			CorrectAnswer:   row.CorrectAnswer,
+			PlayerID:        row.PlayerID.String,
+			Answer:          row.Answer,
+			Correct:         row.Correct,
+			LatencyMs:       int(row.LatencyMs.Int32),
+			Buzzes:          []MatchBuzz{},
+		}
+		index[row.QuestionNo] = i
+	}
+	for _, b := range buzzes {
+		if i, ok := index[b.QuestionNo]; ok {
+			answers[i].Buzzes = append(answers[i].Buzzes, MatchBuzz{PlayerID: b.PlayerID, LatencyMs: b.LatencyMs, Granted: b.Granted})
+		}
+	}
+	return answers, nil
+}
+
+func (r *sqlMatchRepository) FastAnswerers(ctx context.Context, belowMs, minCount int) ([]FastAnswerer, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT player_id, COUNT(*), AVG(latency_ms), MIN(latency_ms)
+		FROM match_answers
+		WHERE correct = TRUE AND player_id IS NOT NULL AND latency_ms < ?
+		GROUP BY player_id
+		HAVING COUNT(*) >= ?
+		ORDER BY COUNT(*) DESC
+		LIMIT 100`,
+		belowMs, minCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	players := []FastAnswerer{}
+	for rows.Next() {
+		var p FastAnswerer
+		if err := rows.Scan(&p.Username, &p.FastCorrect, &p.AvgLatencyMs, &p.MinLatencyMs); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+func (r *sqlMatchRepository) DeleteGuestMatches(ctx context.Context, prefix string, before time.Time) (int64, error) {
+	pattern := prefix + "%"
+	const guestMatches = "SELECT id FROM matches WHERE rated = FALSE AND created_at < ? AND (player1_id LIKE ? OR player2_id LIKE ?)"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"match_buzzes", "match_answers"} {
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE match_id IN ("+guestMatches+")", before, pattern, pattern)
+		if err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM matches
+		WHERE rated = FALSE AND created_at < ? AND (player1_id LIKE ? OR player2_id LIKE ?)`,
+		before, pattern, pattern,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
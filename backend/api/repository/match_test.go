@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteGuestMatches(t *testing.T) {
+	db := openSQLite(t)
+	matches := newSQLMatchRepository(db, DialectFor(DriverSQLite))
+	statements := []string{
+		// 1: 古いゲストのカジュアル戦だけが削除される
+		"INSERT INTO matches (id, rated, player1_id, player2_id, player1_score, player2_score, created_at) VALUES (1, FALSE, 'guest_1', 'alice', 0, 1, '2020-01-01 00:00:00')",
+		"INSERT INTO matches (id, rated, player1_id, player2_id, player1_score, player2_score, created_at) VALUES (2, TRUE, 'guest_1', 'alice', 0, 1, '2020-01-01 00:00:00')",
+		"INSERT INTO matches (id, rated, player1_id, player2_id, player1_score, player2_score, created_at) VALUES (3, FALSE, 'guest_2', 'alice', 0, 1, '2099-01-01 00:00:00')",
+		"INSERT INTO matches (id, rated, player1_id, player2_id, player1_score, player2_score, created_at) VALUES (4, FALSE, 'bob', 'alice', 0, 1, '2020-01-01 00:00:00')",
+		"INSERT INTO match_answers (match_id, question_no, question_id, player_id, answer, correct) VALUES (1, 1, 10, 'alice', 'a', TRUE), (4, 1, 10, 'alice', 'a', TRUE)",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := matches.DeleteGuestMatches(context.Background(), "guest_", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("deleted = %d, want 1", n)
+	}
+	var remaining, answers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM matches").Scan(&remaining); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM match_answers").Scan(&answers); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 3 || answers != 1 {
+		t.Errorf("matches = %d, answers = %d, want 3 and 1", remaining, answers)
+	}
+}
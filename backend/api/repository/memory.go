@@ -0,0 +1,1058 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository メモリ上にアカウントを保存するUserRepository
+// ゲストの対戦記録は保存しないので、NewUser.MergeGuestIDは無視する
+type MemoryUserRepository struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+// NewMemoryUserRepository 空のMemoryUserRepositoryを作成する
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: make(map[string]User)}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user NewUser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createLocked(User{Username: user.Username, PasswordHash: user.PasswordHash, Role: "player"})
+}
+
+func (r *MemoryUserRepository) createLocked(user User) error {
+	if r.takenLocked(user.Username) {
+		return ErrConflict
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	r.users[user.Username] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) takenLocked(username string) bool {
+	for name := range r.users {
+		if strings.EqualFold(name, username) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryUserRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[username]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *MemoryUserRepository) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.takenLocked(username), nil
+}
+
+func (r *MemoryUserRepository) GetRole(ctx context.Context, username string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[username]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return user.Role, nil
+}
+
+func (r *MemoryUserRepository) SetRole(ctx context.Context, username, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	r.users[username] = user
+	return nil
+}
+
+// MemoryOAuthRepository メモリ上に外部サービスとの連携を保存するOAuthRepository
+// OAuthLink.CreateUserで作成するアカウントはusersに保存する
+type MemoryOAuthRepository struct {
+	users *MemoryUserRepository
+	links map[[2]string]string
+}
+
+// NewMemoryOAuthRepository usersにアカウントを作成するMemoryOAuthRepositoryを作成する
+func NewMemoryOAuthRepository(users *MemoryUserRepository) *MemoryOAuthRepository {
+	return &MemoryOAuthRepository{users: users, links: make(map[[2]string]string)}
+}
+
+func (r *MemoryOAuthRepository) LinkedUser(ctx context.Context, provider, providerUserID string) (string, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	username, ok := r.links[[2]string{provider, providerUserID}]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return username, nil
+}
+
+func (r *MemoryOAuthRepository) LinkAccount(ctx context.Context, link OAuthLink) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	key := [2]string{link.Provider, link.ProviderUserID}
+	if _, ok := r.links[key]; ok {
+		return ErrConflict
+	}
+	if link.CreateUser {
+		if err := r.users.createLocked(User{Username: link.Username, Role: "player"}); err != nil {
+			return err
+		}
+	}
+	r.links[key] = link.Username
+	return nil
+}
+
+// MemoryFriendRepository メモリ上にフレンドを保存するFriendRepository
+// テストやデータベースを使わない開発環境で使う
+type MemoryFriendRepository struct {
+	mu       sync.Mutex
+	friends  map[[2]string]bool
+	requests []FriendRequest
+}
+
+// NewMemoryFriendRepository 空のMemoryFriendRepositoryを作成する
+func NewMemoryFriendRepository() *MemoryFriendRepository {
+	return &MemoryFriendRepository{friends: make(map[[2]string]bool)}
+}
+
+func (r *MemoryFriendRepository) AreFriends(ctx context.Context, username, friendUsername string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.friends[[2]string{username, friendUsername}], nil
+}
+
+func (r *MemoryFriendRepository) CreateFriendRequest(ctx context.Context, username, friendUsername string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, request := range r.requests {
+		if request.Username == username && request.FriendUsername == friendUsername {
+			return ErrConflict
+		}
+	}
+	r.requests = append(r.requests, FriendRequest{
+		ID:             len(r.requests) + 1,
+		Username:       username,
+		FriendUsername: friendUsername,
+		Status:         FriendRequestPending,
+	})
+	return nil
+}
+
+func (r *MemoryFriendRepository) RespondFriendRequest(ctx context.Context, id int, username string, accept bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, request := range r.requests {
+		if request.ID != id || request.FriendUsername != username || request.Status != FriendRequestPending {
+			continue
+		}
+		if !accept {
+			r.requests[i].Status = FriendRequestRejected
+			return nil
+		}
+		r.requests[i].Status = FriendRequestAccepted
+		r.friends[[2]string{username, request.Username}] = true
+		r.friends[[2]string{request.Username, username}] = true
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryFriendRepository) PendingFriendRequests(ctx context.Context, username string) ([]FriendRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var requests []FriendRequest
+	for _, request := range r.requests {
+		if request.FriendUsername == username && request.Status == FriendRequestPending {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+// MemoryProfileRepository メモリ上にプロフィールを保存するProfileRepository
+type MemoryProfileRepository struct {
+	mu       sync.Mutex
+	profiles map[string]Profile
+}
+
+// NewMemoryProfileRepository 空のMemoryProfileRepositoryを作成する
+func NewMemoryProfileRepository() *MemoryProfileRepository {
+	return &MemoryProfileRepository{profiles: make(map[string]Profile)}
+}
+
+func (r *MemoryProfileRepository) Profile(ctx context.Context, username string) (Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if profile, ok := r.profiles[username]; ok {
+		return profile, nil
+	}
+	return Profile{Username: username}, nil
+}
+
+func (r *MemoryProfileRepository) SaveProfile(ctx context.Context, p Profile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles[p.Username] = p
+	return nil
+}
+
+// MemoryEmailRepository メモリ上にトークンを保存するEmailRepository
+// メールアドレスとパスワードはusersのアカウントに保存する
+type MemoryEmailRepository struct {
+	users  *MemoryUserRepository
+	tokens map[string]memoryEmailToken
+}
+
+type memoryEmailToken struct {
+	EmailToken
+	used bool
+}
+
+// NewMemoryEmailRepository usersのアカウントを使うMemoryEmailRepositoryを作成する
+func NewMemoryEmailRepository(users *MemoryUserRepository) *MemoryEmailRepository {
+	return &MemoryEmailRepository{users: users, tokens: make(map[string]memoryEmailToken)}
+}
+
+func (r *MemoryEmailRepository) EmailVerified(ctx context.Context, username string) (bool, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	return r.users.users[username].EmailVerifiedAt != nil, nil
+}
+
+func (r *MemoryEmailRepository) SetEmail(ctx context.Context, username, email string) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	user, ok := r.users.users[username]
+	if !ok {
+		return nil
+	}
+	if user.Email != email {
+		user.EmailVerifiedAt = nil
+	}
+	user.Email = email
+	r.users.users[username] = user
+	return nil
+}
+
+func (r *MemoryEmailRepository) IssueEmailToken(ctx context.Context, token EmailToken) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	for hash, t := range r.tokens {
+		if t.Username == token.Username && t.Purpose == token.Purpose {
+			t.used = true
+			r.tokens[hash] = t
+		}
+	}
+	r.tokens[token.Hash] = memoryEmailToken{EmailToken: token}
+	return nil
+}
+
+// validTokenLocked 期限切れでなく未使用のトークンを返す
+func (r *MemoryEmailRepository) validTokenLocked(tokenHash, purpose string) (memoryEmailToken, bool) {
+	t, ok := r.tokens[tokenHash]
+	if !ok || t.used || t.Purpose != purpose || !time.Now().Before(t.ExpiresAt) {
+		return memoryEmailToken{}, false
+	}
+	return t, true
+}
+
+func (r *MemoryEmailRepository) VerifyEmail(ctx context.Context, tokenHash string) (string, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	t, ok := r.validTokenLocked(tokenHash, EmailTokenVerify)
+	if !ok {
+		return "", ErrNotFound
+	}
+	user := r.users.users[t.Username]
+	for _, other := range r.users.users {
+		if other.Username != user.Username && other.EmailVerifiedAt != nil && strings.EqualFold(other.Email, user.Email) {
+			return "", ErrConflict
+		}
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	r.users.users[user.Username] = user
+	t.used = true
+	r.tokens[tokenHash] = t
+	return user.Username, nil
+}
+
+func (r *MemoryEmailRepository) VerifiedUser(ctx context.Context, email string) (string, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	for _, user := range r.users.users {
+		if user.EmailVerifiedAt != nil && strings.EqualFold(user.Email, email) {
+			return user.Username, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (r *MemoryEmailRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	t, ok := r.validTokenLocked(tokenHash, EmailTokenReset)
+	if !ok {
+		return "", ErrNotFound
+	}
+	user := r.users.users[t.Username]
+	user.PasswordHash = passwordHash
+	r.users.users[user.Username] = user
+	t.used = true
+	r.tokens[tokenHash] = t
+	return user.Username, nil
+}
+
+// MemorySeasonRepository メモリ上にシーズンを保存するSeasonRepository
+// シーズンの終了処理で使うプレイヤーのレートはSetRatingで設定する
+type MemorySeasonRepository struct {
+	mu      sync.Mutex
+	seasons []Season
+	ratings map[[2]string]int // ユーザー名とゲームの種類ごとのレート
+	results []SeasonRating
+}
+
+// NewMemorySeasonRepository 空のMemorySeasonRepositoryを作成する
+func NewMemorySeasonRepository() *MemorySeasonRepository {
+	return &MemorySeasonRepository{ratings: make(map[[2]string]int)}
+}
+
+// SetRating プレイヤーの現在のレートを設定する
+func (r *MemorySeasonRepository) SetRating(username, gameType string, rating int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ratings[[2]string{username, gameType}] = rating
+}
+
+// Rating プレイヤーの現在のレートを返す
+func (r *MemorySeasonRepository) Rating(username, gameType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ratings[[2]string{username, gameType}]
+}
+
+func (r *MemorySeasonRepository) Seasons(ctx context.Context) ([]Season, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seasons := append([]Season(nil), r.seasons...)
+	sort.SliceStable(seasons, func(i, j int) bool { return seasons[i].StartsAt.After(seasons[j].StartsAt) })
+	return seasons, nil
+}
+
+func (r *MemorySeasonRepository) CurrentSeason(ctx context.Context, now time.Time) (Season, error) {
+	seasons, _ := r.Seasons(ctx)
+	for _, s := range seasons {
+		if !s.Finalized && !s.StartsAt.After(now) && s.EndsAt.After(now) {
+			return s, nil
+		}
+	}
+	return Season{}, ErrNotFound
+}
+
+func (r *MemorySeasonRepository) CreateSeason(ctx context.Context, s Season) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.seasons {
+		if other.StartsAt.Before(s.EndsAt) && other.EndsAt.After(s.StartsAt) {
+			return 0, ErrConflict
+		}
+	}
+	s.ID = len(r.seasons) + 1
+	r.seasons = append(r.seasons, s)
+	return int64(s.ID), nil
+}
+
+func (r *MemorySeasonRepository) SetSeasonPool(ctx context.Context, id int, poolID *int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.seasons {
+		if r.seasons[i].ID == id {
+			r.seasons[i].QuestionPoolID = poolID
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemorySeasonRepository) SeasonRatings(ctx context.Context, seasonID int, gameType string, limit, offset int) ([]SeasonRating, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ratings []SeasonRating
+	for _, rating := range r.results {
+		if rating.SeasonID == seasonID && rating.GameType == gameType {
+			ratings = append(ratings, rating)
+		}
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].FinalRank != ratings[j].FinalRank {
+			return ratings[i].FinalRank < ratings[j].FinalRank
+		}
+		return ratings[i].Username < ratings[j].Username
+	})
+	if offset >= len(ratings) {
+		return nil, nil
+	}
+	ratings = ratings[offset:]
+	if len(ratings) > limit {
+		ratings = ratings[:limit]
+	}
+	return ratings, nil
+}
+
+func (r *MemorySeasonRepository) FinalizeSeason(ctx context.Context, id int, resetFactor float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := -1
+	for j := range r.seasons {
+		if r.seasons[j].ID == id {
+			i = j
+		}
+	}
+	if i < 0 {
+		return ErrNotFound
+	}
+	if r.seasons[i].Finalized {
+		return nil
+	}
+	r.seasons[i].Finalized = true
+
+	byGameType := make(map[string][]SeasonRating)
+	for key, rating := range r.ratings {
+		byGameType[key[1]] = append(byGameType[key[1]], SeasonRating{SeasonID: id, GameType: key[1], Username: key[0], Rating: rating})
+	}
+	for gameType, ratings := range byGameType {
+		sort.Slice(ratings, func(a, b int) bool { return ratings[a].Rating > ratings[b].Rating })
+		sum := 0
+		for k := range ratings {
+			// 同じレートは同じ順位にする
+			ratings[k].FinalRank = k + 1
+			if k > 0 && ratings[k].Rating == ratings[k-1].Rating {
+				ratings[k].FinalRank = ratings[k-1].FinalRank
+			}
+			sum += ratings[k].Rating
+		}
+		r.results = append(r.results, ratings...)
+
+		mean := float64(sum) / float64(len(ratings))
+		for _, rating := range ratings {
+			r.ratings[[2]string{rating.Username, gameType}] = int(math.Round(mean + (float64(rating.Rating)-mean)*resetFactor))
+		}
+	}
+	return nil
+}
+
+func (r *MemorySeasonRepository) ExpiredSeasons(ctx context.Context, now time.Time) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seasons := append([]Season(nil), r.seasons...)
+	sort.SliceStable(seasons, func(i, j int) bool { return seasons[i].EndsAt.Before(seasons[j].EndsAt) })
+	var ids []int
+	for _, s := range seasons {
+		if !s.Finalized && !s.EndsAt.After(now) {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids, nil
+}
+
+// MemoryPoolRepository メモリ上に問題のプールを保存するPoolRepository
+// 問題は保存しないので、QuestionCountは作成時に指定した値のまま変わらない
+type MemoryPoolRepository struct {
+	mu     sync.Mutex
+	pools  []QuestionPool
+	nextID int
+}
+
+// NewMemoryPoolRepository 空のMemoryPoolRepositoryを作成する
+func NewMemoryPoolRepository() *MemoryPoolRepository {
+	return &MemoryPoolRepository{}
+}
+
+func (r *MemoryPoolRepository) Pools(ctx context.Context) ([]QuestionPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pools := append([]QuestionPool(nil), r.pools...)
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools, nil
+}
+
+func (r *MemoryPoolRepository) GetPool(ctx context.Context, id int) (QuestionPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.pools {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return QuestionPool{}, ErrNotFound
+}
+
+func (r *MemoryPoolRepository) CreatePool(ctx context.Context, p QuestionPool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.pools {
+		if other.Name == p.Name {
+			return 0, ErrConflict
+		}
+	}
+	r.nextID++
+	p.ID = r.nextID
+	r.pools = append(r.pools, p)
+	return p.ID, nil
+}
+
+func (r *MemoryPoolRepository) UpdatePool(ctx context.Context, p QuestionPool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := -1
+	for j, other := range r.pools {
+		if other.ID == p.ID {
+			i = j
+		} else if other.Name == p.Name {
+			return ErrConflict
+		}
+	}
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.pools[i].Name = p.Name
+	r.pools[i].Description = p.Description
+	return nil
+}
+
+func (r *MemoryPoolRepository) DeletePool(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.pools {
+		if p.ID == id {
+			r.pools = append(r.pools[:i], r.pools[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MemoryPlayerDataRepository メモリ上の対戦とレートの変動を返すPlayerDataRepository
+type MemoryPlayerDataRepository struct {
+	mu      sync.Mutex
+	matches []PlayerMatch
+	history map[string][]RatingChange
+}
+
+// NewMemoryPlayerDataRepository 空のMemoryPlayerDataRepositoryを作成する
+func NewMemoryPlayerDataRepository() *MemoryPlayerDataRepository {
+	return &MemoryPlayerDataRepository{history: make(map[string][]RatingChange)}
+}
+
+// AddMatch 対戦を追加する。Answersには両方のプレイヤーの回答を入れる
+func (r *MemoryPlayerDataRepository) AddMatch(m PlayerMatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.matches = append(r.matches, m)
+}
+
+// AddRatingChange プレイヤーのレートの変動を追加する
+func (r *MemoryPlayerDataRepository) AddRatingChange(username string, change RatingChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history[username] = append(r.history[username], change)
+}
+
+func (r *MemoryPlayerDataRepository) CountMatches(ctx context.Context, username string) (int, error) {
+	matches, err := r.Matches(ctx, username)
+	return len(matches), err
+}
+
+func (r *MemoryPlayerDataRepository) Matches(ctx context.Context, username string) ([]PlayerMatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matches := []PlayerMatch{}
+	for _, m := range r.matches {
+		if m.Player1ID != username && m.Player2ID != username {
+			continue
+		}
+		answers := []PlayerAnswer{}
+		for _, a := range m.Answers {
+			if a.PlayerID == username {
+				answers = append(answers, a)
+			}
+		}
+		m.Answers = answers
+		matches = append(matches, m)
+	}
+	return matches, nil
+}
+
+func (r *MemoryPlayerDataRepository) RatingHistory(ctx context.Context, username string) ([]RatingChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RatingChange{}, r.history[username]...), nil
+}
+
+// MemoryRatingRepository メモリ上のレートを参照するRatingRepository
+// 内容はSetRating・SetStats・SetFavoriteCategory・AddSmurfFlagで設定する
+type MemoryRatingRepository struct {
+	mu        sync.Mutex
+	ratings   map[string][]PlayerGameRating // ユーザー名ごと
+	stats     map[string][]PlayerGameStats
+	favorites map[string]string
+	flags     []SmurfFlag
+}
+
+// NewMemoryRatingRepository 空のMemoryRatingRepositoryを作成する
+func NewMemoryRatingRepository() *MemoryRatingRepository {
+	return &MemoryRatingRepository{
+		ratings:   make(map[string][]PlayerGameRating),
+		stats:     make(map[string][]PlayerGameStats),
+		favorites: make(map[string]string),
+	}
+}
+
+// SetRating プレイヤーのゲームの種類のレートを設定する
+func (r *MemoryRatingRepository) SetRating(username string, rating PlayerGameRating) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ratings := r.ratings[username]
+	for i := range ratings {
+		if ratings[i].GameType == rating.GameType {
+			ratings[i] = rating
+			return
+		}
+	}
+	ratings = append(ratings, rating)
+	sort.Slice(ratings, func(i, j int) bool { return ratings[i].GameType < ratings[j].GameType })
+	r.ratings[username] = ratings
+}
+
+// SetStats プレイヤーのゲームの種類の成績を設定する
+func (r *MemoryRatingRepository) SetStats(username string, stats PlayerGameStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.stats[username]
+	for i := range list {
+		if list[i].GameType == stats.GameType {
+			list[i] = stats
+			return
+		}
+	}
+	list = append(list, stats)
+	sort.Slice(list, func(i, j int) bool { return list[i].GameType < list[j].GameType })
+	r.stats[username] = list
+}
+
+// SetFavoriteCategory プレイヤーが最も多く回答した問題のカテゴリーを設定する
+func (r *MemoryRatingRepository) SetFavoriteCategory(username, category string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.favorites[username] = category
+}
+
+// AddSmurfFlag サブアカウントの疑いの記録を追加する
+func (r *MemoryRatingRepository) AddSmurfFlag(flag SmurfFlag) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flags = append(r.flags, flag)
+}
+
+func (r *MemoryRatingRepository) Rating(ctx context.Context, username, gameType string) (int, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rating := range r.ratings[username] {
+		if rating.GameType == gameType {
+			return rating.Rating, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (r *MemoryRatingRepository) Top(ctx context.Context, gameType string, limit int) ([]PlayerRating, error) {
+	players, err := r.Leaderboard(ctx, gameType)
+	if len(players) > limit {
+		players = players[:limit]
+	}
+	return players, err
+}
+
+func (r *MemoryRatingRepository) Leaderboard(ctx context.Context, gameType string) ([]PlayerRating, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var players []PlayerRating
+	for username, ratings := range r.ratings {
+		for _, rating := range ratings {
+			if rating.GameType == gameType {
+				players = append(players, PlayerRating{Username: username, Rating: rating.Rating})
+			}
+		}
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Rating != players[j].Rating {
+			return players[i].Rating > players[j].Rating
+		}
+		return players[i].Username < players[j].Username
+	})
+	return players, nil
+}
+
+func (r *MemoryRatingRepository) PlayerRatings(ctx context.Context, username string) ([]PlayerGameRating, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]PlayerGameRating{}, r.ratings[username]...), nil
+}
+
+func (r *MemoryRatingRepository) PlayerStats(ctx context.Context, username string) ([]PlayerGameStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]PlayerGameStats{}, r.stats[username]...), nil
+}
+
+func (r *MemoryRatingRepository) FavoriteCategory(ctx context.Context, username string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.favorites[username], nil
+}
+
+func (r *MemoryRatingRepository) SmurfFlags(ctx context.Context, gameType string) ([]SmurfFlag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flags := []SmurfFlag{}
+	for _, flag := range r.flags {
+		if flag.GameType == gameType {
+			flags = append(flags, flag)
+		}
+	}
+	sort.SliceStable(flags, func(i, j int) bool { return flags[i].FlaggedAt.After(flags[j].FlaggedAt) })
+	return flags, nil
+}
+
+// MemorySessionRepository メモリ上にログインセッションを保存するSessionRepository
+type MemorySessionRepository struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionRepository 空のMemorySessionRepositoryを作成する
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{sessions: make(map[string]Session)}
+}
+
+func (r *MemorySessionRepository) CreateSession(ctx context.Context, session Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return ErrConflict
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *MemorySessionRepository) GetSession(ctx context.Context, id, username string) (Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok || s.Username != username {
+		return Session{}, ErrNotFound
+	}
+	return s, nil
+}
+
+// activeLocked 無効にされていないユーザーのセッションを返す
+func (r *MemorySessionRepository) activeLocked(id, username string) (Session, bool) {
+	s, ok := r.sessions[id]
+	return s, ok && s.Username == username && s.RevokedAt == nil
+}
+
+func (r *MemorySessionRepository) ExtendSession(ctx context.Context, id, username string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.activeLocked(id, username)
+	if !ok {
+		return ErrNotFound
+	}
+	s.ExpiresAt = expiresAt
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *MemorySessionRepository) TouchSession(ctx context.Context, id string, now time.Time, interval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok || (s.LastSeenAt != nil && !s.LastSeenAt.Before(now.Add(-interval))) {
+		return nil
+	}
+	s.LastSeenAt = &now
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeSession(ctx context.Context, id, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.activeLocked(id, username)
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	r.sessions[id] = s
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeUserSessions(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for id, s := range r.sessions {
+		if s.Username == username && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			r.sessions[id] = s
+		}
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) ActiveSessions(ctx context.Context, username string, now time.Time) ([]Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := []Session{}
+	for _, s := range r.sessions {
+		if s.Username == username && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	lastUsed := func(s Session) time.Time {
+		if s.LastSeenAt != nil {
+			return *s.LastSeenAt
+		}
+		return s.CreatedAt
+	}
+	sort.Slice(sessions, func(i, j int) bool { return lastUsed(sessions[i]).After(lastUsed(sessions[j])) })
+	return sessions, nil
+}
+
+// MemoryAPIKeyRepository メモリ上にAPIキーを保存するAPIKeyRepository
+type MemoryAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys []APIKey
+	// revoked 無効にしたキーのID
+	revoked map[string]bool
+}
+
+// NewMemoryAPIKeyRepository 空のMemoryAPIKeyRepositoryを作成する
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{revoked: make(map[string]bool)}
+}
+
+func (r *MemoryAPIKeyRepository) CountAPIKeys(ctx context.Context, username string) (int, error) {
+	keys, err := r.APIKeys(ctx, username)
+	return len(keys), err
+}
+
+func (r *MemoryAPIKeyRepository) CreateAPIKey(ctx context.Context, key APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if k.ID == key.ID || k.KeyHash == key.KeyHash {
+			return ErrConflict
+		}
+	}
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) APIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash && !r.revoked[k.ID] {
+			return k, nil
+		}
+	}
+	return APIKey{}, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) TouchAPIKey(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			now := time.Now()
+			r.keys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) APIKeys(ctx context.Context, username string) ([]APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := []APIKey{}
+	for _, k := range r.keys {
+		if k.Username == username && !r.revoked[k.ID] {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) RevokeAPIKey(ctx context.Context, id, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if k.ID == id && k.Username == username && !r.revoked[id] {
+			r.revoked[id] = true
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MemoryAuditRepository メモリ上に管理者の操作の記録を保存するAuditRepository
+type MemoryAuditRepository struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+// NewMemoryAuditRepository 空のMemoryAuditRepositoryを作成する
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.ID = int64(len(r.entries) + 1)
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *MemoryAuditRepository) AuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matched := []AuditEntry{}
+	for _, e := range r.entries {
+		if (filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Action != "" && e.Action != filter.Action) ||
+			(filter.Target != "" && e.Target != filter.Target) ||
+			(!filter.From.IsZero() && e.CreatedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !e.CreatedAt.Before(filter.To)) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+	total := len(matched)
+	start := min(filter.Offset, total)
+	end := min(start+filter.Limit, total)
+	return matched[start:end], total, nil
+}
+
+// MemoryEventRepository メモリ上に送信前の対戦のイベントを保存するEventRepository
+type MemoryEventRepository struct {
+	mu        sync.Mutex
+	events    []OutboxEvent
+	lastID    int64
+	delivered map[int64]time.Time
+	attempts  map[int64]int
+}
+
+// NewMemoryEventRepository 空のMemoryEventRepositoryを作成する
+func NewMemoryEventRepository() *MemoryEventRepository {
+	return &MemoryEventRepository{delivered: make(map[int64]time.Time), attempts: make(map[int64]int)}
+}
+
+func (r *MemoryEventRepository) SaveEvent(ctx context.Context, e OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, saved := range r.events {
+		if saved.EventID == e.EventID {
+			return ErrConflict
+		}
+	}
+	r.lastID++
+	e.ID = r.lastID
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *MemoryEventRepository) PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pending []OutboxEvent
+	for _, e := range r.events {
+		if len(pending) == limit {
+			break
+		}
+		if _, ok := r.delivered[e.ID]; !ok {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (r *MemoryEventRepository) MarkDelivered(ctx context.Context, ids []int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.delivered[id] = at
+	}
+	return nil
+}
+
+func (r *MemoryEventRepository) IncrementAttempts(ctx context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.attempts[id]++
+	}
+	return nil
+}
+
+// Attempts イベントの送信に失敗した回数を返す
+func (r *MemoryEventRepository) Attempts(id int64) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts[id]
+}
+
+func (r *MemoryEventRepository) DeleteDelivered(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.events[:0]
+	for _, e := range r.events {
+		if at, ok := r.delivered[e.ID]; ok && at.Before(before) {
+			delete(r.delivered, e.ID)
+			delete(r.attempts, e.ID)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	r.events = kept
+	return nil
+}
@@ -0,0 +1,507 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Question 問題
+type Question struct {
+	ID              int      `json:"id"`
+	CreatorUsername string   `json:"creator_username"`
+	QuestionText    string   `json:"question_text"`
+	CorrectAnswer   string   `json:"correct_answer"`
+	Choices         []string `json:"choices"`
+	Explanation     string   `json:"explanation"`
+	Status          string   `json:"status"`  // 審査の状態。QuestionApprovedの問題だけを出題する
+	Version         int      `json:"version"` // 内容を変更するたびに1増える
+	Source          string   `json:"source"`  // 問題の出どころ。QuestionSourceCommunityの問題は作成者を投稿者として表示する
+	// 回答の集計から計算した難易度。出題数が足りない間はDifficultyScoreがnilでDifficultyNormalのまま
+	Difficulty      string   `json:"difficulty"`
+	DifficultyScore *float64 `json:"difficulty_score,omitempty"` // 0(易しい)〜1(難しい)
+	// 出題を始める日時と終える日時。どちらもnilなら承認されている間はずっと出題する
+	// 日時になると定期的な切り替えで状態をQuestionScheduled・QuestionApproved・QuestionRetiredの間で変更する
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+	RetireAt   *time.Time `json:"retire_at,omitempty"`
+	// 読み込み時に設定するカテゴリーとタグの名前。変更はSetLabelsで行う
+	Categories []string `json:"categories"`
+	Tags       []string `json:"tags"`
+	// 読み込み時に設定する、問題が入っているプールのID。変更はAddToPool・RemoveFromPoolで行う
+	PoolIDs []int `json:"pool_ids"`
+}
+
+// QuestionVersion 問題のある時点の内容。作成後は変更しない
+type QuestionVersion struct {
+	Version       int       `json:"version"`
+	QuestionText  string    `json:"question_text"`
+	CorrectAnswer string    `json:"correct_answer"`
+	Choices       []string  `json:"choices"`
+	Explanation   string    `json:"explanation"`
+	Editor        string    `json:"editor"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Category 問題のカテゴリー
+type Category struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	QuestionCount int    `json:"question_count"` // 削除されていない問題の数
+}
+
+// QuestionPool テーマのある対戦で出題する問題の集まり。シーズンや部屋の設定で指定する
+type QuestionPool struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	QuestionCount int    `json:"question_count"` // 出題できる承認済みの問題の数
+}
+
+// Tag 問題のタグ
+type Tag struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	QuestionCount int    `json:"question_count"`
+}
+
+// 問題の審査の状態
+const (
+	QuestionDraft         = "draft"          // 作成者が編集中
+	QuestionPendingReview = "pending_review" // モデレーターの審査待ち
+	QuestionApproved      = "approved"       // 出題される
+	QuestionRejected      = "rejected"       // 却下された
+	QuestionSuspended     = "suspended"      // プレイヤーからの報告が多いため出題を停止している
+	QuestionScheduled     = "scheduled"      // 承認済みで、ActivateAtになったら出題を始める
+	QuestionRetired       = "retired"        // RetireAtを過ぎたため出題を終えた
+)
+
+// 問題の出どころ
+const (
+	QuestionSourceAdmin     = "admin"     // 管理者が作成した
+	QuestionSourceImport    = "import"    // ファイルからまとめて取り込んだ
+	QuestionSourceCommunity = "community" // プレイヤーが投稿した
+	QuestionSourceExternal  = "external"  // 外部の問題集から取り込んだ。作成者は問題集の名前
+)
+
+// 問題の難易度
+const (
+	DifficultyEasy   = "easy"
+	DifficultyNormal = "normal"
+	DifficultyHard   = "hard"
+)
+
+// QuestionFilter 出題する問題の絞り込み条件。ゼロ値の項目は絞り込まない
+type QuestionFilter struct {
+	Exclude    []int  // 既に出題した問題のID
+	Difficulty string // DifficultyEasy, DifficultyNormal, DifficultyHard
+	PoolID     int    // このプールに入っている問題だけを対象にする
+}
+
+// Contributor 問題を投稿したプレイヤーと承認された問題の数
+type Contributor struct {
+	Username      string `json:"username"`
+	ApprovedCount int    `json:"approved_count"`
+}
+
+// QuestionReview 問題の審査の記録
+type QuestionReview struct {
+	ID         int       `json:"id"`
+	QuestionID int       `json:"question_id"`
+	Reviewer   string    `json:"reviewer"`
+	FromStatus string    `json:"from_status"`
+	Status     string    `json:"status"`
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// QuestionReport 対戦中にプレイヤーから寄せられた問題の報告
+type QuestionReport struct {
+	ID              int        `json:"id"`
+	QuestionID      int        `json:"question_id"`
+	QuestionVersion int        `json:"question_version"` // 報告した時点で出題されていた版
+	Reporter        string     `json:"reporter"`
+	Reason          string     `json:"reason"` // ReportWrongAnswer, ReportTypo, ReportOffensive
+	Comment         string     `json:"comment"`
+	RoomID          string     `json:"room_id"`
+	GameType        string     `json:"game_type"`
+	Status          string     `json:"status"` // ReportOpen, ReportResolved, ReportDismissed
+	ResolvedBy      string     `json:"resolved_by,omitempty"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// QuestionTranslation 問題の1つの言語への翻訳
+// 選択肢は元の問題と同じ順に並べるので、正解の位置も元の問題と同じになる
+type QuestionTranslation struct {
+	QuestionID    int       `json:"question_id"`
+	Locale        string    `json:"locale"`
+	QuestionText  string    `json:"question_text"`
+	CorrectAnswer string    `json:"correct_answer"`
+	Choices       []string  `json:"choices"`
+	Explanation   string    `json:"explanation"`
+	SourceVersion int       `json:"source_version"` // 翻訳した元の問題の版
+	Translator    string    `json:"translator"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TranslatedVersion 翻訳の有無と古さを調べるための、翻訳した問題・言語と元の版
+type TranslatedVersion struct {
+	QuestionID    int
+	Locale        string
+	SourceVersion int
+}
+
+// 問題の報告の理由
+const (
+	ReportWrongAnswer = "wrong_answer" // 正解が間違っている
+	ReportTypo        = "typo"         // 誤字・脱字
+	ReportOffensive   = "offensive"    // 不快な内容
+)
+
+// 問題の報告の状態
+const (
+	ReportOpen      = "open"      // 未対応
+	ReportResolved  = "resolved"  // 問題を直すなどして対応した
+	ReportDismissed = "dismissed" // 報告が誤りだった
+)
+
+// QuestionStats 問題ごとの回答の集計(対戦の保存時に更新される)
+type QuestionStats struct {
+	QuestionID    int     `json:"question_id"`
+	QuestionText  string  `json:"question_text"`
+	TimesShown    int     `json:"times_shown"`    // 出題された回数
+	TimesAnswered int     `json:"times_answered"` // 誰かが回答権を取った回数
+	TimesCorrect  int     `json:"times_correct"`
+	CorrectRate   float64 `json:"correct_rate"`  // 回答された中での正解率
+	AvgAnswerMs   float64 `json:"avg_answer_ms"` // 回答権を取るまでの平均時間
+}
+
+// User 保存されているアカウント
+type User struct {
+	Username        string
+	PasswordHash    string // bcryptのハッシュ。OAuthのみのアカウントは空
+	Role            string
+	Email           string     // 登録されていなければ空
+	EmailVerifiedAt *time.Time // メールアドレスを確認していなければnil
+	CreatedAt       time.Time
+}
+
+// NewUser 作成するアカウント
+type NewUser struct {
+	Username     string
+	PasswordHash string
+	MergeGuestID string // 対戦記録を引き継ぐゲストのID
+}
+
+// OAuthLink 外部サービスのユーザーとアカウントの連携
+type OAuthLink struct {
+	Provider       string
+	ProviderUserID string
+	Username       string
+	CreateUser     bool // Usernameのアカウントを、パスワードでログインできないアカウントとして作成する
+}
+
+// Profile ユーザーのプロフィール
+type Profile struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Bio         string `json:"bio"`
+	Country     string `json:"country"` // ISO 3166-1 alpha-2
+	Locale      string `json:"locale"`  // 例: ja, en-US
+}
+
+// メールで送るトークンの用途
+const (
+	EmailTokenVerify = "verify"
+	EmailTokenReset  = "reset"
+)
+
+// EmailToken メールで送る一度だけ使えるトークン。トークンそのものは保存せずハッシュを保存する
+type EmailToken struct {
+	Hash      string
+	Username  string
+	Purpose   string
+	ExpiresAt time.Time
+}
+
+// PlayerRating プレイヤーのレート
+type PlayerRating struct {
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+}
+
+// PlayerGameRating プレイヤーのゲームの種類ごとのレートと連勝数
+// Tierはランク帯を保存していなければ空
+type PlayerGameRating struct {
+	GameType      string
+	Rating        int
+	Tier          string
+	CurrentStreak int
+	BestStreak    int
+}
+
+// PlayerGameStats プレイヤーのゲームの種類ごとの成績の合計
+type PlayerGameStats struct {
+	GameType       string
+	GamesPlayed    int
+	Wins           int
+	Losses         int
+	Draws          int
+	TotalScore     int64
+	Buzzes         int
+	CorrectAnswers int
+	TotalBuzzMs    int64
+}
+
+// SmurfFlag サブアカウントの疑いがあるプレイヤーの記録
+type SmurfFlag struct {
+	Username        string    `json:"username"`
+	GameType        string    `json:"game_type"`
+	Games           int       `json:"games"`
+	WinRate         float64   `json:"win_rate"`
+	AvgAnswerMs     float64   `json:"avg_answer_ms"`
+	BracketAnswerMs float64   `json:"bracket_answer_ms"` // 同じランク帯の平均回答時間
+	FlaggedAt       time.Time `json:"flagged_at"`
+}
+
+// FastAnswerer 人間には難しい速さで正解を繰り返しているプレイヤー
+type FastAnswerer struct {
+	Username     string  `json:"username"`
+	FastCorrect  int     `json:"fast_correct"` // below_ms未満で回答権を取って正解した回数
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MinLatencyMs int     `json:"min_latency_ms"`
+}
+
+// 対戦履歴の結果の絞り込み
+const (
+	ResultWin  = "win"
+	ResultLoss = "loss"
+	ResultDraw = "draw"
+)
+
+// MatchFilter 対戦履歴の絞り込み条件。ゼロ値の項目は絞り込まない
+type MatchFilter struct {
+	Username string
+	GameType string
+	From     time.Time // この日時以降に終わった対戦
+	To       time.Time // この日時より前に終わった対戦
+	Result   string    // ResultWin, ResultLoss, ResultDraw
+	Limit    int
+	Offset   int
+}
+
+// MatchSummary 対戦履歴の1件
+// Result, Opponent, RatingChangeはプレイヤーの対戦履歴を取得したときだけ設定する
+type MatchSummary struct {
+	ID           int64      `json:"id"`
+	GameType     string     `json:"game_type"`
+	Mode         string     `json:"mode"` // ranked または casual
+	Player1ID    string     `json:"player1_id"`
+	Player2ID    string     `json:"player2_id"`
+	Player1Score int        `json:"player1_score"`
+	Player2Score int        `json:"player2_score"`
+	WinnerID     string     `json:"winner_id,omitempty"` // 引き分けは空
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	EndedAt      time.Time  `json:"ended_at"`
+	DurationMs   int64      `json:"duration_ms,omitempty"`
+
+	Result       string `json:"result,omitempty"`
+	Opponent     string `json:"opponent,omitempty"`
+	RatingChange *int   `json:"rating_change,omitempty"`
+}
+
+// setPerspective プレイヤーから見た結果と対戦相手を設定する
+func (m *MatchSummary) setPerspective(username string) {
+	m.Opponent = m.Player2ID
+	if username == m.Player2ID {
+		m.Opponent = m.Player1ID
+	}
+	switch m.WinnerID {
+	case "":
+		m.Result = ResultDraw
+	case username:
+		m.Result = ResultWin
+	default:
+		m.Result = ResultLoss
+	}
+}
+
+// MatchPlayerResult 対戦でのプレイヤーごとのレート変動
+type MatchPlayerResult struct {
+	Username  string `json:"username"`
+	OldRating int    `json:"old_rating"`
+	NewRating int    `json:"new_rating"`
+	Delta     int    `json:"delta"`
+	AnswerMs  int    `json:"answer_ms,omitempty"`
+}
+
+// MatchAnswer 対戦の1問ごとの回答。誰も回答権を取らなかった問題はPlayerIDが空
+type MatchAnswer struct {
+	QuestionNo int `json:"question_no"` // 出題順(1から)
+	QuestionID int `json:"question_id"`
+	// QuestionVersion 出題した問題の版。QuestionTextとCorrectAnswerはこの版の内容
+	// 版を記録する前の対戦では0で、現在の内容を返す
+	QuestionVersion int         `json:"question_version,omitempty"`
+	QuestionText    string      `json:"question_text"`
+	CorrectAnswer   string      `json:"correct_answer"`
+	PlayerID        string      `json:"player_id,omitempty"`
+	Answer          string      `json:"answer,omitempty"`
+	Correct         bool        `json:"correct"`
+	LatencyMs       int         `json:"latency_ms,omitempty"` // 出題から回答権を得るまでの時間
+	Buzzes          []MatchBuzz `json:"buzzes"`
+}
+
+// MatchBuzz 回答権の要求1回分
+type MatchBuzz struct {
+	PlayerID  string `json:"player_id"`
+	LatencyMs int    `json:"latency_ms"` // 出題から要求までの時間
+	Granted   bool   `json:"granted"`
+}
+
+// MatchDetail 対戦の詳細。カジュアル戦はレートが変動しないのでPlayersは空
+type MatchDetail struct {
+	MatchSummary
+	Players []MatchPlayerResult `json:"players"`
+}
+
+// FriendRequest フレンド申請。Usernameが申請した側、FriendUsernameが申請された側
+type FriendRequest struct {
+	ID             int    `json:"id"`
+	Username       string `json:"username"`
+	FriendUsername string `json:"friend_username"`
+	Status         string `json:"status"`
+}
+
+// フレンド申請の状態
+const (
+	FriendRequestPending  = "pending"
+	FriendRequestAccepted = "accepted"
+	FriendRequestRejected = "rejected"
+)
+
+// Season レーティングのシーズン
+type Season struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	StartsAt  time.Time       `json:"starts_at"`
+	EndsAt    time.Time       `json:"ends_at"`
+	Finalized bool            `json:"finalized"`         // シーズン終了の処理(ソフトリセット)が済んでいるか
+	Rewards   json.RawMessage `json:"rewards,omitempty"` // シーズン終了時の報酬の定義(例: {"top10": "金の王冠"})
+	// 開催中、部屋の設定で指定がなければ出題に使う問題のプール
+	QuestionPoolID *int `json:"question_pool_id,omitempty"`
+}
+
+// Status シーズンの状態を返す("upcoming", "active", "finished")
+func (s Season) Status(now time.Time) string {
+	switch {
+	case s.Finalized || !now.Before(s.EndsAt):
+		return "finished"
+	case now.Before(s.StartsAt):
+		return "upcoming"
+	default:
+		return "active"
+	}
+}
+
+// SeasonRating シーズン終了時点のプレイヤーの成績
+type SeasonRating struct {
+	SeasonID  int    `json:"season_id"`
+	GameType  string `json:"game_type"`
+	Username  string `json:"username"`
+	Rating    int    `json:"rating"`
+	FinalRank int    `json:"final_rank"`
+}
+
+// PlayerMatch プレイヤーが参加した対戦と、その対戦での問題ごとの回答
+type PlayerMatch struct {
+	ID           int64          `json:"id"`
+	GameType     string         `json:"game_type"`
+	Rated        bool           `json:"rated"`
+	Player1ID    string         `json:"player1_id"`
+	Player2ID    string         `json:"player2_id"`
+	Player1Score int            `json:"player1_score"`
+	Player2Score int            `json:"player2_score"`
+	WinnerID     string         `json:"winner_id,omitempty"`
+	StartedAt    *time.Time     `json:"started_at,omitempty"`
+	PlayedAt     time.Time      `json:"played_at"`
+	Answers      []PlayerAnswer `json:"answers"`
+}
+
+// PlayerAnswer 対戦中の1問ごとの回答
+type PlayerAnswer struct {
+	QuestionNo int    `json:"question_no"`
+	QuestionID int    `json:"question_id"`
+	PlayerID   string `json:"player_id,omitempty"`
+	Answer     string `json:"answer"`
+	Correct    bool   `json:"correct"`
+	LatencyMs  *int   `json:"latency_ms,omitempty"`
+}
+
+// RatingChange 対戦によるレートの変動の記録
+type RatingChange struct {
+	MatchID   int64     `json:"match_id"`
+	GameType  string    `json:"game_type"`
+	OldRating int       `json:"old_rating"`
+	NewRating int       `json:"new_rating"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Session ログインセッション
+type Session struct {
+	ID         string
+	Username   string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastSeenAt *time.Time
+	RevokedAt  *time.Time // 無効にした日時。有効なセッションはnil
+}
+
+// APIKey 発行したAPIキー。キー自体は保存せず、ハッシュだけを持つ
+type APIKey struct {
+	ID         string
+	KeyHash    string
+	Prefix     string // 一覧で見分けるためのキーの先頭部分
+	Username   string
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// AuditEntry 管理者の操作の記録
+type AuditEntry struct {
+	ID      int64           `json:"id"`
+	Actor   string          `json:"actor"`            // 操作したユーザー
+	Action  string          `json:"action"`           // 例: "POST /admin/rooms/{id}/close"
+	Target  string          `json:"target,omitempty"` // 操作の対象(URLの{id})
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Diff 操作による変更({"before": ..., "after": ...})。ハンドラーが記録した場合のみ
+	Diff      json.RawMessage `json:"diff,omitempty"`
+	Status    int             `json:"status"` // レスポンスのステータスコード
+	IP        string          `json:"ip"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter 操作の記録の絞り込み条件。空の項目では絞り込まない
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	From   time.Time // この日時以降の操作
+	To     time.Time // この日時より前の操作
+	Limit  int
+	Offset int
+}
+
+// OutboxEvent 分析基盤に送る前に保存した対戦のイベント
+type OutboxEvent struct {
+	ID        int64  // 保存した順の連番
+	EventID   string // 受信側で重複を取り除くためのイベントのID
+	Type      string
+	RoomID    string
+	Payload   string // 送信するイベントのJSON
+	CreatedAt time.Time
+}
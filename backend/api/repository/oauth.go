@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlOAuthRepository struct {
+	db conn
+}
+
+// NewSQLOAuthRepository データベースに外部サービスとの連携を保存するOAuthRepositoryを作成する
+func NewSQLOAuthRepository(db *sql.DB) OAuthRepository {
+	return newSQLOAuthRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLOAuthRepository(db *sql.DB, dialect Dialect) OAuthRepository {
+	return &sqlOAuthRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlOAuthRepository) LinkedUser(ctx context.Context, provider, providerUserID string) (string, error) {
+	var username string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT username FROM oauth_accounts WHERE provider = ? AND provider_user_id = ?",
+		provider, providerUserID,
+	).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return username, err
+}
+
+func (r *sqlOAuthRepository) LinkAccount(ctx context.Context, link OAuthLink) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if link.CreateUser {
+		// パスワードでログインできないよう、パスワードは空のままにする
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (username, password) VALUES (?, '')", link.Username)
+		if IsUniqueViolation(err) {
+			return ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO oauth_accounts (provider, provider_user_id, username) VALUES (?, ?, ?)",
+		link.Provider, link.ProviderUserID, link.Username,
+	)
+	if IsUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
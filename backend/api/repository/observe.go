@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"sys3/api/logging"
+	"sys3/api/metrics"
+	"sys3/api/tracing"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// DefaultSlowQueryThreshold これより時間のかかったクエリを警告としてログに記録する時間のデフォルト
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+var slowQueryThreshold = DefaultSlowQueryThreshold
+
+// SetSlowQueryThreshold 遅いクエリとしてログに記録する時間を設定する。0なら記録しない
+// サーバー起動前に呼び出すこと
+func SetSlowQueryThreshold(threshold time.Duration) {
+	if threshold >= 0 {
+		slowQueryThreshold = threshold
+	}
+}
+
+// observeQuery クエリのスパンを始め、実行し終えたときに呼ぶ関数を返す
+// 終えた関数は実行時間をメトリクスに記録し、エラーがあればスパンに残す
+// slowQueryThresholdより時間がかかった場合は、対戦のトレースIDと一緒にログに記録する
+// 引数の値は個人情報を含むことがあるので、スパンにはクエリの文だけを記録する
+func observeQuery(ctx context.Context, dialect Dialect, query string) (context.Context, func(error)) {
+	operation := queryOperation(query)
+	ctx, span := tracing.Start(ctx, "db."+operation,
+		semconv.DBSystemKey.String(dialect.Name()),
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(query),
+	)
+	start := time.Now()
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+		metrics.ObserveQuery(operation, elapsed)
+		if slowQueryThreshold > 0 && elapsed >= slowQueryThreshold {
+			logSlowQuery(ctx, dialect, operation, query, elapsed, err)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}
+}
+
+// logSlowQuery 時間のかかったクエリを警告として記録する
+// 対戦中のクエリであれば、トレースIDから対戦のログとスパンを探せる
+func logSlowQuery(ctx context.Context, dialect Dialect, operation, query string, elapsed time.Duration, err error) {
+	args := []any{
+		"db_system", dialect.Name(),
+		"operation", operation,
+		"statement", strings.Join(strings.Fields(query), " "),
+		"duration_ms", elapsed.Milliseconds(),
+		"threshold_ms", slowQueryThreshold.Milliseconds(),
+	}
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		args = append(args, logging.KeyTraceID, traceID)
+	}
+	if err != nil {
+		args = append(args, logging.Err(err))
+	}
+	slog.Warn("遅いクエリ", args...)
+}
+
+// queryOperation メトリクスのラベルやスパンの名前の種類が増えすぎないように、SQLの最初のキーワードだけを小文字で返す
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch s := strings.ToLower(fields[0]); s {
+	case "select", "insert", "update", "delete", "with", "replace":
+		return s
+	}
+	return "other"
+}
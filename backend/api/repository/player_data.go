@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlPlayerDataRepository struct {
+	db conn
+}
+
+// NewSQLPlayerDataRepository データベースからプレイヤーのデータを読み取るPlayerDataRepositoryを作成する
+func NewSQLPlayerDataRepository(db *sql.DB) PlayerDataRepository {
+	return newSQLPlayerDataRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLPlayerDataRepository(db *sql.DB, dialect Dialect) PlayerDataRepository {
+	return &sqlPlayerDataRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlPlayerDataRepository) CountMatches(ctx context.Context, username string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM matches WHERE player1_id = ? OR player2_id = ?",
+		username, username,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *sqlPlayerDataRepository) Matches(ctx context.Context, username string) ([]PlayerMatch, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, game_type, rated, player1_id, player2_id, player1_score, player2_score, winner_id, started_at, created_at
+		FROM matches
+		WHERE player1_id = ? OR player2_id = ?
+		ORDER BY created_at, id`,
+		username, username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []PlayerMatch{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var m PlayerMatch
+		var winnerID sql.NullString
+		var startedAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.GameType, &m.Rated, &m.Player1ID, &m.Player2ID,
+			&m.Player1Score, &m.Player2Score, &winnerID, &startedAt, &m.PlayedAt); err != nil {
+			return nil, err
+		}
+		m.WinnerID = winnerID.String
+		if startedAt.Valid {
+			m.StartedAt = &startedAt.Time
+		}
+		m.Answers = []PlayerAnswer{}
+		index[m.ID] = len(matches)
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 回答は対戦ごとに問い合わせず、まとめて取得して振り分ける
+	answerRows, err := r.db.QueryContext(ctx, `
+		SELECT match_id, question_no, question_id, player_id, answer, correct, latency_ms
+		FROM match_answers
+		WHERE player_id = ?
+		ORDER BY match_id, question_no`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer answerRows.Close()
+
+	for answerRows.Next() {
+		var matchID int64
+		var a PlayerAnswer
+		var playerID sql.NullString
+		var latency sql.NullInt64
+		if err := answerRows.Scan(&matchID, &a.QuestionNo, &a.QuestionID, &playerID, &a.Answer, &a.Correct, &latency); err != nil {
+			return nil, err
+		}
+		a.PlayerID = playerID.String
+		if latency.Valid {
+			ms := int(latency.Int64)
+			a.LatencyMs = &ms
+		}
+		if i, ok := index[matchID]; ok {
+			matches[i].Answers = append(matches[i].Answers, a)
+		}
+	}
+	return matches, answerRows.Err()
+}
+
+func (r *sqlPlayerDataRepository) RatingHistory(ctx context.Context, username string) ([]RatingChange, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT match_id, game_type, old_rating, new_rating, created_at
+		FROM rating_history
+		WHERE username = ?
+		ORDER BY created_at, id`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []RatingChange{}
+	for rows.Next() {
+		var h RatingChange
+		if err := rows.Scan(&h.MatchID, &h.GameType, &h.OldRating, &h.NewRating, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
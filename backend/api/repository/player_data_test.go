@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPlayerMatchesOnlyOwnAnswers(t *testing.T) {
+	db := openSQLite(t)
+	data := newSQLPlayerDataRepository(db, DialectFor(DriverSQLite))
+	statements := []string{
+		"INSERT INTO matches (id, player1_id, player2_id, player1_score, player2_score, winner_id) VALUES (1, 'alice', 'bob', 1, 1, NULL)",
+		"INSERT INTO match_answers (match_id, question_no, question_id, player_id, answer, correct) VALUES (1, 1, 10, 'alice', 'a', TRUE), (1, 2, 11, 'bob', 'b', TRUE)",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if count, err := data.CountMatches(ctx, "alice"); err != nil || count != 1 {
+		t.Errorf("CountMatches = %d, %v, want 1", count, err)
+	}
+	matches, err := data.Matches(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("matches = %d, want 1", len(matches))
+	}
+	answers := matches[0].Answers
+	if len(answers) != 1 || answers[0].PlayerID != "alice" {
+		t.Errorf("answers = %+v, want only alice's answer", answers)
+	}
+}
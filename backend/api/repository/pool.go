@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolConfig データベースの接続プールの設定
+// 0の項目はデフォルト値を使う
+type PoolConfig struct {
+	MaxOpenConns    int           // 同時に開ける接続の最大数
+	MaxIdleConns    int           // 使い終わった後も開いたままにしておく接続の最大数
+	ConnMaxLifetime time.Duration // 1つの接続を使い回せる最大時間
+}
+
+// DefaultPoolConfig 接続プールのデフォルト設定
+// database/sqlのデフォルトは接続数が無制限で待機接続が2つしかないため、
+// 対戦が重なると接続の作り直しが増えてデータベースの接続上限に達してしまう
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    25,
+	MaxIdleConns:    25,
+	ConnMaxLifetime: 5 * time.Minute,
+}
+
+// ConfigurePool 接続プールを設定する
+// データベースを開いた直後、サーバー起動前に呼び出すこと
+func ConfigurePool(db *sql.DB, config PoolConfig) {
+	if config.MaxOpenConns <= 0 {
+		config.MaxOpenConns = DefaultPoolConfig.MaxOpenConns
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = DefaultPoolConfig.MaxIdleConns
+	}
+	// 待機接続が最大接続数を超えても意味がない
+	if config.MaxIdleConns > config.MaxOpenConns {
+		config.MaxIdleConns = config.MaxOpenConns
+	}
+	if config.ConnMaxLifetime <= 0 {
+		config.ConnMaxLifetime = DefaultPoolConfig.ConnMaxLifetime
+	}
+
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlProfileRepository struct {
+	db conn
+}
+
+// NewSQLProfileRepository データベースにプロフィールを保存するProfileRepositoryを作成する
+func NewSQLProfileRepository(db *sql.DB) ProfileRepository {
+	return newSQLProfileRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLProfileRepository(db *sql.DB, dialect Dialect) ProfileRepository {
+	return &sqlProfileRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlProfileRepository) Profile(ctx context.Context, username string) (Profile, error) {
+	profile := Profile{Username: username}
+	var displayName, avatarURL, bio, country, locale sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		"SELECT display_name, avatar_url, bio, country, locale FROM user_profiles WHERE username = ?",
+		username,
+	).Scan(&displayName, &avatarURL, &bio, &country, &locale)
+	if err != nil && err != sql.ErrNoRows {
+		return Profile{}, err
+	}
+	profile.DisplayName = displayName.String
+	profile.AvatarURL = avatarURL.String
+	profile.Bio = bio.String
+	profile.Country = country.String
+	profile.Locale = locale.String
+	return profile, nil
+}
+
+func (r *sqlProfileRepository) SaveProfile(ctx context.Context, p Profile) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_profiles (username, display_name, avatar_url, bio, country, locale)
+		VALUES (?, ?, ?, ?, ?, ?)`+r.db.dialect.Upsert([]string{"username"}, `display_name = VALUES(display_name), avatar_url = VALUES(avatar_url),
+			bio = VALUES(bio), country = VALUES(country), locale = VALUES(locale)`),
+		p.Username, p.DisplayName, p.AvatarURL, p.Bio, p.Country, p.Locale,
+	)
+	return err
+}
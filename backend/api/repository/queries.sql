@@ -0,0 +1,409 @@
+-- 型付きのクエリの定義。変更したら go generate ./api/repository で queries_gen.go を作り直す
+-- 書き方は querygen/main.go を参照
+
+-- name: QuestionRow :columns
+-- 問題を読み込むSELECT
+SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at
+FROM questions;
+
+-- name: CreateQuestion :insertid
+-- 問題を追加してIDを返す
+INSERT INTO questions (creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, source, difficulty, activate_at, retire_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetQuestion :one QuestionRow
+-- 削除されていない1問を返す
+SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at
+FROM questions
+WHERE id = ? AND deleted_at IS NULL;
+
+-- name: UpdateQuestion :execrows
+-- 削除されていない問題の内容と版を書き換える。作成者は変更しない
+-- 現在の版が一致する場合だけ変更するので、同時に編集しても版が重複しない
+UPDATE questions
+SET question_text = ?, correct_answer = ?, choice1 = ?, choice2 = ?, choice3 = ?, choice4 = ?, explanation = ?, version = ?
+WHERE id = ? AND version = ? AND deleted_at IS NULL;
+
+-- name: CreateQuestionVersion :exec
+-- 問題の版を追加する
+INSERT INTO question_versions (question_id, version, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, editor, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListQuestionVersions :many
+-- 問題の版を古い順に返す
+SELECT version, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, editor, created_at
+FROM question_versions
+WHERE question_id = ?
+ORDER BY version;
+
+-- name: UpdateQuestionDifficulty :execrows
+-- 回答の集計から計算した難易度を保存する
+UPDATE questions SET difficulty = ?, difficulty_score = ? WHERE id = ?;
+
+-- name: UpdateQuestionSchedule :execrows
+-- 削除されていない問題の出題を始める日時と終える日時を変更する
+UPDATE questions SET activate_at = ?, retire_at = ? WHERE id = ? AND deleted_at IS NULL;
+
+-- name: ListQuestionsByStatus :many QuestionRow
+-- 削除されていない問題のうち指定した状態のものを返す
+SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at
+FROM questions
+WHERE deleted_at IS NULL AND status = ?
+ORDER BY id;
+
+-- name: ListQuestionsByCreator :many QuestionRow
+-- ユーザーが投稿した問題を新しい順に返す。削除済みの問題は返さない
+SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at
+FROM questions
+WHERE creator_username = ? AND source = ? AND deleted_at IS NULL
+ORDER BY id DESC;
+
+-- name: CountSubmissionsSince :one
+-- ユーザーがsince以降に投稿した問題の数を返す。削除された投稿も数える
+SELECT COUNT(*) FROM questions WHERE creator_username = ? AND source = ? AND created_at >= ?;
+
+-- name: TopContributors :many
+-- 承認された投稿の多い順にlimit人を返す
+SELECT creator_username, COUNT(*) AS approved_count
+FROM questions
+WHERE source = ? AND status = ? AND deleted_at IS NULL
+GROUP BY creator_username
+ORDER BY approved_count DESC, creator_username
+LIMIT ?;
+
+-- name: SetQuestionStatus :execrows
+-- 削除されていない問題の状態を、現在の状態が一致する場合だけ変更する
+UPDATE questions SET status = ? WHERE id = ? AND status = ? AND deleted_at IS NULL;
+
+-- name: CreateQuestionReview :exec
+-- 審査の記録を追加する
+INSERT INTO question_reviews (question_id, reviewer, from_status, status, comment, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ListQuestionReviews :many
+-- 問題の審査の記録を古い順に返す
+SELECT id, question_id, reviewer, from_status, status, comment, created_at
+FROM question_reviews
+WHERE question_id = ?
+ORDER BY id;
+
+-- name: DeleteQuestion :execrows
+-- 問題を削除済みにする。削除済みの問題は変更しない
+UPDATE questions SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL;
+
+-- name: RestoreQuestion :execrows
+-- 削除済みの問題を元に戻す
+UPDATE questions SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL;
+
+-- name: ListQuestionStats :many QuestionStatsRow
+-- 削除されていない問題の回答の集計を返す
+SELECT q.id, q.question_text, COALESCE(s.times_shown, 0) AS times_shown, COALESCE(s.times_answered, 0) AS times_answered,
+    COALESCE(s.times_correct, 0) AS times_correct, COALESCE(s.total_answer_ms, 0) AS total_answer_ms
+FROM questions q
+LEFT JOIN question_stats s ON s.question_id = q.id
+WHERE q.deleted_at IS NULL
+ORDER BY q.id;
+
+-- name: GetQuestionStats :one QuestionStatsRow
+-- 1問の回答の集計を返す。削除済みの問題も返す
+SELECT q.id, q.question_text, COALESCE(s.times_shown, 0) AS times_shown, COALESCE(s.times_answered, 0) AS times_answered,
+    COALESCE(s.times_correct, 0) AS times_correct, COALESCE(s.total_answer_ms, 0) AS total_answer_ms
+FROM questions q
+LEFT JOIN question_stats s ON s.question_id = q.id
+WHERE q.id = ?;
+
+-- name: MatchRow :columns
+-- 対戦履歴を読み込むSELECT
+SELECT m.id, m.game_type, m.rated, m.player1_id, m.player2_id, m.player1_score, m.player2_score, m.winner_id, m.started_at, m.created_at
+FROM matches m;
+
+-- name: GetMatch :one MatchRow
+-- 1件の対戦を返す
+SELECT m.id, m.game_type, m.rated, m.player1_id, m.player2_id, m.player1_score, m.player2_score, m.winner_id, m.started_at, m.created_at
+FROM matches m
+WHERE m.id = ?;
+
+-- name: ListMatchPlayers :many
+-- 対戦でのプレイヤーごとのレート変動を返す
+SELECT username, old_rating, new_rating, answer_ms FROM rating_history WHERE match_id = ?;
+
+-- name: GetRating :one
+-- プレイヤーのレートを返す
+SELECT rating FROM player_ratings WHERE username = ? AND game_type = ?;
+
+-- name: TopRatings :many
+-- レートの高い順にlimit人を返す
+SELECT username, rating
+FROM player_ratings
+WHERE game_type = ?
+ORDER BY rating DESC
+LIMIT ?;
+
+-- name: ListMatchAnswers :many
+-- 対戦の問題ごとの回答を出題順に返す。問題は削除済みでも返す
+-- 問題の内容は出題した時点の版を返す。版を記録していない古い対戦は現在の内容を返す
+SELECT a.question_no, a.question_id, a.question_version,
+    COALESCE(v.question_text, q.question_text, '') AS question_text,
+    COALESCE(v.correct_answer, q.correct_answer, '') AS correct_answer,
+    a.player_id, a.answer, a.correct, a.latency_ms
+FROM match_answers a
+LEFT JOIN questions q ON q.id = a.question_id
+LEFT JOIN question_versions v ON v.question_id = a.question_id AND v.version = a.question_version
+WHERE a.match_id = ?
+ORDER BY a.question_no;
+
+-- name: ListMatchBuzzes :many
+-- 対戦の回答権の要求を要求した順に返す
+SELECT question_no, player_id, latency_ms, granted
+FROM match_buzzes
+WHERE match_id = ?
+ORDER BY question_no, id;
+
+-- name: CategoryRow :columns
+-- カテゴリーを読み込むSELECT
+SELECT id, name, description FROM categories;
+
+-- name: ListCategories :many CategoryRow
+-- カテゴリーを名前の順に返す
+SELECT id, name, description FROM categories ORDER BY name;
+
+-- name: GetCategory :one CategoryRow
+-- 1件のカテゴリーを返す
+SELECT id, name, description FROM categories WHERE id = ?;
+
+-- name: CountCategoryQuestions :many
+-- カテゴリーごとの削除されていない問題の数を返す
+SELECT qc.category_id, COUNT(*) AS question_count
+FROM question_categories qc
+JOIN questions q ON q.id = qc.question_id
+WHERE q.deleted_at IS NULL
+GROUP BY qc.category_id;
+
+-- name: CategoryNameTaken :one
+-- id以外のカテゴリーが同じ名前を使っている数を返す
+SELECT COUNT(*) FROM categories WHERE name = ? AND id <> ?;
+
+-- name: CreateCategory :insertid
+-- カテゴリーを追加してIDを返す
+INSERT INTO categories (name, description) VALUES (?, ?);
+
+-- name: UpdateCategory :execrows
+-- カテゴリーの名前と説明を変更する
+UPDATE categories SET name = ?, description = ? WHERE id = ?;
+
+-- name: DeleteCategory :execrows
+-- カテゴリーを削除する。先にDeleteCategoryLinksで問題との紐付けを削除すること
+DELETE FROM categories WHERE id = ?;
+
+-- name: DeleteCategoryLinks :exec
+-- カテゴリーと問題の紐付けを全て削除する
+DELETE FROM question_categories WHERE category_id = ?;
+
+-- name: ListTags :many
+-- タグを名前の順に返す
+SELECT id, name FROM tags ORDER BY name;
+
+-- name: CountTagQuestions :many
+-- タグごとの削除されていない問題の数を返す
+SELECT qt.tag_id, COUNT(*) AS question_count
+FROM question_tags qt
+JOIN questions q ON q.id = qt.question_id
+WHERE q.deleted_at IS NULL
+GROUP BY qt.tag_id;
+
+-- name: TagNameTaken :one
+-- 同じ名前のタグの数を返す
+SELECT COUNT(*) FROM tags WHERE name = ?;
+
+-- name: CreateTag :insertid
+-- タグを追加してIDを返す
+INSERT INTO tags (name) VALUES (?);
+
+-- name: DeleteTag :execrows
+-- タグを削除する。先にDeleteTagLinksで問題との紐付けを削除すること
+DELETE FROM tags WHERE id = ?;
+
+-- name: DeleteTagLinks :exec
+-- タグと問題の紐付けを全て削除する
+DELETE FROM question_tags WHERE tag_id = ?;
+
+-- name: QuestionLabelRow :columns
+-- 問題に付いたカテゴリー・タグの名前を読み込むSELECT
+SELECT qc.question_id, c.name FROM question_categories qc JOIN categories c ON c.id = qc.category_id;
+
+-- name: ListQuestionCategoryNames :many QuestionLabelRow
+-- 全ての問題のカテゴリーの名前を返す
+SELECT qc.question_id, c.name FROM question_categories qc JOIN categories c ON c.id = qc.category_id ORDER BY c.name;
+
+-- name: GetQuestionCategoryNames :many QuestionLabelRow
+-- 1問のカテゴリーの名前を返す
+SELECT qc.question_id, c.name FROM question_categories qc JOIN categories c ON c.id = qc.category_id
+WHERE qc.question_id = ?
+ORDER BY c.name;
+
+-- name: ListQuestionTagNames :many QuestionLabelRow
+-- 全ての問題のタグの名前を返す
+SELECT qt.question_id, t.name FROM question_tags qt JOIN tags t ON t.id = qt.tag_id ORDER BY t.name;
+
+-- name: GetQuestionTagNames :many QuestionLabelRow
+-- 1問のタグの名前を返す
+SELECT qt.question_id, t.name FROM question_tags qt JOIN tags t ON t.id = qt.tag_id
+WHERE qt.question_id = ?
+ORDER BY t.name;
+
+-- name: ClearQuestionCategories :exec
+-- 問題のカテゴリーの紐付けを全て削除する
+DELETE FROM question_categories WHERE question_id = ?;
+
+-- name: AddQuestionCategory :exec
+-- 問題にカテゴリーを紐付ける
+INSERT INTO question_categories (question_id, category_id) VALUES (?, ?);
+
+-- name: ClearQuestionTags :exec
+-- 問題のタグの紐付けを全て削除する
+DELETE FROM question_tags WHERE question_id = ?;
+
+-- name: AddQuestionTag :exec
+-- 問題にタグを紐付ける
+INSERT INTO question_tags (question_id, tag_id) VALUES (?, ?);
+
+-- name: QuestionPoolRow :columns
+-- 問題のプールを読み込むSELECT
+SELECT id, name, description FROM question_pools;
+
+-- name: ListQuestionPools :many QuestionPoolRow
+-- プールを名前の順に返す
+SELECT id, name, description FROM question_pools ORDER BY name;
+
+-- name: GetQuestionPool :one QuestionPoolRow
+-- 1件のプールを返す
+SELECT id, name, description FROM question_pools WHERE id = ?;
+
+-- name: CountPoolQuestions :many
+-- プールごとの出題できる(削除されておらず承認済みの)問題の数を返す
+SELECT m.pool_id, COUNT(*) AS question_count
+FROM question_pool_members m
+JOIN questions q ON q.id = m.question_id
+WHERE q.deleted_at IS NULL AND q.status = ?
+GROUP BY m.pool_id;
+
+-- name: QuestionPoolNameTaken :one
+-- id以外のプールが同じ名前を使っている数を返す
+SELECT COUNT(*) FROM question_pools WHERE name = ? AND id <> ?;
+
+-- name: CreateQuestionPool :insertid
+-- プールを追加してIDを返す
+INSERT INTO question_pools (name, description) VALUES (?, ?);
+
+-- name: UpdateQuestionPool :execrows
+-- プールの名前と説明を変更する
+UPDATE question_pools SET name = ?, description = ? WHERE id = ?;
+
+-- name: DeleteQuestionPool :execrows
+-- プールを削除する。先にDeleteQuestionPoolMembersとClearSeasonQuestionPoolで参照を外すこと
+DELETE FROM question_pools WHERE id = ?;
+
+-- name: DeleteQuestionPoolMembers :exec
+-- プールに入っている問題を全て外す
+DELETE FROM question_pool_members WHERE pool_id = ?;
+
+-- name: ClearSeasonQuestionPool :exec
+-- プールを使っているシーズンの設定を外す
+UPDATE seasons SET question_pool_id = NULL WHERE question_pool_id = ?;
+
+-- name: QuestionPoolMemberRow :columns
+-- 問題が入っているプールを読み込むSELECT
+SELECT question_id, pool_id FROM question_pool_members;
+
+-- name: ListQuestionPoolMembers :many QuestionPoolMemberRow
+-- 全ての問題が入っているプールを返す
+SELECT question_id, pool_id FROM question_pool_members ORDER BY pool_id;
+
+-- name: GetQuestionPoolMembers :many QuestionPoolMemberRow
+-- 1問が入っているプールを返す
+SELECT question_id, pool_id FROM question_pool_members WHERE question_id = ? ORDER BY pool_id;
+
+-- name: QuestionPoolMemberExists :one
+-- 問題がプールに入っているか(0か1)を返す
+SELECT COUNT(*) FROM question_pool_members WHERE pool_id = ? AND question_id = ?;
+
+-- name: AddQuestionPoolMember :exec
+-- 問題をプールに入れる
+INSERT INTO question_pool_members (pool_id, question_id) VALUES (?, ?);
+
+-- name: RemoveQuestionPoolMember :execrows
+-- 問題をプールから外す
+DELETE FROM question_pool_members WHERE pool_id = ? AND question_id = ?;
+
+-- name: QuestionReportRow :columns
+-- 問題の報告を読み込むSELECT
+SELECT id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at
+FROM question_reports;
+
+-- name: OpenQuestionReportExists :one
+-- プレイヤーがその問題に未対応の報告をしているか(0か1)を返す
+SELECT COUNT(*) FROM question_reports WHERE question_id = ? AND reporter = ? AND status = ?;
+
+-- name: CreateQuestionReport :insertid
+-- 問題の報告を追加してIDを返す
+INSERT INTO question_reports (question_id, question_version, reporter, reason, comment, room_id, game_type, status, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: CountQuestionReportsByStatus :one
+-- 問題の指定した状態の報告の数を返す
+SELECT COUNT(*) FROM question_reports WHERE question_id = ? AND status = ?;
+
+-- name: ListQuestionReportsByStatus :many QuestionReportRow
+-- 指定した状態の報告を古い順に返す
+SELECT id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at
+FROM question_reports
+WHERE status = ?
+ORDER BY created_at, id;
+
+-- name: ListQuestionReportsByQuestion :many QuestionReportRow
+-- 1問の報告を古い順に返す
+SELECT id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at
+FROM question_reports
+WHERE question_id = ?
+ORDER BY created_at, id;
+
+-- name: CloseQuestionReports :execrows
+-- 問題の未対応の報告を対応済みか却下にする
+UPDATE question_reports SET status = ?, resolved_by = ?, resolved_at = ? WHERE question_id = ? AND status = ?;
+
+-- name: QuestionTranslationRow :columns
+-- 問題の翻訳を読み込むSELECT
+SELECT question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at
+FROM question_translations;
+
+-- name: ListQuestionTranslations :many QuestionTranslationRow
+-- 1問の翻訳を言語の順に返す
+SELECT question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at
+FROM question_translations
+WHERE question_id = ?
+ORDER BY locale;
+
+-- name: GetQuestionTranslation :one QuestionTranslationRow
+-- 1問の1つの言語の翻訳を返す
+SELECT question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at
+FROM question_translations
+WHERE question_id = ? AND locale = ?;
+
+-- name: CreateQuestionTranslation :exec
+-- 問題の翻訳を追加する
+INSERT INTO question_translations (question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: UpdateQuestionTranslation :execrows
+-- 問題の翻訳を書き換える
+UPDATE question_translations
+SET question_text = ?, correct_answer = ?, choice1 = ?, choice2 = ?, choice3 = ?, choice4 = ?, explanation = ?, source_version = ?, translator = ?, updated_at = ?
+WHERE question_id = ? AND locale = ?;
+
+-- name: DeleteQuestionTranslation :execrows
+-- 問題の翻訳を削除する
+DELETE FROM question_translations WHERE question_id = ? AND locale = ?;
+
+-- name: ListTranslatedVersions :many
+-- 全ての翻訳の問題・言語と、翻訳した元の版を返す
+SELECT question_id, locale, source_version FROM question_translations ORDER BY locale, question_id;
@@ -0,0 +1,1369 @@
+// Code generated by querygen from queries.sql. DO NOT EDIT.
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// rowScanner *sql.Rowと*sql.Rowsの共通のメソッド
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// questionRow クエリで読み込む1行
+type questionRow struct {
+	ID              int
+	CreatorUsername string
+	QuestionText    string
+	CorrectAnswer   string
+	Choice1         string
+	Choice2         string
+	Choice3         string
+	Choice4         string
+	Explanation     string
+	Status          string
+	Version         int
+	Source          string
+	Difficulty      string
+	DifficultyScore sql.NullFloat64
+	ActivateAt      sql.NullTime
+	RetireAt        sql.NullTime
+}
+
+// scanQuestionRow questionRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionRow(scanner rowScanner, extra ...interface{}) (questionRow, error) {
+	var r questionRow
+	dest := append([]interface{}{&r.ID, &r.CreatorUsername, &r.QuestionText, &r.CorrectAnswer, &r.Choice1, &r.Choice2, &r.Choice3, &r.Choice4, &r.Explanation, &r.Status, &r.Version, &r.Source, &r.Difficulty, &r.DifficultyScore, &r.ActivateAt, &r.RetireAt}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listQuestionVersionsRow クエリで読み込む1行
+type listQuestionVersionsRow struct {
+	Version       int
+	QuestionText  string
+	CorrectAnswer string
+	Choice1       string
+	Choice2       string
+	Choice3       string
+	Choice4       string
+	Explanation   string
+	Editor        string
+	CreatedAt     sql.NullTime
+}
+
+// scanListQuestionVersionsRow listQuestionVersionsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListQuestionVersionsRow(scanner rowScanner, extra ...interface{}) (listQuestionVersionsRow, error) {
+	var r listQuestionVersionsRow
+	dest := append([]interface{}{&r.Version, &r.QuestionText, &r.CorrectAnswer, &r.Choice1, &r.Choice2, &r.Choice3, &r.Choice4, &r.Explanation, &r.Editor, &r.CreatedAt}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// topContributorsRow クエリで読み込む1行
+type topContributorsRow struct {
+	CreatorUsername string
+	ApprovedCount   int
+}
+
+// scanTopContributorsRow topContributorsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanTopContributorsRow(scanner rowScanner, extra ...interface{}) (topContributorsRow, error) {
+	var r topContributorsRow
+	dest := append([]interface{}{&r.CreatorUsername, &r.ApprovedCount}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listQuestionReviewsRow クエリで読み込む1行
+type listQuestionReviewsRow struct {
+	ID         int
+	QuestionID int
+	Reviewer   string
+	FromStatus string
+	Status     string
+	Comment    string
+	CreatedAt  sql.NullTime
+}
+
+// scanListQuestionReviewsRow listQuestionReviewsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListQuestionReviewsRow(scanner rowScanner, extra ...interface{}) (listQuestionReviewsRow, error) {
+	var r listQuestionReviewsRow
+	dest := append([]interface{}{&r.ID, &r.QuestionID, &r.Reviewer, &r.FromStatus, &r.Status, &r.Comment, &r.CreatedAt}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionStatsRow クエリで読み込む1行
+type questionStatsRow struct {
+	ID            int
+	QuestionText  string
+	TimesShown    int
+	TimesAnswered int
+	TimesCorrect  int
+	TotalAnswerMs int64
+}
+
+// scanQuestionStatsRow questionStatsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionStatsRow(scanner rowScanner, extra ...interface{}) (questionStatsRow, error) {
+	var r questionStatsRow
+	dest := append([]interface{}{&r.ID, &r.QuestionText, &r.TimesShown, &r.TimesAnswered, &r.TimesCorrect, &r.TotalAnswerMs}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// matchRow クエリで読み込む1行
+type matchRow struct {
+	ID           int64
+	GameType     string
+	Rated        bool
+	Player1ID    string
+	Player2ID    string
+	Player1Score int
+	Player2Score int
+	WinnerID     sql.NullString
+	StartedAt    sql.NullTime
+	CreatedAt    sql.NullTime
+}
+
+// scanMatchRow matchRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanMatchRow(scanner rowScanner, extra ...interface{}) (matchRow, error) {
+	var r matchRow
+	dest := append([]interface{}{&r.ID, &r.GameType, &r.Rated, &r.Player1ID, &r.Player2ID, &r.Player1Score, &r.Player2Score, &r.WinnerID, &r.StartedAt, &r.CreatedAt}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listMatchPlayersRow クエリで読み込む1行
+type listMatchPlayersRow struct {
+	Username  string
+	OldRating int
+	NewRating int
+	AnswerMs  sql.NullInt32
+}
+
+// scanListMatchPlayersRow listMatchPlayersRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListMatchPlayersRow(scanner rowScanner, extra ...interface{}) (listMatchPlayersRow, error) {
+	var r listMatchPlayersRow
+	dest := append([]interface{}{&r.Username, &r.OldRating, &r.NewRating, &r.AnswerMs}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// topRatingsRow クエリで読み込む1行
+type topRatingsRow struct {
+	Username string
+	Rating   int
+}
+
+// scanTopRatingsRow topRatingsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanTopRatingsRow(scanner rowScanner, extra ...interface{}) (topRatingsRow, error) {
+	var r topRatingsRow
+	dest := append([]interface{}{&r.Username, &r.Rating}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listMatchAnswersRow クエリで読み込む1行
+type listMatchAnswersRow struct {
+	QuestionNo      int
+	QuestionID      int
+	QuestionVersion sql.NullInt32
+	QuestionText    string
+	CorrectAnswer   string
+	PlayerID        sql.NullString
+	Answer          string
+	Correct         bool
+	LatencyMs       sql.NullInt32
+}
+
+// scanListMatchAnswersRow listMatchAnswersRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListMatchAnswersRow(scanner rowScanner, extra ...interface{}) (listMatchAnswersRow, error) {
+	var r listMatchAnswersRow
+	dest := append([]interface{}{&r.QuestionNo, &r.QuestionID, &r.QuestionVersion, &r.QuestionText, &r.CorrectAnswer, &r.PlayerID, &r.Answer, &r.Correct, &r.LatencyMs}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listMatchBuzzesRow クエリで読み込む1行
+type listMatchBuzzesRow struct {
+	QuestionNo int
+	PlayerID   string
+	LatencyMs  int
+	Granted    bool
+}
+
+// scanListMatchBuzzesRow listMatchBuzzesRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListMatchBuzzesRow(scanner rowScanner, extra ...interface{}) (listMatchBuzzesRow, error) {
+	var r listMatchBuzzesRow
+	dest := append([]interface{}{&r.QuestionNo, &r.PlayerID, &r.LatencyMs, &r.Granted}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// categoryRow クエリで読み込む1行
+type categoryRow struct {
+	ID          int
+	Name        string
+	Description string
+}
+
+// scanCategoryRow categoryRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanCategoryRow(scanner rowScanner, extra ...interface{}) (categoryRow, error) {
+	var r categoryRow
+	dest := append([]interface{}{&r.ID, &r.Name, &r.Description}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// countCategoryQuestionsRow クエリで読み込む1行
+type countCategoryQuestionsRow struct {
+	CategoryID    int
+	QuestionCount int
+}
+
+// scanCountCategoryQuestionsRow countCategoryQuestionsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanCountCategoryQuestionsRow(scanner rowScanner, extra ...interface{}) (countCategoryQuestionsRow, error) {
+	var r countCategoryQuestionsRow
+	dest := append([]interface{}{&r.CategoryID, &r.QuestionCount}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listTagsRow クエリで読み込む1行
+type listTagsRow struct {
+	ID   int
+	Name string
+}
+
+// scanListTagsRow listTagsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListTagsRow(scanner rowScanner, extra ...interface{}) (listTagsRow, error) {
+	var r listTagsRow
+	dest := append([]interface{}{&r.ID, &r.Name}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// countTagQuestionsRow クエリで読み込む1行
+type countTagQuestionsRow struct {
+	TagID         int
+	QuestionCount int
+}
+
+// scanCountTagQuestionsRow countTagQuestionsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanCountTagQuestionsRow(scanner rowScanner, extra ...interface{}) (countTagQuestionsRow, error) {
+	var r countTagQuestionsRow
+	dest := append([]interface{}{&r.TagID, &r.QuestionCount}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionLabelRow クエリで読み込む1行
+type questionLabelRow struct {
+	QuestionID int
+	Name       string
+}
+
+// scanQuestionLabelRow questionLabelRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionLabelRow(scanner rowScanner, extra ...interface{}) (questionLabelRow, error) {
+	var r questionLabelRow
+	dest := append([]interface{}{&r.QuestionID, &r.Name}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionPoolRow クエリで読み込む1行
+type questionPoolRow struct {
+	ID          int
+	Name        string
+	Description string
+}
+
+// scanQuestionPoolRow questionPoolRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionPoolRow(scanner rowScanner, extra ...interface{}) (questionPoolRow, error) {
+	var r questionPoolRow
+	dest := append([]interface{}{&r.ID, &r.Name, &r.Description}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// countPoolQuestionsRow クエリで読み込む1行
+type countPoolQuestionsRow struct {
+	PoolID        int
+	QuestionCount int
+}
+
+// scanCountPoolQuestionsRow countPoolQuestionsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanCountPoolQuestionsRow(scanner rowScanner, extra ...interface{}) (countPoolQuestionsRow, error) {
+	var r countPoolQuestionsRow
+	dest := append([]interface{}{&r.PoolID, &r.QuestionCount}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionPoolMemberRow クエリで読み込む1行
+type questionPoolMemberRow struct {
+	QuestionID int
+	PoolID     int
+}
+
+// scanQuestionPoolMemberRow questionPoolMemberRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionPoolMemberRow(scanner rowScanner, extra ...interface{}) (questionPoolMemberRow, error) {
+	var r questionPoolMemberRow
+	dest := append([]interface{}{&r.QuestionID, &r.PoolID}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionReportRow クエリで読み込む1行
+type questionReportRow struct {
+	ID              int
+	QuestionID      int
+	QuestionVersion int
+	Reporter        string
+	Reason          string
+	Comment         string
+	RoomID          string
+	GameType        string
+	Status          string
+	ResolvedBy      sql.NullString
+	ResolvedAt      sql.NullTime
+	CreatedAt       sql.NullTime
+}
+
+// scanQuestionReportRow questionReportRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionReportRow(scanner rowScanner, extra ...interface{}) (questionReportRow, error) {
+	var r questionReportRow
+	dest := append([]interface{}{&r.ID, &r.QuestionID, &r.QuestionVersion, &r.Reporter, &r.Reason, &r.Comment, &r.RoomID, &r.GameType, &r.Status, &r.ResolvedBy, &r.ResolvedAt, &r.CreatedAt}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionTranslationRow クエリで読み込む1行
+type questionTranslationRow struct {
+	QuestionID    int
+	Locale        string
+	QuestionText  string
+	CorrectAnswer string
+	Choice1       string
+	Choice2       string
+	Choice3       string
+	Choice4       string
+	Explanation   string
+	SourceVersion int
+	Translator    string
+	UpdatedAt     sql.NullTime
+}
+
+// scanQuestionTranslationRow questionTranslationRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanQuestionTranslationRow(scanner rowScanner, extra ...interface{}) (questionTranslationRow, error) {
+	var r questionTranslationRow
+	dest := append([]interface{}{&r.QuestionID, &r.Locale, &r.QuestionText, &r.CorrectAnswer, &r.Choice1, &r.Choice2, &r.Choice3, &r.Choice4, &r.Explanation, &r.SourceVersion, &r.Translator, &r.UpdatedAt}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// listTranslatedVersionsRow クエリで読み込む1行
+type listTranslatedVersionsRow struct {
+	QuestionID    int
+	Locale        string
+	SourceVersion int
+}
+
+// scanListTranslatedVersionsRow listTranslatedVersionsRowの列を順番に読み込む。extraは後ろに続く列の読み込み先
+func scanListTranslatedVersionsRow(scanner rowScanner, extra ...interface{}) (listTranslatedVersionsRow, error) {
+	var r listTranslatedVersionsRow
+	dest := append([]interface{}{&r.QuestionID, &r.Locale, &r.SourceVersion}, extra...)
+	err := scanner.Scan(dest...)
+	return r, err
+}
+
+// questionRowColumns questionRowで読み込む列
+const questionRowColumns = "id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at"
+
+// questionRowSelect 問題を読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const questionRowSelect = "SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at FROM questions"
+
+const queryCreateQuestion = "INSERT INTO questions (creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, source, difficulty, activate_at, retire_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// CreateQuestion 問題を追加してIDを返す
+func (c conn) CreateQuestion(ctx context.Context, creatorUsername string, questionText string, correctAnswer string, choice1 string, choice2 string, choice3 string, choice4 string, explanation string, status string, source string, difficulty string, activateAt time.Time, retireAt time.Time) (int64, error) {
+	return c.InsertID(ctx, queryCreateQuestion, creatorUsername, questionText, correctAnswer, choice1, choice2, choice3, choice4, explanation, status, source, difficulty, activateAt, retireAt)
+}
+
+const queryGetQuestion = "SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at FROM questions WHERE id = ? AND deleted_at IS NULL"
+
+// GetQuestion 削除されていない1問を返す
+func (c conn) GetQuestion(ctx context.Context, id int) (questionRow, error) {
+	return scanQuestionRow(c.QueryRowContext(ctx, queryGetQuestion, id))
+}
+
+const queryUpdateQuestion = "UPDATE questions SET question_text = ?, correct_answer = ?, choice1 = ?, choice2 = ?, choice3 = ?, choice4 = ?, explanation = ?, version = ? WHERE id = ? AND version = ? AND deleted_at IS NULL"
+
+// UpdateQuestion 削除されていない問題の内容と版を書き換える。作成者は変更しない
+// 現在の版が一致する場合だけ変更するので、同時に編集しても版が重複しない
+func (c conn) UpdateQuestion(ctx context.Context, questionText string, correctAnswer string, choice1 string, choice2 string, choice3 string, choice4 string, explanation string, version int, id int, version2 int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryUpdateQuestion, questionText, correctAnswer, choice1, choice2, choice3, choice4, explanation, version, id, version2)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryCreateQuestionVersion = "INSERT INTO question_versions (question_id, version, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, editor, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// CreateQuestionVersion 問題の版を追加する
+func (c conn) CreateQuestionVersion(ctx context.Context, questionID int, version int, questionText string, correctAnswer string, choice1 string, choice2 string, choice3 string, choice4 string, explanation string, editor string, createdAt time.Time) error {
+	_, err := c.ExecContext(ctx, queryCreateQuestionVersion, questionID, version, questionText, correctAnswer, choice1, choice2, choice3, choice4, explanation, editor, createdAt)
+	return err
+}
+
+const queryListQuestionVersions = "SELECT version, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, editor, created_at FROM question_versions WHERE question_id = ? ORDER BY version"
+
+// ListQuestionVersions 問題の版を古い順に返す
+func (c conn) ListQuestionVersions(ctx context.Context, questionID int) ([]listQuestionVersionsRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionVersions, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listQuestionVersionsRow
+	for rows.Next() {
+		item, err := scanListQuestionVersionsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryUpdateQuestionDifficulty = "UPDATE questions SET difficulty = ?, difficulty_score = ? WHERE id = ?"
+
+// UpdateQuestionDifficulty 回答の集計から計算した難易度を保存する
+func (c conn) UpdateQuestionDifficulty(ctx context.Context, difficulty string, difficultyScore float64, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryUpdateQuestionDifficulty, difficulty, difficultyScore, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryUpdateQuestionSchedule = "UPDATE questions SET activate_at = ?, retire_at = ? WHERE id = ? AND deleted_at IS NULL"
+
+// UpdateQuestionSchedule 削除されていない問題の出題を始める日時と終える日時を変更する
+func (c conn) UpdateQuestionSchedule(ctx context.Context, activateAt time.Time, retireAt time.Time, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryUpdateQuestionSchedule, activateAt, retireAt, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryListQuestionsByStatus = "SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at FROM questions WHERE deleted_at IS NULL AND status = ? ORDER BY id"
+
+// ListQuestionsByStatus 削除されていない問題のうち指定した状態のものを返す
+func (c conn) ListQuestionsByStatus(ctx context.Context, status string) ([]questionRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionsByStatus, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionRow
+	for rows.Next() {
+		item, err := scanQuestionRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryListQuestionsByCreator = "SELECT id, creator_username, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, status, version, source, difficulty, difficulty_score, activate_at, retire_at FROM questions WHERE creator_username = ? AND source = ? AND deleted_at IS NULL ORDER BY id DESC"
+
+// ListQuestionsByCreator ユーザーが投稿した問題を新しい順に返す。削除済みの問題は返さない
+func (c conn) ListQuestionsByCreator(ctx context.Context, creatorUsername string, source string) ([]questionRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionsByCreator, creatorUsername, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionRow
+	for rows.Next() {
+		item, err := scanQuestionRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryCountSubmissionsSince = "SELECT COUNT(*) FROM questions WHERE creator_username = ? AND source = ? AND created_at >= ?"
+
+// CountSubmissionsSince ユーザーがsince以降に投稿した問題の数を返す。削除された投稿も数える
+func (c conn) CountSubmissionsSince(ctx context.Context, creatorUsername string, source string, createdAt time.Time) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryCountSubmissionsSince, creatorUsername, source, createdAt).Scan(&v)
+	return v, err
+}
+
+const queryTopContributors = "SELECT creator_username, COUNT(*) AS approved_count FROM questions WHERE source = ? AND status = ? AND deleted_at IS NULL GROUP BY creator_username ORDER BY approved_count DESC, creator_username LIMIT ?"
+
+// TopContributors 承認された投稿の多い順にlimit人を返す
+func (c conn) TopContributors(ctx context.Context, source string, status string, limit int) ([]topContributorsRow, error) {
+	rows, err := c.QueryContext(ctx, queryTopContributors, source, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []topContributorsRow
+	for rows.Next() {
+		item, err := scanTopContributorsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const querySetQuestionStatus = "UPDATE questions SET status = ? WHERE id = ? AND status = ? AND deleted_at IS NULL"
+
+// SetQuestionStatus 削除されていない問題の状態を、現在の状態が一致する場合だけ変更する
+func (c conn) SetQuestionStatus(ctx context.Context, status string, id int, status2 string) (int64, error) {
+	res, err := c.ExecContext(ctx, querySetQuestionStatus, status, id, status2)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryCreateQuestionReview = "INSERT INTO question_reviews (question_id, reviewer, from_status, status, comment, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+
+// CreateQuestionReview 審査の記録を追加する
+func (c conn) CreateQuestionReview(ctx context.Context, questionID int, reviewer string, fromStatus string, status string, comment string, createdAt time.Time) error {
+	_, err := c.ExecContext(ctx, queryCreateQuestionReview, questionID, reviewer, fromStatus, status, comment, createdAt)
+	return err
+}
+
+const queryListQuestionReviews = "SELECT id, question_id, reviewer, from_status, status, comment, created_at FROM question_reviews WHERE question_id = ? ORDER BY id"
+
+// ListQuestionReviews 問題の審査の記録を古い順に返す
+func (c conn) ListQuestionReviews(ctx context.Context, questionID int) ([]listQuestionReviewsRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionReviews, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listQuestionReviewsRow
+	for rows.Next() {
+		item, err := scanListQuestionReviewsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryDeleteQuestion = "UPDATE questions SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL"
+
+// DeleteQuestion 問題を削除済みにする。削除済みの問題は変更しない
+func (c conn) DeleteQuestion(ctx context.Context, deletedAt time.Time, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryDeleteQuestion, deletedAt, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryRestoreQuestion = "UPDATE questions SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL"
+
+// RestoreQuestion 削除済みの問題を元に戻す
+func (c conn) RestoreQuestion(ctx context.Context, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryRestoreQuestion, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryListQuestionStats = "SELECT q.id, q.question_text, COALESCE(s.times_shown, 0) AS times_shown, COALESCE(s.times_answered, 0) AS times_answered, COALESCE(s.times_correct, 0) AS times_correct, COALESCE(s.total_answer_ms, 0) AS total_answer_ms FROM questions q LEFT JOIN question_stats s ON s.question_id = q.id WHERE q.deleted_at IS NULL ORDER BY q.id"
+
+// ListQuestionStats 削除されていない問題の回答の集計を返す
+func (c conn) ListQuestionStats(ctx context.Context) ([]questionStatsRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionStats)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionStatsRow
+	for rows.Next() {
+		item, err := scanQuestionStatsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetQuestionStats = "SELECT q.id, q.question_text, COALESCE(s.times_shown, 0) AS times_shown, COALESCE(s.times_answered, 0) AS times_answered, COALESCE(s.times_correct, 0) AS times_correct, COALESCE(s.total_answer_ms, 0) AS total_answer_ms FROM questions q LEFT JOIN question_stats s ON s.question_id = q.id WHERE q.id = ?"
+
+// GetQuestionStats 1問の回答の集計を返す。削除済みの問題も返す
+func (c conn) GetQuestionStats(ctx context.Context, id int) (questionStatsRow, error) {
+	return scanQuestionStatsRow(c.QueryRowContext(ctx, queryGetQuestionStats, id))
+}
+
+// matchRowColumns matchRowで読み込む列
+const matchRowColumns = "m.id, m.game_type, m.rated, m.player1_id, m.player2_id, m.player1_score, m.player2_score, m.winner_id, m.started_at, m.created_at"
+
+// matchRowSelect 対戦履歴を読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const matchRowSelect = "SELECT m.id, m.game_type, m.rated, m.player1_id, m.player2_id, m.player1_score, m.player2_score, m.winner_id, m.started_at, m.created_at FROM matches m"
+
+const queryGetMatch = "SELECT m.id, m.game_type, m.rated, m.player1_id, m.player2_id, m.player1_score, m.player2_score, m.winner_id, m.started_at, m.created_at FROM matches m WHERE m.id = ?"
+
+// GetMatch 1件の対戦を返す
+func (c conn) GetMatch(ctx context.Context, id int64) (matchRow, error) {
+	return scanMatchRow(c.QueryRowContext(ctx, queryGetMatch, id))
+}
+
+const queryListMatchPlayers = "SELECT username, old_rating, new_rating, answer_ms FROM rating_history WHERE match_id = ?"
+
+// ListMatchPlayers 対戦でのプレイヤーごとのレート変動を返す
+func (c conn) ListMatchPlayers(ctx context.Context, matchID int64) ([]listMatchPlayersRow, error) {
+	rows, err := c.QueryContext(ctx, queryListMatchPlayers, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listMatchPlayersRow
+	for rows.Next() {
+		item, err := scanListMatchPlayersRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetRating = "SELECT rating FROM player_ratings WHERE username = ? AND game_type = ?"
+
+// GetRating プレイヤーのレートを返す
+func (c conn) GetRating(ctx context.Context, username string, gameType string) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryGetRating, username, gameType).Scan(&v)
+	return v, err
+}
+
+const queryTopRatings = "SELECT username, rating FROM player_ratings WHERE game_type = ? ORDER BY rating DESC LIMIT ?"
+
+// TopRatings レートの高い順にlimit人を返す
+func (c conn) TopRatings(ctx context.Context, gameType string, limit int) ([]topRatingsRow, error) {
+	rows, err := c.QueryContext(ctx, queryTopRatings, gameType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []topRatingsRow
+	for rows.Next() {
+		item, err := scanTopRatingsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryListMatchAnswers = "SELECT a.question_no, a.question_id, a.question_version, COALESCE(v.question_text, q.question_text, '') AS question_text, COALESCE(v.correct_answer, q.correct_answer, '') AS correct_answer, a.player_id, a.answer, a.correct, a.latency_ms FROM match_answers a LEFT JOIN questions q ON q.id = a.question_id LEFT JOIN question_versions v ON v.question_id = a.question_id AND v.version = a.question_version WHERE a.match_id = ? ORDER BY a.question_no"
+
+// ListMatchAnswers 対戦の問題ごとの回答を出題順に返す。問題は削除済みでも返す
+// 問題の内容は出題した時点の版を返す。版を記録していない古い対戦は現在の内容を返す
+func (c conn) ListMatchAnswers(ctx context.Context, matchID int64) ([]listMatchAnswersRow, error) {
+	rows, err := c.QueryContext(ctx, queryListMatchAnswers, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listMatchAnswersRow
+	for rows.Next() {
+		item, err := scanListMatchAnswersRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryListMatchBuzzes = "SELECT question_no, player_id, latency_ms, granted FROM match_buzzes WHERE match_id = ? ORDER BY question_no, id"
+
+// ListMatchBuzzes 対戦の回答権の要求を要求した順に返す
+func (c conn) ListMatchBuzzes(ctx context.Context, matchID int64) ([]listMatchBuzzesRow, error) {
+	rows, err := c.QueryContext(ctx, queryListMatchBuzzes, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listMatchBuzzesRow
+	for rows.Next() {
+		item, err := scanListMatchBuzzesRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// categoryRowColumns categoryRowで読み込む列
+const categoryRowColumns = "id, name, description"
+
+// categoryRowSelect カテゴリーを読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const categoryRowSelect = "SELECT id, name, description FROM categories"
+
+const queryListCategories = "SELECT id, name, description FROM categories ORDER BY name"
+
+// ListCategories カテゴリーを名前の順に返す
+func (c conn) ListCategories(ctx context.Context) ([]categoryRow, error) {
+	rows, err := c.QueryContext(ctx, queryListCategories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []categoryRow
+	for rows.Next() {
+		item, err := scanCategoryRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetCategory = "SELECT id, name, description FROM categories WHERE id = ?"
+
+// GetCategory 1件のカテゴリーを返す
+func (c conn) GetCategory(ctx context.Context, id int) (categoryRow, error) {
+	return scanCategoryRow(c.QueryRowContext(ctx, queryGetCategory, id))
+}
+
+const queryCountCategoryQuestions = "SELECT qc.category_id, COUNT(*) AS question_count FROM question_categories qc JOIN questions q ON q.id = qc.question_id WHERE q.deleted_at IS NULL GROUP BY qc.category_id"
+
+// CountCategoryQuestions カテゴリーごとの削除されていない問題の数を返す
+func (c conn) CountCategoryQuestions(ctx context.Context) ([]countCategoryQuestionsRow, error) {
+	rows, err := c.QueryContext(ctx, queryCountCategoryQuestions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []countCategoryQuestionsRow
+	for rows.Next() {
+		item, err := scanCountCategoryQuestionsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryCategoryNameTaken = "SELECT COUNT(*) FROM categories WHERE name = ? AND id <> ?"
+
+// CategoryNameTaken id以外のカテゴリーが同じ名前を使っている数を返す
+func (c conn) CategoryNameTaken(ctx context.Context, name string, id int) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryCategoryNameTaken, name, id).Scan(&v)
+	return v, err
+}
+
+const queryCreateCategory = "INSERT INTO categories (name, description) VALUES (?, ?)"
+
+// CreateCategory カテゴリーを追加してIDを返す
+func (c conn) CreateCategory(ctx context.Context, name string, description string) (int64, error) {
+	return c.InsertID(ctx, queryCreateCategory, name, description)
+}
+
+const queryUpdateCategory = "UPDATE categories SET name = ?, description = ? WHERE id = ?"
+
+// UpdateCategory カテゴリーの名前と説明を変更する
+func (c conn) UpdateCategory(ctx context.Context, name string, description string, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryUpdateCategory, name, description, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryDeleteCategory = "DELETE FROM categories WHERE id = ?"
+
+// DeleteCategory カテゴリーを削除する。先にDeleteCategoryLinksで問題との紐付けを削除すること
+func (c conn) DeleteCategory(ctx context.Context, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryDeleteCategory, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryDeleteCategoryLinks = "DELETE FROM question_categories WHERE category_id = ?"
+
+// DeleteCategoryLinks カテゴリーと問題の紐付けを全て削除する
+func (c conn) DeleteCategoryLinks(ctx context.Context, categoryID int) error {
+	_, err := c.ExecContext(ctx, queryDeleteCategoryLinks, categoryID)
+	return err
+}
+
+const queryListTags = "SELECT id, name FROM tags ORDER BY name"
+
+// ListTags タグを名前の順に返す
+func (c conn) ListTags(ctx context.Context) ([]listTagsRow, error) {
+	rows, err := c.QueryContext(ctx, queryListTags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listTagsRow
+	for rows.Next() {
+		item, err := scanListTagsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryCountTagQuestions = "SELECT qt.tag_id, COUNT(*) AS question_count FROM question_tags qt JOIN questions q ON q.id = qt.question_id WHERE q.deleted_at IS NULL GROUP BY qt.tag_id"
+
+// CountTagQuestions タグごとの削除されていない問題の数を返す
+func (c conn) CountTagQuestions(ctx context.Context) ([]countTagQuestionsRow, error) {
+	rows, err := c.QueryContext(ctx, queryCountTagQuestions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []countTagQuestionsRow
+	for rows.Next() {
+		item, err := scanCountTagQuestionsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryTagNameTaken = "SELECT COUNT(*) FROM tags WHERE name = ?"
+
+// TagNameTaken 同じ名前のタグの数を返す
+func (c conn) TagNameTaken(ctx context.Context, name string) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryTagNameTaken, name).Scan(&v)
+	return v, err
+}
+
+const queryCreateTag = "INSERT INTO tags (name) VALUES (?)"
+
+// CreateTag タグを追加してIDを返す
+func (c conn) CreateTag(ctx context.Context, name string) (int64, error) {
+	return c.InsertID(ctx, queryCreateTag, name)
+}
+
+const queryDeleteTag = "DELETE FROM tags WHERE id = ?"
+
+// DeleteTag タグを削除する。先にDeleteTagLinksで問題との紐付けを削除すること
+func (c conn) DeleteTag(ctx context.Context, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryDeleteTag, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryDeleteTagLinks = "DELETE FROM question_tags WHERE tag_id = ?"
+
+// DeleteTagLinks タグと問題の紐付けを全て削除する
+func (c conn) DeleteTagLinks(ctx context.Context, tagID int) error {
+	_, err := c.ExecContext(ctx, queryDeleteTagLinks, tagID)
+	return err
+}
+
+// questionLabelRowColumns questionLabelRowで読み込む列
+const questionLabelRowColumns = "qc.question_id, c.name"
+
+// questionLabelRowSelect 問題に付いたカテゴリー・タグの名前を読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const questionLabelRowSelect = "SELECT qc.question_id, c.name FROM question_categories qc JOIN categories c ON c.id = qc.category_id"
+
+const queryListQuestionCategoryNames = "SELECT qc.question_id, c.name FROM question_categories qc JOIN categories c ON c.id = qc.category_id ORDER BY c.name"
+
+// ListQuestionCategoryNames 全ての問題のカテゴリーの名前を返す
+func (c conn) ListQuestionCategoryNames(ctx context.Context) ([]questionLabelRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionCategoryNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionLabelRow
+	for rows.Next() {
+		item, err := scanQuestionLabelRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetQuestionCategoryNames = "SELECT qc.question_id, c.name FROM question_categories qc JOIN categories c ON c.id = qc.category_id WHERE qc.question_id = ? ORDER BY c.name"
+
+// GetQuestionCategoryNames 1問のカテゴリーの名前を返す
+func (c conn) GetQuestionCategoryNames(ctx context.Context, questionID int) ([]questionLabelRow, error) {
+	rows, err := c.QueryContext(ctx, queryGetQuestionCategoryNames, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionLabelRow
+	for rows.Next() {
+		item, err := scanQuestionLabelRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryListQuestionTagNames = "SELECT qt.question_id, t.name FROM question_tags qt JOIN tags t ON t.id = qt.tag_id ORDER BY t.name"
+
+// ListQuestionTagNames 全ての問題のタグの名前を返す
+func (c conn) ListQuestionTagNames(ctx context.Context) ([]questionLabelRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionTagNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionLabelRow
+	for rows.Next() {
+		item, err := scanQuestionLabelRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetQuestionTagNames = "SELECT qt.question_id, t.name FROM question_tags qt JOIN tags t ON t.id = qt.tag_id WHERE qt.question_id = ? ORDER BY t.name"
+
+// GetQuestionTagNames 1問のタグの名前を返す
+func (c conn) GetQuestionTagNames(ctx context.Context, questionID int) ([]questionLabelRow, error) {
+	rows, err := c.QueryContext(ctx, queryGetQuestionTagNames, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionLabelRow
+	for rows.Next() {
+		item, err := scanQuestionLabelRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryClearQuestionCategories = "DELETE FROM question_categories WHERE question_id = ?"
+
+// ClearQuestionCategories 問題のカテゴリーの紐付けを全て削除する
+func (c conn) ClearQuestionCategories(ctx context.Context, questionID int) error {
+	_, err := c.ExecContext(ctx, queryClearQuestionCategories, questionID)
+	return err
+}
+
+const queryAddQuestionCategory = "INSERT INTO question_categories (question_id, category_id) VALUES (?, ?)"
+
+// AddQuestionCategory 問題にカテゴリーを紐付ける
+func (c conn) AddQuestionCategory(ctx context.Context, questionID int, categoryID int) error {
+	_, err := c.ExecContext(ctx, queryAddQuestionCategory, questionID, categoryID)
+	return err
+}
+
+const queryClearQuestionTags = "DELETE FROM question_tags WHERE question_id = ?"
+
+// ClearQuestionTags 問題のタグの紐付けを全て削除する
+func (c conn) ClearQuestionTags(ctx context.Context, questionID int) error {
+	_, err := c.ExecContext(ctx, queryClearQuestionTags, questionID)
+	return err
+}
+
+const queryAddQuestionTag = "INSERT INTO question_tags (question_id, tag_id) VALUES (?, ?)"
+
+// AddQuestionTag 問題にタグを紐付ける
+func (c conn) AddQuestionTag(ctx context.Context, questionID int, tagID int) error {
+	_, err := c.ExecContext(ctx, queryAddQuestionTag, questionID, tagID)
+	return err
+}
+
+// questionPoolRowColumns questionPoolRowで読み込む列
+const questionPoolRowColumns = "id, name, description"
+
+// questionPoolRowSelect 問題のプールを読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const questionPoolRowSelect = "SELECT id, name, description FROM question_pools"
+
+const queryListQuestionPools = "SELECT id, name, description FROM question_pools ORDER BY name"
+
+// ListQuestionPools プールを名前の順に返す
+func (c conn) ListQuestionPools(ctx context.Context) ([]questionPoolRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionPools)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionPoolRow
+	for rows.Next() {
+		item, err := scanQuestionPoolRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetQuestionPool = "SELECT id, name, description FROM question_pools WHERE id = ?"
+
+// GetQuestionPool 1件のプールを返す
+func (c conn) GetQuestionPool(ctx context.Context, id int) (questionPoolRow, error) {
+	return scanQuestionPoolRow(c.QueryRowContext(ctx, queryGetQuestionPool, id))
+}
+
+const queryCountPoolQuestions = "SELECT m.pool_id, COUNT(*) AS question_count FROM question_pool_members m JOIN questions q ON q.id = m.question_id WHERE q.deleted_at IS NULL AND q.status = ? GROUP BY m.pool_id"
+
+// CountPoolQuestions プールごとの出題できる(削除されておらず承認済みの)問題の数を返す
+func (c conn) CountPoolQuestions(ctx context.Context, status string) ([]countPoolQuestionsRow, error) {
+	rows, err := c.QueryContext(ctx, queryCountPoolQuestions, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []countPoolQuestionsRow
+	for rows.Next() {
+		item, err := scanCountPoolQuestionsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryQuestionPoolNameTaken = "SELECT COUNT(*) FROM question_pools WHERE name = ? AND id <> ?"
+
+// QuestionPoolNameTaken id以外のプールが同じ名前を使っている数を返す
+func (c conn) QuestionPoolNameTaken(ctx context.Context, name string, id int) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryQuestionPoolNameTaken, name, id).Scan(&v)
+	return v, err
+}
+
+const queryCreateQuestionPool = "INSERT INTO question_pools (name, description) VALUES (?, ?)"
+
+// CreateQuestionPool プールを追加してIDを返す
+func (c conn) CreateQuestionPool(ctx context.Context, name string, description string) (int64, error) {
+	return c.InsertID(ctx, queryCreateQuestionPool, name, description)
+}
+
+const queryUpdateQuestionPool = "UPDATE question_pools SET name = ?, description = ? WHERE id = ?"
+
+// UpdateQuestionPool プールの名前と説明を変更する
+func (c conn) UpdateQuestionPool(ctx context.Context, name string, description string, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryUpdateQuestionPool, name, description, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryDeleteQuestionPool = "DELETE FROM question_pools WHERE id = ?"
+
+// DeleteQuestionPool プールを削除する。先にDeleteQuestionPoolMembersとClearSeasonQuestionPoolで参照を外すこと
+func (c conn) DeleteQuestionPool(ctx context.Context, id int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryDeleteQuestionPool, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryDeleteQuestionPoolMembers = "DELETE FROM question_pool_members WHERE pool_id = ?"
+
+// DeleteQuestionPoolMembers プールに入っている問題を全て外す
+func (c conn) DeleteQuestionPoolMembers(ctx context.Context, poolID int) error {
+	_, err := c.ExecContext(ctx, queryDeleteQuestionPoolMembers, poolID)
+	return err
+}
+
+const queryClearSeasonQuestionPool = "UPDATE seasons SET question_pool_id = NULL WHERE question_pool_id = ?"
+
+// ClearSeasonQuestionPool プールを使っているシーズンの設定を外す
+func (c conn) ClearSeasonQuestionPool(ctx context.Context, questionPoolID int) error {
+	_, err := c.ExecContext(ctx, queryClearSeasonQuestionPool, questionPoolID)
+	return err
+}
+
+// questionPoolMemberRowColumns questionPoolMemberRowで読み込む列
+const questionPoolMemberRowColumns = "question_id, pool_id"
+
+// questionPoolMemberRowSelect 問題が入っているプールを読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const questionPoolMemberRowSelect = "SELECT question_id, pool_id FROM question_pool_members"
+
+const queryListQuestionPoolMembers = "SELECT question_id, pool_id FROM question_pool_members ORDER BY pool_id"
+
+// ListQuestionPoolMembers 全ての問題が入っているプールを返す
+func (c conn) ListQuestionPoolMembers(ctx context.Context) ([]questionPoolMemberRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionPoolMembers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionPoolMemberRow
+	for rows.Next() {
+		item, err := scanQuestionPoolMemberRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetQuestionPoolMembers = "SELECT question_id, pool_id FROM question_pool_members WHERE question_id = ? ORDER BY pool_id"
+
+// GetQuestionPoolMembers 1問が入っているプールを返す
+func (c conn) GetQuestionPoolMembers(ctx context.Context, questionID int) ([]questionPoolMemberRow, error) {
+	rows, err := c.QueryContext(ctx, queryGetQuestionPoolMembers, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionPoolMemberRow
+	for rows.Next() {
+		item, err := scanQuestionPoolMemberRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryQuestionPoolMemberExists = "SELECT COUNT(*) FROM question_pool_members WHERE pool_id = ? AND question_id = ?"
+
+// QuestionPoolMemberExists 問題がプールに入っているか(0か1)を返す
+func (c conn) QuestionPoolMemberExists(ctx context.Context, poolID int, questionID int) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryQuestionPoolMemberExists, poolID, questionID).Scan(&v)
+	return v, err
+}
+
+const queryAddQuestionPoolMember = "INSERT INTO question_pool_members (pool_id, question_id) VALUES (?, ?)"
+
+// AddQuestionPoolMember 問題をプールに入れる
+func (c conn) AddQuestionPoolMember(ctx context.Context, poolID int, questionID int) error {
+	_, err := c.ExecContext(ctx, queryAddQuestionPoolMember, poolID, questionID)
+	return err
+}
+
+const queryRemoveQuestionPoolMember = "DELETE FROM question_pool_members WHERE pool_id = ? AND question_id = ?"
+
+// RemoveQuestionPoolMember 問題をプールから外す
+func (c conn) RemoveQuestionPoolMember(ctx context.Context, poolID int, questionID int) (int64, error) {
+	res, err := c.ExecContext(ctx, queryRemoveQuestionPoolMember, poolID, questionID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// questionReportRowColumns questionReportRowで読み込む列
+const questionReportRowColumns = "id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at"
+
+// questionReportRowSelect 問題の報告を読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const questionReportRowSelect = "SELECT id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at FROM question_reports"
+
+const queryOpenQuestionReportExists = "SELECT COUNT(*) FROM question_reports WHERE question_id = ? AND reporter = ? AND status = ?"
+
+// OpenQuestionReportExists プレイヤーがその問題に未対応の報告をしているか(0か1)を返す
+func (c conn) OpenQuestionReportExists(ctx context.Context, questionID int, reporter string, status string) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryOpenQuestionReportExists, questionID, reporter, status).Scan(&v)
+	return v, err
+}
+
+const queryCreateQuestionReport = "INSERT INTO question_reports (question_id, question_version, reporter, reason, comment, room_id, game_type, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// CreateQuestionReport 問題の報告を追加してIDを返す
+func (c conn) CreateQuestionReport(ctx context.Context, questionID int, questionVersion int, reporter string, reason string, comment string, roomID string, gameType string, status string, createdAt time.Time) (int64, error) {
+	return c.InsertID(ctx, queryCreateQuestionReport, questionID, questionVersion, reporter, reason, comment, roomID, gameType, status, createdAt)
+}
+
+const queryCountQuestionReportsByStatus = "SELECT COUNT(*) FROM question_reports WHERE question_id = ? AND status = ?"
+
+// CountQuestionReportsByStatus 問題の指定した状態の報告の数を返す
+func (c conn) CountQuestionReportsByStatus(ctx context.Context, questionID int, status string) (int, error) {
+	var v int
+	err := c.QueryRowContext(ctx, queryCountQuestionReportsByStatus, questionID, status).Scan(&v)
+	return v, err
+}
+
+const queryListQuestionReportsByStatus = "SELECT id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at FROM question_reports WHERE status = ? ORDER BY created_at, id"
+
+// ListQuestionReportsByStatus 指定した状態の報告を古い順に返す
+func (c conn) ListQuestionReportsByStatus(ctx context.Context, status string) ([]questionReportRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionReportsByStatus, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionReportRow
+	for rows.Next() {
+		item, err := scanQuestionReportRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryListQuestionReportsByQuestion = "SELECT id, question_id, question_version, reporter, reason, comment, room_id, game_type, status, resolved_by, resolved_at, created_at FROM question_reports WHERE question_id = ? ORDER BY created_at, id"
+
+// ListQuestionReportsByQuestion 1問の報告を古い順に返す
+func (c conn) ListQuestionReportsByQuestion(ctx context.Context, questionID int) ([]questionReportRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionReportsByQuestion, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionReportRow
+	for rows.Next() {
+		item, err := scanQuestionReportRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryCloseQuestionReports = "UPDATE question_reports SET status = ?, resolved_by = ?, resolved_at = ? WHERE question_id = ? AND status = ?"
+
+// CloseQuestionReports 問題の未対応の報告を対応済みか却下にする
+func (c conn) CloseQuestionReports(ctx context.Context, status string, resolvedBy string, resolvedAt time.Time, questionID int, status2 string) (int64, error) {
+	res, err := c.ExecContext(ctx, queryCloseQuestionReports, status, resolvedBy, resolvedAt, questionID, status2)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// questionTranslationRowColumns questionTranslationRowで読み込む列
+const questionTranslationRowColumns = "question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at"
+
+// questionTranslationRowSelect 問題の翻訳を読み込むSELECT
+// 条件や並び順は後ろに付け足して使う
+const questionTranslationRowSelect = "SELECT question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at FROM question_translations"
+
+const queryListQuestionTranslations = "SELECT question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at FROM question_translations WHERE question_id = ? ORDER BY locale"
+
+// ListQuestionTranslations 1問の翻訳を言語の順に返す
+func (c conn) ListQuestionTranslations(ctx context.Context, questionID int) ([]questionTranslationRow, error) {
+	rows, err := c.QueryContext(ctx, queryListQuestionTranslations, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []questionTranslationRow
+	for rows.Next() {
+		item, err := scanQuestionTranslationRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const queryGetQuestionTranslation = "SELECT question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at FROM question_translations WHERE question_id = ? AND locale = ?"
+
+// GetQuestionTranslation 1問の1つの言語の翻訳を返す
+func (c conn) GetQuestionTranslation(ctx context.Context, questionID int, locale string) (questionTranslationRow, error) {
+	return scanQuestionTranslationRow(c.QueryRowContext(ctx, queryGetQuestionTranslation, questionID, locale))
+}
+
+const queryCreateQuestionTranslation = "INSERT INTO question_translations (question_id, locale, question_text, correct_answer, choice1, choice2, choice3, choice4, explanation, source_version, translator, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// CreateQuestionTranslation 問題の翻訳を追加する
+func (c conn) CreateQuestionTranslation(ctx context.Context, questionID int, locale string, questionText string, correctAnswer string, choice1 string, choice2 string, choice3 string, choice4 string, explanation string, sourceVersion int, translator string, updatedAt time.Time) error {
+	_, err := c.ExecContext(ctx, queryCreateQuestionTranslation, questionID, locale, questionText, correctAnswer, choice1, choice2, choice3, choice4, explanation, sourceVersion, translator, updatedAt)
+	return err
+}
+
+const queryUpdateQuestionTranslation = "UPDATE question_translations SET question_text = ?, correct_answer = ?, choice1 = ?, choice2 = ?, choice3 = ?, choice4 = ?, explanation = ?, source_version = ?, translator = ?, updated_at = ? WHERE question_id = ? AND locale = ?"
+
+// UpdateQuestionTranslation 問題の翻訳を書き換える
+func (c conn) UpdateQuestionTranslation(ctx context.Context, questionText string, correctAnswer string, choice1 string, choice2 string, choice3 string, choice4 string, explanation string, sourceVersion int, translator string, updatedAt time.Time, questionID int, locale string) (int64, error) {
+	res, err := c.ExecContext(ctx, queryUpdateQuestionTranslation, questionText, correctAnswer, choice1, choice2, choice3, choice4, explanation, sourceVersion, translator, updatedAt, questionID, locale)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryDeleteQuestionTranslation = "DELETE FROM question_translations WHERE question_id = ? AND locale = ?"
+
+// DeleteQuestionTranslation 問題の翻訳を削除する
+func (c conn) DeleteQuestionTranslation(ctx context.Context, questionID int, locale string) (int64, error) {
+	res, err := c.ExecContext(ctx, queryDeleteQuestionTranslation, questionID, locale)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const queryListTranslatedVersions = "SELECT question_id, locale, source_version FROM question_translations ORDER BY locale, question_id"
+
+// ListTranslatedVersions 全ての翻訳の問題・言語と、翻訳した元の版を返す
+func (c conn) ListTranslatedVersions(ctx context.Context) ([]listTranslatedVersionsRow, error) {
+	rows, err := c.QueryContext(ctx, queryListTranslatedVersions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listTranslatedVersionsRow
+	for rows.Next() {
+		item, err := scanListTranslatedVersionsRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,681 @@
+// querygen queries.sqlに書いたクエリから、型付きの読み込み処理を生成する
+//
+// 列の型はスキーマ(db.sql)から決めるので、列を追加・変更したときに
+// Scanの順番や型がずれたまま動き続けることがない。スキーマにない列を参照すると生成に失敗する
+//
+// クエリは次の形式で書く。2行目以降のコメントは生成する関数の説明になる
+//
+//	-- name: CountQuestions :one
+//	-- 削除されていない問題の件数
+//	SELECT COUNT(*) FROM questions WHERE deleted_at IS NULL;
+//
+// 種類:
+//
+//	:columns  列の一覧と読み込み用の構造体だけを生成する(条件を組み立てるクエリ用)
+//	:one      1行を返す。行がなければsql.ErrNoRows
+//	:many     全ての行を返す
+//	:exec     結果を返さない
+//	:execrows 変更した行数を返す
+//	:insertid 追加した行のIDを返す
+//
+// :one と :many は種類の後に構造体の名前を書くと、同じ列を読み込む他のクエリと構造体を共有する
+// 引数の型は「列 = ?」の比較、INSERTの列の並び、LIMIT・OFFSETから決める
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "スキーマのファイル(MySQLのCREATE TABLE)")
+	queriesPath := flag.String("queries", "queries.sql", "クエリのファイル")
+	outPath := flag.String("out", "queries_gen.go", "生成するファイル")
+	pkg := flag.String("package", "repository", "生成するファイルのパッケージ名")
+	check := flag.Bool("check", false, "生成せずに、生成済みのファイルが最新かだけを確認する")
+	flag.Parse()
+	log.SetFlags(0)
+
+	schema, err := loadSchema(*schemaPath)
+	if err != nil {
+		log.Fatalf("スキーマを読み込めません: %v", err)
+	}
+	queries, err := loadQueries(*queriesPath)
+	if err != nil {
+		log.Fatalf("クエリを読み込めません: %v", err)
+	}
+
+	g := &generator{schema: schema, rows: make(map[string][]field)}
+	for _, q := range queries {
+		if err := g.add(q); err != nil {
+			log.Fatalf("%s: %v", q.name, err)
+		}
+	}
+	src, err := g.source(*pkg)
+	if err != nil {
+		log.Fatalf("生成したコードを整形できません: %v", err)
+	}
+
+	if *check {
+		current, err := os.ReadFile(*outPath)
+		if err != nil || !bytes.Equal(current, src) {
+			log.Fatalf("%sが%sと一致しません。go generateを実行してください", *outPath, *queriesPath)
+		}
+		return
+	}
+	if err := os.WriteFile(*outPath, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// column スキーマの1列
+type column struct {
+	sqlType string
+	notNull bool
+}
+
+// schema テーブル名から列名と列の情報を引く
+type schema map[string]map[string]column
+
+var (
+	createTableRe = regexp.MustCompile(`(?i)^CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+	constraintRe  = regexp.MustCompile(`(?i)^(PRIMARY KEY|UNIQUE|INDEX|KEY|FOREIGN KEY|CONSTRAINT|CHECK)\b`)
+)
+
+// loadSchema CREATE TABLEの列の定義を読み込む。1行に1列ずつ書かれていること
+func loadSchema(path string) (schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := make(schema)
+	var table map[string]column
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "--"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if m := createTableRe.FindStringSubmatch(line); m != nil {
+			table = make(map[string]column)
+			s[m[1]] = table
+			continue
+		}
+		if table == nil || line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ")") {
+			table = nil
+			continue
+		}
+		if constraintRe.MatchString(line) {
+			continue
+		}
+		words := strings.Fields(strings.TrimSuffix(line, ","))
+		if len(words) < 2 {
+			continue
+		}
+		upper := strings.ToUpper(line)
+		sqlType := strings.ToUpper(words[1])
+		if i := strings.Index(sqlType, "("); i >= 0 {
+			sqlType = sqlType[:i]
+		}
+		table[words[0]] = column{
+			sqlType: sqlType,
+			notNull: strings.Contains(upper, "NOT NULL") || strings.Contains(upper, "PRIMARY KEY"),
+		}
+	}
+	return s, scanner.Err()
+}
+
+// query queries.sqlの1つのクエリ
+type query struct {
+	name    string
+	kind    string
+	rowType string
+	doc     []string
+	sql     string
+}
+
+var nameRe = regexp.MustCompile(`^-- name: (\w+) (:\w+)(?: (\w+))?\s*$`)
+
+func loadQueries(path string) ([]query, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []query
+	var current *query
+	var body []string
+	flush := func() {
+		if current != nil {
+			current.sql = strings.TrimSuffix(strings.Join(strings.Fields(strings.Join(body, " ")), " "), ";")
+			queries = append(queries, *current)
+		}
+		body = nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := nameRe.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			current = &query{name: m[1], kind: m[2], rowType: m[3]}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "--") {
+			if len(body) == 0 {
+				current.doc = append(current.doc, strings.TrimSpace(strings.TrimPrefix(trimmed, "--")))
+			}
+			continue
+		}
+		if trimmed != "" {
+			body = append(body, trimmed)
+		}
+	}
+	flush()
+	return queries, nil
+}
+
+// field 読み込む1列、または1つの引数
+type field struct {
+	name   string // Goでの名前
+	goType string
+}
+
+type generator struct {
+	schema schema
+	rows   map[string][]field
+	order  []string // 構造体を生成する順番
+	decls  bytes.Buffer
+	usesDB bool
+	usesT  bool
+}
+
+// source 生成したコード全体を返す
+func (g *generator) source(pkg string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by querygen from queries.sql. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	buf.WriteString("import (\n\"context\"\n")
+	if g.usesDB {
+		buf.WriteString("\"database/sql\"\n")
+	}
+	if g.usesT {
+		buf.WriteString("\"time\"\n")
+	}
+	buf.WriteString(")\n\n")
+	buf.WriteString("// rowScanner *sql.Rowと*sql.Rowsの共通のメソッド\n")
+	buf.WriteString("type rowScanner interface {\nScan(dest ...interface{}) error\n}\n\n")
+	for _, name := range g.order {
+		g.writeRow(&buf, name, g.rows[name])
+	}
+	buf.Write(g.decls.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+func (g *generator) writeRow(buf *bytes.Buffer, name string, fields []field) {
+	fmt.Fprintf(buf, "// %s クエリで読み込む1行\n", name)
+	fmt.Fprintf(buf, "type %s struct {\n", name)
+	for _, f := range fields {
+		fmt.Fprintf(buf, "%s %s\n", f.name, f.goType)
+	}
+	buf.WriteString("}\n\n")
+
+	scan := "scan" + exported(name)
+	fmt.Fprintf(buf, "// %s %sの列を順番に読み込む。extraは後ろに続く列の読み込み先\n", scan, name)
+	fmt.Fprintf(buf, "func %s(scanner rowScanner, extra ...interface{}) (%s, error) {\n", scan, name)
+	fmt.Fprintf(buf, "var r %s\n", name)
+	buf.WriteString("dest := append([]interface{}{")
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "&r.%s", f.name)
+	}
+	buf.WriteString("}, extra...)\n")
+	buf.WriteString("err := scanner.Scan(dest...)\nreturn r, err\n}\n\n")
+}
+
+// defineRow 読み込む列の構造体を登録する。既にあれば同じ列を読み込むかを確認する
+func (g *generator) defineRow(name string, fields []field) error {
+	if existing, ok := g.rows[name]; ok {
+		if len(existing) != len(fields) {
+			return fmt.Errorf("%sと列の数が違います", name)
+		}
+		for i := range fields {
+			if existing[i] != fields[i] {
+				return fmt.Errorf("%sと%d番目の列(%s %s)が違います", name, i+1, fields[i].name, fields[i].goType)
+			}
+		}
+		return nil
+	}
+	g.rows[name] = fields
+	g.order = append(g.order, name)
+	return nil
+}
+
+func (g *generator) add(q query) error {
+	tables, err := g.tables(q.sql)
+	if err != nil {
+		return err
+	}
+	params, err := g.params(q.sql, tables)
+	if err != nil {
+		return err
+	}
+	var columns []field
+	if strings.HasPrefix(strings.ToUpper(q.sql), "SELECT ") {
+		if columns, err = g.selectColumns(q.sql, tables); err != nil {
+			return err
+		}
+	}
+
+	w := &g.decls
+	constName := "query" + q.name
+	writeDoc := func(name string) {
+		if len(q.doc) == 0 {
+			fmt.Fprintf(w, "// %s %s\n", name, q.name)
+		}
+		for i, line := range q.doc {
+			if i == 0 {
+				fmt.Fprintf(w, "// %s %s\n", name, line)
+			} else {
+				fmt.Fprintf(w, "// %s\n", line)
+			}
+		}
+	}
+
+	if q.kind == ":columns" {
+		if len(columns) == 0 {
+			return fmt.Errorf(":columnsはSELECTにしか使えません")
+		}
+		row := unexported(q.name)
+		if err := g.defineRow(row, columns); err != nil {
+			return err
+		}
+		selectList := q.sql[len("SELECT "):fromIndex(q.sql)]
+		fmt.Fprintf(w, "// %sColumns %sで読み込む列\n", row, row)
+		fmt.Fprintf(w, "const %sColumns = %q\n\n", row, strings.TrimSpace(selectList))
+		writeDoc(row + "Select")
+		fmt.Fprintf(w, "// 条件や並び順は後ろに付け足して使う\n")
+		fmt.Fprintf(w, "const %sSelect = %q\n\n", row, q.sql)
+		return nil
+	}
+
+	fmt.Fprintf(w, "const %s = %q\n\n", constName, q.sql)
+	writeDoc(q.name)
+
+	var signature, args []string
+	signature = append(signature, "ctx context.Context")
+	for _, p := range params {
+		signature = append(signature, p.name+" "+p.goType)
+		args = append(args, p.name)
+	}
+	callArgs := constName
+	if len(args) > 0 {
+		callArgs += ", " + strings.Join(args, ", ")
+	}
+	fmt.Fprintf(w, "func (c conn) %s(%s) ", q.name, strings.Join(signature, ", "))
+
+	switch q.kind {
+	case ":one", ":many":
+		if len(columns) == 0 {
+			return fmt.Errorf("%sはSELECTにしか使えません", q.kind)
+		}
+		// 1列だけならその値をそのまま返す
+		if len(columns) == 1 && q.rowType == "" {
+			t := columns[0].goType
+			if q.kind == ":one" {
+				fmt.Fprintf(w, "(%s, error) {\nvar v %s\nerr := c.QueryRowContext(ctx, %s).Scan(&v)\nreturn v, err\n}\n\n", t, t, callArgs)
+				return nil
+			}
+			fmt.Fprintf(w, "([]%s, error) {\nrows, err := c.QueryContext(ctx, %s)\nif err != nil {\nreturn nil, err\n}\ndefer rows.Close()\n", t, callArgs)
+			fmt.Fprintf(w, "var items []%s\nfor rows.Next() {\nvar v %s\nif err := rows.Scan(&v); err != nil {\nreturn nil, err\n}\nitems = append(items, v)\n}\nreturn items, rows.Err()\n}\n\n", t, t)
+			return nil
+		}
+		row := unexported(q.rowType)
+		if row == "" {
+			row = unexported(q.name) + "Row"
+		}
+		if err := g.defineRow(row, columns); err != nil {
+			return err
+		}
+		scan := "scan" + exported(row)
+		if q.kind == ":one" {
+			fmt.Fprintf(w, "(%s, error) {\nreturn %s(c.QueryRowContext(ctx, %s))\n}\n\n", row, scan, callArgs)
+			return nil
+		}
+		fmt.Fprintf(w, "([]%s, error) {\nrows, err := c.QueryContext(ctx, %s)\nif err != nil {\nreturn nil, err\n}\ndefer rows.Close()\n", row, callArgs)
+		fmt.Fprintf(w, "var items []%s\nfor rows.Next() {\nitem, err := %s(rows)\nif err != nil {\nreturn nil, err\n}\nitems = append(items, item)\n}\nreturn items, rows.Err()\n}\n\n", row, scan)
+	case ":exec":
+		fmt.Fprintf(w, "error {\n_, err := c.ExecContext(ctx, %s)\nreturn err\n}\n\n", callArgs)
+	case ":execrows":
+		fmt.Fprintf(w, "(int64, error) {\nres, err := c.ExecContext(ctx, %s)\nif err != nil {\nreturn 0, err\n}\nreturn res.RowsAffected()\n}\n\n", callArgs)
+	case ":insertid":
+		fmt.Fprintf(w, "(int64, error) {\nreturn c.InsertID(ctx, %s)\n}\n\n", callArgs)
+	default:
+		return fmt.Errorf("不明な種類です: %s", q.kind)
+	}
+	return nil
+}
+
+// tableRef クエリで参照するテーブル
+type tableRef struct {
+	name     string
+	nullable bool // LEFT JOINしたテーブルの列は全てNULLになり得る
+}
+
+var (
+	tableRe    = regexp.MustCompile(`(?i)\b(LEFT (?:OUTER )?JOIN|FROM|JOIN|INTO|UPDATE) (\w+)(?: (?:AS )?(\w+))?`)
+	sqlKeyword = map[string]bool{
+		"WHERE": true, "LEFT": true, "INNER": true, "JOIN": true, "ON": true, "SET": true, "ORDER": true,
+		"GROUP": true, "LIMIT": true, "VALUES": true, "SELECT": true, "OFFSET": true, "HAVING": true,
+	}
+)
+
+// tables クエリで参照するテーブルを別名から引けるようにする
+// 別名のないテーブルはテーブル名で引く
+func (g *generator) tables(sql string) (map[string]tableRef, error) {
+	refs := make(map[string]tableRef)
+	for _, m := range tableRe.FindAllStringSubmatch(sql, -1) {
+		name := m[2]
+		if _, ok := g.schema[name]; !ok {
+			return nil, fmt.Errorf("スキーマにないテーブルです: %s", name)
+		}
+		ref := tableRef{name: name, nullable: strings.HasPrefix(strings.ToUpper(m[1]), "LEFT")}
+		alias := m[3]
+		if alias == "" || sqlKeyword[strings.ToUpper(alias)] {
+			alias = name
+		}
+		refs[alias] = ref
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("テーブルが見つかりません")
+	}
+	return refs, nil
+}
+
+// lookup 「別名.列」または「列」の型を返す
+func (g *generator) lookup(ident string, tables map[string]tableRef) (column, bool, error) {
+	if alias, name, ok := strings.Cut(ident, "."); ok {
+		ref, found := tables[alias]
+		if !found {
+			return column{}, false, fmt.Errorf("テーブルの別名が見つかりません: %s", ident)
+		}
+		col, found := g.schema[ref.name][name]
+		if !found {
+			return column{}, false, fmt.Errorf("スキーマにない列です: %s.%s", ref.name, name)
+		}
+		return col, ref.nullable, nil
+	}
+	var result column
+	var nullable bool
+	found := 0
+	for _, ref := range tables {
+		if col, ok := g.schema[ref.name][ident]; ok {
+			result, nullable = col, ref.nullable
+			found++
+		}
+	}
+	switch found {
+	case 0:
+		return column{}, false, fmt.Errorf("スキーマにない列です: %s", ident)
+	case 1:
+		return result, nullable, nil
+	}
+	return column{}, false, fmt.Errorf("どのテーブルの列か分かりません: %s", ident)
+}
+
+var (
+	identRe    = regexp.MustCompile(`^\w+(?:\.\w+)?$`)
+	asRe       = regexp.MustCompile(`(?i)^(.+) AS (\w+)$`)
+	coalesceRe = regexp.MustCompile(`(?i)^COALESCE\((\w+(?:\.\w+)?), [^()]+\)$`)
+)
+
+// fromIndex トップレベルのFROMの位置を返す
+func fromIndex(sql string) int {
+	depth := 0
+	upper := strings.ToUpper(sql)
+	for i := 0; i < len(sql); i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ':
+			if depth == 0 && strings.HasPrefix(upper[i:], " FROM ") {
+				return i
+			}
+		}
+	}
+	return len(sql)
+}
+
+// splitTopLevel 括弧の外のカンマで区切る
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// selectColumns SELECTする列の名前と型を決める
+func (g *generator) selectColumns(sql string, tables map[string]tableRef) ([]field, error) {
+	var fields []field
+	seen := make(map[string]bool)
+	for _, item := range splitTopLevel(sql[len("SELECT "):fromIndex(sql)]) {
+		expr, name := item, ""
+		if m := asRe.FindStringSubmatch(item); m != nil {
+			expr, name = m[1], m[2]
+		}
+
+		var goType string
+		switch {
+		case strings.EqualFold(expr, "COUNT(*)"):
+			goType = "int"
+			if name == "" {
+				name = "count"
+			}
+		case coalesceRe.MatchString(expr):
+			// 既定値を指定しているのでNULLにはならない
+			ident := coalesceRe.FindStringSubmatch(expr)[1]
+			col, _, err := g.lookup(ident, tables)
+			if err != nil {
+				return nil, err
+			}
+			if goType, err = g.goType(col, false); err != nil {
+				return nil, err
+			}
+			if name == "" {
+				return nil, fmt.Errorf("COALESCEにはASで名前を付けてください: %s", item)
+			}
+		case identRe.MatchString(expr):
+			col, nullable, err := g.lookup(expr, tables)
+			if err != nil {
+				return nil, err
+			}
+			if goType, err = g.goType(col, nullable || !col.notNull); err != nil {
+				return nil, err
+			}
+			if name == "" {
+				_, name, _ = strings.Cut(expr, ".")
+				if name == "" {
+					name = expr
+				}
+			}
+		default:
+			return nil, fmt.Errorf("型を決められない式です(列、COUNT(*)、COALESCEのみ使えます): %s", item)
+		}
+
+		f := field{name: exported(name), goType: goType}
+		if seen[f.name] {
+			return nil, fmt.Errorf("列の名前が重複しています。ASで名前を付けてください: %s", item)
+		}
+		seen[f.name] = true
+		if strings.HasPrefix(goType, "sql.") {
+			g.usesDB = true
+		}
+		if strings.Contains(goType, "time.") {
+			g.usesT = true
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+var (
+	compareRe = regexp.MustCompile(`(\w+(?:\.\w+)?) ?(=|<>|!=|<=|>=|<|>) ?$`)
+	pagingRe  = regexp.MustCompile(`(?i)\b(LIMIT|OFFSET) $`)
+	insertRe  = regexp.MustCompile(`(?i)^INSERT INTO \w+ \(([^)]*)\) VALUES \(([^)]*)\)`)
+)
+
+// params 「?」ごとに引数の名前と型を決める
+func (g *generator) params(sql string, tables map[string]tableRef) ([]field, error) {
+	var insertColumns []string
+	valuesStart := -1
+	if m := insertRe.FindStringSubmatchIndex(sql); m != nil {
+		insertColumns = splitTopLevel(sql[m[2]:m[3]])
+		valuesStart = m[4]
+	}
+
+	var params []field
+	used := make(map[string]int)
+	insertIndex := 0
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			continue
+		}
+		before := sql[:i]
+		var ident, name, goType string
+		switch {
+		case valuesStart >= 0 && i >= valuesStart && insertIndex < len(insertColumns):
+			ident = insertColumns[insertIndex]
+			insertIndex++
+		case compareRe.MatchString(before):
+			ident = compareRe.FindStringSubmatch(before)[1]
+		case pagingRe.MatchString(before):
+			name = strings.ToLower(pagingRe.FindStringSubmatch(before)[1])
+			goType = "int"
+		default:
+			return nil, fmt.Errorf("%d番目の「?」の型を決められません: %s", len(params)+1, before)
+		}
+		if ident != "" {
+			col, _, err := g.lookup(ident, tables)
+			if err != nil {
+				return nil, err
+			}
+			if goType, err = g.goType(col, false); err != nil {
+				return nil, err
+			}
+			_, name, _ = strings.Cut(ident, ".")
+			if name == "" {
+				name = ident
+			}
+		}
+		if strings.Contains(goType, "time.") {
+			g.usesT = true
+		}
+
+		name = unexported(exported(name))
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, used[name])
+		}
+		if token.IsKeyword(name) {
+			name += "Arg"
+		}
+		params = append(params, field{name: name, goType: goType})
+	}
+	return params, nil
+}
+
+// goType 列の型に対応するGoの型を返す
+func (g *generator) goType(col column, nullable bool) (string, error) {
+	var t, null string
+	switch col.sqlType {
+	case "INT", "INTEGER", "SMALLINT", "TINYINT":
+		t, null = "int", "sql.NullInt32"
+	case "BIGINT":
+		t, null = "int64", "sql.NullInt64"
+	case "VARCHAR", "CHAR", "TEXT", "ENUM":
+		t, null = "string", "sql.NullString"
+	case "BOOLEAN", "BOOL":
+		t, null = "bool", "sql.NullBool"
+	case "DOUBLE", "FLOAT", "DECIMAL":
+		t, null = "float64", "sql.NullFloat64"
+	case "TIMESTAMP", "DATETIME":
+		t, null = "time.Time", "sql.NullTime"
+	case "JSON":
+		// NULLはnilとして読み込める
+		return "[]byte", nil
+	default:
+		return "", fmt.Errorf("対応していない列の型です: %s", col.sqlType)
+	}
+	if nullable {
+		return null, nil
+	}
+	return t, nil
+}
+
+// initialisms Goの命名で大文字にする略語
+var initialisms = map[string]bool{"id": true, "url": true, "ip": true, "json": true}
+
+// exported snake_caseをCamelCaseにする
+func exported(name string) string {
+	if name != "" && !strings.Contains(name, "_") && name[0] >= 'A' && name[0] <= 'Z' {
+		return name
+	}
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if initialisms[part] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// unexported CamelCaseの先頭の単語を小文字にする
+func unexported(name string) string {
+	if name == "" {
+		return ""
+	}
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+	for _, word := range []string{"ID", "URL", "IP", "JSON"} {
+		if strings.HasPrefix(name, word) && len(name) > len(word) && name[len(word)] >= 'A' && name[len(word)] <= 'Z' {
+			return strings.ToLower(word) + name[len(word):]
+		}
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
@@ -0,0 +1,653 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+type sqlQuestionRepository struct {
+	db conn
+}
+
+// NewSQLQuestionRepository データベースに問題を保存するQuestionRepositoryを作成する
+func NewSQLQuestionRepository(db *sql.DB) QuestionRepository {
+	return newSQLQuestionRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLQuestionRepository(db *sql.DB, dialect Dialect) QuestionRepository {
+	return &sqlQuestionRepository{db: newConn(db, dialect)}
+}
+
+// scanQuestion questionRowSelectの1行を問題として読み込む
+func scanQuestion(scanner rowScanner) (Question, error) {
+	row, err := scanQuestionRow(scanner)
+	if err != nil {
+		return Question{}, err
+	}
+	return row.question(), nil
+}
+
+func (row questionRow) question() Question {
+	q := Question{
+		ID:              row.ID,
+		CreatorUsername: row.CreatorUsername,
+		QuestionText:    row.QuestionText,
+		CorrectAnswer:   row.CorrectAnswer,
+		Choices:         []string{row.Choice1, row.Choice2, row.Choice3, row.Choice4},
+		Explanation:     row.Explanation,
+		Status:          row.Status,
+		Version:         row.Version,
+		Source:          row.Source,
+		Difficulty:      row.Difficulty,
+	}
+	if row.DifficultyScore.Valid {
+		q.DifficultyScore = &row.DifficultyScore.Float64
+	}
+	if row.ActivateAt.Valid {
+		q.ActivateAt = &row.ActivateAt.Time
+	}
+	if row.RetireAt.Valid {
+		q.RetireAt = &row.RetireAt.Time
+	}
+	return q
+}
+
+func (r *sqlQuestionRepository) Create(ctx context.Context, q Question) (int64, error) {
+	if q.Status == "" {
+		q.Status = QuestionApproved
+	}
+	if q.Source == "" {
+		q.Source = QuestionSourceAdmin
+	}
+	if q.Difficulty == "" {
+		q.Difficulty = DifficultyNormal
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.InsertID(ctx, queryCreateQuestion,
+		q.CreatorUsername, q.QuestionText, q.CorrectAnswer, q.Choices[0], q.Choices[1], q.Choices[2], q.Choices[3], q.Explanation, q.Status, q.Source, q.Difficulty,
+		nullTime(q.ActivateAt), nullTime(q.RetireAt),
+	)
+	if err != nil {
+		return 0, err
+	}
+	q.ID, q.Version = int(id), 1
+	if err := createVersion(ctx, tx, q, q.CreatorUsername); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// createVersion q.Versionの版としてqの内容を記録する
+func createVersion(ctx context.Context, tx txConn, q Question, editor string) error {
+	_, err := tx.ExecContext(ctx, queryCreateQuestionVersion,
+		q.ID, q.Version, q.QuestionText, q.CorrectAnswer, q.Choices[0], q.Choices[1], q.Choices[2], q.Choices[3], q.Explanation,
+		editor, time.Now(),
+	)
+	return err
+}
+
+// sameContent 版を分ける必要のない変更かを返す
+func sameContent(a, b Question) bool {
+	if a.QuestionText != b.QuestionText || a.CorrectAnswer != b.CorrectAnswer || a.Explanation != b.Explanation {
+		return false
+	}
+	if len(a.Choices) != len(b.Choices) {
+		return false
+	}
+	for i := range a.Choices {
+		if a.Choices[i] != b.Choices[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *sqlQuestionRepository) Get(ctx context.Context, id int) (Question, error) {
+	row, err := r.db.GetQuestion(ctx, id)
+	if err == sql.ErrNoRows {
+		return Question{}, ErrNotFound
+	}
+	if err != nil {
+		return Question{}, err
+	}
+	q := row.question()
+	return q, r.attachLabelsOf(ctx, &q)
+}
+
+// attachLabels 読み込んだ問題にカテゴリーとタグの名前、入っているプールを設定する
+// 一覧の読み込みでは問題ごとに問い合わせず、全ての紐付けをまとめて読み込む
+func (r *sqlQuestionRepository) attachLabels(ctx context.Context, questions []Question) error {
+	if len(questions) == 0 {
+		return nil
+	}
+	categories, err := r.db.ListQuestionCategoryNames(ctx)
+	if err != nil {
+		return err
+	}
+	tags, err := r.db.ListQuestionTagNames(ctx)
+	if err != nil {
+		return err
+	}
+	members, err := r.db.ListQuestionPoolMembers(ctx)
+	if err != nil {
+		return err
+	}
+	categoryNames, tagNames, poolIDs := labelNames(categories), labelNames(tags), memberPools(members)
+	for i := range questions {
+		questions[i].Categories = append([]string{}, categoryNames[questions[i].ID]...)
+		questions[i].Tags = append([]string{}, tagNames[questions[i].ID]...)
+		questions[i].PoolIDs = append([]int{}, poolIDs[questions[i].ID]...)
+	}
+	return nil
+}
+
+// attachLabelsOf 1問にカテゴリーとタグの名前、入っているプールを設定する
+func (r *sqlQuestionRepository) attachLabelsOf(ctx context.Context, q *Question) error {
+	categories, err := r.db.GetQuestionCategoryNames(ctx, q.ID)
+	if err != nil {
+		return err
+	}
+	tags, err := r.db.GetQuestionTagNames(ctx, q.ID)
+	if err != nil {
+		return err
+	}
+	q.Categories = append([]string{}, labelNames(categories)[q.ID]...)
+	q.Tags = append([]string{}, labelNames(tags)[q.ID]...)
+	members, err := r.db.GetQuestionPoolMembers(ctx, q.ID)
+	if err != nil {
+		return err
+	}
+	q.PoolIDs = append([]int{}, memberPools(members)[q.ID]...)
+	return nil
+}
+
+// labelNames 紐付けの行を問題IDごとの名前の一覧にする
+func labelNames(rows []questionLabelRow) map[int][]string {
+	names := make(map[int][]string)
+	for _, row := range rows {
+		names[row.QuestionID] = append(names[row.QuestionID], row.Name)
+	}
+	return names
+}
+
+// memberPools プールの中身の行を問題IDごとのプールIDの一覧にする
+func memberPools(rows []questionPoolMemberRow) map[int][]int {
+	pools := make(map[int][]int)
+	for _, row := range rows {
+		pools[row.QuestionID] = append(pools[row.QuestionID], row.PoolID)
+	}
+	return pools
+}
+
+func (r *sqlQuestionRepository) AddToPool(ctx context.Context, poolID int, questionIDs []int) error {
+	if _, err := r.db.GetQuestionPool(ctx, poolID); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	for _, id := range questionIDs {
+		if _, err := r.db.GetQuestion(ctx, id); err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range questionIDs {
+		var exists int
+		if err := tx.QueryRowContext(ctx, queryQuestionPoolMemberExists, poolID, id).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, queryAddQuestionPoolMember, poolID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlQuestionRepository) RemoveFromPool(ctx context.Context, poolID, questionID int) error {
+	return changed(r.db.RemoveQuestionPoolMember(ctx, poolID, questionID))
+}
+
+func (r *sqlQuestionRepository) SetLabels(ctx context.Context, id int, categoryIDs, tagIDs []int) error {
+	if _, err := r.db.GetQuestion(ctx, id); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	links := []struct {
+		clear, add string
+		ids        []int
+	}{
+		{queryClearQuestionCategories, queryAddQuestionCategory, categoryIDs},
+		{queryClearQuestionTags, queryAddQuestionTag, tagIDs},
+	}
+	for _, link := range links {
+		if _, err := tx.ExecContext(ctx, link.clear, id); err != nil {
+			return err
+		}
+		added := make(map[int]bool, len(link.ids))
+		for _, labelID := range link.ids {
+			if added[labelID] {
+				continue
+			}
+			added[labelID] = true
+			if _, err := tx.ExecContext(ctx, link.add, id, labelID); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlQuestionRepository) Update(ctx context.Context, q Question, editor string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := scanQuestion(tx.QueryRowContext(ctx, queryGetQuestion, q.ID))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if sameContent(current, q) {
+		return nil
+	}
+
+	q.Version = current.Version + 1
+	result, err := tx.ExecContext(ctx, queryUpdateQuestion,
+		q.QuestionText, q.CorrectAnswer, q.Choices[0], q.Choices[1], q.Choices[2], q.Choices[3], q.Explanation,
+		q.Version, q.ID, current.Version,
+	)
+	if err != nil {
+		return err
+	}
+	if err := changed(result.RowsAffected()); err != nil {
+		return err
+	}
+	if err := createVersion(ctx, tx, q, editor); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlQuestionRepository) Versions(ctx context.Context, id int) ([]QuestionVersion, error) {
+	rows, err := r.db.ListQuestionVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]QuestionVersion, len(rows))
+	for i, row := range rows {
+		versions[i] = QuestionVersion{
+			Version:       row.Version,
+			QuestionText:  row.QuestionText,
+			CorrectAnswer: row.CorrectAnswer,
+			Choices:       []string{row.Choice1, row.Choice2, row.Choice3, row.Choice4},
+			Explanation:   row.Explanation,
+			Editor:        row.Editor,
+			CreatedAt:     row.CreatedAt.Time,
+		}
+	}
+	return versions, nil
+}
+
+func (r *sqlQuestionRepository) List(ctx context.Context) ([]Question, error) {
+	return r.list(ctx, "deleted_at IS NULL")
+}
+
+func (r *sqlQuestionRepository) ListDeleted(ctx context.Context) ([]Question, error) {
+	return r.list(ctx, "deleted_at IS NOT NULL")
+}
+
+func (r *sqlQuestionRepository) ListByStatus(ctx context.Context, status string) ([]Question, error) {
+	rows, err := r.db.ListQuestionsByStatus(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	questions := make([]Question, len(rows))
+	for i, row := range rows {
+		questions[i] = row.question()
+	}
+	return questions, r.attachLabels(ctx, questions)
+}
+
+func (r *sqlQuestionRepository) ListSubmissions(ctx context.Context, username string) ([]Question, error) {
+	rows, err := r.db.ListQuestionsByCreator(ctx, username, QuestionSourceCommunity)
+	if err != nil {
+		return nil, err
+	}
+	questions := make([]Question, len(rows))
+	for i, row := range rows {
+		questions[i] = row.question()
+	}
+	return questions, r.attachLabels(ctx, questions)
+}
+
+func (r *sqlQuestionRepository) CountSubmissionsSince(ctx context.Context, username string, since time.Time) (int, error) {
+	return r.db.CountSubmissionsSince(ctx, username, QuestionSourceCommunity, since)
+}
+
+func (r *sqlQuestionRepository) Contributors(ctx context.Context, limit int) ([]Contributor, error) {
+	rows, err := r.db.TopContributors(ctx, QuestionSourceCommunity, QuestionApproved, limit)
+	if err != nil {
+		return nil, err
+	}
+	contributors := make([]Contributor, len(rows))
+	for i, row := range rows {
+		contributors[i] = Contributor{Username: row.CreatorUsername, ApprovedCount: row.ApprovedCount}
+	}
+	return contributors, nil
+}
+
+func (r *sqlQuestionRepository) SetStatus(ctx context.Context, review QuestionReview) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, querySetQuestionStatus, review.Status, review.QuestionID, review.FromStatus)
+	if err != nil {
+		return err
+	}
+	if err := changed(result.RowsAffected()); err != nil {
+		return err
+	}
+	if review.CreatedAt.IsZero() {
+		review.CreatedAt = time.Now()
+	}
+	if _, err := tx.ExecContext(ctx, queryCreateQuestionReview,
+		review.QuestionID, review.Reviewer, review.FromStatus, review.Status, review.Comment, review.CreatedAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlQuestionRepository) Reviews(ctx context.Context, id int) ([]QuestionReview, error) {
+	rows, err := r.db.ListQuestionReviews(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	reviews := make([]QuestionReview, len(rows))
+	for i, row := range rows {
+		reviews[i] = QuestionReview{
+			ID:         row.ID,
+			QuestionID: row.QuestionID,
+			Reviewer:   row.Reviewer,
+			FromStatus: row.FromStatus,
+			Status:     row.Status,
+			Comment:    row.Comment,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+	}
+	return reviews, nil
+}
+
+func (r *sqlQuestionRepository) list(ctx context.Context, condition string) ([]Question, error) {
+	rows, err := r.db.QueryContext(ctx, questionRowSelect+" WHERE "+condition+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []Question
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return questions, r.attachLabels(ctx, questions)
+}
+
+// filterWhere 出題できる問題のうちfilterに当てはまるものを選ぶWHERE句と引数を返す
+func filterWhere(filter QuestionFilter) (string, []interface{}) {
+	where := " WHERE deleted_at IS NULL AND status = ?"
+	args := []interface{}{QuestionApproved}
+	if filter.Difficulty != "" {
+		where += " AND difficulty = ?"
+		args = append(args, filter.Difficulty)
+	}
+	if filter.PoolID != 0 {
+		where += " AND id IN (SELECT question_id FROM question_pool_members WHERE pool_id = ?)"
+		args = append(args, filter.PoolID)
+	}
+	if len(filter.Exclude) > 0 {
+		placeholders := make([]string, len(filter.Exclude))
+		for i, id := range filter.Exclude {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		where += " AND id NOT IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	return where, args
+}
+
+func (r *sqlQuestionRepository) Count(ctx context.Context, filter QuestionFilter) (int, error) {
+	where, args := filterWhere(filter)
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM questions"+where, args...).Scan(&count)
+	return count, err
+}
+
+func (r *sqlQuestionRepository) Random(ctx context.Context, filter QuestionFilter) (Question, error) {
+	where, args := filterWhere(filter)
+
+	query := questionRowSelect + where
+	if order := r.db.dialect.RandomOrder(); order != "" {
+		query += " ORDER BY " + order + " LIMIT 1"
+	} else {
+		// 乱数の関数を使わずに、残っている問題の件数から無作為に位置を選ぶ
+		var count int
+		if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM questions"+where, args...).Scan(&count); err != nil {
+			return Question{}, err
+		}
+		if count == 0 {
+			return Question{}, ErrNotFound
+		}
+		query += " ORDER BY id LIMIT 1 OFFSET ?"
+		args = append(args, rand.Intn(count))
+	}
+
+	q, err := scanQuestion(r.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return Question{}, ErrNotFound
+	}
+	if err != nil {
+		return Question{}, err
+	}
+	return q, r.attachLabelsOf(ctx, &q)
+}
+
+func (r *sqlQuestionRepository) Sample(ctx context.Context, filter QuestionFilter, n int) ([]Question, error) {
+	where, args := filterWhere(filter)
+	columns := strings.TrimSuffix(strings.TrimPrefix(questionRowSelect, "SELECT "), " FROM questions")
+
+	var query string
+	if order := r.db.dialect.RandomOrder(); order != "" {
+		// 難易度ごとに無作為に番号を振り、それぞれn番目までを1回のクエリで取得する
+		query = "SELECT " + columns + " FROM (SELECT " + columns + ", ROW_NUMBER() OVER (PARTITION BY difficulty ORDER BY " + order + ") AS pick FROM questions" + where + ") sampled WHERE pick <= ?"
+		args = append(args, n)
+	} else {
+		// 乱数の関数を使わずに、当てはまる問題のIDから無作為に選んでから読み込む
+		ids, err := r.sampleIDs(ctx, where, args, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		placeholders := make([]string, len(ids))
+		args = args[:0]
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query = questionRowSelect + " WHERE id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []Question
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// 全ての紐付けを読み込むattachLabelsより、選んだ問題の分だけ読み込む方が少なく済む
+	for i := range questions {
+		if err := r.attachLabelsOf(ctx, &questions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return questions, nil
+}
+
+// sampleIDs whereに当てはまる問題のIDを、難易度ごとに最大n個ずつ無作為に選ぶ
+func (r *sqlQuestionRepository) sampleIDs(ctx context.Context, where string, args []interface{}, n int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, difficulty FROM questions"+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDifficulty := map[string][]int{}
+	for rows.Next() {
+		var id int
+		var difficulty string
+		if err := rows.Scan(&id, &difficulty); err != nil {
+			return nil, err
+		}
+		byDifficulty[difficulty] = append(byDifficulty[difficulty], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, candidates := range byDifficulty {
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		ids = append(ids, candidates[:min(n, len(candidates))]...)
+	}
+	return ids, nil
+}
+
+func (r *sqlQuestionRepository) SetDifficulty(ctx context.Context, id int, difficulty string, score float64) error {
+	return changed(r.db.UpdateQuestionDifficulty(ctx, difficulty, score, id))
+}
+
+func (r *sqlQuestionRepository) SetSchedule(ctx context.Context, id int, activateAt, retireAt *time.Time) error {
+	// 生成したメソッドはNULLを渡せないので、クエリを直接実行する
+	result, err := r.db.ExecContext(ctx, queryUpdateQuestionSchedule, nullTime(activateAt), nullTime(retireAt), id)
+	if err != nil {
+		return err
+	}
+	return changed(result.RowsAffected())
+}
+
+// nullTime nilの日時をNULLとして保存する
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func (r *sqlQuestionRepository) Delete(ctx context.Context, id int) error {
+	return changed(r.db.DeleteQuestion(ctx, time.Now(), id))
+}
+
+func (r *sqlQuestionRepository) Restore(ctx context.Context, id int) error {
+	return changed(r.db.RestoreQuestion(ctx, id))
+}
+
+// changed 1行も変更しなかった場合はErrNotFoundを返す
+func changed(n int64, err error) error {
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (row questionStatsRow) stats() QuestionStats {
+	stats := QuestionStats{
+		QuestionID:    row.ID,
+		QuestionText:  row.QuestionText,
+		TimesShown:    row.TimesShown,
+		TimesAnswered: row.TimesAnswered,
+		TimesCorrect:  row.TimesCorrect,
+	}
+	if stats.TimesAnswered > 0 {
+		stats.CorrectRate = float64(stats.TimesCorrect) / float64(stats.TimesAnswered)
+		stats.AvgAnswerMs = float64(row.TotalAnswerMs) / float64(stats.TimesAnswered)
+	}
+	return stats
+}
+
+func (r *sqlQuestionRepository) Stats(ctx context.Context) ([]QuestionStats, error) {
+	rows, err := r.db.ListQuestionStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]QuestionStats, len(rows))
+	for i, row := range rows {
+		list[i] = row.stats()
+	}
+	return list, nil
+}
+
+func (r *sqlQuestionRepository) StatsByID(ctx context.Context, id int) (QuestionStats, error) {
+	row, err := r.db.GetQuestionStats(ctx, id)
+	if err == sql.ErrNoRows {
+		return QuestionStats{}, ErrNotFound
+	}
+	if err != nil {
+		return QuestionStats{}, err
+	}
+	return row.stats(), nil
+}
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultQuestionCacheTTL 問題のキャッシュを読み込み直すまでの時間のデフォルト
+// 他のサーバーで追加された問題もこの時間が経てば出題される
+const DefaultQuestionCacheTTL = 5 * time.Minute
+
+// cachedQuestionRepository 問題を全てメモリに読み込んでおくQuestionRepository
+// 対戦中は1問ごとに問題を取得するため、データベースへの問い合わせを減らす
+// 問題を追加・変更したときはキャッシュを破棄し、次の取得時に読み込み直す
+type cachedQuestionRepository struct {
+	next QuestionRepository
+	ttl  time.Duration
+
+	mu       sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	items    []Question
+	live     []Question // itemsのうち出題できる承認済みの問題
+}
+
+// NewCachedQuestionRepository nextの問題をメモリに保持するQuestionRepositoryを作成する
+// ttlが0以下の場合はDefaultQuestionCacheTTLを使う
+func NewCachedQuestionRepository(next QuestionRepository, ttl time.Duration) QuestionRepository {
+	if ttl <= 0 {
+		ttl = DefaultQuestionCacheTTL
+	}
+	return &cachedQuestionRepository{next: next, ttl: ttl}
+}
+
+// snapshot キャッシュしている全ての問題と出題できる問題を返す。期限切れや未読み込みの場合は読み込み直す
+// 返したスライスは書き換えないこと
+func (r *cachedQuestionRepository) snapshot(ctx context.Context) (items, live []Question, err error) {
+	r.mu.RLock()
+	if r.loaded && time.Since(r.loadedAt) < r.ttl {
+		items, live = r.items, r.live
+		r.mu.RUnlock()
+		return items, live, nil
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 待っている間に他のゴルーチンが読み込んだ場合はそれを使う
+	if r.loaded && time.Since(r.loadedAt) < r.ttl {
+		return r.items, r.live, nil
+	}
+	items, err = r.next.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, q := range items {
+		if q.Status == QuestionApproved {
+			live = append(live, q)
+		}
+	}
+	r.items = items
+	r.live = live
+	r.loaded = true
+	r.loadedAt = time.Now()
+	return items, live, nil
+}
+
+// Invalidate キャッシュを破棄し、次の取得時に読み込み直させる
+func (r *cachedQuestionRepository) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loaded = false
+	r.items = nil
+	r.live = nil
+}
+
+func (r *cachedQuestionRepository) Create(ctx context.Context, q Question) (int64, error) {
+	id, err := r.next.Create(ctx, q)
+	if err == nil {
+		r.Invalidate()
+	}
+	return id, err
+}
+
+func (r *cachedQuestionRepository) Update(ctx context.Context, q Question, editor string) error {
+	err := r.next.Update(ctx, q, editor)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) Versions(ctx context.Context, id int) ([]QuestionVersion, error) {
+	return r.next.Versions(ctx, id)
+}
+
+// Get 編集の直前に読み込むので、他のサーバーでの変更も反映した最新の内容を返す
+func (r *cachedQuestionRepository) Get(ctx context.Context, id int) (Question, error) {
+	return r.next.Get(ctx, id)
+}
+
+func (r *cachedQuestionRepository) Delete(ctx context.Context, id int) error {
+	err := r.next.Delete(ctx, id)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) Restore(ctx context.Context, id int) error {
+	err := r.next.Restore(ctx, id)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+// ListDeleted 管理画面でしか使わないのでキャッシュしない
+func (r *cachedQuestionRepository) ListDeleted(ctx context.Context) ([]Question, error) {
+	return r.next.ListDeleted(ctx)
+}
+
+// ListByStatus 審査の画面でしか使わないのでキャッシュしない
+func (r *cachedQuestionRepository) ListByStatus(ctx context.Context, status string) ([]Question, error) {
+	return r.next.ListByStatus(ctx, status)
+}
+
+func (r *cachedQuestionRepository) ListSubmissions(ctx context.Context, username string) ([]Question, error) {
+	return r.next.ListSubmissions(ctx, username)
+}
+
+func (r *cachedQuestionRepository) CountSubmissionsSince(ctx context.Context, username string, since time.Time) (int, error) {
+	return r.next.CountSubmissionsSince(ctx, username, since)
+}
+
+func (r *cachedQuestionRepository) Contributors(ctx context.Context, limit int) ([]Contributor, error) {
+	return r.next.Contributors(ctx, limit)
+}
+
+// SetStatus 承認・却下で出題する問題が変わるのでキャッシュを破棄する
+func (r *cachedQuestionRepository) SetStatus(ctx context.Context, review QuestionReview) error {
+	err := r.next.SetStatus(ctx, review)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) Reviews(ctx context.Context, id int) ([]QuestionReview, error) {
+	return r.next.Reviews(ctx, id)
+}
+
+func (r *cachedQuestionRepository) SetLabels(ctx context.Context, id int, categoryIDs, tagIDs []int) error {
+	err := r.next.SetLabels(ctx, id, categoryIDs, tagIDs)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) AddToPool(ctx context.Context, poolID int, questionIDs []int) error {
+	err := r.next.AddToPool(ctx, poolID, questionIDs)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) RemoveFromPool(ctx context.Context, poolID, questionID int) error {
+	err := r.next.RemoveFromPool(ctx, poolID, questionID)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) SetDifficulty(ctx context.Context, id int, difficulty string, score float64) error {
+	err := r.next.SetDifficulty(ctx, id, difficulty, score)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+func (r *cachedQuestionRepository) SetSchedule(ctx context.Context, id int, activateAt, retireAt *time.Time) error {
+	err := r.next.SetSchedule(ctx, id, activateAt, retireAt)
+	if err == nil {
+		r.Invalidate()
+	}
+	return err
+}
+
+// Stats 集計は対戦のたびに変わるのでキャッシュしない
+func (r *cachedQuestionRepository) Stats(ctx context.Context) ([]QuestionStats, error) {
+	return r.next.Stats(ctx)
+}
+
+func (r *cachedQuestionRepository) StatsByID(ctx context.Context, id int) (QuestionStats, error) {
+	return r.next.StatsByID(ctx, id)
+}
+
+func (r *cachedQuestionRepository) List(ctx context.Context) ([]Question, error) {
+	items, _, err := r.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 呼び出し側が書き換えてもキャッシュに影響しないようにコピーを返す
+	return append([]Question(nil), items...), nil
+}
+
+func (r *cachedQuestionRepository) Count(ctx context.Context, filter QuestionFilter) (int, error) {
+	_, items, err := r.snapshot(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(matching(items, filter)), nil
+}
+
+func (r *cachedQuestionRepository) Random(ctx context.Context, filter QuestionFilter) (Question, error) {
+	_, items, err := r.snapshot(ctx)
+	if err != nil {
+		return Question{}, err
+	}
+	candidates := matching(items, filter)
+	if len(candidates) == 0 {
+		return Question{}, ErrNotFound
+	}
+	return items[candidates[rand.Intn(len(candidates))]], nil
+}
+
+func (r *cachedQuestionRepository) Sample(ctx context.Context, filter QuestionFilter, n int) ([]Question, error) {
+	_, items, err := r.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidates := matching(items, filter)
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	picked := map[string]int{}
+	var sampled []Question
+	for _, i := range candidates {
+		if picked[items[i].Difficulty] < n {
+			picked[items[i].Difficulty]++
+			sampled = append(sampled, items[i])
+		}
+	}
+	return sampled, nil
+}
+
+// matching itemsのうちfilterに当てはまる問題の位置を返す
+func matching(items []Question, filter QuestionFilter) []int {
+	excluded := make(map[int]bool, len(filter.Exclude))
+	for _, id := range filter.Exclude {
+		excluded[id] = true
+	}
+	candidates := make([]int, 0, len(items))
+	for i, q := range items {
+		if excluded[q.ID] || (filter.Difficulty != "" && q.Difficulty != filter.Difficulty) {
+			continue
+		}
+		if filter.PoolID != 0 && !slices.Contains(q.PoolIDs, filter.PoolID) {
+			continue
+		}
+		candidates = append(candidates, i)
+	}
+	return candidates
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlPoolRepository struct {
+	db conn
+}
+
+// NewSQLPoolRepository データベースに問題のプールを保存するPoolRepositoryを作成する
+func NewSQLPoolRepository(db *sql.DB) PoolRepository {
+	return newSQLPoolRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLPoolRepository(db *sql.DB, dialect Dialect) PoolRepository {
+	return &sqlPoolRepository{db: newConn(db, dialect)}
+}
+
+// questionCounts プールごとの出題できる問題の数を返す
+func (r *sqlPoolRepository) questionCounts(ctx context.Context) (map[int]int, error) {
+	counts, err := r.db.CountPoolQuestions(ctx, QuestionApproved)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]int, len(counts))
+	for _, c := range counts {
+		byID[c.PoolID] = c.QuestionCount
+	}
+	return byID, nil
+}
+
+func (r *sqlPoolRepository) Pools(ctx context.Context) ([]QuestionPool, error) {
+	rows, err := r.db.ListQuestionPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := r.questionCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pools := make([]QuestionPool, len(rows))
+	for i, row := range rows {
+		pools[i] = QuestionPool{ID: row.ID, Name: row.Name, Description: row.Description, QuestionCount: counts[row.ID]}
+	}
+	return pools, nil
+}
+
+func (r *sqlPoolRepository) GetPool(ctx context.Context, id int) (QuestionPool, error) {
+	row, err := r.db.GetQuestionPool(ctx, id)
+	if err == sql.ErrNoRows {
+		return QuestionPool{}, ErrNotFound
+	}
+	if err != nil {
+		return QuestionPool{}, err
+	}
+	counts, err := r.questionCounts(ctx)
+	if err != nil {
+		return QuestionPool{}, err
+	}
+	return QuestionPool{ID: row.ID, Name: row.Name, Description: row.Description, QuestionCount: counts[row.ID]}, nil
+}
+
+func (r *sqlPoolRepository) CreatePool(ctx context.Context, p QuestionPool) (int, error) {
+	taken, err := r.db.QuestionPoolNameTaken(ctx, p.Name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		return 0, ErrConflict
+	}
+	id, err := r.db.CreateQuestionPool(ctx, p.Name, p.Description)
+	return int(id), err
+}
+
+func (r *sqlPoolRepository) UpdatePool(ctx context.Context, p QuestionPool) error {
+	if _, err := r.db.GetQuestionPool(ctx, p.ID); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	taken, err := r.db.QuestionPoolNameTaken(ctx, p.Name, p.ID)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrConflict
+	}
+	_, err = r.db.UpdateQuestionPool(ctx, p.Name, p.Description, p.ID)
+	return err
+}
+
+func (r *sqlPoolRepository) DeletePool(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, queryDeleteQuestionPoolMembers, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, queryClearSeasonQuestionPool, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, queryDeleteQuestionPool, id)
+	if err != nil {
+		return err
+	}
+	if err := changed(result.RowsAffected()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlRatingRepository struct {
+	db conn
+}
+
+// NewSQLRatingRepository データベースのレートを参照するRatingRepositoryを作成する
+func NewSQLRatingRepository(db *sql.DB) RatingRepository {
+	return newSQLRatingRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLRatingRepository(db *sql.DB, dialect Dialect) RatingRepository {
+	return &sqlRatingRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlRatingRepository) Rating(ctx context.Context, username, gameType string) (int, bool, error) {
+	rating, err := r.db.GetRating(ctx, username, gameType)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return rating, true, nil
+}
+
+func (r *sqlRatingRepository) Top(ctx context.Context, gameType string, limit int) ([]PlayerRating, error) {
+	rows, err := r.db.TopRatings(ctx, gameType, limit)
+	if err != nil {
+		return nil, err
+	}
+	var players []PlayerRating
+	for _, row := range rows {
+		players = append(players, PlayerRating{Username: row.Username, Rating: row.Rating})
+	}
+	return players, nil
+}
+
+func (r *sqlRatingRepository) Leaderboard(ctx context.Context, gameType string) ([]PlayerRating, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT username, rating FROM player_ratings WHERE game_type = ? ORDER BY rating DESC, username",
+		gameType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []PlayerRating
+	for rows.Next() {
+		var p PlayerRating
+		if err := rows.Scan(&p.Username, &p.Rating); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+func (r *sqlRatingRepository) PlayerRatings(ctx context.Context, username string) ([]PlayerGameRating, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT game_type, rating, tier, current_streak, best_streak FROM player_ratings WHERE username = ? ORDER BY game_type",
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []PlayerGameRating{}
+	for rows.Next() {
+		var rating PlayerGameRating
+		var tier sql.NullString
+		if err := rows.Scan(&rating.GameType, &rating.Rating, &tier, &rating.CurrentStreak, &rating.BestStreak); err != nil {
+			return nil, err
+		}
+		rating.Tier = tier.String
+		ratings = append(ratings, rating)
+	}
+	return ratings, rows.Err()
+}
+
+func (r *sqlRatingRepository) PlayerStats(ctx context.Context, username string) ([]PlayerGameStats, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT game_type, games_played, wins, losses, draws, total_score, buzzes, correct_answers, total_buzz_ms
+		FROM player_stats WHERE username = ? ORDER BY game_type`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []PlayerGameStats{}
+	for rows.Next() {
+		var s PlayerGameStats
+		if err := rows.Scan(&s.GameType, &s.GamesPlayed, &s.Wins, &s.Losses, &s.Draws,
+			&s.TotalScore, &s.Buzzes, &s.CorrectAnswers, &s.TotalBuzzMs); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// FavoriteCategory 複数のカテゴリーに属する問題は、それぞれのカテゴリーで1回と数える
+// 回答した数が同じカテゴリーは名前の順で先のものを返す
+func (r *sqlRatingRepository) FavoriteCategory(ctx context.Context, username string) (string, error) {
+	var name string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT c.name
+		FROM match_answers a
+		JOIN question_categories qc ON qc.question_id = a.question_id
+		JOIN categories c ON c.id = qc.category_id
+		WHERE a.player_id = ?
+		GROUP BY c.id, c.name
+		ORDER BY COUNT(*) DESC, c.name
+		LIMIT 1`,
+		username,
+	).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+func (r *sqlRatingRepository) SmurfFlags(ctx context.Context, gameType string) ([]SmurfFlag, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT username, game_type, games, win_rate, avg_answer_ms, bracket_answer_ms, flagged_at
+		FROM smurf_flags
+		WHERE game_type = ?
+		ORDER BY flagged_at DESC`,
+		gameType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []SmurfFlag{}
+	for rows.Next() {
+		var flag SmurfFlag
+		var avgAnswer, bracketAnswer sql.NullFloat64
+		if err := rows.Scan(&flag.Username, &flag.GameType, &flag.Games, &flag.WinRate, &avgAnswer, &bracketAnswer, &flag.FlaggedAt); err != nil {
+			return nil, err
+		}
+		flag.AvgAnswerMs = avgAnswer.Float64
+		flag.BracketAnswerMs = bracketAnswer.Float64
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
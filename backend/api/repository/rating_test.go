@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFavoriteCategory(t *testing.T) {
+	db := openSQLite(t)
+	ratings := newSQLRatingRepository(db, DialectFor(DriverSQLite))
+	ctx := context.Background()
+
+	if favorite, err := ratings.FavoriteCategory(ctx, "alice"); err != nil || favorite != "" {
+		t.Errorf("before answering: FavoriteCategory = %q, %v, want empty", favorite, err)
+	}
+
+	statements := []string{
+		"INSERT INTO categories (id, name, description) VALUES (1, 'History', ''), (2, 'Science', '')",
+		"INSERT INTO question_categories (question_id, category_id) VALUES (10, 1), (11, 2), (12, 2)",
+		"INSERT INTO matches (id, player1_id, player2_id, player1_score, player2_score) VALUES (1, 'alice', 'bob', 1, 2)",
+		// aliceが回答したのはHistoryの問題が2問、Scienceの問題が1問。bobの回答は数えない
+		"INSERT INTO match_answers (match_id, question_no, question_id, player_id, answer, correct) VALUES " +
+			"(1, 1, 10, 'alice', 'a', TRUE), (1, 2, 11, 'bob', 'b', TRUE), (1, 3, 12, 'bob', 'c', TRUE), (1, 4, 10, 'alice', 'd', FALSE), (1, 5, 11, 'alice', 'e', TRUE)",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if favorite, err := ratings.FavoriteCategory(ctx, "alice"); err != nil || favorite != "History" {
+		t.Errorf("alice: FavoriteCategory = %q, %v, want History", favorite, err)
+	}
+	if favorite, err := ratings.FavoriteCategory(ctx, "bob"); err != nil || favorite != "Science" {
+		t.Errorf("bob: FavoriteCategory = %q, %v, want Science", favorite, err)
+	}
+}
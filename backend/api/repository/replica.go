@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"sys3/api/logging"
+	"time"
+)
+
+// DefaultReplicaRetryAfter 読み取り用のデータベースでエラーが起きてから、次に使ってみるまでの時間
+const DefaultReplicaRetryAfter = 30 * time.Second
+
+// Replica 読み取りに使う複製のデータベース
+// 接続できない間はプライマリで読み取り、RetryAfterが経ったら再び使ってみる
+// nilのReplicaは常に使えないものとして扱う
+type Replica struct {
+	DB         *sql.DB
+	RetryAfter time.Duration
+
+	downUntil atomic.Int64 // UnixNano。この時刻まではプライマリを使う
+}
+
+// NewReplica 読み取り用のデータベースを作成する
+func NewReplica(db *sql.DB) *Replica {
+	return &Replica{DB: db, RetryAfter: DefaultReplicaRetryAfter}
+}
+
+// Available 読み取り用のデータベースを使える状態かを返す
+func (r *Replica) Available() bool {
+	return r != nil && time.Now().UnixNano() >= r.downUntil.Load()
+}
+
+// Fallback 読み取り用のデータベースで起きたエラーが、プライマリで読み直すべきものかを返す
+// データが見つからない場合や呼び出し元のキャンセルはプライマリでも同じ結果になるのでfalse
+// trueを返した場合はRetryAfterの間、読み取り用のデータベースを使わない
+func (r *Replica) Fallback(err error) bool {
+	if r == nil || err == nil || errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	retryAfter := r.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = DefaultReplicaRetryAfter
+	}
+	r.downUntil.Store(time.Now().Add(retryAfter).UnixNano())
+	slog.Warn("読み取り用のデータベースでエラーが発生したため、しばらくプライマリで読み取ります", "retry_after", retryAfter, logging.Err(err))
+	return true
+}
+
+// readFrom 読み取り用のデータベースが使えればreplicaで、使えないか失敗した場合はprimaryで読み取る
+func readFrom[T any](r *Replica, replica, primary func() (T, error)) (T, error) {
+	if r.Available() {
+		v, err := replica()
+		if !r.Fallback(err) {
+			return v, err
+		}
+	}
+	return primary()
+}
+
+// replicaQuestionRepository 問題の読み取りを読み取り用のデータベースで行うQuestionRepository
+// 書き込みは常にプライマリで行う
+type replicaQuestionRepository struct {
+	primary QuestionRepository
+	replica QuestionRepository
+	r       *Replica
+}
+
+func (q *replicaQuestionRepository) Create(ctx context.Context, question Question) (int64, error) {
+	return q.primary.Create(ctx, question)
+}
+
+// Get 編集の直前に読み込むので、複製の遅れの影響を受けないようプライマリで読み取る
+func (q *replicaQuestionRepository) Get(ctx context.Context, id int) (Question, error) {
+	return q.primary.Get(ctx, id)
+}
+
+func (q *replicaQuestionRepository) Update(ctx context.Context, question Question, editor string) error {
+	return q.primary.Update(ctx, question, editor)
+}
+
+// Versions 編集の直後に参照されるのでプライマリで読み取る
+func (q *replicaQuestionRepository) Versions(ctx context.Context, id int) ([]QuestionVersion, error) {
+	return q.primary.Versions(ctx, id)
+}
+
+func (q *replicaQuestionRepository) List(ctx context.Context) ([]Question, error) {
+	return readFrom(q.r,
+		func() ([]Question, error) { return q.replica.List(ctx) },
+		func() ([]Question, error) { return q.primary.List(ctx) })
+}
+
+func (q *replicaQuestionRepository) Count(ctx context.Context, filter QuestionFilter) (int, error) {
+	return readFrom(q.r,
+		func() (int, error) { return q.replica.Count(ctx, filter) },
+		func() (int, error) { return q.primary.Count(ctx, filter) })
+}
+
+func (q *replicaQuestionRepository) Random(ctx context.Context, filter QuestionFilter) (Question, error) {
+	return readFrom(q.r,
+		func() (Question, error) { return q.replica.Random(ctx, filter) },
+		func() (Question, error) { return q.primary.Random(ctx, filter) })
+}
+
+func (q *replicaQuestionRepository) Sample(ctx context.Context, filter QuestionFilter, n int) ([]Question, error) {
+	return readFrom(q.r,
+		func() ([]Question, error) { return q.replica.Sample(ctx, filter, n) },
+		func() ([]Question, error) { return q.primary.Sample(ctx, filter, n) })
+}
+
+func (q *replicaQuestionRepository) Delete(ctx context.Context, id int) error {
+	return q.primary.Delete(ctx, id)
+}
+
+func (q *replicaQuestionRepository) Restore(ctx context.Context, id int) error {
+	return q.primary.Restore(ctx, id)
+}
+
+func (q *replicaQuestionRepository) ListDeleted(ctx context.Context) ([]Question, error) {
+	return readFrom(q.r,
+		func() ([]Question, error) { return q.replica.ListDeleted(ctx) },
+		func() ([]Question, error) { return q.primary.ListDeleted(ctx) })
+}
+
+func (q *replicaQuestionRepository) ListByStatus(ctx context.Context, status string) ([]Question, error) {
+	return readFrom(q.r,
+		func() ([]Question, error) { return q.replica.ListByStatus(ctx, status) },
+		func() ([]Question, error) { return q.primary.ListByStatus(ctx, status) })
+}
+
+// ListSubmissions 投稿の直後に参照されるのでプライマリで読み取る
+func (q *replicaQuestionRepository) ListSubmissions(ctx context.Context, username string) ([]Question, error) {
+	return q.primary.ListSubmissions(ctx, username)
+}
+
+// CountSubmissionsSince 投稿数の制限に使うので、複製の遅れで制限をすり抜けないようプライマリで数える
+func (q *replicaQuestionRepository) CountSubmissionsSince(ctx context.Context, username string, since time.Time) (int, error) {
+	return q.primary.CountSubmissionsSince(ctx, username, since)
+}
+
+func (q *replicaQuestionRepository) Contributors(ctx context.Context, limit int) ([]Contributor, error) {
+	return readFrom(q.r,
+		func() ([]Contributor, error) { return q.replica.Contributors(ctx, limit) },
+		func() ([]Contributor, error) { return q.primary.Contributors(ctx, limit) })
+}
+
+func (q *replicaQuestionRepository) SetStatus(ctx context.Context, review QuestionReview) error {
+	return q.primary.SetStatus(ctx, review)
+}
+
+// Reviews 審査の直後に参照されるのでプライマリで読み取る
+func (q *replicaQuestionRepository) Reviews(ctx context.Context, id int) ([]QuestionReview, error) {
+	return q.primary.Reviews(ctx, id)
+}
+
+func (q *replicaQuestionRepository) SetLabels(ctx context.Context, id int, categoryIDs, tagIDs []int) error {
+	return q.primary.SetLabels(ctx, id, categoryIDs, tagIDs)
+}
+
+func (q *replicaQuestionRepository) AddToPool(ctx context.Context, poolID int, questionIDs []int) error {
+	return q.primary.AddToPool(ctx, poolID, questionIDs)
+}
+
+func (q *replicaQuestionRepository) RemoveFromPool(ctx context.Context, poolID, questionID int) error {
+	return q.primary.RemoveFromPool(ctx, poolID, questionID)
+}
+
+func (q *replicaQuestionRepository) SetDifficulty(ctx context.Context, id int, difficulty string, score float64) error {
+	return q.primary.SetDifficulty(ctx, id, difficulty, score)
+}
+
+func (q *replicaQuestionRepository) SetSchedule(ctx context.Context, id int, activateAt, retireAt *time.Time) error {
+	return q.primary.SetSchedule(ctx, id, activateAt, retireAt)
+}
+
+func (q *replicaQuestionRepository) Stats(ctx context.Context) ([]QuestionStats, error) {
+	return readFrom(q.r,
+		func() ([]QuestionStats, error) { return q.replica.Stats(ctx) },
+		func() ([]QuestionStats, error) { return q.primary.Stats(ctx) })
+}
+
+func (q *replicaQuestionRepository) StatsByID(ctx context.Context, id int) (QuestionStats, error) {
+	return readFrom(q.r,
+		func() (QuestionStats, error) { return q.replica.StatsByID(ctx, id) },
+		func() (QuestionStats, error) { return q.primary.StatsByID(ctx, id) })
+}
+
+// replicaRatingRepository ランキングの読み取りを読み取り用のデータベースで行うRatingRepository
+// 1人のレートや成績は対戦の直後に参照されるため、複製の遅れの影響を受けないようプライマリで読み取る
+type replicaRatingRepository struct {
+	primary RatingRepository
+	replica RatingRepository
+	r       *Replica
+}
+
+func (q *replicaRatingRepository) Rating(ctx context.Context, username, gameType string) (int, bool, error) {
+	return q.primary.Rating(ctx, username, gameType)
+}
+
+func (q *replicaRatingRepository) Top(ctx context.Context, gameType string, limit int) ([]PlayerRating, error) {
+	return readFrom(q.r,
+		func() ([]PlayerRating, error) { return q.replica.Top(ctx, gameType, limit) },
+		func() ([]PlayerRating, error) { return q.primary.Top(ctx, gameType, limit) })
+}
+
+// Leaderboard ランキングは定期的に作り直すので、複製の遅れは次の作り直しで解消される
+func (q *replicaRatingRepository) Leaderboard(ctx context.Context, gameType string) ([]PlayerRating, error) {
+	return readFrom(q.r,
+		func() ([]PlayerRating, error) { return q.replica.Leaderboard(ctx, gameType) },
+		func() ([]PlayerRating, error) { return q.primary.Leaderboard(ctx, gameType) })
+}
+
+func (q *replicaRatingRepository) PlayerRatings(ctx context.Context, username string) ([]PlayerGameRating, error) {
+	return q.primary.PlayerRatings(ctx, username)
+}
+
+func (q *replicaRatingRepository) PlayerStats(ctx context.Context, username string) ([]PlayerGameStats, error) {
+	return q.primary.PlayerStats(ctx, username)
+}
+
+func (q *replicaRatingRepository) FavoriteCategory(ctx context.Context, username string) (string, error) {
+	return q.primary.FavoriteCategory(ctx, username)
+}
+
+func (q *replicaRatingRepository) SmurfFlags(ctx context.Context, gameType string) ([]SmurfFlag, error) {
+	return q.primary.SmurfFlags(ctx, gameType)
+}
+
+// WithReplica 問題とランキングの読み取りを読み取り用のデータベースで行うようにする
+// 対戦結果やレートなどの書き込みは引き続きreposのデータベースで行う
+func (repos Repositories) WithReplica(r *Replica, dialect Dialect) Repositories {
+	repos.Questions = &replicaQuestionRepository{
+		primary: repos.Questions,
+		replica: newSQLQuestionRepository(r.DB, dialect),
+		r:       r,
+	}
+	repos.Ratings = &replicaRatingRepository{
+		primary: repos.Ratings,
+		replica: newSQLRatingRepository(r.DB, dialect),
+		r:       r,
+	}
+	return repos
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlReportRepository struct {
+	db conn
+}
+
+// NewSQLReportRepository データベースに問題の報告を保存するReportRepositoryを作成する
+func NewSQLReportRepository(db *sql.DB) ReportRepository {
+	return newSQLReportRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLReportRepository(db *sql.DB, dialect Dialect) ReportRepository {
+	return &sqlReportRepository{db: newConn(db, dialect)}
+}
+
+func (row questionReportRow) report() QuestionReport {
+	r := QuestionReport{
+		ID:              row.ID,
+		QuestionID:      row.QuestionID,
+		QuestionVersion: row.QuestionVersion,
+		Reporter:        row.Reporter,
+		Reason:          row.Reason,
+		Comment:         row.Comment,
+		RoomID:          row.RoomID,
+		GameType:        row.GameType,
+		Status:          row.Status,
+		ResolvedBy:      row.ResolvedBy.String,
+		CreatedAt:       row.CreatedAt.Time,
+	}
+	if row.ResolvedAt.Valid {
+		r.ResolvedAt = &row.ResolvedAt.Time
+	}
+	return r
+}
+
+func reports(rows []questionReportRow) []QuestionReport {
+	list := make([]QuestionReport, len(rows))
+	for i, row := range rows {
+		list[i] = row.report()
+	}
+	return list
+}
+
+func (r *sqlReportRepository) CreateReport(ctx context.Context, report QuestionReport) (int64, error) {
+	// 別々の接続から同時に送られた報告は両方入ることがあるが、早めに停止するだけなので許容する
+	open, err := r.db.OpenQuestionReportExists(ctx, report.QuestionID, report.Reporter, ReportOpen)
+	if err != nil {
+		return 0, err
+	}
+	if open > 0 {
+		return 0, ErrConflict
+	}
+	return r.db.CreateQuestionReport(ctx,
+		report.QuestionID, report.QuestionVersion, report.Reporter, report.Reason, report.Comment,
+		report.RoomID, report.GameType, ReportOpen, time.Now(),
+	)
+}
+
+func (r *sqlReportRepository) CountOpenReports(ctx context.Context, questionID int) (int, error) {
+	return r.db.CountQuestionReportsByStatus(ctx, questionID, ReportOpen)
+}
+
+func (r *sqlReportRepository) ReportsByStatus(ctx context.Context, status string) ([]QuestionReport, error) {
+	rows, err := r.db.ListQuestionReportsByStatus(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	return reports(rows), nil
+}
+
+func (r *sqlReportRepository) QuestionReports(ctx context.Context, questionID int) ([]QuestionReport, error) {
+	rows, err := r.db.ListQuestionReportsByQuestion(ctx, questionID)
+	if err != nil {
+		return nil, err
+	}
+	return reports(rows), nil
+}
+
+func (r *sqlReportRepository) CloseReports(ctx context.Context, questionID int, status, resolver string) (int, error) {
+	n, err := r.db.CloseQuestionReports(ctx, status, resolver, time.Now(), questionID, ReportOpen)
+	return int(n), err
+}
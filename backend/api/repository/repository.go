@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+//go:generate go run ./querygen -schema ../../server/db.sql -queries queries.sql -out queries_gen.go
+
+// ErrNotFound 指定したデータが存在しない
+var ErrNotFound = errors.New("データが見つかりません")
+
+// ErrConflict 同じ名前などのデータが既に存在する
+var ErrConflict = errors.New("既に存在します")
+
+// ErrDBUnavailable データベースに接続できないか、再試行しても一時的なエラーが続いた
+// 元のエラーと一緒にラップして返す
+var ErrDBUnavailable = errors.New("データベースを利用できません")
+
+// QuestionRepository 問題の保存先
+// 削除した問題は過去の対戦記録から参照されるため、行は残してdeleted_atを設定する
+// 削除した問題はList・Count・Random・Sampleの対象にならない
+// Count・Random・Sampleは承認済み(QuestionApproved)の問題だけを対象にし、Listは全ての状態の問題を返す
+type QuestionRepository interface {
+	// Create 問題を追加してIDを返す。q.Statusが空の場合は承認済み、q.Sourceが空の場合は管理者の作成として追加する
+	Create(ctx context.Context, q Question) (int64, error)
+	// Get 削除されていない問題を1つ返す。なければErrNotFound
+	Get(ctx context.Context, id int) (Question, error)
+	// Update q.IDの問題の内容を書き換え、editorが作成した新しい版として記録する
+	// 内容が変わらない場合は版を増やさない。存在しないか削除済みの場合はErrNotFound
+	Update(ctx context.Context, q Question, editor string) error
+	// Versions 問題の版を古い順に返す。削除済みの問題も返す
+	Versions(ctx context.Context, id int) ([]QuestionVersion, error)
+	List(ctx context.Context) ([]Question, error)
+	// Count filterに当てはまる問題の数を返す
+	Count(ctx context.Context, filter QuestionFilter) (int, error)
+	// Random filterに当てはまる問題を1つ無作為に返す。残っていなければErrNotFound
+	Random(ctx context.Context, filter QuestionFilter) (Question, error)
+	// Sample filterに当てはまる問題を、難易度ごとに最大n問ずつ無作為に返す
+	// 対戦で出題する問題を開始時にまとめて読み込むために使う。返す順番は決まっていない
+	Sample(ctx context.Context, filter QuestionFilter, n int) ([]Question, error)
+	// Delete 問題を削除済みにする。存在しないか削除済みの場合はErrNotFound
+	Delete(ctx context.Context, id int) error
+	// Restore 削除済みの問題を元に戻す。削除されていない場合はErrNotFound
+	Restore(ctx context.Context, id int) error
+	// ListDeleted 削除済みの問題を返す
+	ListDeleted(ctx context.Context) ([]Question, error)
+	// ListByStatus 削除されていない問題のうち指定した状態のものを返す
+	ListByStatus(ctx context.Context, status string) ([]Question, error)
+	// ListSubmissions プレイヤーが投稿した削除されていない問題を新しい順に返す
+	ListSubmissions(ctx context.Context, username string) ([]Question, error)
+	// CountSubmissionsSince プレイヤーがsince以降に投稿した問題の数を返す。削除された投稿も数える
+	CountSubmissionsSince(ctx context.Context, username string, since time.Time) (int, error)
+	// Contributors 承認された投稿の多い順にlimit人を返す
+	Contributors(ctx context.Context, limit int) ([]Contributor, error)
+	// SetStatus 問題の状態をreview.FromStatusからreview.Statusに変更し、審査の記録を残す
+	// 問題が存在しないか、削除済みか、状態がreview.FromStatusでなくなっていた場合はErrNotFound
+	SetStatus(ctx context.Context, review QuestionReview) error
+	// Reviews 問題の審査の記録を古い順に返す
+	Reviews(ctx context.Context, id int) ([]QuestionReview, error)
+	// SetLabels 問題のカテゴリーとタグを指定したIDのものに置き換える
+	SetLabels(ctx context.Context, id int, categoryIDs, tagIDs []int) error
+	// AddToPool 問題をプールに入れる。既に入っている問題はそのまま
+	// 存在しないか削除済みの問題が含まれていた場合はErrNotFoundで、どの問題も入れない
+	AddToPool(ctx context.Context, poolID int, questionIDs []int) error
+	// RemoveFromPool 問題をプールから外す。入っていなければErrNotFound
+	RemoveFromPool(ctx context.Context, poolID, questionID int) error
+	// SetDifficulty 回答の集計から計算した難易度を保存する。版は増やさない。存在しなければErrNotFound
+	SetDifficulty(ctx context.Context, id int, difficulty string, score float64) error
+	// SetSchedule 出題を始める日時と終える日時を変更する。状態は変えない。存在しなければErrNotFound
+	SetSchedule(ctx context.Context, id int, activateAt, retireAt *time.Time) error
+	// Stats 問題ごとの回答の集計を返す。まだ出題されていない問題は0件として返す
+	Stats(ctx context.Context) ([]QuestionStats, error)
+	// StatsByID 1問の回答の集計を返す。問題が存在しなければErrNotFound
+	StatsByID(ctx context.Context, id int) (QuestionStats, error)
+}
+
+// CategoryRepository 問題のカテゴリーとタグの保存先
+// 問題への紐付けはQuestionRepository.SetLabelsで行う
+// 名前の変更や削除は、問題のキャッシュを読み込み直すまで対戦中の問題には反映されない
+type CategoryRepository interface {
+	// Categories カテゴリーを名前の順に返す
+	Categories(ctx context.Context) ([]Category, error)
+	// CreateCategory カテゴリーを追加してIDを返す。同じ名前があればErrConflict
+	CreateCategory(ctx context.Context, c Category) (int, error)
+	// UpdateCategory c.IDのカテゴリーの名前と説明を変更する。存在しなければErrNotFound、名前が重複すればErrConflict
+	UpdateCategory(ctx context.Context, c Category) error
+	// DeleteCategory カテゴリーと問題への紐付けを削除する。存在しなければErrNotFound
+	DeleteCategory(ctx context.Context, id int) error
+	// Tags タグを名前の順に返す
+	Tags(ctx context.Context) ([]Tag, error)
+	// CreateTag タグを追加してIDを返す。同じ名前があればErrConflict
+	CreateTag(ctx context.Context, name string) (int, error)
+	// DeleteTag タグと問題への紐付けを削除する。存在しなければErrNotFound
+	DeleteTag(ctx context.Context, id int) error
+}
+
+// PoolRepository 問題のプールの保存先
+// プールへの問題の出し入れはQuestionRepository.AddToPool・RemoveFromPoolで行う
+type PoolRepository interface {
+	// Pools プールを名前の順に返す
+	Pools(ctx context.Context) ([]QuestionPool, error)
+	// GetPool 1件のプールを返す。存在しなければErrNotFound
+	GetPool(ctx context.Context, id int) (QuestionPool, error)
+	// CreatePool プールを追加してIDを返す。同じ名前があればErrConflict
+	CreatePool(ctx context.Context, p QuestionPool) (int, error)
+	// UpdatePool p.IDのプールの名前と説明を変更する。存在しなければErrNotFound、名前が重複すればErrConflict
+	UpdatePool(ctx context.Context, p QuestionPool) error
+	// DeletePool プールを削除し、問題とシーズンからの参照も外す。存在しなければErrNotFound
+	DeletePool(ctx context.Context, id int) error
+}
+
+// ReportRepository 対戦中にプレイヤーから寄せられた問題の報告の保存先
+type ReportRepository interface {
+	// CreateReport 報告を未対応として追加してIDを返す
+	// 同じプレイヤーが同じ問題に未対応の報告をしている場合はErrConflict
+	CreateReport(ctx context.Context, r QuestionReport) (int64, error)
+	// CountOpenReports 問題の未対応の報告の数を返す。同じプレイヤーの報告は1件までなので報告した人数と同じ
+	CountOpenReports(ctx context.Context, questionID int) (int, error)
+	// ReportsByStatus 指定した状態の報告を古い順に返す
+	ReportsByStatus(ctx context.Context, status string) ([]QuestionReport, error)
+	// QuestionReports 1問の報告を古い順に返す
+	QuestionReports(ctx context.Context, questionID int) ([]QuestionReport, error)
+	// CloseReports 問題の未対応の報告を全てstatusにし、変更した件数を返す
+	CloseReports(ctx context.Context, questionID int, status, resolver string) (int, error)
+}
+
+// TranslationRepository 問題の翻訳の保存先
+type TranslationRepository interface {
+	// Translations 1問の翻訳を言語の順に返す
+	Translations(ctx context.Context, questionID int) ([]QuestionTranslation, error)
+	// GetTranslation 1問の1つの言語の翻訳を返す。なければErrNotFound
+	GetTranslation(ctx context.Context, questionID int, locale string) (QuestionTranslation, error)
+	// SaveTranslation 翻訳を追加する。同じ問題と言語の翻訳があれば置き換える
+	SaveTranslation(ctx context.Context, t QuestionTranslation) error
+	// DeleteTranslation 翻訳を削除する。なければErrNotFound
+	DeleteTranslation(ctx context.Context, questionID int, locale string) error
+	// TranslatedVersions 全ての翻訳の問題・言語と翻訳した元の版を返す
+	TranslatedVersions(ctx context.Context) ([]TranslatedVersion, error)
+}
+
+// MatchRepository 対戦履歴の参照先
+// 対戦結果の書き込みはレートの更新と同じトランザクションで行うため rate.RatingService が担当する
+type MatchRepository interface {
+	ListByPlayer(ctx context.Context, filter MatchFilter) ([]MatchSummary, int, error)
+	Get(ctx context.Context, id int64) (MatchDetail, error)
+	// Answers 対戦の問題ごとの回答と回答権の要求を出題順に返す
+	Answers(ctx context.Context, id int64) ([]MatchAnswer, error)
+	// FastAnswerers belowMs未満で回答権を取って正解した回数がminCount以上のプレイヤーを、回数の多い順に最大100人返す
+	FastAnswerers(ctx context.Context, belowMs, minCount int) ([]FastAnswerer, error)
+	// DeleteGuestMatches ユーザー名がprefixで始まるゲストが参加した、beforeより前のカジュアル戦を削除する
+	// 問題ごとの回答と回答権の要求も削除し、削除した対戦の数を返す
+	DeleteGuestMatches(ctx context.Context, prefix string, before time.Time) (int64, error)
+}
+
+// RatingRepository レートの参照先
+type RatingRepository interface {
+	// Rating プレイヤーのレートを返す。まだ対戦していなければfoundはfalse
+	Rating(ctx context.Context, username, gameType string) (rating int, found bool, err error)
+	Top(ctx context.Context, gameType string, limit int) ([]PlayerRating, error)
+	// Leaderboard ゲームの種類の全てのプレイヤーを、レートの降順、同じレートはユーザー名順で返す
+	Leaderboard(ctx context.Context, gameType string) ([]PlayerRating, error)
+	// PlayerRatings プレイヤーの対戦したゲームの種類ごとのレートを、ゲームの種類の順に返す
+	PlayerRatings(ctx context.Context, username string) ([]PlayerGameRating, error)
+	// PlayerStats プレイヤーの対戦したゲームの種類ごとの成績を、ゲームの種類の順に返す
+	PlayerStats(ctx context.Context, username string) ([]PlayerGameStats, error)
+	// FavoriteCategory プレイヤーが最も多く回答した問題のカテゴリーの名前を返す。まだ回答していなければ空
+	FavoriteCategory(ctx context.Context, username string) (string, error)
+	// SmurfFlags サブアカウントの疑いがあるプレイヤーを、記録した日時の新しい順に返す
+	SmurfFlags(ctx context.Context, gameType string) ([]SmurfFlag, error)
+}
+
+// UserRepository アカウントの保存先
+type UserRepository interface {
+	// Create アカウントを作成する。同じユーザー名があればErrConflict
+	// MergeGuestIDが空でなければ、同じトランザクションでゲストの対戦記録を新しいアカウントに移す
+	Create(ctx context.Context, user NewUser) error
+	// FindByUsername アカウントを返す。存在しなければErrNotFound
+	FindByUsername(ctx context.Context, username string) (User, error)
+	// UsernameTaken 大文字と小文字を区別せずに同じユーザー名があるかを返す
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+	// GetRole アカウントのロールを返す。存在しなければErrNotFound
+	GetRole(ctx context.Context, username string) (string, error)
+	// SetRole アカウントのロールを変更する。存在しなければErrNotFound
+	SetRole(ctx context.Context, username, role string) error
+}
+
+// SessionRepository ログインセッションの保存先
+type SessionRepository interface {
+	// CreateSession セッションを保存する
+	CreateSession(ctx context.Context, session Session) error
+	// GetSession ユーザーのセッションを返す。無効にしたセッションも返す。存在しなければErrNotFound
+	GetSession(ctx context.Context, id, username string) (Session, error)
+	// ExtendSession 無効にされていないセッションの有効期限を変更する。なければErrNotFound
+	ExtendSession(ctx context.Context, id, username string, expiresAt time.Time) error
+	// TouchSession セッションの最終利用日時をnowにする。interval以内に更新していれば何もしない
+	TouchSession(ctx context.Context, id string, now time.Time, interval time.Duration) error
+	// RevokeSession セッションを無効にする。無効にされていないセッションがなければErrNotFound
+	RevokeSession(ctx context.Context, id, username string) error
+	// RevokeUserSessions ユーザーの全てのセッションを無効にする
+	RevokeUserSessions(ctx context.Context, username string) error
+	// ActiveSessions ユーザーのnowの時点で有効なセッションを、最後に使った順に返す
+	ActiveSessions(ctx context.Context, username string, now time.Time) ([]Session, error)
+}
+
+// APIKeyRepository APIキーの保存先
+type APIKeyRepository interface {
+	// CountAPIKeys ユーザーの有効なAPIキーの数を返す
+	CountAPIKeys(ctx context.Context, username string) (int, error)
+	// CreateAPIKey APIキーを保存する
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	// APIKeyByHash ハッシュが一致する有効なAPIキーを返す。なければErrNotFound
+	APIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	// TouchAPIKey APIキーの最終利用日時を現在の日時にする
+	TouchAPIKey(ctx context.Context, id string) error
+	// APIKeys ユーザーの有効なAPIキーを発行した順に返す
+	APIKeys(ctx context.Context, username string) ([]APIKey, error)
+	// RevokeAPIKey ユーザーのAPIキーを無効にする。有効なキーがなければErrNotFound
+	RevokeAPIKey(ctx context.Context, id, username string) error
+}
+
+// FriendRepository フレンドとフレンド申請の保存先
+// フレンドの関係は双方向に1行ずつ保存する
+type FriendRepository interface {
+	// AreFriends usernameとfriendUsernameがフレンドかを返す
+	AreFriends(ctx context.Context, username, friendUsername string) (bool, error)
+	// CreateFriendRequest usernameからfriendUsernameへの申請を追加する。同じ相手への申請があればErrConflict
+	CreateFriendRequest(ctx context.Context, username, friendUsername string) error
+	// RespondFriendRequest usernameに届いた承認待ちの申請に応答する。acceptならフレンドにする
+	// 承認待ちの申請でないか、username宛てでなければErrNotFound
+	RespondFriendRequest(ctx context.Context, id int, username string, accept bool) error
+	// PendingFriendRequests usernameに届いた承認待ちの申請を返す
+	PendingFriendRequests(ctx context.Context, username string) ([]FriendRequest, error)
+}
+
+// OAuthRepository 外部サービスのアカウントとの連携の保存先
+type OAuthRepository interface {
+	// LinkedUser 外部サービスのユーザーに連携しているアカウント名を返す。連携していなければErrNotFound
+	LinkedUser(ctx context.Context, provider, providerUserID string) (string, error)
+	// LinkAccount 外部サービスのユーザーをアカウントに連携する。link.CreateUserなら同じトランザクションでアカウントも作成する
+	// 外部サービスのユーザーが連携済みか、作成するアカウントと同じユーザー名があればErrConflict
+	LinkAccount(ctx context.Context, link OAuthLink) error
+}
+
+// ProfileRepository プロフィールの保存先
+type ProfileRepository interface {
+	// Profile 保存されているプロフィールを返す。登録していなければUsername以外は空
+	Profile(ctx context.Context, username string) (Profile, error)
+	// SaveProfile プロフィールを保存する。既にあれば置き換える
+	SaveProfile(ctx context.Context, p Profile) error
+}
+
+// EmailRepository メールアドレスとメールで送るトークンの保存先
+// トークンは期限切れでなく未使用のものだけを有効として扱い、使ったら使用済みにする
+type EmailRepository interface {
+	// EmailVerified メールアドレスを確認済みかを返す。アカウントが存在しなければfalse
+	EmailVerified(ctx context.Context, username string) (bool, error)
+	// SetEmail メールアドレスを登録する。変更した場合は確認済みの状態を取り消す
+	SetEmail(ctx context.Context, username, email string) error
+	// IssueEmailToken トークンを保存し、同じユーザーの同じ用途の未使用のトークンを無効にする
+	IssueEmailToken(ctx context.Context, token EmailToken) error
+	// VerifyEmail 確認用のトークンを使い、発行先のユーザーのメールアドレスを確認済みにしてユーザー名を返す
+	// トークンが無効ならErrNotFound、他のアカウントが同じメールアドレスを確認済みならErrConflictで、トークンは使わない
+	VerifyEmail(ctx context.Context, tokenHash string) (string, error)
+	// VerifiedUser メールアドレスを確認済みのユーザー名を返す。大文字と小文字は区別しない。なければErrNotFound
+	VerifiedUser(ctx context.Context, email string) (string, error)
+	// ResetPassword 再設定用のトークンを使い、発行先のユーザーのパスワードを変更してユーザー名を返す
+	// トークンが無効ならErrNotFound
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error)
+}
+
+// SeasonRepository シーズンと最終順位の保存先
+type SeasonRepository interface {
+	// Seasons 全てのシーズンを開始日時の新しい順に返す
+	Seasons(ctx context.Context) ([]Season, error)
+	// CurrentSeason nowに開催中で終了処理の済んでいないシーズンを返す。なければErrNotFound
+	CurrentSeason(ctx context.Context, now time.Time) (Season, error)
+	// CreateSeason シーズンを追加してIDを返す。期間が重なるシーズンがあればErrConflict
+	CreateSeason(ctx context.Context, s Season) (int64, error)
+	// SetSeasonPool シーズンの出題に使う問題のプールを変更する。nilで指定を外す。シーズンが存在しなければErrNotFound
+	SetSeasonPool(ctx context.Context, id int, poolID *int) error
+	// SeasonRatings シーズンの最終順位を順位の順に返す
+	SeasonRatings(ctx context.Context, seasonID int, gameType string, limit, offset int) ([]SeasonRating, error)
+	// FinalizeSeason シーズンの最終順位を保存し、現在のレートをゲームの種類ごとの平均に向けてresetFactorの割合に縮める
+	// 1つのトランザクションで行い、終了処理の済んだシーズンには何もしない。シーズンが存在しなければErrNotFound
+	FinalizeSeason(ctx context.Context, id int, resetFactor float64) error
+	// ExpiredSeasons 終了日時がnow以前なのに終了処理の済んでいないシーズンのIDを終了日時の順に返す
+	ExpiredSeasons(ctx context.Context, now time.Time) ([]int, error)
+}
+
+// PlayerDataRepository プレイヤーが自分のデータを書き出すときの読み取り先
+// 対戦相手の回答は相手のデータなので返さない
+type PlayerDataRepository interface {
+	// CountMatches プレイヤーが参加した対戦の数を返す
+	CountMatches(ctx context.Context, username string) (int, error)
+	// Matches プレイヤーが参加した対戦を古い順に、プレイヤー自身の回答と一緒に返す
+	Matches(ctx context.Context, username string) ([]PlayerMatch, error)
+	// RatingHistory プレイヤーのレートの変動を古い順に返す
+	RatingHistory(ctx context.Context, username string) ([]RatingChange, error)
+}
+
+// AuditRepository 管理者の操作の記録の保存先
+type AuditRepository interface {
+	// RecordAudit 操作の記録を追加する
+	RecordAudit(ctx context.Context, entry AuditEntry) error
+	// AuditEntries 条件に合う記録を新しい順に返す。totalはLimitとOffsetを適用する前の件数
+	AuditEntries(ctx context.Context, filter AuditFilter) (entries []AuditEntry, total int, err error)
+}
+
+// EventRepository 分析基盤に送る前の対戦のイベントの保存先(送信待ちの一覧)
+type EventRepository interface {
+	// SaveEvent 送信待ちのイベントを追加する
+	SaveEvent(ctx context.Context, e OutboxEvent) error
+	// PendingEvents 送信していないイベントを保存した順に最大limit件返す
+	PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	// MarkDelivered イベントを送信済みにする
+	MarkDelivered(ctx context.Context, ids []int64, at time.Time) error
+	// IncrementAttempts イベントの送信に失敗した回数を増やす
+	IncrementAttempts(ctx context.Context, ids []int64) error
+	// DeleteDelivered before より前に送信したイベントを削除する
+	DeleteDelivered(ctx context.Context, before time.Time) error
+}
+
+// Repositories ハンドラーに渡す保存先をまとめた構造体
+type Repositories struct {
+	Questions    QuestionRepository
+	Categories   CategoryRepository
+	Pools        PoolRepository
+	Reports      ReportRepository
+	Translations TranslationRepository
+	Matches      MatchRepository
+	Ratings      RatingRepository
+	Users        UserRepository
+	Friends      FriendRepository
+	OAuth        OAuthRepository
+	Profiles     ProfileRepository
+	Emails       EmailRepository
+	Seasons      SeasonRepository
+	PlayerData   PlayerDataRepository
+	Sessions     SessionRepository
+	APIKeys      APIKeyRepository
+	Audit        AuditRepository
+	Events       EventRepository
+}
+
+// NewSQL MySQLのデータベースを使う保存先を作成する
+func NewSQL(db *sql.DB) Repositories {
+	return NewSQLWithDialect(db, DialectFor(DriverMySQL))
+}
+
+// NewSQLWithDialect 指定した種類のデータベースを使う保存先を作成する
+func NewSQLWithDialect(db *sql.DB, dialect Dialect) Repositories {
+	return Repositories{
+		Questions:    newSQLQuestionRepository(db, dialect),
+		Categories:   newSQLCategoryRepository(db, dialect),
+		Pools:        newSQLPoolRepository(db, dialect),
+		Reports:      newSQLReportRepository(db, dialect),
+		Translations: newSQLTranslationRepository(db, dialect),
+		Matches:      newSQLMatchRepository(db, dialect),
+		Ratings:      newSQLRatingRepository(db, dialect),
+		Users:        newSQLUserRepository(db, dialect),
+		Friends:      newSQLFriendRepository(db, dialect),
+		OAuth:        newSQLOAuthRepository(db, dialect),
+		Profiles:     newSQLProfileRepository(db, dialect),
+		Emails:       newSQLEmailRepository(db, dialect),
+		Seasons:      newSQLSeasonRepository(db, dialect),
+		PlayerData:   newSQLPlayerDataRepository(db, dialect),
+		Sessions:     newSQLSessionRepository(db, dialect),
+		APIKeys:      newSQLAPIKeyRepository(db, dialect),
+		Audit:        newSQLAuditRepository(db, dialect),
+		Events:       newSQLEventRepository(db, dialect),
+	}
+}
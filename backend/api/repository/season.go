@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type sqlSeasonRepository struct {
+	db conn
+}
+
+// NewSQLSeasonRepository データベースにシーズンを保存するSeasonRepositoryを作成する
+func NewSQLSeasonRepository(db *sql.DB) SeasonRepository {
+	return newSQLSeasonRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLSeasonRepository(db *sql.DB, dialect Dialect) SeasonRepository {
+	return &sqlSeasonRepository{db: newConn(db, dialect)}
+}
+
+const seasonColumns = "id, name, starts_at, ends_at, finalized, rewards, question_pool_id"
+
+func scanSeason(row rowScanner) (Season, error) {
+	var s Season
+	var rewards sql.NullString
+	var poolID sql.NullInt64
+	if err := row.Scan(&s.ID, &s.Name, &s.StartsAt, &s.EndsAt, &s.Finalized, &rewards, &poolID); err != nil {
+		return Season{}, err
+	}
+	if poolID.Valid {
+		id := int(poolID.Int64)
+		s.QuestionPoolID = &id
+	}
+	if rewards.Valid {
+		s.Rewards = json.RawMessage(rewards.String)
+	}
+	return s, nil
+}
+
+func (r *sqlSeasonRepository) Seasons(ctx context.Context) ([]Season, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+seasonColumns+" FROM seasons ORDER BY starts_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []Season
+	for rows.Next() {
+		s, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, s)
+	}
+	return seasons, rows.Err()
+}
+
+func (r *sqlSeasonRepository) CurrentSeason(ctx context.Context, now time.Time) (Season, error) {
+	s, err := scanSeason(r.db.QueryRowContext(ctx, `
+		SELECT `+seasonColumns+`
+		FROM seasons
+		WHERE finalized = FALSE AND starts_at <= ? AND ends_at > ?
+		ORDER BY starts_at DESC
+		LIMIT 1`,
+		now, now,
+	))
+	if err == sql.ErrNoRows {
+		return Season{}, ErrNotFound
+	}
+	return s, err
+}
+
+func (r *sqlSeasonRepository) CreateSeason(ctx context.Context, s Season) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var overlaps bool
+	if err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM seasons WHERE starts_at < ? AND ends_at > ?)",
+		s.EndsAt, s.StartsAt,
+	).Scan(&overlaps); err != nil {
+		return 0, err
+	}
+	if overlaps {
+		return 0, ErrConflict
+	}
+
+	var rewards interface{}
+	if len(s.Rewards) > 0 {
+		rewards = string(s.Rewards)
+	}
+	id, err := tx.InsertID(ctx,
+		"INSERT INTO seasons (name, starts_at, ends_at, rewards, question_pool_id) VALUES (?, ?, ?, ?, ?)",
+		s.Name, s.StartsAt, s.EndsAt, rewards, s.QuestionPoolID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *sqlSeasonRepository) SetSeasonPool(ctx context.Context, id int, poolID *int) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE seasons SET question_pool_id = ? WHERE id = ?", poolID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// 同じプールを指定し直した場合も0行になるので、シーズンがあるかを確かめる
+		var exists bool
+		if err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM seasons WHERE id = ?)", id).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+func (r *sqlSeasonRepository) SeasonRatings(ctx context.Context, seasonID int, gameType string, limit, offset int) ([]SeasonRating, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT season_id, game_type, username, rating, final_rank
+		FROM season_ratings
+		WHERE season_id = ? AND game_type = ?
+		ORDER BY final_rank, username
+		LIMIT ? OFFSET ?`,
+		seasonID, gameType, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratings []SeasonRating
+	for rows.Next() {
+		var rating SeasonRating
+		if err := rows.Scan(&rating.SeasonID, &rating.GameType, &rating.Username, &rating.Rating, &rating.FinalRank); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, rows.Err()
+}
+
+func (r *sqlSeasonRepository) FinalizeSeason(ctx context.Context, id int, resetFactor float64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 終了済みにする更新で処理する権利を取るので、同時に呼ばれても順位は1回しか保存しない
+	res, err := tx.ExecContext(ctx, "UPDATE seasons SET finalized = TRUE WHERE id = ? AND finalized = FALSE", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM seasons WHERE id = ?)", id).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return nil // 既に処理済み
+	}
+
+	// 最終順位を保存
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO season_ratings (season_id, game_type, username, rating, final_rank)
+		SELECT s.id, p.game_type, p.username, p.rating, RANK() OVER (PARTITION BY p.game_type ORDER BY p.rating DESC)
+		FROM player_ratings p
+		JOIN seasons s ON s.id = ?`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	// ゲームの種類ごとの平均に向けてレートを縮める
+	if err := softReset(ctx, tx, resetFactor); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// softReset ゲームの種類ごとに、レートを平均に向けてfactorの割合に縮める
+// 更新するテーブルを結合したUPDATEはデータベースごとに書き方が違うので、平均を先に求めてから更新する
+func softReset(ctx context.Context, tx txConn, factor float64) error {
+	rows, err := tx.QueryContext(ctx, "SELECT game_type, AVG(rating) FROM player_ratings GROUP BY game_type")
+	if err != nil {
+		return err
+	}
+	means := make(map[string]float64)
+	for rows.Next() {
+		var gameType string
+		var mean float64
+		if err := rows.Scan(&gameType, &mean); err != nil {
+			rows.Close()
+			return err
+		}
+		means[gameType] = mean
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// PostgreSQLはプレースホルダーの型を列から推測して整数にするので、小数の値は明示的に変換する
+	const decimal = "CAST(? AS DECIMAL(12, 4))"
+	for gameType, mean := range means {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE player_ratings SET rating = ROUND("+decimal+" + (rating - "+decimal+") * "+decimal+") WHERE game_type = ?",
+			mean, mean, factor, gameType,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlSeasonRepository) ExpiredSeasons(ctx context.Context, now time.Time) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id FROM seasons WHERE finalized = FALSE AND ends_at <= ? ORDER BY ends_at",
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
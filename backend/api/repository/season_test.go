@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFinalizeSeason(t *testing.T) {
+	db := openSQLite(t)
+	seasons := newSQLSeasonRepository(db, DialectFor(DriverSQLite))
+	ctx := context.Background()
+	now := time.Now()
+
+	id, err := seasons.CreateSeason(ctx, Season{Name: "S1", StartsAt: now.Add(-time.Hour), EndsAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seasons.CreateSeason(ctx, Season{Name: "S2", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)}); !errors.Is(err, ErrConflict) {
+		t.Errorf("overlapping CreateSeason = %v, want ErrConflict", err)
+	}
+	for username, rating := range map[string]int{"alice": 1700, "bob": 1500, "carol": 1300} {
+		if _, err := db.Exec("INSERT INTO player_ratings (username, game_type, rating) VALUES (?, 'quiz', ?)", username, rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := seasons.ExpiredSeasons(ctx, now)
+	if err != nil || len(expired) != 1 || expired[0] != int(id) {
+		t.Fatalf("ExpiredSeasons = %v, %v", expired, err)
+	}
+	// 2回目は何もしないので、レートは1回分だけ縮む
+	for i := 0; i < 2; i++ {
+		if err := seasons.FinalizeSeason(ctx, int(id), 0.5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seasons.FinalizeSeason(ctx, 99, 0.5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FinalizeSeason(99) = %v, want ErrNotFound", err)
+	}
+
+	ratings, err := seasons.SeasonRatings(ctx, int(id), "quiz", 10, 0)
+	if err != nil || len(ratings) != 3 || ratings[0].Username != "alice" || ratings[0].FinalRank != 1 {
+		t.Fatalf("SeasonRatings = %+v, %v", ratings, err)
+	}
+	var rating int
+	if err := db.QueryRow("SELECT rating FROM player_ratings WHERE username = 'alice'").Scan(&rating); err != nil {
+		t.Fatal(err)
+	}
+	if rating != 1600 {
+		t.Errorf("alice = %d, want 1600", rating)
+	}
+	if expired, _ := seasons.ExpiredSeasons(ctx, now); len(expired) != 0 {
+		t.Errorf("ExpiredSeasons after finalize = %v", expired)
+	}
+}
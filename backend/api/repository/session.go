@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlSessionRepository struct {
+	db conn
+}
+
+// NewSQLSessionRepository データベースにログインセッションを保存するSessionRepositoryを作成する
+func NewSQLSessionRepository(db *sql.DB) SessionRepository {
+	return newSQLSessionRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLSessionRepository(db *sql.DB, dialect Dialect) SessionRepository {
+	return &sqlSessionRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlSessionRepository) CreateSession(ctx context.Context, s Session) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO sessions (id, username, ip, user_agent, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		s.ID, s.Username, s.IP, s.UserAgent, s.CreatedAt, s.ExpiresAt,
+	)
+	return err
+}
+
+func (r *sqlSessionRepository) GetSession(ctx context.Context, id, username string) (Session, error) {
+	s := Session{ID: id, Username: username}
+	var lastSeenAt, revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT ip, user_agent, created_at, expires_at, last_seen_at, revoked_at FROM sessions WHERE id = ? AND username = ?",
+		id, username,
+	).Scan(&s.IP, &s.UserAgent, &s.CreatedAt, &s.ExpiresAt, &lastSeenAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if lastSeenAt.Valid {
+		s.LastSeenAt = &lastSeenAt.Time
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	return s, nil
+}
+
+func (r *sqlSessionRepository) ExtendSession(ctx context.Context, id, username string, expiresAt time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET expires_at = ? WHERE id = ? AND username = ? AND revoked_at IS NULL",
+		expiresAt, id, username,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlSessionRepository) TouchSession(ctx context.Context, id string, now time.Time, interval time.Duration) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET last_seen_at = ? WHERE id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)",
+		now, id, now.Add(-interval),
+	)
+	return err
+}
+
+func (r *sqlSessionRepository) RevokeSession(ctx context.Context, id, username string) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ? AND revoked_at IS NULL",
+		id, username,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlSessionRepository) RevokeUserSessions(ctx context.Context, username string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE username = ? AND revoked_at IS NULL",
+		username,
+	)
+	return err
+}
+
+func (r *sqlSessionRepository) ActiveSessions(ctx context.Context, username string, now time.Time) ([]Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, ip, user_agent, created_at, expires_at, last_seen_at FROM sessions
+		WHERE username = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC`,
+		username, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s := Session{Username: username}
+		var lastSeenAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.IP, &s.UserAgent, &s.CreatedAt, &s.ExpiresAt, &lastSeenAt); err != nil {
+			return nil, err
+		}
+		if lastSeenAt.Valid {
+			s.LastSeenAt = &lastSeenAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
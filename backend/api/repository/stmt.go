@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// maxCachedStatements 1つのStatementCacheに保持するステートメント数の上限
+// 条件の数で形が変わるクエリもあるので、上限を超えたら最も長く使われていないものを閉じて入れ替える
+const maxCachedStatements = 128
+
+// StatementCache クエリごとに準備済みのステートメントを使い回す
+// 対戦中は1問ごとに同じクエリを実行するため、毎回SQLを解析し直さないようにする
+type StatementCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*list.Element // 値は*cachedStmt
+	lru   *list.List               // 先頭ほど最近使ったもの
+
+	preparing map[string]bool // トランザクションの外で準備している最中のクエリ
+}
+
+// cachedStmt 保持しているステートメントと、それを実行中の呼び出しの数
+// 実行中に追い出された場合は、最後の呼び出しが終わったときに閉じる
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// NewStatementCache dbで準備したステートメントを保持するStatementCacheを作成する
+func NewStatementCache(db *sql.DB) *StatementCache {
+	return &StatementCache{db: db, stmts: make(map[string]*list.Element), lru: list.New(), preparing: make(map[string]bool)}
+}
+
+// acquire 準備済みのステートメントを返す。まだ準備していなければ準備して保持する
+// 使い終わったらreleaseを呼ぶこと。準備できない場合はnilを返すので、呼び出し側はそのまま実行する
+// 準備には接続を使うので、他の呼び出しを待たせないようにロックを外して行う
+func (c *StatementCache) acquire(ctx context.Context, query string) *cachedStmt {
+	if entry := c.lookup(query); entry != nil {
+		return entry
+	}
+
+	// 準備したステートメントは使い回すので、呼び出し元のコンテキストには縛られないようにする
+	stmt, err := c.db.PrepareContext(context.WithoutCancel(ctx), query)
+	if err != nil {
+		return nil
+	}
+	return c.store(query, stmt)
+}
+
+// lookup 準備済みのステートメントがあれば返す。なければnilを返す
+func (c *StatementCache) lookup(query string) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.stmts[query]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cachedStmt)
+	entry.refs++
+	return entry
+}
+
+// store 準備したステートメントを保持して返す
+// 同じクエリを他の呼び出しが先に保持していた場合は、stmtを閉じてそちらを返す
+func (c *StatementCache) store(query string, stmt *sql.Stmt) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.stmts[query]; ok {
+		stmt.Close()
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*cachedStmt)
+		entry.refs++
+		return entry
+	}
+	if c.lru.Len() >= maxCachedStatements {
+		c.evictLocked(c.lru.Back())
+	}
+	entry := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.stmts[query] = c.lru.PushFront(entry)
+	return entry
+}
+
+// prepareLater トランザクションの中で初めて実行されたクエリを、トランザクションの外で準備する
+// トランザクションが接続を持ったまま別の接続を待つと、接続が足りないときに進まなくなるため
+func (c *StatementCache) prepareLater(query string) {
+	c.mu.Lock()
+	if c.preparing[query] {
+		c.mu.Unlock()
+		return
+	}
+	c.preparing[query] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.preparing, query)
+			c.mu.Unlock()
+		}()
+		stmt, err := c.db.Prepare(query)
+		if err != nil {
+			return
+		}
+		c.release(c.store(query, stmt))
+	}()
+}
+
+// release acquireで取ったステートメントを返す。追い出されていて誰も使っていなければ閉じる
+func (c *StatementCache) release(entry *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// evictLocked ステートメントをキャッシュから外す。使っている呼び出しがなければすぐに閉じる
+func (c *StatementCache) evictLocked(elem *list.Element) error {
+	entry := c.lru.Remove(elem).(*cachedStmt)
+	delete(c.stmts, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		return entry.stmt.Close()
+	}
+	return nil
+}
+
+// Close 保持しているステートメントを全て閉じる
+func (c *StatementCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for c.lru.Len() > 0 {
+		if err := c.evictLocked(c.lru.Back()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ExecContext 準備済みのステートメントで実行する。準備できない場合はそのまま実行する
+func (c *StatementCache) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if entry := c.acquire(ctx, query); entry != nil {
+		defer c.release(entry)
+		return entry.stmt.ExecContext(ctx, args...)
+	}
+	return c.db.ExecContext(ctx, query, args...)
+}
+
+// QueryContext 準備済みのステートメントで問い合わせる。準備できない場合はそのまま実行する
+// 返したRowsが閉じられるまでは、追い出されてもステートメントは閉じられない
+func (c *StatementCache) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if entry := c.acquire(ctx, query); entry != nil {
+		defer c.release(entry)
+		return entry.stmt.QueryContext(ctx, args...)
+	}
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext 準備済みのステートメントで1行を問い合わせる。準備できない場合はそのまま実行する
+func (c *StatementCache) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if entry := c.acquire(ctx, query); entry != nil {
+		defer c.release(entry)
+		return entry.stmt.QueryRowContext(ctx, args...)
+	}
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+// TxExecContext 準備済みのステートメントをトランザクションの中で実行する
+// まだ準備していない場合や、cがnilの場合はそのまま実行する
+func (c *StatementCache) TxExecContext(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	if c == nil {
+		return tx.ExecContext(ctx, query, args...)
+	}
+	if entry := c.lookup(query); entry != nil {
+		defer c.release(entry)
+		return tx.StmtContext(ctx, entry.stmt).ExecContext(ctx, args...)
+	}
+	c.prepareLater(query)
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// TxQueryRowContext 準備済みのステートメントをトランザクションの中で使って1行を問い合わせる
+// まだ準備していない場合や、cがnilの場合はそのまま実行する
+func (c *StatementCache) TxQueryRowContext(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	if c == nil {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	if entry := c.lookup(query); entry != nil {
+		defer c.release(entry)
+		return tx.StmtContext(ctx, entry.stmt).QueryRowContext(ctx, args...)
+	}
+	c.prepareLater(query)
+	return tx.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// トランザクションが唯一の接続を持っている間に、まだ準備していないクエリを実行しても止まらないこと
+func TestTxExecDoesNotWaitForConnection(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE counters (id INTEGER PRIMARY KEY, n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewStatementCache(db)
+	defer cache.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.TxExecContext(ctx, tx, "INSERT INTO counters (id, n) VALUES (?, ?)", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := cache.TxQueryRowContext(ctx, tx, "SELECT n FROM counters WHERE id = ?", 1).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("n = %d, want 1", n)
+	}
+
+	// トランザクションの外で準備されたステートメントは、次からキャッシュを使う
+	if err := cache.QueryRowContext(ctx, "SELECT n FROM counters WHERE id = ?", 1).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 上限を超えたら最も長く使われていないステートメントを追い出すこと
+func TestStatementCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cache := NewStatementCache(db)
+	defer cache.Close()
+	ctx := context.Background()
+	for i := 0; i <= maxCachedStatements; i++ {
+		if _, err := cache.ExecContext(ctx, fmt.Sprintf("SELECT %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.lru.Len() != maxCachedStatements {
+		t.Errorf("cached = %d, want %d", cache.lru.Len(), maxCachedStatements)
+	}
+	if _, ok := cache.stmts["SELECT 0"]; ok {
+		t.Error("SELECT 0 was not evicted")
+	}
+}
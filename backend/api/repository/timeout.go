@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultQueryTimeout 1回のデータベース操作にかけられる時間のデフォルト
+const DefaultQueryTimeout = 5 * time.Second
+
+var queryTimeout = DefaultQueryTimeout
+
+// SetQueryTimeout 1回のデータベース操作にかけられる時間を設定する
+// サーバー起動前に呼び出すこと
+func SetQueryTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		queryTimeout = timeout
+	}
+}
+
+// WithTimeout 1回のデータベース操作用に、制限時間付きのコンテキストを作成する
+// 部屋やリクエストのコンテキストから作るので、対戦が終わったり切断されたりしても操作が中断される
+// データベースが遅くてもゲームのゴルーチンが止まり続けないようにするため
+func WithTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, queryTimeout)
+}
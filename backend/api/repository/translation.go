@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlTranslationRepository struct {
+	db conn
+}
+
+// NewSQLTranslationRepository データベースに問題の翻訳を保存するTranslationRepositoryを作成する
+func NewSQLTranslationRepository(db *sql.DB) TranslationRepository {
+	return newSQLTranslationRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLTranslationRepository(db *sql.DB, dialect Dialect) TranslationRepository {
+	return &sqlTranslationRepository{db: newConn(db, dialect)}
+}
+
+func (row questionTranslationRow) translation() QuestionTranslation {
+	return QuestionTranslation{
+		QuestionID:    row.QuestionID,
+		Locale:        row.Locale,
+		QuestionText:  row.QuestionText,
+		CorrectAnswer: row.CorrectAnswer,
+		Choices:       []string{row.Choice1, row.Choice2, row.Choice3, row.Choice4},
+		Explanation:   row.Explanation,
+		SourceVersion: row.SourceVersion,
+		Translator:    row.Translator,
+		UpdatedAt:     row.UpdatedAt.Time,
+	}
+}
+
+func (r *sqlTranslationRepository) Translations(ctx context.Context, questionID int) ([]QuestionTranslation, error) {
+	rows, err := r.db.ListQuestionTranslations(ctx, questionID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]QuestionTranslation, len(rows))
+	for i, row := range rows {
+		list[i] = row.translation()
+	}
+	return list, nil
+}
+
+func (r *sqlTranslationRepository) GetTranslation(ctx context.Context, questionID int, locale string) (QuestionTranslation, error) {
+	row, err := r.db.GetQuestionTranslation(ctx, questionID, locale)
+	if err == sql.ErrNoRows {
+		return QuestionTranslation{}, ErrNotFound
+	}
+	if err != nil {
+		return QuestionTranslation{}, err
+	}
+	return row.translation(), nil
+}
+
+func (r *sqlTranslationRepository) SaveTranslation(ctx context.Context, t QuestionTranslation) error {
+	// 書き換えた件数は内容が同じだと0になるデータベースがあるので、先に有無を確かめる
+	_, err := r.db.GetQuestionTranslation(ctx, t.QuestionID, t.Locale)
+	if err == sql.ErrNoRows {
+		return r.db.CreateQuestionTranslation(ctx,
+			t.QuestionID, t.Locale, t.QuestionText, t.CorrectAnswer, t.Choices[0], t.Choices[1], t.Choices[2], t.Choices[3],
+			t.Explanation, t.SourceVersion, t.Translator, time.Now(),
+		)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.db.UpdateQuestionTranslation(ctx,
+		t.QuestionText, t.CorrectAnswer, t.Choices[0], t.Choices[1], t.Choices[2], t.Choices[3],
+		t.Explanation, t.SourceVersion, t.Translator, time.Now(), t.QuestionID, t.Locale,
+	)
+	return err
+}
+
+func (r *sqlTranslationRepository) DeleteTranslation(ctx context.Context, questionID int, locale string) error {
+	n, err := r.db.DeleteQuestionTranslation(ctx, questionID, locale)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlTranslationRepository) TranslatedVersions(ctx context.Context) ([]TranslatedVersion, error) {
+	rows, err := r.db.ListTranslatedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]TranslatedVersion, len(rows))
+	for i, row := range rows {
+		list[i] = TranslatedVersion{QuestionID: row.QuestionID, Locale: row.Locale, SourceVersion: row.SourceVersion}
+	}
+	return list, nil
+}
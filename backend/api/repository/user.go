@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type sqlUserRepository struct {
+	db conn
+}
+
+// NewSQLUserRepository データベースにアカウントを保存するUserRepositoryを作成する
+func NewSQLUserRepository(db *sql.DB) UserRepository {
+	return newSQLUserRepository(db, DialectFor(DriverMySQL))
+}
+
+func newSQLUserRepository(db *sql.DB, dialect Dialect) UserRepository {
+	return &sqlUserRepository{db: newConn(db, dialect)}
+}
+
+func (r *sqlUserRepository) Create(ctx context.Context, user NewUser) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO users (username, password) VALUES (?, ?)", user.Username, user.PasswordHash); IsUniqueViolation(err) {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+	if user.MergeGuestID != "" {
+		if err := transferPlayer(ctx, tx, user.MergeGuestID, user.Username); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// transferPlayer プレイヤーの対戦記録とレートを別のIDに移す
+// ゲストがアカウントを作成したときに、ゲストの間の記録を引き継ぐために使う
+func transferPlayer(ctx context.Context, tx txConn, fromID, toID string) error {
+	statements := []string{
+		"UPDATE matches SET player1_id = ? WHERE player1_id = ?",
+		"UPDATE matches SET player2_id = ? WHERE player2_id = ?",
+		"UPDATE matches SET winner_id = ? WHERE winner_id = ?",
+		"UPDATE rating_history SET username = ? WHERE username = ?",
+		"UPDATE player_ratings SET username = ? WHERE username = ?",
+		"UPDATE player_stats SET username = ? WHERE username = ?",
+		"UPDATE match_answers SET player_id = ? WHERE player_id = ?",
+		"UPDATE match_buzzes SET player_id = ? WHERE player_id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, toID, fromID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlUserRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	user := User{Username: username}
+	var email sql.NullString
+	var verifiedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT password, role, email, email_verified_at, created_at FROM users WHERE username = ?", username,
+	).Scan(&user.PasswordHash, &user.Role, &email, &verifiedAt, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	user.Email = email.String
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	return user, nil
+}
+
+func (r *sqlUserRepository) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER(?))", username,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqlUserRepository) GetRole(ctx context.Context, username string) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx, "SELECT role FROM users WHERE username = ?", username).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return role, err
+}
+
+func (r *sqlUserRepository) SetRole(ctx context.Context, username, role string) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// 同じロールを指定し直した場合も0行になるので、アカウントがあるかを確かめる
+		var exists bool
+		if err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
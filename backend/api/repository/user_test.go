@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openSQLite ローカル開発用のスキーマを適用したメモリ上のSQLiteを開く
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	schema, err := os.ReadFile("../../server/db_sqlite.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// メモリ上のデータベースは接続ごとに別になるため、1つの接続だけを使う
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCreateUserConflict(t *testing.T) {
+	users := newSQLUserRepository(openSQLite(t), DialectFor(DriverSQLite))
+	ctx := context.Background()
+
+	if err := users.Create(ctx, NewUser{Username: "alice", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "Alice"} {
+		if err := users.Create(ctx, NewUser{Username: username, PasswordHash: "hash"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("Create(%q) = %v, want ErrConflict", username, err)
+		}
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	users := newSQLUserRepository(openSQLite(t), DialectFor(DriverSQLite))
+	ctx := context.Background()
+
+	if err := users.Create(ctx, NewUser{Username: "alice", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	// 同じロールを指定し直してもアカウントがあればエラーにしない
+	for _, role := range []string{"admin", "admin"} {
+		if err := users.SetRole(ctx, "alice", role); err != nil {
+			t.Fatalf("SetRole(%q) = %v", role, err)
+		}
+	}
+	if role, err := users.GetRole(ctx, "alice"); err != nil || role != "admin" {
+		t.Errorf("GetRole = %q, %v, want admin", role, err)
+	}
+	if err := users.SetRole(ctx, "bob", "admin"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetRole(bob) = %v, want ErrNotFound", err)
+	}
+	if _, err := users.GetRole(ctx, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRole(bob) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,264 @@
+package season
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sys3/api/logging"
+	"sys3/api/rate"
+	"sys3/api/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SoftResetFactor シーズン切り替え時に平均からの差を何倍に縮めるか
+// 0.5なら平均より200高いプレイヤーは100高い位置から次のシーズンを始める
+const SoftResetFactor = 0.5
+
+// ListSeasonsHandler 全てのシーズンを返すハンドラー
+func ListSeasonsHandler(seasons repository.SeasonRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := seasons.Seasons(r.Context())
+		if err != nil {
+			http.Error(w, "シーズンの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		response := make([]SeasonResponse, 0, len(list))
+		for _, s := range list {
+			response = append(response, SeasonResponse{Season: s, Status: s.Status(now)})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// CurrentSeasonHandler 開催中のシーズンを返すハンドラー
+func CurrentSeasonHandler(seasons repository.SeasonRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, err := seasons.CurrentSeason(r.Context(), time.Now())
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "開催中のシーズンはありません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "シーズンの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SeasonResponse{Season: s, Status: s.Status(time.Now())})
+	}
+}
+
+// SeasonRatingsHandler 終了したシーズンの最終順位を返すハンドラー
+// ?game_type= でゲームの種類を指定できる(デフォルト: quiz)
+func SeasonRatingsHandler(seasons repository.SeasonRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seasonID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "無効なシーズンIDです", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit <= 0 || limit > 100 {
+			limit = 100
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset < 0 {
+			offset = 0
+		}
+
+		gameType := rate.NormalizeGameType(r.URL.Query().Get("game_type"))
+
+		ratings, err := seasons.SeasonRatings(r.Context(), seasonID, gameType, limit, offset)
+		if err != nil {
+			http.Error(w, "シーズンの成績の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if ratings == nil {
+			ratings = []SeasonRating{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ratings)
+	}
+}
+
+// CreateSeasonHandler 管理者がシーズンを作成するハンドラー
+func CreateSeasonHandler(seasons repository.SeasonRepository, pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateSeasonRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" || !req.EndsAt.After(req.StartsAt) {
+			http.Error(w, "シーズン名と、開始日時より後の終了日時が必要です", http.StatusBadRequest)
+			return
+		}
+
+		if !poolExists(w, r, pools, req.QuestionPoolID) {
+			return
+		}
+
+		id, err := seasons.CreateSeason(r.Context(), Season{
+			Name:           req.Name,
+			StartsAt:       req.StartsAt,
+			EndsAt:         req.EndsAt,
+			Rewards:        req.Rewards,
+			QuestionPoolID: req.QuestionPoolID,
+		})
+		// 期間が重なるシーズンは作成できない
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "期間が重なるシーズンがあります", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "シーズンの作成に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "シーズンを作成しました",
+			"id":      id,
+		})
+	}
+}
+
+// SetPoolHandler 管理者がシーズンの出題に使う問題のプールを変更するハンドラー
+func SetPoolHandler(seasons repository.SeasonRepository, pools repository.PoolRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seasonID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "無効なシーズンIDです", http.StatusBadRequest)
+			return
+		}
+		var req SetPoolRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "無効なリクエストデータです", http.StatusBadRequest)
+			return
+		}
+		if !poolExists(w, r, pools, req.QuestionPoolID) {
+			return
+		}
+
+		err = seasons.SetSeasonPool(r.Context(), seasonID, req.QuestionPoolID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "シーズンが見つかりません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "シーズンの更新に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// poolExists 指定された問題のプールがあるかを確かめる。nilは指定なしとして扱う
+// ない場合はレスポンスを書き込んでfalseを返す
+func poolExists(w http.ResponseWriter, r *http.Request, pools repository.PoolRepository, poolID *int) bool {
+	if poolID == nil {
+		return true
+	}
+	_, err := pools.GetPool(r.Context(), *poolID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "問題のプールが見つかりません", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "データベースエラー", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// CurrentQuestionPool 開催中のシーズンに設定されている問題のプールのIDを返す。なければ0
+func CurrentQuestionPool(ctx context.Context, seasons repository.SeasonRepository, now time.Time) (int, error) {
+	s, err := seasons.CurrentSeason(ctx, now)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil || s.QuestionPoolID == nil {
+		return 0, err
+	}
+	return *s.QuestionPoolID, nil
+}
+
+// RolloverHandler 管理者が終了日時を待たずにシーズンを切り替えるハンドラー
+func RolloverHandler(seasons repository.SeasonRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, err := seasons.CurrentSeason(r.Context(), time.Now())
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "開催中のシーズンはありません", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "シーズンの取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		if err := FinalizeSeason(r.Context(), seasons, s.ID); err != nil {
+			http.Error(w, "シーズンの切り替えに失敗しました", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "シーズンを終了しました",
+			"season_id": s.ID,
+		})
+	}
+}
+
+// FinalizeSeason シーズンの最終順位を保存し、現在のレートを平均に向けてソフトリセットする
+// 順位と平均はゲームの種類ごとに計算する
+func FinalizeSeason(ctx context.Context, seasons repository.SeasonRepository, seasonID int) error {
+	if err := seasons.FinalizeSeason(ctx, seasonID, SoftResetFactor); err != nil {
+		return err
+	}
+	// レートをまとめてリセットしたので、キャッシュしているランキングを作り直させる
+	rate.InvalidateLeaderboards()
+	return nil
+}
+
+// StartScheduler 終了日時を過ぎたシーズンを定期的に確認して切り替える
+func StartScheduler(seasons repository.SeasonRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// シーズンの終了処理は全プレイヤーのレートを書き換えるので、制限時間は確認間隔にする
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			rolloverExpired(ctx, seasons, time.Now())
+			cancel()
+		}
+	}()
+}
+
+// rolloverExpired 終了日時を過ぎたのに未処理のシーズンを全て終了させる
+func rolloverExpired(ctx context.Context, seasons repository.SeasonRepository, now time.Time) {
+	ids, err := seasons.ExpiredSeasons(ctx, now)
+	if err != nil {
+		slog.Error("シーズンの確認エラー", logging.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		if err := FinalizeSeason(ctx, seasons, id); err != nil {
+			slog.Error("シーズンの終了処理エラー", "season_id", id, logging.Err(err))
+			continue
+		}
+		slog.Info("シーズンを終了しました", "season_id", id)
+	}
+}
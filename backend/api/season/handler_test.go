@@ -0,0 +1,110 @@
+package season
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sys3/api/repository"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newRouter(seasons repository.SeasonRepository, pools repository.PoolRepository) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/seasons/current", CurrentSeasonHandler(seasons)).Methods("GET")
+	r.HandleFunc("/seasons/{id}/ratings", SeasonRatingsHandler(seasons)).Methods("GET")
+	r.HandleFunc("/admin/seasons", CreateSeasonHandler(seasons, pools)).Methods("POST")
+	r.HandleFunc("/admin/seasons/{id}/pool", SetPoolHandler(seasons, pools)).Methods("PUT")
+	r.HandleFunc("/admin/seasons/rollover", RolloverHandler(seasons)).Methods("POST")
+	return r
+}
+
+func do(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func seasonBody(name string, start, end time.Time, extra string) string {
+	body, _ := json.Marshal(map[string]interface{}{"name": name, "starts_at": start, "ends_at": end})
+	if extra == "" {
+		return string(body)
+	}
+	return strings.TrimSuffix(string(body), "}") + "," + extra + "}"
+}
+
+func TestCreateSeason(t *testing.T) {
+	seasons := repository.NewMemorySeasonRepository()
+	pools := repository.NewMemoryPoolRepository()
+	router := newRouter(seasons, pools)
+	now := time.Now()
+
+	if rec := do(router, "POST", "/admin/seasons", seasonBody("S1", now.Add(-time.Hour), now.Add(time.Hour), "")); rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	// 期間が重なるシーズンは作成できない
+	if rec := do(router, "POST", "/admin/seasons", seasonBody("S2", now, now.Add(2*time.Hour), "")); rec.Code != http.StatusConflict {
+		t.Errorf("overlap: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	// 存在しないプールは指定できない
+	if rec := do(router, "POST", "/admin/seasons", seasonBody("S2", now.Add(time.Hour), now.Add(2*time.Hour), `"question_pool_id":1`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown pool: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	poolID, err := pools.CreatePool(context.Background(), repository.QuestionPool{Name: "歴史", QuestionCount: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(router, "PUT", "/admin/seasons/1/pool", `{"question_pool_id":1}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("set pool: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := do(router, "PUT", "/admin/seasons/9/pool", `{"question_pool_id":1}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown season: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	id, err := CurrentQuestionPool(context.Background(), seasons, now)
+	if err != nil || id != poolID {
+		t.Errorf("CurrentQuestionPool = %d, %v, want %d", id, err, poolID)
+	}
+}
+
+func TestRollover(t *testing.T) {
+	seasons := repository.NewMemorySeasonRepository()
+	router := newRouter(seasons, repository.NewMemoryPoolRepository())
+	now := time.Now()
+	if _, err := seasons.CreateSeason(context.Background(), Season{Name: "S1", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	seasons.SetRating("alice", "quiz", 1700)
+	seasons.SetRating("bob", "quiz", 1500)
+	seasons.SetRating("carol", "quiz", 1300)
+
+	if rec := do(router, "POST", "/admin/seasons/rollover", ""); rec.Code != http.StatusOK {
+		t.Fatalf("rollover: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := do(router, "GET", "/seasons/current", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("current after rollover: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(router, "POST", "/admin/seasons/rollover", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("rollover twice: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec := do(router, "GET", "/seasons/1/ratings", "")
+	var ratings []SeasonRating
+	if err := json.NewDecoder(rec.Body).Decode(&ratings); err != nil {
+		t.Fatal(err)
+	}
+	if len(ratings) != 3 || ratings[0].Username != "alice" || ratings[0].FinalRank != 1 || ratings[0].Rating != 1700 {
+		t.Errorf("ratings = %+v", ratings)
+	}
+	// 平均(1500)からの差を半分にする
+	if got := seasons.Rating("alice", "quiz"); got != 1600 {
+		t.Errorf("alice = %d, want 1600", got)
+	}
+	if got := seasons.Rating("carol", "quiz"); got != 1400 {
+		t.Errorf("carol = %d, want 1400", got)
+	}
+}
@@ -0,0 +1,34 @@
+package season
+
+import (
+	"encoding/json"
+	"sys3/api/repository"
+	"time"
+)
+
+// Season レーティングのシーズン
+type Season = repository.Season
+
+// SeasonResponse APIで返すシーズンの情報
+type SeasonResponse struct {
+	Season
+	Status string `json:"status"`
+}
+
+// SeasonRating シーズン終了時点のプレイヤーの成績
+type SeasonRating = repository.SeasonRating
+
+// CreateSeasonRequest シーズン作成のリクエスト
+type CreateSeasonRequest struct {
+	Name     string          `json:"name"`
+	StartsAt time.Time       `json:"starts_at"`
+	EndsAt   time.Time       `json:"ends_at"`
+	Rewards  json.RawMessage `json:"rewards"`
+	// 出題に使う問題のプール。省略した場合は全ての問題から出題する
+	QuestionPoolID *int `json:"question_pool_id"`
+}
+
+// SetPoolRequest シーズンの問題のプールを変更するリクエスト。nullでプールの指定を外す
+type SetPoolRequest struct {
+	QuestionPoolID *int `json:"question_pool_id"`
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// トレーサーの名前。スパンがどのライブラリで作られたかとして記録される
+const instrumentationName = "sys3"
+
+// 送信されていないスパンを書き出すのにかけられる時間
+const shutdownTimeout = 5 * time.Second
+
+// Setup スパンをOTLP(HTTP)で送信するように設定し、終了時に呼ぶ関数を返す
+// 送信先やサンプリングの割合は OTEL_EXPORTER_OTLP_ENDPOINT、OTEL_TRACES_SAMPLER などの標準の環境変数で設定する
+// 呼ばなかった場合、スパンは作られるだけでどこにも送信されない
+func Setup(ctx context.Context, serviceName string) (func(), error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME や OTEL_RESOURCE_ATTRIBUTES が設定されていれば、そちらを優先する
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	// 呼び出し元から traceparent ヘッダーで渡されたトレースを引き継ぐ
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		provider.Shutdown(ctx)
+	}, nil
+}
+
+// FromRequest リクエストの traceparent ヘッダーで渡されたトレースを引き継いだコンテキストを返す
+func FromRequest(r *http.Request) context.Context {
+	return otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// Tracer スパンを作るトレーサーを返す
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start ctxのスパンの子としてスパンを始める
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Fail errをスパンに記録し、スパンを失敗として終える。errがnilなら何もしない
+func Fail(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID ctxのスパンのトレースIDを返す。記録していなければ空文字
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
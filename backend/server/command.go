@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sys3/api/backup"
+	"sys3/api/question"
+	"sys3/api/repository"
+)
+
+// runCommand サーバーを起動せずに実行するサブコマンド
+//
+//	backup  [-tables core|questions|テーブル名,...] [-o ファイル]  テーブルの内容を書き出す
+//	restore [-replace] [-i ファイル]                             書き出した内容を読み込む
+//	import  [-format csv|json] [-dry-run] [-creator ユーザー名] [-i ファイル]  問題をまとめて追加する
+//
+// ファイルを指定しない場合は標準入出力を使う。終了コードを返す
+func runCommand(db *sql.DB, dialect repository.Dialect, args []string) int {
+	switch args[0] {
+	case "backup":
+		return runBackup(db, dialect, args[1:])
+	case "restore":
+		return runRestore(db, dialect, args[1:])
+	case "import":
+		return runImport(db, dialect, args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "不明なコマンドです: %s (backup, restore, import)\n", args[0])
+	return 2
+}
+
+// backupTables -tablesの指定を書き出すテーブルの一覧に変換する
+// 誤って他のテーブルを書き出さないように、CoreTablesに含まれるものだけを受け付ける
+func backupTables(spec string) ([]string, error) {
+	switch spec {
+	case "", "core":
+		return backup.CoreTables, nil
+	case "questions":
+		return backup.QuestionTables, nil
+	}
+	known := make(map[string]bool, len(backup.CoreTables))
+	for _, name := range backup.CoreTables {
+		known[name] = true
+	}
+	var tables []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return nil, fmt.Errorf("書き出せないテーブルです: %s", name)
+		}
+		tables = append(tables, name)
+	}
+	return tables, nil
+}
+
+func runBackup(db *sql.DB, dialect repository.Dialect, args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	spec := flags.String("tables", "core", "書き出すテーブル(core, questions またはカンマ区切りのテーブル名)")
+	output := flags.String("o", "", "書き出し先のファイル(省略時は標準出力)")
+	flags.Parse(args)
+
+	tables, err := backupTables(*spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ファイルを作成できません:", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := backup.Export(context.Background(), db, dialect, tables, w); err != nil {
+		fmt.Fprintln(os.Stderr, "書き出しに失敗しました:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d個のテーブルを書き出しました\n", len(tables))
+	return 0
+}
+
+func runRestore(db *sql.DB, dialect repository.Dialect, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	replace := flags.Bool("replace", false, "既存の行を削除してから読み込む")
+	input := flags.String("i", "", "読み込むファイル(省略時は標準入力)")
+	flags.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ファイルを開けません:", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+	n, err := backup.Import(context.Background(), db, dialect, r, *replace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "読み込みに失敗しました:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d行を読み込みました\n", n)
+	return 0
+}
+
+// runImport 問題のファイルを取り込む。行ごとの結果はJSONで標準出力に書き出す
+// 誤りのある行が1つでもあれば終了コード1を返す
+func runImport(db *sql.DB, dialect repository.Dialect, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "ファイルの形式(csv, json。省略時は拡張子から判断する)")
+	dryRun := flags.Bool("dry-run", false, "検証だけを行い保存しない")
+	creator := flags.String("creator", "", "作成者として記録するユーザー名")
+	input := flags.String("i", "", "読み込むファイル(省略時は標準入力)")
+	flags.Parse(args)
+
+	kind, err := question.DetectFormat(*format, "", *input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ファイルを開けません:", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+	rows, err := question.ParseImport(r, kind)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "読み込みに失敗しました:", err)
+		return 1
+	}
+
+	questions := repository.NewSQLWithDialect(db, dialect).Questions
+	report := question.Import(context.Background(), questions, rows, *creator, *dryRun)
+	for _, row := range report.Rows {
+		if row.Error != "" {
+			fmt.Fprintf(os.Stderr, "%d行目: %s\n", row.Row, row.Error)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "%d問中%d問が取り込めます(誤り%d件)\n", report.Total, report.Valid, report.Invalid)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d問中%d問を取り込みました(誤り%d件, 保存失敗%d件)\n", report.Total, report.Imported, report.Invalid, report.Failed)
+	}
+	if report.Invalid > 0 || report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
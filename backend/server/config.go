@@ -0,0 +1,848 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sys3/api/alert"
+	"sys3/api/events"
+	"sys3/api/logging"
+	"sys3/api/matchmaking"
+	"sys3/api/oauth"
+	"sys3/api/question"
+	"sys3/api/rate"
+	"sys3/api/repository"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config サーバーの設定
+// デフォルト値の上に CONFIG_FILE で指定したYAMLファイル、環境変数の順に読み込み、後から読んだものを優先する
+// 例:
+//
+//	server:
+//	  port: 8080
+//	database:
+//	  driver: mysql
+//	  query_timeout: 3s
+//	matchmaking:
+//	  questions_per_game: 5
+//	  allowed_origins: ["https://quiz.example.com"]
+//
+// 項目ごとの環境変数は各フィールドのコメントを参照
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Matchmaking MatchmakingConfig `yaml:"matchmaking"`
+	Log         LogConfig         `yaml:"log"`
+	Alert       AlertConfig       `yaml:"alert"`
+	Events      EventsConfig      `yaml:"events"`
+	Cluster     ClusterConfig     `yaml:"cluster"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Question    QuestionConfig    `yaml:"question"`
+	Mail        MailConfig        `yaml:"mail"`
+	OAuth       OAuthConfig       `yaml:"oauth"`
+	Rating      RatingConfig      `yaml:"rating"`
+}
+
+// ServerConfig HTTPサーバーの設定
+type ServerConfig struct {
+	Port           int      `yaml:"port"`            // PORT
+	MetricsToken   string   `yaml:"metrics_token"`   // METRICS_TOKEN: /metricsに必要なトークン。空なら誰でも取得できる
+	TrustedProxies []string `yaml:"trusted_proxies"` // TRUSTED_PROXIES: X-Forwarded-Forを信頼するプロキシ(カンマ区切り)
+	Region         string   `yaml:"region"`          // REGION: 対戦のメトリクスのregionラベルに付ける地域。空ならラベルも空
+
+	// SHUTDOWN_GRACE: 停止するときに、進行中の対戦がそのまま終わるのを待つ時間
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"`
+	// SHUTDOWN_TIMEOUT: 停止するときに、処理中のリクエストや対戦結果の保存が終わるのを待つ時間
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DatabaseConfig データベースへの接続の設定
+type DatabaseConfig struct {
+	// DB_DRIVER: "mysql"(デフォルト)、"postgres" または "sqlite3"
+	// 未設定の場合はURLから判断する(postgres:// ならPostgreSQL、file: ならSQLite)
+	// PostgreSQLのスキーマは db_postgres.sql。SQLiteはローカル開発用
+	Driver string `yaml:"driver"`
+	// DATABASE_URL: 接続文字列。未設定ならドライバーごとのローカル開発用の接続先を使う
+	URL string `yaml:"url"`
+	// READ_DATABASE_URL: 問題とランキングの読み取りに使うデータベース
+	ReadURL string `yaml:"read_url"`
+	// READ_DATABASE_RETRY_AFTER: エラーの後、再び読み取り用のデータベースを使うまでの時間
+	ReadRetryAfter time.Duration `yaml:"read_retry_after"`
+	// QUERY_TIMEOUT: 1回のデータベース操作にかけられる時間
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+	// SLOW_QUERY_THRESHOLD: これより時間のかかったクエリをログに記録する。0なら記録しない
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+	// DB_HEALTH_INTERVAL: 接続できている間にPingする間隔
+	HealthInterval time.Duration `yaml:"health_interval"`
+	// DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME: 接続プール
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// MatchmakingConfig マッチングと対戦、WebSocket接続の設定
+type MatchmakingConfig struct {
+	QuestionsPerGame  int           `yaml:"questions_per_game"`  // QUESTIONS_PER_GAME
+	MatchTimeout      time.Duration `yaml:"match_timeout"`       // MATCH_TIMEOUT: 対戦相手を待つ時間
+	QuestionDelay     time.Duration `yaml:"question_delay"`      // QUESTION_DELAY: 出題から回答権の受付までの時間
+	BuzzTimeout       time.Duration `yaml:"buzz_timeout"`        // BUZZ_TIMEOUT: 回答権の受付時間
+	AnswerTimeout     time.Duration `yaml:"answer_timeout"`      // ANSWER_TIMEOUT: 回答権を得てから回答するまでの時間
+	NextQuestionDelay time.Duration `yaml:"next_question_delay"` // NEXT_QUESTION_DELAY: 次の問題までの時間
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // IDLE_TIMEOUT: 何もしていない接続を切断するまでの時間。0なら切断しない
+
+	// このインスタンスで同時に進める対戦の数。上限に達している間のマッチングは、枠が空くまで開始を待たせる
+	MaxSessions         int           `yaml:"max_sessions"`          // MAX_SESSIONS: 同時に進める対戦の上限。0なら制限しない
+	MaxQueuedSessions   int           `yaml:"max_queued_sessions"`   // MAX_QUEUED_SESSIONS: 開始を待たせておける対戦の数
+	SessionQueueTimeout time.Duration `yaml:"session_queue_timeout"` // SESSION_QUEUE_TIMEOUT: 開始を待たせておける最長時間
+
+	// ALLOWED_ORIGINS: WebSocketの接続を許可するオリジン(カンマ区切り。"https://*.example.com" も指定できる)
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// DEV_MODE: trueなら全てのオリジンを許可する(開発環境専用)
+	DevMode bool `yaml:"dev_mode"`
+	// DEVICE_POLICY: 複数端末から接続した場合の扱い(kick_old, reject_new, allow)
+	DevicePolicy string `yaml:"device_policy"`
+
+	MaxMessageSize    int64         `yaml:"max_message_size"`    // WS_MAX_MESSAGE_SIZE: 受信できる1メッセージの最大バイト数
+	PongWait          time.Duration `yaml:"pong_wait"`           // WS_PONG_WAIT: この時間内に何も受信しなければ切断する
+	PingPeriod        time.Duration `yaml:"ping_period"`         // WS_PING_PERIOD: Pingの送信間隔
+	WriteWait         time.Duration `yaml:"write_wait"`          // WS_WRITE_WAIT: 1メッセージの書き込みにかけられる時間
+	OutboundQueueSize int           `yaml:"outbound_queue_size"` // WS_OUTBOUND_QUEUE_SIZE: 送信待ちにできるメッセージ数
+	IncomingQueueSize int           `yaml:"incoming_queue_size"` // WS_INCOMING_QUEUE_SIZE: 処理待ちにできる受信メッセージ数
+	ReadBufferSize    int           `yaml:"read_buffer_size"`    // WS_READ_BUFFER_SIZE
+	WriteBufferSize   int           `yaml:"write_buffer_size"`   // WS_WRITE_BUFFER_SIZE
+
+	// これより時間のかかった処理をログに記録する。0なら記録しない
+	SlowQuestionFetch time.Duration `yaml:"slow_question_fetch"` // SLOW_QUESTION_FETCH_THRESHOLD: 対戦で出題する問題の取得
+	SlowWrite         time.Duration `yaml:"slow_write"`          // SLOW_WRITE_THRESHOLD: 1メッセージの書き込み
+	SlowFinalize      time.Duration `yaml:"slow_finalize"`       // SLOW_FINALIZE_THRESHOLD: 対戦結果とレートの保存
+}
+
+// LogConfig ログの設定
+type LogConfig struct {
+	Format string `yaml:"format"` // LOG_FORMAT: json(本番向け)かtext(デフォルト。開発向け)
+	Level  string `yaml:"level"`  // LOG_LEVEL: debug, info(デフォルト), warn, error
+	// LOG_UNREDACTED: trueならCookieの値・トークン・メールアドレスを伏せずに出力する
+	// ローカルでの開発専用のため、DEV_MODEも有効にしないと起動しない
+	Unredacted bool `yaml:"unredacted"`
+}
+
+// AlertConfig エラーが続いたときの通知の設定。通知先がなければログに出力する
+type AlertConfig struct {
+	WebhookURL      string `yaml:"webhook_url"`       // ALERT_WEBHOOK_URL: アラートをJSONでPOSTするURL
+	SlackWebhookURL string `yaml:"slack_webhook_url"` // ALERT_SLACK_WEBHOOK_URL: SlackのIncoming WebhookのURL
+	// ALERT_COOLDOWN: 通知した後、同じアラートを通知しない時間
+	Cooldown time.Duration `yaml:"cooldown"`
+
+	// ALERT_RATING_FAILURE_THRESHOLD, ALERT_RATING_FAILURE_WINDOW: レートの更新の失敗が期間内にこの回数を超えたら通知する。0なら通知しない
+	RatingFailureThreshold int           `yaml:"rating_failure_threshold"`
+	RatingFailureWindow    time.Duration `yaml:"rating_failure_window"`
+	// ALERT_ABNORMAL_CLOSE_THRESHOLD, ALERT_ABNORMAL_CLOSE_WINDOW: WebSocketの異常切断が期間内にこの回数を超えたら通知する。0なら通知しない
+	AbnormalCloseThreshold int           `yaml:"abnormal_close_threshold"`
+	AbnormalCloseWindow    time.Duration `yaml:"abnormal_close_window"`
+}
+
+// 対戦のイベントの送信先
+const (
+	EventSinkNone        = "none"
+	EventSinkRedisStream = "redis_stream"
+)
+
+// EventsConfig 分析基盤に対戦のイベントを送る設定
+type EventsConfig struct {
+	Sink        string `yaml:"sink"`         // EVENT_SINK: none(デフォルト。送らない)か redis_stream
+	RedisURL    string `yaml:"redis_url"`    // EVENT_REDIS_URL: redis://形式のURL
+	RedisStream string `yaml:"redis_stream"` // EVENT_REDIS_STREAM: XADDするストリームの名前
+	// EVENT_REDIS_MAXLEN: ストリームに残すおおよその件数。0なら削らない
+	RedisMaxLen int64 `yaml:"redis_max_len"`
+	// EVENT_PUBLISH_INTERVAL: 送信に失敗したイベントを送り直す間隔
+	PublishInterval time.Duration `yaml:"publish_interval"`
+}
+
+// ClusterConfig 複数のインスタンスでマッチングする設定
+type ClusterConfig struct {
+	// CLUSTER_REDIS_URL: 待ち行列の共有と対戦の中継に使うRedis(redis://形式)。空なら1つのインスタンスの中だけでマッチングする
+	RedisURL string `yaml:"redis_url"`
+	// CLUSTER_INSTANCE_ID: インスタンスごとに異なる名前。デフォルトはホスト名
+	InstanceID string `yaml:"instance_id"`
+	// CLUSTER_JOIN_TIMEOUT: 別のインスタンスの部屋への参加の応答を待つ時間
+	JoinTimeout time.Duration `yaml:"join_timeout"`
+}
+
+// AuthConfig ログインの設定
+type AuthConfig struct {
+	// AUTH_SECRET: トークンの署名鍵。空なら起動ごとにランダムに作るため、複数のインスタンスで動かす場合は必須
+	Secret    string `yaml:"secret"`
+	GuestMode bool   `yaml:"guest_mode"` // GUEST_MODE: trueならゲストでの対戦を受け付ける
+}
+
+// QuestionConfig 問題の出題・投稿と定期的な処理の設定
+type QuestionConfig struct {
+	// QUESTION_CACHE: 対戦中の出題をメモリに保持した問題から行う(offで無効)
+	Cache bool `yaml:"cache"`
+	// QUESTION_CACHE_TTL: 他のサーバーでの変更を取り込むために読み込み直す間隔。0ならリポジトリのデフォルト
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	SubmissionLimit  int           `yaml:"submission_limit"`  // QUESTION_SUBMISSION_LIMIT: プレイヤーが投稿できる問題の数。0なら無制限
+	SubmissionWindow time.Duration `yaml:"submission_window"` // QUESTION_SUBMISSION_WINDOW: 投稿数を数える期間
+	// QUESTION_REPORT_THRESHOLD: 未対応の報告がこの数に達した問題は出題を停止する。0なら停止しない
+	ReportThreshold int `yaml:"report_threshold"`
+	// QUESTION_LOCALES: 問題を翻訳する言語(カンマ区切り 例: en,zh-Hans)
+	Locales []string `yaml:"locales"`
+
+	// QUESTION_CALIBRATION_INTERVAL: 回答の集計から難易度を計算し直す間隔。0(環境変数ではoff)なら計算しない
+	CalibrationInterval time.Duration `yaml:"calibration_interval"`
+	// QUESTION_ROTATION_INTERVAL: 出題を始める・終える日時になった問題を確認する間隔。0(環境変数ではoff)なら切り替えない
+	RotationInterval time.Duration `yaml:"rotation_interval"`
+
+	// TRIVIA_INGEST_INTERVAL: 外部の問題集から問題を取り込む間隔。0なら取り込まない
+	IngestInterval time.Duration `yaml:"ingest_interval"`
+	IngestSource   string        `yaml:"ingest_source"` // TRIVIA_INGEST_SOURCE: 取り込む問題集
+	IngestAmount   int           `yaml:"ingest_amount"` // TRIVIA_INGEST_AMOUNT: 1回に取り込む問題の数
+}
+
+// MailConfig メールアドレスの確認とパスワード再設定のメールの設定
+type MailConfig struct {
+	SMTPAddr     string `yaml:"smtp_addr"`     // SMTP_ADDR: 空ならメールを送らずログに出力する
+	SMTPFrom     string `yaml:"smtp_from"`     // SMTP_FROM: 送信元のアドレス
+	SMTPUsername string `yaml:"smtp_username"` // SMTP_USERNAME
+	SMTPPassword string `yaml:"smtp_password"` // SMTP_PASSWORD
+	// EMAIL_LINK_BASE: メールに載せるリンクのURLの先頭。空ならaccountパッケージのデフォルト
+	LinkBase string `yaml:"link_base"`
+	// REQUIRE_EMAIL_VERIFICATION: trueならランク戦にメールアドレスの確認を必須にする
+	RequireVerification bool `yaml:"require_verification"`
+}
+
+// OAuthConfig 外部サービスでのログインの設定
+type OAuthConfig struct {
+	// OAUTH_CALLBACK_BASE: コールバックのURLの先頭。コールバックは {callback_base}/auth/oauth/{provider}/callback
+	CallbackBase string `yaml:"callback_base"`
+	// OAUTH_SUCCESS_URL: ログインした後に戻るURL。空ならoauthパッケージのデフォルト
+	SuccessURL string `yaml:"success_url"`
+	// OAUTH_{GOOGLE,GITHUB,LINE}_CLIENT_ID, OAUTH_{GOOGLE,GITHUB,LINE}_CLIENT_SECRET: 設定したサービスだけを有効にする
+	Providers map[string]OAuthClientConfig `yaml:"providers"`
+}
+
+// OAuthClientConfig 外部サービスに登録したクライアント
+type OAuthClientConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+}
+
+// oauthProviders 環境変数から読み込む外部サービス
+var oauthProviders = []string{oauth.ProviderGoogle, oauth.ProviderGitHub, oauth.ProviderLINE}
+
+// RatingConfig レーティングのパラメータ。0(空)の項目はrateパッケージのデフォルトを使う
+// RATING_ALGORITHM, RATING_K_FACTOR, RATING_INITIAL, RATING_SCALE, RATING_MIN, RATING_MAX,
+// RATING_PROTECTED_TIERS(カンマ区切り)
+type RatingConfig struct {
+	rate.RatingConfig `yaml:",inline"`
+	// RATING_GAME_TYPES: ゲームの種類ごとの上書き(JSON 例: {"quiz": {"algorithm": "glicko2"}})
+	GameTypes map[string]rate.RatingConfig `yaml:"game_types"`
+}
+
+// defaultConfig 設定ファイルも環境変数もない場合の設定
+func defaultConfig() Config {
+	game := matchmaking.DefaultGameConfig()
+	conn := matchmaking.DefaultConnectionConfig()
+	slow := matchmaking.DefaultSlowLogConfig()
+	sched := matchmaking.DefaultSchedulerConfig()
+	ratingFailure := alert.DefaultRule(alert.RatingUpdateFailure)
+	abnormalClose := alert.DefaultRule(alert.AbnormalClose)
+	return Config{
+		Server: ServerConfig{Port: 8080, ShutdownGrace: 20 * time.Second, ShutdownTimeout: 10 * time.Second},
+		Database: DatabaseConfig{
+			QueryTimeout:       repository.DefaultQueryTimeout,
+			SlowQueryThreshold: repository.DefaultSlowQueryThreshold,
+			HealthInterval:     repository.DefaultHealthInterval,
+			MaxOpenConns:       repository.DefaultPoolConfig.MaxOpenConns,
+			MaxIdleConns:       repository.DefaultPoolConfig.MaxIdleConns,
+			ConnMaxLifetime:    repository.DefaultPoolConfig.ConnMaxLifetime,
+		},
+		Matchmaking: MatchmakingConfig{
+			QuestionsPerGame:  game.QuestionsPerGame,
+			MatchTimeout:      game.MatchTimeout,
+			QuestionDelay:     game.QuestionDelay,
+			BuzzTimeout:       game.BuzzTimeout,
+			AnswerTimeout:     game.AnswerTimeout,
+			NextQuestionDelay: game.NextQuestionDelay,
+			IdleTimeout:       matchmaking.DefaultIdleConfig().Timeout,
+			AllowedOrigins:    []string{"http://localhost:3000"},
+			DevicePolicy:      matchmaking.DevicePolicyKickOld,
+			MaxMessageSize:    conn.MaxMessageSize,
+			PongWait:          conn.PongWait,
+			PingPeriod:        conn.PingPeriod,
+			WriteWait:         conn.WriteWait,
+			OutboundQueueSize: conn.OutboundQueueSize,
+			IncomingQueueSize: conn.IncomingQueueSize,
+			ReadBufferSize:    conn.ReadBufferSize,
+			WriteBufferSize:   conn.WriteBufferSize,
+			SlowQuestionFetch: slow.QuestionFetch,
+			SlowWrite:         slow.Write,
+			SlowFinalize:      slow.Finalize,
+
+			MaxSessions:         sched.MaxSessions,
+			MaxQueuedSessions:   sched.MaxQueued,
+			SessionQueueTimeout: sched.QueueTimeout,
+		},
+		Log: LogConfig{Format: logging.FormatText, Level: "info"},
+		Alert: AlertConfig{
+			Cooldown:               ratingFailure.Cooldown,
+			RatingFailureThreshold: ratingFailure.Threshold,
+			RatingFailureWindow:    ratingFailure.Window,
+			AbnormalCloseThreshold: abnormalClose.Threshold,
+			AbnormalCloseWindow:    abnormalClose.Window,
+		},
+		Cluster: ClusterConfig{
+			InstanceID:  hostname(),
+			JoinTimeout: 5 * time.Second,
+		},
+		Events: EventsConfig{
+			Sink:            EventSinkNone,
+			RedisStream:     "quiz:match_events",
+			RedisMaxLen:     100000,
+			PublishInterval: time.Second,
+		},
+		Question: QuestionConfig{
+			Cache:               true,
+			SubmissionLimit:     10,
+			SubmissionWindow:    24 * time.Hour,
+			ReportThreshold:     3,
+			CalibrationInterval: time.Hour,
+			RotationInterval:    time.Minute,
+			IngestSource:        "opentdb",
+			IngestAmount:        10,
+		},
+		OAuth: OAuthConfig{CallbackBase: "http://localhost:8080"},
+	}
+}
+
+// loadConfig デフォルト値、CONFIG_FILEのYAMLファイル、環境変数の順に設定を読み込んで確認する
+// 読み込めない値や範囲外の値は、全ての項目をまとめて1つのエラーとして返す
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadConfigFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	env := envLoader{}
+	env.apply(&cfg)
+	cfg.Database.resolve()
+	return cfg, errors.Join(append(env.errs, cfg.validate()...)...)
+}
+
+// loadConfigFile YAMLファイルの値でcfgを上書きする。書かれていない項目はそのまま
+// 項目名の書き間違いに気付けるように、知らない項目があればエラーにする
+func loadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("設定ファイルを開けません: %w", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("設定ファイル %s を読み込めません: %w", path, err)
+	}
+	return nil
+}
+
+// envLoader 環境変数を読み込み、読み込めなかった値をエラーとして溜めておく
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) apply(cfg *Config) {
+	e.int("PORT", &cfg.Server.Port)
+	e.string("REGION", &cfg.Server.Region)
+	e.string("METRICS_TOKEN", &cfg.Server.MetricsToken)
+	e.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	e.duration("SHUTDOWN_GRACE", &cfg.Server.ShutdownGrace)
+	e.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	db := &cfg.Database
+	e.string("DB_DRIVER", &db.Driver)
+	e.string("DATABASE_URL", &db.URL)
+	e.string("READ_DATABASE_URL", &db.ReadURL)
+	e.duration("READ_DATABASE_RETRY_AFTER", &db.ReadRetryAfter)
+	e.duration("QUERY_TIMEOUT", &db.QueryTimeout)
+	e.duration("SLOW_QUERY_THRESHOLD", &db.SlowQueryThreshold)
+	e.duration("DB_HEALTH_INTERVAL", &db.HealthInterval)
+	e.int("DB_MAX_OPEN_CONNS", &db.MaxOpenConns)
+	e.int("DB_MAX_IDLE_CONNS", &db.MaxIdleConns)
+	e.duration("DB_CONN_MAX_LIFETIME", &db.ConnMaxLifetime)
+
+	m := &cfg.Matchmaking
+	e.int("QUESTIONS_PER_GAME", &m.QuestionsPerGame)
+	e.duration("MATCH_TIMEOUT", &m.MatchTimeout)
+	e.duration("QUESTION_DELAY", &m.QuestionDelay)
+	e.duration("BUZZ_TIMEOUT", &m.BuzzTimeout)
+	e.duration("ANSWER_TIMEOUT", &m.AnswerTimeout)
+	e.duration("NEXT_QUESTION_DELAY", &m.NextQuestionDelay)
+	e.duration("IDLE_TIMEOUT", &m.IdleTimeout)
+	e.int("MAX_SESSIONS", &m.MaxSessions)
+	e.int("MAX_QUEUED_SESSIONS", &m.MaxQueuedSessions)
+	e.duration("SESSION_QUEUE_TIMEOUT", &m.SessionQueueTimeout)
+	e.list("ALLOWED_ORIGINS", &m.AllowedOrigins)
+	e.bool("DEV_MODE", &m.DevMode)
+	e.string("DEVICE_POLICY", &m.DevicePolicy)
+	e.int64("WS_MAX_MESSAGE_SIZE", &m.MaxMessageSize)
+	e.duration("WS_PONG_WAIT", &m.PongWait)
+	e.duration("WS_PING_PERIOD", &m.PingPeriod)
+	e.duration("WS_WRITE_WAIT", &m.WriteWait)
+	e.int("WS_OUTBOUND_QUEUE_SIZE", &m.OutboundQueueSize)
+	e.int("WS_INCOMING_QUEUE_SIZE", &m.IncomingQueueSize)
+	e.int("WS_READ_BUFFER_SIZE", &m.ReadBufferSize)
+	e.int("WS_WRITE_BUFFER_SIZE", &m.WriteBufferSize)
+	e.duration("SLOW_QUESTION_FETCH_THRESHOLD", &m.SlowQuestionFetch)
+	e.duration("SLOW_WRITE_THRESHOLD", &m.SlowWrite)
+	e.duration("SLOW_FINALIZE_THRESHOLD", &m.SlowFinalize)
+
+	e.string("LOG_FORMAT", &cfg.Log.Format)
+	e.string("LOG_LEVEL", &cfg.Log.Level)
+	e.bool("LOG_UNREDACTED", &cfg.Log.Unredacted)
+
+	a := &cfg.Alert
+	e.string("ALERT_WEBHOOK_URL", &a.WebhookURL)
+	e.string("ALERT_SLACK_WEBHOOK_URL", &a.SlackWebhookURL)
+	e.duration("ALERT_COOLDOWN", &a.Cooldown)
+	e.int("ALERT_RATING_FAILURE_THRESHOLD", &a.RatingFailureThreshold)
+	e.duration("ALERT_RATING_FAILURE_WINDOW", &a.RatingFailureWindow)
+	e.int("ALERT_ABNORMAL_CLOSE_THRESHOLD", &a.AbnormalCloseThreshold)
+	e.duration("ALERT_ABNORMAL_CLOSE_WINDOW", &a.AbnormalCloseWindow)
+
+	cl := &cfg.Cluster
+	e.string("CLUSTER_REDIS_URL", &cl.RedisURL)
+	e.string("CLUSTER_INSTANCE_ID", &cl.InstanceID)
+	e.duration("CLUSTER_JOIN_TIMEOUT", &cl.JoinTimeout)
+
+	ev := &cfg.Events
+	e.string("EVENT_SINK", &ev.Sink)
+	e.string("EVENT_REDIS_URL", &ev.RedisURL)
+	e.string("EVENT_REDIS_STREAM", &ev.RedisStream)
+	e.int64("EVENT_REDIS_MAXLEN", &ev.RedisMaxLen)
+	e.duration("EVENT_PUBLISH_INTERVAL", &ev.PublishInterval)
+
+	e.string("AUTH_SECRET", &cfg.Auth.Secret)
+	e.bool("GUEST_MODE", &cfg.Auth.GuestMode)
+
+	q := &cfg.Question
+	e.toggle("QUESTION_CACHE", &q.Cache)
+	e.duration("QUESTION_CACHE_TTL", &q.CacheTTL)
+	e.int("QUESTION_SUBMISSION_LIMIT", &q.SubmissionLimit)
+	e.duration("QUESTION_SUBMISSION_WINDOW", &q.SubmissionWindow)
+	e.int("QUESTION_REPORT_THRESHOLD", &q.ReportThreshold)
+	e.list("QUESTION_LOCALES", &q.Locales)
+	e.interval("QUESTION_CALIBRATION_INTERVAL", &q.CalibrationInterval)
+	e.interval("QUESTION_ROTATION_INTERVAL", &q.RotationInterval)
+	e.duration("TRIVIA_INGEST_INTERVAL", &q.IngestInterval)
+	e.string("TRIVIA_INGEST_SOURCE", &q.IngestSource)
+	e.int("TRIVIA_INGEST_AMOUNT", &q.IngestAmount)
+
+	mail := &cfg.Mail
+	e.string("SMTP_ADDR", &mail.SMTPAddr)
+	e.string("SMTP_FROM", &mail.SMTPFrom)
+	e.string("SMTP_USERNAME", &mail.SMTPUsername)
+	e.string("SMTP_PASSWORD", &mail.SMTPPassword)
+	e.string("EMAIL_LINK_BASE", &mail.LinkBase)
+	e.bool("REQUIRE_EMAIL_VERIFICATION", &mail.RequireVerification)
+
+	o := &cfg.OAuth
+	e.string("OAUTH_CALLBACK_BASE", &o.CallbackBase)
+	e.string("OAUTH_SUCCESS_URL", &o.SuccessURL)
+	for _, name := range oauthProviders {
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		client := o.Providers[name]
+		e.string(prefix+"CLIENT_ID", &client.ClientID)
+		e.string(prefix+"CLIENT_SECRET", &client.ClientSecret)
+		if client != (OAuthClientConfig{}) {
+			if o.Providers == nil {
+				o.Providers = make(map[string]OAuthClientConfig)
+			}
+			o.Providers[name] = client
+		}
+	}
+
+	r := &cfg.Rating
+	e.string("RATING_ALGORITHM", &r.Algorithm)
+	e.float("RATING_K_FACTOR", &r.KFactor)
+	e.int("RATING_INITIAL", &r.InitialRating)
+	e.float("RATING_SCALE", &r.Scale)
+	e.int("RATING_MIN", &r.MinRating)
+	e.int("RATING_MAX", &r.MaxRating)
+	e.list("RATING_PROTECTED_TIERS", &r.ProtectedTiers)
+	e.json("RATING_GAME_TYPES", &r.GameTypes)
+}
+
+func (e *envLoader) fail(name, value, format string) {
+	e.errs = append(e.errs, fmt.Errorf("%s=%q: %s", name, value, format))
+}
+
+func (e *envLoader) string(name string, dst *string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+func (e *envLoader) list(name string, dst *[]string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	*dst = (*dst)[:0:0]
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*dst = append(*dst, item)
+		}
+	}
+}
+
+func (e *envLoader) int(name string, dst *int) {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.fail(name, v, "整数で指定してください")
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envLoader) int64(name string, dst *int64) {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			e.fail(name, v, "整数で指定してください")
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envLoader) float(name string, dst *float64) {
+	if v := os.Getenv(name); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			e.fail(name, v, "数値で指定してください")
+			return
+		}
+		*dst = f
+	}
+}
+
+func (e *envLoader) bool(name string, dst *bool) {
+	if v := os.Getenv(name); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			e.fail(name, v, "true か false で指定してください")
+			return
+		}
+		*dst = b
+	}
+}
+
+// toggle on/offでも指定できるbool
+func (e *envLoader) toggle(name string, dst *bool) {
+	switch v := os.Getenv(name); v {
+	case "on":
+		*dst = true
+	case "off":
+		*dst = false
+	default:
+		e.bool(name, dst)
+	}
+}
+
+// interval offを0として読み込む時間
+func (e *envLoader) interval(name string, dst *time.Duration) {
+	if os.Getenv(name) == "off" {
+		*dst = 0
+		return
+	}
+	e.duration(name, dst)
+}
+
+func (e *envLoader) json(name string, dst interface{}) {
+	if v := os.Getenv(name); v != "" {
+		if err := json.Unmarshal([]byte(v), dst); err != nil {
+			e.fail(name, v, "JSONで指定してください: "+err.Error())
+		}
+	}
+}
+
+func (e *envLoader) duration(name string, dst *time.Duration) {
+	if v := os.Getenv(name); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.fail(name, v, `時間は "30s" や "5m" のように単位を付けて指定してください`)
+			return
+		}
+		*dst = d
+	}
+}
+
+// resolve ドライバーが指定されていなければURLから判断し、URLが未設定ならローカル開発用の接続先にする
+func (c *DatabaseConfig) resolve() {
+	if c.Driver == "" {
+		c.Driver = repository.DriverMySQL
+		if strings.HasPrefix(c.URL, "postgres://") || strings.HasPrefix(c.URL, "postgresql://") {
+			c.Driver = repository.DriverPostgres
+		} else if strings.HasPrefix(c.URL, "file:") {
+			c.Driver = repository.DriverSQLite
+		}
+	}
+	if c.URL == "" {
+		switch c.Driver {
+		case repository.DriverMySQL:
+			// DATETIMEをtime.Timeとして読み取るためparseTimeを有効にする
+			c.URL = "root:root@tcp(localhost:3306)/sys3?parseTime=true"
+		case repository.DriverSQLite:
+			// 対戦中の書き込みが重なっても待つようにする
+			c.URL = "file:sys3.db?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on"
+		}
+	}
+}
+
+// validate 範囲外や矛盾した値を、YAMLの項目名と対応する環境変数を付けて全て返す
+func (c Config) validate() []error {
+	var errs []error
+	check := func(ok bool, key, env, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s (%s): %s", key, env, fmt.Sprintf(format, args...)))
+		}
+	}
+	isURL := func(s string) bool {
+		return s == "" || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port", "PORT", "1〜65535で指定してください(値: %d)", c.Server.Port)
+	check(c.Server.ShutdownGrace >= 0, "server.shutdown_grace", "SHUTDOWN_GRACE", "0以上の時間を指定してください(値: %s)", c.Server.ShutdownGrace)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "0より長い時間を指定してください(値: %s)", c.Server.ShutdownTimeout)
+
+	db := c.Database
+	switch db.Driver {
+	case repository.DriverMySQL, repository.DriverPostgres, repository.DriverSQLite:
+	default:
+		check(false, "database.driver", "DB_DRIVER", "mysql, postgres, sqlite3 のいずれかを指定してください(値: %q)", db.Driver)
+	}
+	check(db.URL != "", "database.url", "DATABASE_URL", "%sでは接続文字列を指定してください", db.Driver)
+	check(db.QueryTimeout > 0, "database.query_timeout", "QUERY_TIMEOUT", "0より長い時間を指定してください(値: %s)", db.QueryTimeout)
+	check(db.SlowQueryThreshold >= 0, "database.slow_query_threshold", "SLOW_QUERY_THRESHOLD", "0以上の時間を指定してください(0で記録しない)(値: %s)", db.SlowQueryThreshold)
+	check(db.HealthInterval > 0, "database.health_interval", "DB_HEALTH_INTERVAL", "0より長い時間を指定してください(値: %s)", db.HealthInterval)
+	check(db.ReadRetryAfter >= 0, "database.read_retry_after", "READ_DATABASE_RETRY_AFTER", "0以上の時間を指定してください(値: %s)", db.ReadRetryAfter)
+	check(db.MaxOpenConns > 0, "database.max_open_conns", "DB_MAX_OPEN_CONNS", "1以上を指定してください(値: %d)", db.MaxOpenConns)
+	check(db.MaxIdleConns >= 0, "database.max_idle_conns", "DB_MAX_IDLE_CONNS", "0以上を指定してください(値: %d)", db.MaxIdleConns)
+	check(db.ConnMaxLifetime > 0, "database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "0より長い時間を指定してください(値: %s)", db.ConnMaxLifetime)
+
+	m := c.Matchmaking
+	check(m.QuestionsPerGame > 0 && m.QuestionsPerGame <= 50, "matchmaking.questions_per_game", "QUESTIONS_PER_GAME", "1〜50で指定してください(値: %d)", m.QuestionsPerGame)
+	check(m.MatchTimeout > 0, "matchmaking.match_timeout", "MATCH_TIMEOUT", "0より長い時間を指定してください(値: %s)", m.MatchTimeout)
+	check(m.QuestionDelay >= 0, "matchmaking.question_delay", "QUESTION_DELAY", "0以上の時間を指定してください(値: %s)", m.QuestionDelay)
+	check(m.BuzzTimeout > 0, "matchmaking.buzz_timeout", "BUZZ_TIMEOUT", "0より長い時間を指定してください(値: %s)", m.BuzzTimeout)
+	check(m.AnswerTimeout > 0, "matchmaking.answer_timeout", "ANSWER_TIMEOUT", "0より長い時間を指定してください(値: %s)", m.AnswerTimeout)
+	check(m.NextQuestionDelay >= 0, "matchmaking.next_question_delay", "NEXT_QUESTION_DELAY", "0以上の時間を指定してください(値: %s)", m.NextQuestionDelay)
+	check(m.IdleTimeout >= 0, "matchmaking.idle_timeout", "IDLE_TIMEOUT", "0以上の時間を指定してください(0で切断しない)(値: %s)", m.IdleTimeout)
+	check(m.MaxSessions >= 0, "matchmaking.max_sessions", "MAX_SESSIONS", "0以上を指定してください(0で制限しない)(値: %d)", m.MaxSessions)
+	check(m.MaxQueuedSessions >= 0, "matchmaking.max_queued_sessions", "MAX_QUEUED_SESSIONS", "0以上を指定してください(値: %d)", m.MaxQueuedSessions)
+	check(m.SessionQueueTimeout > 0, "matchmaking.session_queue_timeout", "SESSION_QUEUE_TIMEOUT", "0より長い時間を指定してください(値: %s)", m.SessionQueueTimeout)
+	check(len(m.AllowedOrigins) > 0 || m.DevMode, "matchmaking.allowed_origins", "ALLOWED_ORIGINS", "開発モードでない場合は1つ以上のオリジンを指定してください")
+	switch m.DevicePolicy {
+	case matchmaking.DevicePolicyKickOld, matchmaking.DevicePolicyRejectNew, matchmaking.DevicePolicyAllow:
+	default:
+		check(false, "matchmaking.device_policy", "DEVICE_POLICY", "kick_old, reject_new, allow のいずれかを指定してください(値: %q)", m.DevicePolicy)
+	}
+	check(m.MaxMessageSize > 0, "matchmaking.max_message_size", "WS_MAX_MESSAGE_SIZE", "1以上を指定してください(値: %d)", m.MaxMessageSize)
+	check(m.PongWait > 0, "matchmaking.pong_wait", "WS_PONG_WAIT", "0より長い時間を指定してください(値: %s)", m.PongWait)
+	check(m.PingPeriod > 0 && m.PingPeriod < m.PongWait, "matchmaking.ping_period", "WS_PING_PERIOD", "0より長く、pong_wait(%s)より短い時間を指定してください(値: %s)", m.PongWait, m.PingPeriod)
+	check(m.WriteWait > 0, "matchmaking.write_wait", "WS_WRITE_WAIT", "0より長い時間を指定してください(値: %s)", m.WriteWait)
+	check(m.OutboundQueueSize > 0, "matchmaking.outbound_queue_size", "WS_OUTBOUND_QUEUE_SIZE", "1以上を指定してください(値: %d)", m.OutboundQueueSize)
+	check(m.IncomingQueueSize > 0, "matchmaking.incoming_queue_size", "WS_INCOMING_QUEUE_SIZE", "1以上を指定してください(値: %d)", m.IncomingQueueSize)
+	check(m.ReadBufferSize > 0, "matchmaking.read_buffer_size", "WS_READ_BUFFER_SIZE", "1以上を指定してください(値: %d)", m.ReadBufferSize)
+	check(m.WriteBufferSize > 0, "matchmaking.write_buffer_size", "WS_WRITE_BUFFER_SIZE", "1以上を指定してください(値: %d)", m.WriteBufferSize)
+	check(m.SlowQuestionFetch >= 0, "matchmaking.slow_question_fetch", "SLOW_QUESTION_FETCH_THRESHOLD", "0以上の時間を指定してください(0で記録しない)(値: %s)", m.SlowQuestionFetch)
+	check(m.SlowWrite >= 0, "matchmaking.slow_write", "SLOW_WRITE_THRESHOLD", "0以上の時間を指定してください(0で記録しない)(値: %s)", m.SlowWrite)
+	check(m.SlowFinalize >= 0, "matchmaking.slow_finalize", "SLOW_FINALIZE_THRESHOLD", "0以上の時間を指定してください(0で記録しない)(値: %s)", m.SlowFinalize)
+
+	check(strings.EqualFold(c.Log.Format, logging.FormatText) || strings.EqualFold(c.Log.Format, logging.FormatJSON),
+		"log.format", "LOG_FORMAT", "text か json を指定してください(値: %q)", c.Log.Format)
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level", "LOG_LEVEL", "debug, info, warn, error のいずれかを指定してください(値: %q)", c.Log.Level)
+	check(!c.Log.Unredacted || m.DevMode, "log.unredacted", "LOG_UNREDACTED", "個人情報を伏せずに出力するのはローカルでの開発専用です。DEV_MODE=true と一緒に指定してください")
+
+	a := c.Alert
+	check(isURL(a.WebhookURL), "alert.webhook_url", "ALERT_WEBHOOK_URL", "http:// か https:// で始まるURLを指定してください")
+	check(isURL(a.SlackWebhookURL), "alert.slack_webhook_url", "ALERT_SLACK_WEBHOOK_URL", "http:// か https:// で始まるURLを指定してください")
+	check(a.Cooldown >= 0, "alert.cooldown", "ALERT_COOLDOWN", "0以上の時間を指定してください(値: %s)", a.Cooldown)
+	check(a.RatingFailureThreshold >= 0, "alert.rating_failure_threshold", "ALERT_RATING_FAILURE_THRESHOLD", "0以上を指定してください(0で通知しない)(値: %d)", a.RatingFailureThreshold)
+	check(a.RatingFailureWindow > 0, "alert.rating_failure_window", "ALERT_RATING_FAILURE_WINDOW", "0より長い時間を指定してください(値: %s)", a.RatingFailureWindow)
+	check(a.AbnormalCloseThreshold >= 0, "alert.abnormal_close_threshold", "ALERT_ABNORMAL_CLOSE_THRESHOLD", "0以上を指定してください(0で通知しない)(値: %d)", a.AbnormalCloseThreshold)
+	check(a.AbnormalCloseWindow > 0, "alert.abnormal_close_window", "ALERT_ABNORMAL_CLOSE_WINDOW", "0より長い時間を指定してください(値: %s)", a.AbnormalCloseWindow)
+
+	if cl := c.Cluster; cl.RedisURL != "" {
+		check(strings.HasPrefix(cl.RedisURL, "redis://") || strings.HasPrefix(cl.RedisURL, "rediss://"),
+			"cluster.redis_url", "CLUSTER_REDIS_URL", "redis:// か rediss:// で始まるURLを指定してください")
+		check(cl.InstanceID != "", "cluster.instance_id", "CLUSTER_INSTANCE_ID", "インスタンスの名前を指定してください")
+		check(cl.JoinTimeout > 0, "cluster.join_timeout", "CLUSTER_JOIN_TIMEOUT", "0より長い時間を指定してください(値: %s)", cl.JoinTimeout)
+		// 署名鍵がインスタンスごとに違うと、別のインスタンスが発行したトークンを検証できない
+		check(c.Auth.Secret != "", "auth.secret", "AUTH_SECRET", "複数のインスタンスでマッチングする場合はトークンの署名鍵を指定してください")
+	}
+
+	ev := c.Events
+	switch ev.Sink {
+	case EventSinkNone:
+	case EventSinkRedisStream:
+		check(strings.HasPrefix(ev.RedisURL, "redis://") || strings.HasPrefix(ev.RedisURL, "rediss://"),
+			"events.redis_url", "EVENT_REDIS_URL", "redis:// か rediss:// で始まるURLを指定してください")
+		check(ev.RedisStream != "", "events.redis_stream", "EVENT_REDIS_STREAM", "ストリームの名前を指定してください")
+		check(ev.RedisMaxLen >= 0, "events.redis_max_len", "EVENT_REDIS_MAXLEN", "0以上を指定してください(0で削らない)(値: %d)", ev.RedisMaxLen)
+	default:
+		check(false, "events.sink", "EVENT_SINK", "none か redis_stream を指定してください(値: %q)", ev.Sink)
+	}
+	check(ev.PublishInterval > 0, "events.publish_interval", "EVENT_PUBLISH_INTERVAL", "0より長い時間を指定してください(値: %s)", ev.PublishInterval)
+
+	q := c.Question
+	check(q.CacheTTL >= 0, "question.cache_ttl", "QUESTION_CACHE_TTL", "0以上の時間を指定してください(0でデフォルト)(値: %s)", q.CacheTTL)
+	check(q.SubmissionLimit >= 0, "question.submission_limit", "QUESTION_SUBMISSION_LIMIT", "0以上を指定してください(0で無制限)(値: %d)", q.SubmissionLimit)
+	check(q.SubmissionWindow > 0, "question.submission_window", "QUESTION_SUBMISSION_WINDOW", "0より長い時間を指定してください(値: %s)", q.SubmissionWindow)
+	check(q.ReportThreshold >= 0, "question.report_threshold", "QUESTION_REPORT_THRESHOLD", "0以上を指定してください(0で停止しない)(値: %d)", q.ReportThreshold)
+	check(q.CalibrationInterval >= 0, "question.calibration_interval", "QUESTION_CALIBRATION_INTERVAL", "0以上の時間を指定してください(0またはoffで計算しない)(値: %s)", q.CalibrationInterval)
+	check(q.RotationInterval >= 0, "question.rotation_interval", "QUESTION_ROTATION_INTERVAL", "0以上の時間を指定してください(0またはoffで切り替えない)(値: %s)", q.RotationInterval)
+	check(q.IngestInterval >= 0, "question.ingest_interval", "TRIVIA_INGEST_INTERVAL", "0以上の時間を指定してください(0で取り込まない)(値: %s)", q.IngestInterval)
+	if q.IngestInterval > 0 {
+		_, ok := question.TriviaSourceFor(q.IngestSource)
+		check(ok, "question.ingest_source", "TRIVIA_INGEST_SOURCE", "不明な問題集です(値: %q)", q.IngestSource)
+		check(q.IngestAmount > 0, "question.ingest_amount", "TRIVIA_INGEST_AMOUNT", "1以上を指定してください(値: %d)", q.IngestAmount)
+	}
+
+	mail := c.Mail
+	check(mail.SMTPAddr == "" || mail.SMTPFrom != "", "mail.smtp_from", "SMTP_FROM", "SMTPでメールを送る場合は送信元のアドレスを指定してください")
+	check(isURL(mail.LinkBase), "mail.link_base", "EMAIL_LINK_BASE", "http:// か https:// で始まるURLを指定してください")
+
+	o := c.OAuth
+	check(o.CallbackBase != "" && isURL(o.CallbackBase), "oauth.callback_base", "OAUTH_CALLBACK_BASE", "http:// か https:// で始まるURLを指定してください")
+	check(isURL(o.SuccessURL), "oauth.success_url", "OAUTH_SUCCESS_URL", "http:// か https:// で始まるURLを指定してください")
+	for name, client := range o.Providers {
+		env := "OAUTH_" + strings.ToUpper(name) + "_CLIENT_ID"
+		check(slices.Contains(oauthProviders, name), "oauth.providers."+name, env, "google, github, line のいずれかを指定してください")
+		check(client.ClientID != "" && client.ClientSecret != "", "oauth.providers."+name, env,
+			"クライアントIDとクライアントシークレットを両方指定してください")
+	}
+
+	checkRating := func(key, env string, r rate.RatingConfig) {
+		switch r.Algorithm {
+		case "", rate.AlgorithmElo, rate.AlgorithmGlicko2:
+		default:
+			check(false, key+".algorithm", env, "elo か glicko2 を指定してください(値: %q)", r.Algorithm)
+		}
+		check(r.KFactor >= 0, key+".k_factor", env, "0以上を指定してください(0でデフォルト)(値: %g)", r.KFactor)
+		check(r.Scale >= 0, key+".scale", env, "0以上を指定してください(0でデフォルト)(値: %g)", r.Scale)
+		check(r.InitialRating >= 0, key+".initial_rating", env, "0以上を指定してください(0でデフォルト)(値: %d)", r.InitialRating)
+		check(r.MinRating >= 0, key+".min_rating", env, "0以上を指定してください(値: %d)", r.MinRating)
+		check(r.MaxRating == 0 || r.MaxRating > r.MinRating, key+".max_rating", env, "min_rating(%d)より大きい値を指定してください(0で上限なし)(値: %d)", r.MinRating, r.MaxRating)
+		for _, name := range r.ProtectedTiers {
+			known := slices.ContainsFunc(rate.Tiers(), func(t rate.Tier) bool { return t.Name == name })
+			check(known, key+".protected_tiers", env, "不明なランク帯です(値: %q)", name)
+		}
+	}
+	checkRating("rating", "RATING_*", c.Rating.RatingConfig)
+	for gameType, r := range c.Rating.GameTypes {
+		checkRating("rating.game_types."+gameType, "RATING_GAME_TYPES", r)
+	}
+	return errs
+}
+
+// Addr サーバーが待ち受けるアドレス
+func (c ServerConfig) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// PoolConfig 接続プールの設定
+func (c DatabaseConfig) PoolConfig() repository.PoolConfig {
+	return repository.PoolConfig{MaxOpenConns: c.MaxOpenConns, MaxIdleConns: c.MaxIdleConns, ConnMaxLifetime: c.ConnMaxLifetime}
+}
+
+// GameConfig マッチングと対戦の進め方
+func (c MatchmakingConfig) GameConfig() matchmaking.GameConfig {
+	return matchmaking.GameConfig{
+		QuestionsPerGame:  c.QuestionsPerGame,
+		MatchTimeout:      c.MatchTimeout,
+		QuestionDelay:     c.QuestionDelay,
+		BuzzTimeout:       c.BuzzTimeout,
+		AnswerTimeout:     c.AnswerTimeout,
+		NextQuestionDelay: c.NextQuestionDelay,
+	}
+}
+
+// SchedulerConfig 同時に進める対戦の数
+func (c MatchmakingConfig) SchedulerConfig() matchmaking.SchedulerConfig {
+	return matchmaking.SchedulerConfig{MaxSessions: c.MaxSessions, MaxQueued: c.MaxQueuedSessions, QueueTimeout: c.SessionQueueTimeout}
+}
+
+// ConnectionConfig 接続ごとの読み書きの制限
+func (c MatchmakingConfig) ConnectionConfig() matchmaking.ConnectionConfig {
+	return matchmaking.ConnectionConfig{
+		MaxMessageSize:    c.MaxMessageSize,
+		PongWait:          c.PongWait,
+		PingPeriod:        c.PingPeriod,
+		WriteWait:         c.WriteWait,
+		OutboundQueueSize: c.OutboundQueueSize,
+		IncomingQueueSize: c.IncomingQueueSize,
+		ReadBufferSize:    c.ReadBufferSize,
+		WriteBufferSize:   c.WriteBufferSize,
+	}
+}
+
+// SlowLogConfig 遅い処理としてログに記録する閾値
+func (c MatchmakingConfig) SlowLogConfig() matchmaking.SlowLogConfig {
+	return matchmaking.SlowLogConfig{QuestionFetch: c.SlowQuestionFetch, Write: c.SlowWrite, Finalize: c.SlowFinalize}
+}
+
+// Notifier 設定されている通知先。どちらもなければログに出力する
+func (c AlertConfig) Notifier() alert.Notifier {
+	var notifiers alert.Notifiers
+	if c.WebhookURL != "" {
+		notifiers = append(notifiers, alert.WebhookNotifier{URL: c.WebhookURL})
+	}
+	if c.SlackWebhookURL != "" {
+		notifiers = append(notifiers, alert.SlackNotifier{WebhookURL: c.SlackWebhookURL})
+	}
+	if len(notifiers) == 0 {
+		return alert.LogNotifier{}
+	}
+	return notifiers
+}
+
+// Rules 事象ごとの通知の条件
+func (c AlertConfig) Rules() map[string]alert.Rule {
+	return map[string]alert.Rule{
+		alert.RatingUpdateFailure: {Threshold: c.RatingFailureThreshold, Window: c.RatingFailureWindow, Cooldown: c.Cooldown},
+		alert.AbnormalClose:       {Threshold: c.AbnormalCloseThreshold, Window: c.AbnormalCloseWindow, Cooldown: c.Cooldown},
+	}
+}
+
+// hostname インスタンスの名前のデフォルト。取得できなければ空にして、複数のインスタンスで使う場合は指定させる
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// NewSink 設定されている送信先を作成する
+func (c EventsConfig) NewSink() (events.Sink, error) {
+	if c.Sink == EventSinkRedisStream {
+		return events.NewRedisStreamSink(c.RedisURL, c.RedisStream, c.RedisMaxLen)
+	}
+	return events.NopSink{}, nil
+}
+
+// OriginPolicy WebSocketのオリジンポリシー
+func (c MatchmakingConfig) OriginPolicy() matchmaking.OriginPolicy {
+	return matchmaking.OriginPolicy{AllowedOrigins: c.AllowedOrigins, DevMode: c.DevMode}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Question.Cache || cfg.Question.SubmissionLimit != 10 || cfg.Question.RotationInterval != time.Minute {
+		t.Errorf("question = %+v", cfg.Question)
+	}
+}
+
+func TestLoadConfigQuestionEnv(t *testing.T) {
+	t.Setenv("QUESTION_CACHE", "off")
+	t.Setenv("QUESTION_CALIBRATION_INTERVAL", "off")
+	t.Setenv("QUESTION_LOCALES", "en, zh-Hans")
+	t.Setenv("TRIVIA_INGEST_INTERVAL", "24h")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := cfg.Question
+	if q.Cache || q.CalibrationInterval != 0 || q.IngestInterval != 24*time.Hour {
+		t.Errorf("question = %+v", q)
+	}
+	if len(q.Locales) != 2 || q.Locales[1] != "zh-Hans" {
+		t.Errorf("locales = %v", q.Locales)
+	}
+}
+
+func TestLoadConfigRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		name, env, value, want string
+	}{
+		{"submission limit", "QUESTION_SUBMISSION_LIMIT", "ten", "QUESTION_SUBMISSION_LIMIT"},
+		{"cache ttl", "QUESTION_CACHE_TTL", "5", "QUESTION_CACHE_TTL"},
+		{"cache switch", "QUESTION_CACHE", "disabled", "QUESTION_CACHE"},
+		{"ingest source", "TRIVIA_INGEST_SOURCE", "unknown", "TRIVIA_INGEST_SOURCE"},
+		{"k factor", "RATING_K_FACTOR", "high", "RATING_K_FACTOR"},
+		{"algorithm", "RATING_ALGORITHM", "trueskill", "rating.algorithm"},
+		{"protected tier", "RATING_PROTECTED_TIERS", "Gold,Mithril", "rating.protected_tiers"},
+		{"game types", "RATING_GAME_TYPES", `{"quiz":`, "RATING_GAME_TYPES"},
+		{"game type algorithm", "RATING_GAME_TYPES", `{"quiz":{"algorithm":"x"}}`, "rating.game_types.quiz.algorithm"},
+		{"oauth secret", "OAUTH_GOOGLE_CLIENT_ID", "id", "oauth.providers.google"},
+		{"smtp from", "SMTP_ADDR", "smtp.example.com:587", "mail.smtp_from"},
+		{"guest mode", "GUEST_MODE", "yes", "GUEST_MODE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			if tt.env == "TRIVIA_INGEST_SOURCE" {
+				t.Setenv("TRIVIA_INGEST_INTERVAL", "24h")
+			}
+			_, err := loadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want mention of %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigClusterRequiresAuthSecret(t *testing.T) {
+	t.Setenv("CLUSTER_REDIS_URL", "redis://localhost:6379")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "AUTH_SECRET") {
+		t.Errorf("without secret: err = %v, want AUTH_SECRET", err)
+	}
+
+	t.Setenv("AUTH_SECRET", "shared-secret")
+	if _, err := loadConfig(); err != nil {
+		t.Errorf("with secret: err = %v", err)
+	}
+}
@@ -4,7 +4,52 @@ USE sys3;
 CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(255) NOT NULL,
-    password VARCHAR(255) NOT NULL
+    password VARCHAR(255) NOT NULL, -- bcryptのハッシュ。OAuthのみのアカウントは空
+    role ENUM('player', 'moderator', 'admin') NOT NULL DEFAULT 'player', -- 最初の管理者はSQLで設定する
+    email VARCHAR(255) NULL,
+    email_verified_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_username (username),
+    -- 確認済みのメールアドレスは1つのアカウントにしか使えない(未確認のものは重複してよい)
+    UNIQUE KEY unique_verified_email ((CASE WHEN email_verified_at IS NULL THEN NULL ELSE email END)),
+    INDEX idx_email (email)
+);
+
+-- メールアドレスの確認とパスワード再設定のトークン(ハッシュで保存する)
+CREATE TABLE IF NOT EXISTS email_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    purpose ENUM('verify', 'reset') NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_username_purpose (username, purpose)
+);
+
+-- ボットや外部ツール用のAPIキー(キー自体はハッシュで保存する)
+-- scopesはカンマ区切り(play, spectate, stats:read)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id CHAR(16) PRIMARY KEY,
+    key_hash CHAR(64) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    UNIQUE KEY unique_key_hash (key_hash),
+    INDEX idx_username (username)
+);
+
+CREATE TABLE IF NOT EXISTS user_profiles (
+    username VARCHAR(255) PRIMARY KEY,
+    display_name VARCHAR(30) NULL,
+    avatar_url VARCHAR(512) NULL,
+    bio VARCHAR(200) NULL,
+    country CHAR(2) NULL,
+    locale VARCHAR(10) NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS friends (
@@ -24,9 +69,138 @@ CREATE TABLE IF NOT EXISTS questions (
     choice3 VARCHAR(255) NOT NULL,
     choice4 VARCHAR(255) NOT NULL,
     explanation TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'approved', -- draft, pending_review, approved, rejected, suspended。approvedの問題だけを出題する
+    version INT NOT NULL DEFAULT 1, -- 現在の版。question_versionsのversionに対応する
+    source VARCHAR(20) NOT NULL DEFAULT 'admin', -- admin, import, community, external。communityはプレイヤーからの投稿、externalは外部の問題集
+    difficulty VARCHAR(10) NOT NULL DEFAULT 'normal', -- easy, normal, hard。回答の集計から定期的に計算し直す
+    difficulty_score DOUBLE NULL, -- 0(易しい)〜1(難しい)。出題数が少ない間はNULL
+    activate_at TIMESTAMP NULL, -- この日時まではscheduledにして出題しない
+    retire_at TIMESTAMP NULL, -- この日時になったらretiredにして出題をやめる
+    deleted_at TIMESTAMP NULL, -- 削除済みの問題は出題しない(過去の対戦記録のために行は残す)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_questions_creator (creator_username, created_at)
+);
+
+-- 問題の版。内容を変更するたびに変更後の内容を追加し、行は書き換えない
+-- 過去の対戦記録は出題した時点の版を参照する
+CREATE TABLE IF NOT EXISTS question_versions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    question_id INT NOT NULL,
+    version INT NOT NULL,
+    question_text TEXT NOT NULL,
+    correct_answer VARCHAR(255) NOT NULL,
+    choice1 VARCHAR(255) NOT NULL,
+    choice2 VARCHAR(255) NOT NULL,
+    choice3 VARCHAR(255) NOT NULL,
+    choice4 VARCHAR(255) NOT NULL,
+    explanation TEXT NOT NULL,
+    editor VARCHAR(255) NOT NULL, -- この版を作成したユーザー
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_question_version (question_id, version),
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
+
+CREATE TABLE IF NOT EXISTS question_reviews (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    question_id INT NOT NULL,
+    reviewer VARCHAR(255) NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL, -- 審査後の状態
+    comment TEXT NOT NULL, -- 却下の理由など。作成者に表示する
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_question_reviews_question (question_id),
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
+
+-- 対戦中にプレイヤーから寄せられた問題の報告
+-- 未対応(open)の報告が一定数に達した問題は自動で出題を停止する
+CREATE TABLE IF NOT EXISTS question_reports (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    question_id INT NOT NULL,
+    question_version INT NOT NULL, -- 報告した時点で出題されていた版
+    reporter VARCHAR(255) NOT NULL,
+    reason VARCHAR(20) NOT NULL, -- wrong_answer, typo, offensive
+    comment TEXT NOT NULL,
+    room_id VARCHAR(64) NOT NULL, -- 報告した対戦の部屋
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, resolved, dismissed
+    resolved_by VARCHAR(255) NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_question_reports_question (question_id, status),
+    INDEX idx_question_reports_status (status, created_at),
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
+
+-- 問題の分類。カテゴリーは管理者が用意し、タグはイベントなどのために自由に付ける
+CREATE TABLE IF NOT EXISTS categories (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS tags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS question_categories (
+    question_id INT NOT NULL,
+    category_id INT NOT NULL,
+    PRIMARY KEY (question_id, category_id),
+    INDEX idx_question_categories_category (category_id),
+    FOREIGN KEY (question_id) REFERENCES questions(id),
+    FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+
+CREATE TABLE IF NOT EXISTS question_tags (
+    question_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (question_id, tag_id),
+    INDEX idx_question_tags_tag (tag_id),
+    FOREIGN KEY (question_id) REFERENCES questions(id),
+    FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+-- テーマのある対戦で出題する問題の集まり(例: シーズン3、アニメ週間)
+CREATE TABLE IF NOT EXISTS question_pools (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS question_pool_members (
+    pool_id INT NOT NULL,
+    question_id INT NOT NULL,
+    PRIMARY KEY (pool_id, question_id),
+    INDEX idx_question_pool_members_question (question_id),
+    FOREIGN KEY (pool_id) REFERENCES question_pools(id),
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
+
+-- 問題の翻訳。元の問題(日本語)の版ごとに翻訳し、source_versionが問題のversionより古い翻訳は更新が必要
+-- 選択肢は元の問題と同じ順に並べ、正解も同じ位置の選択肢にする
+CREATE TABLE IF NOT EXISTS question_translations (
+    question_id INT NOT NULL,
+    locale VARCHAR(20) NOT NULL, -- en, zh-Hantなど
+    question_text TEXT NOT NULL,
+    correct_answer VARCHAR(255) NOT NULL,
+    choice1 VARCHAR(255) NOT NULL,
+    choice2 VARCHAR(255) NOT NULL,
+    choice3 VARCHAR(255) NOT NULL,
+    choice4 VARCHAR(255) NOT NULL,
+    explanation TEXT NOT NULL,
+    source_version INT NOT NULL, -- 翻訳した元の問題の版
+    translator VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (question_id, locale),
+    INDEX idx_question_translations_locale (locale),
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
+
 CREATE TABLE IF NOT EXISTS friend_requests (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(255) NOT NULL,
@@ -38,7 +212,182 @@ CREATE TABLE IF NOT EXISTS friend_requests (
 );
 
 CREATE TABLE IF NOT EXISTS player_ratings (
-    username VARCHAR(255) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
     rating INT NOT NULL DEFAULT 1500,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-);
\ No newline at end of file
+    tier VARCHAR(20) NULL,
+    rating_deviation DOUBLE NOT NULL DEFAULT 350,
+    volatility DOUBLE NOT NULL DEFAULT 0.06,
+    current_streak INT NOT NULL DEFAULT 0,
+    best_streak INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, game_type),
+    INDEX idx_player_ratings_game_type_rating (game_type, rating)
+);
+
+CREATE TABLE IF NOT EXISTS seasons (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    finalized BOOLEAN NOT NULL DEFAULT FALSE,
+    rewards JSON NULL,
+    question_pool_id INT NULL, -- 開催中、部屋の設定で指定がなければこのプールから出題する
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_seasons_period (starts_at, ends_at),
+    FOREIGN KEY (question_pool_id) REFERENCES question_pools(id)
+);
+
+CREATE TABLE IF NOT EXISTS season_ratings (
+    season_id INT NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    username VARCHAR(255) NOT NULL,
+    rating INT NOT NULL,
+    final_rank INT NOT NULL,
+    PRIMARY KEY (season_id, game_type, username),
+    INDEX idx_season_ratings_rank (season_id, game_type, final_rank)
+);
+CREATE TABLE IF NOT EXISTS matches (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    rated BOOLEAN NOT NULL DEFAULT TRUE,
+    player1_id VARCHAR(255) NOT NULL,
+    player2_id VARCHAR(255) NOT NULL,
+    player1_score INT NOT NULL,
+    player2_score INT NOT NULL,
+    winner_id VARCHAR(255) NULL,
+    started_at TIMESTAMP NULL,
+    match_key VARCHAR(64) NULL, -- 部屋ID。保存を再試行しても二重に記録しないために使う
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 対戦が終わった日時
+    UNIQUE KEY unique_match_key (match_key),
+    INDEX idx_matches_player1 (player1_id, created_at),
+    INDEX idx_matches_player2 (player2_id, created_at)
+);
+
+-- プレイヤーごと・ゲームの種類ごとの成績の集計(対戦の保存時に更新する)
+CREATE TABLE IF NOT EXISTS player_stats (
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    games_played INT NOT NULL DEFAULT 0,
+    wins INT NOT NULL DEFAULT 0,
+    losses INT NOT NULL DEFAULT 0,
+    draws INT NOT NULL DEFAULT 0,
+    total_score BIGINT NOT NULL DEFAULT 0,
+    buzzes INT NOT NULL DEFAULT 0, -- 回答権を取った回数
+    correct_answers INT NOT NULL DEFAULT 0,
+    total_buzz_ms BIGINT NOT NULL DEFAULT 0, -- 回答権を取るまでの時間の合計
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, game_type)
+);
+
+-- 問題ごとの回答の集計(対戦の保存時に更新する)
+CREATE TABLE IF NOT EXISTS question_stats (
+    question_id INT PRIMARY KEY,
+    times_shown INT NOT NULL DEFAULT 0,
+    times_answered INT NOT NULL DEFAULT 0, -- 誰かが回答権を取った回数
+    times_correct INT NOT NULL DEFAULT 0,
+    total_answer_ms BIGINT NOT NULL DEFAULT 0 -- 回答権を取るまでの時間の合計
+);
+
+-- 問題ごとの回答。誰も回答権を取らなかった問題はplayer_idがNULL
+CREATE TABLE IF NOT EXISTS match_answers (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    match_id BIGINT NOT NULL,
+    question_no INT NOT NULL, -- 出題順(1から)
+    question_id INT NOT NULL,
+    player_id VARCHAR(255) NULL,
+    answer VARCHAR(255) NOT NULL DEFAULT '',
+    correct BOOLEAN NOT NULL DEFAULT FALSE,
+    latency_ms INT NULL,
+    question_version INT NULL, -- 出題した問題の版
+    UNIQUE KEY unique_match_question (match_id, question_no),
+    INDEX idx_match_answers_question (question_id),
+    FOREIGN KEY (match_id) REFERENCES matches(id)
+);
+
+-- 回答権の要求。回答権を取れなかった要求も含めて、要求した順に記録する
+CREATE TABLE IF NOT EXISTS match_buzzes (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    match_id BIGINT NOT NULL,
+    question_no INT NOT NULL,
+    player_id VARCHAR(255) NOT NULL,
+    latency_ms INT NOT NULL, -- 出題から要求までの時間
+    granted BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX idx_match_buzzes_match (match_id, question_no),
+    INDEX idx_match_buzzes_player (player_id),
+    FOREIGN KEY (match_id) REFERENCES matches(id)
+);
+
+CREATE TABLE IF NOT EXISTS rating_history (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    match_id BIGINT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    old_rating INT NOT NULL,
+    new_rating INT NOT NULL,
+    answer_ms INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_rating_history_user (username, game_type, created_at),
+    FOREIGN KEY (match_id) REFERENCES matches(id)
+);
+
+CREATE TABLE IF NOT EXISTS smurf_flags (
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    games INT NOT NULL,
+    win_rate DOUBLE NOT NULL,
+    avg_answer_ms DOUBLE NULL,
+    bracket_answer_ms DOUBLE NULL,
+    flagged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, game_type)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    last_seen_at DATETIME NULL,
+    INDEX idx_sessions_username (username)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_accounts (
+    provider VARCHAR(20) NOT NULL,
+    provider_user_id VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, provider_user_id),
+    INDEX idx_oauth_accounts_username (username)
+);
+
+-- 管理者の操作の記録
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL, -- メソッドとルート(例: POST /admin/rooms/{id}/close)
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    payload TEXT NULL, -- リクエストの本文(JSON)
+    diff TEXT NULL, -- 変更前と変更後(JSON)
+    status INT NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    INDEX idx_audit_log_created (created_at),
+    INDEX idx_audit_log_actor (actor, created_at),
+    INDEX idx_audit_log_target (target, created_at)
+);
+
+-- 分析基盤に送る対戦のイベント。送信できるまで残し、送信済みのものは一定期間後に削除する
+CREATE TABLE IF NOT EXISTS match_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL UNIQUE, -- 受信側で重複を取り除くためのID
+    event_type VARCHAR(50) NOT NULL,
+    room_id VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL, -- イベント全体(JSON)
+    attempts INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    delivered_at DATETIME NULL,
+    INDEX idx_match_events_pending (delivered_at, id)
+);
@@ -0,0 +1,364 @@
+-- SQLite用のスキーマ(db.sqlと同じ内容)
+-- DB_DRIVER=sqlite3 で起動した場合、サーバーの起動時に自動で適用される
+-- ENUMはCHECK制約、ON UPDATE CURRENT_TIMESTAMPはアプリケーション側の更新で代用する
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL, -- bcryptのハッシュ。OAuthのみのアカウントは空
+    role VARCHAR(20) NOT NULL DEFAULT 'player' CHECK (role IN ('player', 'moderator', 'admin')),
+    email VARCHAR(255) NULL,
+    email_verified_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_email ON users (email);
+-- 確認済みのメールアドレスは1つのアカウントにしか使えない(未確認のものは重複してよい)
+CREATE UNIQUE INDEX IF NOT EXISTS unique_verified_email ON users (LOWER(email)) WHERE email_verified_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_users_lower_username;
+-- 大文字と小文字だけが違うユーザー名も同じものとして扱う(MySQLは照合順序で区別しない)
+CREATE UNIQUE INDEX IF NOT EXISTS unique_users_lower_username ON users (LOWER(username));
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    purpose VARCHAR(10) NOT NULL CHECK (purpose IN ('verify', 'reset')),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_username_purpose ON email_tokens (username, purpose);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id CHAR(16) PRIMARY KEY,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    prefix VARCHAR(16) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_username ON api_keys (username);
+
+CREATE TABLE IF NOT EXISTS user_profiles (
+    username VARCHAR(255) PRIMARY KEY,
+    display_name VARCHAR(30) NULL,
+    avatar_url VARCHAR(512) NULL,
+    bio VARCHAR(200) NULL,
+    country CHAR(2) NULL,
+    locale VARCHAR(10) NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS friends (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(255) NOT NULL,
+    friend_username VARCHAR(255) NOT NULL,
+    UNIQUE (username, friend_username)
+);
+
+CREATE TABLE IF NOT EXISTS questions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    creator_username VARCHAR(255) NOT NULL,
+    question_text TEXT NOT NULL,
+    correct_answer VARCHAR(255) NOT NULL,
+    choice1 VARCHAR(255) NOT NULL,
+    choice2 VARCHAR(255) NOT NULL,
+    choice3 VARCHAR(255) NOT NULL,
+    choice4 VARCHAR(255) NOT NULL,
+    explanation TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'approved',
+    version INT NOT NULL DEFAULT 1,
+    source VARCHAR(20) NOT NULL DEFAULT 'admin',
+    difficulty VARCHAR(10) NOT NULL DEFAULT 'normal',
+    difficulty_score DOUBLE NULL,
+    activate_at TIMESTAMP NULL,
+    retire_at TIMESTAMP NULL,
+    deleted_at TIMESTAMP NULL, -- 削除済みの問題は出題しない(過去の対戦記録のために行は残す)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_questions_creator ON questions (creator_username, created_at);
+
+CREATE TABLE IF NOT EXISTS question_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INT NOT NULL REFERENCES questions(id),
+    version INT NOT NULL,
+    question_text TEXT NOT NULL,
+    correct_answer VARCHAR(255) NOT NULL,
+    choice1 VARCHAR(255) NOT NULL,
+    choice2 VARCHAR(255) NOT NULL,
+    choice3 VARCHAR(255) NOT NULL,
+    choice4 VARCHAR(255) NOT NULL,
+    explanation TEXT NOT NULL,
+    editor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (question_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS question_reviews (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INT NOT NULL REFERENCES questions(id),
+    reviewer VARCHAR(255) NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    comment TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_question_reviews_question ON question_reviews (question_id);
+
+CREATE TABLE IF NOT EXISTS question_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INT NOT NULL REFERENCES questions(id),
+    question_version INT NOT NULL,
+    reporter VARCHAR(255) NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    comment TEXT NOT NULL,
+    room_id VARCHAR(64) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    resolved_by VARCHAR(255) NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_question_reports_question ON question_reports (question_id, status);
+CREATE INDEX IF NOT EXISTS idx_question_reports_status ON question_reports (status, created_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS question_categories (
+    question_id INT NOT NULL REFERENCES questions(id),
+    category_id INT NOT NULL REFERENCES categories(id),
+    PRIMARY KEY (question_id, category_id)
+);
+CREATE INDEX IF NOT EXISTS idx_question_categories_category ON question_categories (category_id);
+
+CREATE TABLE IF NOT EXISTS question_tags (
+    question_id INT NOT NULL REFERENCES questions(id),
+    tag_id INT NOT NULL REFERENCES tags(id),
+    PRIMARY KEY (question_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_question_tags_tag ON question_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS question_pools (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS question_pool_members (
+    pool_id INT NOT NULL REFERENCES question_pools(id),
+    question_id INT NOT NULL REFERENCES questions(id),
+    PRIMARY KEY (pool_id, question_id)
+);
+CREATE INDEX IF NOT EXISTS idx_question_pool_members_question ON question_pool_members (question_id);
+
+CREATE TABLE IF NOT EXISTS question_translations (
+    question_id INT NOT NULL REFERENCES questions(id),
+    locale VARCHAR(20) NOT NULL,
+    question_text TEXT NOT NULL,
+    correct_answer VARCHAR(255) NOT NULL,
+    choice1 VARCHAR(255) NOT NULL,
+    choice2 VARCHAR(255) NOT NULL,
+    choice3 VARCHAR(255) NOT NULL,
+    choice4 VARCHAR(255) NOT NULL,
+    explanation TEXT NOT NULL,
+    source_version INT NOT NULL,
+    translator VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (question_id, locale)
+);
+CREATE INDEX IF NOT EXISTS idx_question_translations_locale ON question_translations (locale);
+
+CREATE TABLE IF NOT EXISTS friend_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(255) NOT NULL,
+    friend_username VARCHAR(255) NOT NULL,
+    status VARCHAR(10) DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (username, friend_username)
+);
+
+CREATE TABLE IF NOT EXISTS player_ratings (
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    rating INT NOT NULL DEFAULT 1500,
+    tier VARCHAR(20) NULL,
+    rating_deviation REAL NOT NULL DEFAULT 350,
+    volatility REAL NOT NULL DEFAULT 0.06,
+    current_streak INT NOT NULL DEFAULT 0,
+    best_streak INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, game_type)
+);
+CREATE INDEX IF NOT EXISTS idx_player_ratings_game_type_rating ON player_ratings (game_type, rating);
+
+CREATE TABLE IF NOT EXISTS seasons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    finalized BOOLEAN NOT NULL DEFAULT FALSE,
+    rewards TEXT NULL,
+    question_pool_id INT NULL REFERENCES question_pools(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_seasons_period ON seasons (starts_at, ends_at);
+
+CREATE TABLE IF NOT EXISTS season_ratings (
+    season_id INT NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    username VARCHAR(255) NOT NULL,
+    rating INT NOT NULL,
+    final_rank INT NOT NULL,
+    PRIMARY KEY (season_id, game_type, username)
+);
+CREATE INDEX IF NOT EXISTS idx_season_ratings_rank ON season_ratings (season_id, game_type, final_rank);
+
+CREATE TABLE IF NOT EXISTS matches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    rated BOOLEAN NOT NULL DEFAULT TRUE,
+    player1_id VARCHAR(255) NOT NULL,
+    player2_id VARCHAR(255) NOT NULL,
+    player1_score INT NOT NULL,
+    player2_score INT NOT NULL,
+    winner_id VARCHAR(255) NULL,
+    started_at TIMESTAMP NULL,
+    match_key VARCHAR(64) NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- 対戦が終わった日時
+);
+CREATE INDEX IF NOT EXISTS idx_matches_player1 ON matches (player1_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_matches_player2 ON matches (player2_id, created_at);
+
+CREATE TABLE IF NOT EXISTS player_stats (
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    games_played INT NOT NULL DEFAULT 0,
+    wins INT NOT NULL DEFAULT 0,
+    losses INT NOT NULL DEFAULT 0,
+    draws INT NOT NULL DEFAULT 0,
+    total_score BIGINT NOT NULL DEFAULT 0,
+    buzzes INT NOT NULL DEFAULT 0,
+    correct_answers INT NOT NULL DEFAULT 0,
+    total_buzz_ms BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, game_type)
+);
+
+CREATE TABLE IF NOT EXISTS question_stats (
+    question_id INT PRIMARY KEY,
+    times_shown INT NOT NULL DEFAULT 0,
+    times_answered INT NOT NULL DEFAULT 0,
+    times_correct INT NOT NULL DEFAULT 0,
+    total_answer_ms BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS match_answers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    match_id BIGINT NOT NULL REFERENCES matches(id),
+    question_no INT NOT NULL,
+    question_id INT NOT NULL,
+    player_id VARCHAR(255) NULL,
+    answer VARCHAR(255) NOT NULL DEFAULT '',
+    correct BOOLEAN NOT NULL DEFAULT FALSE,
+    latency_ms INT NULL,
+    question_version INT NULL,
+    UNIQUE (match_id, question_no)
+);
+CREATE INDEX IF NOT EXISTS idx_match_answers_question ON match_answers (question_id);
+
+CREATE TABLE IF NOT EXISTS match_buzzes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    match_id BIGINT NOT NULL REFERENCES matches(id),
+    question_no INT NOT NULL,
+    player_id VARCHAR(255) NOT NULL,
+    latency_ms INT NOT NULL,
+    granted BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_match_buzzes_match ON match_buzzes (match_id, question_no);
+CREATE INDEX IF NOT EXISTS idx_match_buzzes_player ON match_buzzes (player_id);
+
+CREATE TABLE IF NOT EXISTS rating_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    match_id BIGINT NOT NULL REFERENCES matches(id),
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    old_rating INT NOT NULL,
+    new_rating INT NOT NULL,
+    answer_ms INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_rating_history_user ON rating_history (username, game_type, created_at);
+
+CREATE TABLE IF NOT EXISTS smurf_flags (
+    username VARCHAR(255) NOT NULL,
+    game_type VARCHAR(50) NOT NULL DEFAULT 'quiz',
+    games INT NOT NULL,
+    win_rate REAL NOT NULL,
+    avg_answer_ms REAL NULL,
+    bracket_answer_ms REAL NULL,
+    flagged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, game_type)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    last_seen_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions (username);
+
+CREATE TABLE IF NOT EXISTS oauth_accounts (
+    provider VARCHAR(20) NOT NULL,
+    provider_user_id VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, provider_user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_accounts_username ON oauth_accounts (username);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    payload TEXT NULL,
+    diff TEXT NULL,
+    status INT NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target, created_at);
+
+CREATE TABLE IF NOT EXISTS match_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id VARCHAR(64) NOT NULL UNIQUE,
+    event_type VARCHAR(50) NOT NULL,
+    room_id VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_match_events_pending ON match_events (delivered_at, id);
@@ -1,92 +1,114 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	_ "embed"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
 	"sys3/api/account"
-	"sys3/api/friends"
-	"sys3/api/matchmaking"
-	"sys3/api/question"
+	"sys3/api/logging"
+	"sys3/api/oauth"
 	"sys3/api/rate"
+	"sys3/api/repository"
+	"sys3/api/tracing"
+	"syscall"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
+// sqliteSchema DB_DRIVER=sqlite3 の場合に起動時に適用するスキーマ
+//
+//go:embed db_sqlite.sql
+var sqliteSchema string
+
 func main() {
+	// 設定を読み込む。誤りがあれば全ての項目をまとめて表示して終了する
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal("設定に誤りがあります", err)
+	}
+	setupLogging(cfg.Log)
+	shutdownTracing := setupTracing()
+
 	// データベース接続の初期化
-	connStr := "root:root@tcp(localhost:3306)/sys3"
-	var db *sql.DB
-	var err error
-	db, err = sql.Open("mysql", connStr)
+	driver := cfg.Database.Driver
+	db, err := sql.Open(driver, cfg.Database.URL)
 	if err != nil {
-		log.Fatal(err)
+		fatal("データベースの設定エラー", err)
 	}
-	defer db.Close()
+	repository.ConfigurePool(db, cfg.Database.PoolConfig())
 
 	// データベース接続のテスト
 	if err = db.Ping(); err != nil {
-		log.Fatal("データベース接続エラー:", err)
+		fatal("データベース接続エラー", err)
+	}
+	if driver == repository.DriverSQLite {
+		// ローカル開発用のSQLiteは、テーブルがなければ作成してそのまま使えるようにする
+		if _, err = db.Exec(sqliteSchema); err != nil {
+			fatal("スキーマの適用エラー", err)
+		}
 	}
 
-	// データベース接続を初期化
-	matchmaking.InitDB(db)
-
-	// ルーターの初期化
-	r := mux.NewRouter()
-
-	// デバッグ用のログミドルウェアを追加
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Printf("受信リクエスト: %s %s\n", r.Method, r.URL.Path)
-			fmt.Printf("ヘッダー: %+v\n", r.Header)
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	// CORSミドルウェア
-	r.Use(corsMiddleware)
+	// backup・restoreのサブコマンドはサーバーを起動せずに実行して終了する
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(db, repository.DialectFor(driver), os.Args[1:]))
+	}
 
-	// WebSocketエンドポイント
-	r.HandleFunc("/matchmaking", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("マッチメイキングエンドポイントヒット")
-		matchmaking.MatchmakingHandler(w, r)
-	})
+	// SIGINT・SIGTERMを受け取ったら、対戦と接続を片付けてから終了する
+	// 片付けている間にもう一度受け取った場合は、待たずに終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	// ルートの設定
-	r.HandleFunc("/", homeHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/signup", account.SignUpHandler(db)).Methods("POST", "OPTIONS")
-	r.HandleFunc("/login", account.LoginHandler(db)).Methods("POST", "OPTIONS")
-	r.HandleFunc("/logout", account.LogoutHandler()).Methods("POST")
-	r.HandleFunc("/getusername", account.GetUsernameHandler(db)).Methods("GET")
-	r.HandleFunc("/postquestions", question.MakeQuestionHandler(db)).Methods("POST")
-	r.HandleFunc("/getquestions", question.GetQuestionHandler(db)).Methods("GET")
-	r.HandleFunc("/friends/request", friends.SendFriendRequestHandler(db)).Methods("POST")
-	r.HandleFunc("/friends/respond", friends.RespondToFriendRequestHandler(db)).Methods("POST")
-	r.HandleFunc("/friends/pending", friends.GetPendingRequestsHandler(db)).Methods("GET")
-	r.HandleFunc("/rate/calculate", rate.CalculateRatingHandler(db)).Methods("POST")
-	r.HandleFunc("/rate/top", rate.GetTopPlayersHandler(db)).Methods("GET")
-	r.HandleFunc("/rate/user", rate.GetUserRatingHandler(db)).Methods("GET")
-
-	// サーバーの設定
-	port := ":8080"
-	fmt.Printf("Server is running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(port, r))
+	srv := newServer(cfg, db)
+	err = srv.Run(ctx)
+	shutdownTracing()
+	if err != nil {
+		fatal("サーバーエラー", err)
+	}
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "tihs is the go api server for sys3")
 }
 
+// recoverMiddleware ハンドラーでパニックが発生した場合に500を返し、スタックトレースをログに記録する
+// http.ErrAbortHandler はnet/httpがレスポンスを中断するために使うので、そのまま投げ直す
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			slog.Error("ハンドラーでパニック発生", "method", r.Method, "path", r.URL.Path, "panic", rec, "stack", string(debug.Stack()))
+			// WebSocketに切り替えた後や書き込み始めた後は、ステータスを返せないので書き込みは失敗する
+			http.Error(w, "サーバーエラーが発生しました", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// localhost:3000からのリクエストを許可(*が使えない)
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-CSRF-Token")
 		w.Header().Set("Access-Control-Expose-Headers", "Set-Cookie")
 
 		if r.Method == "OPTIONS" {
@@ -97,3 +119,97 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// setupLogging ログの出力形式とレベルを設定する。値はloadConfigで確認済み
+func setupLogging(cfg LogConfig) {
+	level, _ := logging.ParseLevel(cfg.Level)
+	if cfg.Unredacted {
+		logging.DisableRedaction()
+	}
+	logging.Setup(os.Stderr, cfg.Format, level)
+	if cfg.Unredacted {
+		slog.Warn("開発モード: Cookieの値・トークン・メールアドレスを伏せずにログに出力します")
+	}
+}
+
+// setupTracing OTEL_EXPORTER_OTLP_ENDPOINT(またはOTEL_EXPORTER_OTLP_TRACES_ENDPOINT)が設定されていれば
+// 対戦や問題ごとのスパンをOTLPで送信する。終了する前に、送信されていないスパンを書き出す関数を返す
+// サンプリングの割合は OTEL_TRACES_SAMPLER と OTEL_TRACES_SAMPLER_ARG で設定する
+func setupTracing() func() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() {}
+	}
+	shutdown, err := tracing.Setup(context.Background(), "sys3")
+	if err != nil {
+		slog.Warn("トレースの送信を設定できませんでした", logging.Err(err))
+		return func() {}
+	}
+	slog.Info("トレースをOTLPで送信します")
+	return shutdown
+}
+
+// fatal 起動を続けられないエラーを記録して終了する
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
+// openReadReplica 読み取り用のデータベースが設定されていれば接続する
+// 種類はプライマリと同じものを使う。起動時に接続できなくても、使えるようになるまでプライマリで読み取る
+func openReadReplica(cfg DatabaseConfig) *repository.Replica {
+	if cfg.ReadURL == "" {
+		return nil
+	}
+	db, err := sql.Open(cfg.Driver, cfg.ReadURL)
+	if err != nil {
+		fatal("読み取り用のデータベースの設定エラー", err)
+	}
+	repository.ConfigurePool(db, cfg.PoolConfig())
+
+	replica := repository.NewReplica(db)
+	if cfg.ReadRetryAfter > 0 {
+		replica.RetryAfter = cfg.ReadRetryAfter
+	}
+	if err := db.Ping(); err != nil {
+		replica.Fallback(err)
+	}
+	return replica
+}
+
+// setupMail SMTPのアドレスが設定されていればSMTPでメールを送る。未設定の場合はログに出力するだけ
+func setupMail(cfg MailConfig) {
+	if cfg.SMTPAddr != "" {
+		account.SetMailSender(account.NewSMTPMailSender(cfg.SMTPAddr, cfg.SMTPFrom, cfg.SMTPUsername, cfg.SMTPPassword))
+	}
+	if cfg.LinkBase != "" {
+		account.SetLinkBaseURL(strings.TrimSuffix(cfg.LinkBase, "/"))
+	}
+	account.SetEmailVerificationRequired(cfg.RequireVerification)
+}
+
+// setupOAuth クライアントが設定されている外部サービスを有効にする
+// コールバックのURLは callback_base + /auth/oauth/{provider}/callback
+func setupOAuth(cfg OAuthConfig) {
+	base := strings.TrimSuffix(cfg.CallbackBase, "/")
+	for name, client := range cfg.Providers {
+		err := oauth.RegisterProvider(name, oauth.ProviderConfig{
+			ClientID:     client.ClientID,
+			ClientSecret: client.ClientSecret,
+			RedirectURL:  base + "/auth/oauth/" + name + "/callback",
+		})
+		if err != nil {
+			fatal("OAuthの設定エラー", err)
+		}
+	}
+	if cfg.SuccessURL != "" {
+		oauth.SetSuccessURL(cfg.SuccessURL)
+	}
+}
+
+// setupRating レーティングのパラメータを設定する。値はloadConfigで確認済み
+func setupRating(cfg RatingConfig) {
+	rate.SetConfig(cfg.RatingConfig)
+	for gameType, c := range cfg.GameTypes {
+		rate.SetGameTypeConfig(gameType, c)
+	}
+}
@@ -0,0 +1,7 @@
+-- usersにユーザー名の一意制約がないまま作成したMySQLのデータベースに追加する
+-- (db.sqlのCREATE TABLE IF NOT EXISTSは既存のテーブルを変更しないため)
+-- 同じユーザー名が既にあると追加できないので、先に次のクエリで確認して整理しておくこと
+--   SELECT LOWER(username), COUNT(*) FROM users GROUP BY LOWER(username) HAVING COUNT(*) > 1;
+USE sys3;
+
+ALTER TABLE users ADD UNIQUE KEY unique_username (username);
@@ -0,0 +1,6 @@
+-- 大文字と小文字だけが違うユーザー名を許していたPostgreSQLのデータベースに一意制約を追加する
+-- 同じユーザー名が既にあると追加できないので、先に次のクエリで確認して整理しておくこと
+--   SELECT LOWER(username), COUNT(*) FROM users GROUP BY LOWER(username) HAVING COUNT(*) > 1;
+-- SQLiteは起動時に適用するdb_sqlite.sqlで追加される
+DROP INDEX IF EXISTS idx_users_lower_username;
+CREATE UNIQUE INDEX IF NOT EXISTS unique_users_lower_username ON users (LOWER(username));
@@ -0,0 +1,6 @@
+-- 確認済みのメールアドレスの一意制約を、既存のMySQLのデータベースに追加する
+-- 同じメールアドレスを確認済みのアカウントが既にあると追加できないので、先に次のクエリで確認して整理しておくこと
+--   SELECT email, COUNT(*) FROM users WHERE email_verified_at IS NOT NULL GROUP BY email HAVING COUNT(*) > 1;
+USE sys3;
+
+ALTER TABLE users ADD UNIQUE KEY unique_verified_email ((CASE WHEN email_verified_at IS NULL THEN NULL ELSE email END));
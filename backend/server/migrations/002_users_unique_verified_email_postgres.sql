@@ -0,0 +1,5 @@
+-- 確認済みのメールアドレスの一意制約を、既存のPostgreSQLのデータベースに追加する
+-- 同じメールアドレスを確認済みのアカウントが既にあると追加できないので、先に次のクエリで確認して整理しておくこと
+--   SELECT LOWER(email), COUNT(*) FROM users WHERE email_verified_at IS NOT NULL GROUP BY LOWER(email) HAVING COUNT(*) > 1;
+-- SQLiteは起動時に適用するdb_sqlite.sqlで追加される
+CREATE UNIQUE INDEX IF NOT EXISTS unique_verified_email ON users (LOWER(email)) WHERE email_verified_at IS NOT NULL;
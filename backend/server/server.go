@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sys3/api/account"
+	"sys3/api/alert"
+	"sys3/api/audit"
+	"sys3/api/auth"
+	"sys3/api/clientip"
+	"sys3/api/events"
+	"sys3/api/export"
+	"sys3/api/friends"
+	"sys3/api/health"
+	"sys3/api/logging"
+	"sys3/api/matchmaking"
+	"sys3/api/metrics"
+	"sys3/api/oauth"
+	"sys3/api/question"
+	"sys3/api/rate"
+	"sys3/api/repository"
+	"sys3/api/season"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Server APIサーバー。newServerで設定とデータベースから組み立て、Runで起動する
+type Server struct {
+	cfg     Config
+	handler http.Handler
+	db      *sql.DB
+	replica *repository.Replica  // 読み取り用のデータベース。設定されていなければnil
+	servers []*http.Server       // 待ち受けているHTTPサーバー(リダイレクト用を含む)
+	cluster *matchmaking.Cluster // 複数のインスタンスでマッチングする場合のみ
+}
+
+// newServer 設定に従ってリポジトリ・対戦・定期実行の処理・ルーティングを組み立てる
+// dbは接続を確認済みのプライマリのデータベース
+func newServer(cfg Config, db *sql.DB) *Server {
+	driver := cfg.Database.Driver
+
+	// データベース接続を初期化
+	// データベースへのアクセスはリポジトリを通して行う
+	// リポジトリの外でSQLを実行するパッケージにも、データベースの種類に合わせて変換するDBを渡す
+	dialect := repository.DialectFor(driver)
+	repos := repository.NewSQLWithDialect(db, dialect)
+	database := repository.NewDB(db, dialect)
+	// 問題とランキングの読み取りは読み取り用のデータベースで行う(READ_DATABASE_URL)
+	replica := openReadReplica(cfg.Database)
+	if replica != nil {
+		repos = repos.WithReplica(replica, dialect)
+	}
+	// 1回のデータベース操作にかけられる時間
+	repository.SetQueryTimeout(cfg.Database.QueryTimeout)
+	repository.SetSlowQueryThreshold(cfg.Database.SlowQueryThreshold)
+	// 対戦中の出題はメモリに保持した問題から行う
+	if cfg.Question.Cache {
+		repos.Questions = repository.NewCachedQuestionRepository(repos.Questions, cfg.Question.CacheTTL)
+	}
+	// プレイヤーが投稿できる問題の数
+	question.SetSubmissionLimit(question.SubmissionLimit{Max: cfg.Question.SubmissionLimit, Window: cfg.Question.SubmissionWindow})
+	ratingService := rate.NewSQLService(database)
+	matchmaking.SetRatingService(ratingService)
+	matchmaking.SetQuestionRepository(repos.Questions)
+	matchmaking.SetPoolRepository(repos.Pools)
+	matchmaking.SetReportRepository(repos.Reports)
+	matchmaking.SetProfileRepository(repos.Profiles)
+	matchmaking.SetEmailRepository(repos.Emails)
+	matchmaking.SetSeasonRepository(repos.Seasons)
+	// 未対応の報告が一定の数に達した問題は出題を停止する
+	question.SetReportThreshold(cfg.Question.ReportThreshold)
+	// 問題を翻訳する言語
+	if len(cfg.Question.Locales) > 0 {
+		question.SetLocales(cfg.Question.Locales)
+	}
+
+	// データベースに定期的にPingし、接続できない間は新しい対戦を受け付けない
+	dbHealth := repository.NewHealth(db, cfg.Database.HealthInterval)
+	dbHealth.Start(context.Background())
+	matchmaking.SetHealthCheck(dbHealth.Healthy)
+	// /readyzではデータベースへの接続と、新しい対戦を受け付けているかを確認する
+	health.Register("database", func() health.CheckResult {
+		status := dbHealth.Status()
+		return health.CheckResult{Healthy: status.Healthy, Since: &status.Since, Error: status.Error}
+	})
+	health.Register("matchmaking", matchmaking.Readiness)
+
+	// トークンの署名鍵を設定(未設定の場合は起動ごとにランダム)
+	auth.SetSecret(cfg.Auth.Secret)
+	auth.SetSessionRepository(repos.Sessions)
+	auth.SetAPIKeyRepository(repos.APIKeys)
+	auth.SetUserRepository(repos.Users)
+
+	// 対戦のイベントを保存してから分析基盤に送る(EVENT_SINKを設定しない場合は保存も送信もしない)
+	events.SetEventRepository(repos.Events)
+	sink, err := cfg.Events.NewSink()
+	if err != nil {
+		fatal("対戦のイベントの送信先の設定エラー", err)
+	}
+	events.SetSink(sink)
+	events.StartPublisher(cfg.Events.PublishInterval)
+
+	// レートの更新の失敗や異常切断が続いたときの通知
+	alert.SetNotifier(cfg.Alert.Notifier())
+	for name, rule := range cfg.Alert.Rules() {
+		alert.SetRule(name, rule)
+	}
+
+	// マッチングと対戦の進め方、WebSocket接続の制限
+	matchmaking.SetGameConfig(cfg.Matchmaking.GameConfig())
+	matchmaking.SetSlowLogConfig(cfg.Matchmaking.SlowLogConfig())
+	metrics.SetRegion(cfg.Server.Region)
+	matchmaking.SetConnectionConfig(cfg.Matchmaking.ConnectionConfig())
+	matchmaking.SetIdleConfig(matchmaking.IdleConfig{Timeout: cfg.Matchmaking.IdleTimeout})
+	matchmaking.SetSchedulerConfig(cfg.Matchmaking.SchedulerConfig())
+
+	// WebSocketのオリジンポリシー
+	matchmaking.SetOriginPolicy(cfg.Matchmaking.OriginPolicy())
+	if cfg.Matchmaking.DevMode {
+		slog.Warn("開発モード: 全てのオリジンからのWebSocket接続を許可します")
+	}
+
+	// 複数端末から接続した場合の扱い(kick_old, reject_new, allow)
+	matchmaking.SetDevicePolicy(cfg.Matchmaking.DevicePolicy)
+
+	// 複数のインスタンスで待ち行列を共有し、別のインスタンスのプレイヤーとの対戦はRedisで中継する
+	var cluster *matchmaking.Cluster
+	if c := cfg.Cluster; c.RedisURL != "" {
+		var err error
+		cluster, err = matchmaking.NewCluster(c.RedisURL, c.InstanceID, c.JoinTimeout)
+		if err != nil {
+			fatal("マッチングに使うRedisに接続できません", err)
+		}
+		matchmaking.SetCluster(cluster)
+		slog.Info("複数のインスタンスでマッチングします", "instance_id", c.InstanceID)
+	}
+
+	// レーティングのパラメータ
+	setupRating(cfg.Rating)
+
+	// ルーターの初期化
+	r := mux.NewRouter()
+
+	// ハンドラーでパニックが発生してもプロセスを落とさずに500を返す。他のミドルウェアも対象にするため最初に追加する
+	r.Use(recoverMiddleware)
+
+	// デバッグ用のログミドルウェアを追加
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slog.Debug("受信リクエスト", "method", r.Method, "path", r.URL.Path, "ip", clientip.Resolve(r), "header", r.Header)
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// 接続元のIPアドレスを解決してコンテキストに保存
+	if len(cfg.Server.TrustedProxies) > 0 {
+		clientip.SetTrustedProxies(cfg.Server.TrustedProxies)
+	}
+	r.Use(clientip.Middleware)
+	// 全てのリクエストでトークンを検証し、ログイン中のユーザーをコンテキストに保存する
+	r.Use(auth.Middleware)
+
+	// CORSミドルウェア
+	r.Use(corsMiddleware)
+
+	// Cookieで認証した状態を変更するリクエストはCSRFトークンを検証する
+	r.Use(auth.CSRFMiddleware)
+
+	// ロードバランサーやオーケストレーターのプローブ用。認証は不要
+	r.HandleFunc("/healthz", health.LivenessHandler()).Methods("GET")
+	r.HandleFunc("/readyz", health.ReadinessHandler()).Methods("GET")
+
+	// Prometheus形式のメトリクス。トークンを設定すると、そのトークンを付けたリクエストだけに返す
+	r.Handle("/metrics", metrics.Handler(cfg.Server.MetricsToken)).Methods("GET")
+
+	// WebSocketエンドポイント
+	r.HandleFunc("/matchmaking", func(w http.ResponseWriter, r *http.Request) {
+		matchmaking.MatchmakingHandler(w, r)
+	})
+
+	// ルートの設定
+	// レートやランキングの取得はstats:readスコープのないAPIキーでは使えない
+	stats := func(next http.HandlerFunc) http.HandlerFunc { return auth.RequireScope(auth.ScopeStatsRead, next) }
+	r.HandleFunc("/", homeHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/logout", account.LogoutHandler()).Methods("POST")
+	r.HandleFunc("/auth/register", account.RegisterHandler(repos.Users)).Methods("POST")
+	r.HandleFunc("/auth/login", account.AuthLoginHandler(repos.Users)).Methods("POST")
+	r.HandleFunc("/auth/email", account.RequestVerificationHandler(repos.Emails)).Methods("POST")
+	r.HandleFunc("/auth/email/verify", account.VerifyEmailHandler(repos.Emails)).Methods("POST")
+	r.HandleFunc("/auth/password/forgot", account.RequestPasswordResetHandler(repos.Emails)).Methods("POST")
+	r.HandleFunc("/auth/password/reset", account.ResetPasswordHandler(repos.Emails)).Methods("POST")
+	r.HandleFunc("/auth/guest", auth.GuestLoginHandler()).Methods("POST")
+	r.HandleFunc("/auth/csrf", auth.CSRFTokenHandler()).Methods("GET")
+	r.HandleFunc("/auth/oauth/{provider}/login", oauth.LoginHandler()).Methods("GET")
+	r.HandleFunc("/auth/oauth/{provider}/callback", oauth.CallbackHandler(repos.OAuth, repos.Users)).Methods("GET")
+	r.HandleFunc("/getusername", account.GetUsernameHandler()).Methods("GET")
+	r.HandleFunc("/postquestions", question.MakeQuestionHandler(repos.Questions)).Methods("POST")
+	r.HandleFunc("/getquestions", question.GetQuestionHandler(repos.Questions)).Methods("GET")
+	r.HandleFunc("/categories", question.ListCategoriesHandler(repos.Categories)).Methods("GET")
+	r.HandleFunc("/pools", question.ListPoolsHandler(repos.Pools)).Methods("GET")
+	r.HandleFunc("/tags", question.ListTagsHandler(repos.Categories)).Methods("GET")
+	r.HandleFunc("/questions/submissions", question.CreateSubmissionHandler(repos.Questions)).Methods("POST")
+	r.HandleFunc("/questions/submissions", question.ListSubmissionsHandler(repos.Questions)).Methods("GET")
+	r.HandleFunc("/questions/contributors", question.ContributorsHandler(repos.Questions)).Methods("GET")
+	r.HandleFunc("/questions/{id}/submit", question.SubmitQuestionHandler(repos.Questions)).Methods("POST")
+	r.HandleFunc("/friends/request", friends.SendFriendRequestHandler(repos.Friends)).Methods("POST")
+	r.HandleFunc("/friends/respond", friends.RespondToFriendRequestHandler(repos.Friends)).Methods("POST")
+	r.HandleFunc("/friends/pending", friends.GetPendingRequestsHandler(repos.Friends)).Methods("GET")
+	r.HandleFunc("/rate/top", stats(rate.GetTopPlayersHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/rate/user", stats(rate.GetUserRatingHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/leaderboard", stats(rate.LeaderboardHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/players/me/export", export.ExportHandler(export.Sources{Users: repos.Users, Profiles: repos.Profiles, PlayerData: repos.PlayerData})).Methods("GET")
+	r.HandleFunc("/players/me/export/{id}", export.ExportJobHandler()).Methods("GET")
+	r.HandleFunc("/players/{id}/profile", stats(rate.PlayerProfileHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/users/{id}/profile", account.GetProfileHandler(repos.Users, repos.Profiles)).Methods("GET")
+	r.HandleFunc("/profile", account.MyProfileHandler(repos.Profiles)).Methods("GET")
+	r.HandleFunc("/profile", account.UpdateProfileHandler(repos.Profiles)).Methods("PUT")
+	r.HandleFunc("/players/{id}/stats", stats(rate.PlayerStatsHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/players/{id}/rank", stats(rate.PlayerRankHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/players/{id}/matches", stats(rate.PlayerMatchesHandler(repos.Matches))).Methods("GET")
+	r.HandleFunc("/matches/{id}", stats(rate.MatchDetailHandler(repos.Matches))).Methods("GET")
+	r.HandleFunc("/matches/{id}/replay", stats(rate.MatchReplayHandler(repos.Matches))).Methods("GET")
+	r.HandleFunc("/seasons", stats(season.ListSeasonsHandler(repos.Seasons))).Methods("GET")
+	r.HandleFunc("/seasons/current", stats(season.CurrentSeasonHandler(repos.Seasons))).Methods("GET")
+	r.HandleFunc("/seasons/{id}/ratings", stats(season.SeasonRatingsHandler(repos.Seasons))).Methods("GET")
+	r.HandleFunc("/apikeys", auth.CreateAPIKeyHandler()).Methods("POST")
+	r.HandleFunc("/apikeys", auth.ListAPIKeysHandler()).Methods("GET")
+	r.HandleFunc("/apikeys/{id}", auth.RevokeAPIKeyHandler()).Methods("DELETE")
+	r.HandleFunc("/sessions", auth.ListSessionsHandler()).Methods("GET")
+	r.HandleFunc("/sessions/{id}", auth.RevokeSessionHandler()).Methods("DELETE")
+
+	// 管理者用エンドポイント(ロールで保護する)
+	// 状態を変更する操作は全て操作の記録に残す
+	admin := func(next http.HandlerFunc) http.HandlerFunc {
+		return auth.RequireRole(auth.RoleAdmin, audit.Middleware(repos.Audit, next))
+	}
+	moderator := func(next http.HandlerFunc) http.HandlerFunc {
+		return auth.RequireRole(auth.RoleModerator, audit.Middleware(repos.Audit, next))
+	}
+	// 対戦の結果はゲームから直接レートに反映するので、外部からのレート更新は管理者に限る
+	r.HandleFunc("/rate/calculate", admin(rate.CalculateRatingHandler(ratingService))).Methods("POST")
+	r.HandleFunc("/admin/overview", admin(matchmaking.OverviewHandler())).Methods("GET")
+	r.HandleFunc("/admin/log-level", admin(logging.LevelHandler())).Methods("GET", "PUT")
+	r.HandleFunc("/admin/audit", admin(audit.ListHandler(repos.Audit))).Methods("GET")
+	r.HandleFunc("/admin/broadcast", admin(matchmaking.BroadcastHandler())).Methods("POST")
+	r.HandleFunc("/admin/rooms/{id}/close", moderator(matchmaking.CloseRoomHandler())).Methods("POST")
+	r.HandleFunc("/admin/questions", admin(question.ListQuestionsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions", admin(question.CreateQuestionHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/questions/import", admin(question.ImportQuestionsHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/questions/ingest", admin(question.IngestQuestionsHandler(repos.Questions, repos.Categories))).Methods("POST")
+	r.HandleFunc("/admin/questions/deleted", admin(question.DeletedQuestionsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/calibrate", admin(question.CalibrateHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/questions/rotate", admin(question.RotateHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/questions/rotations", admin(question.UpcomingRotationsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/stats", admin(question.QuestionStatsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}/stats", admin(question.QuestionStatsByIDHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/pending", moderator(question.PendingQuestionsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/reports", moderator(question.ReportQueueHandler(repos.Questions, repos.Reports))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}/reports", moderator(question.QuestionReportsHandler(repos.Reports))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}/reports/close", moderator(question.CloseReportsHandler(repos.Questions, repos.Reports))).Methods("POST")
+	r.HandleFunc("/admin/questions/{id}/approve", moderator(question.ApproveQuestionHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/questions/{id}/reject", moderator(question.RejectQuestionHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/questions/{id}/reviews", moderator(question.QuestionReviewsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}/versions", admin(question.QuestionVersionsHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}/translations", admin(question.QuestionTranslationsHandler(repos.Questions, repos.Translations))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}/translations/{locale}", admin(question.SaveTranslationHandler(repos.Questions, repos.Translations))).Methods("PUT")
+	r.HandleFunc("/admin/questions/{id}/translations/{locale}", admin(question.DeleteTranslationHandler(repos.Translations))).Methods("DELETE")
+	r.HandleFunc("/admin/questions/{id}/schedule", admin(question.SetScheduleHandler(repos.Questions))).Methods("PUT")
+	r.HandleFunc("/admin/questions/{id}/labels", admin(question.SetQuestionLabelsHandler(repos.Questions, repos.Categories))).Methods("PUT")
+	r.HandleFunc("/admin/questions/{id}", admin(question.GetQuestionByIDHandler(repos.Questions))).Methods("GET")
+	r.HandleFunc("/admin/questions/{id}", admin(question.UpdateQuestionHandler(repos.Questions))).Methods("PUT")
+	r.HandleFunc("/admin/questions/{id}", admin(question.DeleteQuestionHandler(repos.Questions))).Methods("DELETE")
+	r.HandleFunc("/admin/questions/{id}/restore", admin(question.RestoreQuestionHandler(repos.Questions))).Methods("POST")
+	r.HandleFunc("/admin/translations", admin(question.TranslationCompletenessHandler(repos.Questions, repos.Translations))).Methods("GET")
+	r.HandleFunc("/admin/translations/{locale}", admin(question.TranslationCompletenessHandler(repos.Questions, repos.Translations))).Methods("GET")
+	r.HandleFunc("/admin/categories", admin(question.CreateCategoryHandler(repos.Categories))).Methods("POST")
+	r.HandleFunc("/admin/categories/{id}", admin(question.UpdateCategoryHandler(repos.Categories))).Methods("PUT")
+	r.HandleFunc("/admin/categories/{id}", admin(question.DeleteCategoryHandler(repos.Categories))).Methods("DELETE")
+	r.HandleFunc("/admin/tags", admin(question.CreateTagHandler(repos.Categories))).Methods("POST")
+	r.HandleFunc("/admin/tags/{id}", admin(question.DeleteTagHandler(repos.Categories))).Methods("DELETE")
+	r.HandleFunc("/admin/pools", admin(question.CreatePoolHandler(repos.Pools))).Methods("POST")
+	r.HandleFunc("/admin/pools/{id}", admin(question.UpdatePoolHandler(repos.Pools))).Methods("PUT")
+	r.HandleFunc("/admin/pools/{id}", admin(question.DeletePoolHandler(repos.Pools))).Methods("DELETE")
+	r.HandleFunc("/admin/pools/{id}/questions", admin(question.PoolQuestionsHandler(repos.Questions, repos.Pools))).Methods("GET")
+	r.HandleFunc("/admin/pools/{id}/questions", admin(question.AddPoolQuestionsHandler(repos.Questions, repos.Pools))).Methods("POST")
+	r.HandleFunc("/admin/pools/{id}/questions/{question_id}", admin(question.RemovePoolQuestionHandler(repos.Questions))).Methods("DELETE")
+	r.HandleFunc("/admin/seasons", admin(season.CreateSeasonHandler(repos.Seasons, repos.Pools))).Methods("POST")
+	r.HandleFunc("/admin/seasons/{id}/pool", admin(season.SetPoolHandler(repos.Seasons, repos.Pools))).Methods("PUT")
+	r.HandleFunc("/admin/seasons/rollover", admin(season.RolloverHandler(repos.Seasons))).Methods("POST")
+	r.HandleFunc("/admin/smurfs", moderator(rate.SmurfFlagsHandler(repos.Ratings))).Methods("GET")
+	r.HandleFunc("/admin/answers/fast", moderator(rate.FastAnswersHandler(repos.Matches))).Methods("GET")
+	r.HandleFunc("/admin/users/{id}/revoke-sessions", moderator(auth.RevokeUserSessionsHandler())).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/role", admin(auth.SetRoleHandler())).Methods("POST")
+
+	// 終了日時を過ぎたシーズンを自動で切り替える
+	season.StartScheduler(repos.Seasons, time.Minute)
+
+	// OAuthでのログインに使う外部サービス
+	setupOAuth(cfg.OAuth)
+
+	// メールアドレスの確認とパスワード再設定のメール
+	setupMail(cfg.Mail)
+
+	// ゲストでの対戦
+	auth.SetGuestMode(cfg.Auth.GuestMode)
+	rate.StartGuestMatchCleanup(repos.Matches, auth.GuestIDPrefix, auth.GuestRetention)
+
+	// キャッシュしているランキングを定期的にデータベースから作り直す
+	rate.StartLeaderboardRebuild(repos.Ratings, 5*time.Minute)
+
+	// 回答の集計から問題の難易度を定期的に計算し直す
+	if cfg.Question.CalibrationInterval > 0 {
+		question.StartCalibration(repos.Questions, cfg.Question.CalibrationInterval)
+	}
+
+	// 出題を始める・終える日時になった問題を定期的に切り替える
+	if cfg.Question.RotationInterval > 0 {
+		question.StartRotation(repos.Questions, cfg.Question.RotationInterval)
+	}
+
+	// 外部の問題集から定期的に問題を取り込み、審査待ちにする。問題集の名前はloadConfigで確認済み
+	if cfg.Question.IngestInterval > 0 {
+		source, _ := question.TriviaSourceFor(cfg.Question.IngestSource)
+		question.StartIngestion(repos.Questions, repos.Categories, source, cfg.Question.IngestAmount, cfg.Question.IngestInterval)
+	}
+
+	return &Server{cfg: cfg, handler: r, db: db, replica: replica, cluster: cluster}
+}
+
+// Run サーバーを起動し、ctxがキャンセルされたら(SIGINT・SIGTERMを受け取ったら)Shutdownで停止する
+// 待ち受けに失敗した場合はそのエラーを返す
+func (s *Server) Run(ctx context.Context) error {
+	errs := make(chan error, 2)
+	s.servers = listen(s.cfg.Server.Addr(), s.handler, loadTLSOptions(), errs)
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	slog.Info("停止のシグナルを受信しました。サーバーを停止します",
+		"grace", s.cfg.Server.ShutdownGrace, "timeout", s.cfg.Server.ShutdownTimeout)
+	s.Shutdown()
+	return nil
+}
+
+// Shutdown 新しい対戦の受付を止めてから、次の順に停止する
+//  1. マッチングの受付を止め、対戦相手を待っている部屋を閉じる(/readyzは503になる)
+//  2. HTTPサーバーの待ち受けを止め、処理中のリクエストが終わるのをShutdownTimeoutまで待つ
+//  3. 進行中の対戦がそのまま終わるのをShutdownGraceまで待つ
+//  4. 終わらなかった対戦を結果を記録せずに中止し、保存中の対戦結果とレートの更新が終わるのをShutdownTimeoutまで待つ
+//  5. 送信していない対戦のイベントを送る
+//  6. 残っている接続を閉じてから、Redisとデータベースへの接続を閉じる
+func (s *Server) Shutdown() {
+	cfg := s.cfg.Server
+	matchmaking.StopMatchmaking()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	for _, server := range s.servers {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("HTTPサーバーの停止エラー", "addr", server.Addr, logging.Err(err))
+		}
+	}
+	cancel()
+
+	if !matchmaking.WaitForSessions(cfg.ShutdownGrace) {
+		matchmaking.StopSessions()
+		if !matchmaking.WaitForSessions(cfg.ShutdownTimeout) {
+			slog.Error("終了しなかった対戦があります。結果が保存されていない可能性があります")
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	if err := events.Flush(ctx); err != nil {
+		slog.Error("送信できなかった対戦のイベントがあります。次回の起動後に送信します", logging.Err(err))
+	}
+	cancel()
+
+	if closed := matchmaking.CloseConnections(); closed > 0 {
+		slog.Info("残っていた接続を閉じました", "connections", closed)
+		// 送信キューに入れたクローズを書き込む時間を与える
+		time.Sleep(time.Second)
+	}
+
+	s.cluster.Close()
+	if s.replica != nil {
+		s.replica.DB.Close()
+	}
+	s.db.Close()
+	slog.Info("サーバーを停止しました")
+}
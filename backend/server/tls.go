@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sys3/api/logging"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions wss://をバックエンド自身で終端するための設定
+type TLSOptions struct {
+	CertFile string // 証明書ファイル(KeyFileと組み合わせて使う)
+	KeyFile  string
+
+	// Let's Encryptで証明書を自動取得するドメイン
+	// CertFile/KeyFileより優先される
+	AutocertDomains  []string
+	AutocertCacheDir string
+
+	// HTTPでアクセスされた場合にHTTPSへリダイレクトするサーバーのアドレス(例: ":80")
+	// 空の場合はリダイレクト用サーバーを起動しない
+	RedirectAddr string
+}
+
+// Enabled TLSを使う設定になっているかを返す
+func (o TLSOptions) Enabled() bool {
+	return len(o.AutocertDomains) > 0 || (o.CertFile != "" && o.KeyFile != "")
+}
+
+// loadTLSOptions 環境変数からTLSの設定を読み込む
+// TLS_CERT_FILE, TLS_KEY_FILE: 証明書と秘密鍵のパス
+// TLS_AUTOCERT_DOMAINS: カンマ区切りのドメイン(Let's Encryptを使う場合)
+// TLS_AUTOCERT_CACHE_DIR: 取得した証明書の保存先(デフォルト: "certs")
+// HTTP_REDIRECT_ADDR: HTTP→HTTPSリダイレクト用サーバーのアドレス
+func loadTLSOptions() TLSOptions {
+	options := TLSOptions{
+		CertFile:         os.Getenv("TLS_CERT_FILE"),
+		KeyFile:          os.Getenv("TLS_KEY_FILE"),
+		AutocertCacheDir: os.Getenv("TLS_AUTOCERT_CACHE_DIR"),
+		RedirectAddr:     os.Getenv("HTTP_REDIRECT_ADDR"),
+	}
+	if domains := os.Getenv("TLS_AUTOCERT_DOMAINS"); domains != "" {
+		for _, domain := range strings.Split(domains, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				options.AutocertDomains = append(options.AutocertDomains, domain)
+			}
+		}
+	}
+	if options.AutocertCacheDir == "" {
+		options.AutocertCacheDir = "certs"
+	}
+	return options
+}
+
+// listen 設定に応じてHTTPまたはHTTPSでサーバーを起動し、起動したサーバーを返す
+// 待ち受けに失敗した場合はerrsにエラーを送る。Shutdownで止めた場合は送らない
+func listen(addr string, handler http.Handler, options TLSOptions, errs chan<- error) []*http.Server {
+	server := &http.Server{Addr: addr, Handler: handler}
+	if !options.Enabled() {
+		slog.Info("サーバーを起動しました", "addr", addr)
+		go report(errs, server.ListenAndServe)
+		return []*http.Server{server}
+	}
+
+	server.TLSConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	// リダイレクト用のハンドラー(autocertの場合はHTTP-01チャレンジにも応答する)
+	var redirect http.Handler = http.HandlerFunc(redirectToHTTPS(addr))
+
+	if len(options.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(options.AutocertDomains...),
+			Cache:      autocert.DirCache(options.AutocertCacheDir),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		redirect = manager.HTTPHandler(redirect)
+	}
+
+	servers := []*http.Server{server}
+	if options.RedirectAddr != "" {
+		redirectServer := &http.Server{Addr: options.RedirectAddr, Handler: redirect}
+		servers = append(servers, redirectServer)
+		go func() {
+			slog.Info("HTTP→HTTPSリダイレクトサーバーを起動します", "addr", options.RedirectAddr)
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("リダイレクトサーバーエラー", logging.Err(err))
+			}
+		}()
+	}
+
+	slog.Info("サーバーを起動しました", "addr", addr, "tls", true)
+	// autocertの場合は証明書をTLSConfigから取得するのでファイルは空でよい
+	go report(errs, func() error { return server.ListenAndServeTLS(options.CertFile, options.KeyFile) })
+	return servers
+}
+
+// report 待ち受けを終えたときのエラーをerrsに送る。Shutdownで止めた場合は送らない
+func report(errs chan<- error, serve func() error) {
+	if err := serve(); !errors.Is(err, http.ErrServerClosed) {
+		errs <- err
+	}
+}
+
+// redirectToHTTPS 同じホストのHTTPSのURLへリダイレクトする
+func redirectToHTTPS(httpsAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
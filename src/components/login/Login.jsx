@@ -15,7 +15,7 @@ const Login = () => {
     e.preventDefault();
 
     try {
-      const response = await fetch('http://localhost:8080/login', {
+      const response = await fetch('http://localhost:8080/auth/login', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -30,10 +30,10 @@ const Login = () => {
       const data = await response.json();
 
       if (response.ok) {
-        alert(data.message); // ログイン成功メッセージ
+        alert('ログインに成功しました');
         navigate('/');  // ホーム画面へ遷移
       } else {
-        alert(data.message || 'ログインに失敗しました'); // エラーメッセージを表示
+        alert(data.error?.message || 'ログインに失敗しました'); // エラーメッセージを表示
       }
     } catch (error) {
       alert('ログイン処理中にエラーが発生しました');